@@ -0,0 +1,195 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// AddressList is a set of networks, as read from a --blocklist-file or
+// --allowlist-file.
+type AddressList struct {
+	// ranges are the first and last addresses of the networks, in 16-byte
+	// form, sorted and merged.
+	ranges [][2]net.IP
+}
+
+// ReadAddressList reads a list of networks, one per line: CIDR blocks, IP
+// addresses or FIRST-LAST ranges. Text after a # is a comment.
+func ReadAddressList(source io.Reader) (*AddressList, error) {
+	var ranges [][2]net.IP
+	scanner := bufio.NewScanner(source)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		var first, last net.IP
+		if ip := net.ParseIP(text); ip != nil {
+			first, last = ip, ip
+		} else if _, ipnet, err := net.ParseCIDR(text); err == nil {
+			first = ipnet.IP
+			last = make(net.IP, len(ipnet.IP))
+			for i := range ipnet.IP {
+				last[i] = ipnet.IP[i] | ^ipnet.Mask[i]
+			}
+		} else if start, end, ok := parseIPRange(text); ok {
+			first, last = start, end
+		} else {
+			return nil, fmt.Errorf("line %d: can't parse %q as an IP address, CIDR block or range", line, text)
+		}
+		ranges = append(ranges, [2]net.IP{first.To16(), last.To16()})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i][0], ranges[j][0]) < 0
+	})
+	ret := new(AddressList)
+	for _, r := range ranges {
+		if n := len(ret.ranges); n > 0 && bytes.Compare(r[0], ret.ranges[n-1][1]) <= 0 {
+			if bytes.Compare(r[1], ret.ranges[n-1][1]) > 0 {
+				ret.ranges[n-1][1] = r[1]
+			}
+			continue
+		}
+		ret.ranges = append(ret.ranges, r)
+	}
+	return ret, nil
+}
+
+// ReadAddressListFile reads a list of networks from a file.
+func ReadAddressListFile(path string) (*AddressList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadAddressList(f)
+}
+
+// Contains returns true if ip is in one of the networks of the list.
+func (l *AddressList) Contains(ip net.IP) bool {
+	ip = ip.To16()
+	if ip == nil {
+		return false
+	}
+	// The first range that ends at or after ip.
+	i := sort.Search(len(l.ranges), func(i int) bool {
+		return bytes.Compare(l.ranges[i][1], ip) >= 0
+	})
+	return i < len(l.ranges) && bytes.Compare(l.ranges[i][0], ip) <= 0
+}
+
+// errAddressBlocked is the error of connections to addresses excluded by
+// --blocklist-file or --allowlist-file.
+var errAddressBlocked = errors.New("address excluded by the blocklist or allowlist")
+
+// AddressPolicyStats counts the targets and connections excluded by
+// --blocklist-file and --allowlist-file.
+type AddressPolicyStats struct {
+	TargetsSkipped     int64 `json:"targets_skipped"`
+	ConnectionsBlocked int64 `json:"connections_blocked"`
+}
+
+// AddressPolicy, as --blocklist-file and --allowlist-file, excludes
+// addresses from a Runner's input targets, and from the connections dialed
+// through the framework for its targets.
+type AddressPolicy struct {
+	blocklist *AddressList
+	allowlist *AddressList
+	stats     AddressPolicyStats
+}
+
+// allowed returns true if ip may be scanned: it is in the allowlist, if
+// there is one, and not in the blocklist.
+func (p *AddressPolicy) allowed(ip net.IP) bool {
+	if p.allowlist != nil && !p.allowlist.Contains(ip) {
+		return false
+	}
+	return p.blocklist == nil || !p.blocklist.Contains(ip)
+}
+
+// checkAddress returns errAddressBlocked if the host of address is an IP
+// address that may not be scanned.
+func (p *AddressPolicy) checkAddress(address string) error {
+	if p == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if ip := net.ParseIP(host); ip != nil && !p.allowed(ip) {
+		atomic.AddInt64(&p.stats.ConnectionsBlocked, 1)
+		return errAddressBlocked
+	}
+	return nil
+}
+
+// dialControl returns the net.Dialer Control function that rejects the
+// connections to blocked addresses, after name resolution. It is nil without
+// a policy.
+func (p *AddressPolicy) dialControl() func(network, address string, c syscall.RawConn) error {
+	if p == nil {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		return p.checkAddress(address)
+	}
+}
+
+// filterTargets returns an InputTargetsFunc that passes on the targets of
+// input with an address that may be scanned. Targets given by domain are
+// checked when they are dialed.
+func (p *AddressPolicy) filterTargets(input InputTargetsFunc) InputTargetsFunc {
+	return func(ch chan<- ScanTarget) error {
+		return pipeTargets(input, ch, func(targets <-chan ScanTarget) {
+			for target := range targets {
+				if target.IP != nil && !p.allowed(target.IP) {
+					atomic.AddInt64(&p.stats.TargetsSkipped, 1)
+					continue
+				}
+				ch <- target
+			}
+		})
+	}
+}
+
+// NewAddressPolicy returns the AddressPolicy that excludes the addresses
+// outside allowlist, if it is not nil, and those in blocklist.
+func NewAddressPolicy(blocklist *AddressList, allowlist *AddressList) *AddressPolicy {
+	return &AddressPolicy{blocklist: blocklist, allowlist: allowlist}
+}
+
+// Stats returns the counts of the targets and connections excluded by the
+// policy, or nil without a policy.
+func (p *AddressPolicy) Stats() *AddressPolicyStats {
+	if p == nil {
+		return nil
+	}
+	return &AddressPolicyStats{
+		TargetsSkipped:     atomic.LoadInt64(&p.stats.TargetsSkipped),
+		ConnectionsBlocked: atomic.LoadInt64(&p.stats.ConnectionsBlocked),
+	}
+}
+
+// GetAddressPolicyStats returns the counts of the targets and connections
+// excluded by --blocklist-file and --allowlist-file, or nil if neither is
+// set.
+func GetAddressPolicyStats() *AddressPolicyStats {
+	return config.addressPolicy.Stats()
+}
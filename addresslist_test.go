@@ -0,0 +1,83 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddressList(t *testing.T) {
+	list, err := ReadAddressList(strings.NewReader(`
+# do not scan
+10.0.0.0/8
+192.168.1.1   # a single host
+192.168.2.10-192.168.2.20
+10.1.0.0/16
+2001:db8::/32
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.ranges) != 4 {
+		t.Errorf("got ranges %v", list.ranges)
+	}
+	tests := map[string]bool{
+		"10.0.0.1":        true,
+		"10.255.255.255":  true,
+		"11.0.0.0":        false,
+		"192.168.1.1":     true,
+		"192.168.1.2":     false,
+		"192.168.2.9":     false,
+		"192.168.2.20":    true,
+		"2001:db8::1":     true,
+		"2001:db9::1":     false,
+		"::ffff:10.0.0.1": true,
+	}
+	for ip, expected := range tests {
+		if actual := list.Contains(net.ParseIP(ip)); actual != expected {
+			t.Errorf("%s: got %v", ip, actual)
+		}
+	}
+	if _, err := ReadAddressList(strings.NewReader("10.0.0.0/8\nexample.com\n")); err == nil {
+		t.Error("expected an error for a domain")
+	}
+}
+
+func TestAddressPolicy(t *testing.T) {
+	blocklist, _ := ReadAddressList(strings.NewReader("127.0.0.0/8\n10.0.0.2\n"))
+	allowlist, _ := ReadAddressList(strings.NewReader("10.0.0.0/24\n127.0.0.1\n"))
+	policy := NewAddressPolicy(blocklist, allowlist)
+	targets := collectTargets(t, policy.filterTargets(csvInput("10.0.0.1\n10.0.0.2\n10.0.1.1\nexample.com\n")))
+	if !reflect.DeepEqual(targets, []string{"10.0.0.1/", "example.com/"}) {
+		t.Errorf("got %v", targets)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	port := uint(listener.Addr().(*net.TCPAddr).Port)
+	target := ScanTarget{IP: net.ParseIP("127.0.0.1"), Port: &port, dialOpts: &dialOptions{policy: policy}}
+	if _, err := target.Open(&BaseFlags{Timeout: time.Second}); TryGetScanStatus(err) != SCAN_BLOCKED {
+		t.Errorf("got %v", err)
+	}
+	dialer := NewDialer(&Dialer{Timeout: time.Second, Target: &target})
+	if _, err := dialer.DialContext(context.Background(), "tcp", listener.Addr().String()); TryGetScanStatus(err) != SCAN_BLOCKED {
+		t.Errorf("got %v", err)
+	}
+	if stats := policy.Stats(); stats.TargetsSkipped != 2 || stats.ConnectionsBlocked != 2 {
+		t.Errorf("got stats %+v", stats)
+	}
+
+	// The targets of other runners are not subject to the policy.
+	target.dialOpts = nil
+	conn, err := target.Open(&BaseFlags{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,218 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Alert is the message sent to the alert sinks for a matching result. It is
+// POSTed as-is to --alert-webhook, and used as the body of --alert-smtp
+// e-mails.
+type Alert struct {
+	IP     string `json:"ip,omitempty"`
+	Domain string `json:"domain,omitempty"`
+
+	// Modules are the scanners whose status matched --alert-status.
+	Modules []string `json:"modules,omitempty"`
+
+	// Matched are the --alert-contains strings found in the result.
+	Matched []string `json:"matched,omitempty"`
+
+	// Result is the full output line for the target.
+	Result json.RawMessage `json:"result"`
+}
+
+// alerter checks each output line against the alert criteria and delivers
+// alerts for the matching ones to the configured sinks.
+type alerter struct {
+	statuses map[ScanStatus]bool
+	contains []string
+	max      int
+	sent     int
+
+	webhook string
+	client  *http.Client
+
+	smtpAddr string
+	smtpAuth smtp.Auth
+	from     string
+	to       []string
+}
+
+// newAlerter returns an alerter for the --alert-* options, or nil if no alert
+// sink is configured.
+func newAlerter(c *Config) (*alerter, error) {
+	if c.AlertWebhook == "" && c.AlertSMTP == "" {
+		return nil, nil
+	}
+	a := &alerter{
+		statuses: make(map[ScanStatus]bool),
+		max:      c.AlertMax,
+		webhook:  c.AlertWebhook,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		smtpAddr: c.AlertSMTP,
+		from:     c.AlertSMTPFrom,
+	}
+	for _, status := range strings.Split(c.AlertStatus, ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			a.statuses[ScanStatus(status)] = true
+		}
+	}
+	for _, s := range strings.Split(c.AlertContains, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			a.contains = append(a.contains, s)
+		}
+	}
+	if len(a.statuses) == 0 && len(a.contains) == 0 {
+		return nil, fmt.Errorf("at least one of --alert-status and --alert-contains is required")
+	}
+	if a.smtpAddr != "" {
+		host, _, err := net.SplitHostPort(a.smtpAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --alert-smtp: %s", err)
+		}
+		for _, to := range strings.Split(c.AlertSMTPTo, ",") {
+			if to = strings.TrimSpace(to); to != "" {
+				a.to = append(a.to, to)
+			}
+		}
+		if a.from == "" || len(a.to) == 0 {
+			return nil, fmt.Errorf("--alert-smtp requires --alert-smtp-from and --alert-smtp-to")
+		}
+		if c.AlertSMTPUser != "" {
+			a.smtpAuth = smtp.PlainAuth("", c.AlertSMTPUser, c.AlertSMTPPassword, host)
+		}
+	}
+	return a, nil
+}
+
+// match returns the alert for an output line, or nil if the line does not
+// match every configured criterion.
+func (a *alerter) match(result []byte) *Alert {
+	var grab struct {
+		IP     string `json:"ip"`
+		Domain string `json:"domain"`
+		Data   map[string]struct {
+			Status ScanStatus `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(result, &grab); err != nil {
+		return nil
+	}
+	alert := &Alert{IP: grab.IP, Domain: grab.Domain, Result: json.RawMessage(result)}
+	if len(a.statuses) > 0 {
+		for name, response := range grab.Data {
+			if a.statuses[response.Status] {
+				alert.Modules = append(alert.Modules, name)
+			}
+		}
+		if len(alert.Modules) == 0 {
+			return nil
+		}
+	}
+	if len(a.contains) > 0 {
+		for _, s := range a.contains {
+			if bytes.Contains(result, []byte(s)) {
+				alert.Matched = append(alert.Matched, s)
+			}
+		}
+		if len(alert.Matched) == 0 {
+			return nil
+		}
+	}
+	return alert
+}
+
+// target returns a short description of the alert's target.
+func (alert *Alert) target() string {
+	if alert.Domain != "" && alert.IP != "" {
+		return alert.Domain + " (" + alert.IP + ")"
+	}
+	return alert.Domain + alert.IP
+}
+
+// send delivers the alert to every configured sink.
+func (a *alerter) send(alert *Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	if a.webhook != "" {
+		resp, err := a.client.Post(a.webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned %s", resp.Status)
+		}
+	}
+	if a.smtpAddr != "" {
+		var msg bytes.Buffer
+		fmt.Fprintf(&msg, "From: %s\r\n", a.from)
+		fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(a.to, ", "))
+		fmt.Fprintf(&msg, "Subject: zgrab2 alert: %s\r\n", alert.target())
+		fmt.Fprintf(&msg, "Content-Type: application/json\r\n\r\n")
+		msg.Write(body)
+		msg.WriteString("\r\n")
+		if err := smtp.SendMail(a.smtpAddr, a.smtpAuth, a.from, a.to, msg.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wrap returns an OutputResultsFunc that passes the results on to next,
+// sending alerts for the matching ones in the background. At most --alert-max
+// alerts are sent; alerts are dropped if the sinks fall behind.
+func (a *alerter) wrap(next OutputResultsFunc) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		alerts := make(chan *Alert, 100)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for alert := range alerts {
+				if err := a.send(alert); err != nil {
+					log.Errorf("Could not send alert for %s: %v", alert.target(), err)
+				}
+			}
+		}()
+		defer wg.Wait()
+		defer close(alerts)
+
+		passed := make(chan []byte)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- next(passed)
+		}()
+		for result := range results {
+			if a.max <= 0 || a.sent < a.max {
+				if alert := a.match(result); alert != nil {
+					select {
+					case alerts <- alert:
+						a.sent++
+					default:
+						log.Warnf("Alert queue full, dropping alert for %s", alert.target())
+					}
+				}
+			}
+			select {
+			case passed <- result:
+			case err := <-errs:
+				return err
+			}
+		}
+		close(passed)
+		return <-errs
+	}
+}
@@ -0,0 +1,89 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestAlerterMatch(t *testing.T) {
+	a, err := newAlerter(&Config{AlertWebhook: "http://localhost/", AlertStatus: "success", AlertContains: "abcd,ef01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		result  string
+		modules []string
+		matched []string
+	}{
+		{`{"ip":"192.0.2.1","data":{"tls":{"status":"success","result":{"fp":"abcd"}}}}`, []string{"tls"}, []string{"abcd"}},
+		{`{"ip":"192.0.2.1","data":{"tls":{"status":"success-not-contain"}},"x":"abcd"}`, nil, nil},
+		{`{"ip":"192.0.2.1","data":{"tls":{"status":"success","result":{"fp":"1234"}}}}`, nil, nil},
+		{`not json`, nil, nil},
+	}
+	for _, test := range tests {
+		alert := a.match([]byte(test.result))
+		if test.modules == nil {
+			if alert != nil {
+				t.Errorf("%s: unexpected alert %+v", test.result, alert)
+			}
+			continue
+		}
+		if alert == nil {
+			t.Errorf("%s: no alert", test.result)
+			continue
+		}
+		if len(alert.Modules) != 1 || alert.Modules[0] != test.modules[0] || len(alert.Matched) != 1 || alert.Matched[0] != test.matched[0] {
+			t.Errorf("%s: wrong alert %+v", test.result, alert)
+		}
+	}
+
+	if _, err := newAlerter(&Config{AlertSMTP: "localhost:25", AlertStatus: "success"}); err == nil {
+		t.Error("--alert-smtp without recipients accepted")
+	}
+}
+
+func TestAlerterWebhook(t *testing.T) {
+	var mutex sync.Mutex
+	var received []Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var alert Alert
+		if err := json.Unmarshal(body, &alert); err != nil {
+			t.Errorf("bad alert body %q: %v", body, err)
+		}
+		mutex.Lock()
+		received = append(received, alert)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	a, err := newAlerter(&Config{AlertWebhook: server.URL, AlertStatus: "success", AlertMax: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output [][]byte
+	outputFunc := a.wrap(func(results <-chan []byte) error {
+		for result := range results {
+			output = append(output, result)
+		}
+		return nil
+	})
+	results := make(chan []byte, 3)
+	results <- []byte(`{"ip":"192.0.2.1","data":{"tls":{"status":"success"}}}`)
+	results <- []byte(`{"ip":"192.0.2.2","data":{"tls":{"status":"io-timeout"}}}`)
+	results <- []byte(`{"ip":"192.0.2.3","data":{"tls":{"status":"success"}}}`)
+	close(results)
+	if err := outputFunc(results); err != nil {
+		t.Fatal(err)
+	}
+	if len(output) != 3 {
+		t.Errorf("expected all 3 results to be passed through, got %d", len(output))
+	}
+	if len(received) != 1 || received[0].IP != "192.0.2.1" {
+		t.Errorf("expected a single alert for 192.0.2.1 (--alert-max 1), got %+v", received)
+	}
+}
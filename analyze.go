@@ -0,0 +1,318 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// AnalyzeCommand holds the options of the analyze command, which reads the
+// JSON output of earlier scans (the files given as arguments, or the input
+// file) and writes a report to the output file instead of scanning.
+type AnalyzeCommand struct {
+	Report string `long:"report" default:"status" choice:"status" choice:"certificates" choice:"banners" choice:"pivot" description:"Report to write: result counts by module and status, the most common certificates, clusters of similar banners, or the values of --pivot"`
+	Filter string `long:"filter" description:"Only analyze the output lines matching this --filter-expr style expression, e.g. .data.http.status == 'success'"`
+	Pivot  string `long:"pivot" description:"Path of the value to count with --report pivot, e.g. .data.http.result.response.status_code"`
+	Module string `long:"module" description:"Only consider the results of this module (scanner name) for the status, certificates and banners reports"`
+	Top    int    `long:"top" default:"20" description:"Number of rows to write, most frequent first (0 = all)"`
+	JSON   bool   `long:"json" description:"Write the report as JSON instead of a table"`
+
+	files  []string
+	filter *FilterExpression
+	pivot  *FilterExpression
+}
+
+// Validate checks the analyze options, and keeps the file arguments.
+func (x *AnalyzeCommand) Validate(args []string) error {
+	var err error
+	if x.Filter != "" {
+		if x.filter, err = ParseFilterExpression(x.Filter); err != nil {
+			return fmt.Errorf("invalid --filter: %s", err)
+		}
+	}
+	if x.Report == "pivot" {
+		if x.Pivot == "" {
+			return errors.New("--report pivot requires --pivot")
+		}
+		if x.pivot, err = ParseFilterExpression(x.Pivot); err != nil {
+			return fmt.Errorf("invalid --pivot: %s", err)
+		}
+	} else if x.Pivot != "" {
+		return errors.New("--pivot requires --report pivot")
+	}
+	if x.Top < 0 {
+		return errors.New("--top must not be negative")
+	}
+	x.files = args
+	return nil
+}
+
+// Help returns a usage string that will be output at the command line
+func (x *AnalyzeCommand) Help() string {
+	return "Reads the JSON output of earlier scans from the files given as arguments (or the input file) and writes a report"
+}
+
+// Run reads the results and writes the report to the output file.
+func (x *AnalyzeCommand) Run() error {
+	output, err := commandOutput()
+	if err != nil {
+		return err
+	}
+	var sources []io.Reader
+	for _, name := range x.files {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		sources = append(sources, file)
+	}
+	if len(sources) == 0 {
+		sources = append(sources, config.inputFile)
+	}
+	return x.analyze(io.MultiReader(sources...), output)
+}
+
+// analyzeReport is the output of the analyze command.
+type analyzeReport struct {
+	Report  string   `json:"report"`
+	Lines   int      `json:"lines"`
+	Matched int      `json:"matched"`
+	Columns []string `json:"columns"`
+
+	// Distinct is the number of distinct rows before --top.
+	Distinct int          `json:"distinct"`
+	Rows     []analyzeRow `json:"rows"`
+}
+
+type analyzeRow struct {
+	Values []string `json:"values"`
+	Count  int      `json:"count"`
+}
+
+// analyzeCounter counts the rows of a report, keeping them in the order
+// they were first seen.
+type analyzeCounter struct {
+	rows  []*analyzeRow
+	index map[string]*analyzeRow
+}
+
+func (c *analyzeCounter) add(values ...string) {
+	c.addKeyed(strings.Join(values, "\x00"), values...)
+}
+
+// addKeyed counts a row identified by key; the values are those of the
+// first row with the key.
+func (c *analyzeCounter) addKeyed(key string, values ...string) {
+	row, ok := c.index[key]
+	if !ok {
+		row = &analyzeRow{Values: values}
+		c.index[key] = row
+		c.rows = append(c.rows, row)
+	}
+	row.Count++
+}
+
+// analyzeColumns are the columns of each report; the pivot column is
+// named after the path.
+var analyzeColumns = map[string][]string{
+	"status":       {"module", "status"},
+	"certificates": {"fingerprint_sha256", "subject_dn"},
+	"banners":      {"module", "cluster", "example"},
+}
+
+// analyze reads the output lines from source, and writes the report to w.
+// Lines that are not JSON objects are skipped.
+func (x *AnalyzeCommand) analyze(source io.Reader, w io.Writer) error {
+	report := &analyzeReport{Report: x.Report, Columns: analyzeColumns[x.Report]}
+	if x.Report == "pivot" {
+		report.Columns = []string{x.Pivot}
+	}
+	counter := &analyzeCounter{index: make(map[string]*analyzeRow)}
+	reader := bufio.NewReader(source)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			report.Lines++
+			var record map[string]interface{}
+			if json.Unmarshal(line, &record) == nil && (x.filter == nil || filterTruth(x.filter.Value(record))) {
+				report.Matched++
+				x.count(counter, record)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	rows := counter.rows
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Count > rows[j].Count
+	})
+	report.Distinct = len(rows)
+	if x.Top > 0 && len(rows) > x.Top {
+		rows = rows[:x.Top]
+	}
+	report.Rows = make([]analyzeRow, len(rows))
+	for i, row := range rows {
+		report.Rows[i] = *row
+	}
+	if x.JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return report.writeTable(w)
+}
+
+// count adds the rows of a record to the counter.
+func (x *AnalyzeCommand) count(counter *analyzeCounter, record map[string]interface{}) {
+	if x.Report == "pivot" {
+		counter.add(analyzeValueString(x.pivot.Value(record)))
+		return
+	}
+	data, _ := record["data"].(map[string]interface{})
+	modules := make([]string, 0, len(data))
+	for module := range data {
+		if x.Module == "" || module == x.Module {
+			modules = append(modules, module)
+		}
+	}
+	sort.Strings(modules)
+	// A certificate seen by several modules of a record is counted once.
+	certificates := make(map[string]bool)
+	for _, module := range modules {
+		response, _ := data[module].(map[string]interface{})
+		switch x.Report {
+		case "status":
+			status, _ := response["status"].(string)
+			counter.add(module, status)
+		case "certificates":
+			walkJSON(response["result"], func(key string, value interface{}) {
+				if key != "server_certificates" {
+					return
+				}
+				parsed, _ := filterPath{"certificate", "parsed"}.eval(value).(map[string]interface{})
+				fingerprint, _ := parsed["fingerprint_sha256"].(string)
+				if fingerprint != "" && !certificates[fingerprint] {
+					certificates[fingerprint] = true
+					subject, _ := parsed["subject_dn"].(string)
+					counter.add(fingerprint, subject)
+				}
+			})
+		case "banners":
+			walkJSON(response["result"], func(key string, value interface{}) {
+				var banner string
+				switch key {
+				case "banner":
+					banner, _ = value.(string)
+				case "server_id":
+					// ssh
+					banner, _ = filterPath{"raw"}.eval(value).(string)
+				case "headers":
+					// The Server header of http
+					banner, _ = filterPath{"server", 0}.eval(value).(string)
+				}
+				banner = firstLine(banner)
+				if banner == "" {
+					return
+				}
+				// The example of a cluster is its first banner.
+				cluster := bannerCluster(banner)
+				counter.addKeyed(module+"\x00"+cluster, module, cluster, banner)
+			})
+		}
+	}
+}
+
+// walkJSON calls f for each key and value of the objects in a decoded JSON
+// value, recursively.
+func walkJSON(v interface{}, f func(key string, value interface{})) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for key := range t {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f(key, t[key])
+			walkJSON(t[key], f)
+		}
+	case []interface{}:
+		for _, element := range t {
+			walkJSON(element, f)
+		}
+	}
+}
+
+// firstLine returns the first non-empty line of s, trimmed.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// bannerHostRegex matches a host name token of a banner.
+var bannerHostRegex = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}$`)
+
+// bannerDigitsRegex matches the numbers of a banner.
+var bannerDigitsRegex = regexp.MustCompile(`[0-9]+`)
+
+// bannerCluster returns the cluster of a banner line: host names are
+// replaced with <host> and numbers (versions, dates, addresses) with #, so
+// that the banners of one software differing only in those fall together.
+func bannerCluster(banner string) string {
+	fields := strings.Fields(banner)
+	for i, field := range fields {
+		if bannerHostRegex.MatchString(strings.Trim(field, "()[]<>,;:")) {
+			fields[i] = "<host>"
+		}
+	}
+	return bannerDigitsRegex.ReplaceAllString(strings.Join(fields, " "), "#")
+}
+
+// analyzeValueString formats a pivot value: strings as they are, missing
+// values as (missing), and anything else as JSON.
+func analyzeValueString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "(missing)"
+	case string:
+		return t
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(encoded)
+}
+
+// writeTable writes the report as a table preceded by the line counts.
+func (report *analyzeReport) writeTable(w io.Writer) error {
+	fmt.Fprintf(w, "lines: %d, matched: %d, distinct: %d\n", report.Lines, report.Matched, report.Distinct)
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "COUNT\t"+strings.ToUpper(strings.Join(report.Columns, "\t")))
+	for _, row := range report.Rows {
+		values := make([]string, len(row.Values))
+		for i, value := range row.Values {
+			values[i] = strings.Replace(value, "\t", " ", -1)
+		}
+		fmt.Fprintf(table, "%d\t%s\n", row.Count, strings.Join(values, "\t"))
+	}
+	return table.Flush()
+}
@@ -0,0 +1,106 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const analyzeInput = `{"ip":"10.0.0.1","data":{"ssh":{"status":"success","result":{"server_id":{"raw":"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6"}}},"https":{"status":"success","result":{"response":{"status_code":200,"headers":{"server":["nginx/1.18.0"]},"request":{"tls_log":{"handshake_log":{"server_certificates":{"certificate":{"parsed":{"fingerprint_sha256":"aa","subject_dn":"CN=a.example"}}}}}}}}},"tls":{"status":"success","result":{"handshake_log":{"server_certificates":{"certificate":{"parsed":{"fingerprint_sha256":"aa","subject_dn":"CN=a.example"}}}}}}}}
+{"ip":"10.0.0.2","data":{"ssh":{"status":"success","result":{"server_id":{"raw":"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.10"}}},"https":{"status":"connection-timeout"},"tls":{"status":"success","result":{"handshake_log":{"server_certificates":{"certificate":{"parsed":{"fingerprint_sha256":"bb","subject_dn":"CN=b.example"}}}}}}}}
+this line is not JSON
+
+{"ip":"10.0.0.3","data":{"ftp":{"status":"success","result":{"banner":"220 ftp.example.com FTP server (vsFTPd 3.0.3) ready.\r\n"}},"tls":{"status":"success","result":{"handshake_log":{"server_certificates":{"certificate":{"parsed":{"fingerprint_sha256":"aa","subject_dn":"CN=a.example"}}}}}}}}
+`
+
+func runAnalyze(t *testing.T, x *AnalyzeCommand) *analyzeReport {
+	if err := x.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	x.JSON = true
+	var out bytes.Buffer
+	if err := x.analyze(strings.NewReader(analyzeInput), &out); err != nil {
+		t.Fatal(err)
+	}
+	report := new(analyzeReport)
+	if err := json.Unmarshal(out.Bytes(), report); err != nil {
+		t.Fatalf("bad output %s: %v", out.String(), err)
+	}
+	return report
+}
+
+func checkAnalyzeRows(t *testing.T, report *analyzeReport, expected ...string) {
+	t.Helper()
+	var rows []string
+	for _, row := range report.Rows {
+		rows = append(rows, fmt.Sprintf("%d %s", row.Count, strings.Join(row.Values, "|")))
+	}
+	if strings.Join(rows, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("%s report:\n%s\nexpected:\n%s", report.Report, strings.Join(rows, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestAnalyzeStatus(t *testing.T) {
+	report := runAnalyze(t, &AnalyzeCommand{Report: "status"})
+	if report.Lines != 4 || report.Matched != 3 || report.Distinct != 5 {
+		t.Errorf("unexpected counts %+v", report)
+	}
+	checkAnalyzeRows(t, report, "3 tls|success", "2 ssh|success", "1 https|success", "1 https|connection-timeout", "1 ftp|success")
+
+	report = runAnalyze(t, &AnalyzeCommand{Report: "status", Module: "https", Filter: ".ip != '10.0.0.3'", Top: 1})
+	if report.Matched != 2 || report.Distinct != 2 {
+		t.Errorf("unexpected counts %+v", report)
+	}
+	checkAnalyzeRows(t, report, "1 https|success")
+}
+
+func TestAnalyzeCertificates(t *testing.T) {
+	// The certificate seen by both https and tls in the first line is
+	// counted once.
+	report := runAnalyze(t, &AnalyzeCommand{Report: "certificates"})
+	checkAnalyzeRows(t, report, "2 aa|CN=a.example", "1 bb|CN=b.example")
+}
+
+func TestAnalyzeBanners(t *testing.T) {
+	report := runAnalyze(t, &AnalyzeCommand{Report: "banners"})
+	checkAnalyzeRows(t, report,
+		"2 ssh|SSH-#.#-OpenSSH_#.#p# Ubuntu-#ubuntu#.#|SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6",
+		"1 https|nginx/#.#.#|nginx/1.18.0",
+		"1 ftp|# <host> FTP server (vsFTPd #.#.#) ready.|220 ftp.example.com FTP server (vsFTPd 3.0.3) ready.")
+}
+
+func TestAnalyzePivot(t *testing.T) {
+	report := runAnalyze(t, &AnalyzeCommand{Report: "pivot", Pivot: ".data.https.result.response.status_code"})
+	checkAnalyzeRows(t, report, "2 (missing)", "1 200")
+	if len(report.Columns) != 1 || report.Columns[0] != ".data.https.result.response.status_code" {
+		t.Errorf("unexpected columns %v", report.Columns)
+	}
+}
+
+func TestAnalyzeValidate(t *testing.T) {
+	for _, x := range []*AnalyzeCommand{
+		{Report: "pivot"},
+		{Report: "status", Pivot: ".ip"},
+		{Report: "status", Filter: ".ip =="},
+		{Report: "status", Top: -1},
+	} {
+		if err := x.Validate(nil); err == nil {
+			t.Errorf("expected an error for %+v", x)
+		}
+	}
+}
+
+func TestAnalyzeTable(t *testing.T) {
+	x := &AnalyzeCommand{Report: "status", Module: "ftp"}
+	x.Validate(nil)
+	var out bytes.Buffer
+	if err := x.analyze(strings.NewReader(analyzeInput), &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "lines: 4, matched: 3, distinct: 1\nCOUNT  MODULE  STATUS\n1      ftp     success\n"
+	if out.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
@@ -0,0 +1,134 @@
+package zgrab2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultPortModules maps well-known ports to the module used for them in
+// --auto-module mode.
+var defaultPortModules = map[uint]string{
+	21:    "ftp",
+	22:    "ssh",
+	23:    "telnet",
+	25:    "smtp",
+	80:    "http",
+	102:   "siemens",
+	110:   "pop3",
+	123:   "ntp",
+	143:   "imap",
+	443:   "tls",
+	445:   "smb",
+	465:   "smtp",
+	502:   "modbus",
+	587:   "smtp",
+	631:   "ipp",
+	993:   "imap",
+	995:   "pop3",
+	1433:  "mssql",
+	1521:  "oracle",
+	1911:  "fox",
+	3306:  "mysql",
+	4911:  "fox",
+	5432:  "postgres",
+	6379:  "redis",
+	8000:  "http",
+	8008:  "http",
+	8080:  "http",
+	8443:  "tls",
+	8888:  "http",
+	20000: "dnp3",
+	27017: "mongodb",
+	47808: "bacnet",
+}
+
+// parsePortModules returns the port to module map for --auto-module: the
+// defaults with the comma-separated PORT=MODULE overrides applied, or those
+// of the file named after a @, one per line with # comments. An empty
+// MODULE removes the port from the map.
+func parsePortModules(overrides string) (map[uint]string, error) {
+	ret := make(map[uint]string, len(defaultPortModules))
+	for port, module := range defaultPortModules {
+		ret[port] = module
+	}
+	list := strings.Split(overrides, ",")
+	if strings.HasPrefix(overrides, "@") {
+		data, err := ioutil.ReadFile(overrides[1:])
+		if err != nil {
+			return nil, err
+		}
+		list = strings.Split(string(data), "\n")
+	}
+	for _, override := range list {
+		if i := strings.IndexByte(override, '#'); i >= 0 {
+			override = override[:i]
+		}
+		if override = strings.TrimSpace(override); override == "" {
+			continue
+		}
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected PORT=MODULE, got %q", override)
+		}
+		port, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid port in %q", override)
+		}
+		if module := strings.TrimSpace(parts[1]); module != "" {
+			ret[uint(port)] = module
+		} else {
+			delete(ret, uint(port))
+		}
+	}
+	return ret, nil
+}
+
+// resolveAutoModules maps each port of config.portModules to the registered
+// scanners that handle it: the scanners named like the module if there are
+// any, otherwise those with that protocol. Ports whose module has no
+// scanner are left out.
+func resolveAutoModules() map[uint][]string {
+	ret := make(map[uint][]string)
+	missing := make(map[string]bool)
+	for port, module := range config.portModules {
+		var byName, byProtocol []string
+		for _, name := range orderedScanners {
+			scanner := *scanners[name]
+			if name == module {
+				byName = append(byName, name)
+			} else if scanner.Protocol() == module {
+				byProtocol = append(byProtocol, name)
+			}
+		}
+		switch {
+		case len(byName) > 0:
+			ret[port] = byName
+		case len(byProtocol) > 0:
+			ret[port] = byProtocol
+		default:
+			missing[module] = true
+		}
+	}
+	if len(missing) > 0 {
+		var names []string
+		for module := range missing {
+			names = append(names, module)
+		}
+		sort.Strings(names)
+		log.Infof("--auto-module: no scanner configured for %s, targets on their ports are skipped", strings.Join(names, ", "))
+	}
+	return ret
+}
+
+// InputTargetsAutoModule is an InputTargetsFunc for --auto-module. It reads
+// the same CSV input as InputTargetsCSV, but the address field may carry a
+// port (ADDRESS:PORT, [IPv6]:PORT), which selects the scanners for untagged
+// records.
+func InputTargetsAutoModule(ch chan<- ScanTarget) error {
+	return getTargetsCSV(config.inputFile, ch, true, nil)
+}
@@ -0,0 +1,75 @@
+package zgrab2
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParsePortModules(t *testing.T) {
+	ports, err := parsePortModules("8443=http, 2222=ssh,23=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint]string{8443: "http", 2222: "ssh", 22: "ssh", 443: "tls"}
+	for port, module := range expected {
+		if ports[port] != module {
+			t.Errorf("port %d: got %q, expected %q", port, ports[port], module)
+		}
+	}
+	if _, ok := ports[23]; ok {
+		t.Error("23= did not remove the port")
+	}
+	for _, overrides := range []string{"8443", "0=http", "70000=http", "x=http"} {
+		if _, err := parsePortModules(overrides); err == nil {
+			t.Errorf("%q: expected an error", overrides)
+		}
+	}
+}
+
+func TestParsePortModulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ports.txt")
+	if err := ioutil.WriteFile(path, []byte("# port table\n8443=http\n\n22= # no ssh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ports, err := parsePortModules("@" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ports[8443] != "http" || ports[443] != "tls" {
+		t.Errorf("got %v", ports)
+	}
+	if _, ok := ports[22]; ok {
+		t.Error("22= did not remove the port")
+	}
+}
+
+func TestGetTargetsCSVPorts(t *testing.T) {
+	input := "10.0.0.1:443\n[2001:db8::1]:22,example.com\n2001:db8::2\nexample.com:80\n10.0.0.0/31:8080,,tag\n10.0.0.2:x\n"
+	ch := make(chan ScanTarget, 10)
+	if err := getTargetsCSV(strings.NewReader(input), ch, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	var got []string
+	for target := range ch {
+		s := target.String()
+		if target.Port != nil {
+			s += " port:" + strconv.FormatUint(uint64(*target.Port), 10)
+		}
+		got = append(got, s)
+	}
+	expected := []string{
+		"10.0.0.1 port:443",
+		"example.com(2001:db8::1) port:22",
+		"2001:db8::2",
+		"example.com port:80",
+		"10.0.0.0 tag:tag port:8080",
+		"10.0.0.1 tag:tag port:8080",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -0,0 +1,99 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// backfillFilter selects the results of a previous scan to rescan with
+// --backfill. A result matches if any module has one of the statuses (or
+// statuses is empty) and the expression (if any) is true for the result.
+type backfillFilter struct {
+	statuses map[ScanStatus]bool
+	expr     *FilterExpression
+}
+
+// newBackfillFilter parses --backfill-status and --backfill-filter.
+func newBackfillFilter(statuses string, expr string) (*backfillFilter, error) {
+	ret := &backfillFilter{statuses: make(map[ScanStatus]bool)}
+	for _, status := range strings.Split(statuses, ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			ret.statuses[ScanStatus(status)] = true
+		}
+	}
+	if expr != "" {
+		var err error
+		if ret.expr, err = ParseFilterExpression(expr); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// backfillRecord holds the fields of an output line needed by --backfill.
+type backfillRecord struct {
+	IP     string `json:"ip"`
+	Domain string `json:"domain"`
+	Data   map[string]struct {
+		Status ScanStatus `json:"status"`
+	} `json:"data"`
+}
+
+func (f *backfillFilter) match(record *backfillRecord, line []byte) bool {
+	if len(f.statuses) > 0 {
+		found := false
+		for _, res := range record.Data {
+			if f.statuses[res.Status] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.expr == nil || f.expr.Match(json.RawMessage(line))
+}
+
+// InputTargetsBackfill is an InputTargetsFunc for --backfill. It reads the
+// input file as the JSON output of a previous scan and generates a target
+// for each result matching the --backfill-status and --backfill-filter.
+func InputTargetsBackfill(ch chan<- ScanTarget) error {
+	return getTargetsBackfill(config.inputFile, ch, config.backfill)
+}
+
+// getTargetsBackfill implements InputTargetsBackfill. Each IP and domain
+// pair is generated once, even if it has several matching results (e.g.
+// with --connections-per-host).
+func getTargetsBackfill(source io.Reader, ch chan<- ScanTarget, filter *backfillFilter) error {
+	reader := bufio.NewReader(source)
+	seen := make(map[string]bool)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var record backfillRecord
+			if jsonErr := json.Unmarshal(line, &record); jsonErr != nil {
+				log.Errorf("line %d: parse error, skipping: %v", lineNumber, jsonErr)
+			} else if filter.match(&record, line) {
+				ip := net.ParseIP(record.IP)
+				key := record.IP + "," + record.Domain
+				if (ip != nil || record.Domain != "") && !seen[key] {
+					seen[key] = true
+					ch <- ScanTarget{IP: ip, Domain: record.Domain}
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
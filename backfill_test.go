@@ -0,0 +1,48 @@
+package zgrab2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const backfillInput = `{"ip":"10.0.0.1","data":{"http":{"status":"io-timeout","protocol":"http"}}}
+{"ip":"10.0.0.2","data":{"http":{"status":"success","protocol":"http","result":{"response":{"status_code":200}}}}}
+{"ip":"10.0.0.3","domain":"example.com","data":{"http":{"status":"success","protocol":"http","result":{"response":{"status_code":404}}},"tls":{"status":"connection-timeout","protocol":"tls"}}}
+not json
+{"ip":"10.0.0.1","data":{"http":{"status":"io-timeout","protocol":"http"}}}
+{"domain":"example.org","data":{"http":{"status":"io-timeout","protocol":"http"}}}`
+
+func backfillTargets(t *testing.T, statuses, expr string) []string {
+	filter, err := newBackfillFilter(statuses, expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan ScanTarget, 10)
+	if err := getTargetsBackfill(strings.NewReader(backfillInput), ch, filter); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	var ret []string
+	for target := range ch {
+		ret = append(ret, target.String())
+	}
+	return ret
+}
+
+func TestGetTargetsBackfill(t *testing.T) {
+	tests := []struct {
+		statuses, expr string
+		expected       []string
+	}{
+		{"", "", []string{"10.0.0.1", "10.0.0.2", "example.com(10.0.0.3)", "example.org"}},
+		{"io-timeout, connection-timeout", "", []string{"10.0.0.1", "example.com(10.0.0.3)", "example.org"}},
+		{"", ".data.http.result.response.status_code == 200", []string{"10.0.0.2"}},
+		{"connection-timeout", ".data.http.status == 'success'", []string{"example.com(10.0.0.3)"}},
+	}
+	for _, test := range tests {
+		if got := backfillTargets(t, test.statuses, test.expr); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%q %q: got %v, expected %v", test.statuses, test.expr, got, test.expected)
+		}
+	}
+}
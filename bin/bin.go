@@ -105,15 +105,32 @@ func ZGrab2Main() {
 		log.Fatalf("could not parse flags: %s", err)
 	}
 
+	if a, ok := flag.(*zgrab2.AnalyzeCommand); ok {
+		if err := a.Run(); err != nil {
+			log.Fatalf("could not analyze: %s", err)
+		}
+		return
+	}
+
+	if s, ok := flag.(*zgrab2.SchemaCommand); ok {
+		if err := s.Run(); err != nil {
+			log.Fatalf("could not write the schema: %s", err)
+		}
+		return
+	}
+
+	if s, ok := flag.(*zgrab2.ServeCommand); ok {
+		if err := s.Run(); err != nil {
+			log.Fatalf("could not serve: %s", err)
+		}
+		return
+	}
+
 	if m, ok := flag.(*zgrab2.MultipleCommand); ok {
 		iniParser := zgrab2.NewIniParser()
 		var modTypes []string
 		var flagsReturned []interface{}
-		if m.ConfigFileName == "-" {
-			modTypes, flagsReturned, err = iniParser.Parse(os.Stdin)
-		} else {
-			modTypes, flagsReturned, err = iniParser.ParseFile(m.ConfigFileName)
-		}
+		modTypes, flagsReturned, err = m.Parse(iniParser)
 		if err != nil {
 			log.Fatalf("could not parse multiple: %s", err)
 		}
@@ -126,12 +143,22 @@ func ZGrab2Main() {
 			s := mod.NewScanner()
 			s.Init(f)
 			zgrab2.RegisterScan(s.GetName(), s)
+			zgrab2.SetMaxRuntime(s.GetName(), f)
+			zgrab2.RegisterScanFlags(s.GetName(), f)
 		}
 	} else {
 		mod := zgrab2.GetModule(moduleType)
 		s := mod.NewScanner()
 		s.Init(flag)
 		zgrab2.RegisterScan(moduleType, s)
+		zgrab2.SetMaxRuntime(s.GetName(), flag)
+		zgrab2.RegisterScanFlags(moduleType, flag)
+	}
+	if zgrab2.IsDryRun() {
+		if err := zgrab2.DryRun(); err != nil {
+			log.Fatalf("could not preview the scans: %s", err)
+		}
+		return
 	}
 	wg := sync.WaitGroup{}
 	monitor := zgrab2.MakeMonitor(1, &wg)
@@ -150,9 +177,15 @@ func ZGrab2Main() {
 		StartTime:         start.Format(time.RFC3339),
 		EndTime:           end.Format(time.RFC3339),
 		Duration:          end.Sub(start).String(),
+		AddressPolicy:     zgrab2.GetAddressPolicyStats(),
+		Output:            zgrab2.GetOutputSplitStats(),
+		Webhook:           zgrab2.GetWebhookStats(),
 	}
 	enc := json.NewEncoder(zgrab2.GetMetaFile())
 	if err := enc.Encode(&s); err != nil {
 		log.Fatalf("unable to write summary: %s", err.Error())
 	}
+	if err := zgrab2.WriteSummaryFile(monitor.Summary(start, end)); err != nil {
+		log.Fatalf("unable to write --summary-file: %s", err.Error())
+	}
 }
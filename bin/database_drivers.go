@@ -0,0 +1,8 @@
+package bin
+
+import (
+	// The drivers of --output-database. They are linked into the zgrab2
+	// binary only: programs embedding zgrab2 import those they use.
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
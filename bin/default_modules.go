@@ -5,54 +5,74 @@ import (
 	"github.com/Positive-Engineer/zgrab2/modules"
 	"github.com/Positive-Engineer/zgrab2/modules/bacnet"
 	"github.com/Positive-Engineer/zgrab2/modules/banner"
+	"github.com/Positive-Engineer/zgrab2/modules/declarative"
+	"github.com/Positive-Engineer/zgrab2/modules/detect"
 	"github.com/Positive-Engineer/zgrab2/modules/dnp3"
+	"github.com/Positive-Engineer/zgrab2/modules/external"
 	"github.com/Positive-Engineer/zgrab2/modules/fox"
 	"github.com/Positive-Engineer/zgrab2/modules/ftp"
+	"github.com/Positive-Engineer/zgrab2/modules/grpc"
 	"github.com/Positive-Engineer/zgrab2/modules/http"
+	"github.com/Positive-Engineer/zgrab2/modules/http3"
 	"github.com/Positive-Engineer/zgrab2/modules/imap"
 	"github.com/Positive-Engineer/zgrab2/modules/ipp"
+	"github.com/Positive-Engineer/zgrab2/modules/mailpolicy"
 	"github.com/Positive-Engineer/zgrab2/modules/modbus"
 	"github.com/Positive-Engineer/zgrab2/modules/mongodb"
 	"github.com/Positive-Engineer/zgrab2/modules/mssql"
 	"github.com/Positive-Engineer/zgrab2/modules/mysql"
+	"github.com/Positive-Engineer/zgrab2/modules/nmap"
 	"github.com/Positive-Engineer/zgrab2/modules/ntp"
 	"github.com/Positive-Engineer/zgrab2/modules/oracle"
 	"github.com/Positive-Engineer/zgrab2/modules/pop3"
 	"github.com/Positive-Engineer/zgrab2/modules/postgres"
+	"github.com/Positive-Engineer/zgrab2/modules/quic"
 	"github.com/Positive-Engineer/zgrab2/modules/redis"
 	"github.com/Positive-Engineer/zgrab2/modules/siemens"
 	"github.com/Positive-Engineer/zgrab2/modules/smb"
 	"github.com/Positive-Engineer/zgrab2/modules/smtp"
 	"github.com/Positive-Engineer/zgrab2/modules/telnet"
+	"github.com/Positive-Engineer/zgrab2/modules/tlsvuln"
+	"github.com/Positive-Engineer/zgrab2/modules/websocket"
 )
 
 var defaultModules zgrab2.ModuleSet
 
 func init() {
 	defaultModules = map[string]zgrab2.ScanModule{
-		"bacnet":   &bacnet.Module{},
-		"banner":   &banner.Module{},
-		"dnp3":     &dnp3.Module{},
-		"fox":      &fox.Module{},
-		"ftp":      &ftp.Module{},
-		"http":     &http.Module{},
-		"imap":     &imap.Module{},
-		"ipp":      &ipp.Module{},
-		"modbus":   &modbus.Module{},
-		"mongodb":  &mongodb.Module{},
-		"mssql":    &mssql.Module{},
-		"mysql":    &mysql.Module{},
-		"ntp":      &ntp.Module{},
-		"oracle":   &oracle.Module{},
-		"pop3":     &pop3.Module{},
-		"postgres": &postgres.Module{},
-		"redis":    &redis.Module{},
-		"siemens":  &siemens.Module{},
-		"smb":      &smb.Module{},
-		"smtp":     &smtp.Module{},
-		"ssh":      &modules.SSHModule{},
-		"telnet":   &telnet.Module{},
-		"tls":      &modules.TLSModule{},
+		"bacnet":      &bacnet.Module{},
+		"banner":      &banner.Module{},
+		"declarative": &declarative.Module{},
+		"detect":      &detect.Module{},
+		"dnp3":        &dnp3.Module{},
+		"external":    &external.Module{},
+		"fox":         &fox.Module{},
+		"ftp":         &ftp.Module{},
+		"grpc":        &grpc.Module{},
+		"http":        &http.Module{},
+		"http3":       &http3.Module{},
+		"imap":        &imap.Module{},
+		"ipp":         &ipp.Module{},
+		"mailpolicy":  &mailpolicy.Module{},
+		"modbus":      &modbus.Module{},
+		"mongodb":     &mongodb.Module{},
+		"mssql":       &mssql.Module{},
+		"mysql":       &mysql.Module{},
+		"nmap":        &nmap.Module{},
+		"ntp":         &ntp.Module{},
+		"oracle":      &oracle.Module{},
+		"pop3":        &pop3.Module{},
+		"postgres":    &postgres.Module{},
+		"quic":        &quic.Module{},
+		"redis":       &redis.Module{},
+		"siemens":     &siemens.Module{},
+		"smb":         &smb.Module{},
+		"smtp":        &smtp.Module{},
+		"ssh":         &modules.SSHModule{},
+		"telnet":      &telnet.Module{},
+		"tlsvuln":     &tlsvuln.Module{},
+		"tls":         &modules.TLSModule{},
+		"websocket":   &websocket.Module{},
 	}
 }
 
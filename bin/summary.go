@@ -4,8 +4,11 @@ import "github.com/Positive-Engineer/zgrab2"
 
 // Summary holds the results of a run of a ZGrab2 binary.
 type Summary struct {
-	StatusesPerModule map[string]*zgrab2.State `json:"statuses"`
-	StartTime         string                   `json:"start"`
-	EndTime           string                   `json:"end"`
-	Duration          string                   `json:"duration"`
+	StatusesPerModule map[string]*zgrab2.State   `json:"statuses"`
+	StartTime         string                     `json:"start"`
+	EndTime           string                     `json:"end"`
+	Duration          string                     `json:"duration"`
+	AddressPolicy     *zgrab2.AddressPolicyStats `json:"address_policy,omitempty"`
+	Output            *zgrab2.OutputSplitStats   `json:"output,omitempty"`
+	Webhook           *zgrab2.WebhookStats       `json:"webhook,omitempty"`
 }
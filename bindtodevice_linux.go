@@ -0,0 +1,27 @@
+//go:build linux
+// +build linux
+
+package zgrab2
+
+import (
+	"os"
+	"syscall"
+)
+
+// canBindToDevice is true on the platforms that support --interface.
+const canBindToDevice = true
+
+// bindToDevice binds the socket c to the network interface or VRF device,
+// with SO_BINDTODEVICE.
+func bindToDevice(c syscall.RawConn, device string) error {
+	var err error
+	if controlErr := c.Control(func(fd uintptr) {
+		err = syscall.BindToDevice(int(fd), device)
+	}); controlErr != nil {
+		return controlErr
+	}
+	if err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	return nil
+}
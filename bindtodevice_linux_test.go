@@ -0,0 +1,69 @@
+package zgrab2
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterface(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := uint(listener.Addr().(*net.TCPAddr).Port)
+	dialOpts := new(dialOptions)
+	target := ScanTarget{IP: net.ParseIP("127.0.0.1"), Port: &port, dialOpts: dialOpts}
+
+	if err := dialOpts.setInterface("lo"); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := target.Open(&BaseFlags{Timeout: time.Second})
+	if isSyscallError(err, syscall.EPERM) {
+		t.Skip("binding to an interface is not permitted")
+	}
+	if err != nil {
+		t.Fatalf("bound to lo: %v", err)
+	}
+	conn.Close()
+	udp, err := target.ListenUDP(&net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("UDP bound to lo: %v", err)
+	}
+	udp.Close()
+
+	if err := new(dialOptions).setInterface("zgrab-none0"); err == nil {
+		t.Error("expected an error for a missing interface")
+	}
+	dialOpts.device = "zgrab-none0"
+	if conn, err := target.Open(&BaseFlags{Timeout: time.Second}); err == nil {
+		conn.Close()
+		t.Error("connected through a missing interface")
+	}
+	if conn, err := target.OpenUDP(&BaseFlags{Timeout: time.Second}, nil); err == nil {
+		conn.Close()
+		t.Error("UDP through a missing interface")
+	}
+}
+
+// isSyscallError returns whether a dial failed with errno.
+func isSyscallError(err error, errno syscall.Errno) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == errno
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package zgrab2
+
+import (
+	"errors"
+	"syscall"
+)
+
+// canBindToDevice is true on the platforms that support --interface.
+const canBindToDevice = false
+
+// bindToDevice fails: SO_BINDTODEVICE is specific to Linux.
+func bindToDevice(c syscall.RawConn, device string) error {
+	return errors.New("binding to a network interface is not supported on this platform")
+}
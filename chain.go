@@ -0,0 +1,134 @@
+package zgrab2
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ChainRule runs follow-up scanners on a target when the result of another
+// scanner matches, e.g. http with HTTP/2 when tls negotiated ALPN h2, or ssh
+// when the banner starts with SSH-.
+type ChainRule struct {
+	// Scanner is the name of the scanner whose result is checked.
+	Scanner string `yaml:"scanner"`
+
+	// Status is the status the scan must have (default success).
+	Status ScanStatus `yaml:"status"`
+
+	// Match is an optional --filter-expr style expression over the result.
+	Match string `yaml:"match"`
+
+	// Run are the names of the scanners to run when the rule matches, given
+	// as a list or a single name.
+	Run chainScanners `yaml:"run"`
+
+	match *FilterExpression
+}
+
+// chainScanners is a list of scanner names that also accepts a single name.
+type chainScanners []string
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *chainScanners) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*s = chainScanners{name}
+		return nil
+	}
+	var names []string
+	if err := unmarshal(&names); err != nil {
+		return err
+	}
+	*s = names
+	return nil
+}
+
+// chainRuleFile is the format of a --chain-rules file, in YAML or JSON.
+type chainRuleFile struct {
+	Rules []*ChainRule `yaml:"rules"`
+}
+
+// ParseChainRules parses and compiles the rules of a --chain-rules file.
+func ParseChainRules(data []byte) ([]*ChainRule, error) {
+	var file chainRuleFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+	for i, rule := range file.Rules {
+		if rule.Scanner == "" || len(rule.Run) == 0 {
+			return nil, fmt.Errorf("rule %d: scanner and run are required", i+1)
+		}
+		if rule.Status == "" {
+			rule.Status = SCAN_SUCCESS
+		}
+		if rule.Match != "" {
+			expr, err := ParseFilterExpression(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid match: %s", i+1, err)
+			}
+			rule.match = expr
+		}
+	}
+	return file.Rules, nil
+}
+
+// LoadChainRules reads a --chain-rules file.
+func LoadChainRules(path string) ([]*ChainRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseChainRules(data)
+}
+
+// checkChainRules returns an error if a rule names a scanner that is not
+// one of scanners.
+func checkChainRules(rules []*ChainRule, scanners map[string]Scanner) error {
+	var missing []string
+	for _, rule := range rules {
+		for _, name := range append([]string{rule.Scanner}, rule.Run...) {
+			if _, ok := scanners[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("unknown scanners in --chain-rules: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// matches returns true if the rule fires for the response of scanner name.
+func (rule *ChainRule) matches(name string, res *ScanResponse) bool {
+	if rule.Scanner != name || rule.Status != res.Status {
+		return false
+	}
+	return rule.match == nil || rule.match.Match(res.Result)
+}
+
+// chainedScanners returns the scanners named in a run list of the rules,
+// which only run when a rule fires.
+func chainedScanners(rules []*ChainRule) map[string]bool {
+	ret := make(map[string]bool)
+	for _, rule := range rules {
+		for _, name := range rule.Run {
+			ret[name] = true
+		}
+	}
+	return ret
+}
+
+// followUps returns the scanners to run after the response of scanner name.
+func followUps(rules []*ChainRule, name string, res *ScanResponse) []string {
+	var ret []string
+	for _, rule := range rules {
+		if rule.matches(name, res) {
+			ret = append(ret, rule.Run...)
+		}
+	}
+	return ret
+}
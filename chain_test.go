@@ -0,0 +1,105 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// staticScanner returns the same result for every target.
+type staticScanner struct {
+	name   string
+	result interface{}
+}
+
+func (s *staticScanner) Init(flags ScanFlags) error       { return nil }
+func (s *staticScanner) InitPerSender(senderID int) error { return nil }
+func (s *staticScanner) GetName() string                  { return s.name }
+func (s *staticScanner) GetTrigger() string               { return "" }
+func (s *staticScanner) Protocol() string                 { return s.name }
+
+func (s *staticScanner) Scan(t ScanTarget) (ScanStatus, interface{}, error) {
+	return SCAN_SUCCESS, s.result, nil
+}
+
+func TestParseChainRules(t *testing.T) {
+	rules, err := ParseChainRules([]byte(`
+rules:
+  - scanner: tls
+    match: .handshake_log.server_hello.alpn_protocol == 'h2'
+    run: [http2, http]
+  - scanner: banner
+    status: success
+    run: ssh
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || !reflect.DeepEqual([]string(rules[0].Run), []string{"http2", "http"}) || rules[0].Status != SCAN_SUCCESS || rules[0].match == nil {
+		t.Errorf("unexpected first rule %+v", rules[0])
+	}
+	if !reflect.DeepEqual([]string(rules[1].Run), []string{"ssh"}) || rules[1].match != nil {
+		t.Errorf("unexpected second rule %+v", rules[1])
+	}
+	if _, err := ParseChainRules([]byte(`{"rules": [{"scanner": "tls", "run": ["http"]}]}`)); err != nil {
+		t.Errorf("JSON rules: %v", err)
+	}
+	for _, bad := range []string{
+		`rules: [{scanner: tls}]`,
+		`rules: [{scanner: tls, run: http, match: "=="}]`,
+		`rules: [{scanner: tls, run: http, unknown: 1}]`,
+	} {
+		if _, err := ParseChainRules([]byte(bad)); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+}
+
+func TestGrabTargetChain(t *testing.T) {
+	r := &Runner{scanners: make(map[string]Scanner)}
+	for _, s := range []Scanner{
+		&staticScanner{name: "banner", result: map[string]string{"banner": "SSH-2.0-OpenSSH_8.9"}},
+		&staticScanner{name: "ssh", result: "ssh"},
+		&staticScanner{name: "http", result: "http"},
+		&staticScanner{name: "ftp", result: "ftp"},
+	} {
+		r.scanners[s.GetName()] = s
+		r.order = append(r.order, s.GetName())
+	}
+	rules, err := ParseChainRules([]byte(`
+rules:
+  - scanner: banner
+    match: .banner matches '^SSH-'
+    run: ssh
+  - scanner: banner
+    match: .banner matches '^220'
+    run: ftp
+  - scanner: ssh
+    run: ssh
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkChainRules(rules, r.scanners); err != nil {
+		t.Fatal(err)
+	}
+	r.chainRules, r.chained = rules, chainedScanners(rules)
+
+	grab := r.grabTarget(context.Background(), ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	// ssh runs once, although it chains to itself; ftp only runs from its
+	// rule, which does not match.
+	if len(grab.Data) != 3 {
+		t.Fatalf("unexpected results %v", grab.Data)
+	}
+	if res := grab.Data["ssh"]; res.Status != SCAN_SUCCESS || res.ChainedFrom != "banner" {
+		t.Errorf("unexpected ssh result %+v", res)
+	}
+	if res := grab.Data["http"]; res.ChainedFrom != "" {
+		t.Errorf("unexpected http result %+v", res)
+	}
+
+	if err := checkChainRules([]*ChainRule{{Scanner: "banner", Run: chainScanners{"missing"}}}, r.scanners); err == nil {
+		t.Error("expected an error for an unknown scanner")
+	}
+}
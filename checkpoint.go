@@ -0,0 +1,128 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Checkpoint is the progress of a scan through its input, written to the
+// --checkpoint file and read back with --resume.
+type Checkpoint struct {
+	// InputFile is the --input-file of the scan.
+	InputFile string `json:"input_file"`
+
+	// TargetsDone is the number of targets at the start of the input whose
+	// results have all been output. Targets after it may have been scanned
+	// too, and are scanned again on resume.
+	TargetsDone uint64 `json:"targets_done"`
+
+	// Complete is true if the scan read the whole input.
+	Complete bool `json:"complete"`
+
+	// ShuffleSeed is the --shuffle-seed of the scan, which is resumed in
+	// the same order.
+	ShuffleSeed int64 `json:"shuffle_seed,omitempty"`
+
+	// Time is when the checkpoint was written.
+	Time string `json:"time"`
+}
+
+// ReadCheckpoint reads a checkpoint file.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := new(Checkpoint)
+	if err := json.Unmarshal(data, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Write replaces the checkpoint file at path, so that it is never left
+// partially written.
+func (c *Checkpoint) Write(path string) error {
+	c.Time = time.Now().Format(time.RFC3339)
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// progressTracker counts the targets at the start of the input that are
+// done, while they finish out of order.
+type progressTracker struct {
+	mutex   sync.Mutex
+	next    uint64
+	pending map[uint64]bool
+}
+
+func newProgressTracker(start uint64) *progressTracker {
+	return &progressTracker{next: start, pending: make(map[uint64]bool)}
+}
+
+// done marks the target at index of the input as done.
+func (p *progressTracker) done(index uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.pending[index] = true
+	for p.pending[p.next] {
+		delete(p.pending, p.next)
+		p.next++
+	}
+}
+
+// targetsDone returns the number of targets at the start of the input that
+// are done.
+func (p *progressTracker) targetsDone() uint64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.next
+}
+
+// newCheckpoint returns the checkpoint of the command line scan run by r.
+func newCheckpoint(r *Runner) *Checkpoint {
+	ret := &Checkpoint{InputFile: config.InputFileName, TargetsDone: r.TargetsDone()}
+	if config.Shuffle {
+		ret.ShuffleSeed = config.ShuffleSeed
+	}
+	return ret
+}
+
+// writeCheckpoints writes the checkpoint of the runner to --checkpoint every
+// --checkpoint-interval until done is closed.
+func writeCheckpoints(r *Runner, done <-chan struct{}) {
+	ticker := time.NewTicker(config.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			checkpoint := newCheckpoint(r)
+			if err := checkpoint.Write(config.Checkpoint); err != nil {
+				log.Errorf("could not write the checkpoint: %s", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package zgrab2
+
+import (
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestProgressTracker(t *testing.T) {
+	p := newProgressTracker(10)
+	for _, index := range []uint64{11, 13, 10} {
+		p.done(index)
+	}
+	if done := p.targetsDone(); done != 12 {
+		t.Errorf("got %d targets done", done)
+	}
+	p.done(12)
+	if done := p.targetsDone(); done != 14 {
+		t.Errorf("got %d targets done", done)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint := Checkpoint{InputFile: "targets.csv", TargetsDone: 42}
+	if err := checkpoint.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *read != checkpoint {
+		t.Errorf("got %+v", read)
+	}
+
+	var mutex sync.Mutex
+	var ips []string
+	r := &Runner{
+		scanners:           map[string]Scanner{"static": &staticScanner{name: "static"}},
+		order:              []string{"static"},
+		senders:            2,
+		connectionsPerHost: 1,
+		skipTargets:        2,
+		input: func(ch chan<- ScanTarget) error {
+			for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+				ch <- ScanTarget{IP: net.ParseIP(ip)}
+			}
+			return nil
+		},
+		output: func(grab *Grab) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			ips = append(ips, grab.IP)
+		},
+	}
+	if done := r.TargetsDone(); done != 2 {
+		t.Errorf("got %d targets done before the run", done)
+	}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 || r.TargetsDone() != 4 {
+		t.Errorf("got %v, %d targets done", ips, r.TargetsDone())
+	}
+}
@@ -60,6 +60,14 @@ type TimeoutConnection struct {
 	explicitReadDeadline    bool
 	explicitWriteDeadline   bool
 	explicitDeadline        bool
+
+	// traffic, if set, counts the bytes of the scan the connection was
+	// opened for.
+	traffic *trafficLog
+
+	// capture, if set, writes the bytes of the connection to the capture
+	// file of its target, with --pcap-dir.
+	capture *connCapture
 }
 
 // TimeoutConnection.Read calls Read() on the underlying connection, using any configured deadlines
@@ -81,6 +89,8 @@ func (c *TimeoutConnection) Read(b []byte) (n int, err error) {
 	}
 	n, err = c.Conn.Read(b)
 	c.BytesRead += n
+	c.traffic.addRead(n)
+	c.capture.read(b[:n])
 	if err == nil && origSize != len(b) && n == len(b) {
 		// we had to shrink the output buffer AND we used up the whole shrunk size, AND we're not at EOF
 		switch c.ReadLimitExceededAction {
@@ -113,6 +123,8 @@ func (c *TimeoutConnection) Write(b []byte) (n int, err error) {
 	}
 	n, err = c.Conn.Write(b)
 	c.BytesWritten += n
+	c.traffic.addWritten(n)
+	c.capture.written(b[:n])
 	return n, err
 }
 
@@ -173,6 +185,7 @@ func GetTimeoutDialFunc(timeout time.Duration) func(string, string) (net.Conn, e
 
 // Close the underlying connection.
 func (c *TimeoutConnection) Close() error {
+	c.capture.close()
 	return c.Conn.Close()
 }
 
@@ -234,13 +247,11 @@ func NewTimeoutConnection(ctx context.Context, conn net.Conn, timeout, readTimeo
 
 // DialTimeoutConnectionEx dials the target and returns a net.Conn that uses the configured timeouts for Read/Write operations.
 func DialTimeoutConnectionEx(proto string, target string, dialTimeout, sessionTimeout, readTimeout, writeTimeout time.Duration, bytesReadLimit int) (net.Conn, error) {
-	var conn net.Conn
-	var err error
-	if dialTimeout > 0 {
-		conn, err = net.DialTimeout(proto, target, dialTimeout)
-	} else {
-		conn, err = net.DialTimeout(proto, target, sessionTimeout)
+	dialer := net.Dialer{Timeout: dialTimeout}
+	if dialTimeout <= 0 {
+		dialer.Timeout = sessionTimeout
 	}
+	conn, err := dialer.Dial(proto, target)
 	if err != nil {
 		if conn != nil {
 			conn.Close()
@@ -275,12 +286,19 @@ type Dialer struct {
 	Dialer *net.Dialer
 
 	// BytesReadLimit is the maximum number of bytes that connections dialed with this dialer will
-	// read before erroring.
+	// read before erroring. If it is 0, connections get DefaultBytesReadLimit, reduced while the
+	// runner of the Target is shedding load under --max-memory.
 	BytesReadLimit int
 
 	// ReadLimitExceededAction describes how connections dialed with this dialer deal with exceeding
 	// the BytesReadLimit.
 	ReadLimitExceededAction ReadLimitExceededAction
+
+	// Target, if set, is the target being scanned: connections use the local address of its
+	// sender and the --interface of its runner, are rejected if the address policy of its runner
+	// excludes them, and are recorded in its local addresses. Connections dialed without a target
+	// use none of the runner's options.
+	Target *ScanTarget
 }
 
 func (d *Dialer) getTimeout(field time.Duration) time.Duration {
@@ -291,6 +309,9 @@ func (d *Dialer) getTimeout(field time.Duration) time.Duration {
 }
 
 // DialContext wraps the connection returned by net.Dialer.DialContext() with a TimeoutConnection.
+// With a Target, ctx only bounds the dial: the connection uses the context of the target's scan,
+// and is closed by the watchdog, --target-timeout or an interrupt along with the scan's other
+// connections.
 func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	if d.Timeout != 0 {
 		ctx, _ = context.WithTimeout(ctx, d.Timeout)
@@ -299,19 +320,46 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	d.Dialer.Timeout = d.getTimeout(d.ConnectTimeout)
 	d.Dialer.KeepAlive = d.Timeout
 
-	// Copy over the source IP if set, or nil
-	d.Dialer.LocalAddr = config.localAddr
+	// The target picks the local address of its sender, and the control
+	// function of its runner
+	d.Dialer.LocalAddr = nil
+	d.Dialer.Control = nil
 
 	dialContext, cancelDial := context.WithTimeout(ctx, d.Dialer.Timeout)
 	defer cancelDial()
-	conn, err := d.Dialer.DialContext(dialContext, network, address)
+	var conn net.Conn
+	var err error
+	if d.Target != nil {
+		// The dial is canceled with the scan too.
+		dialDone := make(chan struct{})
+		defer close(dialDone)
+		go func() {
+			select {
+			case <-d.Target.Ctx().Done():
+				cancelDial()
+			case <-dialDone:
+			}
+		}()
+		conn, err = d.Target.dial(dialContext, d.Dialer, network, address)
+	} else {
+		conn, err = d.Dialer.DialContext(dialContext, network, address)
+	}
 	if err != nil {
 		return nil, err
 	}
-	ret := NewTimeoutConnection(ctx, conn, d.Timeout, d.ReadTimeout, d.WriteTimeout, d.BytesReadLimit)
-	ret.BytesReadLimit = d.BytesReadLimit
+	readLimit := d.BytesReadLimit
+	if d.Target != nil {
+		ctx = d.Target.Ctx()
+		readLimit = d.Target.bytesReadLimit(readLimit)
+	}
+	ret := NewTimeoutConnection(ctx, conn, d.Timeout, d.ReadTimeout, d.WriteTimeout, readLimit)
 	ret.ReadLimitExceededAction = d.ReadLimitExceededAction
-	return ret, nil
+	if d.Target == nil {
+		return ret, nil
+	}
+	ret.traffic = d.Target.traffic
+	ret.capture = d.Target.capture.open(conn)
+	return d.Target.conns.track(ret, nil)
 }
 
 // Dial returns a connection with the configured timeout.
@@ -332,9 +380,6 @@ func (d *Dialer) SetDefaults() *Dialer {
 	if d.ReadLimitExceededAction == ReadLimitExceededActionNotSet {
 		d.ReadLimitExceededAction = DefaultReadLimitExceededAction
 	}
-	if d.BytesReadLimit == 0 {
-		d.BytesReadLimit = DefaultBytesReadLimit
-	}
 	if d.Dialer == nil {
 		d.Dialer = &net.Dialer{
 			Timeout:   d.Timeout,
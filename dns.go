@@ -0,0 +1,292 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// DNS record types looked up by modules.
+const (
+	DNSTypeA     uint16 = 1
+	DNSTypeCNAME uint16 = 5
+	DNSTypeMX    uint16 = 15
+	DNSTypeTXT   uint16 = 16
+	DNSTypeAAAA  uint16 = 28
+	DNSTypeTLSA  uint16 = 52
+)
+
+// DNSRCodeNameError (NXDOMAIN) is the response code for a name that does not
+// exist.
+const DNSRCodeNameError = 3
+
+// DNSRecord is a resource record of the answer section of a response.
+type DNSRecord struct {
+	Name string
+	Type uint16
+	TTL  uint32
+
+	// Data is the raw RDATA of the record.
+	Data []byte
+
+	// Preference and Target are the decoded RDATA of MX (the exchange) and
+	// CNAME records, whose names may be compressed.
+	Preference uint16
+	Target     string
+}
+
+// TXT returns the character-strings of a TXT record, concatenated.
+func (record *DNSRecord) TXT() string {
+	var text []byte
+	for data := record.Data; len(data) > 0; {
+		n := int(data[0])
+		if n+1 > len(data) {
+			n = len(data) - 1
+		}
+		text = append(text, data[1:n+1]...)
+		data = data[n+1:]
+	}
+	return string(text)
+}
+
+// DNSResponse is the response to a DNS query.
+type DNSResponse struct {
+	RCode int
+
+	// Authenticated is the AD bit of the response: the resolver validated
+	// the answer with DNSSEC. It is only meaningful if the resolver is
+	// trusted and the path to it is secure.
+	Authenticated bool
+
+	// Answers are the records of the answer section with the queried type;
+	// CNAME records of the chain leading to them are left out.
+	Answers []DNSRecord
+
+	// CNAMEs are the CNAME records of the chain, in the order of the
+	// answer section, if the queried type is not CNAME.
+	CNAMEs []DNSRecord
+}
+
+// dnsResolverAddress is the address of --dns-resolver, or of the first
+// nameserver of /etc/resolv.conf.
+func dnsResolverAddress() string {
+	if config.DNSResolver != "" {
+		return config.DNSResolver
+	}
+	file, err := os.Open("/etc/resolv.conf")
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// LookupDNS sends a recursive query for name and qtype to the resolver of
+// --dns-resolver, requesting DNSSEC validation. The query is sent over UDP,
+// and repeated over TCP if the response is truncated. A timeout of 0 (as
+// with --timeout 0) means 10 seconds.
+func LookupDNS(name string, qtype uint16, timeout time.Duration) (*DNSResponse, error) {
+	return lookupDNS(dnsResolverAddress(), name, qtype, timeout)
+}
+
+// lookupDNS implements LookupDNS with the resolver at server.
+func lookupDNS(server string, name string, qtype uint16, timeout time.Duration) (*DNSResponse, error) {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	query, id, err := newDNSQuery(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Skip stray datagrams.
+		if n >= 12 && binary.BigEndian.Uint16(buf) == id {
+			buf = buf[:n]
+			break
+		}
+	}
+	if buf[2]&0x02 == 0 {
+		return parseDNSResponse(buf, qtype)
+	}
+
+	tcp, err := net.DialTimeout("tcp", server, time.Until(deadline))
+	if err != nil {
+		return nil, err
+	}
+	defer tcp.Close()
+	tcp.SetDeadline(deadline)
+	framed := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	if _, err := tcp.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(tcp)
+	var size uint16
+	if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	buf = make([]byte, size)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, err
+	}
+	return parseDNSResponse(buf, qtype)
+}
+
+// newDNSQuery returns a query with the RD and AD bits set and an EDNS0 OPT
+// record with the DO bit, and its ID.
+func newDNSQuery(name string, qtype uint16) ([]byte, uint16, error) {
+	id := uint16(rand.Uint32())
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	// RD; AD asks for the validation status even without DO.
+	msg[2] = 0x01
+	msg[3] = 0x20
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	binary.BigEndian.PutUint16(msg[10:], 1)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, 1)
+	// OPT: root name, type 41, UDP size 4096, extended RCODE and version 0,
+	// DO, no options.
+	msg = append(msg, 0, 0, 41, 0x10, 0x00, 0, 0, 0x80, 0x00, 0, 0)
+	return msg, id, nil
+}
+
+var errDNSTruncated = errors.New("truncated DNS message")
+
+// parseDNSName reads a possibly compressed name at offset, returning it
+// and the offset following it.
+func parseDNSName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errDNSTruncated
+		}
+		n := int(msg[offset])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = offset + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case n&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, errDNSTruncated
+			}
+			if end < 0 {
+				end = offset + 2
+			}
+			if jumps++; jumps > 32 {
+				return "", 0, errors.New("DNS name compression loop")
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		default:
+			if offset+1+n > len(msg) {
+				return "", 0, errDNSTruncated
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+n]))
+			offset += 1 + n
+		}
+	}
+}
+
+// parseDNSResponse returns the answers of type qtype of a response.
+func parseDNSResponse(msg []byte, qtype uint16) (*DNSResponse, error) {
+	if len(msg) < 12 {
+		return nil, errDNSTruncated
+	}
+	response := &DNSResponse{
+		RCode:         int(msg[3] & 0x0f),
+		Authenticated: msg[3]&0x20 != 0,
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := parseDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+	for i := 0; i < answers; i++ {
+		name, next, err := parseDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errDNSTruncated
+		}
+		record := DNSRecord{
+			Name: name,
+			Type: binary.BigEndian.Uint16(msg[next:]),
+			TTL:  binary.BigEndian.Uint32(msg[next+4:]),
+		}
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		start := next + 10
+		if start+length > len(msg) {
+			return nil, errDNSTruncated
+		}
+		record.Data = msg[start : start+length]
+		offset = start + length
+		if record.Type == DNSTypeCNAME && qtype != DNSTypeCNAME {
+			if record.Target, _, err = parseDNSName(msg, start); err != nil {
+				return nil, err
+			}
+			response.CNAMEs = append(response.CNAMEs, record)
+			continue
+		}
+		if record.Type != qtype {
+			continue
+		}
+		switch record.Type {
+		case DNSTypeMX:
+			if length < 3 {
+				return nil, errDNSTruncated
+			}
+			record.Preference = binary.BigEndian.Uint16(record.Data)
+			if record.Target, _, err = parseDNSName(msg, start+2); err != nil {
+				return nil, err
+			}
+		case DNSTypeCNAME:
+			if record.Target, _, err = parseDNSName(msg, start); err != nil {
+				return nil, err
+			}
+		}
+		response.Answers = append(response.Answers, record)
+	}
+	return response, nil
+}
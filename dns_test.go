@@ -0,0 +1,130 @@
+package zgrab2
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// dnsTestResponse answers query with a CNAME and two MX records, using
+// name compression, and sets the AD and (if truncated) TC bits.
+func dnsTestResponse(query []byte, truncated bool) []byte {
+	msg := append([]byte(nil), query[:12]...)
+	msg[2] |= 0x80
+	if truncated {
+		msg[2] |= 0x02
+	}
+	msg[3] = 0xa0
+	binary.BigEndian.PutUint16(msg[6:], 3)
+	binary.BigEndian.PutUint16(msg[10:], 0)
+	// The question, without the OPT record.
+	question := query[12 : len(query)-11]
+	msg = append(msg, question...)
+	// example.com. CNAME mail.example.com.
+	msg = append(msg, 0xc0, 12, 0, 5, 0, 1, 0, 0, 1, 0, 0, 7, 4, 'm', 'a', 'i', 'l', 0xc0, 12)
+	cname := len(msg) - 7
+	// mail.example.com. MX 10 mx1.mail.example.com. and MX 20 the root.
+	msg = append(msg, 0xc0, byte(cname), 0, 15, 0, 1, 0, 0, 1, 0, 0, 8, 0, 10, 3, 'm', 'x', '1', 0xc0, byte(cname))
+	msg = append(msg, 0xc0, byte(cname), 0, 15, 0, 1, 0, 0, 1, 0, 0, 3, 0, 20, 0)
+	return msg
+}
+
+func TestParseDNSResponse(t *testing.T) {
+	query, _, err := newDNSQuery("example.com", DNSTypeMX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := parseDNSResponse(dnsTestResponse(query, false), DNSTypeMX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Authenticated || response.RCode != 0 || len(response.Answers) != 2 {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	mx := response.Answers[0]
+	if mx.Name != "mail.example.com" || mx.Preference != 10 || mx.Target != "mx1.mail.example.com" || mx.TTL != 256 {
+		t.Errorf("unexpected MX %+v", mx)
+	}
+	if null := response.Answers[1]; null.Preference != 20 || null.Target != "" {
+		t.Errorf("unexpected null MX %+v", null)
+	}
+
+	msg := dnsTestResponse(query, false)
+	if _, err := parseDNSResponse(msg[:len(msg)-4], DNSTypeMX); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+	loop := append([]byte(nil), msg[:12]...)
+	binary.BigEndian.PutUint16(loop[4:], 1)
+	binary.BigEndian.PutUint16(loop[6:], 0)
+	loop = append(loop, 0xc0, 12)
+	if _, err := parseDNSResponse(loop, DNSTypeMX); err == nil {
+		t.Error("expected an error for a compression loop")
+	}
+	if _, _, err := newDNSQuery("bad..name", DNSTypeMX); err == nil {
+		t.Error("expected an error for an empty label")
+	}
+}
+
+func TestDNSRecordTXT(t *testing.T) {
+	record := DNSRecord{Data: []byte("\x07v=STSv1\x0b; id=123456\x05")}
+	if txt := record.TXT(); txt != "v=STSv1; id=123456" {
+		t.Errorf("got %q", txt)
+	}
+}
+
+func TestLookupDNSTCPFallback(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	port := udp.LocalAddr().(*net.UDPAddr).Port
+	tcp, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Skipf("TCP port %d in use: %v", port, err)
+	}
+	defer tcp.Close()
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// A stray datagram, then the truncated response.
+		udp.WriteTo([]byte{0xff, 0xff, 0, 0}, addr)
+		udp.WriteTo(dnsTestResponse(buf[:n], true), addr)
+	}()
+	go func() {
+		conn, err := tcp.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var size uint16
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		query := make([]byte, size)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		response := dnsTestResponse(query, false)
+		framed := make([]byte, 2)
+		binary.BigEndian.PutUint16(framed, uint16(len(response)))
+		conn.Write(append(framed, response...))
+	}()
+
+	saved := config.DNSResolver
+	config.DNSResolver = tcp.Addr().String()
+	t.Cleanup(func() { config.DNSResolver = saved })
+	response, err := LookupDNS("example.com", DNSTypeMX, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Answers) != 2 || response.Answers[0].Target != "mx1.mail.example.com" {
+		t.Errorf("unexpected response %+v", response)
+	}
+}
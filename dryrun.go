@@ -0,0 +1,262 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zmap/zcrypto/tls"
+)
+
+// ProbePreview is a message a scan would send, as written by --dry-run.
+type ProbePreview struct {
+	// Name says what the message is, e.g. "HTTP request".
+	Name string
+
+	// Text is a readable form of the message, e.g. the text of an HTTP
+	// request or a summary of a TLS ClientHello.
+	Text string
+
+	// Data are the bytes of the message, written as a hex dump.
+	Data []byte
+}
+
+// scanFlags are the flags of the registered scanners, by name.
+var scanFlags = make(map[string]ScanFlags)
+
+// RegisterScanFlags records the flags of the named scanner, whose default
+// port --dry-run shows.
+func RegisterScanFlags(name string, flags ScanFlags) {
+	scanFlags[name] = flags
+}
+
+// IsDryRun returns true if --dry-run is set.
+func IsDryRun() bool {
+	return config.DryRun
+}
+
+// DryRun reads the targets of the input and writes to the output file, for
+// each target, the scanners that would scan it and at which address, and
+// what the scanners implementing ScannerPreview would send first, without
+// connecting to the targets.
+func DryRun() error {
+	output, err := commandOutput()
+	if err != nil {
+		return err
+	}
+	runner, err := newCommandLineRunner(nil, func(*Grab) {}, 0)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(output)
+	targets := make(chan ScanTarget)
+	inputDone := make(chan error, 1)
+	go func() {
+		err := config.inputTargets(targets)
+		close(targets)
+		inputDone <- err
+	}()
+	for target := range targets {
+		runner.writePreview(w, target)
+	}
+	if err := <-inputDone; err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// previewScanners returns the names of the scanners that would run first on
+// the target, as in grabTarget; the follow-ups of --chain-rules depend on
+// the results, and are not included.
+func (r *Runner) previewScanners(target *ScanTarget) []string {
+	if r.autoModules != nil && target.Tag == "" && target.Port != nil {
+		return r.autoModules[*target.Port]
+	}
+	var ret []string
+	for _, name := range r.order {
+		if !r.chained[name] && r.scanners[name].GetTrigger() == target.Tag {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// writePreview writes the preview of the scans of a target to w.
+func (r *Runner) writePreview(w io.Writer, target ScanTarget) {
+	fmt.Fprintf(w, "# %s\n", target.String())
+	if target.IP == nil && target.Domain == "" {
+		return
+	}
+	if target.Context == nil {
+		target.Context = NewTargetContext()
+	}
+	names := r.previewScanners(&target)
+	if len(names) == 0 {
+		fmt.Fprintln(w, "no scanner")
+	}
+	for _, name := range names {
+		s := r.scanners[name]
+		if s.GetName() != "" {
+			name = s.GetName()
+		}
+		fmt.Fprintf(w, "%s: %s (protocol %s)\n", name, previewAddress(name, &target), s.Protocol())
+		previewer, ok := s.(ScannerPreview)
+		if !ok {
+			fmt.Fprintln(w, "  no preview")
+			continue
+		}
+		probes, err := previewer.Preview(target)
+		if err != nil {
+			fmt.Fprintf(w, "  preview failed: %s\n", err)
+			continue
+		}
+		for _, probe := range probes {
+			writeProbePreview(w, probe)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// previewAddress returns the address the named scanner would connect to:
+// the port of the target, or the default port of the scanner.
+func previewAddress(name string, target *ScanTarget) string {
+	port := "?"
+	if target.Port != nil {
+		port = strconv.FormatUint(uint64(*target.Port), 10)
+	} else if f, ok := scanFlags[name].(interface{ GetPort() uint }); ok {
+		port = strconv.FormatUint(uint64(f.GetPort()), 10)
+	}
+	host := target.Domain
+	if target.IP != nil {
+		host = target.IP.String()
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// writeProbePreview writes a probe to w, with its text and hex dump
+// indented.
+func writeProbePreview(w io.Writer, probe *ProbePreview) {
+	fmt.Fprintf(w, "  %s (%d bytes):\n", probe.Name, len(probe.Data))
+	indent := func(text string) {
+		for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+			fmt.Fprintf(w, "    %s\n", strings.TrimRight(line, "\r"))
+		}
+	}
+	if probe.Text != "" {
+		indent(probe.Text)
+	}
+	if len(probe.Data) > 0 {
+		indent(hex.Dump(probe.Data))
+	}
+}
+
+// PreviewClientHello returns the TLS ClientHello that a handshake with cfg
+// sends, with a summary of it. The handshake runs over an in-memory
+// connection, which is closed once the ClientHello is read.
+func PreviewClientHello(cfg *tls.Config) (*ProbePreview, error) {
+	client, server := net.Pipe()
+	client.SetDeadline(time.Now().Add(10 * time.Second))
+	record := make(chan []byte, 1)
+	go func() {
+		defer server.Close()
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(server, header); err != nil {
+			record <- nil
+			return
+		}
+		body := make([]byte, int(header[3])<<8|int(header[4]))
+		if _, err := io.ReadFull(server, body); err != nil {
+			record <- nil
+			return
+		}
+		record <- append(header, body...)
+	}()
+	conn := tls.Client(client, cfg)
+	err := conn.Handshake()
+	// Closing the connection ends the read of the ClientHello if the
+	// handshake failed before sending it.
+	client.Close()
+	data := <-record
+	handshake := conn.GetHandshakeLog()
+	if data == nil || handshake == nil || handshake.ClientHello == nil {
+		if err == nil {
+			err = errors.New("no ClientHello was sent")
+		}
+		return nil, err
+	}
+	return &ProbePreview{Name: "TLS ClientHello", Text: summarizeClientHello(handshake.ClientHello), Data: data}, nil
+}
+
+// PreviewClientHello returns the TLS ClientHello that the flags send to
+// target, as PreviewClientHello.
+func (t *TLSFlags) PreviewClientHello(target *ScanTarget) (*ProbePreview, error) {
+	cfg, err := t.GetTLSConfigForTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	return PreviewClientHello(cfg)
+}
+
+// summarizeClientHello describes the main fields of a ClientHello, one per
+// line.
+func summarizeClientHello(hello *tls.ClientHello) string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	add("version: %s", hello.Version.String())
+	if hello.ServerName != "" {
+		add("server name: %s", hello.ServerName)
+	} else {
+		add("server name: none")
+	}
+	suites := make([]string, len(hello.CipherSuites))
+	for i, suite := range hello.CipherSuites {
+		suites[i] = fmt.Sprintf("%s (0x%04x)", suite.String(), uint16(suite))
+	}
+	add("cipher suites (%d): %s", len(suites), strings.Join(suites, ", "))
+	if len(hello.SupportedCurves) > 0 {
+		curves := make([]string, len(hello.SupportedCurves))
+		for i, curve := range hello.SupportedCurves {
+			curves[i] = curve.String()
+		}
+		add("curves: %s", strings.Join(curves, ", "))
+	}
+	if len(hello.AlpnProtocols) > 0 {
+		add("ALPN: %s", strings.Join(hello.AlpnProtocols, ", "))
+	}
+	if len(hello.SignatureAndHashes) > 0 {
+		add("signature algorithms: %d", len(hello.SignatureAndHashes))
+	}
+	var extensions []string
+	for _, extension := range []struct {
+		name string
+		sent bool
+	}{
+		{"ocsp_stapling", hello.OcspStapling},
+		{"session_ticket", hello.TicketSupported},
+		{"secure_renegotiation", hello.SecureRenegotiation},
+		{"heartbeat", hello.HeartbeatSupported},
+		{"extended_random", len(hello.ExtendedRandom) > 0},
+		{"extended_master_secret", hello.ExtendedMasterSecret},
+		{"next_protocol_negotiation", hello.NextProtoNeg},
+		{"signed_certificate_timestamp", hello.SctEnabled || hello.Scts},
+	} {
+		if extension.sent {
+			extensions = append(extensions, extension.name)
+		}
+	}
+	if len(hello.UnknownExtensions) > 0 {
+		extensions = append(extensions, fmt.Sprintf("%d unknown", len(hello.UnknownExtensions)))
+	}
+	if len(extensions) > 0 {
+		add("extensions: %s", strings.Join(extensions, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,73 @@
+package zgrab2
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zcrypto/tls"
+)
+
+// previewScanner is a staticScanner that previews a static probe.
+type previewScanner struct {
+	staticScanner
+}
+
+func (s *previewScanner) Preview(t ScanTarget) ([]*ProbePreview, error) {
+	return []*ProbePreview{{Name: "probe", Data: []byte("HELO " + t.Domain + "\r\n")}}, nil
+}
+
+func TestPreviewClientHello(t *testing.T) {
+	hello, err := PreviewClientHello(&tls.Config{ServerName: "example.com", NextProtos: []string{"h2", "http/1.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A handshake record holding a ClientHello.
+	if len(hello.Data) < 6 || hello.Data[0] != 0x16 || hello.Data[5] != 0x01 || int(hello.Data[3])<<8|int(hello.Data[4]) != len(hello.Data)-5 {
+		t.Errorf("unexpected record % x", hello.Data)
+	}
+	for _, line := range []string{"version: TLSv1.2", "server name: example.com", "ALPN: h2, http/1.1", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (0xc02f)"} {
+		if !strings.Contains(hello.Text, line) {
+			t.Errorf("no %q in the summary:\n%s", line, hello.Text)
+		}
+	}
+	if !bytes.Contains(hello.Data, []byte("example.com")) {
+		t.Error("no server name in the ClientHello")
+	}
+
+	if _, err := PreviewClientHello(&tls.Config{}); err == nil {
+		t.Error("expected an error without a server name or InsecureSkipVerify")
+	}
+}
+
+func TestWritePreview(t *testing.T) {
+	port := uint(25)
+	scanFlags["smtp"] = &configOtherFlags{BaseFlags: BaseFlags{Port: 587}}
+	defer delete(scanFlags, "smtp")
+	r := &Runner{
+		scanners: map[string]Scanner{
+			"smtp": &previewScanner{staticScanner{name: "smtp"}},
+			"ssh":  &staticScanner{name: "ssh"},
+		},
+		order: []string{"smtp", "ssh"},
+	}
+	var buf bytes.Buffer
+	r.writePreview(&buf, ScanTarget{IP: net.ParseIP("192.0.2.1"), Domain: "example.com"})
+	r.writePreview(&buf, ScanTarget{IP: net.ParseIP("192.0.2.2"), Port: &port, Tag: "other"})
+	want := `# example.com(192.0.2.1)
+smtp: 192.0.2.1:587 (protocol smtp)
+  probe (18 bytes):
+    00000000  48 45 4c 4f 20 65 78 61  6d 70 6c 65 2e 63 6f 6d  |HELO example.com|
+    00000010  0d 0a                                             |..|
+ssh: 192.0.2.1:? (protocol ssh)
+  no preview
+
+# 192.0.2.2 tag:other
+no scanner
+
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
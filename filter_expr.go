@@ -0,0 +1,472 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FilterExpression is a compiled --filter-expr: a boolean expression over the
+// JSON form of a module result.
+//
+// The grammar is:
+//
+//	expr    = and { "||" and }
+//	and     = not { "&&" not }
+//	not     = "!" not | compare
+//	compare = operand [ op operand ]
+//	op      = "==" | "!=" | "<" | "<=" | ">" | ">=" | "contains" | "matches"
+//	operand = path | string | number | "true" | "false" | "null" | "(" expr ")"
+//	path    = "." [ name ] { "." name | "[" index "]" }
+//
+// Paths select a value of the result by its JSON field names (. alone is the
+// whole result); a missing field is null. An operand used without op is true
+// unless it is null, false, 0, "" or empty. contains tests for a substring, an
+// array element or an object key; matches takes a regular expression.
+type FilterExpression struct {
+	source string
+	root   filterNode
+}
+
+type filterNode interface {
+	eval(result interface{}) interface{}
+}
+
+// ParseFilterExpression compiles a --filter-expr.
+func ParseFilterExpression(source string) (*FilterExpression, error) {
+	tokens, err := tokenizeFilter(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+	return &FilterExpression{source: source, root: root}, nil
+}
+
+// String returns the expression source.
+func (e *FilterExpression) String() string {
+	return e.source
+}
+
+// Match evaluates the expression against the JSON form of the result.
+func (e *FilterExpression) Match(result interface{}) bool {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return false
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return false
+	}
+	return filterTruth(e.root.eval(decoded))
+}
+
+// Value evaluates the expression against a JSON value already decoded into
+// an interface{} (e.g. to read the value of a path).
+func (e *FilterExpression) Value(decoded interface{}) interface{} {
+	return e.root.eval(decoded)
+}
+
+type filterToken struct {
+	// kind is "path", "string", "number", "ident" or the operator itself.
+	kind   string
+	text   string
+	offset int
+}
+
+var filterOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "!", "<", ">", "(", ")"}
+
+func tokenizeFilter(source string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '"' || c == '\'':
+			// Double-quoted strings use Go escapes, single-quoted ones are raw.
+			j := i + 1
+			for j < len(source) && rune(source[j]) != c {
+				if c == '"' && source[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(source) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			text := source[i+1 : j]
+			if c == '"' {
+				var err error
+				if text, err = strconv.Unquote(source[i : j+1]); err != nil {
+					return nil, fmt.Errorf("invalid string at offset %d: %v", i, err)
+				}
+			}
+			tokens = append(tokens, filterToken{"string", text, i})
+			i = j + 1
+			continue
+		case c == '.':
+			j := i + 1
+			for j < len(source) && isFilterPathChar(source[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{"path", source[i:j], i})
+			i = j
+			continue
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(source) && (source[j] == '.' || source[j] == 'e' || source[j] == 'E' || (source[j] >= '0' && source[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, filterToken{"number", source[i:j], i})
+			i = j
+			continue
+		case unicode.IsLetter(c):
+			j := i + 1
+			for j < len(source) && (unicode.IsLetter(rune(source[j])) || source[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, filterToken{"ident", source[i:j], i})
+			i = j
+			continue
+		}
+		matched := false
+		for _, op := range filterOperators {
+			if strings.HasPrefix(source[i:], op) {
+				tokens = append(tokens, filterToken{op, op, i})
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("unexpected %q at offset %d", source[i], i)
+		}
+	}
+	return tokens, nil
+}
+
+func isFilterPathChar(c byte) bool {
+	return c == '.' || c == '_' || c == '-' || c == '[' || c == ']' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// accept consumes the next token if it is one of the given kinds (or
+// identifiers with that text).
+func (p *filterParser) accept(kinds ...string) *filterToken {
+	t := p.peek()
+	if t == nil {
+		return nil
+	}
+	for _, kind := range kinds {
+		if t.kind == kind || (t.kind == "ident" && t.text == kind) {
+			p.pos++
+			return t
+		}
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") != nil {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterLogical{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") != nil {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterLogical{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.accept("!") != nil {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{operand}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *filterParser) parseCompare() (filterNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.accept("==", "!=", "<", "<=", ">", ">=", "contains", "matches")
+	if op == nil {
+		return left, nil
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	node := &filterCompare{op: op.text, left: left, right: right}
+	if op.text == "matches" {
+		pattern, ok := right.(filterLiteral)
+		if s, isString := pattern.value.(string); ok && isString {
+			if node.re, err = regexp.Compile(s); err != nil {
+				return nil, fmt.Errorf("invalid regular expression at offset %d: %v", op.offset, err)
+			}
+		} else {
+			return nil, fmt.Errorf("matches at offset %d needs a string pattern", op.offset)
+		}
+	}
+	return node, nil
+}
+
+func (p *filterParser) parseOperand() (filterNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.accept(")") == nil {
+			return nil, fmt.Errorf("missing ) for ( at offset %d", t.offset)
+		}
+		return node, nil
+	case "path":
+		return parseFilterPath(t)
+	case "string":
+		return filterLiteral{t.text}, nil
+	case "number":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", t.text, t.offset)
+		}
+		return filterLiteral{f}, nil
+	case "ident":
+		switch t.text {
+		case "true":
+			return filterLiteral{true}, nil
+		case "false":
+			return filterLiteral{false}, nil
+		case "null":
+			return filterLiteral{nil}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.offset)
+}
+
+// parseFilterPath splits a path token into its steps: field names (string)
+// and array indexes (int).
+func parseFilterPath(t *filterToken) (filterNode, error) {
+	var steps []interface{}
+	rest := t.text[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("missing ] in path %q", t.text)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index in path %q", t.text)
+			}
+			steps = append(steps, index)
+			rest = rest[end+1:]
+		case rest[0] == '.':
+			rest = rest[1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if strings.IndexByte(rest[:end], ']') >= 0 {
+				return nil, fmt.Errorf("unexpected ] in path %q", t.text)
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		}
+	}
+	return filterPath(steps), nil
+}
+
+type filterLiteral struct {
+	value interface{}
+}
+
+func (l filterLiteral) eval(interface{}) interface{} {
+	return l.value
+}
+
+type filterPath []interface{}
+
+func (path filterPath) eval(result interface{}) interface{} {
+	v := result
+	for _, step := range path {
+		switch s := step.(type) {
+		case string:
+			object, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = object[s]
+		case int:
+			array, ok := v.([]interface{})
+			if !ok || s >= len(array) {
+				return nil
+			}
+			v = array[s]
+		}
+	}
+	return v
+}
+
+type filterNot struct {
+	operand filterNode
+}
+
+func (n *filterNot) eval(result interface{}) interface{} {
+	return !filterTruth(n.operand.eval(result))
+}
+
+type filterLogical struct {
+	or          bool
+	left, right filterNode
+}
+
+func (n *filterLogical) eval(result interface{}) interface{} {
+	if filterTruth(n.left.eval(result)) == n.or {
+		return n.or
+	}
+	return filterTruth(n.right.eval(result))
+}
+
+type filterCompare struct {
+	op          string
+	left, right filterNode
+	re          *regexp.Regexp
+}
+
+func (n *filterCompare) eval(result interface{}) interface{} {
+	left, right := n.left.eval(result), n.right.eval(result)
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right)
+	case "!=":
+		return !reflect.DeepEqual(left, right)
+	case "contains":
+		switch l := left.(type) {
+		case string:
+			r, ok := right.(string)
+			return ok && strings.Contains(l, r)
+		case []interface{}:
+			for _, element := range l {
+				if reflect.DeepEqual(element, right) {
+					return true
+				}
+			}
+		case map[string]interface{}:
+			r, ok := right.(string)
+			if ok {
+				_, ok = l[r]
+			}
+			return ok
+		}
+		return false
+	case "matches":
+		l, ok := left.(string)
+		return ok && n.re.MatchString(l)
+	}
+	// Ordering: numbers with numbers, strings with strings.
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false
+		}
+		if l < r {
+			cmp = -1
+		} else if l > r {
+			cmp = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return false
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// filterTruth reports whether a value counts as true.
+func filterTruth(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	case []interface{}:
+		return len(t) > 0
+	case map[string]interface{}:
+		return len(t) > 0
+	}
+	return true
+}
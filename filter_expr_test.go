@@ -0,0 +1,53 @@
+package zgrab2
+
+import "testing"
+
+func TestFilterExpression(t *testing.T) {
+	result := struct {
+		Status  int               `json:"status_code"`
+		Server  string            `json:"server"`
+		Headers map[string]string `json:"headers"`
+		Chain   []string          `json:"chain"`
+		Empty   []string          `json:"empty"`
+	}{200, "nginx/1.18.0", map[string]string{"x-powered-by": "PHP"}, []string{"leaf", "root"}, nil}
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{".status_code == 200", true},
+		{".status_code != 200", false},
+		{".status_code >= 200 && .status_code < 300", true},
+		{".server contains 'nginx'", true},
+		{`.server matches "^nginx/1\\.1[0-9]"`, true},
+		{".server matches 'apache'", false},
+		{".headers contains 'x-powered-by'", true},
+		{".headers.x-powered-by == \"PHP\"", true},
+		{".chain[1] == 'root'", true},
+		{".chain[5] == null", true},
+		{".chain contains 'leaf'", true},
+		{".empty", false},
+		{"!.missing", true},
+		{".missing.deeper", false},
+		{".status_code == 404 || (.server contains 'nginx' && !.empty)", true},
+		{".", true},
+		{".server < 'o'", true},
+		{".server < 5", false},
+	}
+	for _, test := range tests {
+		expr, err := ParseFilterExpression(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if actual := expr.Match(result); actual != test.expected {
+			t.Errorf("%s: got %v, expected %v", test.expr, actual, test.expected)
+		}
+	}
+
+	for _, bad := range []string{"", ".a ==", "(.a", ".a == 'x", ".a matches 5", ".a matches '('", ".a .b", ".a[x]", "foo", ".a # 1"} {
+		if _, err := ParseFilterExpression(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
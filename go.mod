@@ -3,6 +3,8 @@ module github.com/Positive-Engineer/zgrab2
 go 1.12
 
 require (
+	github.com/lib/pq v1.9.0
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/prometheus/client_golang v1.1.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/zmap/zcrypto v0.0.0-20200508204656-27de22294d44
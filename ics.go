@@ -0,0 +1,35 @@
+package zgrab2
+
+import "strings"
+
+// ICSDevice is the protocol-independent summary of an industrial control
+// device, emitted by the ICS modules as ics_device next to their
+// protocol-specific fields so that sweeps over several protocols can be
+// analyzed with one schema.
+type ICSDevice struct {
+	// Protocol is the name of the module that identified the device.
+	Protocol string `json:"protocol"`
+
+	Vendor   string `json:"vendor,omitempty"`
+	Product  string `json:"product,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+}
+
+// NewICSDevice returns an ICSDevice with the given fields, stripped of the
+// surrounding whitespace and NUL padding devices often send.
+func NewICSDevice(protocol, vendor, product, firmware, serial string) *ICSDevice {
+	return &ICSDevice{
+		Protocol: protocol,
+		Vendor:   trimICSField(vendor),
+		Product:  trimICSField(product),
+		Firmware: trimICSField(firmware),
+		Serial:   trimICSField(serial),
+	}
+}
+
+func trimICSField(value string) string {
+	return strings.TrimFunc(value, func(r rune) bool {
+		return r == 0 || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	})
+}
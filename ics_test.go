@@ -0,0 +1,11 @@
+package zgrab2
+
+import "testing"
+
+func TestNewICSDevice(t *testing.T) {
+	device := NewICSDevice("s7", "Siemens", " CPU 315-2 PN/DP\x00\x00", "V 3.2.6", "S C-X4U421302009\x00")
+	expected := ICSDevice{Protocol: "s7", Vendor: "Siemens", Product: "CPU 315-2 PN/DP", Firmware: "V 3.2.6", Serial: "S C-X4U421302009"}
+	if *device != expected {
+		t.Errorf("got %+v", *device)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -87,8 +88,19 @@ func InputTargetsCSV(ch chan<- ScanTarget) error {
 }
 
 // GetTargetsCSV reads targets from a CSV source, generates ScanTargets,
-// and delivers them to the provided channel.
+// and delivers them to the provided channel. Besides the records of
+// ParseCSVTarget, the IP field may hold a range of addresses FIRST-LAST,
+// which is expanded into targets for every address in the range.
 func GetTargetsCSV(source io.Reader, ch chan<- ScanTarget) error {
+	return getTargetsCSV(source, ch, false, nil)
+}
+
+// getTargetsCSV implements GetTargetsCSV. If splitPort is true, the first
+// field may carry a port (ADDRESS:PORT, [IPv6]:PORT), which is set on the
+// record's targets. If expand is non-nil, it is called for each record with
+// an address or network first; if it returns true, it has generated the
+// record's targets itself.
+func getTargetsCSV(source io.Reader, ch chan<- ScanTarget, splitPort bool, expand func(ipnet *net.IPNet, domain string, tag string) bool) error {
 	csvreader := csv.NewReader(source)
 	csvreader.Comment = '#'
 	csvreader.FieldsPerRecord = -1 // variable
@@ -102,28 +114,67 @@ func GetTargetsCSV(source io.Reader, ch chan<- ScanTarget) error {
 		if len(fields) == 0 {
 			continue
 		}
+		var port *uint
+		if splitPort {
+			if fields[0], port, err = splitTargetPort(fields[0]); err != nil {
+				log.Errorf("parse error, skipping: %v", err)
+				continue
+			}
+		}
+		first, last, isRange := parseIPRange(strings.TrimSpace(fields[0]))
+		if isRange {
+			fields[0] = first.String()
+		}
 		ipnet, domain, tag, err := ParseCSVTarget(fields)
 		if err != nil {
 			log.Errorf("parse error, skipping: %v", err)
 			continue
 		}
+		if isRange {
+			// expand the range into one target for each IP
+			for ip := duplicateIP(first); ; incrementIP(ip) {
+				ch <- ScanTarget{IP: duplicateIP(ip), Domain: domain, Tag: tag, Port: port}
+				if ip.Equal(last) {
+					break
+				}
+			}
+			continue
+		}
+		if ipnet != nil && expand != nil && expand(ipnet, domain, tag) {
+			continue
+		}
 		var ip net.IP
 		if ipnet != nil {
 			if ipnet.Mask != nil {
 				// expand CIDR block into one target for each IP
 				for ip = ipnet.IP.Mask(ipnet.Mask); ipnet.Contains(ip); incrementIP(ip) {
-					ch <- ScanTarget{IP: duplicateIP(ip), Domain: domain, Tag: tag}
+					ch <- ScanTarget{IP: duplicateIP(ip), Domain: domain, Tag: tag, Port: port}
 				}
 				continue
 			} else {
 				ip = ipnet.IP
 			}
 		}
-		ch <- ScanTarget{IP: ip, Domain: domain, Tag: tag}
+		ch <- ScanTarget{IP: ip, Domain: domain, Tag: tag, Port: port}
 	}
 	return nil
 }
 
+// splitTargetPort splits an optional port off an address field. Fields
+// without a port, including bare IPv6 addresses, are returned unchanged.
+func splitTargetPort(field string) (string, *uint, error) {
+	host, portString, err := net.SplitHostPort(strings.TrimSpace(field))
+	if err != nil {
+		return field, nil, nil
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil || port == 0 {
+		return field, nil, fmt.Errorf("invalid port in %q", field)
+	}
+	p := uint(port)
+	return host, &p, nil
+}
+
 // InputTargetsFunc is a function type for target input functions.
 //
 // A function of this type generates ScanTargets on the provided
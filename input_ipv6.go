@@ -0,0 +1,195 @@
+package zgrab2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IPv6 prefixes are far too large to enumerate, so when --ipv6-patterns is
+// given, IPv6 CIDR blocks in the input are expanded into the addresses that
+// hitlist research shows are likely to be in use, instead of every address
+// in the block.
+//
+// Supported patterns (comma separated):
+//
+//	lowbyte[:N]   interface IDs ::1 to ::N (default 16)
+//	services      interface IDs spelling common ports (::21, ::22, ::25,
+//	              ::53, ::80, ::443, ...)
+//	words         well-known "wordy" interface IDs (::cafe, ::dead:beef, ...)
+//	iid:VALUE     a fixed interface ID, given as an IPv6 suffix (::1:2) or
+//	              as an embedded IPv4 address (192.0.2.1)
+//
+// Prefixes shorter than /64 are first split into their first
+// --ipv6-subnets /64 subnets, and every pattern is applied to each one.
+
+// ipv6Pattern returns the interface IDs (low 64 bits) of one pattern.
+type ipv6Pattern func() []uint64
+
+var ipv6ServiceIIDs = []string{"21", "22", "25", "53", "80", "110", "143", "443", "465", "587", "993", "995", "3389", "8080", "8443"}
+
+var ipv6WordIIDs = []uint64{
+	0xcafe, 0xbabe, 0xface, 0xbeef, 0xfeed, 0xc0de, 0xf00d, 0xdead,
+	0xdeadbeef, 0xcafebabe, 0xbadc0de, 0xc0ffee, 0xdeadc0de, 0xfeedface,
+}
+
+func parseIPv6Pattern(spec string) (ipv6Pattern, error) {
+	name, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, arg = spec[:i], spec[i+1:]
+	}
+	switch name {
+	case "lowbyte":
+		count := uint64(16)
+		if arg != "" {
+			var err error
+			if count, err = strconv.ParseUint(arg, 10, 16); err != nil || count == 0 {
+				return nil, fmt.Errorf("invalid lowbyte count %q", arg)
+			}
+		}
+		return func() []uint64 {
+			ret := make([]uint64, count)
+			for i := range ret {
+				ret[i] = uint64(i) + 1
+			}
+			return ret
+		}, nil
+	case "services":
+		return func() []uint64 {
+			ret := make([]uint64, len(ipv6ServiceIIDs))
+			for i, port := range ipv6ServiceIIDs {
+				// ::443 means the hex digits 4, 4, 3, not the number 443.
+				ret[i], _ = strconv.ParseUint(port, 16, 64)
+			}
+			return ret
+		}, nil
+	case "words":
+		return func() []uint64 { return ipv6WordIIDs }, nil
+	case "iid":
+		iid, err := parseIID(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func() []uint64 { return []uint64{iid} }, nil
+	}
+	return nil, fmt.Errorf("unknown IPv6 pattern %q", name)
+}
+
+// parseIID parses an interface ID given as an IPv6 suffix or an IPv4
+// address.
+func parseIID(value string) (uint64, error) {
+	if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+		return uint64(binary.BigEndian.Uint32(ip.To4())), nil
+	}
+	if !strings.HasPrefix(value, "::") {
+		value = "::" + value
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return 0, fmt.Errorf("invalid interface ID %q", value)
+	}
+	if binary.BigEndian.Uint64(ip[:8]) != 0 {
+		return 0, fmt.Errorf("interface ID %q is longer than 64 bits", value)
+	}
+	return binary.BigEndian.Uint64(ip[8:]), nil
+}
+
+// IPv6Generator expands IPv6 prefixes into candidate addresses.
+type IPv6Generator struct {
+	patterns []ipv6Pattern
+	subnets  uint64
+}
+
+// NewIPv6Generator parses a comma-separated pattern list. subnets is the
+// number of /64 subnets used from prefixes shorter than /64.
+func NewIPv6Generator(patterns string, subnets int) (*IPv6Generator, error) {
+	if subnets <= 0 {
+		return nil, fmt.Errorf("need at least one subnet, given %d", subnets)
+	}
+	ret := &IPv6Generator{subnets: uint64(subnets)}
+	for _, spec := range strings.Split(patterns, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		pattern, err := parseIPv6Pattern(spec)
+		if err != nil {
+			return nil, err
+		}
+		ret.patterns = append(ret.patterns, pattern)
+	}
+	if len(ret.patterns) == 0 {
+		return nil, fmt.Errorf("no IPv6 patterns given")
+	}
+	return ret, nil
+}
+
+// Expand calls emit for each generated address in prefix, without
+// duplicates.
+func (g *IPv6Generator) Expand(prefix *net.IPNet, emit func(net.IP)) {
+	ones, bits := prefix.Mask.Size()
+	if bits != 128 {
+		return
+	}
+	base := prefix.IP.Mask(prefix.Mask).To16()
+	network := binary.BigEndian.Uint64(base[:8])
+	subnets := uint64(1)
+	if ones < 64 {
+		// Number of /64s in the prefix, capped at the configured count.
+		subnets = g.subnets
+		if free := uint(64 - ones); free < 63 && uint64(1)<<free < subnets {
+			subnets = uint64(1) << free
+		}
+	}
+	var hostMask uint64 = ^uint64(0)
+	if ones > 64 {
+		hostMask = ^uint64(0) >> uint(ones-64)
+	}
+	// The subnets differ in their high 64 bits, so the addresses are unique
+	// as long as the interface IDs are: only those are de-duplicated.
+	low := binary.BigEndian.Uint64(base[8:])
+	var iids []uint64
+	seen := make(map[uint64]bool)
+	for _, pattern := range g.patterns {
+		for _, iid := range pattern() {
+			iid = low | (iid & hostMask)
+			if !seen[iid] {
+				seen[iid] = true
+				iids = append(iids, iid)
+			}
+		}
+	}
+	for subnet := uint64(0); subnet < subnets; subnet++ {
+		for _, iid := range iids {
+			ip := make(net.IP, net.IPv6len)
+			binary.BigEndian.PutUint64(ip[:8], network+subnet)
+			binary.BigEndian.PutUint64(ip[8:], iid)
+			emit(ip)
+		}
+	}
+}
+
+// InputTargetsIPv6Patterns is an InputTargetsFunc that reads the CSV input
+// like InputTargetsCSV, but expands IPv6 CIDR blocks with the configured
+// --ipv6-patterns.
+func InputTargetsIPv6Patterns(ch chan<- ScanTarget) error {
+	return GetTargetsIPv6Patterns(config.inputFile, config.ipv6Generator, ch)
+}
+
+// GetTargetsIPv6Patterns reads targets from a CSV source; IPv6 CIDR blocks
+// are expanded with the generator, other records are handled as in
+// GetTargetsCSV.
+func GetTargetsIPv6Patterns(source io.Reader, generator *IPv6Generator, ch chan<- ScanTarget) error {
+	return getTargetsCSV(source, ch, false, func(ipnet *net.IPNet, domain string, tag string) bool {
+		if ipnet.Mask == nil || ipnet.IP.To4() != nil {
+			return false
+		}
+		generator.Expand(ipnet, func(ip net.IP) {
+			ch <- ScanTarget{IP: ip, Domain: domain, Tag: tag}
+		})
+		return true
+	})
+}
@@ -0,0 +1,113 @@
+package zgrab2
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestIPv6Generator(t *testing.T) {
+	tests := []struct {
+		patterns string
+		subnets  int
+		prefix   string
+		expected []string
+	}{
+		{
+			patterns: "lowbyte:3",
+			subnets:  1,
+			prefix:   "2001:db8::/48",
+			expected: []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"},
+		},
+		{
+			patterns: "lowbyte:2,iid:::2,iid:192.0.2.1",
+			subnets:  2,
+			prefix:   "2001:db8:0:10::/60",
+			expected: []string{
+				"2001:db8:0:10::1", "2001:db8:0:10::2", "2001:db8:0:10::c000:201",
+				"2001:db8:0:11::1", "2001:db8:0:11::2", "2001:db8:0:11::c000:201",
+			},
+		},
+		{
+			patterns: "services",
+			subnets:  4,
+			prefix:   "2001:db8::/64",
+			expected: []string{"2001:db8::21", "2001:db8::22", "2001:db8::25", "2001:db8::53", "2001:db8::80"},
+		},
+		{
+			patterns: "lowbyte:300",
+			subnets:  1,
+			prefix:   "2001:db8::100/120",
+			expected: []string{"2001:db8::101", "2001:db8::102"},
+		},
+	}
+	for _, test := range tests {
+		generator, err := NewIPv6Generator(test.patterns, test.subnets)
+		if err != nil {
+			t.Fatalf("%s: %v", test.patterns, err)
+		}
+		_, prefix, _ := net.ParseCIDR(test.prefix)
+		var got []string
+		generator.Expand(prefix, func(ip net.IP) {
+			got = append(got, ip.String())
+		})
+		if len(got) < len(test.expected) {
+			t.Errorf("%s %s: got %d addresses, expected at least %d", test.patterns, test.prefix, len(got), len(test.expected))
+			continue
+		}
+		for i, expected := range test.expected {
+			if got[i] != expected {
+				t.Errorf("%s %s: address %d is %s, expected %s", test.patterns, test.prefix, i, got[i], expected)
+			}
+		}
+	}
+}
+
+func TestIPv6GeneratorDuplicates(t *testing.T) {
+	generator, err := NewIPv6Generator("lowbyte:16,iid:::1,words,iid:::cafe", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, prefix, _ := net.ParseCIDR("2001:db8::/32")
+	seen := make(map[string]bool)
+	generator.Expand(prefix, func(ip net.IP) {
+		if seen[ip.String()] {
+			t.Errorf("duplicate address %s", ip)
+		}
+		seen[ip.String()] = true
+	})
+	if expected := 1000 * (16 + len(ipv6WordIIDs)); len(seen) != expected {
+		t.Errorf("got %d addresses, expected %d", len(seen), expected)
+	}
+}
+
+func TestIPv6GeneratorErrors(t *testing.T) {
+	for _, patterns := range []string{"", "bogus", "lowbyte:0", "iid:zz", "iid:1::2:3:4:5:6"} {
+		if _, err := NewIPv6Generator(patterns, 1); err == nil {
+			t.Errorf("%q: expected an error", patterns)
+		}
+	}
+}
+
+func TestGetTargetsIPv6Patterns(t *testing.T) {
+	input := "2001:db8::/64,,v6\n10.0.0.0/31\n2001:db8::5\n"
+	generator, err := NewIPv6Generator("lowbyte:2", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan ScanTarget)
+	go func() {
+		if err := GetTargetsIPv6Patterns(strings.NewReader(input), generator, ch); err != nil {
+			t.Errorf("GetTargets error: %v", err)
+		}
+		close(ch)
+	}()
+	var got []string
+	for target := range ch {
+		got = append(got, target.IP.String()+"/"+target.Tag)
+	}
+	expected := []string{"2001:db8::1/v6", "2001:db8::2/v6", "10.0.0.0/", "10.0.0.1/", "2001:db8::5/"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,96 @@
+package zgrab2
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+)
+
+// pipeTargets runs input, and calls process with the channel of its targets,
+// which process sends on to ch. It returns the error of input.
+func pipeTargets(input InputTargetsFunc, ch chan<- ScanTarget, process func(targets <-chan ScanTarget)) error {
+	targets := make(chan ScanTarget)
+	inputDone := make(chan error, 1)
+	go func() {
+		err := input(targets)
+		close(targets)
+		inputDone <- err
+	}()
+	process(targets)
+	return <-inputDone
+}
+
+// targetKey identifies the scans of a target: its address or domain, port and
+// tag, which selects the scanners.
+func targetKey(target *ScanTarget) string {
+	port := ""
+	if target.Port != nil {
+		port = fmt.Sprint(*target.Port)
+	}
+	return string(target.IP.To16()) + "\x00" + target.Domain + "\x00" + port + "\x00" + target.Tag
+}
+
+// DedupTargets returns an InputTargetsFunc that passes on the targets of
+// input, dropping those with the same address, domain, port and tag as an
+// earlier one. It remembers every target of the input.
+func DedupTargets(input InputTargetsFunc) InputTargetsFunc {
+	return func(ch chan<- ScanTarget) error {
+		return pipeTargets(input, ch, func(targets <-chan ScanTarget) {
+			seen := make(map[string]bool)
+			for target := range targets {
+				key := targetKey(&target)
+				if !seen[key] {
+					seen[key] = true
+					ch <- target
+				}
+			}
+		})
+	}
+}
+
+// ShuffleTargets returns an InputTargetsFunc that passes on the targets of
+// input in random order, chosen by seed: each target is sent once window
+// others have been read after it, on average. The same input and seed give
+// the same order.
+func ShuffleTargets(input InputTargetsFunc, window int, seed int64) InputTargetsFunc {
+	return func(ch chan<- ScanTarget) error {
+		return pipeTargets(input, ch, func(targets <-chan ScanTarget) {
+			random := rand.New(rand.NewSource(seed))
+			buffer := make([]ScanTarget, 0, window)
+			for target := range targets {
+				if len(buffer) < window {
+					buffer = append(buffer, target)
+					continue
+				}
+				i := random.Intn(window)
+				ch <- buffer[i]
+				buffer[i] = target
+			}
+			random.Shuffle(len(buffer), func(i, j int) {
+				buffer[i], buffer[j] = buffer[j], buffer[i]
+			})
+			for _, target := range buffer {
+				ch <- target
+			}
+		})
+	}
+}
+
+// parseIPRange parses a range of addresses of the same family, given as
+// FIRST-LAST, e.g. 10.0.0.1-10.0.0.255.
+func parseIPRange(field string) (first net.IP, last net.IP, ok bool) {
+	i := strings.IndexByte(field, '-')
+	if i < 0 {
+		return nil, nil, false
+	}
+	first, last = net.ParseIP(field[:i]), net.ParseIP(field[i+1:])
+	if first == nil || last == nil || (first.To4() == nil) != (last.To4() == nil) {
+		return nil, nil, false
+	}
+	if first.To4() != nil {
+		first, last = first.To4(), last.To4()
+	}
+	return first, last, bytes.Compare(first, last) <= 0
+}
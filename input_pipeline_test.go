@@ -0,0 +1,88 @@
+package zgrab2
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// collectTargets returns the addresses or domains of the targets of input.
+func collectTargets(t *testing.T, input InputTargetsFunc) []string {
+	ch := make(chan ScanTarget)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- input(ch)
+		close(ch)
+	}()
+	var ret []string
+	for target := range ch {
+		host := target.Domain
+		if target.IP != nil {
+			host = target.IP.String()
+		}
+		ret = append(ret, host+"/"+target.Tag)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+// csvInput returns an InputTargetsFunc reading the CSV data.
+func csvInput(data string) InputTargetsFunc {
+	return func(ch chan<- ScanTarget) error {
+		return GetTargetsCSV(strings.NewReader(data), ch)
+	}
+}
+
+func TestIPRangeInput(t *testing.T) {
+	targets := collectTargets(t, csvInput("10.0.0.254-10.0.1.1,,http\n10.0.0.9-10.0.0.1\nfe80::1-fe80::2\n"))
+	expected := []string{"10.0.0.254/http", "10.0.0.255/http", "10.0.1.0/http", "10.0.1.1/http", "10.0.0.9-10.0.0.1/", "fe80::1/", "fe80::2/"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("got %v", targets)
+	}
+	if _, _, ok := parseIPRange("10.0.0.1-fe80::1"); ok {
+		t.Error("expected mixed families to be rejected")
+	}
+}
+
+func TestDedupTargets(t *testing.T) {
+	port := uint(443)
+	input := func(ch chan<- ScanTarget) error {
+		for _, target := range []ScanTarget{
+			{IP: net.ParseIP("10.0.0.1")},
+			{IP: net.ParseIP("10.0.0.1"), Tag: "tls"},
+			{IP: net.ParseIP("10.0.0.1").To4()},
+			{IP: net.ParseIP("10.0.0.1"), Port: &port},
+			{Domain: "example.com"},
+			{Domain: "example.com"},
+		} {
+			ch <- target
+		}
+		return nil
+	}
+	targets := collectTargets(t, DedupTargets(input))
+	expected := []string{"10.0.0.1/", "10.0.0.1/tls", "10.0.0.1/", "example.com/"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("got %v", targets)
+	}
+}
+
+func TestShuffleTargets(t *testing.T) {
+	input := csvInput("10.0.0.0/26\n")
+	ordered := collectTargets(t, input)
+	shuffled := collectTargets(t, ShuffleTargets(input, 16, 42))
+	if reflect.DeepEqual(shuffled, ordered) {
+		t.Error("the targets were not shuffled")
+	}
+	if again := collectTargets(t, ShuffleTargets(input, 16, 42)); !reflect.DeepEqual(again, shuffled) {
+		t.Error("the same seed gave another order")
+	}
+	sort.Strings(shuffled)
+	sort.Strings(ordered)
+	if !reflect.DeepEqual(shuffled, ordered) {
+		t.Errorf("got targets %v", shuffled)
+	}
+}
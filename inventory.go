@@ -0,0 +1,74 @@
+package zgrab2
+
+import "fmt"
+
+// Types of InventoryEntry.
+const (
+	InventoryFile      = "file"
+	InventoryDirectory = "directory"
+	InventoryLink      = "link"
+)
+
+// InventoryFlags are the options of modules that can list the content a
+// server exposes to anonymous users. Only the top level is listed, and no
+// file is downloaded.
+type InventoryFlags struct {
+	Inventory           bool `long:"inventory" description:"If anonymous read access is confirmed, list the top-level directory or shares (no file is downloaded)"`
+	InventoryMaxEntries int  `long:"inventory-max-entries" default:"50" description:"Maximum number of entries recorded by --inventory"`
+}
+
+// Validate checks the inventory flags.
+func (flags *InventoryFlags) Validate() error {
+	if flags.InventoryMaxEntries < 1 {
+		return fmt.Errorf("--inventory-max-entries must be positive")
+	}
+	return nil
+}
+
+// NewInventory returns an empty Inventory of path, holding at most the
+// configured number of entries.
+func (flags *InventoryFlags) NewInventory(path string) *Inventory {
+	return &Inventory{Path: path, Entries: []InventoryEntry{}, max: flags.InventoryMaxEntries}
+}
+
+// InventoryEntry is an item of an Inventory.
+type InventoryEntry struct {
+	Name string `json:"name"`
+
+	// Type is InventoryFile, InventoryDirectory, InventoryLink or a
+	// protocol-specific type (e.g. the type of an SMB share).
+	Type string `json:"type,omitempty"`
+
+	// Size is the size in bytes, if the listing has it.
+	Size int64 `json:"size,omitempty"`
+
+	// Comment is any further description given by the server.
+	Comment string `json:"comment,omitempty"`
+}
+
+// Inventory is a bounded listing of anonymously readable content.
+type Inventory struct {
+	// Path is the listed directory, if any.
+	Path string `json:"path,omitempty"`
+
+	Entries []InventoryEntry `json:"entries"`
+
+	// Truncated is true if the listing had more entries than were kept.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Error is set if the listing failed part way.
+	Error string `json:"error,omitempty"`
+
+	max int
+}
+
+// Add appends the entry, unless the inventory is full; it returns false
+// once an entry has been dropped, after which the listing can stop.
+func (inv *Inventory) Add(entry InventoryEntry) bool {
+	if inv.max > 0 && len(inv.Entries) >= inv.max {
+		inv.Truncated = true
+		return false
+	}
+	inv.Entries = append(inv.Entries, entry)
+	return true
+}
@@ -0,0 +1,20 @@
+package zgrab2
+
+import "testing"
+
+func TestInventoryAdd(t *testing.T) {
+	flags := InventoryFlags{InventoryMaxEntries: 2}
+	inv := flags.NewInventory("/")
+	for i, name := range []string{"a", "b", "c", "d"} {
+		added := inv.Add(InventoryEntry{Name: name})
+		if added != (i < 2) {
+			t.Errorf("Add(%s) = %v", name, added)
+		}
+	}
+	if len(inv.Entries) != 2 || inv.Entries[1].Name != "b" || !inv.Truncated {
+		t.Errorf("unexpected inventory %+v", inv)
+	}
+	if err := (&InventoryFlags{}).Validate(); err == nil {
+		t.Error("expected an error for --inventory-max-entries=0")
+	}
+}
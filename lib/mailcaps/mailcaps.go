@@ -0,0 +1,80 @@
+// Package mailcaps compares the capabilities advertised by mail servers:
+// the EHLO keywords of SMTP, the CAPA lines of POP3 and the CAPABILITY
+// atoms of IMAP, with their parameters.
+package mailcaps
+
+import (
+	"strings"
+)
+
+// keyword returns the keyword of a capability, without its parameters.
+func keyword(capability string) string {
+	if fields := strings.Fields(capability); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// Has returns true if one of the capabilities has the keyword, compared
+// case-insensitively.
+func Has(capabilities []string, name string) bool {
+	for _, capability := range capabilities {
+		if strings.EqualFold(keyword(capability), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mechanisms returns the uppercased SASL mechanisms of the capabilities
+// with the keyword, given either as parameters ("AUTH PLAIN LOGIN", "SASL
+// PLAIN") or after "=" ("AUTH=PLAIN"), without duplicates.
+func Mechanisms(capabilities []string, name string) []string {
+	var mechanisms []string
+	seen := make(map[string]bool)
+	name = strings.ToUpper(name)
+	for _, capability := range capabilities {
+		fields := strings.Fields(strings.ToUpper(capability))
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == name:
+			fields = fields[1:]
+		case strings.HasPrefix(fields[0], name+"="):
+			fields[0] = strings.TrimPrefix(fields[0], name+"=")
+		default:
+			continue
+		}
+		for _, mechanism := range fields {
+			if mechanism != "" && !seen[mechanism] {
+				seen[mechanism] = true
+				mechanisms = append(mechanisms, mechanism)
+			}
+		}
+	}
+	return mechanisms
+}
+
+// Delta returns the capabilities of after that are not in before, and those
+// of before that are not in after, compared case-insensitively.
+func Delta(before, after []string) (added, removed []string) {
+	missing := func(list []string, capability string) bool {
+		for _, other := range list {
+			if strings.EqualFold(other, capability) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, capability := range after {
+		if missing(before, capability) {
+			added = append(added, capability)
+		}
+	}
+	for _, capability := range before {
+		if missing(after, capability) {
+			removed = append(removed, capability)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,43 @@
+package mailcaps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHas(t *testing.T) {
+	capabilities := []string{"SIZE 10240000", "starttls", "AUTH=PLAIN"}
+	for name, expected := range map[string]bool{"STARTTLS": true, "size": true, "AUTH": false, "8BITMIME": false} {
+		if Has(capabilities, name) != expected {
+			t.Errorf("%s: expected %v", name, expected)
+		}
+	}
+}
+
+func TestMechanisms(t *testing.T) {
+	tests := []struct {
+		capabilities []string
+		name         string
+		expected     []string
+	}{
+		// SMTP, with the obsolete AUTH= form.
+		{[]string{"SIZE 10240000", "AUTH PLAIN login", "AUTH=LOGIN CRAM-MD5"}, "AUTH", []string{"PLAIN", "LOGIN", "CRAM-MD5"}},
+		// POP3.
+		{[]string{"TOP", "SASL PLAIN CRAM-MD5", "USER"}, "SASL", []string{"PLAIN", "CRAM-MD5"}},
+		// IMAP.
+		{[]string{"IMAP4REV1", "AUTH=PLAIN", "AUTH=", "AUTH=XOAUTH2", "LOGINDISABLED"}, "AUTH", []string{"PLAIN", "XOAUTH2"}},
+		{[]string{"STARTTLS"}, "AUTH", nil},
+	}
+	for _, test := range tests {
+		if mechanisms := Mechanisms(test.capabilities, test.name); !reflect.DeepEqual(mechanisms, test.expected) {
+			t.Errorf("%v: got %v, expected %v", test.capabilities, mechanisms, test.expected)
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	added, removed := Delta([]string{"STLS", "USER", "TOP"}, []string{"top", "USER", "SASL PLAIN"})
+	if !reflect.DeepEqual(added, []string{"SASL PLAIN"}) || !reflect.DeepEqual(removed, []string{"STLS"}) {
+		t.Errorf("added %v, removed %v", added, removed)
+	}
+}
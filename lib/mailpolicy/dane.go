@@ -0,0 +1,175 @@
+package mailpolicy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/zmap/zcrypto/x509"
+)
+
+// TLSA certificate usages (RFC 6698). SMTP clients only use DANE-TA and
+// DANE-EE (RFC 7672, section 3.1.3).
+const (
+	UsagePKIXTA = 0
+	UsagePKIXEE = 1
+	UsageDANETA = 2
+	UsageDANEEE = 3
+)
+
+// TLSARecord is a TLSA record.
+type TLSARecord struct {
+	Usage        uint8 `json:"usage"`
+	Selector     uint8 `json:"selector"`
+	MatchingType uint8 `json:"matching_type"`
+
+	// Data is the certificate association data, in hex.
+	Data string `json:"data"`
+
+	data []byte
+}
+
+// usable returns true if an SMTP client can use the record.
+func (record *TLSARecord) usable() bool {
+	return (record.Usage == UsageDANETA || record.Usage == UsageDANEEE) && record.Selector <= 1 && record.MatchingType <= 2
+}
+
+// matches returns true if the record's association data matches the
+// certificate.
+func (record *TLSARecord) matches(cert *x509.Certificate) bool {
+	selected := cert.Raw
+	if record.Selector == 1 {
+		selected = cert.RawSubjectPublicKeyInfo
+	}
+	switch record.MatchingType {
+	case 0:
+		return bytes.Equal(selected, record.data)
+	case 1:
+		sum := sha256.Sum256(selected)
+		return bytes.Equal(sum[:], record.data)
+	case 2:
+		sum := sha512.Sum512(selected)
+		return bytes.Equal(sum[:], record.data)
+	}
+	return false
+}
+
+// DANEResult holds the TLSA records of a server and whether its
+// certificate chain matches them.
+type DANEResult struct {
+	// Name is the TLSA owner name, e.g. _25._tcp.mx.example.com.
+	Name    string       `json:"name"`
+	Records []TLSARecord `json:"records,omitempty"`
+
+	// Authenticated is true if the resolver validated the records with
+	// DNSSEC; unauthenticated records must be ignored.
+	Authenticated bool `json:"authenticated"`
+
+	// Usable is true if the records are authenticated and at least one of
+	// them is a DANE-TA or DANE-EE record an SMTP client can use, so that
+	// a DANE-aware sender requires a matching certificate.
+	Usable bool `json:"usable"`
+
+	// Checked is true if a certificate chain was checked against the
+	// records.
+	Checked bool `json:"checked,omitempty"`
+
+	// MatchedRecord is the record the chain matched.
+	MatchedRecord *TLSARecord `json:"matched_record,omitempty"`
+
+	// Valid is true if the chain matched a usable record.
+	Valid bool `json:"valid"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// parseTLSA parses the RDATA of a TLSA record.
+func parseTLSA(data []byte) (TLSARecord, error) {
+	if len(data) < 4 {
+		return TLSARecord{}, fmt.Errorf("TLSA record too short (%d bytes)", len(data))
+	}
+	return TLSARecord{
+		Usage:        data[0],
+		Selector:     data[1],
+		MatchingType: data[2],
+		Data:         hex.EncodeToString(data[3:]),
+		data:         data[3:],
+	}, nil
+}
+
+// LookupDANE looks up the TLSA records of a TCP service on host.
+func LookupDANE(host string, port uint, timeout time.Duration) *DANEResult {
+	result := &DANEResult{Name: fmt.Sprintf("_%d._tcp.%s", port, host)}
+	response, err := zgrab2.LookupDNS(result.Name, zgrab2.DNSTypeTLSA, timeout)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if response.RCode != 0 && response.RCode != zgrab2.DNSRCodeNameError {
+		result.Error = fmt.Sprintf("TLSA lookup failed with rcode %d", response.RCode)
+		return result
+	}
+	result.Authenticated = response.Authenticated
+	for _, answer := range response.Answers {
+		record, err := parseTLSA(answer.Data)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Records = append(result.Records, record)
+		if record.usable() {
+			result.Usable = result.Authenticated
+		}
+	}
+	return result
+}
+
+// Check checks a certificate chain (leaf first) presented by host against
+// the records, following RFC 7672: a DANE-EE record must match the leaf,
+// whose names and dates are not checked; a DANE-TA record must match a
+// certificate the leaf chains to, and the leaf must be valid for host.
+func (result *DANEResult) Check(chain []*x509.Certificate, host string) {
+	if !result.Usable || len(chain) == 0 {
+		return
+	}
+	result.Checked = true
+	for i := range result.Records {
+		record := &result.Records[i]
+		if !record.usable() {
+			continue
+		}
+		if record.Usage == UsageDANEEE {
+			if record.matches(chain[0]) {
+				result.MatchedRecord, result.Valid = record, true
+				return
+			}
+			continue
+		}
+		for j := 1; j < len(chain); j++ {
+			if !record.matches(chain[j]) {
+				continue
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(chain[j])
+			intermediates := x509.NewCertPool()
+			for _, cert := range chain[1:j] {
+				intermediates.AddCert(cert)
+			}
+			current, _, _, err := chain[0].Verify(x509.VerifyOptions{
+				DNSName:       host,
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+				CurrentTime:   time.Now(),
+			})
+			if err == nil && len(current) > 0 {
+				result.MatchedRecord, result.Valid = record, true
+				return
+			}
+		}
+	}
+}
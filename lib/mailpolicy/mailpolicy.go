@@ -0,0 +1,115 @@
+// Package mailpolicy looks up the DANE (TLSA, RFC 7672) and MTA-STS
+// (RFC 8461) policies of mail servers and domains, and checks whether the
+// certificate chain presented by a server conforms to them.
+//
+// TLSA records are only trusted if the resolver set with --dns-resolver
+// reports them as validated with DNSSEC (the AD bit).
+package mailpolicy
+
+import (
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/zmap/zcrypto/x509"
+)
+
+// Results holds the conformance of a mail server to the policies of its
+// host name and mail domain.
+type Results struct {
+	DANE   *DANEResult   `json:"dane,omitempty"`
+	MTASTS *MTASTSResult `json:"mta_sts,omitempty"`
+
+	// MXMatch is true if the server's host name matches the mx patterns
+	// of the MTA-STS policy.
+	MXMatch bool `json:"mx_match"`
+
+	// CertificateValid is true if the chain is trusted and valid for the
+	// server's host name, as MTA-STS requires.
+	CertificateValid bool   `json:"certificate_valid"`
+	CertificateError string `json:"certificate_error,omitempty"`
+
+	// MTASTSConformant is true if the domain has an MTA-STS policy in
+	// enforce or testing mode, and a sender enforcing it would deliver to
+	// the server.
+	MTASTSConformant bool `json:"mta_sts_conformant"`
+
+	// DANEConformant is true if the server has usable TLSA records and
+	// the chain matches one of them.
+	DANEConformant bool `json:"dane_conformant"`
+}
+
+// Check looks up the TLSA records of host and port and the MTA-STS policy
+// of domain, and checks chain (leaf first, empty if the server did not
+// offer TLS) against them. roots are the trust anchors of MTA-STS.
+func Check(host string, port uint, domain string, chain []*x509.Certificate, roots *x509.CertPool, timeout time.Duration) *Results {
+	results := &Results{
+		DANE:   LookupDANE(host, port, timeout),
+		MTASTS: FetchMTASTS(domain, timeout),
+	}
+	results.DANE.Check(chain, host)
+	results.DANEConformant = results.DANE.Valid
+	policy := results.MTASTS.Policy
+	if policy != nil {
+		results.MXMatch = policy.MatchMX(host)
+	}
+	if err := verifyChain(chain, host, roots); err != nil {
+		results.CertificateError = err.Error()
+	} else {
+		results.CertificateValid = true
+	}
+	results.MTASTSConformant = policy != nil && policy.Mode != "none" && results.MXMatch && results.CertificateValid
+	return results
+}
+
+// verifyChain checks that the leaf of chain is valid for host and chains to
+// roots.
+func verifyChain(chain []*x509.Certificate, host string, roots *x509.CertPool) error {
+	if len(chain) == 0 {
+		return errors.New("no certificate presented")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, _, _, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+	})
+	return err
+}
+
+// systemRootFiles are the usual locations of the system CA bundle.
+var systemRootFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// LoadRoots reads the PEM trust anchors of file, or of the system CA bundle
+// if file is empty.
+func LoadRoots(file string) (*x509.CertPool, error) {
+	files := systemRootFiles
+	if file != "" {
+		files = []string{file}
+	}
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			if file != "" {
+				return nil, err
+			}
+			continue
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates in " + name)
+		}
+		return roots, nil
+	}
+	return nil, errors.New("no system CA bundle found")
+}
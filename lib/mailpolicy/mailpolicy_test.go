@@ -0,0 +1,192 @@
+package mailpolicy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	stdx509 "crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zmap/zcrypto/x509"
+)
+
+// testChain returns a leaf for mx.example.com issued by a CA, and the CA.
+func testChain(t *testing.T) []*x509.Certificate {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Now()
+	caTemplate := &stdx509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              stdx509.KeyUsageCertSign,
+	}
+	caDER, err := stdx509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &stdx509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "mx.example.com"},
+		DNSNames:     []string{"mx.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		ExtKeyUsage:  []stdx509.ExtKeyUsage{stdx509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := stdx509.CreateCertificate(rand.Reader, leafTemplate, caTemplate, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chain []*x509.Certificate
+	for _, der := range [][]byte{leafDER, caDER} {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain
+}
+
+func tlsaRecord(t *testing.T, usage, selector, matchingType uint8, cert *x509.Certificate) TLSARecord {
+	selected := cert.Raw
+	if selector == 1 {
+		selected = cert.RawSubjectPublicKeyInfo
+	}
+	if matchingType == 1 {
+		sum := sha256.Sum256(selected)
+		selected = sum[:]
+	}
+	record, err := parseTLSA(append([]byte{usage, selector, matchingType}, selected...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestDANECheck(t *testing.T) {
+	chain := testChain(t)
+	other := testChain(t)
+	for _, test := range []struct {
+		name    string
+		records []TLSARecord
+		host    string
+		valid   bool
+	}{
+		{"DANE-EE SPKI SHA-256", []TLSARecord{tlsaRecord(t, 3, 1, 1, chain[0])}, "mx.example.com", true},
+		// DANE-EE ignores the names of the certificate.
+		{"DANE-EE full certificate, other name", []TLSARecord{tlsaRecord(t, 3, 0, 0, chain[0])}, "mx.example.net", true},
+		{"DANE-EE mismatch", []TLSARecord{tlsaRecord(t, 3, 1, 1, other[0])}, "mx.example.com", false},
+		{"DANE-TA", []TLSARecord{tlsaRecord(t, 3, 1, 1, other[0]), tlsaRecord(t, 2, 0, 1, chain[1])}, "mx.example.com", true},
+		{"DANE-TA, other name", []TLSARecord{tlsaRecord(t, 2, 0, 1, chain[1])}, "mx.example.net", false},
+		// A DANE-TA record must not match the leaf.
+		{"DANE-TA on the leaf", []TLSARecord{tlsaRecord(t, 2, 1, 1, chain[0])}, "mx.example.com", false},
+		{"PKIX-EE", []TLSARecord{tlsaRecord(t, 1, 1, 1, chain[0])}, "mx.example.com", false},
+	} {
+		result := &DANEResult{Records: test.records, Authenticated: true}
+		for _, record := range test.records {
+			if record.usable() {
+				result.Usable = true
+			}
+		}
+		result.Check(chain, test.host)
+		if result.Valid != test.valid {
+			t.Errorf("%s: got %v, expected %v", test.name, result.Valid, test.valid)
+		}
+		if result.Valid && result.MatchedRecord == nil {
+			t.Errorf("%s: no matched record", test.name)
+		}
+	}
+
+	// Unauthenticated records are not usable.
+	result := &DANEResult{Records: []TLSARecord{tlsaRecord(t, 3, 1, 1, chain[0])}}
+	result.Check(chain, "mx.example.com")
+	if result.Checked || result.Valid {
+		t.Errorf("unauthenticated records were used: %+v", result)
+	}
+}
+
+func TestParseTLSA(t *testing.T) {
+	record, err := parseTLSA([]byte{3, 1, 1, 0xab, 0xcd})
+	if err != nil || record.Data != "abcd" || record.Usage != 3 || !record.usable() {
+		t.Errorf("got %+v, %v", record, err)
+	}
+	if _, err := parseTLSA([]byte{3, 1, 1}); err == nil {
+		t.Error("expected an error for a record without data")
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	chain := testChain(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(chain[1])
+	if err := verifyChain(chain, "mx.example.com", roots); err != nil {
+		t.Errorf("valid chain: %v", err)
+	}
+	if err := verifyChain(chain, "mx.example.net", roots); err == nil {
+		t.Error("expected an error for another name")
+	}
+	if err := verifyChain(chain, "mx.example.com", x509.NewCertPool()); err == nil {
+		t.Error("expected an error for an untrusted chain")
+	}
+	if err := verifyChain(nil, "mx.example.com", roots); err == nil {
+		t.Error("expected an error without certificates")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(strings.NewReader("version: STSv1\r\nmode: enforce\r\nmx: mail.example.com\r\nmx: *.example.net\r\nmax_age: 604800\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Mode != "enforce" || policy.MaxAge != 604800 || len(policy.MX) != 2 {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+	for host, expected := range map[string]bool{
+		"mail.example.com":     true,
+		"MAIL.example.com.":    true,
+		"mx1.example.net":      true,
+		"a.mx1.example.net":    false,
+		"example.net":          false,
+		"mail.example.com.org": false,
+	} {
+		if policy.MatchMX(host) != expected {
+			t.Errorf("MatchMX(%s) != %v", host, expected)
+		}
+	}
+
+	for _, invalid := range []string{
+		"version: STSv2\nmode: enforce\nmx: a\nmax_age: 1\n",
+		"version: STSv1\nmode: strict\nmx: a\nmax_age: 1\n",
+		"version: STSv1\nmode: enforce\nmx: a\n",
+		"version: STSv1\nmode: enforce\nmax_age: 1\n",
+		"version: STSv1\nmode: enforce\nmx: a\nmax_age: 99999999999\n",
+	} {
+		if _, err := ParsePolicy(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+	if _, err := ParsePolicy(strings.NewReader("version: STSv1\nmode: none\nmax_age: 86400\n")); err != nil {
+		t.Errorf("mode none without mx: %v", err)
+	}
+}
+
+func TestParseSTSRecord(t *testing.T) {
+	if id, err := parseSTSRecord("v=STSv1; id=20240101T000000;"); err != nil || id != "20240101T000000" {
+		t.Errorf("got %q, %v", id, err)
+	}
+	if _, err := parseSTSRecord("v=STSv1;"); err == nil {
+		t.Error("expected an error without id")
+	}
+	if _, err := parseSTSRecord("v=spf1 -all"); err == nil {
+		t.Error("expected an error for another record")
+	}
+}
@@ -0,0 +1,172 @@
+package mailpolicy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// maxPolicySize bounds the policy file read.
+const maxPolicySize = 64 * 1024
+
+// MTASTSPolicy is an MTA-STS policy (RFC 8461, section 3.2).
+type MTASTSPolicy struct {
+	Version string   `json:"version"`
+	Mode    string   `json:"mode"`
+	MX      []string `json:"mx,omitempty"`
+	MaxAge  int64    `json:"max_age"`
+}
+
+// MTASTSResult holds the MTA-STS record and policy of a mail domain.
+type MTASTSResult struct {
+	Domain string `json:"domain"`
+
+	// TXT is the _mta-sts TXT record, and ID its policy id.
+	TXT string `json:"txt,omitempty"`
+	ID  string `json:"id,omitempty"`
+
+	// Policy is the policy fetched from the policy host, if it is valid.
+	Policy *MTASTSPolicy `json:"policy,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// PolicyURL returns the URL of the policy of a domain.
+func PolicyURL(domain string) string {
+	return "https://mta-sts." + domain + "/.well-known/mta-sts.txt"
+}
+
+// parseSTSRecord returns the id of an MTA-STS TXT record.
+func parseSTSRecord(txt string) (string, error) {
+	fields := strings.Split(txt, ";")
+	if strings.TrimSpace(fields[0]) != "v=STSv1" {
+		return "", errors.New("MTA-STS record does not start with v=STSv1")
+	}
+	for _, field := range fields[1:] {
+		field = strings.TrimSpace(field)
+		if strings.HasPrefix(field, "id=") && len(field) > 3 {
+			return field[3:], nil
+		}
+	}
+	return "", errors.New("MTA-STS record has no id")
+}
+
+// ParsePolicy parses a policy file, checking that it is valid.
+func ParsePolicy(r io.Reader) (*MTASTSPolicy, error) {
+	policy := new(MTASTSPolicy)
+	maxAge := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:colon]), strings.TrimSpace(line[colon+1:])
+		switch key {
+		case "version":
+			policy.Version = value
+		case "mode":
+			policy.Mode = value
+		case "mx":
+			policy.MX = append(policy.MX, value)
+		case "max_age":
+			age, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || age < 0 || age > 31557600 {
+				return nil, fmt.Errorf("invalid max_age %q", value)
+			}
+			policy.MaxAge, maxAge = age, true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	switch {
+	case policy.Version != "STSv1":
+		return nil, fmt.Errorf("invalid version %q", policy.Version)
+	case policy.Mode != "enforce" && policy.Mode != "testing" && policy.Mode != "none":
+		return nil, fmt.Errorf("invalid mode %q", policy.Mode)
+	case !maxAge:
+		return nil, errors.New("missing max_age")
+	case policy.Mode != "none" && len(policy.MX) == 0:
+		return nil, errors.New("no mx patterns")
+	}
+	return policy, nil
+}
+
+// MatchMX returns true if host matches one of the mx patterns of the
+// policy. A pattern "*.example.com" matches a single label.
+func (policy *MTASTSPolicy) MatchMX(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range policy.MX {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") {
+			if dot := strings.Index(host, "."); dot > 0 && host[dot:] == pattern[1:] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FetchMTASTS looks up the MTA-STS record of a domain and fetches its
+// policy. Redirects are not followed, as required by RFC 8461.
+func FetchMTASTS(domain string, timeout time.Duration) *MTASTSResult {
+	result := &MTASTSResult{Domain: domain}
+	response, err := zgrab2.LookupDNS("_mta-sts."+domain, zgrab2.DNSTypeTXT, timeout)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	var records []string
+	for _, answer := range response.Answers {
+		if txt := answer.TXT(); strings.HasPrefix(txt, "v=STSv1") {
+			records = append(records, txt)
+		}
+	}
+	switch len(records) {
+	case 0:
+		result.Error = "no MTA-STS record"
+		return result
+	case 1:
+		result.TXT = records[0]
+	default:
+		result.Error = "several MTA-STS records"
+		return result
+	}
+	if result.ID, err = parseSTSRecord(result.TXT); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(PolicyURL(domain))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("policy fetch returned %s", resp.Status)
+		return result
+	}
+	if result.Policy, err = ParsePolicy(io.LimitReader(resp.Body, maxPolicySize)); err != nil {
+		result.Error = "invalid policy: " + err.Error()
+	}
+	return result
+}
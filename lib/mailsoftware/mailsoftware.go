@@ -0,0 +1,201 @@
+// Package mailsoftware identifies mail server software (Exim, Postfix,
+// Microsoft Exchange, Dovecot) from SMTP, POP3 and IMAP banners and maps the
+// version or build to its release date and end of life status, using an
+// embedded table that can be replaced with LoadTable.
+package mailsoftware
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Software is the server software identified from a banner.
+type Software struct {
+	// Product is one of exim, postfix, exchange or dovecot.
+	Product string `json:"product"`
+
+	// Version is the version or build from the banner, if present.
+	Version string `json:"version,omitempty"`
+
+	// Release is the name of the release Version belongs to, e.g.
+	// "Exchange Server 2019 CU14".
+	Release string `json:"release,omitempty"`
+
+	// ReleaseDate is the release date of Release (YYYY-MM-DD).
+	ReleaseDate string `json:"release_date,omitempty"`
+
+	// EOLDate is the vendor's end of support date for Release, if one is
+	// announced.
+	EOLDate string `json:"eol_date,omitempty"`
+
+	// EOL is true if EOLDate has passed.
+	EOL bool `json:"eol"`
+}
+
+// release is a row of the release table.
+type release struct {
+	version  []int
+	name     string
+	released string
+	eol      string
+}
+
+// table holds the releases of each product, sorted by version.
+var table map[string][]release
+
+func init() {
+	var err error
+	if table, err = parseTable(strings.NewReader(defaultTable)); err != nil {
+		panic(err)
+	}
+}
+
+// LoadTable replaces the release table with a CSV file of product,version,
+// release,released,eol rows (see the built-in table for an example).
+func LoadTable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	t, err := parseTable(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	table = t
+	return nil
+}
+
+func parseTable(r io.Reader) (map[string][]release, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 5
+	reader.TrimLeadingSpace = true
+	ret := make(map[string][]release)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		version := parseVersion(record[1])
+		if version == nil {
+			return nil, fmt.Errorf("invalid version %q", record[1])
+		}
+		for _, date := range record[3:] {
+			if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+				return nil, fmt.Errorf("invalid date %q", date)
+			}
+		}
+		product := strings.ToLower(record[0])
+		ret[product] = append(ret[product], release{version, record[2], record[3], record[4]})
+	}
+	for _, releases := range ret {
+		sort.Slice(releases, func(i, j int) bool {
+			return compareVersions(releases[i].version, releases[j].version) < 0
+		})
+	}
+	return ret, nil
+}
+
+// parseVersion returns the numeric components of a dotted version, or nil.
+func parseVersion(s string) []int {
+	var ret []int
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil
+		}
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+// compareVersions compares versions component by component; missing
+// components count as zero.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// banners matches products in banners; the first group, if matched, is the
+// version.
+var banners = []struct {
+	product string
+	regex   *regexp.Regexp
+}{
+	{"exim", regexp.MustCompile(`(?i)\bExim(?: (\d+(?:\.\d+)+))?\b`)},
+	{"postfix", regexp.MustCompile(`(?i)\bPostfix(?: (\d+(?:\.\d+)+))?\b`)},
+	// Exchange 2003 and older include the build in POP3 and IMAP banners;
+	// later versions only name the product. "Microsoft ESMTP MAIL Service,
+	// Version: ..." is the IIS SMTP service and is not matched.
+	{"exchange", regexp.MustCompile(`(?i)\bMicrosoft Exchange\b(?:.*?\bversion:? (\d+\.\d+\.\d+(?:\.\d+)?))?`)},
+	{"exchange", regexp.MustCompile(`(?i)\bMicrosoft ESMTP MAIL Service ready\b()`)},
+	{"dovecot", regexp.MustCompile(`(?i)\bDovecot(?: v?(\d+(?:\.\d+)+))?\b`)},
+}
+
+// Identify returns the software named in the given banners (e.g. an SMTP
+// greeting and EHLO response), or nil.
+func Identify(texts ...string) *Software {
+	return identify(time.Now(), texts...)
+}
+
+func identify(now time.Time, texts ...string) *Software {
+	for _, text := range texts {
+		for _, b := range banners {
+			match := b.regex.FindStringSubmatch(text)
+			if match == nil {
+				continue
+			}
+			ret := &Software{Product: b.product, Version: match[1]}
+			ret.lookup(now)
+			return ret
+		}
+	}
+	return nil
+}
+
+// lookup fills in the release of the closest table row at or below Version.
+func (software *Software) lookup(now time.Time) {
+	version := parseVersion(software.Version)
+	if version == nil {
+		return
+	}
+	releases := table[software.Product]
+	i := sort.Search(len(releases), func(i int) bool {
+		return compareVersions(releases[i].version, version) > 0
+	})
+	if i == 0 {
+		return
+	}
+	r := releases[i-1]
+	software.Release = r.name
+	software.ReleaseDate = r.released
+	software.EOLDate = r.eol
+	if eol, err := time.Parse("2006-01-02", r.eol); err == nil {
+		software.EOL = !now.Before(eol)
+	}
+}
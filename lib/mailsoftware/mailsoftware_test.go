@@ -0,0 +1,72 @@
+package mailsoftware
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIdentify(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		banner   string
+		expected Software
+	}{
+		{"220 mx.example.com ESMTP Exim 4.96.2 Wed, 01 Jan 2025 00:00:00 +0000",
+			Software{"exim", "4.96.2", "Exim 4.96", "2022-06-25", "2023-11-04", true}},
+		{"220 mx.example.com ESMTP Exim 4.98 Wed, 01 Jan 2025 00:00:00 +0000",
+			Software{"exim", "4.98", "Exim 4.98", "2024-07-10", "", false}},
+		{"220 mx.example.com ESMTP Postfix (Ubuntu)",
+			Software{Product: "postfix"}},
+		{"220 mx.example.com ESMTP Postfix 3.10.1",
+			Software{"postfix", "3.10.1", "Postfix 3.10", "2025-02-17", "", false}},
+		{"* OK Microsoft Exchange Server 2003 IMAP4rev1 server version 6.5.7638.1 (mail.example.com) ready.",
+			Software{"exchange", "6.5.7638.1", "Exchange Server 2003 SP2", "2005-10-19", "2014-04-08", true}},
+		{"220 mail.example.com Microsoft ESMTP MAIL Service ready at Wed, 1 Jan 2025 00:00:00 +0000",
+			Software{Product: "exchange"}},
+		{"+OK Dovecot (Debian) ready.",
+			Software{Product: "dovecot"}},
+	}
+	for _, test := range tests {
+		got := identify(now, test.banner)
+		if got == nil || *got != test.expected {
+			t.Errorf("%q: got %+v, expected %+v", test.banner, got, test.expected)
+		}
+	}
+	for _, banner := range []string{
+		"220 mail.example.com Microsoft ESMTP MAIL Service, Version: 6.0.3790.4675 ready",
+		"+OK POP3 server ready",
+	} {
+		if got := identify(now, banner); got != nil {
+			t.Errorf("%q: got %+v, expected nothing", banner, got)
+		}
+	}
+}
+
+func TestLoadTable(t *testing.T) {
+	defer func(saved map[string][]release) { table = saved }(table)
+	dir, err := ioutil.TempDir("", "mailsoftware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "table.csv")
+	if err := ioutil.WriteFile(path, []byte("# custom\nexim,4.99,Exim 4.99,2025-06-01,\nexim,4.98,Exim 4.98,2024-07-10,2025-06-01\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadTable(path); err != nil {
+		t.Fatal(err)
+	}
+	got := identify(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), "220 ESMTP Exim 4.98.1")
+	if got == nil || got.Release != "Exim 4.98" || !got.EOL {
+		t.Errorf("got %+v", got)
+	}
+	if err := ioutil.WriteFile(path, []byte("exim,4.x,Exim 4,2025-06-01,\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadTable(path); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
@@ -0,0 +1,54 @@
+package mailsoftware
+
+// defaultTable is the built-in release table. Each row is the first version
+// of a release (a banner version maps to the closest row at or below it),
+// its name, its release date and the vendor's end of support date (empty if
+// none is announced). Use LoadTable to replace it with a newer copy.
+//
+// Exim supports only its latest release, so each release reaches end of
+// life when the next one is published; Postfix supports the four most
+// recent stable branches.
+const defaultTable = `# product,version,release,released,eol
+exim,4.87,Exim 4.87,2016-04-06,2016-12-25
+exim,4.88,Exim 4.88,2016-12-25,2017-03-09
+exim,4.89,Exim 4.89,2017-03-09,2018-02-10
+exim,4.90,Exim 4.90,2018-02-10,2018-04-16
+exim,4.91,Exim 4.91,2018-04-16,2019-02-10
+exim,4.92,Exim 4.92,2019-02-10,2019-12-08
+exim,4.93,Exim 4.93,2019-12-08,2020-06-01
+exim,4.94,Exim 4.94,2020-06-01,2021-09-28
+exim,4.95,Exim 4.95,2021-09-28,2022-06-25
+exim,4.96,Exim 4.96,2022-06-25,2023-11-04
+exim,4.97,Exim 4.97,2023-11-04,2024-07-10
+exim,4.98,Exim 4.98,2024-07-10,
+postfix,2.11,Postfix 2.11,2014-01-15,2018-02-22
+postfix,3.0,Postfix 3.0,2015-02-08,2019-02-27
+postfix,3.1,Postfix 3.1,2016-02-24,2020-03-15
+postfix,3.2,Postfix 3.2,2017-02-28,2021-04-25
+postfix,3.3,Postfix 3.3,2018-02-22,2022-02-06
+postfix,3.4,Postfix 3.4,2019-02-27,2023-04-17
+postfix,3.5,Postfix 3.5,2020-03-15,2024-03-06
+postfix,3.6,Postfix 3.6,2021-04-25,2025-02-17
+postfix,3.7,Postfix 3.7,2022-02-06,
+postfix,3.8,Postfix 3.8,2023-04-17,
+postfix,3.9,Postfix 3.9,2024-03-06,
+postfix,3.10,Postfix 3.10,2025-02-17,
+dovecot,2.2,Dovecot 2.2,2013-02-25,
+dovecot,2.3,Dovecot 2.3,2017-12-22,
+exchange,6.5.6944,Exchange Server 2003,2003-10-28,2014-04-08
+exchange,6.5.7638,Exchange Server 2003 SP2,2005-10-19,2014-04-08
+exchange,8.0.685,Exchange Server 2007,2006-12-08,2017-04-11
+exchange,8.3.83,Exchange Server 2007 SP3,2010-06-19,2017-04-11
+exchange,14.0.639,Exchange Server 2010,2009-11-09,2020-10-13
+exchange,14.3.123,Exchange Server 2010 SP3,2013-02-12,2020-10-13
+exchange,15.0.516,Exchange Server 2013,2012-12-03,2023-04-11
+exchange,15.0.1497,Exchange Server 2013 CU23,2019-06-18,2023-04-11
+exchange,15.1.225,Exchange Server 2016,2015-10-01,2025-10-14
+exchange,15.1.2507,Exchange Server 2016 CU23,2022-04-20,2025-10-14
+exchange,15.2.221,Exchange Server 2019,2018-10-22,2025-10-14
+exchange,15.2.1118,Exchange Server 2019 CU12,2022-04-20,2025-10-14
+exchange,15.2.1258,Exchange Server 2019 CU13,2023-05-03,2025-10-14
+exchange,15.2.1544,Exchange Server 2019 CU14,2024-02-13,2025-10-14
+exchange,15.2.1748,Exchange Server 2019 CU15,2025-02-10,2025-10-14
+exchange,15.2.2562,Exchange Server Subscription Edition,2025-07-01,
+`
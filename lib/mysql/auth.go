@@ -0,0 +1,292 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// Authentication plugins known to Authenticate.
+const (
+	NativePasswordPlugin      = "mysql_native_password"
+	CachingSHA2PasswordPlugin = "caching_sha2_password"
+	SHA256PasswordPlugin      = "sha256_password"
+	ClearPasswordPlugin       = "mysql_clear_password"
+)
+
+// Headers of the packets the server sends during authentication.
+const (
+	authOKHeader       = 0x00
+	authMoreDataHeader = 0x01
+	authSwitchHeader   = 0xfe
+	authErrorHeader    = 0xff
+)
+
+// Status bytes of the caching_sha2_password AuthMoreData packet.
+const (
+	cachingSHA2FastAuthSuccess = 0x03
+	cachingSHA2FullAuth        = 0x04
+)
+
+// maxAuthRounds bounds the number of packets read while authenticating.
+const maxAuthRounds = 8
+
+// defaultAuthCapabilities are the client capabilities sent in the
+// HandshakeResponse41 packet.
+const defaultAuthCapabilities = CLIENT_LONG_PASSWORD | CLIENT_PROTOCOL_41 | CLIENT_SECURE_CONNECTION | CLIENT_TRANSACTIONS | CLIENT_PLUGIN_AUTH
+
+// HandshakeResponsePacket is the client's response to the HandshakePacket,
+// which logs in.
+// It is defined at https://web.archive.org/web/20160316105725/https://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::HandshakeResponse41
+type HandshakeResponsePacket struct {
+	CapabilityFlags uint32 `json:"capability_flags"`
+	MaxPacketSize   uint32 `zgrab:"debug" json:"max_packet_size"`
+	CharacterSet    byte   `zgrab:"debug" json:"character_set"`
+	Username        string `json:"username"`
+
+	// AuthResponse is the scrambled password; it is never logged.
+	AuthResponse []byte `json:"-"`
+
+	AuthPluginName string `json:"auth_plugin_name,omitempty"`
+}
+
+// EncodeBody encodes the HandshakeResponsePacket for transport to the
+// server.
+func (p *HandshakeResponsePacket) EncodeBody() []byte {
+	var buf bytes.Buffer
+	var header [32]byte
+	binary.LittleEndian.PutUint32(header[0:], p.CapabilityFlags)
+	binary.LittleEndian.PutUint32(header[4:], p.MaxPacketSize)
+	header[8] = p.CharacterSet
+	buf.Write(header[:])
+	buf.WriteString(p.Username)
+	buf.WriteByte(0)
+	buf.WriteByte(byte(len(p.AuthResponse)))
+	buf.Write(p.AuthResponse)
+	if p.CapabilityFlags&CLIENT_PLUGIN_AUTH != 0 {
+		buf.WriteString(p.AuthPluginName)
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// authDataPacket is a raw authentication packet sent after the
+// HandshakeResponsePacket, e.g. in reply to an AuthSwitchRequest.
+type authDataPacket []byte
+
+// EncodeBody returns the packet unchanged.
+func (p authDataPacket) EncodeBody() []byte {
+	return p
+}
+
+// AuthResult is the outcome of an authentication attempt.
+type AuthResult struct {
+	// Username is the user that tried to log in.
+	Username string `json:"username"`
+
+	// Plugin is the authentication plugin the client used first.
+	Plugin string `json:"plugin,omitempty"`
+
+	// SwitchedPlugin is the plugin the server asked to switch to with an
+	// AuthSwitchRequest, if any.
+	SwitchedPlugin string `json:"switched_plugin,omitempty"`
+
+	// Secure is true if the attempt was made over TLS.
+	Secure bool `json:"secure"`
+
+	// Success is true if the server accepted the credential.
+	Success bool `json:"success"`
+
+	// FullAuthRequired is true if caching_sha2_password asked for the
+	// cleartext password, which is only sent over TLS.
+	FullAuthRequired bool `json:"full_auth_required,omitempty"`
+
+	// Error is the error the server returned, if any.
+	Error *ERRPacket `json:"error,omitempty"`
+
+	// Unsupported is set if the server asked for a plugin or step the
+	// client does not implement.
+	Unsupported string `json:"unsupported,omitempty"`
+}
+
+// scramblePassword computes the response of the given plugin for the
+// password and the server's nonce.
+func scramblePassword(plugin string, password string, nonce []byte, secure bool) ([]byte, bool) {
+	switch plugin {
+	case NativePasswordPlugin:
+		if password == "" {
+			return nil, true
+		}
+		// SHA1(password) XOR SHA1(nonce + SHA1(SHA1(password)))
+		stage1 := sha1.Sum([]byte(password))
+		stage2 := sha1.Sum(stage1[:])
+		h := sha1.New()
+		h.Write(nonce)
+		h.Write(stage2[:])
+		return xorBytes(stage1[:], h.Sum(nil)), true
+	case CachingSHA2PasswordPlugin:
+		if password == "" {
+			return nil, true
+		}
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + nonce)
+		stage1 := sha256.Sum256([]byte(password))
+		stage2 := sha256.Sum256(stage1[:])
+		h := sha256.New()
+		h.Write(stage2[:])
+		h.Write(nonce)
+		return xorBytes(stage1[:], h.Sum(nil)), true
+	case SHA256PasswordPlugin, ClearPasswordPlugin:
+		if password == "" {
+			return []byte{0}, true
+		}
+		// Without TLS, sha256_password needs the server's RSA key.
+		if !secure {
+			return nil, false
+		}
+		return append([]byte(password), 0), true
+	}
+	return nil, false
+}
+
+// xorBytes returns a XOR b; they must have the same length.
+func xorBytes(a, b []byte) []byte {
+	ret := make([]byte, len(a))
+	for i := range a {
+		ret[i] = a[i] ^ b[i]
+	}
+	return ret
+}
+
+// authNonce returns the 20-byte nonce of the HandshakePacket.
+func (p *HandshakePacket) authNonce() []byte {
+	nonce := append(append([]byte(nil), p.AuthPluginData1...), p.AuthPluginData2...)
+	return bytes.TrimRight(nonce, "\x00")
+}
+
+// IsSecure returns true if the connection has been upgraded to TLS.
+func (c *Connection) IsSecure() bool {
+	_, ok := c.Connection.(*zgrab2.TLSConnection)
+	return ok
+}
+
+// readAuthPacket reads a packet of the authentication phase, which is not
+// decoded since AuthSwitchRequest and AuthMoreData share their headers with
+// other packets. The connection is read unbuffered, since the server may
+// send AuthMoreData and OK back to back.
+func (c *Connection) readAuthPacket() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.Connection, header[:]); err != nil {
+		return nil, fmt.Errorf("error reading packet header: %s", err)
+	}
+	seq := header[3]
+	header[3] = 0
+	packetSize := binary.LittleEndian.Uint32(header[:])
+	if packetSize == 0 || packetSize > 0x00010000 {
+		return nil, fmt.Errorf("unexpected authentication packet size 0x%x", packetSize)
+	}
+	body := make([]byte, packetSize)
+	if n, err := io.ReadFull(c.Connection, body); err != nil {
+		return nil, fmt.Errorf("error reading %d bytes (partial body=%s): %s", packetSize, trunc(body, n), err)
+	}
+	c.SequenceNumber = seq + 1
+	return body, nil
+}
+
+// Authenticate logs in as user with the given password, using the plugin
+// announced by the server, and follows AuthSwitchRequests. It must be
+// called after Connect, and after the TLS handshake if NegotiateTLS was
+// called. The returned error is only set if the exchange failed; a refused
+// credential is reported in the AuthResult.
+func (c *Connection) Authenticate(user string, password string) (*AuthResult, error) {
+	handshake := c.GetHandshake()
+	if handshake == nil {
+		return nil, fmt.Errorf("no handshake packet")
+	}
+	secure := c.IsSecure()
+	ret := &AuthResult{Username: user, Plugin: handshake.AuthPluginName, Secure: secure}
+	if ret.Plugin == "" {
+		ret.Plugin = NativePasswordPlugin
+	}
+	plugin := ret.Plugin
+	response, ok := scramblePassword(plugin, password, handshake.authNonce(), secure)
+	if !ok {
+		// Try the native plugin, the server will ask to switch if needed.
+		response, _ = scramblePassword(NativePasswordPlugin, password, handshake.authNonce(), secure)
+		plugin = NativePasswordPlugin
+	}
+	capabilities := defaultAuthCapabilities & handshake.CapabilityFlags
+	if secure {
+		capabilities |= CLIENT_SSL
+	}
+	if _, err := c.sendPacket(&HandshakeResponsePacket{
+		CapabilityFlags: capabilities | CLIENT_PROTOCOL_41,
+		MaxPacketSize:   c.Config.MaxPacketSize,
+		CharacterSet:    c.Config.CharSet,
+		Username:        user,
+		AuthResponse:    response,
+		AuthPluginName:  plugin,
+	}); err != nil {
+		return ret, fmt.Errorf("error sending HandshakeResponse packet: %s", err)
+	}
+	for i := 0; i < maxAuthRounds; i++ {
+		body, err := c.readAuthPacket()
+		if err != nil {
+			return ret, err
+		}
+		switch body[0] {
+		case authOKHeader:
+			ret.Success = true
+			return ret, nil
+		case authErrorHeader:
+			if ret.Error, err = c.readERRPacket(body); err != nil {
+				return ret, err
+			}
+			return ret, nil
+		case authSwitchHeader:
+			if len(body) == 1 {
+				// Old servers ask for the pre-4.1 password hash.
+				ret.Unsupported = "mysql_old_password"
+				return ret, nil
+			}
+			var nonce []byte
+			plugin, nonce = readNulString(body[1:])
+			ret.SwitchedPlugin = plugin
+			if response, ok = scramblePassword(plugin, password, bytes.TrimRight(nonce, "\x00"), secure); !ok {
+				ret.Unsupported = plugin
+				return ret, nil
+			}
+			if _, err := c.sendPacket(authDataPacket(response)); err != nil {
+				return ret, err
+			}
+		case authMoreDataHeader:
+			if plugin != CachingSHA2PasswordPlugin || len(body) != 2 {
+				ret.Unsupported = fmt.Sprintf("%s: more data %s", plugin, base64.StdEncoding.EncodeToString(body[1:]))
+				return ret, nil
+			}
+			if body[1] == cachingSHA2FastAuthSuccess {
+				// The OK packet follows.
+				continue
+			}
+			if body[1] != cachingSHA2FullAuth {
+				ret.Unsupported = fmt.Sprintf("%s: status 0x%02x", plugin, body[1])
+				return ret, nil
+			}
+			ret.FullAuthRequired = true
+			if !secure {
+				return ret, nil
+			}
+			if _, err := c.sendPacket(authDataPacket(append([]byte(password), 0))); err != nil {
+				return ret, err
+			}
+		default:
+			return ret, fmt.Errorf("unexpected authentication packet 0x%02x", body[0])
+		}
+	}
+	return ret, fmt.Errorf("too many authentication packets")
+}
@@ -0,0 +1,803 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+)
+
+// Config configures a client connection.
+type Config struct {
+	// ServerName is sent in the SNI extension; empty omits it.
+	ServerName string
+
+	// NextProtos are offered in the ALPN extension, which QUIC requires.
+	NextProtos []string
+
+	// Timeout bounds the handshake. Zero means no limit beyond the
+	// underlying connection's own timeouts.
+	Timeout time.Duration
+}
+
+// HandshakeLog records what the server sent during the handshake.
+type HandshakeLog struct {
+	// Retry is true if the server sent a Retry packet (address validation).
+	Retry bool `json:"retry"`
+
+	// CipherSuite is the TLS 1.3 cipher suite from the ServerHello.
+	CipherSuite uint16 `json:"cipher_suite,omitempty"`
+
+	// ALPN is the application protocol the server selected.
+	ALPN string `json:"alpn,omitempty"`
+
+	// TransportParameters are the server's transport parameters, from
+	// EncryptedExtensions.
+	TransportParameters TransportParameters `json:"transport_parameters,omitempty"`
+
+	// Certificates are the DER certificates from the server's Certificate
+	// message, leaf first. They are not verified.
+	Certificates [][]byte `json:"-"`
+
+	// HandshakeComplete is true once the server's Finished was verified and
+	// the client's Finished sent.
+	HandshakeComplete bool `json:"handshake_complete"`
+
+	// HandshakeConfirmed is true if the server sent HANDSHAKE_DONE.
+	HandshakeConfirmed bool `json:"handshake_confirmed,omitempty"`
+}
+
+// VersionNegotiationError is returned when the server answers with a Version
+// Negotiation packet.
+type VersionNegotiationError struct {
+	Versions []uint32
+}
+
+// Error implements the error interface.
+func (e *VersionNegotiationError) Error() string {
+	names := make([]string, len(e.Versions))
+	for i, v := range e.Versions {
+		names[i] = VersionName(v)
+	}
+	return "quic: server does not support version 1 (supported: " + strings.Join(names, ", ") + ")"
+}
+
+// Encryption levels, which are also the packet number spaces.
+const (
+	levelInitial = iota
+	levelHandshake
+	levelApplication
+	numLevels
+)
+
+const (
+	// retransmitInterval is how long to wait for the server's first packet
+	// before sending the Initial again.
+	retransmitInterval = time.Second
+
+	// maxBufferedPackets bounds the packets kept while their keys are not
+	// yet available.
+	maxBufferedPackets = 16
+
+	// maxStreamChunk is the most stream data sent in a single packet.
+	maxStreamChunk = 1000
+
+	handshakeTypeCertificateRequest = 13
+)
+
+var errRetransmit = errors.New("quic: retransmission timer expired")
+
+// pnSpace is the state of one packet number space.
+type pnSpace struct {
+	seal, open *Keys
+	nextPN     uint64
+	largest    int64
+	received   map[uint64]bool
+	ackPending bool
+
+	// crypto reassembles the CRYPTO data of the level.
+	crypto *recvStream
+}
+
+// appendAck appends an ACK frame for the contiguous run of packets up to the
+// largest received.
+func (s *pnSpace) appendAck(b []byte) []byte {
+	smallest := uint64(s.largest)
+	for smallest > 0 && s.received[smallest-1] {
+		smallest--
+	}
+	b = AppendVarint(b, frameTypeAck)
+	b = AppendVarint(b, uint64(s.largest))
+	b = AppendVarint(b, 0) // ACK delay
+	b = AppendVarint(b, 0) // no further ranges
+	return AppendVarint(b, uint64(s.largest)-smallest)
+}
+
+// recvStream reassembles the data received on a stream.
+type recvStream struct {
+	data      []byte
+	pending   map[uint64][]byte
+	finalSize int64
+
+	// read is how much of data was consumed (for CRYPTO streams).
+	read int
+}
+
+func newRecvStream() *recvStream {
+	return &recvStream{finalSize: -1}
+}
+
+func (s *recvStream) add(offset uint64, data []byte, fin bool) {
+	end := offset + uint64(len(data))
+	if fin {
+		s.finalSize = int64(end)
+	}
+	if end <= uint64(len(s.data)) {
+		return
+	}
+	if offset > uint64(len(s.data)) {
+		if s.pending == nil {
+			s.pending = make(map[uint64][]byte)
+		}
+		s.pending[offset] = append([]byte(nil), data...)
+		return
+	}
+	s.data = append(s.data, data[uint64(len(s.data))-offset:]...)
+	for progressed := true; progressed; {
+		progressed = false
+		for offset, chunk := range s.pending {
+			if offset > uint64(len(s.data)) {
+				continue
+			}
+			if end := offset + uint64(len(chunk)); end > uint64(len(s.data)) {
+				s.data = append(s.data, chunk[uint64(len(s.data))-offset:]...)
+			}
+			delete(s.pending, offset)
+			progressed = true
+		}
+	}
+}
+
+func (s *recvStream) complete() bool {
+	return s.finalSize >= 0 && int64(len(s.data)) == s.finalSize
+}
+
+// Conn is a client QUIC connection over a connected UDP socket.
+type Conn struct {
+	conn   net.Conn
+	config *Config
+	log    HandshakeLog
+
+	scid, dcid, originalDCID []byte
+	token                    []byte
+	gotServerPacket          bool
+	spaces                   [numLevels]pnSpace
+	buffered                 [][]byte
+
+	ks                    *rawtls.KeySchedule
+	private               []byte
+	clientHello           []byte
+	clientHandshakeSecret []byte
+	serverHandshakeSecret []byte
+	certificateRequest    []byte
+	handshakeComplete     bool
+
+	streams     map[uint64]*recvStream
+	sendOffsets map[uint64]uint64
+	closeErr    *CloseError
+	deadline    time.Time
+	buf         []byte
+}
+
+func randomBytes(n int) []byte {
+	ret := make([]byte, n)
+	if _, err := rand.Read(ret); err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// Client returns a client connection over conn, which must be a connected
+// UDP socket. The handshake is done by Handshake.
+func Client(conn net.Conn, config *Config) *Conn {
+	c := &Conn{
+		conn:        conn,
+		config:      config,
+		scid:        randomBytes(8),
+		dcid:        randomBytes(8),
+		streams:     make(map[uint64]*recvStream),
+		sendOffsets: make(map[uint64]uint64),
+		buf:         make([]byte, 65536),
+	}
+	c.originalDCID = c.dcid
+	for i := range c.spaces {
+		c.spaces[i].largest = -1
+		c.spaces[i].received = make(map[uint64]bool)
+		c.spaces[i].crypto = newRecvStream()
+	}
+	c.setInitialKeys()
+	return c
+}
+
+func (c *Conn) setInitialKeys() {
+	client, server := InitialSecrets(c.dcid)
+	c.spaces[levelInitial].seal = NewKeys(client)
+	c.spaces[levelInitial].open = NewKeys(server)
+}
+
+// Log returns the handshake log.
+func (c *Conn) Log() *HandshakeLog {
+	return &c.log
+}
+
+// SetDeadline sets the time after which reads fail; it replaces the
+// handshake timeout from the Config.
+func (c *Conn) SetDeadline(t time.Time) {
+	c.deadline = t
+}
+
+// Handshake performs the QUIC handshake. It returns a *VersionNegotiationError
+// if the server does not support version 1, and a *CloseError if the server
+// closes the connection.
+func (c *Conn) Handshake() error {
+	if c.deadline.IsZero() && c.config.Timeout > 0 {
+		c.deadline = time.Now().Add(c.config.Timeout)
+	}
+	private, share := rawtls.GenerateX25519()
+	c.private = private
+	c.clientHello = c.newClientHello(share).Marshal()
+	if err := c.sendClientHello(); err != nil {
+		return err
+	}
+	lastSent := time.Now()
+	for !c.handshakeComplete {
+		var retransmit time.Time
+		if !c.gotServerPacket {
+			retransmit = lastSent.Add(retransmitInterval)
+		}
+		datagram, err := c.read(retransmit)
+		if err == errRetransmit {
+			if err := c.sendClientHello(); err != nil {
+				return err
+			}
+			lastSent = time.Now()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.processDatagram(datagram); err != nil {
+			return err
+		}
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) newClientHello(share rawtls.KeyShare) *rawtls.ClientHello {
+	ch := &rawtls.ClientHello{
+		Version:      rawtls.VersionTLS12,
+		SessionID:    []byte{},
+		CipherSuites: []uint16{rawtls.CipherSuiteAES128GCMSHA256},
+	}
+	if c.config.ServerName != "" {
+		ch.Add(rawtls.ServerNameExtension(c.config.ServerName))
+	}
+	ch.Add(rawtls.SupportedGroupsExtension([]uint16{rawtls.GroupX25519}))
+	ch.Add(rawtls.SignatureAlgorithmsExtension(rawtls.DefaultSignatureAlgorithms))
+	ch.Add(rawtls.KeyShareExtension([]rawtls.KeyShare{share}))
+	ch.Add(rawtls.SupportedVersionsExtension([]uint16{rawtls.VersionTLS13}))
+	if len(c.config.NextProtos) > 0 {
+		ch.Add(rawtls.ALPNExtension(c.config.NextProtos))
+	}
+	ch.Add(rawtls.Extension{Type: extensionQUICTransportParameters, Data: c.transportParameters()})
+	return ch
+}
+
+// transportParameters are the client's transport parameters: enough flow
+// control credit for a response, and a few unidirectional streams for the
+// peer's control streams.
+func (c *Conn) transportParameters() []byte {
+	var b []byte
+	b = appendBytesParameter(b, paramInitialSourceConnectionID, c.scid)
+	b = appendIntegerParameter(b, paramMaxIdleTimeout, 30000)
+	b = appendIntegerParameter(b, paramInitialMaxData, 1<<20)
+	b = appendIntegerParameter(b, paramInitialMaxStreamDataBidiLocal, 1<<20)
+	b = appendIntegerParameter(b, paramInitialMaxStreamDataBidiRemote, 1<<20)
+	b = appendIntegerParameter(b, paramInitialMaxStreamDataUni, 1<<20)
+	b = appendIntegerParameter(b, paramInitialMaxStreamsBidi, 0)
+	return appendIntegerParameter(b, paramInitialMaxStreamsUni, 16)
+}
+
+func (c *Conn) sendClientHello() error {
+	var payloads [numLevels][]byte
+	payloads[levelInitial] = appendCryptoFrame(nil, 0, c.clientHello)
+	return c.send(payloads)
+}
+
+// read waits for the next datagram. If retransmit is set and passes first,
+// it returns errRetransmit.
+func (c *Conn) read(retransmit time.Time) ([]byte, error) {
+	deadline := c.deadline
+	if !retransmit.IsZero() && (deadline.IsZero() || retransmit.Before(deadline)) {
+		deadline = retransmit
+	} else {
+		retransmit = time.Time{}
+	}
+	if err := c.conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	n, err := c.conn.Read(c.buf)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() && !retransmit.IsZero() {
+			return nil, errRetransmit
+		}
+		return nil, err
+	}
+	return append([]byte(nil), c.buf[:n]...), nil
+}
+
+// send coalesces one packet per level with a non-empty payload (plus any
+// pending ACKs) into a datagram. Datagrams with an Initial packet are padded
+// to MinInitialDatagramSize.
+func (c *Conn) send(payloads [numLevels][]byte) error {
+	for level := range c.spaces {
+		space := &c.spaces[level]
+		if space.ackPending && space.seal != nil {
+			payloads[level] = append(space.appendAck(nil), payloads[level]...)
+			space.ackPending = false
+		}
+	}
+	var tail []byte
+	for level := levelHandshake; level < numLevels; level++ {
+		if len(payloads[level]) > 0 && c.spaces[level].seal != nil {
+			tail = append(tail, c.seal(level, payloads[level])...)
+		}
+	}
+	var datagram []byte
+	if initial := payloads[levelInitial]; len(initial) > 0 {
+		header, _ := appendLongHeader(nil, packetTypeInitial, Version1, c.dcid, c.scid, c.token, 0, 0)
+		if padding := MinInitialDatagramSize - len(header) - 16 - len(initial) - len(tail); padding > 0 {
+			initial = append(initial, make([]byte, padding)...)
+		}
+		datagram = c.seal(levelInitial, initial)
+	}
+	datagram = append(datagram, tail...)
+	if len(datagram) == 0 {
+		return nil
+	}
+	_, err := c.conn.Write(datagram)
+	return err
+}
+
+func (c *Conn) seal(level int, payload []byte) []byte {
+	space := &c.spaces[level]
+	pn := space.nextPN
+	space.nextPN++
+	var header []byte
+	var pnOffset int
+	switch level {
+	case levelInitial:
+		header, pnOffset = appendLongHeader(nil, packetTypeInitial, Version1, c.dcid, c.scid, c.token, len(payload), pn)
+	case levelHandshake:
+		header, pnOffset = appendLongHeader(nil, packetTypeHandshake, Version1, c.dcid, c.scid, nil, len(payload), pn)
+	default:
+		header, pnOffset = appendShortHeader(nil, c.dcid, pn)
+	}
+	return space.seal.Seal(header, pnOffset, pn, payload)
+}
+
+// flush sends the pending ACKs.
+func (c *Conn) flush() error {
+	return c.send([numLevels][]byte{})
+}
+
+func (c *Conn) processDatagram(datagram []byte) error {
+	for len(datagram) > 0 {
+		p, rest, err := parsePacket(datagram, len(c.scid))
+		if err != nil {
+			// Nothing after a malformed packet can be found.
+			return nil
+		}
+		datagram = rest
+		if err := c.processPacket(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) processPacket(p *packet) error {
+	if p.long && p.version == 0 {
+		if c.gotServerPacket || !bytes.Equal(p.dcid, c.scid) {
+			return nil
+		}
+		return &VersionNegotiationError{Versions: p.versions}
+	}
+	if p.long && p.version != Version1 {
+		return nil
+	}
+	level := levelApplication
+	if p.long {
+		switch p.typ {
+		case packetTypeRetry:
+			return c.processRetry(p)
+		case packetTypeInitial:
+			level = levelInitial
+		case packetTypeHandshake:
+			level = levelHandshake
+		default:
+			// 0-RTT packets are only sent by clients.
+			return nil
+		}
+	}
+	space := &c.spaces[level]
+	if space.open == nil {
+		if len(c.buffered) < maxBufferedPackets {
+			c.buffered = append(c.buffered, append([]byte(nil), p.raw...))
+		}
+		return nil
+	}
+	pn, payload, err := space.open.Open(p.raw, p.pnOffset, space.largest)
+	if err != nil {
+		// Corrupted, forged or for keys we do not have: drop it.
+		return nil
+	}
+	if level == levelInitial && !c.gotServerPacket {
+		c.dcid = append([]byte(nil), p.scid...)
+	}
+	c.gotServerPacket = true
+	if space.received[pn] {
+		return nil
+	}
+	space.received[pn] = true
+	if int64(pn) > space.largest {
+		space.largest = int64(pn)
+	}
+	frames, err := parseFrames(payload)
+	if err != nil {
+		return err
+	}
+	for i := range frames {
+		f := &frames[i]
+		if f.ackEliciting() {
+			space.ackPending = true
+		}
+		switch f.typ {
+		case frameTypeCrypto:
+			space.crypto.add(f.offset, f.data, false)
+			if err := c.processCrypto(level); err != nil {
+				return err
+			}
+		case frameTypeStream:
+			if level == levelApplication {
+				c.stream(f.streamID).add(f.offset, f.data, f.fin)
+			}
+		case frameTypeHandshakeDone:
+			c.log.HandshakeConfirmed = true
+		case frameTypeConnectionClose:
+			c.closeErr = f.close
+			return f.close
+		}
+	}
+	return nil
+}
+
+// processBuffered retries the packets that arrived before their keys.
+func (c *Conn) processBuffered() error {
+	buffered := c.buffered
+	c.buffered = nil
+	for _, datagram := range buffered {
+		if err := c.processDatagram(datagram); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	retryKey   = []byte{0xbe, 0x0c, 0x69, 0x0b, 0x9f, 0x66, 0x57, 0x5a, 0x1d, 0x76, 0x6b, 0x54, 0xe3, 0x68, 0xc8, 0x4e}
+	retryNonce = []byte{0x46, 0x15, 0x99, 0xd3, 0x5d, 0x63, 0x2b, 0xf2, 0x23, 0x98, 0x25, 0xbb}
+)
+
+// verifyRetryIntegrity checks the Retry Integrity Tag (RFC 9001, section
+// 5.8).
+func verifyRetryIntegrity(packet []byte, originalDCID []byte) bool {
+	block, err := aes.NewCipher(retryKey)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	pseudo := append([]byte{byte(len(originalDCID))}, originalDCID...)
+	pseudo = append(pseudo, packet[:len(packet)-16]...)
+	_, err = aead.Open(nil, retryNonce, packet[len(packet)-16:], pseudo)
+	return err == nil
+}
+
+func (c *Conn) processRetry(p *packet) error {
+	if c.gotServerPacket || c.log.Retry || !bytes.Equal(p.dcid, c.scid) || len(p.token) == 0 {
+		return nil
+	}
+	if !verifyRetryIntegrity(p.raw, c.originalDCID) {
+		return nil
+	}
+	c.log.Retry = true
+	c.dcid = append([]byte(nil), p.scid...)
+	c.token = append([]byte(nil), p.token...)
+	c.setInitialKeys()
+	return c.sendClientHello()
+}
+
+// processCrypto handles the complete handshake messages received at a level.
+func (c *Conn) processCrypto(level int) error {
+	s := c.spaces[level].crypto
+	for len(s.data)-s.read >= 4 {
+		header := s.data[s.read:]
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if len(header) < 4+length {
+			return nil
+		}
+		msg := header[:4+length]
+		s.read += 4 + length
+		if err := c.handleHandshakeMessage(level, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) handleHandshakeMessage(level int, msg []byte) error {
+	switch {
+	case level == levelInitial && msg[0] == rawtls.HandshakeTypeServerHello && c.ks == nil:
+		return c.handleServerHello(msg)
+	case level == levelHandshake && c.ks != nil && !c.handshakeComplete:
+		return c.handleServerHandshake(msg)
+	}
+	// NewSessionTicket and anything unexpected is ignored.
+	return nil
+}
+
+func (c *Conn) handleServerHello(msg []byte) error {
+	sh, err := rawtls.ParseServerHello(msg[4:])
+	if err != nil {
+		return err
+	}
+	if sh.HelloRetryRequest {
+		return errors.New("quic: server sent a HelloRetryRequest")
+	}
+	if sh.SelectedVersion != rawtls.VersionTLS13 {
+		return fmt.Errorf("quic: server selected TLS version 0x%04x", sh.SelectedVersion)
+	}
+	if sh.CipherSuite != rawtls.CipherSuiteAES128GCMSHA256 {
+		return fmt.Errorf("quic: server selected unsupported cipher suite 0x%04x", sh.CipherSuite)
+	}
+	c.log.CipherSuite = sh.CipherSuite
+	shared, err := rawtls.X25519SharedSecret(c.private, sh.ServerKeyShare())
+	if err != nil {
+		return err
+	}
+	c.ks = rawtls.NewKeySchedule(nil)
+	c.ks.AddMessage(c.clientHello)
+	c.ks.AddMessage(msg)
+	c.ks.Advance(shared)
+	c.clientHandshakeSecret = c.ks.DeriveSecret("c hs traffic")
+	c.serverHandshakeSecret = c.ks.DeriveSecret("s hs traffic")
+	c.spaces[levelHandshake].seal = NewKeys(c.clientHandshakeSecret)
+	c.spaces[levelHandshake].open = NewKeys(c.serverHandshakeSecret)
+	return c.processBuffered()
+}
+
+func (c *Conn) handleServerHandshake(msg []byte) error {
+	body := msg[4:]
+	switch msg[0] {
+	case rawtls.HandshakeTypeEncryptedExtensions:
+		exts, err := rawtls.ParseEncryptedExtensions(body)
+		if err != nil {
+			return err
+		}
+		for _, ext := range exts {
+			switch ext.Type {
+			case rawtls.ExtensionALPN:
+				// A list with exactly one protocol.
+				if len(ext.Data) > 3 && len(ext.Data) >= 3+int(ext.Data[2]) {
+					c.log.ALPN = string(ext.Data[3 : 3+int(ext.Data[2])])
+				}
+			case extensionQUICTransportParameters:
+				params, err := ParseTransportParameters(ext.Data)
+				if err != nil {
+					return err
+				}
+				c.log.TransportParameters = params
+			}
+		}
+	case rawtls.HandshakeTypeCertificate:
+		certificates, err := parseCertificates(body)
+		if err != nil {
+			return err
+		}
+		c.log.Certificates = certificates
+	case handshakeTypeCertificateRequest:
+		if len(body) < 1 || len(body) < 1+int(body[0]) {
+			return rawtls.ErrMalformed
+		}
+		c.certificateRequest = append([]byte{}, body[1:1+int(body[0])]...)
+	case rawtls.HandshakeTypeFinished:
+		expected := rawtls.FinishedMAC(c.serverHandshakeSecret, c.ks.TranscriptHash())
+		if !hmac.Equal(expected, body) {
+			return errors.New("quic: server Finished verification failed")
+		}
+		c.ks.AddMessage(msg)
+		return c.finishHandshake()
+	}
+	c.ks.AddMessage(msg)
+	return nil
+}
+
+// parseCertificates returns the certificate_list of a TLS 1.3 Certificate
+// message.
+func parseCertificates(body []byte) ([][]byte, error) {
+	if len(body) < 1 || len(body) < 1+int(body[0])+3 {
+		return nil, rawtls.ErrMalformed
+	}
+	body = body[1+int(body[0]):]
+	length := int(body[0])<<16 | int(body[1])<<8 | int(body[2])
+	list := body[3:]
+	if len(list) != length {
+		return nil, rawtls.ErrMalformed
+	}
+	var ret [][]byte
+	for len(list) > 0 {
+		if len(list) < 3 {
+			return nil, rawtls.ErrMalformed
+		}
+		n := int(list[0])<<16 | int(list[1])<<8 | int(list[2])
+		if len(list) < 3+n+2 {
+			return nil, rawtls.ErrMalformed
+		}
+		ret = append(ret, list[3:3+n])
+		list = list[3+n:]
+		extensions := int(list[0])<<8 | int(list[1])
+		if len(list) < 2+extensions {
+			return nil, rawtls.ErrMalformed
+		}
+		list = list[2+extensions:]
+	}
+	return ret, nil
+}
+
+// finishHandshake installs the 1-RTT keys and sends the client's Finished
+// (after an empty Certificate if the server asked for one).
+func (c *Conn) finishHandshake() error {
+	c.ks.Advance(nil)
+	clientSecret := c.ks.DeriveSecret("c ap traffic")
+	serverSecret := c.ks.DeriveSecret("s ap traffic")
+	var flight []byte
+	if c.certificateRequest != nil {
+		body := append([]byte{byte(len(c.certificateRequest))}, c.certificateRequest...)
+		certificate := rawtls.HandshakeMessage(rawtls.HandshakeTypeCertificate, append(body, 0, 0, 0))
+		c.ks.AddMessage(certificate)
+		flight = append(flight, certificate...)
+	}
+	finished := rawtls.HandshakeMessage(rawtls.HandshakeTypeFinished, rawtls.FinishedMAC(c.clientHandshakeSecret, c.ks.TranscriptHash()))
+	flight = append(flight, finished...)
+	c.spaces[levelApplication].seal = NewKeys(clientSecret)
+	c.spaces[levelApplication].open = NewKeys(serverSecret)
+	c.handshakeComplete = true
+	c.log.HandshakeComplete = true
+	var payloads [numLevels][]byte
+	payloads[levelHandshake] = appendCryptoFrame(nil, 0, flight)
+	if err := c.send(payloads); err != nil {
+		return err
+	}
+	return c.processBuffered()
+}
+
+func (c *Conn) stream(id uint64) *recvStream {
+	s, ok := c.streams[id]
+	if !ok {
+		s = newRecvStream()
+		c.streams[id] = s
+	}
+	return s
+}
+
+// SendStream sends data on a stream, ending it if fin is set.
+func (c *Conn) SendStream(id uint64, data []byte, fin bool) error {
+	if !c.handshakeComplete {
+		return errors.New("quic: handshake not complete")
+	}
+	offset := c.sendOffsets[id]
+	for {
+		chunk := data
+		if len(chunk) > maxStreamChunk {
+			chunk = chunk[:maxStreamChunk]
+		}
+		data = data[len(chunk):]
+		var payloads [numLevels][]byte
+		payloads[levelApplication] = appendStreamFrame(nil, id, offset, chunk, fin && len(data) == 0)
+		if err := c.send(payloads); err != nil {
+			return err
+		}
+		offset += uint64(len(chunk))
+		if len(data) == 0 {
+			break
+		}
+	}
+	c.sendOffsets[id] = offset
+	return nil
+}
+
+// ReadStreams processes incoming packets until done returns true. It returns
+// the read error once the deadline passes, and a *CloseError if the server
+// closes the connection.
+func (c *Conn) ReadStreams(done func() bool) error {
+	for !done() {
+		if c.closeErr != nil {
+			return c.closeErr
+		}
+		datagram, err := c.read(time.Time{})
+		if err != nil {
+			return err
+		}
+		if err := c.processDatagram(datagram); err != nil {
+			return err
+		}
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stream returns the contiguous data received so far on a stream, and
+// whether the stream is complete.
+func (c *Conn) Stream(id uint64) ([]byte, bool) {
+	s, ok := c.streams[id]
+	if !ok {
+		return nil, false
+	}
+	return s.data, s.complete()
+}
+
+// StreamIDs returns the IDs of the streams the server sent data on.
+func (c *Conn) StreamIDs() []uint64 {
+	ret := make([]uint64, 0, len(c.streams))
+	for id := range c.streams {
+		ret = append(ret, id)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// Close sends a CONNECTION_CLOSE frame: an application close with the given
+// code once the handshake is complete, otherwise a transport close without
+// error. It does not close the underlying connection.
+func (c *Conn) Close(code uint64, reason string) error {
+	if c.closeErr != nil {
+		return nil
+	}
+	var payloads [numLevels][]byte
+	if c.handshakeComplete {
+		payloads[levelApplication] = appendCloseFrame(nil, true, code, reason)
+	} else {
+		payloads[levelInitial] = appendCloseFrame(nil, false, 0, reason)
+		if c.spaces[levelHandshake].seal != nil {
+			payloads[levelHandshake] = appendCloseFrame(nil, false, 0, reason)
+		}
+	}
+	return c.send(payloads)
+}
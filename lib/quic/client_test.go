@@ -0,0 +1,318 @@
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2/lib/testutil"
+)
+
+// testServer is a single-connection QUIC server around the standard
+// library's TLS QUIC support. It answers each complete stream with
+// "echo: " and the stream data.
+type testServer struct {
+	t         *testing.T
+	conn      *net.UDPConn
+	retry     bool
+	tlsConfig *tls.Config
+
+	peer         *net.UDPAddr
+	scid         []byte
+	clientCID    []byte
+	tls          *tls.QUICConn
+	open, seal   [numLevels]*Keys
+	nextPN       [numLevels]uint64
+	largest      [numLevels]int64
+	cryptoSent   [numLevels]uint64
+	cryptoRecv   [numLevels]uint64
+	streams      map[uint64]*recvStream
+	retried      bool
+	retryToken   []byte
+	answered     map[uint64]bool
+	serverParams []byte
+}
+
+func startTestServer(t *testing.T, retry bool) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s := &testServer{
+		t:     t,
+		conn:  conn,
+		retry: retry,
+		tlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{testutil.Certificate(t, "quic.example.com")},
+			NextProtos:   []string{"h3"},
+			MinVersion:   tls.VersionTLS13,
+		},
+		scid:     randomBytes(8),
+		largest:  [numLevels]int64{-1, -1, -1},
+		streams:  make(map[uint64]*recvStream),
+		answered: make(map[uint64]bool),
+	}
+	s.serverParams = appendIntegerParameter(nil, paramInitialMaxData, 1<<20)
+	s.serverParams = appendIntegerParameter(s.serverParams, paramInitialMaxStreamDataBidiRemote, 1<<20)
+	s.serverParams = appendIntegerParameter(s.serverParams, paramInitialMaxStreamsBidi, 10)
+	s.serverParams = appendBytesParameter(s.serverParams, paramInitialSourceConnectionID, s.scid)
+	go s.serve()
+	return conn.LocalAddr().String()
+}
+
+var quicLevels = [numLevels]tls.QUICEncryptionLevel{
+	tls.QUICEncryptionLevelInitial, tls.QUICEncryptionLevelHandshake, tls.QUICEncryptionLevelApplication,
+}
+
+func levelOf(level tls.QUICEncryptionLevel) int {
+	for i, l := range quicLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *testServer) serve() {
+	buf := make([]byte, 65536)
+	for {
+		n, peer, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		s.peer = peer
+		datagram := append([]byte(nil), buf[:n]...)
+		for len(datagram) > 0 {
+			p, rest, err := parsePacket(datagram, len(s.scid))
+			if err != nil {
+				break
+			}
+			datagram = rest
+			if err := s.handlePacket(p); err != nil {
+				s.t.Errorf("server: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func (s *testServer) sendRetry(p *packet) {
+	s.retryToken = randomBytes(16)
+	header := []byte{0xc0 | packetTypeRetry<<4, 0, 0, 0, 1, byte(len(p.scid))}
+	header = append(header, p.scid...)
+	header = append(header, byte(len(s.scid)))
+	header = append(header, s.scid...)
+	header = append(header, s.retryToken...)
+	block, _ := aes.NewCipher(retryKey)
+	aead, _ := cipher.NewGCM(block)
+	pseudo := append([]byte{byte(len(p.dcid))}, p.dcid...)
+	pseudo = append(pseudo, header...)
+	s.conn.WriteToUDP(append(header, aead.Seal(nil, retryNonce, nil, pseudo)...), s.peer)
+}
+
+func (s *testServer) handlePacket(p *packet) error {
+	if s.tls == nil {
+		if !p.long || p.typ != packetTypeInitial {
+			return nil
+		}
+		if s.retry && !s.retried {
+			s.retried = true
+			s.sendRetry(p)
+			return nil
+		}
+		if s.retry && !bytes.Equal(p.token, s.retryToken) {
+			s.t.Errorf("server: got token %x, expected %x", p.token, s.retryToken)
+		}
+		s.clientCID = append([]byte(nil), p.scid...)
+		client, server := InitialSecrets(p.dcid)
+		s.open[levelInitial], s.seal[levelInitial] = NewKeys(client), NewKeys(server)
+		s.tls = tls.QUICServer(&tls.QUICConfig{TLSConfig: s.tlsConfig})
+		s.tls.SetTransportParameters(s.serverParams)
+		if err := s.tls.Start(context.Background()); err != nil {
+			return err
+		}
+	}
+	level := levelApplication
+	if p.long {
+		if p.typ == packetTypeHandshake {
+			level = levelHandshake
+		} else {
+			level = levelInitial
+		}
+	}
+	if s.open[level] == nil {
+		return nil
+	}
+	pn, payload, err := s.open[level].Open(p.raw, p.pnOffset, s.largest[level])
+	if err != nil {
+		return err
+	}
+	if int64(pn) > s.largest[level] {
+		s.largest[level] = int64(pn)
+	}
+	frames, err := parseFrames(payload)
+	if err != nil {
+		return err
+	}
+	for _, f := range frames {
+		switch f.typ {
+		case frameTypeCrypto:
+			if f.offset != s.cryptoRecv[level] {
+				continue
+			}
+			s.cryptoRecv[level] += uint64(len(f.data))
+			if err := s.tls.HandleData(quicLevels[level], f.data); err != nil {
+				return err
+			}
+			if err := s.processEvents(); err != nil {
+				return err
+			}
+		case frameTypeStream:
+			stream, ok := s.streams[f.streamID]
+			if !ok {
+				stream = newRecvStream()
+				s.streams[f.streamID] = stream
+			}
+			stream.add(f.offset, f.data, f.fin)
+			if stream.complete() && !s.answered[f.streamID] {
+				s.answered[f.streamID] = true
+				response := append([]byte("echo: "), stream.data...)
+				s.send(levelApplication, appendStreamFrame(nil, f.streamID, 0, response, true))
+			}
+		}
+	}
+	return nil
+}
+
+func (s *testServer) processEvents() error {
+	for {
+		e := s.tls.NextEvent()
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case tls.QUICSetReadSecret:
+			s.open[levelOf(e.Level)] = NewKeys(e.Data)
+		case tls.QUICSetWriteSecret:
+			s.seal[levelOf(e.Level)] = NewKeys(e.Data)
+		case tls.QUICWriteData:
+			level := levelOf(e.Level)
+			s.send(level, appendCryptoFrame(nil, s.cryptoSent[level], e.Data))
+			s.cryptoSent[level] += uint64(len(e.Data))
+		case tls.QUICHandshakeDone:
+			s.send(levelApplication, []byte{frameTypeHandshakeDone})
+		}
+	}
+}
+
+func (s *testServer) send(level int, payload []byte) {
+	pn := s.nextPN[level]
+	s.nextPN[level]++
+	var header []byte
+	var pnOffset int
+	switch level {
+	case levelInitial:
+		header, pnOffset = appendLongHeader(nil, packetTypeInitial, Version1, s.clientCID, s.scid, nil, len(payload), pn)
+	case levelHandshake:
+		header, pnOffset = appendLongHeader(nil, packetTypeHandshake, Version1, s.clientCID, s.scid, nil, len(payload), pn)
+	default:
+		header, pnOffset = appendShortHeader(nil, s.clientCID, pn)
+	}
+	s.conn.WriteToUDP(s.seal[level].Seal(header, pnOffset, pn, payload), s.peer)
+}
+
+func TestHandshake(t *testing.T) {
+	for _, retry := range []bool{false, true} {
+		addr := startTestServer(t, retry)
+		conn, err := net.Dial("udp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		c := Client(conn, &Config{ServerName: "quic.example.com", NextProtos: []string{"h3"}, Timeout: 5 * time.Second})
+		if err := c.Handshake(); err != nil {
+			t.Fatalf("retry=%v: handshake failed: %v", retry, err)
+		}
+		log := c.Log()
+		if log.Retry != retry || log.ALPN != "h3" || log.CipherSuite != 0x1301 || len(log.Certificates) != 1 || !log.HandshakeComplete {
+			t.Errorf("retry=%v: unexpected log %+v", retry, log)
+		}
+		if log.TransportParameters["initial_max_streams_bidi"] != uint64(10) {
+			t.Errorf("retry=%v: unexpected transport parameters %v", retry, log.TransportParameters)
+		}
+		if err := c.SendStream(0, bytes.Repeat([]byte("x"), 2500), true); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.ReadStreams(func() bool { _, done := c.Stream(0); return done }); err != nil {
+			t.Fatalf("retry=%v: %v", retry, err)
+		}
+		if data, _ := c.Stream(0); string(data) != "echo: "+string(bytes.Repeat([]byte("x"), 2500)) {
+			t.Errorf("retry=%v: got %q", retry, data)
+		}
+		if err := c.Close(0x100, ""); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// startVersionNegotiationServer answers every packet with a Version
+// Negotiation packet.
+func startVersionNegotiationServer(t *testing.T, versions ...uint32) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, peer, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			p, _, err := parsePacket(buf[:n], 0)
+			if err != nil {
+				continue
+			}
+			response := []byte{0x80, 0, 0, 0, 0, byte(len(p.scid))}
+			response = append(response, p.scid...)
+			response = append(response, byte(len(p.dcid)))
+			response = append(response, p.dcid...)
+			for _, v := range versions {
+				response = append(response, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+			}
+			conn.WriteToUDP(response, peer)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	addr := startVersionNegotiationServer(t, Version2, 0xff00001d)
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	versions, err := ProbeVersions(conn, time.Now().Add(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0] != Version2 || versions[1] != 0xff00001d {
+		t.Errorf("got versions %x", versions)
+	}
+
+	c := Client(conn, &Config{NextProtos: []string{"h3"}, Timeout: 5 * time.Second})
+	err = c.Handshake()
+	if vn, ok := err.(*VersionNegotiationError); !ok || len(vn.Versions) != 2 {
+		t.Errorf("expected a version negotiation error, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+)
+
+// Frame types (RFC 9000, section 12.4). Variants that differ only in flag
+// bits are reported as the base type.
+const (
+	frameTypePadding            = 0x00
+	frameTypePing               = 0x01
+	frameTypeAck                = 0x02
+	frameTypeAckECN             = 0x03
+	frameTypeResetStream        = 0x04
+	frameTypeStopSending        = 0x05
+	frameTypeCrypto             = 0x06
+	frameTypeNewToken           = 0x07
+	frameTypeStream             = 0x08 // through 0x0f
+	frameTypeMaxData            = 0x10
+	frameTypeMaxStreamData      = 0x11
+	frameTypeMaxStreamsBidi     = 0x12
+	frameTypeMaxStreamsUni      = 0x13
+	frameTypeDataBlocked        = 0x14
+	frameTypeStreamDataBlocked  = 0x15
+	frameTypeStreamsBlockedBidi = 0x16
+	frameTypeStreamsBlockedUni  = 0x17
+	frameTypeNewConnectionID    = 0x18
+	frameTypeRetireConnectionID = 0x19
+	frameTypePathChallenge      = 0x1a
+	frameTypePathResponse       = 0x1b
+	frameTypeConnectionClose    = 0x1c
+	frameTypeApplicationClose   = 0x1d
+	frameTypeHandshakeDone      = 0x1e
+	frameTypeDatagram           = 0x30 // and 0x31
+)
+
+// CloseError is a CONNECTION_CLOSE frame received from the peer.
+type CloseError struct {
+	// Application is true for an application-level close (frame type 0x1d),
+	// whose Code is defined by the application protocol.
+	Application bool `json:"application"`
+
+	Code uint64 `json:"code"`
+
+	// FrameType is the type of the frame that triggered a transport error.
+	FrameType uint64 `json:"frame_type,omitempty"`
+
+	Reason string `json:"reason,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *CloseError) Error() string {
+	kind := "transport"
+	if e.Application {
+		kind = "application"
+	}
+	ret := fmt.Sprintf("quic: connection closed by peer with %s error 0x%x", kind, e.Code)
+	if !e.Application && e.Code >= 0x100 && e.Code < 0x200 {
+		// CRYPTO_ERROR: a TLS alert.
+		ret += " (" + rawtls.AlertName(uint8(e.Code)) + ")"
+	}
+	if e.Reason != "" {
+		ret += ": " + e.Reason
+	}
+	return ret
+}
+
+// frame is a parsed frame; only the fields the client acts on are kept.
+type frame struct {
+	typ      uint64
+	streamID uint64
+	offset   uint64
+	data     []byte
+	fin      bool
+	close    *CloseError
+}
+
+// ackEliciting reports whether receiving the frame requires an ACK.
+func (f *frame) ackEliciting() bool {
+	switch f.typ {
+	case frameTypePadding, frameTypeAck, frameTypeConnectionClose:
+		return false
+	}
+	return true
+}
+
+type frameReader struct {
+	data []byte
+	err  bool
+}
+
+func (r *frameReader) varint() uint64 {
+	v, n := ReadVarint(r.data)
+	if n == 0 {
+		r.err = true
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *frameReader) bytes(n uint64) []byte {
+	if r.err || uint64(len(r.data)) < n {
+		r.err = true
+		return nil
+	}
+	ret := r.data[:n]
+	r.data = r.data[n:]
+	return ret
+}
+
+// parseFrames parses the frames of a packet payload.
+func parseFrames(payload []byte) ([]frame, error) {
+	r := &frameReader{data: payload}
+	var frames []frame
+	for len(r.data) > 0 && !r.err {
+		f := frame{typ: r.varint()}
+		switch {
+		case f.typ == frameTypePadding, f.typ == frameTypePing, f.typ == frameTypeHandshakeDone:
+		case f.typ == frameTypeAck, f.typ == frameTypeAckECN:
+			r.varint() // largest acknowledged
+			r.varint() // ACK delay
+			ranges := r.varint()
+			r.varint() // first ACK range
+			for i := uint64(0); i < ranges && !r.err; i++ {
+				r.varint() // gap
+				r.varint() // ACK range length
+			}
+			if f.typ == frameTypeAckECN {
+				r.varint()
+				r.varint()
+				r.varint()
+			}
+			f.typ = frameTypeAck
+		case f.typ == frameTypeResetStream:
+			f.streamID = r.varint()
+			r.varint() // application error code
+			r.varint() // final size
+		case f.typ == frameTypeStopSending:
+			f.streamID = r.varint()
+			r.varint() // application error code
+		case f.typ == frameTypeCrypto:
+			f.offset = r.varint()
+			f.data = r.bytes(r.varint())
+		case f.typ == frameTypeNewToken:
+			f.data = r.bytes(r.varint())
+		case f.typ >= frameTypeStream && f.typ <= frameTypeStream|0x07:
+			f.streamID = r.varint()
+			if f.typ&0x04 != 0 {
+				f.offset = r.varint()
+			}
+			if f.typ&0x02 != 0 {
+				f.data = r.bytes(r.varint())
+			} else {
+				f.data, r.data = r.data, nil
+			}
+			f.fin = f.typ&0x01 != 0
+			f.typ = frameTypeStream
+		case f.typ == frameTypeMaxData, f.typ == frameTypeMaxStreamsBidi, f.typ == frameTypeMaxStreamsUni,
+			f.typ == frameTypeDataBlocked, f.typ == frameTypeStreamsBlockedBidi, f.typ == frameTypeStreamsBlockedUni,
+			f.typ == frameTypeRetireConnectionID:
+			r.varint()
+		case f.typ == frameTypeMaxStreamData, f.typ == frameTypeStreamDataBlocked:
+			f.streamID = r.varint()
+			r.varint()
+		case f.typ == frameTypeNewConnectionID:
+			r.varint() // sequence number
+			r.varint() // retire prior to
+			length := r.bytes(1)
+			if length != nil {
+				f.data = r.bytes(uint64(length[0]))
+			}
+			r.bytes(16) // stateless reset token
+		case f.typ == frameTypePathChallenge, f.typ == frameTypePathResponse:
+			f.data = r.bytes(8)
+		case f.typ == frameTypeConnectionClose, f.typ == frameTypeApplicationClose:
+			f.close = &CloseError{Application: f.typ == frameTypeApplicationClose, Code: r.varint()}
+			if !f.close.Application {
+				f.close.FrameType = r.varint()
+			}
+			f.close.Reason = string(r.bytes(r.varint()))
+			f.typ = frameTypeConnectionClose
+		case f.typ == frameTypeDatagram:
+			f.data, r.data = r.data, nil
+		case f.typ == frameTypeDatagram|0x01:
+			f.data = r.bytes(r.varint())
+			f.typ = frameTypeDatagram
+		default:
+			return nil, fmt.Errorf("quic: unknown frame type 0x%x", f.typ)
+		}
+		frames = append(frames, f)
+	}
+	if r.err {
+		return nil, ErrMalformed
+	}
+	return frames, nil
+}
+
+func appendCryptoFrame(b []byte, offset uint64, data []byte) []byte {
+	b = AppendVarint(b, frameTypeCrypto)
+	b = AppendVarint(b, offset)
+	b = AppendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendStreamFrame(b []byte, id, offset uint64, data []byte, fin bool) []byte {
+	typ := uint64(frameTypeStream | 0x04 | 0x02)
+	if fin {
+		typ |= 0x01
+	}
+	b = AppendVarint(b, typ)
+	b = AppendVarint(b, id)
+	b = AppendVarint(b, offset)
+	b = AppendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendCloseFrame(b []byte, application bool, code uint64, reason string) []byte {
+	if application {
+		b = AppendVarint(b, frameTypeApplicationClose)
+		b = AppendVarint(b, code)
+	} else {
+		b = AppendVarint(b, frameTypeConnectionClose)
+		b = AppendVarint(b, code)
+		b = AppendVarint(b, 0) // frame type
+	}
+	b = AppendVarint(b, uint64(len(reason)))
+	return append(b, reason...)
+}
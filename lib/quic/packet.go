@@ -0,0 +1,315 @@
+// Package quic is a minimal QUIC version 1 client (RFC 9000, RFC 9001) for
+// scanning: it performs the handshake with the TLS 1.3 messages from
+// lib/rawtls, records what the server sends and exchanges stream data. It
+// offers only TLS_AES_128_GCM_SHA256 and X25519, and does no congestion
+// control, loss recovery or connection migration.
+package quic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Version1 is QUIC version 1.
+const Version1 uint32 = 0x00000001
+
+// Long header packet types.
+const (
+	packetTypeInitial   = 0x0
+	packetTypeZeroRTT   = 0x1
+	packetTypeHandshake = 0x2
+	packetTypeRetry     = 0x3
+)
+
+// MinInitialDatagramSize is the size client datagrams carrying Initial
+// packets are padded to.
+const MinInitialDatagramSize = 1200
+
+// pnLength is the packet number length used for all packets sent.
+const pnLength = 4
+
+var initialSaltV1 = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+var (
+	// ErrMalformed is returned for packets and frames that cannot be parsed.
+	ErrMalformed = errors.New("malformed QUIC packet")
+
+	// ErrDecrypt is returned when packet protection cannot be removed.
+	ErrDecrypt = errors.New("QUIC packet decryption failed")
+)
+
+// AppendVarint appends v as a QUIC variable-length integer.
+func AppendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// ReadVarint decodes a variable-length integer at the start of b and returns
+// it with its length, or a length of 0 if b is too short.
+func ReadVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0
+	}
+	v := uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+// Keys protects the packets of one direction at one encryption level, with
+// AEAD_AES_128_GCM and AES header protection.
+type Keys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// NewKeys derives the packet protection keys from a traffic secret.
+func NewKeys(secret []byte) *Keys {
+	block, err := aes.NewCipher(rawtls.ExpandLabel(secret, "quic key", nil, 16))
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	hp, err := aes.NewCipher(rawtls.ExpandLabel(secret, "quic hp", nil, 16))
+	if err != nil {
+		panic(err)
+	}
+	return &Keys{aead: aead, iv: rawtls.ExpandLabel(secret, "quic iv", nil, 12), hp: hp}
+}
+
+// InitialSecrets returns the client and server Initial secrets for the
+// client's first Destination Connection ID.
+func InitialSecrets(dcid []byte) (client []byte, server []byte) {
+	initial := hkdf.Extract(sha256.New, dcid, initialSaltV1)
+	return rawtls.ExpandLabel(initial, "client in", nil, sha256.Size),
+		rawtls.ExpandLabel(initial, "server in", nil, sha256.Size)
+}
+
+func (k *Keys) nonce(pn uint64) []byte {
+	nonce := make([]byte, len(k.iv))
+	copy(nonce, k.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * uint(i)))
+	}
+	return nonce
+}
+
+// headerMask returns the header protection mask for a protected packet whose
+// packet number starts at pnOffset.
+func (k *Keys) headerMask(packet []byte, pnOffset int) ([]byte, error) {
+	if len(packet) < pnOffset+4+16 {
+		return nil, ErrMalformed
+	}
+	mask := make([]byte, 16)
+	k.hp.Encrypt(mask, packet[pnOffset+4:pnOffset+4+16])
+	return mask, nil
+}
+
+// Seal protects a packet. header ends with the pnLength-byte packet number,
+// which starts at pnOffset.
+func (k *Keys) Seal(header []byte, pnOffset int, pn uint64, payload []byte) []byte {
+	packet := k.aead.Seal(append([]byte{}, header...), k.nonce(pn), payload, header)
+	mask, err := k.headerMask(packet, pnOffset)
+	if err != nil {
+		panic(err)
+	}
+	if packet[0]&0x80 != 0 {
+		packet[0] ^= mask[0] & 0x0f
+	} else {
+		packet[0] ^= mask[0] & 0x1f
+	}
+	for i := 0; i < pnLength; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet
+}
+
+// Open removes the protection of a packet (modifying it in place) and returns
+// its full packet number and payload. largest is the largest packet number
+// received so far in the packet number space, or -1.
+func (k *Keys) Open(packet []byte, pnOffset int, largest int64) (uint64, []byte, error) {
+	mask, err := k.headerMask(packet, pnOffset)
+	if err != nil {
+		return 0, nil, err
+	}
+	if packet[0]&0x80 != 0 {
+		packet[0] ^= mask[0] & 0x0f
+	} else {
+		packet[0] ^= mask[0] & 0x1f
+	}
+	length := int(packet[0]&0x03) + 1
+	var truncated uint64
+	for i := 0; i < length; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+		truncated = truncated<<8 | uint64(packet[pnOffset+i])
+	}
+	pn := decodePacketNumber(largest, truncated, length*8)
+	header := packet[:pnOffset+length]
+	payload, err := k.aead.Open(nil, k.nonce(pn), packet[pnOffset+length:], header)
+	if err != nil {
+		return 0, nil, ErrDecrypt
+	}
+	return pn, payload, nil
+}
+
+// decodePacketNumber is the algorithm from RFC 9000, appendix A.3.
+func decodePacketNumber(largest int64, truncated uint64, bits int) uint64 {
+	expected := uint64(largest + 1)
+	win := uint64(1) << uint(bits)
+	hwin := win / 2
+	mask := win - 1
+	candidate := (expected &^ mask) | truncated
+	if candidate+hwin <= expected && candidate < (1<<62)-win {
+		return candidate + win
+	}
+	if candidate > expected+hwin && candidate >= win {
+		return candidate - win
+	}
+	return candidate
+}
+
+// packet is a received packet, split off its datagram.
+type packet struct {
+	long     bool
+	typ      int
+	version  uint32
+	dcid     []byte
+	scid     []byte
+	token    []byte
+	pnOffset int
+	raw      []byte
+
+	// versions are the versions of a Version Negotiation packet.
+	versions []uint32
+}
+
+// parsePacket splits the first packet off a datagram. shortDCIDLength is the
+// length of the connection IDs the client chose, used in short headers.
+func parsePacket(datagram []byte, shortDCIDLength int) (*packet, []byte, error) {
+	if len(datagram) == 0 {
+		return nil, nil, ErrMalformed
+	}
+	p := &packet{}
+	if datagram[0]&0x80 == 0 {
+		p.pnOffset = 1 + shortDCIDLength
+		if len(datagram) < p.pnOffset {
+			return nil, nil, ErrMalformed
+		}
+		p.dcid = datagram[1:p.pnOffset]
+		p.raw = datagram
+		return p, nil, nil
+	}
+	p.long = true
+	if len(datagram) < 7 {
+		return nil, nil, ErrMalformed
+	}
+	p.version = binary.BigEndian.Uint32(datagram[1:5])
+	offset := 5
+	readCID := func() []byte {
+		if offset >= len(datagram) {
+			return nil
+		}
+		n := int(datagram[offset])
+		if n > 20 || offset+1+n > len(datagram) {
+			offset = len(datagram) + 1
+			return nil
+		}
+		cid := datagram[offset+1 : offset+1+n]
+		offset += 1 + n
+		return cid
+	}
+	p.dcid = readCID()
+	p.scid = readCID()
+	if offset > len(datagram) {
+		return nil, nil, ErrMalformed
+	}
+	if p.version == 0 {
+		for rest := datagram[offset:]; len(rest) >= 4; rest = rest[4:] {
+			p.versions = append(p.versions, binary.BigEndian.Uint32(rest))
+		}
+		p.raw = datagram
+		return p, nil, nil
+	}
+	p.typ = int(datagram[0]>>4) & 0x3
+	if p.typ == packetTypeRetry {
+		if len(datagram)-offset < 16 {
+			return nil, nil, ErrMalformed
+		}
+		p.token = datagram[offset : len(datagram)-16]
+		p.raw = datagram
+		return p, nil, nil
+	}
+	if p.typ == packetTypeInitial {
+		tokenLength, n := ReadVarint(datagram[offset:])
+		if n == 0 || uint64(len(datagram)-offset-n) < tokenLength {
+			return nil, nil, ErrMalformed
+		}
+		offset += n
+		p.token = datagram[offset : offset+int(tokenLength)]
+		offset += int(tokenLength)
+	}
+	length, n := ReadVarint(datagram[offset:])
+	if n == 0 || uint64(len(datagram)-offset-n) < length {
+		return nil, nil, ErrMalformed
+	}
+	offset += n
+	p.pnOffset = offset
+	p.raw = datagram[:offset+int(length)]
+	return p, datagram[offset+int(length):], nil
+}
+
+// appendLongHeader appends a long header with a pnLength-byte packet number
+// for a payload of payloadLength bytes (before protection), and returns the
+// header and the packet number offset.
+func appendLongHeader(b []byte, typ int, version uint32, dcid, scid, token []byte, payloadLength int, pn uint64) ([]byte, int) {
+	b = append(b, 0xc0|byte(typ)<<4|(pnLength-1))
+	b = append(b, byte(version>>24), byte(version>>16), byte(version>>8), byte(version))
+	b = append(b, byte(len(dcid)))
+	b = append(b, dcid...)
+	b = append(b, byte(len(scid)))
+	b = append(b, scid...)
+	if typ == packetTypeInitial {
+		b = AppendVarint(b, uint64(len(token)))
+		b = append(b, token...)
+	}
+	// Always a two-byte length, so the header size is known up front.
+	length := pnLength + payloadLength + 16
+	b = append(b, 0x40|byte(length>>8), byte(length))
+	pnOffset := len(b)
+	return append(b, byte(pn>>24), byte(pn>>16), byte(pn>>8), byte(pn)), pnOffset
+}
+
+// appendShortHeader appends a short header with a pnLength-byte packet
+// number.
+func appendShortHeader(b []byte, dcid []byte, pn uint64) ([]byte, int) {
+	b = append(b, 0x40|(pnLength-1))
+	b = append(b, dcid...)
+	pnOffset := len(b)
+	return append(b, byte(pn>>24), byte(pn>>16), byte(pn>>8), byte(pn)), pnOffset
+}
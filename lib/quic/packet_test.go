@@ -0,0 +1,145 @@
+package quic
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	ret, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+// TestInitialKeys checks the key derivation and header protection against
+// RFC 9001, appendix A.
+func TestInitialKeys(t *testing.T) {
+	client, server := InitialSecrets(mustHex(t, "8394c8f03e515708"))
+	tests := []struct {
+		name         string
+		secret       []byte
+		key, iv, hp  string
+		sample, mask string
+	}{
+		{"client", client, "1f369613dd76d5467730efcbe3b1a22d", "fa044b2f42a3fd3b46fb255c", "9f50449e04a0e810283a1e9933adedd2",
+			"d1b1c98dd7689fb8ec11d242b123dc9b", "437b9aec36"},
+		{"server", server, "cf3a5331653c364c88f0f379b6067e37", "0ac1493ca1905853b0bba03e", "c206b8d9b9f0f37644430b490eeaa314",
+			"2cd0991cd25b0aac406a5816b6394100", "2ec0d8356a"},
+	}
+	for _, test := range tests {
+		if key := rawtls.ExpandLabel(test.secret, "quic key", nil, 16); !bytes.Equal(key, mustHex(t, test.key)) {
+			t.Errorf("%s key: got %x, expected %s", test.name, key, test.key)
+		}
+		if hp := rawtls.ExpandLabel(test.secret, "quic hp", nil, 16); !bytes.Equal(hp, mustHex(t, test.hp)) {
+			t.Errorf("%s hp: got %x, expected %s", test.name, hp, test.hp)
+		}
+		keys := NewKeys(test.secret)
+		if !bytes.Equal(keys.iv, mustHex(t, test.iv)) {
+			t.Errorf("%s iv: got %x, expected %s", test.name, keys.iv, test.iv)
+		}
+		// A packet whose sample (4 bytes after the packet number offset 0)
+		// is the one from the RFC.
+		packet := append(make([]byte, 4), mustHex(t, test.sample)...)
+		mask, err := keys.headerMask(packet, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(mask[:5], mustHex(t, test.mask)) {
+			t.Errorf("%s mask: got %x, expected %s", test.name, mask[:5], test.mask)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	client, _ := InitialSecrets([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	payload := appendCryptoFrame(nil, 0, []byte("hello"))
+	header, pnOffset := appendLongHeader(nil, packetTypeHandshake, Version1, []byte{9, 9}, []byte{8, 8}, nil, len(payload), 0x1234)
+	sealed := NewKeys(client).Seal(header, pnOffset, 0x1234, payload)
+	p, rest, err := parsePacket(sealed, 0)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("parsePacket: %v, %d bytes left", err, len(rest))
+	}
+	if p.typ != packetTypeHandshake || !bytes.Equal(p.dcid, []byte{9, 9}) || !bytes.Equal(p.scid, []byte{8, 8}) {
+		t.Errorf("unexpected packet %+v", p)
+	}
+	pn, opened, err := NewKeys(client).Open(p.raw, p.pnOffset, 0x1200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pn != 0x1234 || !bytes.Equal(opened, payload) {
+		t.Errorf("got packet %x with payload %x", pn, opened)
+	}
+}
+
+func TestDecodePacketNumber(t *testing.T) {
+	// RFC 9000, appendix A.3.
+	if pn := decodePacketNumber(0xa82f30ea, 0x9b32, 16); pn != 0xa82f9b32 {
+		t.Errorf("got 0x%x", pn)
+	}
+	if pn := decodePacketNumber(-1, 0, 32); pn != 0 {
+		t.Errorf("got 0x%x", pn)
+	}
+}
+
+func TestVarint(t *testing.T) {
+	for _, v := range []uint64{0, 37, 63, 64, 15293, 16383, 16384, 494878333, 1 << 30, 151288809941952652} {
+		b := AppendVarint(nil, v)
+		got, n := ReadVarint(b)
+		if got != v || n != len(b) {
+			t.Errorf("%d: encoded as %x, decoded as %d (%d bytes)", v, b, got, n)
+		}
+	}
+	// RFC 9000, appendix A.1.
+	if v, n := ReadVarint(mustHex(t, "c2197c5eff14e88c")); v != 151288809941952652 || n != 8 {
+		t.Errorf("got %d (%d bytes)", v, n)
+	}
+}
+
+func TestParseTransportParameters(t *testing.T) {
+	var b []byte
+	b = appendIntegerParameter(b, paramInitialMaxData, 65536)
+	b = appendBytesParameter(b, paramInitialSourceConnectionID, []byte{0xab, 0xcd})
+	b = appendBytesParameter(b, paramDisableActiveMigration, nil)
+	b = appendBytesParameter(b, 31*5+27, []byte{1}) // reserved
+	b = appendBytesParameter(b, 0x1234, []byte{2})
+	params, err := ParseTransportParameters(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := TransportParameters{
+		"initial_max_data":             uint64(65536),
+		"initial_source_connection_id": "abcd",
+		"disable_active_migration":     true,
+		"unknown_0x1234":               "02",
+	}
+	if len(params) != len(expected) {
+		t.Errorf("got %v", params)
+	}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("%s: got %v, expected %v", k, params[k], v)
+		}
+	}
+}
+
+func TestVersionName(t *testing.T) {
+	tests := map[uint32]string{
+		0x00000001: "v1",
+		0x6b3343cf: "v2",
+		0xff00001d: "draft-29",
+		0x1a2a3a4a: "grease",
+		0x51303436: "gquic-Q046",
+		0xfaceb002: "mvfst-2",
+		0x12345678: "0x12345678",
+	}
+	for v, expected := range tests {
+		if name := VersionName(v); name != expected {
+			t.Errorf("0x%08x: got %s, expected %s", v, name, expected)
+		}
+	}
+}
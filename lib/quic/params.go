@@ -0,0 +1,121 @@
+package quic
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// extensionQUICTransportParameters is the TLS extension carrying the
+// transport parameters (RFC 9001, section 8.2).
+const extensionQUICTransportParameters = 0x39
+
+// Transport parameter IDs (RFC 9000, section 18.2, and extensions).
+const (
+	paramOriginalDestinationConnectionID = 0x00
+	paramMaxIdleTimeout                  = 0x01
+	paramStatelessResetToken             = 0x02
+	paramMaxUDPPayloadSize               = 0x03
+	paramInitialMaxData                  = 0x04
+	paramInitialMaxStreamDataBidiLocal   = 0x05
+	paramInitialMaxStreamDataBidiRemote  = 0x06
+	paramInitialMaxStreamDataUni         = 0x07
+	paramInitialMaxStreamsBidi           = 0x08
+	paramInitialMaxStreamsUni            = 0x09
+	paramAckDelayExponent                = 0x0a
+	paramMaxAckDelay                     = 0x0b
+	paramDisableActiveMigration          = 0x0c
+	paramPreferredAddress                = 0x0d
+	paramActiveConnectionIDLimit         = 0x0e
+	paramInitialSourceConnectionID       = 0x0f
+	paramRetrySourceConnectionID         = 0x10
+	paramVersionInformation              = 0x11
+	paramMaxDatagramFrameSize            = 0x20
+	paramGreaseQUICBit                   = 0x2ab2
+)
+
+type paramKind int
+
+const (
+	paramInteger paramKind = iota
+	paramBytes
+	paramFlag
+)
+
+var transportParameterNames = map[uint64]struct {
+	name string
+	kind paramKind
+}{
+	paramOriginalDestinationConnectionID: {"original_destination_connection_id", paramBytes},
+	paramMaxIdleTimeout:                  {"max_idle_timeout", paramInteger},
+	paramStatelessResetToken:             {"stateless_reset_token", paramBytes},
+	paramMaxUDPPayloadSize:               {"max_udp_payload_size", paramInteger},
+	paramInitialMaxData:                  {"initial_max_data", paramInteger},
+	paramInitialMaxStreamDataBidiLocal:   {"initial_max_stream_data_bidi_local", paramInteger},
+	paramInitialMaxStreamDataBidiRemote:  {"initial_max_stream_data_bidi_remote", paramInteger},
+	paramInitialMaxStreamDataUni:         {"initial_max_stream_data_uni", paramInteger},
+	paramInitialMaxStreamsBidi:           {"initial_max_streams_bidi", paramInteger},
+	paramInitialMaxStreamsUni:            {"initial_max_streams_uni", paramInteger},
+	paramAckDelayExponent:                {"ack_delay_exponent", paramInteger},
+	paramMaxAckDelay:                     {"max_ack_delay", paramInteger},
+	paramDisableActiveMigration:          {"disable_active_migration", paramFlag},
+	paramPreferredAddress:                {"preferred_address", paramBytes},
+	paramActiveConnectionIDLimit:         {"active_connection_id_limit", paramInteger},
+	paramInitialSourceConnectionID:       {"initial_source_connection_id", paramBytes},
+	paramRetrySourceConnectionID:         {"retry_source_connection_id", paramBytes},
+	paramVersionInformation:              {"version_information", paramBytes},
+	paramMaxDatagramFrameSize:            {"max_datagram_frame_size", paramInteger},
+	paramGreaseQUICBit:                   {"grease_quic_bit", paramFlag},
+}
+
+// TransportParameters are the transport parameters sent by a server, keyed by
+// their RFC names: integers as numbers, connection IDs, tokens and other
+// binary values as hex strings, and flags as true. Unknown parameters appear
+// as "unknown_0x<id>" with a hex value.
+type TransportParameters map[string]interface{}
+
+// ParseTransportParameters parses the quic_transport_parameters extension.
+func ParseTransportParameters(data []byte) (TransportParameters, error) {
+	r := &frameReader{data: data}
+	ret := make(TransportParameters)
+	for len(r.data) > 0 && !r.err {
+		id := r.varint()
+		value := r.bytes(r.varint())
+		if r.err {
+			break
+		}
+		known, ok := transportParameterNames[id]
+		if !ok {
+			// Reserved (GREASE) parameters are 31 * N + 27.
+			if id%31 != 27 {
+				ret[fmt.Sprintf("unknown_0x%x", id)] = hex.EncodeToString(value)
+			}
+			continue
+		}
+		switch known.kind {
+		case paramInteger:
+			v, n := ReadVarint(value)
+			if n == 0 || n != len(value) {
+				return nil, fmt.Errorf("quic: invalid %s transport parameter", known.name)
+			}
+			ret[known.name] = v
+		case paramFlag:
+			ret[known.name] = true
+		default:
+			ret[known.name] = hex.EncodeToString(value)
+		}
+	}
+	if r.err {
+		return nil, ErrMalformed
+	}
+	return ret, nil
+}
+
+func appendBytesParameter(b []byte, id uint64, value []byte) []byte {
+	b = AppendVarint(b, id)
+	b = AppendVarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendIntegerParameter(b []byte, id uint64, value uint64) []byte {
+	return appendBytesParameter(b, id, AppendVarint(nil, value))
+}
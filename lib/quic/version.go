@@ -0,0 +1,78 @@
+package quic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Version2 is QUIC version 2 (RFC 9369).
+const Version2 uint32 = 0x6b3343cf
+
+// greaseVersion is a reserved version (RFC 9000, section 15), which no
+// server supports.
+const greaseVersion uint32 = 0x1a2a3a4a
+
+// VersionName returns a readable name for a QUIC version number.
+func VersionName(v uint32) string {
+	switch {
+	case v == Version1:
+		return "v1"
+	case v == Version2:
+		return "v2"
+	case v&0x0f0f0f0f == 0x0a0a0a0a:
+		return "grease"
+	case v>>8 == 0xff0000:
+		return fmt.Sprintf("draft-%d", v&0xff)
+	case v>>4 == 0xfaceb00:
+		return fmt.Sprintf("mvfst-%d", v&0xf)
+	}
+	// Google QUIC versions are ASCII, e.g. Q046 or T051.
+	b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	if (b[0] == 'Q' || b[0] == 'T') && b[1] >= '0' && b[1] <= '9' && b[2] >= '0' && b[2] <= '9' && b[3] >= '0' && b[3] <= '9' {
+		return "gquic-" + string(b)
+	}
+	return fmt.Sprintf("0x%08x", v)
+}
+
+// ProbeVersions sends an Initial packet with a reserved version, which every
+// QUIC server must answer with a Version Negotiation packet, and returns the
+// versions listed in it. The packet is resent every second until deadline.
+func ProbeVersions(conn net.Conn, deadline time.Time) ([]uint32, error) {
+	if deadline.IsZero() {
+		return nil, errors.New("quic: ProbeVersions needs a deadline")
+	}
+	dcid, scid := randomBytes(8), randomBytes(8)
+	header, _ := appendLongHeader(nil, packetTypeInitial, greaseVersion, dcid, scid, nil, 0, 0)
+	payloadLength := MinInitialDatagramSize - len(header) - 16
+	header, _ = appendLongHeader(nil, packetTypeInitial, greaseVersion, dcid, scid, nil, payloadLength, 0)
+	datagram := append(header, randomBytes(MinInitialDatagramSize-len(header))...)
+	buf := make([]byte, 65536)
+	for {
+		if _, err := conn.Write(datagram); err != nil {
+			return nil, err
+		}
+		retransmit := time.Now().Add(retransmitInterval)
+		if deadline.Before(retransmit) {
+			retransmit = deadline
+		}
+		for {
+			if err := conn.SetReadDeadline(retransmit); err != nil {
+				return nil, err
+			}
+			n, err := conn.Read(buf)
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() && time.Now().Before(deadline) {
+					break
+				}
+				return nil, err
+			}
+			p, _, err := parsePacket(buf[:n], 0)
+			if err == nil && p.long && p.version == 0 && bytes.Equal(p.dcid, scid) && bytes.Equal(p.scid, dcid) {
+				return p.versions, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,626 @@
+// Package rawtls builds TLS ClientHello messages byte-by-byte and parses the
+// server's first flight, for probes that the zcrypto TLS stack cannot perform
+// (it stops at TLS 1.2): TLS 1.3 group negotiation, HelloRetryRequest
+// detection, extension tolerance and so on.
+//
+// Nothing here completes a handshake; the probes only look at the ServerHello
+// (or alert) that the server sends in response to a crafted ClientHello.
+package rawtls
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Record and handshake types.
+const (
+	RecordTypeChangeCipherSpec = 20
+	RecordTypeAlert            = 21
+	RecordTypeHandshake        = 22
+	RecordTypeApplicationData  = 23
+	RecordTypeHeartbeat        = 24
+
+	HandshakeTypeClientHello         = 1
+	HandshakeTypeServerHello         = 2
+	HandshakeTypeNewSessionTicket    = 4
+	HandshakeTypeEndOfEarlyData      = 5
+	HandshakeTypeEncryptedExtensions = 8
+	HandshakeTypeCertificate         = 11
+	HandshakeTypeServerHelloDone     = 14
+	HandshakeTypeClientKeyExchange   = 16
+	HandshakeTypeFinished            = 20
+)
+
+// Protocol versions.
+const (
+	VersionTLS10 = 0x0301
+	VersionTLS11 = 0x0302
+	VersionTLS12 = 0x0303
+	VersionTLS13 = 0x0304
+)
+
+// Extension types.
+const (
+	ExtensionServerName           = 0
+	ExtensionSupportedGroups      = 10
+	ExtensionECPointFormats       = 11
+	ExtensionSignatureAlgorithms  = 13
+	ExtensionALPN                 = 16
+	ExtensionPadding              = 21
+	ExtensionExtendedMasterSecret = 23
+	ExtensionSessionTicket        = 35
+	ExtensionPreSharedKey         = 41
+	ExtensionEarlyData            = 42
+	ExtensionSupportedVersions    = 43
+	ExtensionPSKKeyExchangeModes  = 45
+	ExtensionKeyShare             = 51
+	ExtensionRenegotiationInfo    = 0xff01
+)
+
+// helloRetryRequestRandom is the special ServerHello.random value that marks
+// a HelloRetryRequest (RFC 8446, section 4.1.3).
+var helloRetryRequestRandom = []byte{
+	0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+	0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+}
+
+// DefaultCipherSuites are offered when a ClientHello does not specify any:
+// the TLS 1.3 suites followed by common TLS 1.2 ECDHE suites.
+var DefaultCipherSuites = []uint16{
+	0x1301, 0x1302, 0x1303,
+	0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+}
+
+// DefaultSignatureAlgorithms are offered in the signature_algorithms
+// extension by NewClientHello.
+var DefaultSignatureAlgorithms = []uint16{
+	0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601, 0x0807,
+}
+
+// Extension is a raw TLS extension.
+type Extension struct {
+	Type uint16
+	Data []byte
+}
+
+// ClientHello is a ClientHello message under construction. Extensions are
+// sent in the order given.
+type ClientHello struct {
+	Version      uint16
+	Random       []byte
+	SessionID    []byte
+	CipherSuites []uint16
+	Extensions   []Extension
+}
+
+// NewClientHello returns a ClientHello offering TLS 1.3 and 1.2 with the
+// given groups in supported_groups. keyShares holds the key_share entries to
+// send; with none, a TLS 1.3 server must answer with a HelloRetryRequest that
+// names the group it prefers. An empty serverName omits SNI.
+func NewClientHello(serverName string, groups []uint16, keyShares []KeyShare) *ClientHello {
+	ch := &ClientHello{
+		Version:      VersionTLS12,
+		Random:       randomBytes(32),
+		SessionID:    randomBytes(32),
+		CipherSuites: DefaultCipherSuites,
+	}
+	if serverName != "" {
+		ch.Add(ServerNameExtension(serverName))
+	}
+	ch.Add(Extension{Type: ExtensionExtendedMasterSecret})
+	ch.Add(Extension{Type: ExtensionRenegotiationInfo, Data: []byte{0}})
+	ch.Add(SupportedGroupsExtension(groups))
+	ch.Add(Extension{Type: ExtensionECPointFormats, Data: []byte{1, 0}})
+	ch.Add(Extension{Type: ExtensionSessionTicket})
+	ch.Add(SignatureAlgorithmsExtension(DefaultSignatureAlgorithms))
+	ch.Add(KeyShareExtension(keyShares))
+	ch.Add(Extension{Type: ExtensionPSKKeyExchangeModes, Data: []byte{1, 1}})
+	ch.Add(SupportedVersionsExtension([]uint16{VersionTLS13, VersionTLS12}))
+	return ch
+}
+
+// NewLegacyClientHello returns a ClientHello for the given (pre-1.3)
+// version offering only the given cipher suites, with the extensions a
+// typical TLS 1.2 client sends.
+func NewLegacyClientHello(serverName string, version uint16, cipherSuites []uint16) *ClientHello {
+	ch := &ClientHello{
+		Version:      version,
+		Random:       randomBytes(32),
+		CipherSuites: cipherSuites,
+	}
+	if serverName != "" {
+		ch.Add(ServerNameExtension(serverName))
+	}
+	ch.Add(Extension{Type: ExtensionRenegotiationInfo, Data: []byte{0}})
+	ch.Add(SupportedGroupsExtension([]uint16{0x0017, 0x0018, 0x0019}))
+	ch.Add(Extension{Type: ExtensionECPointFormats, Data: []byte{1, 0}})
+	if version >= VersionTLS12 {
+		ch.Add(SignatureAlgorithmsExtension(DefaultSignatureAlgorithms))
+	}
+	return ch
+}
+
+// HandshakeMessage returns a handshake message with the given type and body.
+func HandshakeMessage(msgType uint8, body []byte) []byte {
+	var msg builder
+	msg.u8(msgType)
+	msg.u24(len(body))
+	msg.Write(body)
+	return msg.Bytes()
+}
+
+func randomBytes(n int) []byte {
+	ret := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, ret); err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// Add appends an extension.
+func (ch *ClientHello) Add(ext Extension) {
+	ch.Extensions = append(ch.Extensions, ext)
+}
+
+// Set replaces the extension with the same type, or appends it if not
+// present.
+func (ch *ClientHello) Set(ext Extension) {
+	for i := range ch.Extensions {
+		if ch.Extensions[i].Type == ext.Type {
+			ch.Extensions[i] = ext
+			return
+		}
+	}
+	ch.Add(ext)
+}
+
+// Remove deletes the extension with the given type, if present.
+func (ch *ClientHello) Remove(extType uint16) {
+	ret := ch.Extensions[:0]
+	for _, ext := range ch.Extensions {
+		if ext.Type != extType {
+			ret = append(ret, ext)
+		}
+	}
+	ch.Extensions = ret
+}
+
+// PadTo adds a padding extension (RFC 7685) so that the ClientHello
+// message is at least n bytes long, replacing any previous padding.
+func (ch *ClientHello) PadTo(n int) {
+	ch.Remove(ExtensionPadding)
+	// The extension header takes four bytes even if the padding is empty.
+	length := n - len(ch.Marshal()) - 4
+	if length < 0 {
+		length = 0
+	}
+	ch.Add(Extension{Type: ExtensionPadding, Data: make([]byte, length)})
+}
+
+// GREASE returns the i-th (mod 16) GREASE value of RFC 8701: 0x0a0a,
+// 0x1a1a, ..., 0xfafa. They are reserved for cipher suites, extensions,
+// groups, signature algorithms and versions.
+func GREASE(i int) uint16 {
+	v := uint16(i&0x0f)<<4 | 0x0a
+	return v<<8 | v
+}
+
+// IsGREASE returns whether v is a GREASE value.
+func IsGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// builder is a tiny helper for writing length-prefixed TLS structures.
+type builder struct {
+	bytes.Buffer
+}
+
+func (b *builder) u8(v uint8) {
+	b.WriteByte(v)
+}
+
+func (b *builder) u16(v uint16) {
+	b.WriteByte(byte(v >> 8))
+	b.WriteByte(byte(v))
+}
+
+func (b *builder) u24(v int) {
+	b.WriteByte(byte(v >> 16))
+	b.WriteByte(byte(v >> 8))
+	b.WriteByte(byte(v))
+}
+
+func (b *builder) vec8(data []byte) {
+	b.u8(uint8(len(data)))
+	b.Write(data)
+}
+
+func (b *builder) vec16(data []byte) {
+	b.u16(uint16(len(data)))
+	b.Write(data)
+}
+
+func u16List(values []uint16) []byte {
+	var b builder
+	for _, v := range values {
+		b.u16(v)
+	}
+	return b.Bytes()
+}
+
+// ServerNameExtension returns an SNI extension for the given host name.
+func ServerNameExtension(name string) Extension {
+	var entry builder
+	entry.u8(0) // host_name
+	entry.vec16([]byte(name))
+	var b builder
+	b.vec16(entry.Bytes())
+	return Extension{Type: ExtensionServerName, Data: b.Bytes()}
+}
+
+// SupportedGroupsExtension returns a supported_groups extension.
+func SupportedGroupsExtension(groups []uint16) Extension {
+	var b builder
+	b.vec16(u16List(groups))
+	return Extension{Type: ExtensionSupportedGroups, Data: b.Bytes()}
+}
+
+// SignatureAlgorithmsExtension returns a signature_algorithms extension.
+func SignatureAlgorithmsExtension(algorithms []uint16) Extension {
+	var b builder
+	b.vec16(u16List(algorithms))
+	return Extension{Type: ExtensionSignatureAlgorithms, Data: b.Bytes()}
+}
+
+// SupportedVersionsExtension returns a (client) supported_versions extension.
+func SupportedVersionsExtension(versions []uint16) Extension {
+	var b builder
+	b.vec8(u16List(versions))
+	return Extension{Type: ExtensionSupportedVersions, Data: b.Bytes()}
+}
+
+// ALPNExtension returns an application_layer_protocol_negotiation extension.
+func ALPNExtension(protocols []string) Extension {
+	var list builder
+	for _, proto := range protocols {
+		list.vec8([]byte(proto))
+	}
+	var b builder
+	b.vec16(list.Bytes())
+	return Extension{Type: ExtensionALPN, Data: b.Bytes()}
+}
+
+// KeyShare is a single key_share entry.
+type KeyShare struct {
+	Group       uint16
+	KeyExchange []byte
+}
+
+// KeyShareExtension returns a (client) key_share extension.
+func KeyShareExtension(shares []KeyShare) Extension {
+	var list builder
+	for _, share := range shares {
+		list.u16(share.Group)
+		list.vec16(share.KeyExchange)
+	}
+	var b builder
+	b.vec16(list.Bytes())
+	return Extension{Type: ExtensionKeyShare, Data: b.Bytes()}
+}
+
+// Marshal returns the ClientHello handshake message (without the record
+// header). A random value is filled in if Random is unset.
+func (ch *ClientHello) Marshal() []byte {
+	if ch.Random == nil {
+		ch.Random = randomBytes(32)
+	}
+	var body builder
+	body.u16(ch.Version)
+	body.Write(ch.Random)
+	body.vec8(ch.SessionID)
+	body.vec16(u16List(ch.CipherSuites))
+	body.vec8([]byte{0}) // null compression
+	var exts builder
+	for _, ext := range ch.Extensions {
+		exts.u16(ext.Type)
+		exts.vec16(ext.Data)
+	}
+	if exts.Len() > 0 {
+		body.vec16(exts.Bytes())
+	}
+	return HandshakeMessage(HandshakeTypeClientHello, body.Bytes())
+}
+
+// Records returns the ClientHello wrapped in as many handshake records as
+// needed.
+func (ch *ClientHello) Records() []byte {
+	return WrapRecords(RecordTypeHandshake, VersionTLS10, ch.Marshal())
+}
+
+// WrapRecords splits data into TLS records of at most 2^14 bytes.
+func WrapRecords(recordType uint8, version uint16, data []byte) []byte {
+	const maxFragment = 1 << 14
+	var b builder
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxFragment {
+			n = maxFragment
+		}
+		b.u8(recordType)
+		b.u16(version)
+		b.vec16(data[:n])
+		data = data[n:]
+	}
+	return b.Bytes()
+}
+
+// AlertError is returned when the server answers with an alert.
+type AlertError struct {
+	Level       uint8
+	Description uint8
+}
+
+func (e *AlertError) Error() string {
+	return fmt.Sprintf("tls: received alert %s", AlertName(e.Description))
+}
+
+var alertNames = map[uint8]string{
+	0:   "close_notify",
+	10:  "unexpected_message",
+	20:  "bad_record_mac",
+	22:  "record_overflow",
+	40:  "handshake_failure",
+	42:  "bad_certificate",
+	47:  "illegal_parameter",
+	50:  "decode_error",
+	51:  "decrypt_error",
+	70:  "protocol_version",
+	71:  "insufficient_security",
+	80:  "internal_error",
+	86:  "inappropriate_fallback",
+	90:  "user_canceled",
+	109: "missing_extension",
+	110: "unsupported_extension",
+	112: "unrecognized_name",
+	116: "certificate_required",
+	120: "no_application_protocol",
+}
+
+// AlertName returns the RFC name of an alert description.
+func AlertName(description uint8) string {
+	if name, ok := alertNames[description]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", description)
+}
+
+// ServerHello is a parsed ServerHello (or HelloRetryRequest).
+type ServerHello struct {
+	Version     uint16
+	Random      []byte
+	SessionID   []byte
+	CipherSuite uint16
+	Compression uint8
+	Extensions  []Extension
+
+	// HelloRetryRequest is true if the message is a HelloRetryRequest.
+	HelloRetryRequest bool
+
+	// SelectedVersion is the negotiated version: the supported_versions
+	// extension if present, otherwise the legacy version field.
+	SelectedVersion uint16
+
+	// SelectedGroup is the group from the key_share extension (for a
+	// HelloRetryRequest, the group the server asks the client to use), or 0.
+	SelectedGroup uint16
+
+	// ALPN is the protocol the server selected, if any.
+	ALPN string
+}
+
+// Extension returns the extension with the given type, or nil.
+func (sh *ServerHello) Extension(extType uint16) *Extension {
+	for i := range sh.Extensions {
+		if sh.Extensions[i].Type == extType {
+			return &sh.Extensions[i]
+		}
+	}
+	return nil
+}
+
+// ErrMalformed is returned when the server's response cannot be parsed.
+var ErrMalformed = errors.New("tls: malformed server response")
+
+// ErrNotTLS is returned when the server's response does not look like TLS at
+// all.
+var ErrNotTLS = errors.New("tls: server response is not TLS")
+
+type reader struct {
+	data []byte
+	err  bool
+}
+
+func (r *reader) u8() uint8 {
+	if len(r.data) < 1 {
+		r.err = true
+		return 0
+	}
+	v := r.data[0]
+	r.data = r.data[1:]
+	return v
+}
+
+func (r *reader) u16() uint16 {
+	if len(r.data) < 2 {
+		r.err = true
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.data)
+	r.data = r.data[2:]
+	return v
+}
+
+func (r *reader) bytes(n int) []byte {
+	if len(r.data) < n {
+		r.err = true
+		return nil
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *reader) vec8() []byte {
+	return r.bytes(int(r.u8()))
+}
+
+func (r *reader) vec16() []byte {
+	return r.bytes(int(r.u16()))
+}
+
+// ParseServerHello parses the body of a ServerHello handshake message.
+func ParseServerHello(body []byte) (*ServerHello, error) {
+	r := &reader{data: body}
+	sh := new(ServerHello)
+	sh.Version = r.u16()
+	sh.Random = r.bytes(32)
+	sh.SessionID = r.vec8()
+	sh.CipherSuite = r.u16()
+	sh.Compression = r.u8()
+	if r.err {
+		return nil, ErrMalformed
+	}
+	sh.SelectedVersion = sh.Version
+	sh.HelloRetryRequest = bytes.Equal(sh.Random, helloRetryRequestRandom)
+	if len(r.data) == 0 {
+		return sh, nil
+	}
+	exts := &reader{data: r.vec16()}
+	for len(exts.data) > 0 && !exts.err {
+		ext := Extension{Type: exts.u16(), Data: exts.vec16()}
+		sh.Extensions = append(sh.Extensions, ext)
+	}
+	if r.err || exts.err {
+		return nil, ErrMalformed
+	}
+	if ext := sh.Extension(ExtensionSupportedVersions); ext != nil && len(ext.Data) == 2 {
+		sh.SelectedVersion = binary.BigEndian.Uint16(ext.Data)
+	}
+	if ext := sh.Extension(ExtensionKeyShare); ext != nil && len(ext.Data) >= 2 {
+		sh.SelectedGroup = binary.BigEndian.Uint16(ext.Data)
+	}
+	if ext := sh.Extension(ExtensionALPN); ext != nil {
+		alpn := &reader{data: ext.Data}
+		list := &reader{data: alpn.vec16()}
+		if proto := list.vec8(); !alpn.err && !list.err {
+			sh.ALPN = string(proto)
+		}
+	}
+	return sh, nil
+}
+
+// ReadRecord reads a single TLS record and returns its type and fragment.
+func ReadRecord(r io.Reader) (uint8, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if header[1] != 3 {
+		return 0, nil, ErrNotTLS
+	}
+	fragment := make([]byte, int(binary.BigEndian.Uint16(header[3:])))
+	if _, err := io.ReadFull(r, fragment); err != nil {
+		return 0, nil, err
+	}
+	return header[0], fragment, nil
+}
+
+// HandshakeReader reads successive handshake messages, which may be split
+// across or packed into records. Messages are read in plaintext until
+// SetProtection is called.
+type HandshakeReader struct {
+	r          io.Reader
+	buffered   []byte
+	protection *RecordProtection
+}
+
+// NewHandshakeReader returns a HandshakeReader reading records from r.
+func NewHandshakeReader(r io.Reader) *HandshakeReader {
+	return &HandshakeReader{r: r}
+}
+
+// Next returns the type and body of the next handshake message. Alert
+// records are returned as *AlertError.
+func (hr *HandshakeReader) Next() (uint8, []byte, error) {
+	for {
+		if len(hr.buffered) >= 4 {
+			length := int(hr.buffered[1])<<16 | int(hr.buffered[2])<<8 | int(hr.buffered[3])
+			if len(hr.buffered) >= 4+length {
+				msgType, body := hr.buffered[0], hr.buffered[4:4+length]
+				hr.buffered = hr.buffered[4+length:]
+				return msgType, body, nil
+			}
+		}
+		recordType, fragment, err := ReadRecord(hr.r)
+		if err != nil {
+			return 0, nil, err
+		}
+		if hr.protection != nil {
+			switch recordType {
+			case RecordTypeChangeCipherSpec:
+				// TLS 1.3 middlebox compatibility; ignored.
+				continue
+			case RecordTypeApplicationData:
+				if recordType, fragment, err = hr.protection.Open(fragment); err != nil {
+					return 0, nil, err
+				}
+			default:
+				return 0, nil, fmt.Errorf("tls: unexpected plaintext record type %d", recordType)
+			}
+		}
+		switch recordType {
+		case RecordTypeAlert:
+			if len(fragment) < 2 {
+				return 0, nil, ErrMalformed
+			}
+			return 0, nil, &AlertError{Level: fragment[0], Description: fragment[1]}
+		case RecordTypeHandshake:
+			hr.buffered = append(hr.buffered, fragment...)
+		case RecordTypeApplicationData:
+			return 0, nil, errors.New("tls: unexpected application data")
+		default:
+			return 0, nil, ErrNotTLS
+		}
+	}
+}
+
+// SetProtection makes the reader decrypt the records that follow with p, as
+// after the TLS 1.3 ServerHello. Any message data already buffered was sent
+// before the key change.
+func (hr *HandshakeReader) SetProtection(p *RecordProtection) {
+	hr.protection = p
+}
+
+// ReadHandshakeMessage reads records from r until a complete handshake
+// message is available and returns its type and body. Alert records are
+// returned as *AlertError.
+func ReadHandshakeMessage(r io.Reader) (uint8, []byte, error) {
+	return NewHandshakeReader(r).Next()
+}
+
+// ReadServerHello reads the server's response to a ClientHello and parses
+// the ServerHello.
+func ReadServerHello(r io.Reader) (*ServerHello, error) {
+	msgType, body, err := ReadHandshakeMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if msgType != HandshakeTypeServerHello {
+		return nil, fmt.Errorf("tls: unexpected handshake message type %d", msgType)
+	}
+	return ParseServerHello(body)
+}
@@ -0,0 +1,130 @@
+package rawtls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// serverHelloRecord builds a ServerHello record with the given random and
+// extensions.
+func serverHelloRecord(random []byte, exts []Extension) []byte {
+	var body builder
+	body.u16(VersionTLS12)
+	body.Write(random)
+	body.vec8(nil)
+	body.u16(0x1301)
+	body.u8(0)
+	var list builder
+	for _, ext := range exts {
+		list.u16(ext.Type)
+		list.vec16(ext.Data)
+	}
+	body.vec16(list.Bytes())
+	var msg builder
+	msg.u8(HandshakeTypeServerHello)
+	msg.u24(body.Len())
+	msg.Write(body.Bytes())
+	return WrapRecords(RecordTypeHandshake, VersionTLS12, msg.Bytes())
+}
+
+func TestClientHelloMarshal(t *testing.T) {
+	ch := NewClientHello("example.com", []uint16{0x11ec, 0x001d}, nil)
+	records := ch.Records()
+	if records[0] != RecordTypeHandshake {
+		t.Fatalf("bad record type %d", records[0])
+	}
+	if int(binary.BigEndian.Uint16(records[3:5])) != len(records)-5 {
+		t.Fatalf("bad record length")
+	}
+	msg := records[5:]
+	if msg[0] != HandshakeTypeClientHello {
+		t.Fatalf("bad handshake type %d", msg[0])
+	}
+	if !bytes.Contains(msg, []byte("example.com")) {
+		t.Errorf("SNI missing from ClientHello")
+	}
+	if !bytes.Contains(msg, []byte{0, 4, 0x11, 0xec, 0, 0x1d}) {
+		t.Errorf("supported_groups missing from ClientHello")
+	}
+
+	ch.Remove(ExtensionServerName)
+	if bytes.Contains(ch.Marshal(), []byte("example.com")) {
+		t.Errorf("SNI still present after Remove")
+	}
+}
+
+func TestClientHelloPadTo(t *testing.T) {
+	ch := NewClientHello("example.com", []uint16{0x001d}, nil)
+	for _, n := range []int{300, 512, 17000} {
+		ch.PadTo(n)
+		if length := len(ch.Marshal()); length != n {
+			t.Errorf("PadTo(%d): length %d", n, length)
+		}
+	}
+	if records := ch.Records(); len(records) < 17000 || records[16384+5] != RecordTypeHandshake {
+		t.Errorf("large ClientHello not split into records")
+	}
+	ch.PadTo(10)
+	if ext := ch.Extensions[len(ch.Extensions)-1]; ext.Type != ExtensionPadding || len(ext.Data) != 0 {
+		t.Errorf("PadTo(10): unexpected padding %+v", ext)
+	}
+}
+
+func TestGREASE(t *testing.T) {
+	if GREASE(0) != 0x0a0a || GREASE(1) != 0x1a1a || GREASE(15) != 0xfafa || GREASE(16) != 0x0a0a {
+		t.Errorf("unexpected GREASE values %04x %04x %04x", GREASE(0), GREASE(1), GREASE(15))
+	}
+	for i := 0; i < 16; i++ {
+		if !IsGREASE(GREASE(i)) {
+			t.Errorf("%04x is not GREASE", GREASE(i))
+		}
+	}
+	for _, v := range []uint16{0x0a1a, 0x1301, 0x0a0b, 0x0b0b} {
+		if IsGREASE(v) {
+			t.Errorf("%04x is GREASE", v)
+		}
+	}
+}
+
+func TestReadServerHello(t *testing.T) {
+	exts := []Extension{
+		{Type: ExtensionSupportedVersions, Data: []byte{0x03, 0x04}},
+		{Type: ExtensionKeyShare, Data: []byte{0x11, 0xec}},
+	}
+	sh, err := ReadServerHello(bytes.NewReader(serverHelloRecord(helloRetryRequestRandom, exts)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sh.HelloRetryRequest {
+		t.Errorf("HelloRetryRequest not detected")
+	}
+	if sh.SelectedVersion != VersionTLS13 {
+		t.Errorf("got version %04x, expected %04x", sh.SelectedVersion, VersionTLS13)
+	}
+	if sh.SelectedGroup != 0x11ec {
+		t.Errorf("got group %04x, expected 11ec", sh.SelectedGroup)
+	}
+
+	sh, err = ReadServerHello(bytes.NewReader(serverHelloRecord(make([]byte, 32), []Extension{ALPNExtension([]string{"h2"})})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sh.HelloRetryRequest || sh.ALPN != "h2" {
+		t.Errorf("got HRR=%v ALPN=%q, expected false, h2", sh.HelloRetryRequest, sh.ALPN)
+	}
+}
+
+func TestReadAlert(t *testing.T) {
+	_, err := ReadServerHello(bytes.NewReader([]byte{RecordTypeAlert, 3, 3, 0, 2, 2, 40}))
+	alert, ok := err.(*AlertError)
+	if !ok {
+		t.Fatalf("expected *AlertError, got %v", err)
+	}
+	if AlertName(alert.Description) != "handshake_failure" {
+		t.Errorf("got alert %s", AlertName(alert.Description))
+	}
+	if _, err := ReadServerHello(bytes.NewReader([]byte("HTTP/1.1 400 Bad Request\r\n"))); err != ErrNotTLS {
+		t.Errorf("expected ErrNotTLS, got %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package rawtls
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// The TLS 1.3 support here is the minimum needed for probes that have to get
+// past the ServerHello (session tickets, PSK resumption, early data): a single
+// cipher suite and group, and no certificate verification.
+const (
+	CipherSuiteAES128GCMSHA256 = 0x1301
+	GroupX25519                = 0x001d
+)
+
+// ErrDecrypt is returned when a protected record fails authentication.
+var ErrDecrypt = errors.New("tls: record authentication failed")
+
+// GenerateX25519 returns a new X25519 private key and the corresponding
+// key_share entry.
+func GenerateX25519() ([]byte, KeyShare) {
+	private := randomBytes(32)
+	public := make([]byte, 32)
+	var priv, pub [32]byte
+	copy(priv[:], private)
+	curve25519.ScalarBaseMult(&pub, &priv)
+	copy(public, pub[:])
+	return private, KeyShare{Group: GroupX25519, KeyExchange: public}
+}
+
+// X25519SharedSecret returns the shared secret for the given private key and
+// the server's key_share.
+func X25519SharedSecret(private []byte, peer []byte) ([]byte, error) {
+	if len(peer) != 32 {
+		return nil, ErrMalformed
+	}
+	var priv, pub, shared [32]byte
+	copy(priv[:], private)
+	copy(pub[:], peer)
+	curve25519.ScalarMult(&shared, &priv, &pub)
+	if shared == [32]byte{} {
+		return nil, errors.New("tls: invalid X25519 key share")
+	}
+	return shared[:], nil
+}
+
+// ServerKeyShare returns the key exchange value from the ServerHello's
+// key_share extension.
+func (sh *ServerHello) ServerKeyShare() []byte {
+	ext := sh.Extension(ExtensionKeyShare)
+	if ext == nil {
+		return nil
+	}
+	r := &reader{data: ext.Data}
+	r.u16()
+	share := r.vec16()
+	if r.err {
+		return nil
+	}
+	return share
+}
+
+// ExpandLabel is HKDF-Expand-Label from RFC 8446, section 7.1, with SHA-256.
+func ExpandLabel(secret []byte, label string, context []byte, length int) []byte {
+	var info builder
+	info.u16(uint16(length))
+	info.vec8([]byte("tls13 " + label))
+	info.vec8(context)
+	out := make([]byte, length)
+	if _, err := hkdf.Expand(sha256.New, secret, info.Bytes()).Read(out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// FinishedMAC returns the verify_data of a Finished message (or a PSK binder)
+// computed with the given base key over the transcript hash.
+func FinishedMAC(baseKey []byte, transcriptHash []byte) []byte {
+	mac := hmac.New(sha256.New, ExpandLabel(baseKey, "finished", nil, sha256.Size))
+	mac.Write(transcriptHash)
+	return mac.Sum(nil)
+}
+
+// ResumptionPSK returns the PSK for a ticket with the given nonce.
+func ResumptionPSK(resumptionSecret []byte, nonce []byte) []byte {
+	return ExpandLabel(resumptionSecret, "resumption", nonce, sha256.Size)
+}
+
+// KeySchedule tracks the current stage secret and the transcript hash.
+type KeySchedule struct {
+	secret     []byte
+	transcript hash.Hash
+}
+
+// NewKeySchedule starts a key schedule at the early secret for the given PSK
+// (nil for a full handshake).
+func NewKeySchedule(psk []byte) *KeySchedule {
+	if psk == nil {
+		psk = make([]byte, sha256.Size)
+	}
+	return &KeySchedule{
+		secret:     hkdf.Extract(sha256.New, psk, nil),
+		transcript: sha256.New(),
+	}
+}
+
+// AddMessage adds a handshake message (including its header) to the
+// transcript.
+func (ks *KeySchedule) AddMessage(msg []byte) {
+	ks.transcript.Write(msg)
+}
+
+// TranscriptHash returns the hash of the messages added so far.
+func (ks *KeySchedule) TranscriptHash() []byte {
+	return ks.transcript.Sum(nil)
+}
+
+// DeriveSecret is Derive-Secret over the current transcript.
+func (ks *KeySchedule) DeriveSecret(label string) []byte {
+	return ExpandLabel(ks.secret, label, ks.TranscriptHash(), sha256.Size)
+}
+
+// BinderKey returns the resumption binder key; only valid at the early
+// secret stage.
+func (ks *KeySchedule) BinderKey() []byte {
+	empty := sha256.Sum256(nil)
+	return ExpandLabel(ks.secret, "res binder", empty[:], sha256.Size)
+}
+
+// Advance moves to the next stage: the handshake secret (with the (EC)DHE
+// shared secret as input) or the master secret (with nil).
+func (ks *KeySchedule) Advance(input []byte) {
+	if input == nil {
+		input = make([]byte, sha256.Size)
+	}
+	empty := sha256.Sum256(nil)
+	derived := ExpandLabel(ks.secret, "derived", empty[:], sha256.Size)
+	ks.secret = hkdf.Extract(sha256.New, input, derived)
+}
+
+// RecordProtection encrypts or decrypts TLS 1.3 records with the keys from a
+// single traffic secret.
+type RecordProtection struct {
+	aead cipher.AEAD
+	iv   []byte
+	seq  uint64
+}
+
+// NewRecordProtection returns the TLS_AES_128_GCM_SHA256 record protection
+// for a traffic secret.
+func NewRecordProtection(trafficSecret []byte) *RecordProtection {
+	block, err := aes.NewCipher(ExpandLabel(trafficSecret, "key", nil, 16))
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &RecordProtection{aead: aead, iv: ExpandLabel(trafficSecret, "iv", nil, 12)}
+}
+
+func (p *RecordProtection) nonce() []byte {
+	nonce := make([]byte, len(p.iv))
+	copy(nonce, p.iv)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], p.seq)
+	for i := range seq {
+		nonce[len(nonce)-8+i] ^= seq[i]
+	}
+	p.seq++
+	return nonce
+}
+
+// Seal returns a protected record carrying data of the given content type.
+func (p *RecordProtection) Seal(contentType uint8, data []byte) []byte {
+	plaintext := append(append([]byte{}, data...), contentType)
+	length := len(plaintext) + p.aead.Overhead()
+	header := []byte{RecordTypeApplicationData, 3, 3, byte(length >> 8), byte(length)}
+	return p.aead.Seal(header, p.nonce(), plaintext, header)
+}
+
+// Open decrypts the fragment of a protected record and returns its real
+// content type and data.
+func (p *RecordProtection) Open(fragment []byte) (uint8, []byte, error) {
+	header := []byte{RecordTypeApplicationData, 3, 3, byte(len(fragment) >> 8), byte(len(fragment))}
+	plaintext, err := p.aead.Open(nil, p.nonce(), fragment, header)
+	if err != nil {
+		return 0, nil, ErrDecrypt
+	}
+	i := len(plaintext) - 1
+	for i >= 0 && plaintext[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return 0, nil, ErrMalformed
+	}
+	return plaintext[i], plaintext[:i], nil
+}
+
+// NewSessionTicket is a TLS 1.3 NewSessionTicket message.
+type NewSessionTicket struct {
+	Lifetime uint32
+	AgeAdd   uint32
+	Nonce    []byte
+	Ticket   []byte
+
+	// MaxEarlyData is the max_early_data_size from the early_data
+	// extension; zero if the ticket does not allow early data.
+	MaxEarlyData uint32
+}
+
+// ParseNewSessionTicket parses the body of a NewSessionTicket message.
+func ParseNewSessionTicket(body []byte) (*NewSessionTicket, error) {
+	r := &reader{data: body}
+	ticket := new(NewSessionTicket)
+	if b := r.bytes(8); b != nil {
+		ticket.Lifetime = binary.BigEndian.Uint32(b)
+		ticket.AgeAdd = binary.BigEndian.Uint32(b[4:])
+	}
+	ticket.Nonce = r.vec8()
+	ticket.Ticket = r.vec16()
+	exts := &reader{data: r.vec16()}
+	for len(exts.data) > 0 && !exts.err {
+		extType, data := exts.u16(), exts.vec16()
+		if extType == ExtensionEarlyData && len(data) == 4 {
+			ticket.MaxEarlyData = binary.BigEndian.Uint32(data)
+		}
+	}
+	if r.err || exts.err || len(ticket.Ticket) == 0 {
+		return nil, ErrMalformed
+	}
+	return ticket, nil
+}
+
+// PreSharedKeyExtension returns a pre_shared_key extension offering a single
+// ticket, with a zeroed binder to be filled in by SetBinder. It must be the
+// last extension in the ClientHello.
+func PreSharedKeyExtension(ticket []byte, obfuscatedAge uint32) Extension {
+	var identities builder
+	identities.vec16(ticket)
+	identities.u16(uint16(obfuscatedAge >> 16))
+	identities.u16(uint16(obfuscatedAge))
+	var binders builder
+	binders.vec8(make([]byte, sha256.Size))
+	var b builder
+	b.vec16(identities.Bytes())
+	b.vec16(binders.Bytes())
+	return Extension{Type: ExtensionPreSharedKey, Data: b.Bytes()}
+}
+
+// SetBinder computes the PSK binder of a marshaled ClientHello ending in a
+// PreSharedKeyExtension and writes it in place.
+func SetBinder(clientHello []byte, binderKey []byte) {
+	binders := 2 + 1 + sha256.Size
+	truncated := sha256.Sum256(clientHello[:len(clientHello)-binders])
+	copy(clientHello[len(clientHello)-sha256.Size:], FinishedMAC(binderKey, truncated[:]))
+}
+
+// ParseEncryptedExtensions parses the body of an EncryptedExtensions
+// message.
+func ParseEncryptedExtensions(body []byte) ([]Extension, error) {
+	r := &reader{data: body}
+	exts := &reader{data: r.vec16()}
+	var ret []Extension
+	for len(exts.data) > 0 && !exts.err {
+		ret = append(ret, Extension{Type: exts.u16(), Data: exts.vec16()})
+	}
+	if r.err || exts.err {
+		return nil, ErrMalformed
+	}
+	return ret, nil
+}
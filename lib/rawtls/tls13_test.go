@@ -0,0 +1,87 @@
+package rawtls
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// The expected values are from the "Simple 1-RTT Handshake" trace in RFC 8448.
+func TestKeySchedule(t *testing.T) {
+	ks := NewKeySchedule(nil)
+	if want := unhex("33ad0a1c607ec03b09e6cd9893680ce210adf300aa1f2660e1b22e10f170f92a"); !bytes.Equal(ks.secret, want) {
+		t.Errorf("wrong early secret: %x", ks.secret)
+	}
+	ks.Advance(unhex("8bd4054fb55b9d63fdfbacf9f04b9f0d35e6d63f537563efd46272900f89492d"))
+	if want := unhex("1dc826e93606aa6fdc0aadc12f741b01046aa6b99f691ed221a9f0ca043fbeac"); !bytes.Equal(ks.secret, want) {
+		t.Errorf("wrong handshake secret: %x", ks.secret)
+	}
+}
+
+func TestRecordProtection(t *testing.T) {
+	secret := bytes.Repeat([]byte{7}, 32)
+	client, server := NewRecordProtection(secret), NewRecordProtection(secret)
+	for _, msg := range []string{"first", "second"} {
+		record := client.Seal(RecordTypeHandshake, []byte(msg))
+		if record[0] != RecordTypeApplicationData || int(record[3])<<8|int(record[4]) != len(record)-5 {
+			t.Fatalf("bad record header: %x", record[:5])
+		}
+		contentType, data, err := server.Open(record[5:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != RecordTypeHandshake || string(data) != msg {
+			t.Errorf("got type %d data %q", contentType, data)
+		}
+	}
+	record := client.Seal(RecordTypeHandshake, []byte("tampered"))
+	record[len(record)-1] ^= 1
+	if _, _, err := server.Open(record[5:]); err != ErrDecrypt {
+		t.Errorf("tampered record: got %v", err)
+	}
+}
+
+func TestX25519(t *testing.T) {
+	a, shareA := GenerateX25519()
+	b, shareB := GenerateX25519()
+	secretA, err := X25519SharedSecret(a, shareB.KeyExchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretB, err := X25519SharedSecret(b, shareA.KeyExchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secretA, secretB) {
+		t.Error("shared secrets differ")
+	}
+}
+
+func TestNewSessionTicket(t *testing.T) {
+	var body builder
+	body.Write([]byte{0, 0, 0x1c, 0x20, 1, 2, 3, 4})
+	body.vec8([]byte{0})
+	body.vec16([]byte("ticket"))
+	var exts builder
+	exts.u16(ExtensionEarlyData)
+	exts.vec16([]byte{0, 0, 0x40, 0})
+	body.vec16(exts.Bytes())
+	ticket, err := ParseNewSessionTicket(body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Lifetime != 7200 || ticket.AgeAdd != 0x01020304 || string(ticket.Ticket) != "ticket" || ticket.MaxEarlyData != 0x4000 {
+		t.Errorf("wrong ticket: %+v", ticket)
+	}
+	if _, err := ParseNewSessionTicket(body.Bytes()[:10]); err != ErrMalformed {
+		t.Errorf("truncated ticket: got %v", err)
+	}
+}
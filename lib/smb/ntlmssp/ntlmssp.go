@@ -255,6 +255,32 @@ func NewAuthenticateHash(domain, user, workstation, hash string, c Challenge) Au
 	return newAuthenticate(domain, user, workstation, buf, buf, c)
 }
 
+// NewAuthenticateAnonymous returns the message of an anonymous (null
+// session) authentication: no user, no domain, an empty NT response and a
+// single zero byte as LM response ([MS-NLMP] 3.2.5.1.2).
+func NewAuthenticateAnonymous(workstation string) Authenticate {
+	return Authenticate{
+		Header: Header{
+			Signature:   []byte(Signature),
+			MessageType: TypeNtLmAuthenticate,
+		},
+		DomainName:  []byte{},
+		UserName:    []byte{},
+		Workstation: encoder.ToUnicode(workstation),
+		NegotiateFlags: FlgNeg56 |
+			FlgNeg128 |
+			FlgNegTargetInfo |
+			FlgNegExtendedSessionSecurity |
+			FlgNegAnonymous |
+			FlgNegNtLm |
+			FlgNegRequestTarget |
+			FlgNegUnicode,
+		EncryptedRandomSessionKey: []byte{},
+		NtChallengeResponse:       []byte{},
+		LmChallengeResponse:       []byte{0},
+	}
+}
+
 func newAuthenticate(domain, user, workstation string, nthash, lmhash []byte, c Challenge) Authenticate {
 	// Assumes domain, user, and workstation are not unicode
 	var timestamp []byte
@@ -0,0 +1,255 @@
+package smb
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/Positive-Engineer/zgrab2/lib/smb/smb/encoder"
+)
+
+// SMB1 security mode flags of the negotiate response ([MS-CIFS] 2.2.4.52.2).
+const (
+	securityModeV1SigningEnabled  = 0x04
+	securityModeV1SigningRequired = 0x08
+)
+
+// SMB 3.1.1 negotiate context types ([MS-SMB2] 2.2.3.1).
+const (
+	contextPreauthIntegrity uint16 = 1
+	contextEncryption       uint16 = 2
+)
+
+// hashSHA512 is the preauthentication integrity hash algorithm of SMB 3.1.1.
+const hashSHA512 uint16 = 1
+
+// cipherNames names the ciphers of the SMB 3.1.1 encryption context.
+var cipherNames = map[uint16]string{
+	1: "AES-128-CCM",
+	2: "AES-128-GCM",
+	3: "AES-256-CCM",
+	4: "AES-256-GCM",
+}
+
+// clientCapabilities are the capabilities offered in the dialect probes, so
+// that the server reports encryption support for SMB 3.0 and 3.0.2.
+const clientCapabilities = SMB2_CAP_DFS | SMB2_CAP_LEASING | SMB2_CAP_LARGE_MTU | SMB2_CAP_ENCRYPTION
+
+// dialectNames lists the probed dialects, from SMB 1.0 up.
+var dialectNames = []struct {
+	dialect uint16
+	name    string
+}{
+	{0, "SMB 1.0"},
+	{DialectSmb_2_0_2, "SMB 2.0.2"},
+	{DialectSmb_2_1, "SMB 2.1"},
+	{DialectSmb_3_0, "SMB 3.0"},
+	{DialectSmb_3_0_2, "SMB 3.0.2"},
+	{DialectSmb_3_1_1, "SMB 3.1.1"},
+}
+
+// DialectLog is the server's response to a Negotiate request offering a
+// single dialect.
+type DialectLog struct {
+	// Dialect is the offered dialect, e.g. "SMB 3.1.1".
+	Dialect string `json:"dialect"`
+
+	// Supported is true if the server selected the dialect.
+	Supported bool `json:"supported"`
+
+	// Status is the NT status of the response, if not OK.
+	Status uint32 `json:"status,omitempty"`
+
+	SigningEnabled  bool `json:"signing_enabled,omitempty"`
+	SigningRequired bool `json:"signing_required,omitempty"`
+
+	// EncryptionSupported is true if the server supports encryption with
+	// the dialect (SMB 3.x only).
+	EncryptionSupported bool `json:"encryption_supported,omitempty"`
+
+	// EncryptionCiphers are the ciphers selected by the server in the SMB
+	// 3.1.1 encryption context.
+	EncryptionCiphers []string `json:"encryption_ciphers,omitempty"`
+
+	// Error is set if the negotiation failed, e.g. if the server closed the
+	// connection.
+	Error string `json:"error,omitempty"`
+}
+
+// NegotiateDialects offers each dialect from SMB 1.0 to SMB 3.1.1 on its own
+// connection, opened with open, and returns the responses.
+func NegotiateDialects(open func() (net.Conn, error), debug bool) []*DialectLog {
+	ret := make([]*DialectLog, 0, len(dialectNames))
+	for _, dialect := range dialectNames {
+		log := &DialectLog{Dialect: dialect.name}
+		ret = append(ret, log)
+		conn, err := open()
+		if err != nil {
+			log.Error = err.Error()
+			continue
+		}
+		s := newLoggedSession(conn, debug)
+		if dialect.dialect == 0 {
+			err = s.negotiateDialectV1(log)
+		} else {
+			err = s.negotiateDialect(dialect.dialect, log)
+		}
+		if err != nil {
+			log.Error = err.Error()
+		}
+		conn.Close()
+	}
+	return ret
+}
+
+// negotiateDialectV1 offers the NT LM 0.12 dialect of SMB1.
+func (s *Session) negotiateDialectV1(log *DialectLog) error {
+	buf, err := s.send(s.NewNegotiateReqV1())
+	if err != nil {
+		return err
+	}
+	if string(buf[0:4]) == ProtocolSmb2 {
+		// An SMB2-only server may answer with its own negotiate response.
+		return nil
+	}
+	if len(buf) < 33 {
+		return errors.New("invalid SMB1 negotiate response")
+	}
+	if status := binary.LittleEndian.Uint32(buf[5:9]); status != StatusOk {
+		log.Status = status
+		return nil
+	}
+	// The header is followed by the WordCount and, for NT LM 0.12, the
+	// DialectIndex and SecurityMode.
+	if buf[32] < 17 || len(buf) < 36 || binary.LittleEndian.Uint16(buf[33:35]) != 0 {
+		return nil
+	}
+	log.Supported = true
+	log.SigningEnabled = buf[35]&securityModeV1SigningEnabled != 0
+	log.SigningRequired = buf[35]&securityModeV1SigningRequired != 0
+	return nil
+}
+
+// newNegotiateContext returns a negotiate context.
+func newNegotiateContext(contextType uint16, data []byte) []byte {
+	ret := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint16(ret, contextType)
+	binary.LittleEndian.PutUint16(ret[2:], uint16(len(data)))
+	return append(ret, data...)
+}
+
+// pad8 pads buf with zeros to a multiple of 8 bytes.
+func pad8(buf []byte) []byte {
+	for len(buf)%8 != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// newDialectNegotiateReq returns a Negotiate request offering only the given
+// dialect; for SMB 3.1.1, with the preauthentication integrity and
+// encryption contexts.
+func (s *Session) newDialectNegotiateReq(dialect uint16) ([]byte, error) {
+	req := s.NewNegotiateReq()
+	req.Dialects = []uint16{dialect}
+	req.DialectCount = 1
+	req.Capabilities = clientCapabilities
+	if _, err := rand.Read(req.ClientGuid); err != nil {
+		return nil, err
+	}
+	if dialect != DialectSmb_3_1_1 {
+		return encoder.Marshal(req)
+	}
+	// The contexts start 8-byte aligned after the 64-byte header, the
+	// 36-byte request and the dialect; ClientStartTime holds their offset
+	// and count.
+	const contextOffset = (64 + 36 + 2 + 7) &^ 7
+	req.ClientStartTime = contextOffset | 2<<32
+	buf, err := encoder.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	buf = pad8(buf)
+	preauth := make([]byte, 6+32)
+	binary.LittleEndian.PutUint16(preauth, 1)      // HashAlgorithmCount
+	binary.LittleEndian.PutUint16(preauth[2:], 32) // SaltLength
+	binary.LittleEndian.PutUint16(preauth[4:], hashSHA512)
+	if _, err := rand.Read(preauth[6:]); err != nil {
+		return nil, err
+	}
+	// CipherCount and the ciphers, GCM first.
+	encryption := []byte{4, 0, 2, 0, 1, 0, 4, 0, 3, 0}
+	buf = pad8(append(buf, newNegotiateContext(contextPreauthIntegrity, preauth)...))
+	return append(buf, newNegotiateContext(contextEncryption, encryption)...), nil
+}
+
+// negotiateDialect offers a single SMB2 dialect.
+func (s *Session) negotiateDialect(dialect uint16, log *DialectLog) error {
+	req, err := s.newDialectNegotiateReq(dialect)
+	if err != nil {
+		return err
+	}
+	buf, err := s.send(req)
+	if err != nil {
+		return err
+	}
+	return parseDialectNegotiateRes(buf, dialect, log)
+}
+
+// parseDialectNegotiateRes fills log from an SMB2 Negotiate response.
+func parseDialectNegotiateRes(buf []byte, dialect uint16, log *DialectLog) error {
+	if string(buf[0:4]) != ProtocolSmb2 || len(buf) < 72 {
+		return errors.New("invalid SMB2 negotiate response")
+	}
+	if status := binary.LittleEndian.Uint32(buf[8:12]); status != StatusOk {
+		log.Status = status
+		return nil
+	}
+	if len(buf) < 128 {
+		return errors.New("SMB2 negotiate response too short")
+	}
+	if binary.LittleEndian.Uint16(buf[68:70]) != dialect {
+		return nil
+	}
+	log.Supported = true
+	securityMode := binary.LittleEndian.Uint16(buf[66:68])
+	log.SigningEnabled = securityMode&SecurityModeSigningEnabled != 0
+	log.SigningRequired = securityMode&SecurityModeSigningRequired != 0
+	switch dialect {
+	case DialectSmb_3_0, DialectSmb_3_0_2:
+		log.EncryptionSupported = binary.LittleEndian.Uint32(buf[88:92])&SMB2_CAP_ENCRYPTION != 0
+	case DialectSmb_3_1_1:
+		count := int(binary.LittleEndian.Uint16(buf[70:72]))
+		offset := int(binary.LittleEndian.Uint32(buf[124:128]))
+		for i := 0; i < count; i++ {
+			if offset+8 > len(buf) {
+				return errors.New("invalid negotiate context")
+			}
+			contextType := binary.LittleEndian.Uint16(buf[offset:])
+			length := int(binary.LittleEndian.Uint16(buf[offset+2:]))
+			if offset+8+length > len(buf) {
+				return errors.New("invalid negotiate context")
+			}
+			data := buf[offset+8 : offset+8+length]
+			if contextType == contextEncryption && len(data) >= 2 {
+				for j := 0; j < int(binary.LittleEndian.Uint16(data)) && 4+2*j <= len(data); j++ {
+					cipher := binary.LittleEndian.Uint16(data[2+2*j:])
+					if cipher == 0 {
+						// No common cipher.
+						continue
+					}
+					name, ok := cipherNames[cipher]
+					if !ok {
+						name = fmt.Sprintf("0x%04x", cipher)
+					}
+					log.EncryptionCiphers = append(log.EncryptionCiphers, name)
+				}
+			}
+			offset = (offset + 8 + length + 7) &^ 7
+		}
+		log.EncryptionSupported = len(log.EncryptionCiphers) > 0
+	}
+	return nil
+}
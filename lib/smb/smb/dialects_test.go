@@ -0,0 +1,158 @@
+package smb
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestDialectNegotiateReq(t *testing.T) {
+	s := newLoggedSession(nil, false)
+	buf, err := s.newDialectNegotiateReq(DialectSmb_3_1_1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := binary.LittleEndian.Uint16(buf[66:]); count != 1 {
+		t.Errorf("dialect count %d", count)
+	}
+	if dialect := binary.LittleEndian.Uint16(buf[100:]); dialect != DialectSmb_3_1_1 {
+		t.Errorf("dialect 0x%x", dialect)
+	}
+	offset := int(binary.LittleEndian.Uint32(buf[92:]))
+	if offset != 104 || binary.LittleEndian.Uint16(buf[96:]) != 2 {
+		t.Fatalf("context offset %d, count %d", offset, binary.LittleEndian.Uint16(buf[96:]))
+	}
+	if contextType := binary.LittleEndian.Uint16(buf[offset:]); contextType != contextPreauthIntegrity {
+		t.Errorf("first context type %d", contextType)
+	}
+	// 8 + 38 bytes of the preauth context, padded to 48.
+	if contextType := binary.LittleEndian.Uint16(buf[offset+48:]); contextType != contextEncryption || len(buf) != offset+48+8+10 {
+		t.Errorf("second context type %d, request length %d", contextType, len(buf))
+	}
+
+	buf, err = s.newDialectNegotiateReq(DialectSmb_2_0_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != 102 || binary.LittleEndian.Uint16(buf[100:]) != DialectSmb_2_0_2 {
+		t.Errorf("unexpected SMB 2.0.2 request % x", buf)
+	}
+}
+
+// negotiateResponse returns an SMB2 Negotiate response body selecting the
+// dialect, followed by the negotiate contexts.
+func negotiateResponse(dialect uint16, securityMode uint16, capabilities uint32, contexts ...[]byte) []byte {
+	body := make([]byte, 64)
+	binary.LittleEndian.PutUint16(body, 65)
+	binary.LittleEndian.PutUint16(body[2:], securityMode)
+	binary.LittleEndian.PutUint16(body[4:], dialect)
+	binary.LittleEndian.PutUint16(body[6:], uint16(len(contexts)))
+	binary.LittleEndian.PutUint32(body[24:], capabilities)
+	binary.LittleEndian.PutUint32(body[60:], 128)
+	for _, context := range contexts {
+		body = append(pad8(body), context...)
+	}
+	return body
+}
+
+func TestParseDialectNegotiateRes(t *testing.T) {
+	tests := []struct {
+		dialect  uint16
+		response []byte
+		expected DialectLog
+	}{
+		{
+			DialectSmb_2_1,
+			smb2Response(CommandNegotiate, StatusOk, negotiateResponse(DialectSmb_2_1, SecurityModeSigningEnabled|SecurityModeSigningRequired, 0)),
+			DialectLog{Supported: true, SigningEnabled: true, SigningRequired: true},
+		},
+		{
+			DialectSmb_3_0,
+			smb2Response(CommandNegotiate, StatusOk, negotiateResponse(DialectSmb_3_0, SecurityModeSigningEnabled, SMB2_CAP_ENCRYPTION)),
+			DialectLog{Supported: true, SigningEnabled: true, EncryptionSupported: true},
+		},
+		{
+			DialectSmb_3_1_1,
+			smb2Response(CommandNegotiate, StatusOk, negotiateResponse(DialectSmb_3_1_1, SecurityModeSigningEnabled, 0,
+				newNegotiateContext(contextPreauthIntegrity, make([]byte, 38)),
+				newNegotiateContext(contextEncryption, []byte{1, 0, 2, 0}))),
+			DialectLog{Supported: true, SigningEnabled: true, EncryptionSupported: true, EncryptionCiphers: []string{"AES-128-GCM"}},
+		},
+		{
+			DialectSmb_2_0_2,
+			smb2Response(CommandNegotiate, StatusNotSupported, make([]byte, 9)),
+			DialectLog{Status: StatusNotSupported},
+		},
+	}
+	for _, test := range tests {
+		var log DialectLog
+		// Strip the NetBIOS frame.
+		if err := parseDialectNegotiateRes(test.response[4:], test.dialect, &log); err != nil {
+			t.Errorf("dialect 0x%x: %v", test.dialect, err)
+		}
+		if !reflect.DeepEqual(log, test.expected) {
+			t.Errorf("dialect 0x%x: got %+v, expected %+v", test.dialect, log, test.expected)
+		}
+	}
+}
+
+func TestCheckShareAccess(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		for {
+			var size uint32
+			if err := binary.Read(server, binary.BigEndian, &size); err != nil {
+				return
+			}
+			msg := make([]byte, size)
+			if _, err := io.ReadFull(server, msg); err != nil {
+				return
+			}
+			switch command := binary.LittleEndian.Uint16(msg[12:]); command {
+			case CommandTreeConnect:
+				// Path is \\host\<name>; the first two shares are
+				// readable, the third is refused.
+				name := string(msg[len(msg)-2:])
+				switch name {
+				case "a\x00":
+					body := make([]byte, 16)
+					binary.LittleEndian.PutUint16(body, 16)
+					body[2] = ShareTypeDisk
+					binary.LittleEndian.PutUint32(body[4:], ShareFlagEncryptData)
+					binary.LittleEndian.PutUint32(body[12:], 0x001200a9)
+					server.Write(smb2Response(command, StatusOk, body))
+				case "b\x00":
+					body := make([]byte, 16)
+					binary.LittleEndian.PutUint16(body, 16)
+					binary.LittleEndian.PutUint32(body[12:], 0x001f01ff)
+					server.Write(smb2Response(command, StatusOk, body))
+				default:
+					server.Write(smb2Response(command, StatusAccessDenied, make([]byte, 9)))
+				}
+			case CommandTreeDisconnect:
+				server.Write(smb2Response(command, StatusOk, []byte{4, 0, 0, 0}))
+			}
+		}
+	}()
+
+	s := newLoggedSession(client, false)
+	s.options.Host = "h"
+	expected := []ShareAccess{
+		{Name: "a", Type: "disk", Access: ShareAccessRead, MaximalAccess: 0x001200a9, EncryptData: true},
+		{Name: "b", Type: "disk", Access: ShareAccessReadWrite, MaximalAccess: 0x001f01ff},
+		{Name: "c", Type: "disk", Access: ShareAccessDenied},
+	}
+	for _, want := range expected {
+		got, err := s.checkShareAccess(share{Name: want.Name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("got %+v, expected %+v", *got, want)
+		}
+	}
+}
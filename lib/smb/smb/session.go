@@ -351,24 +351,36 @@ func (s *Session) send(req interface{}) (res []byte, err error) {
 		return
 	}
 
-	rw := bufio.NewReadWriter(bufio.NewReader(s.conn), bufio.NewWriter(s.conn))
-	if _, err = rw.Write(append(b.Bytes(), buf...)); err != nil {
+	w := bufio.NewWriter(s.conn)
+	if _, err = w.Write(append(b.Bytes(), buf...)); err != nil {
 		s.Debug("", err)
 		return
 	}
-	rw.Flush()
+	w.Flush()
 
+	data, err := s.recv()
+	if err != nil {
+		return nil, err
+	}
+	s.messageID++
+	return data, nil
+}
+
+// recv reads the next message from the server. It reads no further than
+// the message, so that a later message (e.g. the final response following
+// an interim one) is left on the connection.
+func (s *Session) recv() ([]byte, error) {
 	var size uint32
-	if err = binary.Read(rw, binary.BigEndian, &size); err != nil {
+	if err := binary.Read(s.conn, binary.BigEndian, &size); err != nil {
 		s.Debug("", err)
-		return
+		return nil, err
 	}
 	if size > 0x00FFFFFF || size < 4 {
 		return nil, errors.New("Invalid NetBIOS Session message")
 	}
 
 	data := make([]byte, size)
-	l, err := io.ReadFull(rw, data)
+	l, err := io.ReadFull(s.conn, data)
 	if err != nil {
 		s.Debug("", err)
 		return nil, err
@@ -384,7 +396,5 @@ func (s *Session) send(req interface{}) (res []byte, err error) {
 	case ProtocolSmb:
 	case ProtocolSmb2:
 	}
-
-	s.messageID++
 	return data, nil
 }
@@ -0,0 +1,640 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"unicode/utf16"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/smb/ntlmssp"
+	"github.com/Positive-Engineer/zgrab2/lib/smb/smb/encoder"
+)
+
+// DCE/RPC packet types ([C706] 12.6.4).
+const (
+	rpcRequest  uint8 = 0
+	rpcResponse uint8 = 2
+	rpcFault    uint8 = 3
+	rpcBind     uint8 = 11
+	rpcBindAck  uint8 = 12
+	rpcBindNak  uint8 = 13
+)
+
+const (
+	rpcFirstFrag uint8 = 0x01
+	rpcLastFrag  uint8 = 0x02
+)
+
+// opNetrShareEnum is the operation number of NetrShareEnum ([MS-SRVS]
+// 3.1.4.8).
+const opNetrShareEnum = 15
+
+// errorMoreData is the WERROR returned when not all shares fit.
+const errorMoreData = 234
+
+// pipeReadSize is the Length of the Read requests on the pipe, and
+// maxRPCResponse bounds the size of a reassembled RPC response.
+const (
+	pipeReadSize   = 4280
+	maxRPCResponse = 1 << 20
+)
+
+// srvsvcSyntax is the Server Service interface ([MS-SRVS]),
+// 4b324fc8-1670-01d3-1278-5a47bf6ee188 version 3.0.
+var srvsvcSyntax = []byte{
+	0xc8, 0x4f, 0x32, 0x4b, 0x70, 0x16, 0xd3, 0x01, 0x12, 0x78, 0x5a, 0x47, 0xbf, 0x6e, 0xe1, 0x88,
+	0x03, 0x00, 0x00, 0x00,
+}
+
+// ndrSyntax is the NDR transfer syntax,
+// 8a885d04-1ceb-11c9-9fe8-08002b104860 version 2.
+var ndrSyntax = []byte{
+	0x04, 0x5d, 0x88, 0x8a, 0xeb, 0x1c, 0xc9, 0x11, 0x9f, 0xe8, 0x08, 0x00, 0x2b, 0x10, 0x48, 0x60,
+	0x02, 0x00, 0x00, 0x00,
+}
+
+// shareTypes names the base types of a share ([MS-SRVS] 2.2.2.4).
+var shareTypes = map[uint32]string{
+	0: "disk",
+	1: "printer",
+	2: "device",
+	3: "ipc",
+}
+
+// Access masks of the MaximalAccess of a TreeConnect response ([MS-SMB2]
+// 2.2.13.1).
+const (
+	fileReadData   = 0x00000001
+	fileWriteData  = 0x00000002
+	fileAppendData = 0x00000004
+	genericAll     = 0x10000000
+	genericWrite   = 0x40000000
+	genericRead    = 0x80000000
+)
+
+// Access levels of a ShareAccess.
+const (
+	ShareAccessReadWrite = "read_write"
+	ShareAccessRead      = "read"
+	ShareAccessWrite     = "write"
+	ShareAccessNone      = "none"
+	ShareAccessDenied    = "denied"
+)
+
+// sessionFlagEncryptData is the SMB2_SESSION_FLAG_ENCRYPT_DATA flag of a
+// SessionSetup response.
+const sessionFlagEncryptData = 0x0004
+
+// share is a SHARE_INFO_1 entry.
+type share struct {
+	Name    string
+	Type    uint32
+	Comment string
+}
+
+// ShareAccess is a share of the server and the access of the anonymous
+// session to it.
+type ShareAccess struct {
+	Name    string `json:"name"`
+	Type    string `json:"type,omitempty"`
+	Comment string `json:"comment,omitempty"`
+
+	// Access is ShareAccessReadWrite, ShareAccessRead, ShareAccessWrite,
+	// ShareAccessNone (connected, without access to data) or
+	// ShareAccessDenied (the TreeConnect was refused).
+	Access string `json:"access,omitempty"`
+
+	// MaximalAccess is the access mask of the TreeConnect response.
+	MaximalAccess uint32 `json:"maximal_access,omitempty"`
+
+	// EncryptData is true if the share requires encryption.
+	EncryptData bool `json:"encrypt_data,omitempty"`
+
+	// Error is set if the TreeConnect failed for another reason.
+	Error string `json:"error,omitempty"`
+}
+
+// GetSMBInventory negotiates a session like GetSMBLog, then attempts an
+// anonymous (null session) login. If the login succeeds, the shares of
+// the server are listed over the srvsvc pipe into the Inventory of the
+// log. A server refusing the login is not an error.
+func GetSMBInventory(conn net.Conn, flags *zgrab2.InventoryFlags, debug bool) (*SMBLog, error) {
+	return getSMBShares(conn, flags, true, false, debug)
+}
+
+// EnumerateShares works like GetSMBInventory, but connects to each of the
+// listed shares (up to the configured maximum number of entries) to record
+// the access of the anonymous session in the Shares of the log. The
+// Inventory is only filled if inventory is true.
+func EnumerateShares(conn net.Conn, flags *zgrab2.InventoryFlags, inventory bool, debug bool) (*SMBLog, error) {
+	return getSMBShares(conn, flags, inventory, true, debug)
+}
+
+func getSMBShares(conn net.Conn, flags *zgrab2.InventoryFlags, inventory bool, access bool, debug bool) (*SMBLog, error) {
+	s := newLoggedSession(conn, debug)
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		s.options.Host = host
+	}
+	if err := s.LoggedNegotiateProtocol(true); err != nil {
+		return s.Log, err
+	}
+	if err := s.LoggedNullSession(); err != nil {
+		s.Debug("Null session refused: "+err.Error(), nil)
+		return s.Log, nil
+	}
+	shares, more, err := s.enumShares()
+	if inventory {
+		s.Log.Inventory = flags.NewInventory("")
+		if err != nil {
+			s.Log.Inventory.Error = err.Error()
+		} else {
+			addShares(s.Log.Inventory, shares, more)
+		}
+	}
+	if !access {
+		return s.Log, nil
+	}
+	if err != nil {
+		s.Log.SharesError = err.Error()
+		return s.Log, nil
+	}
+	for i, share := range shares {
+		if i >= flags.InventoryMaxEntries {
+			break
+		}
+		result, err := s.checkShareAccess(share)
+		s.Log.Shares = append(s.Log.Shares, result)
+		if err != nil {
+			// The connection is unusable.
+			s.Log.SharesError = err.Error()
+			break
+		}
+	}
+	return s.Log, nil
+}
+
+// LoggedNullSession completes the session setup started by
+// LoggedNegotiateProtocol(true) with an anonymous authentication.
+func (ls *LoggedSession) LoggedNullSession() error {
+	s := &ls.Session
+	s.Debug("Sending anonymous SessionSetup2 request", nil)
+	req, err := s.NewSessionSetup2Req()
+	if err != nil {
+		return err
+	}
+	token, err := encoder.Marshal(ntlmssp.NewAuthenticateAnonymous(s.options.Workstation))
+	if err != nil {
+		return err
+	}
+	req.SecurityBlob.ResponseToken = token
+	buf, err := s.send(req)
+	if err != nil {
+		return err
+	}
+	var header Header
+	if err := encoder.Unmarshal(buf, &header); err != nil {
+		return err
+	}
+	if header.Status != StatusOk {
+		return statusError(header.Status)
+	}
+	ls.Log.NullSession = true
+	// The response body starts with StructureSize and SessionFlags.
+	if len(buf) >= 68 {
+		ls.Log.SessionEncryptData = binary.LittleEndian.Uint16(buf[66:68])&sessionFlagEncryptData != 0
+	}
+	return nil
+}
+
+// ListShares calls NetrShareEnum on the srvsvc pipe of the IPC$ share, and
+// adds the shares to inv.
+func (s *Session) ListShares(inv *zgrab2.Inventory) error {
+	shares, more, err := s.enumShares()
+	if err != nil {
+		return err
+	}
+	addShares(inv, shares, more)
+	return nil
+}
+
+// enumShares calls NetrShareEnum on the srvsvc pipe of the IPC$ share.
+// more is true if the server had more shares than it returned.
+func (s *Session) enumShares() ([]share, bool, error) {
+	if err := s.TreeConnect("IPC$"); err != nil {
+		return nil, false, err
+	}
+	tree := s.trees["IPC$"]
+	fileID, err := s.openPipe(tree, "srvsvc")
+	if err != nil {
+		return nil, false, err
+	}
+	ptype, body, err := s.rpcCall(tree, fileID, newRPCBind(1))
+	if err != nil {
+		return nil, false, err
+	}
+	if ptype != rpcBindAck {
+		return nil, false, fmt.Errorf("srvsvc bind rejected (packet type %d)", ptype)
+	}
+	if err := checkBindAck(body); err != nil {
+		return nil, false, err
+	}
+	stub := newNetrShareEnumStub(`\\` + s.options.Host)
+	ptype, body, err = s.rpcCall(tree, fileID, newRPCRequest(2, opNetrShareEnum, stub))
+	if err != nil {
+		return nil, false, err
+	}
+	if ptype != rpcResponse {
+		return nil, false, fmt.Errorf("unexpected RPC packet type %d", ptype)
+	}
+	return parseNetrShareEnum(body)
+}
+
+// shareTypeName returns the name of the base type of a share.
+func shareTypeName(typ uint32) string {
+	if name, ok := shareTypes[typ&0x0fffffff]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", typ)
+}
+
+// addShares adds the shares to inv.
+func addShares(inv *zgrab2.Inventory, shares []share, more bool) {
+	for _, share := range shares {
+		if !inv.Add(zgrab2.InventoryEntry{Name: share.Name, Type: shareTypeName(share.Type), Comment: share.Comment}) {
+			break
+		}
+	}
+	if more {
+		inv.Truncated = true
+	}
+}
+
+// accessLevel returns the access level of a MaximalAccess mask.
+func accessLevel(mask uint32) string {
+	read := mask&(fileReadData|genericRead|genericAll) != 0
+	write := mask&(fileWriteData|fileAppendData|genericWrite|genericAll) != 0
+	switch {
+	case read && write:
+		return ShareAccessReadWrite
+	case read:
+		return ShareAccessRead
+	case write:
+		return ShareAccessWrite
+	}
+	return ShareAccessNone
+}
+
+// checkShareAccess connects to the share and disconnects again. A refused
+// TreeConnect is recorded in the result; the returned error is only set if
+// the connection failed.
+func (s *Session) checkShareAccess(share share) (*ShareAccess, error) {
+	ret := &ShareAccess{Name: share.Name, Type: shareTypeName(share.Type), Comment: share.Comment}
+	req, err := s.NewTreeConnectReq(share.Name)
+	if err != nil {
+		return ret, err
+	}
+	s.Debug("Sending TreeConnect request ["+share.Name+"]", nil)
+	buf, err := s.send(req)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret, err
+	}
+	var header Header
+	if err := encoder.Unmarshal(buf, &header); err != nil {
+		ret.Error = err.Error()
+		return ret, nil
+	}
+	switch header.Status {
+	case StatusOk:
+	case StatusAccessDenied:
+		ret.Access = ShareAccessDenied
+		return ret, nil
+	default:
+		ret.Error = statusError(header.Status).Error()
+		return ret, nil
+	}
+	var res TreeConnectRes
+	if err := encoder.Unmarshal(buf, &res); err != nil {
+		ret.Error = err.Error()
+		return ret, nil
+	}
+	ret.MaximalAccess = res.MaximalAccess
+	ret.Access = accessLevel(res.MaximalAccess)
+	ret.EncryptData = res.ShareFlags&ShareFlagEncryptData != 0
+	disconnect, err := s.NewTreeDisconnectReq(res.Header.TreeID)
+	if err != nil {
+		return ret, err
+	}
+	_, err = s.send(disconnect)
+	return ret, err
+}
+
+// statusError returns the error for an NT status.
+func statusError(status uint32) error {
+	if name, ok := StatusMap[status]; ok {
+		return errors.New("NT Status Error: " + name)
+	}
+	return fmt.Errorf("NT Status Error: 0x%08x", status)
+}
+
+// responseHeader returns the header of a response, or an error if its
+// status is not one of allowed (StatusOk if none).
+func responseHeader(buf []byte, allowed ...uint32) (*Header, error) {
+	header := new(Header)
+	if err := encoder.Unmarshal(buf, header); err != nil {
+		return nil, err
+	}
+	if len(allowed) == 0 {
+		allowed = []uint32{StatusOk}
+	}
+	for _, status := range allowed {
+		if header.Status == status {
+			return header, nil
+		}
+	}
+	return nil, statusError(header.Status)
+}
+
+// openPipe opens a named pipe of the tree, and returns its file ID.
+func (s *Session) openPipe(tree uint32, name string) ([]byte, error) {
+	s.Debug("Sending Create request ["+name+"]", nil)
+	buf, err := s.send(s.NewCreateReq(tree, name))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := responseHeader(buf); err != nil {
+		return nil, err
+	}
+	var res CreateRes
+	if err := encoder.Unmarshal(buf, &res); err != nil {
+		return nil, err
+	}
+	return res.FileID, nil
+}
+
+// readPipe reads the next chunk of data from a pipe, waiting for the final
+// response if the server answers STATUS_PENDING.
+func (s *Session) readPipe(tree uint32, fileID []byte) ([]byte, error) {
+	buf, err := s.send(s.NewReadReq(tree, fileID, pipeReadSize))
+	for err == nil {
+		var header *Header
+		if header, err = responseHeader(buf, StatusOk, StatusBufferOverflow, StatusPending); err != nil {
+			return nil, err
+		}
+		if header.Status != StatusPending {
+			break
+		}
+		buf, err = s.recv()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The Read response: StructureSize, DataOffset (1 byte), Reserved,
+	// DataLength, DataRemaining, Reserved2, Buffer.
+	if len(buf) < 80 {
+		return nil, errors.New("Read response too short")
+	}
+	offset := int(buf[66])
+	length := int(binary.LittleEndian.Uint32(buf[68:72]))
+	if offset+length > len(buf) || offset < 80 && length > 0 {
+		return nil, errors.New("Invalid Read response data")
+	}
+	return buf[offset : offset+length], nil
+}
+
+// rpcCall writes a DCE/RPC PDU to the pipe and reads the answer. It
+// returns the packet type and, for a response, the reassembled stub data
+// of all fragments, or else the body of the PDU after the common header.
+func (s *Session) rpcCall(tree uint32, fileID []byte, pdu []byte) (uint8, []byte, error) {
+	buf, err := s.send(s.NewWriteReq(tree, fileID, pdu))
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := responseHeader(buf); err != nil {
+		return 0, nil, err
+	}
+	var data, stub []byte
+	for {
+		chunk, err := s.readPipe(tree, fileID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(chunk) == 0 {
+			return 0, nil, errors.New("empty read from pipe")
+		}
+		data = append(data, chunk...)
+		if len(data)+len(stub) > maxRPCResponse {
+			return 0, nil, errors.New("RPC response too large")
+		}
+		for len(data) >= 16 {
+			fragLength := int(binary.LittleEndian.Uint16(data[8:10]))
+			authLength := int(binary.LittleEndian.Uint16(data[10:12]))
+			if fragLength < 16 {
+				return 0, nil, errors.New("invalid RPC fragment length")
+			}
+			if len(data) < fragLength {
+				break
+			}
+			frag := data[:fragLength]
+			data = data[fragLength:]
+			switch ptype := frag[2]; ptype {
+			case rpcResponse:
+				if fragLength < 24+authLength {
+					return 0, nil, errors.New("invalid RPC response fragment")
+				}
+				stub = append(stub, frag[24:fragLength-authLength]...)
+				if frag[3]&rpcLastFrag != 0 {
+					return ptype, stub, nil
+				}
+			case rpcFault:
+				if fragLength < 28 {
+					return 0, nil, errors.New("invalid RPC fault")
+				}
+				return 0, nil, fmt.Errorf("RPC fault 0x%08x", binary.LittleEndian.Uint32(frag[24:28]))
+			default:
+				return ptype, frag[16:], nil
+			}
+		}
+	}
+}
+
+// newRPCHeader returns the common header of a connection-oriented PDU with
+// little-endian, ASCII and IEEE float data representation.
+func newRPCHeader(ptype uint8, fragLength int, callID uint32) []byte {
+	header := []byte{5, 0, ptype, rpcFirstFrag | rpcLastFrag, 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint16(header[8:], uint16(fragLength))
+	binary.LittleEndian.PutUint32(header[12:], callID)
+	return header
+}
+
+// newRPCBind returns a bind PDU for the srvsvc interface with the NDR
+// transfer syntax.
+func newRPCBind(callID uint32) []byte {
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.LittleEndian, []uint16{pipeReadSize, pipeReadSize})
+	binary.Write(body, binary.LittleEndian, uint32(0)) // assoc_group_id
+	body.Write([]byte{1, 0, 0, 0})                     // n_context_elem
+	body.Write([]byte{0, 0, 1, 0})                     // p_cont_id, n_transfer_syn
+	body.Write(srvsvcSyntax)
+	body.Write(ndrSyntax)
+	return append(newRPCHeader(rpcBind, 16+body.Len(), callID), body.Bytes()...)
+}
+
+// checkBindAck checks that the first presentation context of a bind_ack
+// body was accepted.
+func checkBindAck(body []byte) error {
+	if len(body) < 10 {
+		return errors.New("bind_ack too short")
+	}
+	// The secondary address follows its length, padded to 4 bytes.
+	pos := 10 + int(binary.LittleEndian.Uint16(body[8:10]))
+	pos = (pos + 3) &^ 3
+	if len(body) < pos+6 || body[pos] == 0 {
+		return errors.New("bind_ack has no results")
+	}
+	if result := binary.LittleEndian.Uint16(body[pos+4:]); result != 0 {
+		return fmt.Errorf("srvsvc bind rejected (result %d)", result)
+	}
+	return nil
+}
+
+// newRPCRequest returns a request PDU for the first presentation context.
+func newRPCRequest(callID uint32, opnum uint16, stub []byte) []byte {
+	body := make([]byte, 8, 8+len(stub))
+	binary.LittleEndian.PutUint32(body, uint32(len(stub))) // alloc_hint
+	binary.LittleEndian.PutUint16(body[6:], opnum)
+	body = append(body, stub...)
+	return append(newRPCHeader(rpcRequest, 16+len(body), callID), body...)
+}
+
+// ndrWriter encodes NDR data.
+type ndrWriter struct {
+	bytes.Buffer
+}
+
+func (w *ndrWriter) align(n int) {
+	for w.Len()%n != 0 {
+		w.WriteByte(0)
+	}
+}
+
+func (w *ndrWriter) uint32(v uint32) {
+	w.align(4)
+	binary.Write(w, binary.LittleEndian, v)
+}
+
+// string writes a conformant varying, NUL-terminated UTF-16 string.
+func (w *ndrWriter) string(s string) {
+	chars := append(utf16.Encode([]rune(s)), 0)
+	w.uint32(uint32(len(chars)))
+	w.uint32(0)
+	w.uint32(uint32(len(chars)))
+	binary.Write(w, binary.LittleEndian, chars)
+}
+
+// newNetrShareEnumStub returns the stub of a NetrShareEnum request for the
+// SHARE_INFO_1 level, with no preferred maximum length.
+func newNetrShareEnumStub(server string) []byte {
+	w := new(ndrWriter)
+	w.uint32(0x00020000) // ServerName
+	w.string(server)
+	w.uint32(1)          // Level
+	w.uint32(1)          // ShareInfo union switch
+	w.uint32(0x00020004) // SHARE_INFO_1_CONTAINER
+	w.uint32(0)          // EntriesRead
+	w.uint32(0)          // Buffer
+	w.uint32(0xffffffff) // PreferedMaximumLength
+	w.uint32(0x00020008) // ResumeHandle
+	w.uint32(0)
+	return w.Bytes()
+}
+
+// ndrReader decodes NDR data; after an error, all reads return zero.
+type ndrReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *ndrReader) uint32() uint32 {
+	r.pos = (r.pos + 3) &^ 3
+	if r.err != nil || r.pos+4 > len(r.data) {
+		r.err = errors.New("NDR data too short")
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return v
+}
+
+// string reads a conformant varying UTF-16 string.
+func (r *ndrReader) string() string {
+	r.uint32() // maximum count
+	offset := r.uint32()
+	count := int(r.uint32())
+	if r.err != nil || offset != 0 || count > (len(r.data)-r.pos)/2 {
+		r.err = errors.New("invalid NDR string")
+		return ""
+	}
+	chars := make([]uint16, count)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(r.data[r.pos+2*i:])
+	}
+	r.pos += 2 * count
+	for len(chars) > 0 && chars[len(chars)-1] == 0 {
+		chars = chars[:len(chars)-1]
+	}
+	return string(utf16.Decode(chars))
+}
+
+// parseNetrShareEnum parses the stub of a NetrShareEnum response at the
+// SHARE_INFO_1 level. more is true if the server had more shares than it
+// returned.
+func parseNetrShareEnum(stub []byte) (shares []share, more bool, err error) {
+	r := &ndrReader{data: stub}
+	if level := r.uint32(); level != 1 && r.err == nil {
+		return nil, false, fmt.Errorf("unexpected info level %d", level)
+	}
+	r.uint32() // union switch
+	if r.uint32() != 0 {
+		count := int(r.uint32())
+		if r.uint32() != 0 {
+			r.uint32() // maximum count
+			// Each entry takes at least 12 bytes.
+			if count > (len(stub)-r.pos)/12 {
+				return nil, false, errors.New("invalid share count")
+			}
+			type pointers struct{ name, comment uint32 }
+			refs := make([]pointers, count)
+			shares = make([]share, count)
+			for i := range shares {
+				refs[i].name = r.uint32()
+				shares[i].Type = r.uint32()
+				refs[i].comment = r.uint32()
+			}
+			for i := range shares {
+				if refs[i].name != 0 {
+					shares[i].Name = r.string()
+				}
+				if refs[i].comment != 0 {
+					shares[i].Comment = r.string()
+				}
+			}
+		}
+	}
+	r.uint32() // TotalEntries
+	if r.uint32() != 0 {
+		r.uint32() // ResumeHandle
+	}
+	status := r.uint32()
+	if r.err != nil {
+		return nil, false, r.err
+	}
+	if status != 0 && status != errorMoreData {
+		return nil, false, fmt.Errorf("NetrShareEnum failed: WERROR %d", status)
+	}
+	return shares, status == errorMoreData, nil
+}
@@ -0,0 +1,199 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2/lib/smb/ntlmssp"
+	"github.com/Positive-Engineer/zgrab2/lib/smb/smb/encoder"
+)
+
+func netrShareEnumResponse(status uint32, shares ...share) []byte {
+	w := new(ndrWriter)
+	w.uint32(1)
+	w.uint32(1)
+	w.uint32(0x00020000)
+	w.uint32(uint32(len(shares)))
+	w.uint32(0x00020004)
+	w.uint32(uint32(len(shares)))
+	for i, share := range shares {
+		w.uint32(0x00020008 + uint32(i))
+		w.uint32(share.Type)
+		if share.Comment != "" {
+			w.uint32(0x00021000 + uint32(i))
+		} else {
+			w.uint32(0)
+		}
+	}
+	for _, share := range shares {
+		w.string(share.Name)
+		if share.Comment != "" {
+			w.string(share.Comment)
+		}
+	}
+	w.uint32(uint32(len(shares)))
+	w.uint32(0)
+	w.uint32(status)
+	return w.Bytes()
+}
+
+func TestParseNetrShareEnum(t *testing.T) {
+	expected := []share{
+		{Name: "IPC$", Type: 0x80000003, Comment: "Remote IPC"},
+		{Name: "public", Type: 0},
+		{Name: "Общие", Type: 0, Comment: "odd"},
+	}
+	shares, more, err := parseNetrShareEnum(netrShareEnumResponse(0, expected...))
+	if err != nil || more {
+		t.Fatalf("parse failed: %v %v", more, err)
+	}
+	if len(shares) != len(expected) {
+		t.Fatalf("got %+v", shares)
+	}
+	for i := range expected {
+		if shares[i] != expected[i] {
+			t.Errorf("share %d: got %+v, expected %+v", i, shares[i], expected[i])
+		}
+	}
+
+	if _, more, err := parseNetrShareEnum(netrShareEnumResponse(errorMoreData, expected[0])); err != nil || !more {
+		t.Errorf("ERROR_MORE_DATA: %v %v", more, err)
+	}
+	if _, _, err := parseNetrShareEnum(netrShareEnumResponse(5)); err == nil {
+		t.Error("expected an error for ERROR_ACCESS_DENIED")
+	}
+	response := netrShareEnumResponse(0, expected...)
+	if _, _, err := parseNetrShareEnum(response[:len(response)-10]); err == nil {
+		t.Error("expected an error for a truncated response")
+	}
+}
+
+func TestNetrShareEnumRequest(t *testing.T) {
+	pdu := newRPCRequest(2, opNetrShareEnum, newNetrShareEnumStub(`\\10.0.0.1`))
+	if len(pdu) != int(binary.LittleEndian.Uint16(pdu[8:10])) || pdu[2] != rpcRequest || binary.LittleEndian.Uint16(pdu[22:24]) != opNetrShareEnum {
+		t.Fatalf("bad request header % x", pdu[:24])
+	}
+	r := &ndrReader{data: pdu[24:]}
+	r.uint32()
+	if server := r.string(); server != `\\10.0.0.1` || r.err != nil {
+		t.Errorf("server name %q (%v)", server, r.err)
+	}
+	if level := r.uint32(); level != 1 {
+		t.Errorf("level %d", level)
+	}
+}
+
+func TestCheckBindAck(t *testing.T) {
+	// max_xmit_frag, max_recv_frag, assoc_group_id, secondary address
+	// "\PIPE\srvsvc" (13 bytes with the NUL), padding to 4 bytes, one
+	// result.
+	body := []byte{0xb8, 0x10, 0xb8, 0x10, 0x01, 0x02, 0x03, 0x04, 13, 0}
+	body = append(body, "\\PIPE\\srvsvc\x00"...)
+	body = append(body, 0)
+	body = append(body, 1, 0, 0, 0, 0, 0, 0, 0)
+	body = append(body, ndrSyntax...)
+	if err := checkBindAck(body); err != nil {
+		t.Errorf("accepted bind: %v", err)
+	}
+	// Provider rejection.
+	body[len(body)-24] = 2
+	if err := checkBindAck(body); err == nil {
+		t.Error("expected an error for a rejected bind")
+	}
+	if err := checkBindAck(body[:12]); err == nil {
+		t.Error("expected an error for a short bind_ack")
+	}
+}
+
+func TestAuthenticateAnonymous(t *testing.T) {
+	buf, err := encoder.Marshal(ntlmssp.NewAuthenticateAnonymous(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var auth ntlmssp.Authenticate
+	if err := encoder.Unmarshal(buf, &auth); err != nil {
+		t.Fatal(err)
+	}
+	if auth.NegotiateFlags&ntlmssp.FlgNegAnonymous == 0 || len(auth.UserName) != 0 || len(auth.NtChallengeResponse) != 0 || !bytes.Equal(auth.LmChallengeResponse, []byte{0}) {
+		t.Errorf("unexpected message %+v", auth)
+	}
+}
+
+// smb2Response returns a NetBIOS-framed SMB2 response to command.
+func smb2Response(command uint16, status uint32, body []byte) []byte {
+	msg := make([]byte, 64, 64+len(body))
+	copy(msg, ProtocolSmb2)
+	binary.LittleEndian.PutUint16(msg[4:], 64)
+	binary.LittleEndian.PutUint32(msg[8:], status)
+	binary.LittleEndian.PutUint16(msg[12:], command)
+	msg = append(msg, body...)
+	frame := make([]byte, 4, 4+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+func TestRPCCall(t *testing.T) {
+	stub := netrShareEnumResponse(0, share{Name: "public"}, share{Name: "IPC$", Type: 3})
+	// Split the stub over two response fragments.
+	var frags []byte
+	for i, part := range [][]byte{stub[:20], stub[20:]} {
+		frag := newRPCRequest(2, 0, part)
+		frag[2] = rpcResponse
+		frag[3] = 0
+		if i == 0 {
+			frag[3] |= rpcFirstFrag
+		} else {
+			frag[3] |= rpcLastFrag
+		}
+		frags = append(frags, frag...)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		reads := 0
+		for {
+			var size uint32
+			if err := binary.Read(server, binary.BigEndian, &size); err != nil {
+				return
+			}
+			msg := make([]byte, size)
+			if _, err := io.ReadFull(server, msg); err != nil {
+				return
+			}
+			switch command := binary.LittleEndian.Uint16(msg[12:]); command {
+			case CommandWrite:
+				server.Write(smb2Response(command, StatusOk, []byte{17, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}))
+			case CommandRead:
+				// Return the fragments in chunks of 30 bytes, the first
+				// after an interim response.
+				if reads == 0 {
+					server.Write(smb2Response(command, StatusPending, make([]byte, 9)))
+				}
+				chunk := frags[reads*30:]
+				status := uint32(StatusOk)
+				if len(chunk) > 30 {
+					chunk = chunk[:30]
+					status = StatusBufferOverflow
+				}
+				reads++
+				body := []byte{17, 0, 80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+				binary.LittleEndian.PutUint32(body[4:], uint32(len(chunk)))
+				server.Write(smb2Response(command, status, append(body, chunk...)))
+			}
+		}
+	}()
+
+	s := newLoggedSession(client, false)
+	ptype, body, err := s.rpcCall(1, make([]byte, 16), []byte("request"))
+	if err != nil || ptype != rpcResponse {
+		t.Fatalf("rpcCall: %d %v", ptype, err)
+	}
+	if !bytes.Equal(body, stub) {
+		t.Fatalf("reassembled stub differs:\n% x\n% x", body, stub)
+	}
+}
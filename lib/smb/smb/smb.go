@@ -13,17 +13,27 @@ const ProtocolSmb = "\xFFSMB"
 const ProtocolSmb2 = "\xFESMB"
 
 const StatusOk = 0x00000000
+const StatusPending = 0x00000103
+const StatusBufferOverflow = 0x80000005
 const StatusMoreProcessingRequired = 0xc0000016
+const StatusAccessDenied = 0xc0000022
+const StatusBadNetworkName = 0xc00000cc
 const StatusInvalidParameter = 0xc000000d
 const StatusLogonFailure = 0xc000006d
 const StatusUserSessionDeleted = 0xc0000203
+const StatusNotSupported = 0xc00000bb
 
 var StatusMap = map[uint32]string{
 	StatusOk:                     "OK",
+	StatusPending:                "Pending",
+	StatusBufferOverflow:         "Buffer Overflow",
 	StatusMoreProcessingRequired: "More Processing Required",
+	StatusAccessDenied:           "Access denied",
+	StatusBadNetworkName:         "Bad network name",
 	StatusInvalidParameter:       "Invalid Parameter",
 	StatusLogonFailure:           "Logon failed",
 	StatusUserSessionDeleted:     "User session deleted",
+	StatusNotSupported:           "Not supported",
 }
 
 const DialectSmb_2_0_2 = 0x0202
@@ -257,6 +267,74 @@ type TreeDisconnectRes struct {
 	Reserved      uint16
 }
 
+type CreateReq struct {
+	Header
+	StructureSize        uint16
+	SecurityFlags        uint8
+	RequestedOplockLevel uint8
+	ImpersonationLevel   uint32
+	SmbCreateFlags       uint64
+	Reserved             uint64
+	DesiredAccess        uint32
+	FileAttributes       uint32
+	ShareAccess          uint32
+	CreateDisposition    uint32
+	CreateOptions        uint32
+	NameOffset           uint16 `smb:"offset:Name"`
+	NameLength           uint16 `smb:"len:Name"`
+	CreateContextsOffset uint32
+	CreateContextsLength uint32
+	Name                 []byte
+}
+
+type CreateRes struct {
+	Header
+	StructureSize  uint16
+	OplockLevel    uint8
+	Flags          uint8
+	CreateAction   uint32
+	CreationTime   uint64
+	LastAccessTime uint64
+	LastWriteTime  uint64
+	ChangeTime     uint64
+	AllocationSize uint64
+	EndofFile      uint64
+	FileAttributes uint32
+	Reserved2      uint32
+	FileID         []byte `smb:"fixed:16"`
+}
+
+type WriteReq struct {
+	Header
+	StructureSize          uint16
+	DataOffset             uint16 `smb:"offset:Data"`
+	Length                 uint32 `smb:"len:Data"`
+	Offset                 uint64
+	FileID                 []byte `smb:"fixed:16"`
+	Channel                uint32
+	RemainingBytes         uint32
+	WriteChannelInfoOffset uint16
+	WriteChannelInfoLength uint16
+	Flags                  uint32
+	Data                   []byte
+}
+
+type ReadReq struct {
+	Header
+	StructureSize         uint16
+	Padding               uint8
+	Flags                 uint8
+	Length                uint32
+	Offset                uint64
+	FileID                []byte `smb:"fixed:16"`
+	MinimumCount          uint32
+	Channel               uint32
+	RemainingBytes        uint32
+	ReadChannelInfoOffset uint16
+	ReadChannelInfoLength uint16
+	Buffer                []byte `smb:"fixed:1"`
+}
+
 func newHeaderV1() HeaderV1 {
 	return HeaderV1{
 		ProtocolID: []byte(ProtocolSmb),
@@ -477,3 +555,61 @@ func (s *Session) NewTreeDisconnectReq(treeId uint32) (TreeDisconnectReq, error)
 func NewTreeDisconnectRes() (TreeDisconnectRes, error) {
 	return TreeDisconnectRes{}, nil
 }
+
+// NewCreateReq creates a new Create message opening the named file (e.g. a
+// pipe on the IPC$ share) for reading and writing.
+func (s *Session) NewCreateReq(treeID uint32, name string) CreateReq {
+	header := newHeader()
+	header.Command = CommandCreate
+	header.CreditCharge = 1
+	header.MessageID = s.messageID
+	header.SessionID = s.sessionID
+	header.TreeID = treeID
+
+	return CreateReq{
+		Header:             header,
+		StructureSize:      57,
+		ImpersonationLevel: 2, // Impersonation
+		DesiredAccess:      0x0012019f,
+		ShareAccess:        0x07, // read, write, delete
+		CreateDisposition:  1,    // FILE_OPEN
+		Name:               encoder.ToUnicode(name),
+	}
+}
+
+// NewWriteReq creates a new Write message writing data at offset 0.
+func (s *Session) NewWriteReq(treeID uint32, fileID []byte, data []byte) WriteReq {
+	header := newHeader()
+	header.Command = CommandWrite
+	header.CreditCharge = 1
+	header.MessageID = s.messageID
+	header.SessionID = s.sessionID
+	header.TreeID = treeID
+
+	return WriteReq{
+		Header:        header,
+		StructureSize: 49,
+		FileID:        fileID,
+		Data:          data,
+	}
+}
+
+// NewReadReq creates a new Read message reading up to length bytes at
+// offset 0.
+func (s *Session) NewReadReq(treeID uint32, fileID []byte, length uint32) ReadReq {
+	header := newHeader()
+	header.Command = CommandRead
+	header.CreditCharge = 1
+	header.MessageID = s.messageID
+	header.SessionID = s.sessionID
+	header.TreeID = treeID
+
+	return ReadReq{
+		Header:        header,
+		StructureSize: 49,
+		Padding:       0x50,
+		Length:        length,
+		FileID:        fileID,
+		Buffer:        []byte{0},
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"unicode/utf16"
 
+	"github.com/Positive-Engineer/zgrab2"
 	"github.com/Positive-Engineer/zgrab2/lib/smb/gss"
 	"github.com/Positive-Engineer/zgrab2/lib/smb/ntlmssp"
 	"github.com/Positive-Engineer/zgrab2/lib/smb/smb/encoder"
@@ -151,6 +152,29 @@ type SMBLog struct {
 	// SessionSetupLog, if present, contains the server's response to the
 	// session setup request.
 	SessionSetupLog *SessionSetupLog `json:"session_setup_log,omitempty"`
+
+	// NullSession is true if the server accepted an anonymous login.
+	// Only attempted with GetSMBInventory.
+	NullSession bool `json:"null_session,omitempty"`
+
+	// SessionEncryptData is true if the server requires encryption for the
+	// anonymous session.
+	SessionEncryptData bool `json:"session_encrypt_data,omitempty"`
+
+	// Inventory lists the shares of the server, if the anonymous login
+	// succeeded.
+	Inventory *zgrab2.Inventory `json:"inventory,omitempty"`
+
+	// Shares lists the shares of the server with the access of the
+	// anonymous session to each of them. Only filled by EnumerateShares.
+	Shares []*ShareAccess `json:"shares,omitempty"`
+
+	// SharesError is set if the shares could not be listed.
+	SharesError string `json:"shares_error,omitempty"`
+
+	// Dialects are the responses to Negotiate requests for each dialect.
+	// Only filled by NegotiateDialects.
+	Dialects []*DialectLog `json:"dialects,omitempty"`
 }
 
 // LoggedSession wraps the Session struct, and holds a Log struct alongside it
@@ -190,9 +214,19 @@ func fillHeaderLog(src *Header, dest *HeaderLog) *HeaderLog {
 // GetSMBLog() determines the Protocol version and dialect, and optionally
 // negotiates a session.
 func GetSMBLog(conn net.Conn, session bool, v1 bool, debug bool) (smbLog *SMBLog, err error) {
+	s := newLoggedSession(conn, debug)
+	if v1 {
+		err = s.LoggedNegotiateProtocolv1(session)
+	} else {
+		err = s.LoggedNegotiateProtocol(session)
+	}
+	return s.Log, err
+}
+
+func newLoggedSession(conn net.Conn, debug bool) *LoggedSession {
 	opt := Options{}
 
-	s := &LoggedSession{
+	return &LoggedSession{
 		Session: Session{
 			IsSigningRequired: false,
 			IsAuthenticated:   false,
@@ -206,13 +240,6 @@ func GetSMBLog(conn net.Conn, session bool, v1 bool, debug bool) (smbLog *SMBLog
 			trees:             make(map[string]uint32),
 		},
 	}
-
-	if v1 {
-		err = s.LoggedNegotiateProtocolv1(session)
-	} else {
-		err = s.LoggedNegotiateProtocol(session)
-	}
-	return s.Log, err
 }
 
 func wstring(input []byte) string {
@@ -468,6 +495,7 @@ func (ls *LoggedSession) LoggedNegotiateProtocol(setup bool) error {
 	}
 	logStruct.SessionSetupLog.TargetName = wstring(challenge.TargetName)
 	logStruct.SessionSetupLog.NegotiateFlags = challenge.NegotiateFlags
+	s.sessionID = ssres.Header.SessionID
 
 	return nil
 }
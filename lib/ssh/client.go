@@ -283,4 +283,9 @@ type ClientConfig struct {
 	// If true, send the "none" Authentication Request to collect the advertised
 	// userauth method names, but do not attempt to authenticate.
 	DontAuthenticate bool
+
+	// TryAuth makes a client with a ConnLog try each method in Auth once
+	// after "none", recording the outcome in ConnLog.AuthAttempt. Failing
+	// to authenticate is not an error.
+	TryAuth bool
 }
@@ -13,10 +13,15 @@ import (
 
 // clientAuthenticate authenticates with the remote server. See RFC 4252.
 func (c *connection) clientAuthenticate(config *ClientConfig) error {
-	if c.transport.config.ConnLog != nil && !config.DontAuthenticate {
+	if c.transport.config.ConnLog != nil && !config.DontAuthenticate && !config.TryAuth {
 		// Use ConnLog existence to indicate that this is a run and not testing
 		return nil
 	}
+	var attempt *AuthAttempt
+	if c.transport.config.ConnLog != nil && config.TryAuth {
+		attempt = &AuthAttempt{User: config.User}
+		c.transport.config.ConnLog.AuthAttempt = attempt
+	}
 
 	// initiate user auth session
 	if err := c.transport.writePacket(Marshal(&serviceRequestMsg{serviceUserAuth})); err != nil {
@@ -37,15 +42,24 @@ func (c *connection) clientAuthenticate(config *ClientConfig) error {
 	var lastMethods []string
 	for auth := AuthMethod(new(noneAuth)); auth != nil; {
 		ok, methods, err := auth.auth(c.transport.getSessionID(), config.User, c.transport, config.Rand)
+		if attempt != nil && auth.method() != "none" {
+			attempt.Tried = append(attempt.Tried, auth.method())
+		}
 		if err != nil {
+			if attempt != nil {
+				attempt.Error = err.Error()
+			}
 			return err
 		}
 		if ok {
 			// success
+			if attempt != nil {
+				attempt.Success, attempt.Method = true, auth.method()
+			}
 			return nil
 		}
 
-		if c.transport.config.ConnLog != nil {
+		if c.transport.config.ConnLog != nil && auth.method() == "none" {
 			c.transport.config.ConnLog.UserAuth = methods
 		}
 		if config.DontAuthenticate {
@@ -74,7 +88,12 @@ func (c *connection) clientAuthenticate(config *ClientConfig) error {
 			}
 		}
 	}
-	return fmt.Errorf("ssh: unable to authenticate, attempted methods %v, no supported methods remain", keys(tried))
+	err = fmt.Errorf("ssh: unable to authenticate, attempted methods %v, no supported methods remain", keys(tried))
+	if attempt != nil {
+		attempt.Error = err.Error()
+		return nil
+	}
+	return err
 }
 
 func keys(m map[string]bool) []string {
@@ -0,0 +1,185 @@
+package ssh
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FeatureFlags are triage booleans computed from the server's KEXINIT and
+// identification string.
+type FeatureFlags struct {
+	// StrictKex is true if the server offers strict key exchange
+	// (kex-strict-s-v00@openssh.com), the Terrapin countermeasure.
+	StrictKex bool `json:"strict_kex"`
+
+	// TerrapinVulnerable is true if the server offers ChaCha20-Poly1305 or a
+	// CBC cipher together with an Encrypt-then-MAC MAC, without strict key
+	// exchange (CVE-2023-48795).
+	TerrapinVulnerable bool `json:"terrapin_vulnerable"`
+
+	// TerrapinAlgorithms are the offered algorithms that make the prefix
+	// truncation attack possible.
+	TerrapinAlgorithms []string `json:"terrapin_algorithms,omitempty"`
+
+	// SHA1OnlyHostKeys is true if every offered host key algorithm signs
+	// with SHA-1 (ssh-rsa, ssh-dss and their certificate variants).
+	SHA1OnlyHostKeys bool `json:"sha1_only_host_keys"`
+
+	// RSASHA1Only is true if the server offers ssh-rsa but neither
+	// rsa-sha2-256 nor rsa-sha2-512.
+	RSASHA1Only bool `json:"rsa_sha1_only"`
+
+	// SHA1OnlyKex is true if every offered key exchange method hashes with
+	// SHA-1.
+	SHA1OnlyKex bool `json:"sha1_only_kex"`
+
+	// OpenSSHVersion is the version from an OpenSSH identification string,
+	// e.g. "8.9p1".
+	OpenSSHVersion string `json:"openssh_version,omitempty"`
+
+	// OpenSSHCVEs are the server-side CVEs whose affected version range
+	// includes OpenSSHVersion. Distribution backports are not taken into
+	// account.
+	OpenSSHCVEs []string `json:"openssh_cves,omitempty"`
+}
+
+// openSSHRange is a range [from, to) of affected OpenSSH versions. A zero
+// from means all earlier versions.
+type openSSHRange struct {
+	cve      string
+	from, to openSSHVersion
+}
+
+// openSSHVersion is major, minor and portable patch level (the N in pN).
+// Versions without a patch level (OpenBSD) count as p1.
+type openSSHVersion [3]int
+
+func (v openSSHVersion) less(w openSSHVersion) bool {
+	for i := range v {
+		if v[i] != w[i] {
+			return v[i] < w[i]
+		}
+	}
+	return false
+}
+
+var openSSHRanges = []openSSHRange{
+	{"CVE-2016-6210", openSSHVersion{}, openSSHVersion{7, 3, 0}},         // user enumeration via timing
+	{"CVE-2016-6515", openSSHVersion{}, openSSHVersion{7, 3, 0}},         // crypt() DoS with long passwords
+	{"CVE-2018-15473", openSSHVersion{}, openSSHVersion{7, 8, 0}},        // user enumeration
+	{"CVE-2021-41617", openSSHVersion{6, 2, 0}, openSSHVersion{8, 8, 0}}, // AuthorizedKeysCommand privilege escalation
+	{"CVE-2023-25136", openSSHVersion{9, 1, 0}, openSSHVersion{9, 2, 0}}, // pre-auth double free
+	{"CVE-2024-6387", openSSHVersion{}, openSSHVersion{4, 4, 0}},         // regreSSHion (original CVE-2006-5051)
+	{"CVE-2024-6387", openSSHVersion{8, 5, 1}, openSSHVersion{9, 8, 1}},  // regreSSHion
+	{"CVE-2025-26466", openSSHVersion{9, 5, 1}, openSSHVersion{9, 9, 2}}, // pre-auth memory/CPU DoS
+}
+
+var openSSHVersionRegex = regexp.MustCompile(`^OpenSSH_(\d+)\.(\d+)(?:\.\d+)?(?:p(\d+))?`)
+
+// parseOpenSSHVersion returns the version and its text for an OpenSSH
+// software version string.
+func parseOpenSSHVersion(software string) (openSSHVersion, string, bool) {
+	match := openSSHVersionRegex.FindStringSubmatch(software)
+	if match == nil {
+		return openSSHVersion{}, "", false
+	}
+	var v openSSHVersion
+	for i := range v {
+		v[i], _ = strconv.Atoi(match[i+1])
+	}
+	if match[3] == "" {
+		v[2] = 1
+	}
+	return v, strings.TrimPrefix(match[0], "OpenSSH_"), true
+}
+
+func isSHA1HostKeyAlgo(algo string) bool {
+	switch algo {
+	case KeyAlgoRSA, KeyAlgoDSA, CertAlgoRSAv01, CertAlgoDSAv01:
+		return true
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, element := range list {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ComputeFeatureFlags computes the feature flags from the handshake log. It
+// returns nil if neither the server's KEXINIT nor its identification string
+// were received.
+func ComputeFeatureFlags(log *HandshakeLog) *FeatureFlags {
+	if log.ServerKex == nil && log.ServerID == nil {
+		return nil
+	}
+	ret := new(FeatureFlags)
+	if kex := log.ServerKex; kex != nil {
+		ret.StrictKex = containsString(kex.KexAlgos, "kex-strict-s-v00@openssh.com")
+		ciphers := append(append([]string{}, kex.CiphersClientServer...), kex.CiphersServerClient...)
+		macs := append(append([]string{}, kex.MACsClientServer...), kex.MACsServerClient...)
+		var etm []string
+		for _, mac := range macs {
+			if strings.HasSuffix(mac, "-etm@openssh.com") && !containsString(etm, mac) {
+				etm = append(etm, mac)
+			}
+		}
+		var vulnerable []string
+		cbc := false
+		for _, cipher := range ciphers {
+			if containsString(vulnerable, cipher) {
+				continue
+			}
+			if cipher == "chacha20-poly1305@openssh.com" {
+				vulnerable = append(vulnerable, cipher)
+			} else if strings.HasSuffix(cipher, "-cbc") && len(etm) > 0 {
+				vulnerable = append(vulnerable, cipher)
+				cbc = true
+			}
+		}
+		if cbc {
+			vulnerable = append(vulnerable, etm...)
+		}
+		ret.TerrapinAlgorithms = vulnerable
+		ret.TerrapinVulnerable = len(vulnerable) > 0 && !ret.StrictKex
+
+		ret.SHA1OnlyHostKeys = len(kex.ServerHostKeyAlgos) > 0
+		for _, algo := range kex.ServerHostKeyAlgos {
+			if !isSHA1HostKeyAlgo(algo) {
+				ret.SHA1OnlyHostKeys = false
+			}
+		}
+		ret.RSASHA1Only = containsString(kex.ServerHostKeyAlgos, KeyAlgoRSA) &&
+			!containsString(kex.ServerHostKeyAlgos, KeyAlgoRSASHA256) && !containsString(kex.ServerHostKeyAlgos, KeyAlgoRSASHA512)
+
+		sha1Only := false
+		for _, algo := range kex.KexAlgos {
+			if strings.HasPrefix(algo, "ext-info-") || strings.HasPrefix(algo, "kex-strict-") {
+				// Pseudo-algorithms signalling extensions.
+				continue
+			}
+			if !strings.HasSuffix(algo, "-sha1") {
+				sha1Only = false
+				break
+			}
+			sha1Only = true
+		}
+		ret.SHA1OnlyKex = sha1Only
+	}
+	if log.ServerID != nil {
+		if v, text, ok := parseOpenSSHVersion(log.ServerID.SoftwareVersion); ok {
+			ret.OpenSSHVersion = text
+			for _, r := range openSSHRanges {
+				if !v.less(r.from) && v.less(r.to) && !containsString(ret.OpenSSHCVEs, r.cve) {
+					ret.OpenSSHCVEs = append(ret.OpenSSHCVEs, r.cve)
+				}
+			}
+		}
+	}
+	return ret
+}
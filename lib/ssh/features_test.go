@@ -0,0 +1,75 @@
+package ssh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeFeatureFlags(t *testing.T) {
+	log := &HandshakeLog{
+		ServerID: &EndpointId{SoftwareVersion: "OpenSSH_8.9p1"},
+		ServerKex: &KexInitMsg{
+			KexAlgos:            []string{"curve25519-sha256", "diffie-hellman-group14-sha1", "ext-info-s"},
+			ServerHostKeyAlgos:  []string{"ssh-rsa", "ssh-ed25519"},
+			CiphersClientServer: []string{"chacha20-poly1305@openssh.com", "aes128-ctr", "aes128-cbc"},
+			CiphersServerClient: []string{"chacha20-poly1305@openssh.com", "aes128-ctr", "aes128-cbc"},
+			MACsClientServer:    []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256"},
+			MACsServerClient:    []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256"},
+		},
+	}
+	expected := &FeatureFlags{
+		TerrapinVulnerable: true,
+		TerrapinAlgorithms: []string{"chacha20-poly1305@openssh.com", "aes128-cbc", "hmac-sha2-256-etm@openssh.com"},
+		RSASHA1Only:        true,
+		OpenSSHVersion:     "8.9p1",
+		OpenSSHCVEs:        []string{"CVE-2024-6387"},
+	}
+	if actual := ComputeFeatureFlags(log); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %+v, expected %+v", actual, expected)
+	}
+
+	log = &HandshakeLog{
+		ServerID: &EndpointId{SoftwareVersion: "OpenSSH_9.8"},
+		ServerKex: &KexInitMsg{
+			KexAlgos:            []string{"diffie-hellman-group1-sha1", "kex-strict-s-v00@openssh.com"},
+			ServerHostKeyAlgos:  []string{"ssh-rsa", "ssh-dss"},
+			CiphersClientServer: []string{"chacha20-poly1305@openssh.com"},
+		},
+	}
+	expected = &FeatureFlags{
+		StrictKex:          true,
+		TerrapinAlgorithms: []string{"chacha20-poly1305@openssh.com"},
+		SHA1OnlyHostKeys:   true,
+		RSASHA1Only:        true,
+		SHA1OnlyKex:        true,
+		OpenSSHVersion:     "9.8",
+		OpenSSHCVEs:        []string{"CVE-2025-26466"},
+	}
+	if actual := ComputeFeatureFlags(log); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %+v, expected %+v", actual, expected)
+	}
+
+	if ComputeFeatureFlags(&HandshakeLog{}) != nil {
+		t.Error("expected nil flags without server data")
+	}
+}
+
+func TestParseOpenSSHVersion(t *testing.T) {
+	tests := []struct {
+		software string
+		version  openSSHVersion
+		ok       bool
+	}{
+		{"OpenSSH_7.4", openSSHVersion{7, 4, 1}, true},
+		{"OpenSSH_9.6p1", openSSHVersion{9, 6, 1}, true},
+		{"OpenSSH_for_Windows_8.1", openSSHVersion{}, false},
+		{"dropbear_2020.81", openSSHVersion{}, false},
+		{"OpenSSH_9.9p2", openSSHVersion{9, 9, 2}, true},
+	}
+	for _, test := range tests {
+		v, _, ok := parseOpenSSHVersion(test.software)
+		if ok != test.ok || v != test.version {
+			t.Errorf("%s: got %v %v, expected %v %v", test.software, v, ok, test.version, test.ok)
+		}
+	}
+}
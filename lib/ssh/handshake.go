@@ -376,6 +376,9 @@ func (t *handshakeTransport) enterKeyExchangeLocked(otherInitPacket []byte) erro
 		magics.clientKexInit = myInitPacket
 		magics.serverKexInit = otherInitPacket
 	}
+	if t.config.ConnLog != nil {
+		t.config.ConnLog.HASSH = ComputeHASSH(clientInit, serverInit)
+	}
 
 	algs, err := findAgreedAlgorithms(clientInit, serverInit)
 	if err != nil {
@@ -0,0 +1,56 @@
+package ssh
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+)
+
+// HASSH holds the HASSH fingerprints of the client and server KEXINIT
+// messages (https://github.com/salesforce/hassh): the MD5 hash of the key
+// exchange, encryption, MAC and compression algorithms, in the order
+// offered.
+type HASSH struct {
+	// Client is hassh, from the algorithms offered by the client for the
+	// client to server direction.
+	Client           string `json:"hassh,omitempty"`
+	ClientAlgorithms string `json:"hassh_algorithms,omitempty"`
+
+	// Server is hasshServer, from the algorithms offered by the server for
+	// the server to client direction.
+	Server           string `json:"hassh_server,omitempty"`
+	ServerAlgorithms string `json:"hassh_server_algorithms,omitempty"`
+}
+
+// hasshAlgorithms returns the algorithm string of a HASSH fingerprint.
+func hasshAlgorithms(kex []string, ciphers []string, macs []string, compression []string) string {
+	return strings.Join([]string{
+		strings.Join(kex, ","),
+		strings.Join(ciphers, ","),
+		strings.Join(macs, ","),
+		strings.Join(compression, ","),
+	}, ";")
+}
+
+func hasshHash(algorithms string) string {
+	sum := md5.Sum([]byte(algorithms))
+	return hex.EncodeToString(sum[:])
+}
+
+// ComputeHASSH returns the fingerprints of the client and server KEXINIT
+// messages; either may be nil.
+func ComputeHASSH(client *KexInitMsg, server *KexInitMsg) *HASSH {
+	if client == nil && server == nil {
+		return nil
+	}
+	ret := new(HASSH)
+	if client != nil {
+		ret.ClientAlgorithms = hasshAlgorithms(client.KexAlgos, client.CiphersClientServer, client.MACsClientServer, client.CompressionClientServer)
+		ret.Client = hasshHash(ret.ClientAlgorithms)
+	}
+	if server != nil {
+		ret.ServerAlgorithms = hasshAlgorithms(server.KexAlgos, server.CiphersServerClient, server.MACsServerClient, server.CompressionServerClient)
+		ret.Server = hasshHash(ret.ServerAlgorithms)
+	}
+	return ret
+}
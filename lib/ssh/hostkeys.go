@@ -0,0 +1,46 @@
+package ssh
+
+// HostKeyFamily is a type of host key with the host key algorithms that
+// use it, in preference order.
+type HostKeyFamily struct {
+	Name       string
+	Algorithms []string
+}
+
+// HostKeyFamilies are the host key types collected by offering each one's
+// algorithms on its own.
+var HostKeyFamilies = []HostKeyFamily{
+	{"rsa", []string{KeyAlgoRSASHA512, KeyAlgoRSASHA256, KeyAlgoRSA}},
+	{"ecdsa", []string{KeyAlgoECDSA256, KeyAlgoECDSA384, KeyAlgoECDSA521}},
+	{"ed25519", []string{KeyAlgoED25519}},
+	{"dss", []string{KeyAlgoDSA}},
+}
+
+// OfferedBy returns the algorithms of the family in the server's KEXINIT.
+func (family *HostKeyFamily) OfferedBy(kex *KexInitMsg) []string {
+	var ret []string
+	for _, algo := range family.Algorithms {
+		if containsString(kex.ServerHostKeyAlgos, algo) {
+			ret = append(ret, algo)
+		}
+	}
+	return ret
+}
+
+// HostKey is a host key of the server, obtained by a handshake offering
+// only the algorithms of its family.
+type HostKey struct {
+	Family string `json:"family"`
+
+	// Algorithms are the algorithms of the family offered by the server;
+	// the handshake used the first one.
+	Algorithms []string `json:"algorithms"`
+
+	Key *ServerHostKeyJsonLog `json:"key,omitempty"`
+
+	// Fingerprint is the OpenSSH SHA256 fingerprint of the key, e.g.
+	// SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
@@ -26,6 +26,38 @@ type HandshakeLog struct {
 	DHKeyExchange      kexAlgorithm `json:"key_exchange,omitempty"`
 	UserAuth           []string     `json:"userauth,omitempty"`
 	Crypto             *kexResult   `json:"crypto,omitempty"`
+
+	// FeatureFlags are computed by the ssh module after the handshake.
+	FeatureFlags *FeatureFlags `json:"feature_flags,omitempty"`
+
+	// WeakAlgorithms are computed by the ssh module after the handshake.
+	WeakAlgorithms *WeakAlgorithms `json:"weak_algorithms,omitempty"`
+
+	// HASSH holds the fingerprints of both KEXINIT messages.
+	HASSH *HASSH `json:"hassh,omitempty"`
+
+	// HostKeys are collected by the ssh module with --all-host-keys.
+	HostKeys []*HostKey `json:"host_keys,omitempty"`
+
+	// AuthAttempt is the outcome of authenticating with TryAuth.
+	AuthAttempt *AuthAttempt `json:"auth_attempt,omitempty"`
+}
+
+// AuthAttempt is the outcome of a single authentication attempt with each
+// of the configured methods.
+type AuthAttempt struct {
+	User string `json:"user"`
+
+	// Tried are the methods attempted, in order; the server's response to
+	// "none" selects them.
+	Tried []string `json:"tried,omitempty"`
+
+	Success bool `json:"success"`
+
+	// Method is the method accepted by the server, which may be "none".
+	Method string `json:"method,omitempty"`
+
+	Error string `json:"error,omitempty"`
 }
 
 type EndpointId struct {
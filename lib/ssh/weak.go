@@ -0,0 +1,114 @@
+package ssh
+
+import "strings"
+
+// WeakAlgorithm is a deprecated or weak algorithm offered by the server.
+type WeakAlgorithm struct {
+	Algorithm string `json:"algorithm"`
+	Reason    string `json:"reason"`
+}
+
+// WeakAlgorithms lists the weak algorithms in the server's KEXINIT, by
+// kind. Ciphers and MACs offered in either direction are listed once.
+type WeakAlgorithms struct {
+	Kex     []WeakAlgorithm `json:"kex,omitempty"`
+	HostKey []WeakAlgorithm `json:"host_key,omitempty"`
+	Ciphers []WeakAlgorithm `json:"ciphers,omitempty"`
+	MACs    []WeakAlgorithm `json:"macs,omitempty"`
+}
+
+var weakKexAlgorithms = map[string]string{
+	"diffie-hellman-group1-sha1":         "1024-bit group with SHA-1",
+	"diffie-hellman-group14-sha1":        "SHA-1",
+	"diffie-hellman-group-exchange-sha1": "SHA-1",
+	"rsa1024-sha1":                       "1024-bit RSA with SHA-1",
+}
+
+var weakHostKeyAlgorithms = map[string]string{
+	KeyAlgoDSA:     "1024-bit DSA with SHA-1",
+	CertAlgoDSAv01: "1024-bit DSA with SHA-1",
+	KeyAlgoRSA:     "SHA-1 signatures",
+	CertAlgoRSAv01: "SHA-1 signatures",
+}
+
+var weakCiphers = map[string]string{
+	"none":           "no encryption",
+	"des-cbc":        "56-bit DES",
+	"3des-cbc":       "64-bit block cipher in CBC mode",
+	"blowfish-cbc":   "64-bit block cipher in CBC mode",
+	"cast128-cbc":    "64-bit block cipher in CBC mode",
+	"idea-cbc":       "64-bit block cipher in CBC mode",
+	"arcfour":        "RC4",
+	"arcfour128":     "RC4",
+	"arcfour256":     "RC4",
+	"twofish-cbc":    "CBC mode",
+	"twofish128-cbc": "CBC mode",
+	"twofish256-cbc": "CBC mode",
+}
+
+var weakMACs = map[string]string{
+	"none":                    "no integrity protection",
+	"umac-64@openssh.com":     "64-bit tag",
+	"umac-64-etm@openssh.com": "64-bit tag",
+}
+
+// weakCipherReason returns why a cipher is weak, or "".
+func weakCipherReason(cipher string) string {
+	if reason, ok := weakCiphers[cipher]; ok {
+		return reason
+	}
+	if strings.HasSuffix(cipher, "-cbc") || cipher == "rijndael-cbc@lysator.liu.se" {
+		return "CBC mode"
+	}
+	return ""
+}
+
+// weakMACReason returns why a MAC is weak, or "".
+func weakMACReason(mac string) string {
+	if reason, ok := weakMACs[mac]; ok {
+		return reason
+	}
+	switch {
+	case strings.HasPrefix(mac, "hmac-md5"):
+		return "MD5"
+	case strings.HasPrefix(mac, "hmac-ripemd160"):
+		return "RIPEMD-160"
+	case strings.Contains(mac, "-96"):
+		return "truncated to 96 bits"
+	}
+	return ""
+}
+
+// appendWeak appends the algorithms of list that reason flags, skipping
+// those already in ret.
+func appendWeak(ret []WeakAlgorithm, list []string, reason func(string) string) []WeakAlgorithm {
+outer:
+	for _, algo := range list {
+		for _, weak := range ret {
+			if weak.Algorithm == algo {
+				continue outer
+			}
+		}
+		if r := reason(algo); r != "" {
+			ret = append(ret, WeakAlgorithm{Algorithm: algo, Reason: r})
+		}
+	}
+	return ret
+}
+
+// ComputeWeakAlgorithms returns the weak algorithms offered by the server,
+// or nil if its KEXINIT was not received.
+func ComputeWeakAlgorithms(log *HandshakeLog) *WeakAlgorithms {
+	kex := log.ServerKex
+	if kex == nil {
+		return nil
+	}
+	ret := new(WeakAlgorithms)
+	ret.Kex = appendWeak(nil, kex.KexAlgos, func(algo string) string { return weakKexAlgorithms[algo] })
+	ret.HostKey = appendWeak(nil, kex.ServerHostKeyAlgos, func(algo string) string { return weakHostKeyAlgorithms[algo] })
+	ret.Ciphers = appendWeak(nil, kex.CiphersClientServer, weakCipherReason)
+	ret.Ciphers = appendWeak(ret.Ciphers, kex.CiphersServerClient, weakCipherReason)
+	ret.MACs = appendWeak(nil, kex.MACsClientServer, weakMACReason)
+	ret.MACs = appendWeak(ret.MACs, kex.MACsServerClient, weakMACReason)
+	return ret
+}
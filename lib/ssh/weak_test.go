@@ -0,0 +1,41 @@
+package ssh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeWeakAlgorithms(t *testing.T) {
+	log := &HandshakeLog{
+		ServerKex: &KexInitMsg{
+			KexAlgos:            []string{"curve25519-sha256", "diffie-hellman-group14-sha256", "diffie-hellman-group1-sha1"},
+			ServerHostKeyAlgos:  []string{"ssh-ed25519", "rsa-sha2-512", "ssh-rsa", "ssh-dss"},
+			CiphersClientServer: []string{"aes128-ctr", "aes128-cbc", "3des-cbc"},
+			CiphersServerClient: []string{"aes128-ctr", "aes128-cbc", "arcfour"},
+			MACsClientServer:    []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha1", "hmac-md5"},
+			MACsServerClient:    []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha1-96"},
+		},
+	}
+	expected := &WeakAlgorithms{
+		Kex: []WeakAlgorithm{{"diffie-hellman-group1-sha1", "1024-bit group with SHA-1"}},
+		HostKey: []WeakAlgorithm{
+			{"ssh-rsa", "SHA-1 signatures"},
+			{"ssh-dss", "1024-bit DSA with SHA-1"},
+		},
+		Ciphers: []WeakAlgorithm{
+			{"aes128-cbc", "CBC mode"},
+			{"3des-cbc", "64-bit block cipher in CBC mode"},
+			{"arcfour", "RC4"},
+		},
+		MACs: []WeakAlgorithm{
+			{"hmac-md5", "MD5"},
+			{"hmac-sha1-96", "truncated to 96 bits"},
+		},
+	}
+	if actual := ComputeWeakAlgorithms(log); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %+v, expected %+v", actual, expected)
+	}
+	if ComputeWeakAlgorithms(&HandshakeLog{}) != nil {
+		t.Error("weak algorithms without a KEXINIT")
+	}
+}
@@ -0,0 +1,508 @@
+package zgrab2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// localPorts is the local address of the TCP connections opened by one
+// sender: its source IP and its own part of the --source-ports range,
+// used in turn.
+type localPorts struct {
+	mutex     sync.Mutex
+	ip        net.IP
+	low, high int
+	next      int
+}
+
+// addr returns the next local address of the range, or one with port 0 (any
+// port) if there is no range.
+func (p *localPorts) addr() *net.TCPAddr {
+	if p.low == 0 {
+		return &net.TCPAddr{IP: p.ip}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	port := p.next
+	if p.next++; p.next > p.high {
+		p.next = p.low
+	}
+	return &net.TCPAddr{IP: p.ip, Port: port}
+}
+
+// size returns the number of ports in the range, or 1 without a range.
+func (p *localPorts) size() int {
+	if p.low == 0 {
+		return 1
+	}
+	return p.high - p.low + 1
+}
+
+// parsePortRange parses a LOW-HIGH port range.
+func parsePortRange(value string) (int, int, error) {
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected LOW-HIGH, got %q", value)
+	}
+	low, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	high, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	if low == 0 || high < low {
+		return 0, 0, fmt.Errorf("invalid port range %q", value)
+	}
+	return int(low), int(high), nil
+}
+
+// newLocalPorts returns the local addresses of each of senders: the source
+// IPs are assigned in turn, and the senders sharing an IP split the port
+// range between them.
+func newLocalPorts(sourceIPs string, portRange string, senders int) ([]*localPorts, error) {
+	var ips []net.IP
+	for _, value := range strings.Split(sourceIPs, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source IP %q", value)
+		}
+		ips = append(ips, ip)
+	}
+	if len(ips) == 0 {
+		ips = append(ips, nil)
+	}
+	var low, high int
+	if portRange != "" {
+		var err error
+		if low, high, err = parsePortRange(portRange); err != nil {
+			return nil, err
+		}
+	}
+	ret := make([]*localPorts, senders)
+	for i := range ret {
+		ret[i] = &localPorts{ip: ips[i%len(ips)]}
+		if low == 0 {
+			continue
+		}
+		// Sender i is the k-th of the n senders using its IP.
+		k, n := i/len(ips), (senders-i%len(ips)+len(ips)-1)/len(ips)
+		size := high - low + 1
+		if size < n {
+			return nil, fmt.Errorf("%d ports cannot be split between %d senders", size, n)
+		}
+		ret[i].low = low + k*size/n
+		ret[i].high = low + (k+1)*size/n - 1
+		ret[i].next = ret[i].low
+	}
+	return ret, nil
+}
+
+// isAddrInUse returns whether a dial failed because the local address is
+// in use, e.g. by a connection in TIME_WAIT.
+func isAddrInUse(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == syscall.EADDRINUSE
+		}
+	}
+	return false
+}
+
+// localAddrLog records the local addresses of the connections opened by a
+// scan, with --record-local-addr or --source-ports.
+type localAddrLog struct {
+	mutex sync.Mutex
+	addrs []string
+}
+
+func (l *localAddrLog) add(conn net.Conn) {
+	if l == nil || conn == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.addrs = append(l.addrs, conn.LocalAddr().String())
+}
+
+func (l *localAddrLog) list() []string {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.addrs
+}
+
+// sourcePool is the --source-ip-pool: the local addresses of each family,
+// used in turn by the connections.
+type sourcePool struct {
+	ipv4, ipv6 []net.IP
+	next       uint32
+}
+
+// newSourcePool parses a comma-separated list of addresses, or the name of a
+// file of addresses (one per line) after a @.
+func newSourcePool(value string) (*sourcePool, error) {
+	list := strings.Split(value, ",")
+	if strings.HasPrefix(value, "@") {
+		data, err := ioutil.ReadFile(value[1:])
+		if err != nil {
+			return nil, err
+		}
+		list = strings.Split(string(data), "\n")
+	}
+	ipv4, ipv6, err := parseSourceIPs(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(ipv4) == 0 && len(ipv6) == 0 {
+		return nil, fmt.Errorf("no addresses")
+	}
+	return &sourcePool{ipv4: ipv4, ipv6: ipv6}, nil
+}
+
+// parseSourceIPs parses addresses, ignoring empty values, and returns those
+// of each family.
+func parseSourceIPs(values []string) (ipv4 []net.IP, ipv6 []net.IP, err error) {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, nil, fmt.Errorf("invalid source IP %q", value)
+		}
+		if ip.To4() != nil {
+			ipv4 = append(ipv4, ip)
+		} else {
+			ipv6 = append(ipv6, ip)
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+// joinIPs returns the comma-separated list of ips.
+func joinIPs(ips []net.IP) string {
+	values := make([]string, len(ips))
+	for i, ip := range ips {
+		values[i] = ip.String()
+	}
+	return strings.Join(values, ",")
+}
+
+// isIPv6Address returns whether the host of address is an IPv6 address, and
+// whether it is an address at all rather than a name.
+func isIPv6Address(address string) (ipv6 bool, ok bool) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() == nil, ip != nil
+}
+
+// addr returns the next address of the pool of the family of address, or
+// of the first family with addresses for a name. It is nil if the pool has
+// none.
+func (p *sourcePool) addr(address string) net.Addr {
+	ips := p.ipv4
+	if ipv6, ok := isIPv6Address(address); ipv6 || (!ok && len(ips) == 0) {
+		ips = p.ipv6
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	return &net.TCPAddr{IP: ips[int(atomic.AddUint32(&p.next, 1)-1)%len(ips)]}
+}
+
+// localPortsFor returns the local addresses of sender for connections to
+// address, from --source-ip and --source-ports: those of the source IPs of
+// the family of address, or of the first family with source IPs for a name.
+// It is nil if there are none, as with only IPv4 source IPs and an IPv6
+// address, or without options.
+func (o *dialOptions) localPortsFor(sender int, address string) *localPorts {
+	if o == nil {
+		return nil
+	}
+	table := o.localPorts
+	ipv6, ok := isIPv6Address(address)
+	switch {
+	case ipv6 && o.localPorts6 != nil:
+		table = o.localPorts6
+	case ipv6 && len(table) > 0 && table[0].ip != nil:
+		// IPv4 source IPs cannot reach an IPv6 address.
+		table = nil
+	case !ok && len(table) == 0:
+		table = o.localPorts6
+	case !ipv6 && ok && len(table) == 0:
+		table = nil
+	}
+	if len(table) == 0 {
+		return nil
+	}
+	return table[sender%len(table)]
+}
+
+// interfaceControl returns the net.Dialer or net.ListenConfig Control
+// function that binds the sockets to the --interface of the options. It is
+// nil if it is not set, or without options.
+func (o *dialOptions) interfaceControl() func(network, address string, c syscall.RawConn) error {
+	if o == nil || o.device == "" {
+		return nil
+	}
+	device := o.device
+	return func(network, address string, c syscall.RawConn) error {
+		return bindToDevice(c, device)
+	}
+}
+
+// dialOptions are the options of a Runner for the connections dialed
+// through the framework for its targets.
+type dialOptions struct {
+	// policy rejects the connections to the addresses it excludes.
+	policy *AddressPolicy
+
+	// localPorts and localPorts6 are the local addresses of each sender for
+	// the IPv4 and IPv6 addresses, from --source-ip and --source-ports.
+	localPorts  []*localPorts
+	localPorts6 []*localPorts
+
+	// sourcePool is the --source-ip-pool.
+	sourcePool *sourcePool
+
+	// device is the --interface the sockets are bound to.
+	device string
+
+	// happyEyeballsDelay is the --happy-eyeballs-delay, if --happy-eyeballs
+	// is set: the resolved address of the other family is dialed too after
+	// it. It is zero otherwise.
+	happyEyeballsDelay time.Duration
+}
+
+// setInterface sets the network device the sockets are bound to, as
+// --interface, if it exists.
+func (o *dialOptions) setInterface(device string) error {
+	if device == "" {
+		return nil
+	}
+	if !canBindToDevice {
+		return errors.New("--interface is only supported on Linux")
+	}
+	if _, err := net.InterfaceByName(device); err != nil {
+		return fmt.Errorf("invalid --interface %s: %s", device, err)
+	}
+	o.device = device
+	return nil
+}
+
+// setSourceAddrs sets the local addresses of the TCP connections of
+// senders, from sourceIPs and sourcePorts, as --source-ip and
+// --source-ports, or from sourceIPPool, as --source-ip-pool.
+func (o *dialOptions) setSourceAddrs(sourceIPs string, sourcePorts string, sourceIPPool string, senders int) error {
+	if sourceIPPool != "" {
+		if sourceIPs != "" || sourcePorts != "" {
+			return errors.New("--source-ip-pool cannot be used with --source-ip or --source-ports")
+		}
+		pool, err := newSourcePool(sourceIPPool)
+		if err != nil {
+			return fmt.Errorf("invalid --source-ip-pool: %s", err)
+		}
+		o.sourcePool = pool
+	}
+	if sourceIPs != "" || sourcePorts != "" {
+		// The senders get source IPs of each family, used for the
+		// addresses of that family.
+		ipv4, ipv6, err := parseSourceIPs(strings.Split(sourceIPs, ","))
+		if err == nil && (len(ipv4) > 0 || len(ipv6) == 0) {
+			o.localPorts, err = newLocalPorts(joinIPs(ipv4), sourcePorts, senders)
+		}
+		if err == nil && len(ipv6) > 0 {
+			o.localPorts6, err = newLocalPorts(joinIPs(ipv6), sourcePorts, senders)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid --source-ip or --source-ports: %s", err)
+		}
+	}
+	return nil
+}
+
+// control returns the net.Dialer Control function of the connections
+// dialed with the options, which rejects blocked addresses and binds the
+// sockets to --interface. It is nil if there is nothing to do, as without
+// options.
+func (o *dialOptions) control() func(network, address string, c syscall.RawConn) error {
+	var policy func(network, address string, c syscall.RawConn) error
+	if o != nil {
+		policy = o.policy.dialControl()
+	}
+	bind := o.interfaceControl()
+	if policy == nil || bind == nil {
+		if policy == nil {
+			return bind
+		}
+		return policy
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		if err := policy(network, address, c); err != nil {
+			return err
+		}
+		return bind(network, address, c)
+	}
+}
+
+// ListenUDP opens a UDP socket at local, bound to the --interface of the
+// target's runner if set, for the scans that exchange datagrams with more
+// than one address, e.g. to collect the responses to a broadcast.
+func (target *ScanTarget) ListenUDP(local *net.UDPAddr) (*net.UDPConn, error) {
+	listenConfig := net.ListenConfig{Control: target.dialOpts.interfaceControl()}
+	conn, err := listenConfig.ListenPacket(context.Background(), "udp", local.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+// dial connects to address with dialer, from the local address of the
+// target's sender if the runner has --source-ip or --source-ports, or of
+// its --source-ip-pool. Ports of the sender's range that are in use are skipped.
+// With --happy-eyeballs, the resolved address of the other family is dialed
+// too if the connection is slow. It fails without dialing if the context of
+// the scan is done, or the address is blocked by the policy of the target's
+// runner. The sockets are bound to the runner's --interface if set.
+func (target *ScanTarget) dial(ctx context.Context, dialer *net.Dialer, network string, address string) (net.Conn, error) {
+	if err := target.Ctx().Err(); err != nil {
+		return nil, err
+	}
+	dialer.Control = target.dialOpts.control()
+	start := time.Now()
+	defer func() { target.timing.addDial(time.Since(start)) }()
+	var conn net.Conn
+	var err error
+	if fallback := target.happyEyeballsFallback(address); fallback != "" {
+		conn, err = dialHappyEyeballs(ctx, target.dialOpts.happyEyeballsDelay, func(ctx context.Context, address string) (net.Conn, error) {
+			d := *dialer
+			return target.dialFrom(ctx, &d, network, address)
+		}, address, fallback)
+	} else {
+		conn, err = target.dialFrom(ctx, dialer, network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	target.localAddrs.add(conn)
+	return conn, nil
+}
+
+// dialFrom connects to address with dialer from the local address of the
+// target's sender, if any.
+func (target *ScanTarget) dialFrom(ctx context.Context, dialer *net.Dialer, network string, address string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return dialer.DialContext(ctx, network, address)
+	}
+	if target.dialOpts != nil && target.dialOpts.sourcePool != nil {
+		dialer.LocalAddr = target.dialOpts.sourcePool.addr(address)
+	}
+	ports := target.dialOpts.localPortsFor(target.sender, address)
+	if ports == nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+	var conn net.Conn
+	var err error
+	for i := 0; i < ports.size(); i++ {
+		dialer.LocalAddr = ports.addr()
+		if conn, err = dialer.DialContext(ctx, network, address); !isAddrInUse(err) {
+			break
+		}
+	}
+	return conn, err
+}
+
+// happyEyeballsFallback returns the address to dial if dialing address is
+// slow with the --happy-eyeballs of the target's runner: the target's
+// resolved address of the other family, if address is that of the target.
+func (target *ScanTarget) happyEyeballsFallback(address string) string {
+	if target.dialOpts == nil || target.dialOpts.happyEyeballsDelay <= 0 || target.fallbackIP == nil || target.IP == nil {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || !net.ParseIP(host).Equal(target.IP) {
+		return ""
+	}
+	return net.JoinHostPort(target.fallbackIP.String(), port)
+}
+
+// dialHappyEyeballs dials primary, and fallback once primary has failed or
+// delay has passed without a connection (RFC 8305). It returns the first
+// connection, canceling the other attempt, or the error of primary.
+func dialHappyEyeballs(ctx context.Context, delay time.Duration, dial func(ctx context.Context, address string) (net.Conn, error), primary string, fallback string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type attempt struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	attempts := make(chan attempt, 2)
+	start := func(address string, primary bool) {
+		go func() {
+			conn, err := dial(ctx, address)
+			attempts <- attempt{conn, err, primary}
+		}()
+	}
+	start(primary, true)
+	pending, fellBack := 1, false
+	fallBack := func() {
+		if !fellBack {
+			fellBack = true
+			pending++
+			start(fallback, false)
+		}
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var primaryErr error
+	for {
+		select {
+		case <-timer.C:
+			fallBack()
+		case a := <-attempts:
+			pending--
+			if a.err == nil {
+				if pending > 0 {
+					// Close the other connection if it is established
+					// before being canceled.
+					go func() {
+						if other := <-attempts; other.conn != nil {
+							other.conn.Close()
+						}
+					}()
+				}
+				return a.conn, nil
+			}
+			if a.primary {
+				primaryErr = a.err
+				fallBack()
+			} else if primaryErr == nil && pending == 0 {
+				primaryErr = a.err
+			}
+			if pending == 0 {
+				return nil, primaryErr
+			}
+		}
+	}
+}
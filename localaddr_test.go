@@ -0,0 +1,213 @@
+package zgrab2
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewLocalPorts(t *testing.T) {
+	ports, err := newLocalPorts("10.0.0.1, 10.0.0.2", "1000-1999", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		ip        string
+		low, high int
+	}{
+		// 10.0.0.1 is used by senders 0, 2 and 4, 10.0.0.2 by 1 and 3.
+		{"10.0.0.1", 1000, 1332},
+		{"10.0.0.2", 1000, 1499},
+		{"10.0.0.1", 1333, 1665},
+		{"10.0.0.2", 1500, 1999},
+		{"10.0.0.1", 1666, 1999},
+	}
+	for i, e := range expected {
+		if ports[i].ip.String() != e.ip || ports[i].low != e.low || ports[i].high != e.high {
+			t.Errorf("sender %d: %s %d-%d, expected %s %d-%d", i, ports[i].ip, ports[i].low, ports[i].high, e.ip, e.low, e.high)
+		}
+	}
+
+	if ports, err = newLocalPorts("10.0.0.1", "", 2); err != nil || ports[1].addr().String() != "10.0.0.1:0" {
+		t.Errorf("without range: %v", err)
+	}
+	for _, test := range []struct{ ips, ports string }{
+		{"10.0.0.300", ""},
+		{"", "1000"},
+		{"", "2000-1000"},
+		{"", "0-10"},
+		{"", "1000-1002"},
+	} {
+		if _, err := newLocalPorts(test.ips, test.ports, 4); err == nil {
+			t.Errorf("%q %q: no error", test.ips, test.ports)
+		}
+	}
+}
+
+func TestOpenLocalPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	// A listening socket keeps the first port of the range in use.
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	low := busy.Addr().(*net.TCPAddr).Port
+	if low > 65533 {
+		t.Skip("no room for the port range")
+	}
+
+	dialOpts := &dialOptions{localPorts: []*localPorts{{ip: net.ParseIP("127.0.0.1"), low: low, high: low + 2, next: low}}}
+	port := uint(listener.Addr().(*net.TCPAddr).Port)
+	target := ScanTarget{IP: net.ParseIP("127.0.0.1"), Port: &port, localAddrs: new(localAddrLog), dialOpts: dialOpts}
+	var expected []string
+	for i := 1; i <= 2; i++ {
+		conn, err := target.Open(&BaseFlags{Timeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := conn.LocalAddr().(*net.TCPAddr)
+		if addr.Port != low+i {
+			t.Errorf("connection %d from port %d, expected %d", i, addr.Port, low+i)
+		}
+		expected = append(expected, addr.String())
+		conn.Close()
+	}
+	if !reflect.DeepEqual(target.localAddrs.list(), expected) {
+		t.Errorf("recorded %v, expected %v", target.localAddrs.list(), expected)
+	}
+}
+
+func TestSourcePool(t *testing.T) {
+	pool, err := newSourcePool("10.0.0.1, 2001:db8::1,10.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, address := range []string{"192.0.2.1:80", "[2001:db8::80]:80", "192.0.2.1:80", "example.com:80"} {
+		got = append(got, pool.addr(address).String())
+	}
+	expected := []string{"10.0.0.1:0", "[2001:db8::1]:0", "10.0.0.1:0", "10.0.0.2:0"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+
+	if pool, err = newSourcePool("2001:db8::1"); err != nil {
+		t.Fatal(err)
+	} else if addr := pool.addr("192.0.2.1:80"); addr != nil {
+		t.Errorf("IPv4 address from an IPv6 pool: %s", addr)
+	}
+	for _, value := range []string{"", "10.0.0.300", "@/nonexistent"} {
+		if _, err := newSourcePool(value); err == nil {
+			t.Errorf("%q: no error", value)
+		}
+	}
+}
+
+func TestLocalPortsFor(t *testing.T) {
+	dialOpts := new(dialOptions)
+	if err := dialOpts.setSourceAddrs("10.0.0.1,2001:db8::1", "", "", 2); err != nil {
+		t.Fatal(err)
+	}
+	for address, expected := range map[string]string{
+		"192.0.2.1:80":      "10.0.0.1:0",
+		"[2001:db8::80]:80": "[2001:db8::1]:0",
+		"example.com:80":    "10.0.0.1:0",
+	} {
+		if got := dialOpts.localPortsFor(1, address).addr().String(); got != expected {
+			t.Errorf("%s: %s, expected %s", address, got, expected)
+		}
+	}
+
+	// IPv4 source IPs are not used for IPv6 addresses.
+	dialOpts.localPorts6 = nil
+	if ports := dialOpts.localPortsFor(1, "[2001:db8::80]:80"); ports != nil {
+		t.Errorf("IPv6 address from %s", ports.ip)
+	}
+
+	for _, test := range [][3]string{
+		{"10.0.0.1", "", "10.0.0.2"},
+		{"10.0.0.300", "", ""},
+		{"10.0.0.1", "1000-1000", ""},
+	} {
+		if err := new(dialOptions).setSourceAddrs(test[0], test[1], test[2], 2); err == nil {
+			t.Errorf("%q: no error", test)
+		}
+	}
+}
+
+func TestDialHappyEyeballs(t *testing.T) {
+	// fakeDial connects to "fast" and "slow" (after a second), and fails to
+	// connect to anything else.
+	fakeDial := func(ctx context.Context, address string) (net.Conn, error) {
+		if address == "slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		} else if address != "fast" {
+			return nil, fmt.Errorf("can't connect to %s", address)
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	for _, test := range []struct {
+		primary, fallback string
+		fails             bool
+		maxTime           time.Duration
+	}{
+		{"fast", "slow", false, 100 * time.Millisecond},
+		{"slow", "fast", false, 500 * time.Millisecond},
+		{"down", "fast", false, 100 * time.Millisecond},
+		{"down", "down too", true, 100 * time.Millisecond},
+	} {
+		start := time.Now()
+		conn, err := dialHappyEyeballs(context.Background(), 50*time.Millisecond, fakeDial, test.primary, test.fallback)
+		if elapsed := time.Since(start); elapsed > test.maxTime {
+			t.Errorf("%s/%s: took %s", test.primary, test.fallback, elapsed)
+		}
+		if test.fails {
+			if err == nil || err.Error() != "can't connect to down" {
+				t.Errorf("%s/%s: error %v, expected that of the primary", test.primary, test.fallback, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s/%s: %v", test.primary, test.fallback, err)
+			continue
+		}
+		conn.Close()
+	}
+}
+
+func TestHappyEyeballsFallback(t *testing.T) {
+	target := ScanTarget{IP: net.ParseIP("192.0.2.1"), fallbackIP: net.ParseIP("2001:db8::1")}
+	if fallback := target.happyEyeballsFallback("192.0.2.1:80"); fallback != "" {
+		t.Errorf("fallback %s without --happy-eyeballs", fallback)
+	}
+	target.dialOpts = &dialOptions{happyEyeballsDelay: 250 * time.Millisecond}
+	if fallback := target.happyEyeballsFallback("192.0.2.1:80"); fallback != "[2001:db8::1]:80" {
+		t.Errorf("got fallback %q", fallback)
+	}
+	if fallback := target.happyEyeballsFallback("192.0.2.2:80"); fallback != "" {
+		t.Errorf("fallback %s for another address", fallback)
+	}
+}
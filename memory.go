@@ -0,0 +1,195 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// memoryHighWater and memoryLowWater are the fractions of --max-memory
+	// at which load shedding starts and stops.
+	memoryHighWater = 0.9
+	memoryLowWater  = 0.75
+
+	// memoryPollInterval is how often the RSS is checked.
+	memoryPollInterval = 250 * time.Millisecond
+
+	// sheddingReadLimitDivisor divides the per-connection read limit of
+	// connections opened while shedding load.
+	sheddingReadLimitDivisor = 4
+
+	// sheddingMaxResult is the largest encoded result kept while shedding
+	// load; larger ones are replaced by a memory-limit status.
+	sheddingMaxResult = 64 * 1024
+)
+
+// memoryGovernor keeps the process below --max-memory. Above the high water
+// mark it sheds load until the RSS drops below the low water mark: only one
+// target is scanned at a time, new connections get a smaller read limit,
+// oversized results are dropped, and freed memory is returned to the OS.
+type memoryGovernor struct {
+	limit uint64
+	rss   func() (uint64, error)
+
+	// shedding is 1 while shedding load; it is read without the mutex by
+	// bytesReadLimit and shedResult.
+	shedding int32
+
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	active int
+
+	dropped uint64
+}
+
+func newMemoryGovernor(limit uint64) *memoryGovernor {
+	g := &memoryGovernor{limit: limit, rss: processRSS}
+	g.cond = sync.NewCond(&g.mutex)
+	return g
+}
+
+// processRSS returns the resident set size of the process, from
+// /proc/self/statm where available, or the memory obtained from the OS by
+// the Go runtime otherwise.
+func processRSS() (uint64, error) {
+	if data, err := ioutil.ReadFile("/proc/self/statm"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) >= 2 {
+			pages, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return pages * uint64(os.Getpagesize()), nil
+		}
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys, nil
+}
+
+// isShedding reports whether the governor is shedding load; a nil governor
+// never is.
+func (g *memoryGovernor) isShedding() bool {
+	return g != nil && atomic.LoadInt32(&g.shedding) == 1
+}
+
+// check reads the RSS and starts or stops shedding load.
+func (g *memoryGovernor) check() {
+	rss, err := g.rss()
+	if err != nil {
+		log.Debugf("could not read RSS: %v", err)
+		return
+	}
+	shedding := g.isShedding()
+	switch {
+	case !shedding && float64(rss) >= memoryHighWater*float64(g.limit):
+		log.Warnf("RSS %d MB is close to --max-memory %d MB, shedding load", rss>>20, g.limit>>20)
+		g.setShedding(true)
+		debug.FreeOSMemory()
+	case shedding && float64(rss) < memoryLowWater*float64(g.limit):
+		log.Infof("RSS %d MB is back under the limit, resuming (%d results dropped so far)", rss>>20, atomic.LoadUint64(&g.dropped))
+		g.setShedding(false)
+	case shedding:
+		debug.FreeOSMemory()
+	}
+}
+
+func (g *memoryGovernor) setShedding(shedding bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if shedding {
+		atomic.StoreInt32(&g.shedding, 1)
+	} else {
+		atomic.StoreInt32(&g.shedding, 0)
+	}
+	g.cond.Broadcast()
+}
+
+// run polls the RSS until done is closed.
+func (g *memoryGovernor) run(done <-chan struct{}) {
+	ticker := time.NewTicker(memoryPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			g.check()
+		}
+	}
+}
+
+// acquire blocks while load is being shed and another target is in flight.
+// Letting one through keeps the scan progressing if the RSS never drops.
+func (g *memoryGovernor) acquire() {
+	if g == nil {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for g.isShedding() && g.active > 0 {
+		g.cond.Wait()
+	}
+	g.active++
+}
+
+// release marks a target acquired with acquire as done.
+func (g *memoryGovernor) release() {
+	if g == nil {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.active--
+	g.cond.Broadcast()
+}
+
+// shedResult returns the encoded result, or, while shedding load, a
+// replacement with the status memory-limit and no module results if it is
+// larger than sheddingMaxResult. The size is that of the encoded result,
+// which is not encoded again; only the small replacement is.
+func (g *memoryGovernor) shedResult(grab *Grab, encoded []byte) []byte {
+	if !g.isShedding() || len(encoded) <= sheddingMaxResult {
+		return encoded
+	}
+	atomic.AddUint64(&g.dropped, 1)
+	shed := &ErrorDetail{
+		Category: ERROR_MEMORY_LIMIT,
+		Message:  fmt.Sprintf("result of %d bytes dropped to stay under --max-memory", len(encoded)),
+	}
+	data := make(map[string]ScanResponse, len(grab.Data))
+	for name, res := range grab.Data {
+		data[name] = ScanResponse{
+			Status:    SCAN_MEMORY_LIMIT,
+			Protocol:  res.Protocol,
+			Timestamp: res.Timestamp,
+			Timing:    res.Timing,
+			Error:     shed,
+		}
+	}
+	ret, err := json.Marshal(&Grab{IP: grab.IP, Domain: grab.Domain, Port: grab.Port, Data: data, SchemaVersion: grab.SchemaVersion})
+	if err != nil {
+		return encoded
+	}
+	return ret
+}
+
+// bytesReadLimit returns the read limit for new connections without an
+// explicit one: DefaultBytesReadLimit, reduced while shedding load.
+func (g *memoryGovernor) bytesReadLimit() int {
+	if g.isShedding() {
+		return DefaultBytesReadLimit / sheddingReadLimitDivisor
+	}
+	return DefaultBytesReadLimit
+}
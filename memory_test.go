@@ -0,0 +1,109 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryGovernor(t *testing.T) {
+	g := newMemoryGovernor(100 << 20)
+	var rss uint64
+	g.rss = func() (uint64, error) { return rss, nil }
+
+	rss = 80 << 20
+	g.check()
+	if g.isShedding() {
+		t.Fatal("shedding under the high water mark")
+	}
+	rss = 95 << 20
+	g.check()
+	if !g.isShedding() {
+		t.Fatal("not shedding over the high water mark")
+	}
+	rss = 80 << 20
+	g.check()
+	if !g.isShedding() {
+		t.Fatal("stopped shedding above the low water mark")
+	}
+
+	// Only one target is let through while shedding.
+	g.acquire()
+	acquired := make(chan struct{})
+	go func() {
+		g.acquire()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second target let through while shedding")
+	case <-time.After(50 * time.Millisecond):
+	}
+	rss = 50 << 20
+	g.check()
+	if g.isShedding() {
+		t.Fatal("still shedding under the low water mark")
+	}
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second target not let through after shedding stopped")
+	}
+	g.release()
+	g.release()
+}
+
+func TestMemoryGovernorShedResult(t *testing.T) {
+	g := newMemoryGovernor(100 << 20)
+	grab := &Grab{IP: "192.0.2.1", Data: map[string]ScanResponse{"http": {Status: SCAN_SUCCESS, Protocol: "http", Result: strings.Repeat("x", 2*sheddingMaxResult)}}}
+	encoded, _ := json.Marshal(grab)
+	if string(g.shedResult(grab, encoded)) != string(encoded) {
+		t.Error("result dropped while not shedding")
+	}
+
+	g.shedding = 1
+	var shed Grab
+	if err := json.Unmarshal(g.shedResult(grab, encoded), &shed); err != nil {
+		t.Fatal(err)
+	}
+	res := shed.Data["http"]
+	if shed.IP != "192.0.2.1" || res.Status != SCAN_MEMORY_LIMIT || res.Result != nil || res.Error == nil {
+		t.Errorf("unexpected shed result %+v", shed)
+	}
+	small := []byte(`{"ip":"192.0.2.1"}`)
+	if string(g.shedResult(grab, small)) != string(small) {
+		t.Error("small result dropped")
+	}
+
+	target := &ScanTarget{memory: g}
+	if limit := target.bytesReadLimit(0); limit != DefaultBytesReadLimit/sheddingReadLimitDivisor {
+		t.Errorf("read limit not reduced while shedding: %d", limit)
+	}
+	if limit := target.bytesReadLimit(1024); limit != 1024 {
+		t.Errorf("explicit read limit changed while shedding: %d", limit)
+	}
+	target.memory = nil
+	if limit := target.bytesReadLimit(0); limit != DefaultBytesReadLimit {
+		t.Errorf("read limit changed without --max-memory: %d", limit)
+	}
+}
+
+func TestRunnerMaxMemory(t *testing.T) {
+	opts := RunnerOptions{
+		Input:     func(chan<- ScanTarget) error { return nil },
+		Output:    func(*Grab) {},
+		MaxMemory: 100,
+	}
+	runner, err := NewRunner(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runner.memory == nil || runner.memory.limit != 100<<20 {
+		t.Errorf("unexpected memory governor %+v", runner.memory)
+	}
+	opts.MaxMemory = -1
+	if _, err := NewRunner(opts); err == nil {
+		t.Error("negative MaxMemory accepted")
+	}
+}
@@ -1,6 +1,9 @@
 package zgrab2
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // Scanner is an interface that represents all functions necessary to run a scan
 type Scanner interface {
@@ -24,6 +27,27 @@ type Scanner interface {
 	Scan(t ScanTarget) (ScanStatus, interface{}, error)
 }
 
+// ScannerContext is a Scanner whose scans take a context, which is done when
+// the scan is abandoned by the watchdog or --target-timeout, or the scan is
+// interrupted. The framework calls ScanContext instead of Scan; the target's
+// Ctx returns the same context.
+type ScannerContext interface {
+	Scanner
+
+	// ScanContext connects to a host, returning early when ctx is done.
+	ScanContext(ctx context.Context, t ScanTarget) (ScanStatus, interface{}, error)
+}
+
+// ScannerPreview is a Scanner that can tell what its scans would send,
+// without connecting, for --dry-run.
+type ScannerPreview interface {
+	Scanner
+
+	// Preview returns the messages the scan of t would send first, in
+	// order.
+	Preview(t ScanTarget) ([]*ProbePreview, error)
+}
+
 // ScanResponse is the result of a scan on a single host
 type ScanResponse struct {
 	// Status is required for all responses.
@@ -35,7 +59,24 @@ type ScanResponse struct {
 
 	Result    interface{} `json:"result,omitempty"`
 	Timestamp string      `json:"timestamp,omitempty"`
-	Error     *string     `json:"error,omitempty"`
+
+	// Error is set if the scan failed.
+	Error *ErrorDetail `json:"error,omitempty"`
+
+	// Timing is the timing of the scan and of its connections.
+	Timing *Timing `json:"timing,omitempty"`
+
+	// LocalAddrs are the local addresses of the scan's connections, with
+	// --record-local-addr.
+	LocalAddrs []string `json:"local_addrs,omitempty"`
+
+	// ChainedFrom is the scanner whose result ran this one through
+	// --chain-rules.
+	ChainedFrom string `json:"chained_from,omitempty"`
+
+	// Fingerprints are the recog fingerprints matching the result, with
+	// --recog-dir.
+	Fingerprints []*RecogMatch `json:"fingerprints,omitempty"`
 }
 
 // ScanModule is an interface which represents a module that the framework can
@@ -72,6 +113,7 @@ type BaseFlags struct {
 	Timeout        time.Duration `short:"t" long:"timeout" description:"Set connection timeout (0 = no timeout)" default:"10s"`
 	Trigger        string        `short:"g" long:"trigger" description:"Invoke only on targets with specified tag"`
 	BytesReadLimit int           `short:"m" long:"maxbytes" description:"Maximum byte read limit per scan (0 = defaults)"`
+	MaxRuntime     time.Duration `long:"max-runtime" description:"Abandon a scan of this module that runs longer than this, even if it ignores its timeouts (overrides --watchdog-timeout)"`
 }
 
 // UDPFlags contains the common options used for all UDP scans
@@ -85,6 +127,26 @@ func (b *BaseFlags) GetName() string {
 	return b.Name
 }
 
+// GetPort returns the default port of the respective scanner
+func (b *BaseFlags) GetPort() uint {
+	return b.Port
+}
+
+// GetMaxRuntime returns the --max-runtime of the respective scanner
+func (b *BaseFlags) GetMaxRuntime() time.Duration {
+	return b.MaxRuntime
+}
+
+// ResultSchemaModule is implemented by the modules that declare the type of
+// their results, which `zgrab2 schema` describes.
+type ResultSchemaModule interface {
+	ScanModule
+
+	// NewResult returns a new value of the type of the results returned by
+	// the module's scanners.
+	NewResult() interface{}
+}
+
 // GetModule returns the registered module that corresponds to the given name
 // or nil otherwise
 func GetModule(name string) ScanModule {
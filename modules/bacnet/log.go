@@ -1,6 +1,10 @@
 package bacnet
 
-import "net"
+import (
+	"net"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
 
 type Log struct {
 	IsBACNet                    bool   `json:"is_bacnet"`
@@ -13,6 +17,22 @@ type Log struct {
 	ModelName                   string `json:"model_name,omitempty"`
 	Description                 string `json:"description,omitempty"`
 	Location                    string `json:"location,omitempty"`
+
+	// Properties are the device object properties read with --properties.
+	Properties []*PropertyResult `json:"properties,omitempty"`
+
+	// WhoIs lists the devices that answered the Who-Is broadcast (--who-is).
+	WhoIs *WhoIsResult `json:"who_is,omitempty"`
+
+	// ICSDevice summarizes the fields above.
+	ICSDevice *zgrab2.ICSDevice `json:"ics_device,omitempty"`
+}
+
+// setICSDevice fills in the ICSDevice from the properties read so far.
+func (log *Log) setICSDevice() {
+	if log.IsBACNet {
+		log.ICSDevice = zgrab2.NewICSDevice("bacnet", log.VendorName, log.ModelName, log.FirmwareRevision, "")
+	}
 }
 
 func (log *Log) sendReadProperty(c net.Conn, oid ObjectID, pid PropertyID) ([]byte, error, bool) {
@@ -0,0 +1,336 @@
+package bacnet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// APDU types, in the high nibble of APDU.TypeAndFlags.
+const (
+	APDU_TYPE_UNCONFIRMED_REQUEST byte = 0x1
+	APDU_TYPE_COMPLEX_ACK         byte = 0x3
+	APDU_TYPE_ERROR               byte = 0x5
+	APDU_TYPE_REJECT              byte = 0x6
+	APDU_TYPE_ABORT               byte = 0x7
+)
+
+const (
+	PID_MAX_APDU_LENGTH_ACCEPTED    PropertyID = 0x3e
+	PID_OBJECT_LIST                 PropertyID = 0x4c
+	PID_PROTOCOL_OBJECT_TYPES       PropertyID = 0x60
+	PID_PROTOCOL_SERVICES_SUPPORTED PropertyID = 0x61
+	PID_PROTOCOL_VERSION            PropertyID = 0x62
+	PID_SEGMENTATION_SUPPORTED      PropertyID = 0x6b
+	PID_SYSTEM_STATUS               PropertyID = 0x70
+	PID_PROTOCOL_REVISION           PropertyID = 0x8b
+	PID_DATABASE_REVISION           PropertyID = 0x9b
+)
+
+// deviceProperty is a device object property that can be read with
+// --properties.
+type deviceProperty struct {
+	id PropertyID
+
+	// size is set to read array index 0, the size of the array.
+	size bool
+
+	// names, if set, names the bits of a bit string, or the values of an
+	// enumeration.
+	names []string
+}
+
+// servicesSupported names the bits of BACnetServicesSupported.
+var servicesSupported = []string{
+	"acknowledge-alarm", "confirmed-cov-notification", "confirmed-event-notification",
+	"get-alarm-summary", "get-enrollment-summary", "subscribe-cov", "atomic-read-file",
+	"atomic-write-file", "add-list-element", "remove-list-element", "create-object",
+	"delete-object", "read-property", "read-property-conditional", "read-property-multiple",
+	"write-property", "write-property-multiple", "device-communication-control",
+	"confirmed-private-transfer", "confirmed-text-message", "reinitialize-device",
+	"vt-open", "vt-close", "vt-data", "authenticate", "request-key", "i-am", "i-have",
+	"unconfirmed-cov-notification", "unconfirmed-event-notification",
+	"unconfirmed-private-transfer", "unconfirmed-text-message", "time-synchronization",
+	"who-has", "who-is", "read-range", "utc-time-synchronization", "life-safety-operation",
+	"subscribe-cov-property", "get-event-information", "write-group",
+	"subscribe-cov-property-multiple", "confirmed-cov-notification-multiple",
+	"unconfirmed-cov-notification-multiple",
+}
+
+// deviceProperties are the properties that can be read with --properties.
+var deviceProperties = map[string]deviceProperty{
+	"object-list-size":                {id: PID_OBJECT_LIST, size: true},
+	"location":                        {id: PID_LOCATION},
+	"description":                     {id: PID_DESCRIPTION},
+	"firmware-revision":               {id: PID_FIRMWARE_REVISION},
+	"application-software-revision":   {id: PID_APPLICATION_SOFTWARE_REVISION},
+	"model-name":                      {id: PID_MODEL_NAME},
+	"vendor-name":                     {id: PID_VENDOR_NAME},
+	"object-name":                     {id: PID_OBJECT_NAME},
+	"protocol-version":                {id: PID_PROTOCOL_VERSION},
+	"protocol-revision":               {id: PID_PROTOCOL_REVISION},
+	"protocol-services-supported":     {id: PID_PROTOCOL_SERVICES_SUPPORTED, names: servicesSupported},
+	"protocol-object-types-supported": {id: PID_PROTOCOL_OBJECT_TYPES},
+	"max-apdu-length-accepted":        {id: PID_MAX_APDU_LENGTH_ACCEPTED},
+	"segmentation-supported": {id: PID_SEGMENTATION_SUPPORTED, names: []string{
+		"segmented-both", "segmented-transmit", "segmented-receive", "no-segmentation",
+	}},
+	"system-status": {id: PID_SYSTEM_STATUS, names: []string{
+		"operational", "operational-read-only", "download-required",
+		"download-in-progress", "non-operational", "backup-in-progress",
+	}},
+	"database-revision": {id: PID_DATABASE_REVISION},
+}
+
+// parsePropertyNames parses the comma-separated --properties list.
+func parsePropertyNames(value string) ([]string, error) {
+	var ret []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := deviceProperties[name]; !ok {
+			return nil, fmt.Errorf("unknown BACnet property %q", name)
+		}
+		ret = append(ret, name)
+	}
+	return ret, nil
+}
+
+// PropertyResult is the value of a device object property read with
+// --properties.
+type PropertyResult struct {
+	Name string `json:"name"`
+
+	// Value is the decoded value: a string, a number, a list of the names of
+	// the set bits of a bit string, or the name of an enumerated value.
+	Value interface{} `json:"value,omitempty"`
+
+	// Error is the BACnet error, reject or abort returned by the device, or
+	// the error reading the property.
+	Error string `json:"error,omitempty"`
+}
+
+// BACnetError is an Error PDU returned in response to a confirmed request.
+type BACnetError struct {
+	Class uint32
+	Code  uint32
+}
+
+// Error implements the error interface.
+func (err *BACnetError) Error() string {
+	return fmt.Sprintf("BACnet error class %d code %d", err.Class, err.Code)
+}
+
+// readProperty reads a property of the device object and returns the encoded
+// value, without the opening and closing tags.
+func readProperty(c net.Conn, property deviceProperty) ([]byte, error) {
+	req := NewReadPropertyRequest(OID_ANY, property.id)
+	b, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if property.size {
+		// Array index 0, as context tag 2.
+		b = append(b, 0x29, 0x00)
+	}
+	if err := SendVLC(c, b); err != nil {
+		return nil, err
+	}
+	_, _, apdu, body, err, _ := ReadVLC(c)
+	if err != nil {
+		return nil, err
+	}
+	switch apdu.TypeAndFlags >> 4 {
+	case APDU_TYPE_COMPLEX_ACK:
+	case APDU_TYPE_ERROR:
+		var class, code interface{}
+		if class, body, err = decodeApplicationValue(body); err != nil {
+			return nil, err
+		}
+		if code, _, err = decodeApplicationValue(body); err != nil {
+			return nil, err
+		}
+		classValue, _ := class.(uint32)
+		codeValue, _ := code.(uint32)
+		return nil, &BACnetError{Class: classValue, Code: codeValue}
+	case APDU_TYPE_REJECT:
+		return nil, fmt.Errorf("BACnet reject reason %d", apdu.ServerChoice)
+	case APDU_TYPE_ABORT:
+		return nil, fmt.Errorf("BACnet abort reason %d", apdu.ServerChoice)
+	default:
+		return nil, errInvalidPacket
+	}
+	r := new(ReadProperty)
+	if body, err = r.Unmarshal(body); err != nil {
+		return nil, err
+	}
+	// Skip the array index.
+	if len(body) > 0 && body[0]&0xf8 == 0x28 {
+		length := int(body[0] & 0x07)
+		if len(body) < 1+length {
+			return nil, errBACNetPacketTooShort
+		}
+		body = body[1+length:]
+	}
+	if len(body) < 2 || body[0] != 0x3e || body[len(body)-1] != 0x3f {
+		return nil, errInvalidPacket
+	}
+	return body[1 : len(body)-1], nil
+}
+
+// decodeApplicationValue decodes an application-tagged value, and returns the
+// value and the rest of b.
+func decodeApplicationValue(b []byte) (value interface{}, rest []byte, err error) {
+	if len(b) < 1 {
+		return nil, b, errBACNetPacketTooShort
+	}
+	if b[0]&0x08 != 0 {
+		// Context-specific tag.
+		return nil, b, errInvalidPacket
+	}
+	tag := b[0] >> 4
+	length := int(b[0] & 0x07)
+	b = b[1:]
+	if tag == 1 {
+		// The value of a boolean is in the length bits.
+		return length != 0, b, nil
+	}
+	if length == 5 {
+		if len(b) < 1 {
+			return nil, b, errBACNetPacketTooShort
+		}
+		length = int(b[0])
+		b = b[1:]
+		if length == 254 {
+			if len(b) < 2 {
+				return nil, b, errBACNetPacketTooShort
+			}
+			length = int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+		}
+	}
+	if len(b) < length {
+		return nil, b, errBACNetPacketTooShort
+	}
+	data, rest := b[:length], b[length:]
+	switch tag {
+	case 0:
+		return nil, rest, nil
+	case 2, 9:
+		// Unsigned and enumerated.
+		var v uint32
+		for _, c := range data {
+			v = v<<8 | uint32(c)
+		}
+		return v, rest, nil
+	case 3:
+		var v int32
+		for i, c := range data {
+			if i == 0 {
+				v = int32(int8(c))
+			} else {
+				v = v<<8 | int32(c)
+			}
+		}
+		return v, rest, nil
+	case 4:
+		if length != 4 {
+			return nil, rest, errInvalidPacket
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(data)), rest, nil
+	case 5:
+		if length != 8 {
+			return nil, rest, errInvalidPacket
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), rest, nil
+	case 6:
+		return data, rest, nil
+	case 7:
+		// The first byte is the character set.
+		if length < 1 {
+			return nil, rest, errInvalidPacket
+		}
+		return string(data[1:]), rest, nil
+	case 8:
+		return bitString(data), rest, nil
+	case 12:
+		if length != 4 {
+			return nil, rest, errInvalidPacket
+		}
+		oid := binary.BigEndian.Uint32(data)
+		return fmt.Sprintf("%d:%d", oid>>22, oid&0x3fffff), rest, nil
+	}
+	// Date, time and reserved tags are returned raw.
+	return data, rest, nil
+}
+
+// bitString returns the numbers of the set bits of an encoded bit string,
+// whose first byte is the number of unused bits in the last byte.
+func bitString(data []byte) []int {
+	ret := []int{}
+	if len(data) < 1 {
+		return ret
+	}
+	bits := 8*(len(data)-1) - int(data[0]&0x07)
+	for i := 0; i < bits; i++ {
+		if data[1+i/8]&(0x80>>uint(i%8)) != 0 {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// propertyValue decodes the value of a property, naming the bits of bit
+// strings and the values of enumerations where known.
+func propertyValue(property deviceProperty, b []byte) (interface{}, error) {
+	value, _, err := decodeApplicationValue(b)
+	if err != nil || property.names == nil {
+		return value, err
+	}
+	switch v := value.(type) {
+	case []int:
+		names := make([]string, len(v))
+		for i, bit := range v {
+			names[i] = valueName(property.names, bit)
+		}
+		return names, nil
+	case uint32:
+		return valueName(property.names, int(v)), nil
+	}
+	return value, nil
+}
+
+// valueName returns the name of a bit or enumerated value, or its number.
+func valueName(names []string, i int) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return strconv.Itoa(i)
+}
+
+// QueryProperties reads the named device object properties. Errors returned
+// by the device are recorded per property; it stops at the first network
+// error.
+func (log *Log) QueryProperties(c net.Conn, names []string) error {
+	for _, name := range names {
+		result := &PropertyResult{Name: name}
+		log.Properties = append(log.Properties, result)
+		property := deviceProperties[name]
+		b, err := readProperty(c, property)
+		if err == nil {
+			result.Value, err = propertyValue(property, b)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			if _, ok := err.(net.Error); ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package bacnet
+
+import (
+	"net"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type PropertiesSuite struct {
+}
+
+var _ = Suite(&PropertiesSuite{})
+
+func (s *PropertiesSuite) TestDecodeApplicationValue(c *C) {
+	tests := []struct {
+		encoded []byte
+		value   interface{}
+	}{
+		{[]byte{0x21, 0x2a}, uint32(42)},
+		{[]byte{0x22, 0x05, 0xc4}, uint32(1476)},
+		{[]byte{0x91, 0x03}, uint32(3)},
+		{[]byte{0x31, 0xff}, int32(-1)},
+		{[]byte{0x11}, true},
+		{[]byte{0x75, 0x06, 0x00, 'R', 'o', 'o', 'f', '2'}, "Roof2"},
+		{[]byte{0xc4, 0x02, 0x00, 0x00, 0x07}, "8:7"},
+		{[]byte{0x82, 0x05, 0xa0}, []int{0, 2}},
+	}
+	for _, test := range tests {
+		value, rest, err := decodeApplicationValue(test.encoded)
+		c.Assert(err, IsNil)
+		c.Check(value, DeepEquals, test.value)
+		c.Check(len(rest), Equals, 0)
+	}
+	_, _, err := decodeApplicationValue([]byte{0x75, 0x06, 0x00})
+	c.Check(err, Equals, errBACNetPacketTooShort)
+}
+
+func (s *PropertiesSuite) TestPropertyValue(c *C) {
+	// read-property (12), who-is (34) and read-range (35).
+	b := []byte{0x85, 0x06, 0x01, 0x00, 0x08, 0x00, 0x00, 0x30}
+	value, err := propertyValue(deviceProperties["protocol-services-supported"], b)
+	c.Assert(err, IsNil)
+	c.Check(value, DeepEquals, []string{"read-property", "who-is", "read-range"})
+	value, err = propertyValue(deviceProperties["system-status"], []byte{0x91, 0x00})
+	c.Assert(err, IsNil)
+	c.Check(value, Equals, "operational")
+}
+
+func (s *PropertiesSuite) TestParsePropertyNames(c *C) {
+	names, err := parsePropertyNames("object-list-size, location")
+	c.Assert(err, IsNil)
+	c.Check(names, DeepEquals, []string{"object-list-size", "location"})
+	_, err = parsePropertyNames("location,colour")
+	c.Check(err, NotNil)
+}
+
+// iAm returns an I-Am from device 1234, routed from network 5.
+func iAm() []byte {
+	return []byte{
+		0x81, 0x0b, 0x00, 0x1a,
+		0x01, 0x08, 0x00, 0x05, 0x01, 0x0c,
+		0x10, 0x00,
+		0xc4, 0x02, 0x00, 0x04, 0xd2,
+		0x22, 0x01, 0xe0,
+		0x91, 0x03,
+		0x21, 0x18,
+	}
+}
+
+func (s *PropertiesSuite) TestParseIAm(c *C) {
+	addr := &net.UDPAddr{IP: net.ParseIP("192.0.2.7"), Port: 47808}
+	device, err := parseIAm(iAm(), addr)
+	c.Assert(err, IsNil)
+	c.Check(*device, DeepEquals, IAm{
+		Address:        "192.0.2.7:47808",
+		Network:        5,
+		MACAddress:     "0c",
+		InstanceNumber: 1234,
+		MaxAPDULength:  480,
+		Segmentation:   "no-segmentation",
+		VendorID:       24,
+	})
+	_, err = parseIAm(whoIsBytes, addr)
+	c.Check(err, NotNil)
+}
+
+func (s *PropertiesSuite) TestQueryProperties(c *C) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer server.Close()
+	go func() {
+		b := make([]byte, MAX_BACNET_FRAME_LEN)
+		for {
+			n, addr, err := server.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			var response []byte
+			switch property := PropertyID(b[n-1]); {
+			case n > 2 && b[n-2] == 0x29:
+				// object-list-size: array index 0.
+				response = []byte{0x30, 0x01, 0x0c, 0x0c, 0x02, 0x3f, 0xff, 0xff, 0x19, byte(PID_OBJECT_LIST), 0x29, 0x00, 0x3e, 0x21, 0x11, 0x3f}
+			case property == PID_LOCATION:
+				// unknown-property.
+				response = []byte{0x50, 0x01, 0x0c, 0x91, 0x02, 0x91, 0x20}
+			}
+			vlc, _ := (&VLC{Type: VLC_TYPE_IP, Function: VLC_FUNCTION_UNICAST_NPDU, Length: uint16(6 + len(response))}).Marshal()
+			server.WriteTo(append(append(vlc, 0x01, 0x00), response...), addr)
+		}
+	}()
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	log := new(Log)
+	c.Assert(log.QueryProperties(conn, []string{"object-list-size", "location"}), IsNil)
+	c.Check(*log.Properties[0], DeepEquals, PropertyResult{Name: "object-list-size", Value: uint32(17)})
+	c.Check(*log.Properties[1], DeepEquals, PropertyResult{Name: "location", Error: "BACnet error class 2 code 32"})
+}
@@ -2,6 +2,14 @@
 // Default Port: 47808 / 0xBAC0 (UDP)
 //
 // Behavior and output copied identically from original zgrab.
+//
+// The --properties flag reads a comma-separated list of further device object
+// properties, e.g. object-list-size,protocol-services-supported.
+//
+// The --who-is flag first broadcasts a Who-Is to the target, usually the
+// broadcast address of a local network, and lists the devices that answer
+// with an I-Am; --local-port 47808 also catches I-Am responses that are
+// broadcast to the BACnet port.
 package bacnet
 
 import (
@@ -17,7 +25,9 @@ type Flags struct {
 	zgrab2.BaseFlags
 	zgrab2.UDPFlags
 
-	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	Verbose    bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	Properties string `long:"properties" description:"Comma-separated device object properties to read: object-list-size, location, description, firmware-revision, application-software-revision, model-name, vendor-name, object-name, protocol-version, protocol-revision, protocol-services-supported, protocol-object-types-supported, max-apdu-length-accepted, segmentation-supported, system-status, database-revision"`
+	WhoIs      bool   `long:"who-is" description:"Broadcast a Who-Is to the target address and list the devices that answer"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -27,6 +37,9 @@ type Module struct {
 // Scanner implements the zgrab2.Scanner interface.
 type Scanner struct {
 	config *Flags
+
+	// properties are the parsed --properties.
+	properties []string
 }
 
 // RegisterModule registers the zgrab2 module.
@@ -48,6 +61,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Log)
+}
+
 // Description returns text uses in the help for this module.
 func (module *Module) Description() string {
 	return "Probe for devices that speak Bacnet, commonly used for HVAC control."
@@ -57,6 +75,10 @@ func (module *Module) Description() string {
 // On success, returns nil.
 // On failure, returns an error instance describing the error.
 func (flags *Flags) Validate(args []string) error {
+	if _, err := parsePropertyNames(flags.Properties); err != nil {
+		log.Error(err)
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
@@ -69,6 +91,11 @@ func (flags *Flags) Help() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*Flags)
 	scanner.config = f
+	properties, err := parsePropertyNames(f.Properties)
+	if err != nil {
+		return err
+	}
+	scanner.properties = properties
 	return nil
 }
 
@@ -106,17 +133,30 @@ func (scanner *Scanner) Protocol() string {
 // 7. Model  name
 // 8. Description
 // 9. Location
+// 10. With --properties, the listed properties
 // The result is a bacnet.Log, and contains any of the above.
+// With --who-is, the Who-Is broadcast comes first; if any device answers, the
+// result is returned even if the target itself (e.g. a broadcast address)
+// does not answer.
 func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	ret := new(Log)
+	if scanner.config.WhoIs {
+		// Before opening the connection, which may use the same local port.
+		ret.WhoIs = scanner.WhoIs(&target)
+	}
 	conn, err := target.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	defer conn.Close()
-	ret := new(Log)
+	// The properties are read one by one, and any of them may fail.
+	defer ret.setICSDevice()
 	// TODO: if one fails, try others?
 	// TODO: distinguish protocol vs app errors
 	if err := ret.QueryDeviceID(conn); err != nil {
+		if ret.WhoIs != nil && len(ret.WhoIs.Devices) > 0 {
+			return zgrab2.SCAN_SUCCESS, ret, nil
+		}
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	if err := ret.QueryVendorNumber(conn); err != nil {
@@ -143,6 +183,9 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	if err := ret.QueryLocation(conn); err != nil {
 		return zgrab2.TryGetScanStatus(err), ret, nil
 	}
+	if err := ret.QueryProperties(conn, scanner.properties); err != nil {
+		return zgrab2.TryGetScanStatus(err), ret, nil
+	}
 
 	return zgrab2.SCAN_SUCCESS, ret, nil
 }
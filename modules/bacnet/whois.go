@@ -0,0 +1,200 @@
+package bacnet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// BVLC functions of broadcast and forwarded messages.
+const (
+	VLC_FUNCTION_FORWARDED_NPDU          byte = 0x04
+	VLC_FUNCTION_ORIGINAL_BROADCAST_NPDU byte = 0x0b
+)
+
+// Unconfirmed service choices.
+const (
+	SERVICE_CHOICE_I_AM   byte = 0x00
+	SERVICE_CHOICE_WHO_IS byte = 0x08
+)
+
+// NPDU control flags of the network layer addresses.
+const (
+	NPDU_FLAG_DNET_PRESENT byte = 0x20
+	NPDU_FLAG_SNET_PRESENT byte = 0x08
+)
+
+// OBJECT_TYPE_DEVICE is the object type of the device object.
+const OBJECT_TYPE_DEVICE = 8
+
+// maxIAmDevices bounds the number of I-Am responses collected for a Who-Is.
+const maxIAmDevices = 1024
+
+// defaultWhoIsWait is how long to wait for I-Am responses if no timeout is
+// set.
+const defaultWhoIsWait = 3 * time.Second
+
+// IAm is an I-Am response to the Who-Is broadcast.
+type IAm struct {
+	// Address is the address the response came from.
+	Address string `json:"address"`
+
+	// Network and MACAddress are the BACnet network number and MAC address
+	// of a device behind a router.
+	Network    uint16 `json:"network,omitempty"`
+	MACAddress string `json:"mac_address,omitempty"`
+
+	InstanceNumber uint32 `json:"instance_number"`
+	MaxAPDULength  uint32 `json:"max_apdu_length"`
+	Segmentation   string `json:"segmentation,omitempty"`
+	VendorID       uint32 `json:"vendor_id"`
+}
+
+// WhoIsResult is the list of devices that answered the Who-Is broadcast.
+type WhoIsResult struct {
+	Devices []*IAm `json:"devices,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// whoIsBytes is a Who-Is without range limits, broadcast on the local network.
+var whoIsBytes = []byte{
+	VLC_TYPE_IP, VLC_FUNCTION_ORIGINAL_BROADCAST_NPDU, 0x00, 0x08,
+	NPDU_VERSION_ASHRAE_135_1995, 0x00,
+	APDU_TYPE_UNCONFIRMED_REQUEST << 4, SERVICE_CHOICE_WHO_IS,
+}
+
+// parseIAm parses an I-Am response received from addr.
+func parseIAm(b []byte, addr net.Addr) (*IAm, error) {
+	vlc := new(VLC)
+	b, err := vlc.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	ret := &IAm{Address: addr.String()}
+	if vlc.Function == VLC_FUNCTION_FORWARDED_NPDU {
+		// A BBMD forwards the message with the original B/IP address.
+		if len(b) < 6 {
+			return nil, errBACNetPacketTooShort
+		}
+		ip := net.IP(b[0:4])
+		port := int(b[4])<<8 | int(b[5])
+		ret.Address = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+		b = b[6:]
+	}
+	npdu := new(NPDU)
+	if b, err = npdu.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	if npdu.Control&NPDU_FLAG_DNET_PRESENT != 0 {
+		if len(b) < 3 || len(b) < 3+int(b[2]) {
+			return nil, errBACNetPacketTooShort
+		}
+		b = b[3+int(b[2]):]
+	}
+	if npdu.Control&NPDU_FLAG_SNET_PRESENT != 0 {
+		if len(b) < 3 || len(b) < 3+int(b[2]) {
+			return nil, errBACNetPacketTooShort
+		}
+		ret.Network = uint16(b[0])<<8 | uint16(b[1])
+		ret.MACAddress = hex.EncodeToString(b[3 : 3+int(b[2])])
+		b = b[3+int(b[2]):]
+	}
+	if npdu.Control&NPDU_FLAG_DNET_PRESENT != 0 {
+		// Hop count.
+		if len(b) < 1 {
+			return nil, errBACNetPacketTooShort
+		}
+		b = b[1:]
+	}
+	if len(b) < 2 || b[0] != APDU_TYPE_UNCONFIRMED_REQUEST<<4 || b[1] != SERVICE_CHOICE_I_AM {
+		return nil, errInvalidPacket
+	}
+	// The device object identifier, then the max APDU length, segmentation
+	// and vendor ID.
+	if len(b) < 7 || b[2] != 0xc4 {
+		return nil, errInvalidPacket
+	}
+	oid := binary.BigEndian.Uint32(b[3:7])
+	if oid>>22 != OBJECT_TYPE_DEVICE {
+		return nil, errInvalidPacket
+	}
+	ret.InstanceNumber = oid & 0x3fffff
+	b = b[7:]
+	var values [3]interface{}
+	for i := range values {
+		if values[i], b, err = decodeApplicationValue(b); err != nil {
+			return nil, err
+		}
+	}
+	ret.MaxAPDULength, _ = values[0].(uint32)
+	if segmentation, ok := values[1].(uint32); ok {
+		ret.Segmentation = valueName(deviceProperties["segmentation-supported"].names, int(segmentation))
+	}
+	ret.VendorID, _ = values[2].(uint32)
+	return ret, nil
+}
+
+// WhoIs broadcasts a Who-Is to the target address, which is usually the
+// broadcast address of a local network, and collects the I-Am responses until
+// the timeout. The socket is not connected, so that responses from any
+// address are read; it is bound to --interface if set, and to the
+// --local-addr and --local-port, since devices may broadcast their I-Am to
+// port 47808.
+func (scanner *Scanner) WhoIs(target *zgrab2.ScanTarget) *WhoIsResult {
+	ret := new(WhoIsResult)
+	port := scanner.config.Port
+	if target.Port != nil {
+		port = *target.Port
+	}
+	remote := &net.UDPAddr{IP: target.IP, Port: int(port)}
+	local := &net.UDPAddr{Port: int(scanner.config.LocalPort)}
+	if scanner.config.LocalAddress != "" && scanner.config.LocalAddress != "*" {
+		local.IP = net.ParseIP(scanner.config.LocalAddress)
+	}
+	conn, err := target.ListenUDP(local)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer conn.Close()
+	if _, err := conn.WriteTo(whoIsBytes, remote); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	wait := scanner.config.Timeout
+	if wait <= 0 {
+		wait = defaultWhoIsWait
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(wait)); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	seen := make(map[string]bool)
+	b := make([]byte, MAX_BACNET_FRAME_LEN)
+	for len(ret.Devices) < maxIAmDevices {
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			if !zgrab2.IsTimeoutError(err) {
+				ret.Error = err.Error()
+			}
+			break
+		}
+		device, err := parseIAm(b[:n], addr)
+		if err != nil {
+			// Our own broadcast, or other traffic.
+			continue
+		}
+		key := fmt.Sprintf("%s/%d/%s/%d", device.Address, device.Network, device.MACAddress, device.InstanceNumber)
+		if !seen[key] {
+			seen[key] = true
+			ret.Devices = append(ret.Devices, device)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,85 @@
+package banner
+
+import "regexp"
+
+// classifyLength is how much of the banner GuessProtocol looks at.
+const classifyLength = 1024
+
+// protocolRules are tried in order against the start of the banner, read as
+// Latin-1 so that \xNN in a pattern matches the byte NN. More specific
+// rules come before the generic ones for the same greeting (e.g. 220).
+var protocolRules = []struct {
+	protocol string
+	regex    *regexp.Regexp
+}{
+	{"ssh", regexp.MustCompile(`^SSH-\d`)},
+	{"http", regexp.MustCompile(`^HTTP/\d`)},
+	{"rtsp", regexp.MustCompile(`^RTSP/\d`)},
+	{"sip", regexp.MustCompile(`^SIP/2\.0 `)},
+	{"vmware-auth", regexp.MustCompile(`^220 VMware Authentication Daemon`)},
+	{"dict", regexp.MustCompile(`^220 .*\bdictd\b`)},
+	{"nntp", regexp.MustCompile(`(?i)^20[01] .*\b(nntp|news|inn)\b`)},
+	{"smtp", regexp.MustCompile(`(?i)^(220|421|554)[ -].*\b(e?smtp|postfix|exim|sendmail|mail|mta)\b`)},
+	{"ftp", regexp.MustCompile(`(?i)^(220|421)[ -].*\b(ftp|filezilla|vsftpd|proftpd|pure-ftpd|serv-u)`)},
+	{"ftp", regexp.MustCompile(`^220[ -]`)},
+	{"pop3", regexp.MustCompile(`^\+OK`)},
+	{"imap", regexp.MustCompile(`^\* (OK|PREAUTH|BYE)\b`)},
+	{"telnet", regexp.MustCompile(`^\xff[\xfb-\xfe]`)},
+	{"vnc", regexp.MustCompile(`^RFB \d{3}\.\d{3}\n`)},
+	{"rsync", regexp.MustCompile(`^@RSYNCD: `)},
+	{"svn", regexp.MustCompile(`^\( success \( `)},
+	{"jdwp", regexp.MustCompile(`^JDWP-Handshake`)},
+	{"amqp", regexp.MustCompile(`^AMQP[\x00-\x03]`)},
+	{"nats", regexp.MustCompile(`^INFO \{`)},
+	{"xmpp", regexp.MustCompile(`(?s)^(<\?xml[^>]*>\s*)?<stream:(stream|error)`)},
+	{"irc", regexp.MustCompile(`^(:\S+ (NOTICE|0\d\d|ERROR) |NOTICE AUTH )`)},
+	{"asterisk-ami", regexp.MustCompile(`^Asterisk Call Manager/`)},
+	{"munin", regexp.MustCompile(`^# munin node at `)},
+	{"zabbix", regexp.MustCompile(`^ZBXD\x01`)},
+	{"teamspeak", regexp.MustCompile(`^TS3\r?\n`)},
+	{"quagga-vty", regexp.MustCompile(`^\r?\nHello, this is (Quagga|FRRouting)`)},
+	{"zookeeper", regexp.MustCompile(`^Zookeeper version: `)},
+	{"beanstalkd", regexp.MustCompile(`^UNKNOWN_COMMAND\r\n`)},
+	{"memcached", regexp.MustCompile(`^(STAT pid |ERROR\r\n$|VERSION \d)`)},
+	{"redis", regexp.MustCompile(`^(-ERR |-NOAUTH |-DENIED |-WRONGPASS |\+PONG\r\n|\$\d+\r\n# Server)`)},
+	{"stomp", regexp.MustCompile(`^(CONNECTED|ERROR)\r?\n\w+:`)},
+	{"pjl", regexp.MustCompile(`^@PJL`)},
+	{"fox", regexp.MustCompile(`^fox a \d+ -?\d+ fox hello`)},
+	{"mysql", regexp.MustCompile(`(?s)^...\x00\x0a\d+\.\d+`)},
+	{"mysql", regexp.MustCompile(`(?s)^...[\x00\x01]\xff..(#.{5})?Host '`)},
+	{"postgres", regexp.MustCompile(`(?s)^E\x00\x00..S(FATAL|ERROR)`)},
+	{"mongodb", regexp.MustCompile(`(?s)^.{12}\x01\x00\x00\x00.*ismaster`)},
+	{"smb", regexp.MustCompile(`(?s)^\x00...[\xff\xfe]SMB`)},
+	{"tls", regexp.MustCompile(`^[\x15\x16]\x03[\x00-\x04]`)},
+	{"socks5", regexp.MustCompile(`^\x05[\x00-\x02\xff]$`)},
+	{"socks4", regexp.MustCompile(`(?s)^\x00[\x5a-\x5d]......$`)},
+	{"s7", regexp.MustCompile(`(?s)^\x03\x00...\xd0.*\x32[\x01-\x07]`)},
+	{"rdp", regexp.MustCompile(`(?s)^\x03\x00..[\x06-\x13]\xd0`)},
+	{"tpkt", regexp.MustCompile(`(?s)^\x03\x00..`)},
+	{"bgp", regexp.MustCompile(`^\xff{16}`)},
+	{"dnp3", regexp.MustCompile(`^\x05\x64`)},
+	{"iec-104", regexp.MustCompile(`^\x68[\x04-\xfd]`)},
+	{"mqtt", regexp.MustCompile(`^\x20\x02\x00[\x00-\x05]`)},
+	{"x11", regexp.MustCompile(`(?s)^[\x00\x01]...\x0b\x00`)},
+	{"login-prompt", regexp.MustCompile(`(?i)\b(user ?name|login|password) ?: ?$`)},
+	{"html", regexp.MustCompile(`(?i)^\s*<(!doctype html|html)`)},
+}
+
+// GuessProtocol returns the protocol the banner most likely belongs to, or
+// the empty string.
+func GuessProtocol(banner []byte) string {
+	if len(banner) > classifyLength {
+		banner = banner[:classifyLength]
+	}
+	latin1 := make([]rune, len(banner))
+	for i, b := range banner {
+		latin1[i] = rune(b)
+	}
+	text := string(latin1)
+	for _, rule := range protocolRules {
+		if rule.regex.MatchString(text) {
+			return rule.protocol
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package banner
+
+import "testing"
+
+func TestGuessProtocol(t *testing.T) {
+	tests := []struct {
+		banner   string
+		protocol string
+	}{
+		{"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3\r\n", "ssh"},
+		{"HTTP/1.1 400 Bad Request\r\n", "http"},
+		{"220 mail.example.com ESMTP Postfix\r\n", "smtp"},
+		{"220 (vsFTPd 3.0.3)\r\n", "ftp"},
+		{"220 Welcome\r\n", "ftp"},
+		{"220 VMware Authentication Daemon Version 1.10\r\n", "vmware-auth"},
+		{"+OK Dovecot ready.\r\n", "pop3"},
+		{"* OK [CAPABILITY IMAP4rev1] ready\r\n", "imap"},
+		{"\xff\xfd\x18\xff\xfd\x20", "telnet"},
+		{"RFB 003.008\n", "vnc"},
+		{"-ERR unknown command '\\n'\r\n", "redis"},
+		{"-NOAUTH Authentication required.\r\n", "redis"},
+		{"J\x00\x00\x00\x0a8.0.32\x00", "mysql"},
+		{"E\x00\x00\x00\x50SFATAL\x00", "postgres"},
+		{"\x15\x03\x01\x00\x02\x02\x46", "tls"},
+		{"\x03\x00\x00\x13\x0e\xd0\x00\x00\x12\x34\x00", "rdp"},
+		{"\x00\x00\x00\x45\xffSMBr", "smb"},
+		{"\r\nUser Access Verification\r\n\r\nUsername: ", "login-prompt"},
+		{"<!DOCTYPE html><html>", "html"},
+		{"\x00\x01\x02 random", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if protocol := GuessProtocol([]byte(test.banner)); protocol != test.protocol {
+			t.Errorf("%q: got %q, expected %q", test.banner, protocol, test.protocol)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package banner
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// FuzzVariant is a single fuzz payload and the response it produced.
+type FuzzVariant struct {
+	// Kind is the name of the generator that produced the payload.
+	Kind string `json:"kind"`
+
+	Payload  []byte `json:"payload"`
+	Response []byte `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	// ResponseGroup identifies the distinct response this variant produced;
+	// variants with equal responses share a group. Variants without a response
+	// have group -1.
+	ResponseGroup int `json:"response_group"`
+}
+
+// FuzzResults holds the output of --fuzz mode.
+type FuzzResults struct {
+	// Seed is the seed used to generate the payloads, so that a run can be
+	// reproduced with --fuzz-seed.
+	Seed int64 `json:"seed"`
+
+	Variants []*FuzzVariant `json:"variants"`
+
+	// DistinctResponses is the number of different non-empty responses seen.
+	DistinctResponses int `json:"distinct_responses"`
+}
+
+type fuzzPayload struct {
+	kind string
+	data []byte
+}
+
+type fuzzGenerator struct {
+	kind     string
+	generate func(r *rand.Rand) []byte
+}
+
+const printable = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 !#$%&()*+,-./:;<=>?@[]^_{|}~"
+
+func randomBytes(r *rand.Rand, n int) []byte {
+	ret := make([]byte, n)
+	r.Read(ret)
+	return ret
+}
+
+func randomText(r *rand.Rand, n int) []byte {
+	ret := make([]byte, n)
+	for i := range ret {
+		ret[i] = printable[r.Intn(len(printable))]
+	}
+	return ret
+}
+
+// fuzzGenerators are cycled through in order, so that every run with at least
+// len(fuzzGenerators) variants covers each payload structure.
+var fuzzGenerators = []fuzzGenerator{
+	{"text-line", func(r *rand.Rand) []byte {
+		return append(randomText(r, 1+r.Intn(32)), '\r', '\n')
+	}},
+	{"random-bytes", func(r *rand.Rand) []byte {
+		return randomBytes(r, 1+r.Intn(64))
+	}},
+	{"length-prefixed-be16", func(r *rand.Rand) []byte {
+		body := randomBytes(r, r.Intn(64))
+		ret := make([]byte, 2, 2+len(body))
+		binary.BigEndian.PutUint16(ret, uint16(len(body)))
+		return append(ret, body...)
+	}},
+	{"length-prefixed-le32", func(r *rand.Rand) []byte {
+		body := randomBytes(r, r.Intn(64))
+		ret := make([]byte, 4, 4+len(body))
+		binary.LittleEndian.PutUint32(ret, uint32(len(body)))
+		return append(ret, body...)
+	}},
+	{"tlv", func(r *rand.Rand) []byte {
+		var ret []byte
+		for i := 0; i < 1+r.Intn(4); i++ {
+			value := randomBytes(r, r.Intn(16))
+			ret = append(ret, byte(r.Intn(256)), byte(len(value)))
+			ret = append(ret, value...)
+		}
+		return ret
+	}},
+	{"command-line", func(r *rand.Rand) []byte {
+		commands := []string{"HELP", "INFO", "VERSION", "STATUS", "GET / HTTP/1.0", "?", "LIST", "QUIT"}
+		line := commands[r.Intn(len(commands))]
+		if r.Intn(2) == 0 {
+			line += " " + string(randomText(r, 1+r.Intn(8)))
+		}
+		return []byte(line + "\r\n\r\n")
+	}},
+	{"null-bytes", func(r *rand.Rand) []byte {
+		return make([]byte, 1+r.Intn(32))
+	}},
+	{"long-line", func(r *rand.Rand) []byte {
+		return append(randomText(r, 512+r.Intn(1536)), '\n')
+	}},
+}
+
+// generateFuzzPayloads returns count payloads derived deterministically from
+// seed.
+func generateFuzzPayloads(seed int64, count int) []fuzzPayload {
+	r := rand.New(rand.NewSource(seed))
+	ret := make([]fuzzPayload, count)
+	for i := range ret {
+		gen := fuzzGenerators[i%len(fuzzGenerators)]
+		ret[i] = fuzzPayload{kind: gen.kind, data: gen.generate(r)}
+	}
+	return ret
+}
+
+func (scanner *Scanner) initFuzz() {
+	if scanner.config.FuzzSeed == 0 {
+		scanner.config.FuzzSeed = time.Now().UnixNano()
+	}
+	scanner.fuzzPayloads = generateFuzzPayloads(scanner.config.FuzzSeed, scanner.config.FuzzCount)
+}
+
+// sendFuzzPayload sends a single payload on a fresh connection and reads the
+// response.
+func (scanner *Scanner) sendFuzzPayload(target *zgrab2.ScanTarget, payload []byte) ([]byte, error) {
+	conn, err := target.Open(&scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if scanner.config.UseTLS {
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(conn)
+		if err != nil {
+			return nil, err
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return nil, err
+	}
+	response, _, err := scanner.readResponse(conn)
+	if err == io.EOF {
+		err = nil
+	}
+	return response, err
+}
+
+// fuzz sends each of the run's fuzz payloads to the target and groups the
+// variants by the response they produced.
+func (scanner *Scanner) fuzz(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	result := &FuzzResults{Seed: scanner.config.FuzzSeed}
+	groups := make(map[[sha256.Size]byte]int)
+	var lastErr error
+	for _, payload := range scanner.fuzzPayloads {
+		variant := &FuzzVariant{Kind: payload.kind, Payload: payload.data, ResponseGroup: -1}
+		result.Variants = append(result.Variants, variant)
+		response, err := scanner.sendFuzzPayload(&target, payload.data)
+		if err != nil {
+			variant.Error = err.Error()
+			lastErr = err
+		}
+		if len(response) == 0 {
+			continue
+		}
+		variant.Response = response
+		digest := sha256.Sum256(response)
+		group, ok := groups[digest]
+		if !ok {
+			group = len(groups)
+			groups[digest] = group
+		}
+		variant.ResponseGroup = group
+	}
+	result.DistinctResponses = len(groups)
+	if len(groups) == 0 && lastErr != nil {
+		return zgrab2.TryGetScanStatus(lastErr), &Results{Fuzz: result}, lastErr
+	}
+	return zgrab2.SCAN_SUCCESS, &Results{Fuzz: result}, nil
+}
@@ -0,0 +1,88 @@
+package banner
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestGenerateFuzzPayloads(t *testing.T) {
+	payloads := generateFuzzPayloads(42, 2*len(fuzzGenerators))
+	again := generateFuzzPayloads(42, 2*len(fuzzGenerators))
+	other := generateFuzzPayloads(43, 2*len(fuzzGenerators))
+	differs := false
+	for i, payload := range payloads {
+		if payload.kind != fuzzGenerators[i%len(fuzzGenerators)].kind {
+			t.Errorf("payload %d: kind %s", i, payload.kind)
+		}
+		if payload.kind != again[i].kind || !bytes.Equal(payload.data, again[i].data) {
+			t.Errorf("payload %d differs with the same seed", i)
+		}
+		if !bytes.Equal(payload.data, other[i].data) {
+			differs = true
+		}
+	}
+	if !differs {
+		t.Error("the payloads of different seeds are equal")
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// The server answers the payloads ending a line, and the others,
+	// differently.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 4096)
+			n, _ := conn.Read(buf)
+			if bytes.HasSuffix(buf[:n], []byte("\n")) {
+				conn.Write([]byte("line\n"))
+			} else {
+				conn.Write([]byte("binary\n"))
+			}
+			conn.Close()
+		}
+	}()
+
+	scanner := new(Scanner)
+	flags := &Flags{Fuzz: true, FuzzCount: len(fuzzGenerators), FuzzSeed: 42}
+	flags.Port = uint(listener.Addr().(*net.TCPAddr).Port)
+	flags.Timeout = time.Second
+	if err := scanner.Init(flags); err != nil {
+		t.Fatal(err)
+	}
+	status, res, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	fuzz := res.(*Results).Fuzz
+	if fuzz.Seed != 42 || len(fuzz.Variants) != len(fuzzGenerators) || fuzz.DistinctResponses != 2 {
+		t.Fatalf("got seed %d, %d variants, %d distinct responses", fuzz.Seed, len(fuzz.Variants), fuzz.DistinctResponses)
+	}
+	groups := make(map[string]int)
+	for _, variant := range fuzz.Variants {
+		want := "binary\n"
+		if bytes.HasSuffix(variant.Payload, []byte("\n")) {
+			want = "line\n"
+		}
+		if group, ok := groups[want]; !ok {
+			groups[want] = variant.ResponseGroup
+		} else if group != variant.ResponseGroup {
+			t.Errorf("%s: got group %d, not %d", variant.Kind, variant.ResponseGroup, group)
+		}
+		if string(variant.Response) != want {
+			t.Errorf("%s: got response %q", variant.Kind, variant.Response)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package banner
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// Why the read of a response stopped, with --read-until, --read-bytes or
+// --read-timeout.
+const (
+	readStoppedDelimiter = "delimiter"
+	readStoppedBytes     = "bytes"
+	readStoppedEOF       = "eof"
+	readStoppedTimeout   = "timeout"
+)
+
+// maxResponseSize bounds the responses read until a delimiter or the
+// --read-timeout, as ReadAvailable does.
+const maxResponseSize = 512 * 1024
+
+// parseDelimiter parses the --read-until delimiter: hex digits after 0x, or
+// else a string with the escapes of --probe.
+func parseDelimiter(value string) ([]byte, error) {
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		ret, err := hex.DecodeString(value[2:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex delimiter %s: %s", value, err)
+		}
+		return ret, nil
+	}
+	ret, err := strconv.Unquote(`"` + value + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delimiter %s: %s", value, err)
+	}
+	return []byte(ret), nil
+}
+
+// readResponse reads the response from conn. Without --read-until,
+// --read-bytes or --read-timeout, it reads what is available, as
+// ReadAvailable. Otherwise it reads until the delimiter (included), the
+// number of bytes, the end of the connection, or the --read-timeout
+// (default: --timeout) since the start, whichever comes first, and returns
+// why it stopped; the bytes past the delimiter are dropped. With
+// --read-timeout alone, the timeout ends the response: it is only an error
+// if nothing was read.
+func (scanner *Scanner) readResponse(conn net.Conn) ([]byte, string, error) {
+	until, size, timeout := scanner.delimiter, scanner.config.ReadBytes, scanner.config.ReadTimeout
+	if len(until) == 0 && size == 0 && timeout == 0 {
+		ret, err := zgrab2.ReadAvailable(conn)
+		return ret, "", err
+	}
+	if timeout == 0 {
+		timeout = scanner.config.Timeout
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	limit := maxResponseSize
+	if size > 0 {
+		limit = size
+	}
+	var ret []byte
+	buf := make([]byte, 8192)
+	for {
+		if !deadline.IsZero() {
+			conn.SetReadDeadline(deadline)
+		}
+		want := len(buf)
+		if limit-len(ret) < want {
+			want = limit - len(ret)
+		}
+		n, err := conn.Read(buf[:want])
+		// The delimiter can span the end of the previous read.
+		from := len(ret) - len(until) + 1
+		if from < 0 {
+			from = 0
+		}
+		ret = append(ret, buf[:n]...)
+		if len(until) > 0 {
+			if i := bytes.Index(ret[from:], until); i >= 0 {
+				return ret[:from+i+len(until)], readStoppedDelimiter, nil
+			}
+		}
+		if len(ret) >= limit {
+			if size > 0 {
+				return ret, readStoppedBytes, nil
+			}
+			return ret, "", nil
+		}
+		if err == io.EOF {
+			return ret, readStoppedEOF, nil
+		}
+		if err != nil {
+			if zgrab2.IsTimeoutError(err) && !deadline.IsZero() && !time.Now().Before(deadline) {
+				if len(until) == 0 && size == 0 && len(ret) > 0 {
+					err = nil
+				}
+				return ret, readStoppedTimeout, err
+			}
+			return ret, "", err
+		}
+	}
+}
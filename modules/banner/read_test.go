@@ -0,0 +1,75 @@
+package banner
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		value     string
+		delimiter string
+	}{
+		{"0x0d0a", "\r\n"},
+		{"0X00ff", "\x00\xff"},
+		{`\r\n\r\n`, "\r\n\r\n"},
+		{`\x00END`, "\x00END"},
+		{"OK", "OK"},
+	}
+	for _, test := range tests {
+		delimiter, err := parseDelimiter(test.value)
+		if err != nil || !bytes.Equal(delimiter, []byte(test.delimiter)) {
+			t.Errorf("%s: got %q, %v", test.value, delimiter, err)
+		}
+	}
+	for _, value := range []string{"0xzz", "0x0", `\q`} {
+		if _, err := parseDelimiter(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    Flags
+		writes   []string
+		close    bool
+		response string
+		stopped  string
+		timeout  bool
+	}{
+		{"delimiter across reads", Flags{ReadUntil: `\r\n`}, []string{"abc\r", "\nrest"}, false, "abc\r\n", readStoppedDelimiter, false},
+		{"bytes", Flags{ReadBytes: 4}, []string{"ab", "cdefgh"}, false, "abcd", readStoppedBytes, false},
+		{"closed before the delimiter", Flags{ReadUntil: "0x00"}, []string{"abc"}, true, "abc", readStoppedEOF, false},
+		{"timeout alone", Flags{ReadTimeout: 50 * time.Millisecond}, []string{"abc"}, false, "abc", readStoppedTimeout, false},
+		{"timeout before the delimiter", Flags{ReadUntil: "END", ReadTimeout: 50 * time.Millisecond}, []string{"abc"}, false, "abc", readStoppedTimeout, true},
+		{"timeout without data", Flags{ReadTimeout: 50 * time.Millisecond}, nil, false, "", readStoppedTimeout, true},
+	}
+	for _, test := range tests {
+		scanner := new(Scanner)
+		test.flags.Timeout = time.Second
+		if err := scanner.Init(&test.flags); err != nil {
+			t.Fatal(err)
+		}
+		client, server := net.Pipe()
+		go func() {
+			for _, write := range test.writes {
+				server.Write([]byte(write))
+			}
+			if test.close {
+				server.Close()
+			}
+		}()
+		response, stopped, err := scanner.readResponse(client)
+		if string(response) != test.response || stopped != test.stopped || zgrab2.IsTimeoutError(err) != test.timeout {
+			t.Errorf("%s: got %q, stopped %q, error %v", test.name, response, stopped, err)
+		}
+		client.Close()
+		server.Close()
+	}
+}
@@ -5,6 +5,7 @@ package banner
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"net"
 	"regexp"
 	"strconv"
+	"time"
 )
 
 // Flags give the command-line flags for the banner module.
@@ -29,6 +31,14 @@ type Flags struct {
 	ProbeBASE64          string `long:"single-payload" description:"Probe to send to the server, in base64."`
 	SingleContains       string `long:"single-contain" description:"search bytes in banner, set in base64."`
 	SingleContainsString string `long:"single-contain-string" default:"" description:"search substring in banner, set in string."`
+	Fuzz                 bool   `long:"fuzz" description:"Send structured-random payload variants, each on a new connection, and record how the responses differ."`
+	FuzzCount            int    `long:"fuzz-count" default:"8" description:"Number of payload variants to send in --fuzz mode."`
+	FuzzSeed             int64  `long:"fuzz-seed" description:"Seed for the --fuzz payloads (0 = pick one per run; it is recorded in the output)."`
+	// ReadUntil, ReadBytes and ReadTimeout replace the reading of what is
+	// available with a read that stops at a delimiter, a size or a time.
+	ReadUntil   string        `long:"read-until" description:"Read the response until this delimiter (included), escaped as --probe or in hex after 0x, e.g. \\r\\n\\r\\n or 0x0d0a0d0a"`
+	ReadBytes   int           `long:"read-bytes" description:"Read the response until this many bytes"`
+	ReadTimeout time.Duration `long:"read-timeout" description:"Read the response for at most this long; alone, read until the connection is closed or this timeout (default with --read-until or --read-bytes: --timeout)"`
 }
 
 // Module is the implementation of the zgrab2.Module interface.
@@ -37,9 +47,11 @@ type Module struct {
 
 // Scanner is the implementation of the zgrab2.Scanner interface.
 type Scanner struct {
-	config *Flags
-	regex  *regexp.Regexp
-	probe  []byte
+	config       *Flags
+	regex        *regexp.Regexp
+	probe        []byte
+	delimiter    []byte
+	fuzzPayloads []fuzzPayload
 }
 
 type Results struct {
@@ -48,6 +60,18 @@ type Results struct {
 	BannerBase64 string `json:"banner_base64,omitempty"`
 	// TLSLog is the standard TLS log, if --use-tls is enabled.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+	// Fuzz is only present in --fuzz mode.
+	Fuzz *FuzzResults `json:"fuzz,omitempty"`
+	// GuessedProtocol is the protocol the banner most likely belongs to,
+	// from a built-in list of greetings and magic bytes.
+	GuessedProtocol string `json:"guessed_protocol,omitempty"`
+	// TruncatedByTimeout is true if the server was still sending when the
+	// read timed out; the partial banner is kept.
+	TruncatedByTimeout bool `json:"truncated_by_timeout,omitempty"`
+	// ReadStopped says why the read of the banner stopped with --read-until,
+	// --read-bytes or --read-timeout: at the delimiter, the number of
+	// bytes, the end of the connection, or the timeout.
+	ReadStopped string `json:"read_stopped,omitempty"`
 }
 
 // RegisterModule is called by modules/banner.go to register the scanner.
@@ -89,8 +113,24 @@ func (m *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (m *Module) NewResult() interface{} {
+	return new(Results)
+}
+
 // Validate validates the flags and returns nil on success.
 func (f *Flags) Validate(args []string) error {
+	if f.Fuzz && f.FuzzCount <= 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	if f.ReadBytes < 0 || f.ReadTimeout < 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	if f.ReadUntil != "" {
+		if _, err := parseDelimiter(f.ReadUntil); err != nil {
+			return fmt.Errorf("--read-until: %s", err)
+		}
+	}
 	return nil
 }
 
@@ -123,17 +163,58 @@ func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 		}
 		scanner.probe = probe
 	}
+	if len(scanner.config.ReadUntil) > 0 {
+		delimiter, err := parseDelimiter(scanner.config.ReadUntil)
+		if err != nil {
+			return err
+		}
+		scanner.delimiter = delimiter
+	}
+	if scanner.config.Fuzz {
+		scanner.initFuzz()
+	}
 
 	return nil
 }
 
+// Preview implements zgrab2.ScannerPreview: the scan sends the ClientHello
+// with --use-tls, then the probe, or the --fuzz payloads on their own
+// connections.
+func (scanner *Scanner) Preview(target zgrab2.ScanTarget) ([]*zgrab2.ProbePreview, error) {
+	var ret []*zgrab2.ProbePreview
+	if scanner.config.UseTLS {
+		hello, err := scanner.config.TLSFlags.PreviewClientHello(&target)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, hello)
+	}
+	if scanner.config.Fuzz {
+		for i, payload := range scanner.fuzzPayloads {
+			ret = append(ret, &zgrab2.ProbePreview{Name: fmt.Sprintf("fuzz payload %d (%s)", i+1, payload.kind), Data: payload.data})
+		}
+		return ret, nil
+	}
+	return append(ret, &zgrab2.ProbePreview{Name: "probe", Data: scanner.probe}), nil
+}
+
 var NoMatchError = errors.New("pattern did not match")
 
 type Connection struct {
 	Conn net.Conn
 }
 
+// Scan implements zgrab2.Scanner.
 func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	return scanner.ScanContext(target.Ctx(), target)
+}
+
+// ScanContext implements zgrab2.ScannerContext: no more connections are
+// tried once ctx is done, and the connection's reads fail.
+func (scanner *Scanner) ScanContext(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	if scanner.config.Fuzz {
+		return scanner.fuzz(target)
+	}
 	try := 0
 	var (
 		c       net.Conn
@@ -142,6 +223,9 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	)
 	for try < scanner.config.MaxTries {
 		try += 1
+		if err = ctx.Err(); err != nil {
+			return zgrab2.SCAN_CANCELED, nil, err
+		}
 		c, err = target.Open(&scanner.config.BaseFlags)
 		if err != nil {
 			continue
@@ -166,7 +250,10 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		c = tlsConn
 	}
 	conn := Connection{Conn: c}
-	var ret []byte
+	var (
+		ret     []byte
+		stopped string
+	)
 	try = 0
 	err = nil
 	for try < scanner.config.MaxTries {
@@ -174,10 +261,14 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		if len(scanner.probe) > 0 {
 			_, err = conn.Conn.Write(scanner.probe)
 		}
-		ret, readerr = zgrab2.ReadAvailable(conn.Conn)
+		ret, stopped, readerr = scanner.readResponse(conn.Conn)
 		if err != nil {
 			continue
 		}
+		if zgrab2.TruncatedByTimeout(len(ret), readerr) {
+			result.TruncatedByTimeout = true
+			readerr = nil
+		}
 		if readerr != io.EOF && readerr != nil {
 			continue
 		}
@@ -195,8 +286,10 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		banner_str = string(ret)
 	}
 	result.Banner = banner_str
+	result.ReadStopped = stopped
 	result.Length = len(ret)
 	result.BannerBase64 = banner_base64
+	result.GuessedProtocol = GuessProtocol(ret)
 
 	if len(scanner.config.SingleContains) == 0 && len(scanner.config.SingleContainsString) == 0 {
 		if scanner.regex.Match(ret) {
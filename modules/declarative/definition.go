@@ -0,0 +1,340 @@
+package declarative
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Definition is the top-level description of a protocol, as loaded from the
+// YAML file given in --definition.
+type Definition struct {
+	// Protocol is the identifier reported in the scan response.
+	Protocol string `yaml:"protocol"`
+
+	// Transport is either "tcp" (the default) or "udp".
+	Transport string `yaml:"transport"`
+
+	// Steps are executed in order on a single connection.
+	Steps []*Step `yaml:"steps"`
+}
+
+// Step sends an optional probe, reads one response, and extracts fields from
+// it.
+type Step struct {
+	// Send is the probe to send, with Go string escapes (e.g. '\x00\r\n').
+	Send string `yaml:"send"`
+
+	// SendHex is the probe to send, hex-encoded. Mutually exclusive with Send.
+	SendHex string `yaml:"send_hex"`
+
+	// Read describes how to decide where the response ends.
+	Read ReadRule `yaml:"read"`
+
+	// Expect, if set, is a regular expression that the response must match for
+	// the step (and the scan) to succeed.
+	Expect string `yaml:"expect"`
+
+	// Fields are the values extracted from the response.
+	Fields []*Field `yaml:"fields"`
+
+	probe  []byte
+	expect *regexp.Regexp
+}
+
+// ReadRule controls how much of the response is read. At most one of
+// LengthPrefix, Fixed and Until may be set; with none set, whatever is
+// available is read.
+type ReadRule struct {
+	// LengthPrefix reads a header containing the message length, then the
+	// rest of the message.
+	LengthPrefix *LengthPrefix `yaml:"length_prefix"`
+
+	// Fixed reads exactly this many bytes.
+	Fixed int `yaml:"fixed"`
+
+	// Until reads until the given delimiter (Go string escapes allowed) is
+	// seen.
+	Until string `yaml:"until"`
+
+	// MaxSize bounds the size of the response (default 64KiB).
+	MaxSize int `yaml:"max_size"`
+
+	until []byte
+}
+
+// LengthPrefix describes an integer length field inside the response header.
+type LengthPrefix struct {
+	// Offset of the length field from the start of the response.
+	Offset int `yaml:"offset"`
+
+	// Size of the length field in bytes: 1, 2, 4 or 8.
+	Size int `yaml:"size"`
+
+	// LittleEndian selects the byte order of the length field.
+	LittleEndian bool `yaml:"little_endian"`
+
+	// Adjust is added to the length value to get the total length of the
+	// message, counted from its first byte (e.g. the header size, if the
+	// length field does not include the header).
+	Adjust int `yaml:"adjust"`
+}
+
+// Field extracts a single named value from a response, either from a fixed
+// byte range or from a regular expression capture group.
+type Field struct {
+	Name string `yaml:"name"`
+
+	// Offset and Length select a byte range. A Length of 0 means "until the
+	// end of the response".
+	Offset int `yaml:"offset"`
+	Length int `yaml:"length"`
+
+	// Type is one of uint, int, hex, string, base64 (the default is string).
+	Type string `yaml:"type"`
+
+	// LittleEndian selects the byte order for uint / int values.
+	LittleEndian bool `yaml:"little_endian"`
+
+	// Regex, if set, is matched against the response instead of using
+	// Offset / Length; the first capture group (or the whole match) is used.
+	Regex string `yaml:"regex"`
+
+	// Values optionally maps numeric values to labels.
+	Values map[uint64]string `yaml:"values"`
+
+	regex *regexp.Regexp
+}
+
+// LoadDefinition reads and validates a protocol definition file.
+func LoadDefinition(file string) (*Definition, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDefinition(data)
+}
+
+// ParseDefinition parses and validates a YAML protocol definition.
+func ParseDefinition(data []byte) (*Definition, error) {
+	def := new(Definition)
+	if err := yaml.UnmarshalStrict(data, def); err != nil {
+		return nil, err
+	}
+	if err := def.compile(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// unescape interprets Go string escapes in s. Values should be single-quoted
+// in YAML so that YAML itself does not process the escapes (YAML turns \xNN
+// into a unicode code point, not a byte).
+func unescape(s string) ([]byte, error) {
+	s = strings.NewReplacer(`"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s)
+	ret, err := strconv.Unquote(`"` + s + `"`)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(ret), nil
+}
+
+func (def *Definition) compile() error {
+	if def.Protocol == "" {
+		return fmt.Errorf("definition has no protocol name")
+	}
+	switch def.Transport {
+	case "":
+		def.Transport = "tcp"
+	case "tcp", "udp":
+	default:
+		return fmt.Errorf("unsupported transport %q", def.Transport)
+	}
+	if len(def.Steps) == 0 {
+		return fmt.Errorf("definition has no steps")
+	}
+	for i, step := range def.Steps {
+		if err := step.compile(); err != nil {
+			return fmt.Errorf("step %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (step *Step) compile() error {
+	var err error
+	if step.Send != "" && step.SendHex != "" {
+		return fmt.Errorf("only one of send and send_hex may be given")
+	}
+	if step.Send != "" {
+		if step.probe, err = unescape(step.Send); err != nil {
+			return fmt.Errorf("bad send value: %s", err)
+		}
+	} else if step.SendHex != "" {
+		if step.probe, err = hex.DecodeString(strings.Replace(step.SendHex, " ", "", -1)); err != nil {
+			return fmt.Errorf("bad send_hex value: %s", err)
+		}
+	}
+	if step.Expect != "" {
+		if step.expect, err = regexp.Compile(step.Expect); err != nil {
+			return err
+		}
+	}
+	rule := &step.Read
+	set := 0
+	if rule.LengthPrefix != nil {
+		set++
+		switch rule.LengthPrefix.Size {
+		case 1, 2, 4, 8:
+		default:
+			return fmt.Errorf("length_prefix size must be 1, 2, 4 or 8")
+		}
+	}
+	if rule.Fixed > 0 {
+		set++
+	}
+	if rule.Until != "" {
+		set++
+		if rule.until, err = unescape(rule.Until); err != nil {
+			return fmt.Errorf("bad until value: %s", err)
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("only one of length_prefix, fixed and until may be given")
+	}
+	if rule.MaxSize <= 0 {
+		rule.MaxSize = 64 * 1024
+	}
+	for _, field := range step.Fields {
+		if field.Name == "" {
+			return fmt.Errorf("field without a name")
+		}
+		switch field.Type {
+		case "":
+			field.Type = "string"
+		case "uint", "int":
+			if field.Regex == "" && field.Length != 1 && field.Length != 2 && field.Length != 4 && field.Length != 8 {
+				return fmt.Errorf("field %s: integer length must be 1, 2, 4 or 8", field.Name)
+			}
+		case "hex", "string", "base64":
+		default:
+			return fmt.Errorf("field %s: unsupported type %q", field.Name, field.Type)
+		}
+		if field.Regex != "" {
+			if field.regex, err = regexp.Compile(field.Regex); err != nil {
+				return fmt.Errorf("field %s: %s", field.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// messageLength returns the total message length declared by the header in
+// data, or -1 if not enough of the header has been read yet.
+func (prefix *LengthPrefix) messageLength(data []byte) int {
+	end := prefix.Offset + prefix.Size
+	if len(data) < end {
+		return -1
+	}
+	return int(readUint(data[prefix.Offset:end], prefix.LittleEndian)) + prefix.Adjust
+}
+
+func readUint(b []byte, littleEndian bool) uint64 {
+	var order binary.ByteOrder = binary.BigEndian
+	if littleEndian {
+		order = binary.LittleEndian
+	}
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 4:
+		return uint64(order.Uint32(b))
+	default:
+		return order.Uint64(b)
+	}
+}
+
+func readInt(b []byte, littleEndian bool) int64 {
+	v := readUint(b, littleEndian)
+	switch len(b) {
+	case 1:
+		return int64(int8(v))
+	case 2:
+		return int64(int16(v))
+	case 4:
+		return int64(int32(v))
+	default:
+		return int64(v)
+	}
+}
+
+// Extract returns the value of the field in data, or nil if the response does
+// not contain it.
+func (field *Field) Extract(data []byte) interface{} {
+	var raw []byte
+	if field.regex != nil {
+		match := field.regex.FindSubmatch(data)
+		if match == nil {
+			return nil
+		}
+		raw = match[0]
+		if len(match) > 1 {
+			raw = match[1]
+		}
+	} else {
+		if field.Offset >= len(data) {
+			return nil
+		}
+		raw = data[field.Offset:]
+		if field.Length > 0 {
+			if len(raw) < field.Length {
+				return nil
+			}
+			raw = raw[:field.Length]
+		}
+	}
+	switch field.Type {
+	case "uint", "int":
+		var num uint64
+		if field.regex != nil {
+			v, err := strconv.ParseInt(string(raw), 0, 64)
+			if err != nil {
+				return nil
+			}
+			num = uint64(v)
+		} else if field.Type == "uint" {
+			num = readUint(raw, field.LittleEndian)
+		} else {
+			v := readInt(raw, field.LittleEndian)
+			if field.Values == nil {
+				return v
+			}
+			num = uint64(v)
+		}
+		if field.Values != nil {
+			if label, ok := field.Values[num]; ok {
+				return label
+			}
+		}
+		if field.Type == "int" {
+			return int64(num)
+		}
+		return num
+	case "hex":
+		return hex.EncodeToString(raw)
+	case "base64":
+		return base64.StdEncoding.EncodeToString(raw)
+	default:
+		return string(bytes.TrimRight(raw, "\x00"))
+	}
+}
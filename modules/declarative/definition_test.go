@@ -0,0 +1,77 @@
+package declarative
+
+import (
+	"net"
+	"testing"
+)
+
+const testDefinition = `
+protocol: test
+steps:
+  - send: 'HELLO\r\n\x80'
+    read:
+      length_prefix: {offset: 0, size: 2, adjust: 2}
+    expect: "OK"
+    fields:
+      - {name: code, offset: 2, length: 2, type: uint, values: {1: "one"}}
+      - {name: temp, offset: 4, length: 1, type: int}
+      - {name: version, regex: "v([0-9.]+)"}
+      - {name: raw, offset: 4, length: 2, type: hex}
+`
+
+func TestParseDefinition(t *testing.T) {
+	def, err := ParseDefinition([]byte(testDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.Transport != "tcp" {
+		t.Errorf("expected default transport tcp, got %s", def.Transport)
+	}
+	step := def.Steps[0]
+	if string(step.probe) != "HELLO\r\n\x80" {
+		t.Errorf("wrong probe %q", step.probe)
+	}
+
+	// length 0x000d + 2 bytes of header = 15 bytes; trailing garbage must be ignored
+	response := []byte("\x00\x0d\x00\x01\xfeOK v1.2.3\x00\x00GARBAGE")
+	client, server := net.Pipe()
+	go func() {
+		server.Write(response)
+		server.Close()
+	}()
+	data, err := readResponse(client, &step.Read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 15 {
+		t.Fatalf("expected 15 bytes, got %d (%q)", len(data), data)
+	}
+
+	expected := map[string]interface{}{
+		"code":    "one",
+		"temp":    int64(-2),
+		"version": "1.2.3",
+		"raw":     "fe4f",
+	}
+	for _, field := range step.Fields {
+		if value := field.Extract(data); value != expected[field.Name] {
+			t.Errorf("field %s: expected %#v, got %#v", field.Name, expected[field.Name], value)
+		}
+	}
+}
+
+func TestParseDefinitionErrors(t *testing.T) {
+	bad := []string{
+		"steps: [{send: x}]",
+		"protocol: x",
+		"protocol: x\nsteps: [{send: a, send_hex: '00'}]",
+		"protocol: x\nsteps: [{read: {fixed: 2, until: x}}]",
+		"protocol: x\nsteps: [{fields: [{name: a, type: uint, length: 3}]}]",
+		"protocol: x\nunknown: 1\nsteps: [{}]",
+	}
+	for _, def := range bad {
+		if _, err := ParseDefinition([]byte(def)); err == nil {
+			t.Errorf("expected error for %q", def)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package declarative provides a zgrab2 module that executes simple
+// request/response protocols described in a YAML file, so that simple device
+// protocols can be added without writing Go code.
+//
+// A definition looks like:
+//
+//	protocol: example
+//	transport: tcp
+//	steps:
+//	  - send_hex: "00 01 00 00 00 06 01 2b 0e 01 00"
+//	    read:
+//	      length_prefix: {offset: 4, size: 2, adjust: 6}
+//	    expect: '^\x00\x01'
+//	    fields:
+//	      - {name: unit_id, offset: 6, length: 1, type: uint}
+//	      - {name: vendor, regex: "([A-Za-z]+ [A-Za-z]+)"}
+//
+// Each step sends its probe (if any), reads one response according to its
+// read rule, checks it against the optional expect regex and extracts the
+// configured fields. The scan succeeds if every step got a response that
+// matched its expectation.
+package declarative
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/Positive-Engineer/zgrab2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Flags holds the command-line configuration for the declarative module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	Definition string `long:"definition" description:"Path to the YAML file describing the protocol"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config     *Flags
+	definition *Definition
+}
+
+// StepResult holds the data exchanged in one step.
+type StepResult struct {
+	Request  []byte `json:"request,omitempty" zgrab:"debug"`
+	Response []byte `json:"response,omitempty"`
+	Matched  bool   `json:"matched"`
+}
+
+// Results is the output of the scan.
+type Results struct {
+	Steps  []*StepResult          `json:"steps,omitempty"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// ErrNoMatch is returned when a response does not match the step's expect
+// pattern.
+var ErrNoMatch = errors.New("response did not match expected pattern")
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("declarative", "Declarative protocol", module.Description(), 0, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Run a simple request/response protocol defined in a YAML file"
+}
+
+// Validate checks that the flags are valid.
+func (flags *Flags) Validate(args []string) error {
+	if flags.Definition == "" {
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner and loads the protocol definition.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	def, err := LoadDefinition(f.Definition)
+	if err != nil {
+		log.Fatalf("could not load protocol definition %s: %s", f.Definition, err)
+	}
+	scanner.definition = def
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier from the definition.
+func (scanner *Scanner) Protocol() string {
+	return scanner.definition.Protocol
+}
+
+// Preview implements zgrab2.ScannerPreview: the scan sends the probes of
+// the steps, each after the response to the previous one.
+func (scanner *Scanner) Preview(target zgrab2.ScanTarget) ([]*zgrab2.ProbePreview, error) {
+	var ret []*zgrab2.ProbePreview
+	for i, step := range scanner.definition.Steps {
+		if len(step.probe) > 0 {
+			ret = append(ret, &zgrab2.ProbePreview{Name: fmt.Sprintf("step %d probe", i+1), Data: step.probe})
+		}
+	}
+	return ret, nil
+}
+
+// readResponse reads a single response according to rule.
+func readResponse(conn net.Conn, rule *ReadRule) ([]byte, error) {
+	if rule.LengthPrefix == nil && rule.Fixed == 0 && rule.until == nil {
+		data, err := zgrab2.ReadAvailable(conn)
+		if len(data) > rule.MaxSize {
+			data = data[:rule.MaxSize]
+		}
+		if err == io.EOF && len(data) > 0 {
+			// The server sent its response and closed the connection.
+			err = nil
+		}
+		return data, err
+	}
+	want := -1
+	if rule.Fixed > 0 {
+		want = rule.Fixed
+	}
+	buf := make([]byte, 4096)
+	var data []byte
+	for {
+		if want >= 0 && len(data) >= want {
+			return data[:want], nil
+		}
+		if rule.until != nil {
+			if i := bytes.Index(data, rule.until); i >= 0 {
+				return data[:i+len(rule.until)], nil
+			}
+		}
+		if len(data) >= rule.MaxSize {
+			return data, fmt.Errorf("response exceeds %d bytes", rule.MaxSize)
+		}
+		n, err := conn.Read(buf)
+		data = append(data, buf[:n]...)
+		if rule.LengthPrefix != nil && want < 0 {
+			want = rule.LengthPrefix.messageLength(data)
+			if want > rule.MaxSize {
+				return data, fmt.Errorf("declared length %d exceeds %d bytes", want, rule.MaxSize)
+			}
+		}
+		if err != nil {
+			if want >= 0 && len(data) >= want {
+				return data[:want], nil
+			}
+			if err == io.EOF && len(data) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return data, err
+		}
+	}
+}
+
+// Scan runs each step of the definition on a single connection.
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	var conn net.Conn
+	var err error
+	if scanner.definition.Transport == "udp" {
+		conn, err = target.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	} else {
+		conn, err = target.Open(&scanner.config.BaseFlags)
+	}
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+
+	result := &Results{Fields: make(map[string]interface{})}
+	for _, step := range scanner.definition.Steps {
+		stepResult := &StepResult{Request: step.probe}
+		result.Steps = append(result.Steps, stepResult)
+		if len(step.probe) > 0 {
+			if _, err := conn.Write(step.probe); err != nil {
+				return zgrab2.TryGetScanStatus(err), result, err
+			}
+		}
+		response, err := readResponse(conn, &step.Read)
+		stepResult.Response = response
+		if err != nil && len(response) == 0 {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		if step.expect != nil && !step.expect.Match(response) {
+			return zgrab2.SCAN_PROTOCOL_ERROR, result, ErrNoMatch
+		}
+		stepResult.Matched = true
+		for _, field := range step.Fields {
+			if value := field.Extract(response); value != nil {
+				result.Fields[field.Name] = value
+			}
+		}
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, result, nil
+}
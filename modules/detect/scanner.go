@@ -0,0 +1,457 @@
+// Package detect provides a zgrab2 module that identifies the protocol
+// spoken on an open port.
+//
+// It runs a short decision tree of lightweight probes, each on the same
+// connection while it is still clean, or on a new one:
+//
+//  1. banner: wait up to --banner-wait for the server to speak first, and
+//     match the greeting against the banner module's rules (SSH, FTP, SMTP,
+//     POP3, IMAP, MySQL, telnet, VNC, ...).
+//  2. tls: if the server is silent, send a TLS ClientHello. After a
+//     handshake, the banner and HTTP probes are repeated inside TLS.
+//  3. http: send an HTTP GET, and match the response (HTTP, and the error
+//     replies of line-based protocols such as Redis or memcached).
+//
+// The result is the best-guess protocol with a confidence between 0 and 1.
+// With --set-trigger, the protocol is added to the target's triggers (see
+// zgrab2.ContextTriggers), so that the scanners configured after detect in
+// a multiple scan whose --trigger is that protocol run on the target. Over
+// TLS, the trigger gets an "s" suffix, e.g. "https" or "imaps".
+package detect
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/modules/banner"
+	log "github.com/sirupsen/logrus"
+)
+
+// Probe names, in the order they are tried.
+const (
+	probeBanner = "banner"
+	probeTLS    = "tls"
+	probeHTTP   = "http"
+)
+
+// Confidence of the identification by each kind of evidence.
+const (
+	// confidenceHandshake is a completed TLS handshake or an HTTP status line.
+	confidenceHandshake = 1.0
+
+	// confidenceGreeting is a greeting the server sent unprompted.
+	confidenceGreeting = 0.9
+
+	// confidenceReply is a recognized reply to a probe of another protocol.
+	confidenceReply = 0.7
+
+	// confidenceWeak is a match of one of weakProtocols.
+	confidenceWeak = 0.4
+)
+
+// weakProtocols are banner classifications that say little about the
+// service.
+var weakProtocols = map[string]bool{
+	"login-prompt": true,
+	"html":         true,
+	"tpkt":         true,
+}
+
+// maxResponseLength bounds the probe responses kept in the output.
+const maxResponseLength = 512
+
+var errNotIdentified = errors.New("protocol not identified")
+
+// Flags holds the command-line configuration for the detect module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	Probes        string        `long:"probes" default:"banner,tls,http" description:"Comma-separated probes to run (banner, tls, http); they always run in this order"`
+	BannerWait    time.Duration `long:"banner-wait" default:"2s" description:"How long to wait for the server to speak first"`
+	UserAgent     string        `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"User-Agent of the HTTP probe"`
+	SetTrigger    bool          `long:"set-trigger" description:"Add the detected protocol to the target's triggers, so that later scanners with that --trigger run on it"`
+	TriggerPrefix string        `long:"trigger-prefix" description:"Prefix of the trigger added by --set-trigger"`
+	MinConfidence float64       `long:"min-confidence" default:"0.5" description:"Minimum confidence for --set-trigger"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+	probes map[string]bool
+}
+
+// ProbeResult is the outcome of a single probe.
+type ProbeResult struct {
+	Name string `json:"name"`
+
+	// TLS is true if the probe ran inside a TLS session.
+	TLS bool `json:"tls,omitempty"`
+
+	// Response is the start of what the server sent.
+	Response string `json:"response,omitempty"`
+
+	// Protocol is the protocol the response was matched to, if any.
+	Protocol string `json:"protocol,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Results is the output of the detect module.
+type Results struct {
+	// Protocol is the best-guess protocol, or empty if none was identified.
+	Protocol string `json:"protocol,omitempty"`
+
+	// Confidence is between 0 (no idea) and 1 (certain).
+	Confidence float64 `json:"confidence"`
+
+	// TLS is true if the protocol runs over TLS.
+	TLS bool `json:"tls,omitempty"`
+
+	// Trigger is the trigger added to the target with --set-trigger.
+	Trigger string `json:"trigger,omitempty"`
+
+	Probes []*ProbeResult `json:"probes,omitempty"`
+
+	TLSLog *zgrab2.TLSLog `json:"tls_log,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("detect", "Protocol detection", module.Description(), 80, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Identify the protocol of an open port with lightweight probes"
+}
+
+// parseProbes parses the comma-separated --probes list.
+func parseProbes(value string) (map[string]bool, error) {
+	ret := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case probeBanner, probeTLS, probeHTTP:
+			ret[name] = true
+		default:
+			return nil, fmt.Errorf("unknown probe %q", name)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no probes")
+	}
+	return ret, nil
+}
+
+// Validate checks that the flags are valid.
+func (flags *Flags) Validate(args []string) error {
+	if _, err := parseProbes(flags.Probes); err != nil {
+		log.Errorf("invalid --probes: %v", err)
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.MinConfidence < 0 || flags.MinConfidence > 1 {
+		log.Error("--min-confidence must be between 0 and 1")
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	probes, err := parseProbes(f.Probes)
+	if err != nil {
+		return err
+	}
+	scanner.probes = probes
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "detect"
+}
+
+// classify returns the protocol of a response and the confidence of the
+// match; solicited is true if the response answers one of our probes.
+func classify(response []byte, solicited bool) (string, float64) {
+	protocol := banner.GuessProtocol(response)
+	switch {
+	case protocol == "":
+		return "", 0
+	case weakProtocols[protocol]:
+		return protocol, confidenceWeak
+	case protocol == "http" && solicited:
+		return protocol, confidenceHandshake
+	case solicited:
+		return protocol, confidenceReply
+	}
+	return protocol, confidenceGreeting
+}
+
+// truncate returns the start of a response for the output.
+func truncate(response []byte) string {
+	if len(response) > maxResponseLength {
+		response = response[:maxResponseLength]
+	}
+	return string(response)
+}
+
+// detection collects the probe results of a scan.
+type detection struct {
+	results *Results
+
+	// connected is set once a connection to the target succeeded.
+	connected bool
+
+	// err is the first error, returned if no connection succeeded.
+	err error
+}
+
+// open connects to the target.
+func (d *detection) open(scanner *Scanner, target *zgrab2.ScanTarget) (net.Conn, error) {
+	conn, err := target.Open(&scanner.config.BaseFlags)
+	if err == nil {
+		d.connected = true
+	}
+	return conn, err
+}
+
+// record adds the result of a probe, and takes its protocol if it is more
+// certain than the current one.
+func (d *detection) record(probe *ProbeResult, response []byte, err error, solicited bool) float64 {
+	d.results.Probes = append(d.results.Probes, probe)
+	if len(response) > 0 {
+		probe.Response = truncate(response)
+		var confidence float64
+		probe.Protocol, confidence = classify(response, solicited)
+		if confidence > d.results.Confidence {
+			d.results.Protocol = probe.Protocol
+			d.results.Confidence = confidence
+			d.results.TLS = probe.TLS
+		}
+		return confidence
+	}
+	if err != nil {
+		probe.Error = err.Error()
+		if d.err == nil {
+			d.err = err
+		}
+	}
+	return 0
+}
+
+// readBanner waits for the server to speak first.
+func (scanner *Scanner) readBanner(conn net.Conn) ([]byte, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(scanner.config.BannerWait)); err != nil {
+		return nil, err
+	}
+	response, err := zgrab2.ReadAvailable(conn)
+	if zgrab2.TruncatedByTimeout(len(response), err) || (len(response) == 0 && zgrab2.IsTimeoutError(err)) {
+		err = nil
+	}
+	return response, err
+}
+
+// sendHTTP sends a GET request for / and reads the response.
+func (scanner *Scanner) sendHTTP(conn net.Conn, host string) ([]byte, error) {
+	request := fmt.Sprintf("GET / HTTP/1.0\r\nHost: %s\r\nUser-Agent: %s\r\nAccept: */*\r\n\r\n", host, scanner.config.UserAgent)
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return nil, err
+	}
+	response, err := zgrab2.ReadAvailable(conn)
+	if zgrab2.TruncatedByTimeout(len(response), err) {
+		err = nil
+	}
+	return response, err
+}
+
+// host returns the Host header of the HTTP probe.
+func host(target *zgrab2.ScanTarget) string {
+	if target.Domain != "" {
+		return target.Domain
+	}
+	return target.Host()
+}
+
+// probeInsideTLS runs the banner and HTTP probes inside the TLS session.
+func (scanner *Scanner) probeInsideTLS(d *detection, conn net.Conn, target *zgrab2.ScanTarget) {
+	if scanner.probes[probeBanner] {
+		probe := &ProbeResult{Name: probeBanner, TLS: true}
+		response, err := scanner.readBanner(conn)
+		if d.record(probe, response, err, false) > 0 || err != nil {
+			return
+		}
+	}
+	if scanner.probes[probeHTTP] {
+		probe := &ProbeResult{Name: probeHTTP, TLS: true}
+		response, err := scanner.sendHTTP(conn, host(target))
+		d.record(probe, response, err, true)
+	}
+}
+
+// Scan runs the probes until one identifies the protocol.
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	d := &detection{results: new(Results)}
+	// conn is the current connection, while nothing has been sent on it.
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	identified := func() bool {
+		return d.results.Confidence >= confidenceGreeting
+	}
+
+	if scanner.probes[probeBanner] {
+		probe := &ProbeResult{Name: probeBanner}
+		var response []byte
+		var err error
+		if conn, err = d.open(scanner, &target); err == nil {
+			response, err = scanner.readBanner(conn)
+		}
+		d.record(probe, response, err, false)
+		if len(response) > 0 || err != nil {
+			// The connection is no longer clean.
+			if conn != nil {
+				conn.Close()
+			}
+			conn = nil
+		}
+	}
+
+	if !identified() && scanner.probes[probeTLS] && (d.connected || d.err == nil) {
+		probe := &ProbeResult{Name: probeTLS}
+		d.results.Probes = append(d.results.Probes, probe)
+		err := scanner.probeTLS(d, &conn, &target)
+		if err != nil {
+			probe.Error = err.Error()
+			if d.err == nil {
+				d.err = err
+			}
+		} else {
+			probe.Protocol = "tls"
+		}
+	}
+
+	if !identified() && scanner.probes[probeHTTP] && (d.connected || d.err == nil) {
+		probe := &ProbeResult{Name: probeHTTP}
+		var response []byte
+		var err error
+		if conn == nil {
+			conn, err = d.open(scanner, &target)
+		}
+		if err == nil {
+			response, err = scanner.sendHTTP(conn, host(&target))
+		}
+		d.record(probe, response, err, true)
+	}
+
+	results := d.results
+	if results.Protocol == "" {
+		if !d.connected && d.err != nil {
+			// The port could not be reached at all.
+			return zgrab2.TryGetScanStatus(d.err), nil, d.err
+		}
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, errNotIdentified
+	}
+	if scanner.config.SetTrigger && results.Confidence >= scanner.config.MinConfidence {
+		results.Trigger = scanner.config.TriggerPrefix + results.Protocol
+		if results.TLS && results.Protocol != "tls" {
+			results.Trigger += "s"
+		}
+		target.Context.Add(zgrab2.ContextTriggers, results.Trigger)
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
+
+// probeTLS performs a TLS handshake, on *conn if it is still clean, and
+// probes inside the session. On failure, *conn is closed and set to nil.
+func (scanner *Scanner) probeTLS(d *detection, conn *net.Conn, target *zgrab2.ScanTarget) error {
+	if *conn == nil {
+		c, err := d.open(scanner, target)
+		if err != nil {
+			return err
+		}
+		*conn = c
+	}
+	tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(*conn)
+	if err != nil {
+		(*conn).Close()
+		*conn = nil
+		return err
+	}
+	err = tlsConn.Handshake()
+	d.results.TLSLog = tlsConn.GetLog()
+	if err != nil {
+		(*conn).Close()
+		*conn = nil
+		return err
+	}
+	*conn = tlsConn
+	target.Context.RecordTLS(tlsConn)
+	d.results.Protocol = "tls"
+	d.results.Confidence = confidenceHandshake
+	d.results.TLS = true
+	// A protocol identified inside the session replaces the plain "tls".
+	inner := &detection{results: new(Results)}
+	scanner.probeInsideTLS(inner, tlsConn, target)
+	d.results.Probes = append(d.results.Probes, inner.results.Probes...)
+	if inner.results.Protocol != "" && inner.results.Confidence >= confidenceReply {
+		d.results.Protocol = inner.results.Protocol
+	}
+	// Nothing more is learned without TLS.
+	tlsConn.Close()
+	*conn = nil
+	return nil
+}
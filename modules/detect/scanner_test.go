@@ -0,0 +1,121 @@
+package detect
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// serve accepts connections and hands them to handle.
+func serve(t *testing.T, handle func(net.Conn)) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func scan(t *testing.T, port uint) (zgrab2.ScanStatus, *Results, *zgrab2.ScanTarget) {
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags:     zgrab2.BaseFlags{Port: port, Timeout: 5 * time.Second},
+		Probes:        "banner,tls,http",
+		BannerWait:    200 * time.Millisecond,
+		UserAgent:     "zgrab",
+		SetTrigger:    true,
+		MinConfidence: 0.5,
+	}
+	if err := scanner.Init(flags); err != nil {
+		t.Fatal(err)
+	}
+	target := zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1"), Context: zgrab2.NewTargetContext()}
+	status, result, _ := scanner.Scan(target)
+	results, _ := result.(*Results)
+	return status, results, &target
+}
+
+func TestDetectGreeting(t *testing.T) {
+	port := serve(t, func(conn net.Conn) {
+		conn.Write([]byte("SSH-2.0-OpenSSH_8.9\r\n"))
+		time.Sleep(time.Second)
+	})
+	status, results, target := scan(t, port)
+	if status != zgrab2.SCAN_SUCCESS || results.Protocol != "ssh" || results.Confidence != confidenceGreeting || len(results.Probes) != 1 {
+		t.Fatalf("unexpected result %s %+v", status, results)
+	}
+	if !target.Context.Triggered("ssh") {
+		t.Errorf("trigger not set: %v", target.Context.Get(zgrab2.ContextTriggers))
+	}
+}
+
+func TestDetectHTTP(t *testing.T) {
+	port := serve(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		if _, err := http.ReadRequest(reader); err != nil {
+			return
+		}
+		conn.Write([]byte("HTTP/1.0 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	})
+	status, results, target := scan(t, port)
+	if status != zgrab2.SCAN_SUCCESS || results.Protocol != "http" || results.TLS || results.Confidence != confidenceHandshake {
+		t.Fatalf("unexpected result %s %+v", status, results)
+	}
+	var names []string
+	for _, probe := range results.Probes {
+		names = append(names, probe.Name)
+	}
+	if !reflect.DeepEqual(names, []string{probeBanner, probeTLS, probeHTTP}) {
+		t.Errorf("unexpected probes %v", names)
+	}
+	if !target.Context.Triggered("http") {
+		t.Errorf("trigger not set: %v", target.Context.Get(zgrab2.ContextTriggers))
+	}
+}
+
+func TestDetectHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	status, results, target := scan(t, uint(p))
+	if status != zgrab2.SCAN_SUCCESS || results.Protocol != "http" || !results.TLS || results.TLSLog == nil {
+		t.Fatalf("unexpected result %s %+v", status, results)
+	}
+	if results.Trigger != "https" || !target.Context.Triggered("https") {
+		t.Errorf("unexpected trigger %q", results.Trigger)
+	}
+}
+
+func TestDetectUnknown(t *testing.T) {
+	port := serve(t, func(conn net.Conn) {
+		conn.Write([]byte{0x00, 0x01, 0x02})
+		time.Sleep(time.Second)
+	})
+	status, results, target := scan(t, port)
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || results == nil || results.Protocol != "" {
+		t.Fatalf("unexpected result %s %+v", status, results)
+	}
+	if triggers := target.Context.Get(zgrab2.ContextTriggers); len(triggers) != 0 {
+		t.Errorf("unexpected triggers %v", triggers)
+	}
+}
@@ -74,6 +74,7 @@ func GetDNP3Banner(logStruct *DNP3Log, connection net.Conn) (err error) {
 	if len(data) >= LINK_MIN_HEADER_LENGTH && binary.BigEndian.Uint16(data[0:2]) == LINK_START_FIELD {
 		logStruct.IsDNP3 = true
 		logStruct.RawResponse = data
+		logStruct.ICSDevice = zgrab2.NewICSDevice("dnp3", "", "", "", "")
 		return nil
 	}
 
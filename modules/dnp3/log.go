@@ -1,6 +1,12 @@
 package dnp3
 
+import "github.com/Positive-Engineer/zgrab2"
+
 type DNP3Log struct {
 	IsDNP3      bool   `json:"is_dnp3"`
 	RawResponse []byte `json:"raw_response,omitempty"`
+
+	// ICSDevice only identifies the protocol: the device attributes are
+	// not read.
+	ICSDevice *zgrab2.ICSDevice `json:"ics_device,omitempty"`
 }
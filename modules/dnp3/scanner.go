@@ -46,6 +46,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(DNP3Log)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for DNP3, a SCADA protocol"
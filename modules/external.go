@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/Positive-Engineer/zgrab2/modules/external"
+
+func init() {
+	external.RegisterModule()
+}
@@ -0,0 +1,234 @@
+package external
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxMessageLength bounds the lines read from an external scanner.
+const maxMessageLength = 64 * 1024 * 1024
+
+var errProcessExited = errors.New("external scanner exited")
+
+// request is a message to an external scanner: the init message sent when
+// it starts, a scan of a target, or the cancellation of a scan.
+type request struct {
+	Type string `json:"type"`
+	ID   uint64 `json:"id,omitempty"`
+
+	// Scanner, TimeoutMS and Args are the configuration in the init
+	// message.
+	Scanner   string            `json:"scanner,omitempty"`
+	TimeoutMS int64             `json:"timeout_ms,omitempty"`
+	Args      map[string]string `json:"args,omitempty"`
+
+	// The target of a scan; Port is also the default port in the init
+	// message.
+	IP     string `json:"ip,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	Port   uint   `json:"port,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+}
+
+// response is a message from an external scanner: ready, the answer to
+// init, or the result of a scan.
+type response struct {
+	Type string `json:"type"`
+	ID   uint64 `json:"id"`
+
+	// Protocol is the protocol of the scanner, in the ready message.
+	Protocol string `json:"protocol"`
+
+	Status string          `json:"status"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+}
+
+// process is a running external scanner. Scans are sent to it as they come,
+// and it may answer them in any order.
+type process struct {
+	cmd      *exec.Cmd
+	protocol string
+
+	// writeMutex serializes the requests.
+	writeMutex sync.Mutex
+	stdin      io.WriteCloser
+
+	// mutex protects pending, nextID and err.
+	mutex   sync.Mutex
+	pending map[uint64]chan *response
+	nextID  uint64
+	err     error
+
+	// exited is closed when the process has exited.
+	exited chan struct{}
+}
+
+// startProcess starts an external scanner, sends it the init message and
+// waits up to timeout for it to be ready.
+func startProcess(command []string, init *request, timeout time.Duration) (*process, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &process{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[uint64]chan *response),
+		exited:  make(chan struct{}),
+	}
+	go func() {
+		// The scanner's own log.
+		lines := bufio.NewScanner(stderr)
+		for lines.Scan() {
+			log.Warnf("external scanner %s: %s", init.Scanner, lines.Text())
+		}
+	}()
+
+	lines := bufio.NewScanner(stdout)
+	lines.Buffer(make([]byte, 64*1024), maxMessageLength)
+	ready := make(chan error, 1)
+	go func() {
+		if err := p.send(init); err != nil {
+			ready <- err
+			return
+		}
+		if !lines.Scan() {
+			ready <- fmt.Errorf("no ready message: %v", lines.Err())
+			return
+		}
+		var msg response
+		if err := json.Unmarshal(lines.Bytes(), &msg); err != nil || msg.Type != "ready" {
+			ready <- fmt.Errorf("expected a ready message, got %q", lines.Text())
+			return
+		}
+		p.protocol = msg.Protocol
+		ready <- nil
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(timeout):
+		err = fmt.Errorf("not ready after %s", timeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	go p.read(lines)
+	return p, nil
+}
+
+// send writes a request to the process.
+func (p *process) send(req *request) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	_, err = p.stdin.Write(append(b, '\n'))
+	return err
+}
+
+// read hands the results to the scans waiting for them until the process
+// exits, and then fails the scans still waiting.
+func (p *process) read(lines *bufio.Scanner) {
+	for lines.Scan() {
+		msg := new(response)
+		if err := json.Unmarshal(lines.Bytes(), msg); err != nil || msg.Type != "result" {
+			log.Warnf("external scanner: ignoring unexpected message %q", lines.Text())
+			continue
+		}
+		p.mutex.Lock()
+		ch := p.pending[msg.ID]
+		delete(p.pending, msg.ID)
+		p.mutex.Unlock()
+		if ch != nil {
+			ch <- msg
+		}
+	}
+	err := lines.Err()
+	if waitErr := p.cmd.Wait(); err == nil {
+		err = waitErr
+	}
+	p.mutex.Lock()
+	if err != nil {
+		p.err = fmt.Errorf("%v: %v", errProcessExited, err)
+	} else {
+		p.err = errProcessExited
+	}
+	p.pending = nil
+	p.mutex.Unlock()
+	close(p.exited)
+}
+
+// alive returns false once the process has exited.
+func (p *process) alive() bool {
+	select {
+	case <-p.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// scan sends the scan of a target and returns the channel of its result,
+// and the ID of the scan.
+func (p *process) scan(req *request) (<-chan *response, uint64, error) {
+	ch := make(chan *response, 1)
+	p.mutex.Lock()
+	if p.pending == nil {
+		err := p.err
+		p.mutex.Unlock()
+		return nil, 0, err
+	}
+	p.nextID++
+	req.ID = p.nextID
+	p.pending[req.ID] = ch
+	p.mutex.Unlock()
+	if err := p.send(req); err != nil {
+		p.forget(req.ID)
+		return nil, 0, err
+	}
+	return ch, req.ID, nil
+}
+
+// forget stops waiting for the result of a scan, and asks the process to
+// cancel it.
+func (p *process) forget(id uint64) {
+	p.mutex.Lock()
+	waiting := p.pending[id] != nil
+	delete(p.pending, id)
+	p.mutex.Unlock()
+	if waiting && p.alive() {
+		p.send(&request{Type: "cancel", ID: id})
+	}
+}
+
+// exitError returns why the process exited.
+func (p *process) exitError() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
@@ -0,0 +1,286 @@
+// Package external provides a zgrab2 module that runs scanners implemented
+// outside zgrab2, in any language, as subprocesses speaking JSON lines over
+// their standard input and output.
+//
+// zgrab2 starts --processes copies of --command, and first sends each an
+// init message with the scanner name, the default port, the --timeout and
+// the --arg values:
+//
+//	{"type": "init", "scanner": "acme", "port": 4000, "timeout_ms": 10000, "args": {"user": "guest"}}
+//
+// to which the process answers, on one line of its standard output:
+//
+//	{"type": "ready", "protocol": "acme"}
+//
+// Then each target is sent as a scan, with an ID:
+//
+//	{"type": "scan", "id": 1, "ip": "192.0.2.1", "domain": "example.com", "port": 4000, "tag": "t"}
+//
+// and the process writes its result, with the same ID, a zgrab2 status
+// (success, connection-refused, io-timeout, protocol-error, ...), the
+// module's result as any JSON value, and an error message unless it
+// succeeded:
+//
+//	{"type": "result", "id": 1, "status": "success", "result": {"version": "2.1"}}
+//
+// Scans are sent as the senders get targets, before the earlier ones are
+// answered, and may be answered in any order. A scan that zgrab2 gives up
+// on (after --scan-timeout, or when it is interrupted) is followed by a
+// {"type": "cancel", "id": 1} message, after which its result is ignored.
+// The standard error of the processes is logged. A process that exits is
+// started again for the next scan; the processes exit when their standard
+// input is closed.
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	log "github.com/sirupsen/logrus"
+)
+
+var errScanTimeout = errors.New("no result from the external scanner before --scan-timeout")
+
+// statuses are the statuses an external scanner may report.
+var statuses = map[zgrab2.ScanStatus]bool{
+	zgrab2.SCAN_SUCCESS:            true,
+	zgrab2.SCAN_SUCCESS_NOTCONTAIN: true,
+	zgrab2.SCAN_CONNECTION_REFUSED: true,
+	zgrab2.SCAN_CONNECTION_TIMEOUT: true,
+	zgrab2.SCAN_CONNECTION_CLOSED:  true,
+	zgrab2.SCAN_CONNECTION_RESET:   true,
+	zgrab2.SCAN_IO_TIMEOUT:         true,
+	zgrab2.SCAN_PROTOCOL_ERROR:     true,
+	zgrab2.SCAN_APPLICATION_ERROR:  true,
+	zgrab2.SCAN_UNKNOWN_ERROR:      true,
+}
+
+// Flags holds the command-line configuration for the external module.
+type Flags struct {
+	zgrab2.BaseFlags
+
+	Command     string        `long:"command" description:"Command line of the external scanner, split on spaces, e.g. '/opt/scanners/acme --verbose'"`
+	Args        []string      `long:"arg" description:"KEY=VALUE passed to the external scanner in its init message; may be repeated"`
+	Processes   int           `long:"processes" default:"1" description:"Number of external scanner processes the scans are spread over"`
+	ScanTimeout time.Duration `long:"scan-timeout" default:"1m" description:"Longest wait for the result of a scan"`
+	InitTimeout time.Duration `long:"init-timeout" default:"10s" description:"Longest wait for a process to answer its init message"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config  *Flags
+	command []string
+	init    *request
+
+	// processes are the running processes, restarted when they exit.
+	mutex     sync.Mutex
+	processes []*process
+	next      uint64
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("external", "External scanner", module.Description(), 0, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results, which is
+// any JSON value.
+func (module *Module) NewResult() interface{} {
+	return new(interface{})
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Run a scanner implemented by an external program speaking JSON lines over stdio"
+}
+
+// parseArgs parses the KEY=VALUE --arg values.
+func parseArgs(values []string) (map[string]string, error) {
+	ret := make(map[string]string)
+	for _, value := range values {
+		i := strings.IndexByte(value, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("expected KEY=VALUE, got %q", value)
+		}
+		ret[value[:i]] = value[i+1:]
+	}
+	return ret, nil
+}
+
+// Validate checks that the flags are valid.
+func (flags *Flags) Validate(args []string) error {
+	if len(strings.Fields(flags.Command)) == 0 {
+		log.Error("--command is required")
+		return zgrab2.ErrInvalidArguments
+	}
+	if _, err := parseArgs(flags.Args); err != nil {
+		log.Errorf("invalid --arg: %v", err)
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.Processes < 1 || flags.ScanTimeout <= 0 || flags.InitTimeout <= 0 {
+		log.Error("--processes, --scan-timeout and --init-timeout must be positive")
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner and starts the processes.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	scanner.command = strings.Fields(f.Command)
+	if len(scanner.command) == 0 {
+		return errors.New("no --command")
+	}
+	args, err := parseArgs(f.Args)
+	if err != nil {
+		return err
+	}
+	scanner.init = &request{
+		Type:      "init",
+		Scanner:   f.Name,
+		Port:      f.Port,
+		TimeoutMS: int64(f.Timeout / time.Millisecond),
+		Args:      args,
+	}
+	processes := f.Processes
+	if processes < 1 {
+		processes = 1
+	}
+	scanner.processes = make([]*process, processes)
+	for i := range scanner.processes {
+		if scanner.processes[i], err = startProcess(scanner.command, scanner.init, f.InitTimeout); err != nil {
+			return fmt.Errorf("starting %s: %v", scanner.command[0], err)
+		}
+	}
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol given by the external scanner, or external.
+func (scanner *Scanner) Protocol() string {
+	scanner.mutex.Lock()
+	defer scanner.mutex.Unlock()
+	if len(scanner.processes) > 0 && scanner.processes[0].protocol != "" {
+		return scanner.processes[0].protocol
+	}
+	return "external"
+}
+
+// process returns the next process in turn, started again if it exited.
+func (scanner *Scanner) process() (*process, error) {
+	i := int(atomic.AddUint64(&scanner.next, 1) % uint64(len(scanner.processes)))
+	scanner.mutex.Lock()
+	defer scanner.mutex.Unlock()
+	p := scanner.processes[i]
+	if !p.alive() {
+		log.Warnf("external scanner %s: %v, restarting it", scanner.config.Name, p.exitError())
+		restarted, err := startProcess(scanner.command, scanner.init, scanner.config.InitTimeout)
+		if err != nil {
+			return nil, err
+		}
+		scanner.processes[i], p = restarted, restarted
+	}
+	return p, nil
+}
+
+// Scan implements zgrab2.Scanner.
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	return scanner.ScanContext(target.Ctx(), target)
+}
+
+// ScanContext implements zgrab2.ScannerContext: the scan is canceled in the
+// external scanner when ctx is done.
+func (scanner *Scanner) ScanContext(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	p, err := scanner.process()
+	if err != nil {
+		return zgrab2.SCAN_UNKNOWN_ERROR, nil, err
+	}
+	req := &request{Type: "scan", Domain: target.Domain, Port: scanner.config.Port, Tag: target.Tag}
+	if target.IP != nil {
+		req.IP = target.IP.String()
+	}
+	if target.Port != nil {
+		req.Port = *target.Port
+	}
+	results, id, err := p.scan(req)
+	if err != nil {
+		return zgrab2.SCAN_UNKNOWN_ERROR, nil, err
+	}
+	timer := time.NewTimer(scanner.config.ScanTimeout)
+	defer timer.Stop()
+	select {
+	case msg := <-results:
+		return result(msg)
+	case <-p.exited:
+		return zgrab2.SCAN_UNKNOWN_ERROR, nil, p.exitError()
+	case <-timer.C:
+		p.forget(id)
+		return zgrab2.SCAN_IO_TIMEOUT, nil, errScanTimeout
+	case <-ctx.Done():
+		p.forget(id)
+		return zgrab2.SCAN_CANCELED, nil, ctx.Err()
+	}
+}
+
+// result returns the status, result and error of a result message.
+func result(msg *response) (zgrab2.ScanStatus, interface{}, error) {
+	status := zgrab2.ScanStatus(msg.Status)
+	if !statuses[status] {
+		return zgrab2.SCAN_UNKNOWN_ERROR, nil, fmt.Errorf("external scanner returned unknown status %q", msg.Status)
+	}
+	var res interface{}
+	if len(msg.Result) > 0 && string(msg.Result) != "null" {
+		res = msg.Result
+	}
+	switch {
+	case msg.Error != "":
+		return status, res, errors.New(msg.Error)
+	case status != zgrab2.SCAN_SUCCESS && status != zgrab2.SCAN_SUCCESS_NOTCONTAIN:
+		return status, res, errors.New(msg.Status)
+	}
+	return status, res, nil
+}
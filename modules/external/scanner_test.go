@@ -0,0 +1,146 @@
+package external
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// TestExternalHelper is the external scanner run by the tests: it answers
+// the scans of 192.0.2.1 with the init message, fails those of 192.0.2.2,
+// exits on 192.0.2.3 and never answers 192.0.2.4.
+func TestExternalHelper(t *testing.T) {
+	if os.Getenv("ZGRAB2_EXTERNAL_HELPER") != "1" {
+		return
+	}
+	lines := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	var init request
+	if !lines.Scan() || json.Unmarshal(lines.Bytes(), &init) != nil {
+		os.Exit(2)
+	}
+	encoder.Encode(map[string]string{"type": "ready", "protocol": "acme"})
+	for lines.Scan() {
+		var req request
+		json.Unmarshal(lines.Bytes(), &req)
+		if req.Type != "scan" {
+			continue
+		}
+		switch req.IP {
+		case "192.0.2.1":
+			encoder.Encode(map[string]interface{}{"type": "result", "id": req.ID, "status": "success", "result": map[string]interface{}{"init": init, "port": req.Port}})
+		case "192.0.2.2":
+			encoder.Encode(map[string]interface{}{"type": "result", "id": req.ID, "status": "protocol-error", "error": "bad greeting"})
+		case "192.0.2.3":
+			fmt.Fprintln(os.Stderr, "crashing")
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
+
+func newScanner(t *testing.T) *Scanner {
+	t.Setenv("ZGRAB2_EXTERNAL_HELPER", "1")
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags:   zgrab2.BaseFlags{Name: "acme", Port: 4000, Timeout: 10 * time.Second},
+		Command:     os.Args[0] + " -test.run=^TestExternalHelper$",
+		Args:        []string{"user=guest", "mode=a=b"},
+		Processes:   2,
+		ScanTimeout: 500 * time.Millisecond,
+		InitTimeout: 10 * time.Second,
+	}
+	if err := flags.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Init(flags); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, p := range scanner.processes {
+			p.stdin.Close()
+		}
+	})
+	return &scanner
+}
+
+func scan(scanner *Scanner, ip string) (zgrab2.ScanStatus, interface{}, error) {
+	port := uint(4001)
+	target := zgrab2.ScanTarget{IP: net.ParseIP(ip), Port: &port, Context: zgrab2.NewTargetContext()}
+	return scanner.Scan(target)
+}
+
+func TestScan(t *testing.T) {
+	scanner := newScanner(t)
+	if scanner.Protocol() != "acme" {
+		t.Errorf("got protocol %s", scanner.Protocol())
+	}
+	for i := 0; i < 2; i++ {
+		status, result, err := scan(scanner, "192.0.2.1")
+		if status != zgrab2.SCAN_SUCCESS || err != nil {
+			t.Fatalf("got %s, %v", status, err)
+		}
+		var decoded struct {
+			Init request `json:"init"`
+			Port uint    `json:"port"`
+		}
+		if err := json.Unmarshal(result.(json.RawMessage), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		init := decoded.Init
+		if init.Scanner != "acme" || init.Port != 4000 || init.TimeoutMS != 10000 || init.Args["user"] != "guest" || init.Args["mode"] != "a=b" || decoded.Port != 4001 {
+			t.Errorf("got %+v", decoded)
+		}
+	}
+
+	status, result, err := scan(scanner, "192.0.2.2")
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || result != nil || err == nil || err.Error() != "bad greeting" {
+		t.Errorf("got %s, %v, %v", status, result, err)
+	}
+
+	status, _, err = scan(scanner, "192.0.2.4")
+	if status != zgrab2.SCAN_IO_TIMEOUT || err != errScanTimeout {
+		t.Errorf("unanswered scan: got %s, %v", status, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	port := uint(4001)
+	status, _, _ = scanner.ScanContext(ctx, zgrab2.ScanTarget{IP: net.ParseIP("192.0.2.4"), Port: &port})
+	if status != zgrab2.SCAN_CANCELED {
+		t.Errorf("canceled scan: got %s", status)
+	}
+}
+
+func TestScanExited(t *testing.T) {
+	scanner := newScanner(t)
+	status, _, err := scan(scanner, "192.0.2.3")
+	if status != zgrab2.SCAN_UNKNOWN_ERROR || err == nil {
+		t.Errorf("got %s, %v", status, err)
+	}
+	// Both processes are tried: the one that exited is started again.
+	for i := 0; i < 2; i++ {
+		if status, _, err := scan(scanner, "192.0.2.1"); status != zgrab2.SCAN_SUCCESS {
+			t.Errorf("after the exit: got %s, %v", status, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, flags := range []*Flags{
+		{Processes: 1, ScanTimeout: time.Second, InitTimeout: time.Second},
+		{Command: "scanner", Args: []string{"user"}, Processes: 1, ScanTimeout: time.Second, InitTimeout: time.Second},
+		{Command: "scanner", Processes: 0, ScanTimeout: time.Second, InitTimeout: time.Second},
+	} {
+		if err := flags.Validate(nil); err != zgrab2.ErrInvalidArguments {
+			t.Errorf("%+v: got %v", flags, err)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package fox
 
+import "github.com/Positive-Engineer/zgrab2"
+
 // FoxLog is the struct returned to the caller.
 type FoxLog struct {
 	// IsFox should always be true (otherwise, the result should have been nil).
@@ -58,4 +60,12 @@ type FoxLog struct {
 
 	// AuthAgentType corresponds to the "authAgentTypeSpecs" field.
 	AuthAgentType string `json:"auth_agent_type,omitempty"`
+
+	// ICSDevice summarizes the fields above: the brand is the vendor, the
+	// application the product and the host ID the serial.
+	ICSDevice *zgrab2.ICSDevice `json:"ics_device,omitempty"`
+}
+
+func (log *FoxLog) icsDevice() *zgrab2.ICSDevice {
+	return zgrab2.NewICSDevice("fox", log.BrandId, log.AppName, log.AppVersion, log.HostId)
 }
@@ -46,6 +46,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(FoxLog)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for Tridium Fox"
@@ -107,6 +112,8 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	err = GetFoxBanner(result, conn)
 	if !result.IsFox {
 		result = nil
+	} else {
+		result.ICSDevice = result.icsDevice()
 	}
 	return zgrab2.TryGetScanStatus(err), result, err
 }
@@ -0,0 +1,66 @@
+package ftp
+
+import (
+	"strings"
+)
+
+// parseFEAT returns the features of a FEAT response (RFC 2389): the lines
+// between the first and the last line, which start with a space.
+func parseFEAT(response string) []string {
+	var features []string
+	lines := strings.Split(strings.TrimRight(response, "\r\n"), "\n")
+	if len(lines) < 3 {
+		return nil
+	}
+	for _, line := range lines[1 : len(lines)-1] {
+		if feature := strings.TrimSpace(line); feature != "" {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// hasAuthTLS returns true if the features include AUTH TLS or AUTH SSL
+// (RFC 4217, section 6).
+func hasAuthTLS(features []string) bool {
+	for _, feature := range features {
+		fields := strings.Fields(strings.ToUpper(feature))
+		if len(fields) < 2 || fields[0] != "AUTH" {
+			continue
+		}
+		for _, mechanism := range strings.Split(strings.Join(fields[1:], ""), ";") {
+			if mechanism == "TLS" || mechanism == "SSL" || mechanism == "TLS-C" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getFeatures sends FEAT and records the response and the features it
+// lists. A server that does not implement FEAT has no features.
+func (ftp *Connection) getFeatures() error {
+	ret, retCode, err := ftp.sendCommand("FEAT")
+	if err != nil {
+		return err
+	}
+	ftp.results.FeatResp = ret
+	if retCode == "211" {
+		ftp.results.Features = parseFEAT(ret)
+	}
+	return nil
+}
+
+// getSystemType sends SYST and records the system type of a 215 response,
+// e.g. "UNIX Type: L8".
+func (ftp *Connection) getSystemType() error {
+	ret, retCode, err := ftp.sendCommand("SYST")
+	if err != nil {
+		return err
+	}
+	ftp.results.SystResp = ret
+	if retCode == "215" {
+		ftp.results.SystemType = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(ret), "215"))
+	}
+	return nil
+}
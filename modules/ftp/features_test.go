@@ -0,0 +1,109 @@
+package ftp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/testutil"
+)
+
+// serveFTPS accepts one control connection of a server advertising AUTH
+// TLS, which only accepts the anonymous login once TLS is negotiated.
+func serveFTPS(t *testing.T) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	cert := testutil.Certificate(t, "ftp.example.com")
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { conn.Close() }()
+		fmt.Fprint(conn, "220 test server\r\n")
+		secure := false
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch strings.TrimSpace(line) {
+			case "FEAT":
+				fmt.Fprint(conn, "211-Features:\r\n AUTH TLS\r\n MDTM\r\n UTF8\r\n211 End\r\n")
+			case "SYST":
+				fmt.Fprint(conn, "215 UNIX Type: L8\r\n")
+			case "AUTH TLS":
+				fmt.Fprint(conn, "234 Proceed with negotiation.\r\n")
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				conn, secure = tlsConn, true
+				reader = bufio.NewReader(conn)
+			case "USER anonymous":
+				if !secure {
+					fmt.Fprint(conn, "530 Non-anonymous sessions must use encryption.\r\n")
+					continue
+				}
+				fmt.Fprint(conn, "331 Please specify the password.\r\n")
+			case "PASS anonymous@":
+				fmt.Fprint(conn, "230 Login successful.\r\n")
+			default:
+				fmt.Fprint(conn, "502 Command not implemented.\r\n")
+			}
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestFTPFeatures(t *testing.T) {
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags: zgrab2.BaseFlags{Port: serveFTPS(t), Timeout: 5 * time.Second},
+		Features:  true,
+		Anonymous: true,
+	}
+	scanner.Init(flags)
+	status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	results := result.(*ScanResults)
+	if !reflect.DeepEqual(results.Features, []string{"AUTH TLS", "MDTM", "UTF8"}) || results.SystemType != "UNIX Type: L8" {
+		t.Errorf("unexpected features %q, system type %q", results.Features, results.SystemType)
+	}
+	if results.TLSLog == nil || results.TLSLog.ServerCertificates() == nil {
+		t.Fatalf("no TLS log: %+v", results)
+	}
+	if cn := results.TLSLog.ServerCertificates().Certificate.Parsed.Subject.CommonName; cn != "ftp.example.com" {
+		t.Errorf("unexpected certificate %s", cn)
+	}
+	if !results.AnonymousLogin || results.Inventory != nil {
+		t.Errorf("unexpected login results %+v", results)
+	}
+}
+
+func TestParseFEAT(t *testing.T) {
+	for response, expected := range map[string][]string{
+		"211-Extensions supported:\r\n SIZE\r\n AUTH TLS;TLS-C\r\n211 END\r\n": {"SIZE", "AUTH TLS;TLS-C"},
+		"211 No features\r\n": nil,
+	} {
+		features := parseFEAT(response)
+		if !reflect.DeepEqual(features, expected) {
+			t.Errorf("parseFEAT(%q) = %q", response, features)
+		}
+	}
+	if !hasAuthTLS([]string{"SIZE", "AUTH TLS;TLS-C"}) || hasAuthTLS([]string{"AUTH"}) {
+		t.Error("hasAuthTLS")
+	}
+}
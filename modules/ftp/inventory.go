@@ -0,0 +1,163 @@
+package ftp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// maxListingBytes bounds how much of a directory listing is read.
+const maxListingBytes = 256 * 1024
+
+// pasvRegex matches the h1,h2,h3,h4,p1,p2 address of a 227 response.
+var pasvRegex = regexp.MustCompile(`(\d{1,3}),(\d{1,3}),(\d{1,3}),(\d{1,3}),(\d{1,3}),(\d{1,3})`)
+
+// pwdRegex matches the quoted directory of a 257 response.
+var pwdRegex = regexp.MustCompile(`"((?:[^"]|"")*)"`)
+
+// unixListRegex matches a line of ls -l style output, with or without the
+// group column: type, size and name.
+var unixListRegex = regexp.MustCompile(`^([-dlbcps])\S{9}\S*\s+\d+\s+(?:\S+\s+)?\S+\s+(\d+)\s+\w{3}\s+\d{1,2}\s+(?:\d{1,2}:\d{2}|\d{4})\s+(.+)$`)
+
+// dosListRegex matches a line of MS-DOS style output (e.g. IIS): size or
+// <DIR>, and name.
+var dosListRegex = regexp.MustCompile(`^\d{2}-\d{2}-\d{2,4}\s+\d{1,2}:\d{2}(?:AM|PM)?\s+(<DIR>|\d+)\s+(.+)$`)
+
+// loginAnonymous logs in as the anonymous user, and returns true if the
+// server accepted the login.
+func (ftp *Connection) loginAnonymous() (bool, error) {
+	ret, retCode, err := ftp.sendCommand("USER anonymous")
+	if err != nil {
+		return false, err
+	}
+	if retCode == "331" {
+		ret, retCode, err = ftp.sendCommand("PASS anonymous@")
+		if err != nil {
+			return false, err
+		}
+	}
+	ftp.results.AnonymousLoginResp = ret
+	ftp.results.AnonymousLogin = retCode == "230"
+	return ftp.results.AnonymousLogin, nil
+}
+
+// listDirectory records the entries of the current directory, read over a
+// passive data connection to the target, in inv. Reading stops once inv
+// is full.
+func (ftp *Connection) listDirectory(target zgrab2.ScanTarget, inv *zgrab2.Inventory) error {
+	if ret, retCode, err := ftp.sendCommand("PWD"); err == nil && retCode == "257" {
+		if m := pwdRegex.FindStringSubmatch(ret); m != nil {
+			inv.Path = strings.Replace(m[1], `""`, `"`, -1)
+		}
+	}
+	protected := false
+	if ftp.tls {
+		// The data connection is only encrypted if the server agrees to
+		// PROT P; otherwise it stays in the clear.
+		if _, retCode, err := ftp.sendCommand("PBSZ 0"); err == nil && ftp.isOKResponse(retCode) {
+			_, retCode, err = ftp.sendCommand("PROT P")
+			protected = err == nil && ftp.isOKResponse(retCode)
+		}
+	}
+	ret, retCode, err := ftp.sendCommand("PASV")
+	if err != nil {
+		return err
+	}
+	m := pasvRegex.FindStringSubmatch(ret)
+	if retCode != "227" || m == nil {
+		return fmt.Errorf("PASV failed: %s", strings.TrimSpace(ret))
+	}
+	p1, _ := strconv.Atoi(m[5])
+	p2, _ := strconv.Atoi(m[6])
+	// The data connection goes to the target itself, not to the advertised
+	// address, which may be private or point to another host.
+	port := uint(p1<<8 | p2)
+	target.Port = &port
+	dataConn, err := target.Open(&ftp.config.BaseFlags)
+	if err != nil {
+		return err
+	}
+	defer dataConn.Close()
+
+	ret, retCode, err = ftp.sendCommand("LIST")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(ret, "1") {
+		return fmt.Errorf("LIST failed: %s", strings.TrimSpace(ret))
+	}
+	// The end of the transfer may arrive along with the preliminary reply.
+	done := !strings.HasPrefix(retCode, "1")
+	var data net.Conn = dataConn
+	if protected {
+		tlsConn, err := ftp.config.TLSFlags.GetTLSConnection(dataConn)
+		if err != nil {
+			return err
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		data = tlsConn
+	}
+	lines := bufio.NewScanner(io.LimitReader(data, maxListingBytes))
+	for lines.Scan() {
+		entry, ok := parseListLine(lines.Text())
+		if ok && !inv.Add(entry) {
+			break
+		}
+	}
+	data.Close()
+	if err := lines.Err(); err != nil && !inv.Truncated {
+		return err
+	}
+	if done {
+		return nil
+	}
+	// Read the end of the transfer (226, or 426 if it was cut short).
+	_, _, err = ftp.readResponse()
+	return err
+}
+
+// parseListLine parses a line of LIST output. Unix and MS-DOS formats are
+// understood; other lines are recorded as a name alone. The "total" line
+// and the . and .. entries are skipped.
+func parseListLine(line string) (zgrab2.InventoryEntry, bool) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "total ") {
+		return zgrab2.InventoryEntry{}, false
+	}
+	entry := zgrab2.InventoryEntry{Name: line}
+	if m := unixListRegex.FindStringSubmatch(line); m != nil {
+		entry.Name = m[3]
+		entry.Size, _ = strconv.ParseInt(m[2], 10, 64)
+		switch m[1] {
+		case "d":
+			entry.Type = zgrab2.InventoryDirectory
+		case "l":
+			entry.Type = zgrab2.InventoryLink
+			if i := strings.Index(entry.Name, " -> "); i >= 0 {
+				entry.Name = entry.Name[:i]
+			}
+		case "-":
+			entry.Type = zgrab2.InventoryFile
+		}
+	} else if m := dosListRegex.FindStringSubmatch(line); m != nil {
+		entry.Name = m[2]
+		if m[1] == "<DIR>" {
+			entry.Type = zgrab2.InventoryDirectory
+		} else {
+			entry.Type = zgrab2.InventoryFile
+			entry.Size, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+	}
+	if entry.Name == "." || entry.Name == ".." {
+		return zgrab2.InventoryEntry{}, false
+	}
+	return entry, true
+}
@@ -6,8 +6,16 @@
 //
 // The scan performs a banner grab and (optionally) a TLS handshake.
 //
-// The output is the banner, any responses to the AUTH TLS/AUTH SSL commands,
-// and any TLS logs.
+// Setting the --features flag will cause the scanner to send FEAT and SYST,
+// and to upgrade the connection to TLS if the server advertises AUTH TLS.
+//
+// Setting the --anonymous flag will cause the scanner to attempt an anonymous
+// login. Setting the --inventory flag will additionally, if the login is
+// accepted, list the login directory.
+//
+// The output is the banner, the features and system type, any responses to
+// the AUTH TLS/AUTH SSL commands, any TLS logs, and the anonymous login
+// result and listing.
 package ftp
 
 import (
@@ -39,8 +47,38 @@ type ScanResults struct {
 	ImplicitTLS bool `json:"implicit_tls,omitempty"`
 
 	// TLSLog is the standard shared TLS handshake log.
-	// Only present if the FTPAuthTLS flag is set.
+	// Only present if the FTPAuthTLS flag is set, or the Features flag is
+	// set and the server advertises AUTH TLS.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// FeatResp is the response to the FEAT command.
+	// Only present if the Features flag is set.
+	FeatResp string `json:"feat,omitempty"`
+
+	// Features are the features listed in the response to FEAT.
+	Features []string `json:"features,omitempty"`
+
+	// SystResp is the response to the SYST command.
+	// Only present if the Features flag is set.
+	SystResp string `json:"syst,omitempty"`
+
+	// SystemType is the system type reported by SYST, e.g. "UNIX Type: L8".
+	SystemType string `json:"system_type,omitempty"`
+
+	// AnonymousLogin is true if the server accepted an anonymous login.
+	// Only attempted if the Anonymous or Inventory flag is set.
+	AnonymousLogin bool `json:"anonymous_login,omitempty"`
+
+	// AnonymousLoginResp is the final response to the anonymous login.
+	AnonymousLoginResp string `json:"anonymous_login_resp,omitempty"`
+
+	// Inventory lists the login directory, if the anonymous login
+	// succeeded.
+	Inventory *zgrab2.Inventory `json:"inventory,omitempty"`
+
+	// TruncatedByTimeout is true if a response was cut short by a read
+	// timeout; the partial response is kept.
+	TruncatedByTimeout bool `json:"truncated_by_timeout,omitempty"`
 }
 
 // Flags are the FTP-specific command-line flags. Taken from the original zgrab.
@@ -48,10 +86,13 @@ type ScanResults struct {
 type Flags struct {
 	zgrab2.BaseFlags
 	zgrab2.TLSFlags
+	zgrab2.InventoryFlags
 
 	Verbose     bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
 	FTPAuthTLS  bool `long:"authtls" description:"Collect FTPS certificates in addition to FTP banners"`
 	ImplicitTLS bool `long:"implicit-tls" description:"Attempt to connect via a TLS wrapped connection"`
+	Features    bool `long:"features" description:"Send FEAT and SYST, and collect FTPS certificates if the server advertises AUTH TLS"`
+	Anonymous   bool `long:"anonymous" description:"Attempt an anonymous login"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -72,6 +113,9 @@ type Connection struct {
 	config  *Flags
 	results ScanResults
 	conn    net.Conn
+
+	// tls is true once the control connection is wrapped in TLS.
+	tls bool
 }
 
 // RegisterModule registers the ftp zgrab2 module.
@@ -94,6 +138,11 @@ func (m *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (m *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (m *Module) Description() string {
 	return "Grab an FTP banner"
@@ -102,9 +151,9 @@ func (m *Module) Description() string {
 // Validate flags
 func (f *Flags) Validate(args []string) (err error) {
 	if f.FTPAuthTLS && f.ImplicitTLS {
-		err = fmt.Errorf("Cannot specify both '--authtls' and '--implicit-tls' together")
+		return fmt.Errorf("Cannot specify both '--authtls' and '--implicit-tls' together")
 	}
-	return
+	return f.InventoryFlags.Validate()
 }
 
 // Help returns this module's help string.
@@ -155,8 +204,13 @@ func (ftp *Connection) isOKResponse(retCode string) bool {
 
 // readResponse reads an FTP response chunk from the server.
 // It returns the full response, as well as the status code alone.
+// A response cut short by a timeout is returned without a status code.
 func (ftp *Connection) readResponse() (string, string, error) {
 	respLen, err := zgrab2.ReadUntilRegex(ftp.conn, ftp.buffer[:], ftpEndRegex)
+	if zgrab2.TruncatedByTimeout(respLen, err) {
+		ftp.results.TruncatedByTimeout = true
+		return string(ftp.buffer[0:respLen]), "", nil
+	}
 	if err != nil {
 		return "", "", err
 	}
@@ -235,16 +289,22 @@ func (ftp *Connection) GetFTPSCertificates() error {
 		return err
 	}
 	ftp.conn = conn
+	ftp.tls = true
 	return nil
 }
 
 // Scan performs the configured scan on the FTP server, as follows:
 // * Read the banner into results.Banner (if it is not a 2XX response, bail)
-// * If the FTPAuthTLS flag is not set, finish.
-// * Send the AUTH TLS command to the server. If the response is not 2XX, then
-//   send the AUTH SSL command. If the response is not 2XX, then finish.
-// * Perform ths TLS handshake / any configured TLS scans, populating
+// * If the Features flag is set, send FEAT and SYST, populating
+//   results.Features and results.SystemType.
+// * If the FTPAuthTLS flag is set, or the Features flag is set and FEAT
+//   advertised AUTH TLS, send the AUTH TLS command to the server. If the
+//   response is not 2XX, then send the AUTH SSL command. If the response is
+//   2XX, perform ths TLS handshake / any configured TLS scans, populating
 //   results.TLSLog.
+// * If the Anonymous or Inventory flag is set, log in as anonymous.
+// * If the Inventory flag is set and the login succeeded, list the directory
+//   into results.Inventory.
 // * Return SCAN_SUCCESS, &results, nil
 func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
 	var err error
@@ -269,15 +329,36 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 		cn = tlsConn
 	}
 
-	ftp := Connection{conn: cn, config: s.config, results: results}
+	ftp := Connection{conn: cn, config: s.config, results: results, tls: results.ImplicitTLS}
 	is200Banner, err := ftp.GetFTPBanner()
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), &ftp.results, err
 	}
-	if s.config.FTPAuthTLS && is200Banner {
+	if s.config.Features && is200Banner {
+		if err := ftp.getFeatures(); err != nil {
+			return zgrab2.TryGetScanStatus(err), &ftp.results, err
+		}
+		if err := ftp.getSystemType(); err != nil {
+			return zgrab2.TryGetScanStatus(err), &ftp.results, err
+		}
+	}
+	authTLS := s.config.FTPAuthTLS || (s.config.Features && !ftp.tls && hasAuthTLS(ftp.results.Features))
+	if authTLS && is200Banner {
 		if err := ftp.GetFTPSCertificates(); err != nil {
 			return zgrab2.SCAN_APPLICATION_ERROR, &ftp.results, err
 		}
 	}
+	if (s.config.Anonymous || s.config.Inventory) && is200Banner {
+		loggedIn, err := ftp.loginAnonymous()
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), &ftp.results, err
+		}
+		if loggedIn && s.config.Inventory {
+			ftp.results.Inventory = s.config.NewInventory("")
+			if err := ftp.listDirectory(t, ftp.results.Inventory); err != nil {
+				ftp.results.Inventory.Error = err.Error()
+			}
+		}
+	}
 	return zgrab2.SCAN_SUCCESS, &ftp.results, nil
 }
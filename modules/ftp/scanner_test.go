@@ -0,0 +1,124 @@
+package ftp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// serveFTP accepts one control connection and answers an anonymous login
+// and a passive LIST with listing.
+func serveFTP(t *testing.T, listing string) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var data net.Listener
+		fmt.Fprint(conn, "220 test server\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.Fields(line)[0]; cmd {
+			case "USER":
+				fmt.Fprint(conn, "331 Please specify the password.\r\n")
+			case "PASS":
+				fmt.Fprint(conn, "230 Login successful.\r\n")
+			case "PWD":
+				fmt.Fprint(conn, "257 \"/pub\" is the current directory\r\n")
+			case "PASV":
+				data, err = net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					return
+				}
+				defer data.Close()
+				port := data.Addr().(*net.TCPAddr).Port
+				// Advertise an address other than the server's.
+				fmt.Fprintf(conn, "227 Entering Passive Mode (10,1,2,3,%d,%d).\r\n", port>>8, port&0xff)
+			case "LIST":
+				dataConn, err := data.Accept()
+				if err != nil {
+					return
+				}
+				fmt.Fprint(conn, "150 Here comes the directory listing.\r\n")
+				fmt.Fprint(dataConn, listing)
+				dataConn.Close()
+				fmt.Fprint(conn, "226 Directory send OK.\r\n")
+			default:
+				fmt.Fprint(conn, "502 Command not implemented.\r\n")
+			}
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestFTPInventory(t *testing.T) {
+	listing := "total 12\r\n" +
+		"drwxr-xr-x    2 0        0            4096 Jan 01 00:00 .\r\n" +
+		"drwxr-xr-x    2 0        0            4096 Jan 01 00:00 incoming\r\n" +
+		"-rw-r--r--    1 ftp      ftp         12345 Mar 15  2019 read me.txt\r\n" +
+		"lrwxrwxrwx    1 0        0               4 Jan 01 00:00 latest -> v1.0\r\n"
+	for _, test := range []struct {
+		max       int
+		names     []string
+		truncated bool
+	}{
+		{10, []string{"incoming", "read me.txt", "latest"}, false},
+		{2, []string{"incoming", "read me.txt"}, true},
+	} {
+		var scanner Scanner
+		flags := &Flags{
+			BaseFlags:      zgrab2.BaseFlags{Port: serveFTP(t, listing), Timeout: 5 * time.Second},
+			InventoryFlags: zgrab2.InventoryFlags{Inventory: true, InventoryMaxEntries: test.max},
+		}
+		scanner.Init(flags)
+		status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+		if status != zgrab2.SCAN_SUCCESS || err != nil {
+			t.Fatalf("scan failed: %s %v", status, err)
+		}
+		results := result.(*ScanResults)
+		if !results.AnonymousLogin || results.Inventory == nil {
+			t.Fatalf("no inventory: %+v", results)
+		}
+		inv := results.Inventory
+		if inv.Error != "" || inv.Path != "/pub" || inv.Truncated != test.truncated || len(inv.Entries) != len(test.names) {
+			t.Fatalf("unexpected inventory: %+v", inv)
+		}
+		for i, name := range test.names {
+			if inv.Entries[i].Name != name {
+				t.Errorf("entry %d: got %s, expected %s", i, inv.Entries[i].Name, name)
+			}
+		}
+		if inv.Entries[0].Type != zgrab2.InventoryDirectory || inv.Entries[1].Size != 12345 || inv.Entries[1].Type != zgrab2.InventoryFile {
+			t.Errorf("unexpected entries: %+v", inv.Entries)
+		}
+	}
+}
+
+func TestParseListLine(t *testing.T) {
+	for line, expected := range map[string]zgrab2.InventoryEntry{
+		"-rw-r--r-- 1 owner 1024 Jan  1 12:00 file.bin":    {Name: "file.bin", Type: zgrab2.InventoryFile, Size: 1024},
+		"01-02-20  10:00AM       <DIR>          wwwroot":   {Name: "wwwroot", Type: zgrab2.InventoryDirectory},
+		"01-02-2020  10:00PM                 77 notes.txt": {Name: "notes.txt", Type: zgrab2.InventoryFile, Size: 77},
+		"something else": {Name: "something else"},
+	} {
+		entry, ok := parseListLine(line)
+		if !ok || entry != expected {
+			t.Errorf("parseListLine(%q) = %+v, %v", line, entry, ok)
+		}
+	}
+}
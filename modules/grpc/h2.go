@@ -0,0 +1,183 @@
+package grpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2Conn is a minimal HTTP/2 client for unary-style gRPC calls: the whole
+// request is sent, then the response is read to the end of the stream.
+type h2Conn struct {
+	conn      net.Conn
+	framer    *http2.Framer
+	decoder   *hpack.Decoder
+	scheme    string
+	authority string
+	userAgent string
+	maxSize   int
+	streamID  uint32
+}
+
+// h2Response is the response to a call.
+type h2Response struct {
+	// Headers holds the response headers and trailers, lowercase; the
+	// trailers of a gRPC response carry grpc-status.
+	Headers map[string]string
+	Body    []byte
+
+	// Reset is the error code of a RST_STREAM ending the stream.
+	Reset string
+}
+
+// newH2Conn sends the client preface over conn.
+func newH2Conn(conn net.Conn, scheme string, authority string, userAgent string, maxSize int) (*h2Conn, error) {
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		return nil, err
+	}
+	framer := http2.NewFramer(conn, conn)
+	framer.SetMaxReadFrameSize(1 << 20)
+	if err := framer.WriteSettings(); err != nil {
+		return nil, err
+	}
+	return &h2Conn{
+		conn:      conn,
+		framer:    framer,
+		decoder:   hpack.NewDecoder(4096, nil),
+		scheme:    scheme,
+		authority: authority,
+		userAgent: userAgent,
+		maxSize:   maxSize,
+		streamID:  1,
+	}, nil
+}
+
+// call POSTs body to path on a new stream as a gRPC request and reads the
+// response.
+func (c *h2Conn) call(path string, body []byte) (*h2Response, error) {
+	streamID := c.streamID
+	c.streamID += 2
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: "POST"},
+		{Name: ":scheme", Value: c.scheme},
+		{Name: ":authority", Value: c.authority},
+		{Name: ":path", Value: path},
+		{Name: "content-type", Value: "application/grpc"},
+		{Name: "te", Value: "trailers"},
+		{Name: "user-agent", Value: c.userAgent},
+	} {
+		if err := encoder.WriteField(field); err != nil {
+			return nil, err
+		}
+	}
+	err := c.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: block.Bytes(),
+		EndHeaders:    true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.framer.WriteData(streamID, true, body); err != nil {
+		return nil, err
+	}
+	return c.readResponse(streamID)
+}
+
+// readResponse reads frames until the stream ends, acknowledging the
+// server's SETTINGS and PINGs and keeping its flow control window open.
+func (c *h2Conn) readResponse(streamID uint32) (*h2Response, error) {
+	ret := &h2Response{Headers: make(map[string]string)}
+	var block []byte
+	// headersEnd is set by a HEADERS frame ending the stream, which only
+	// ends once its CONTINUATION frames are read.
+	headersEnd := false
+	for {
+		frame, err := c.framer.ReadFrame()
+		if err != nil {
+			return ret, err
+		}
+		endStream := false
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				if err := c.framer.WriteSettingsAck(); err != nil {
+					return ret, err
+				}
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				if err := c.framer.WritePing(true, f.Data); err != nil {
+					return ret, err
+				}
+			}
+		case *http2.GoAwayFrame:
+			return ret, fmt.Errorf("GOAWAY %s: %s", f.ErrCode, f.DebugData())
+		case *http2.RSTStreamFrame:
+			if f.StreamID == streamID {
+				ret.Reset = f.ErrCode.String()
+				return ret, nil
+			}
+		case *http2.HeadersFrame:
+			if f.StreamID != streamID {
+				continue
+			}
+			block = append(block[:0], f.HeaderBlockFragment()...)
+			if f.HeadersEnded() {
+				if err := c.decodeHeaders(block, ret); err != nil {
+					return ret, err
+				}
+			}
+			headersEnd = f.StreamEnded()
+			endStream = headersEnd && f.HeadersEnded()
+		case *http2.ContinuationFrame:
+			if f.StreamID != streamID {
+				continue
+			}
+			block = append(block, f.HeaderBlockFragment()...)
+			if f.HeadersEnded() {
+				if err := c.decodeHeaders(block, ret); err != nil {
+					return ret, err
+				}
+				endStream = headersEnd
+			}
+		case *http2.DataFrame:
+			if f.StreamID != streamID {
+				continue
+			}
+			if len(ret.Body)+len(f.Data()) > c.maxSize {
+				return ret, errors.New("response too large")
+			}
+			ret.Body = append(ret.Body, f.Data()...)
+			endStream = f.StreamEnded()
+			if n := uint32(len(f.Data())); n > 0 {
+				c.framer.WriteWindowUpdate(0, n)
+				if !endStream {
+					c.framer.WriteWindowUpdate(streamID, n)
+				}
+			}
+		}
+		if endStream {
+			return ret, nil
+		}
+	}
+}
+
+func (c *h2Conn) decodeHeaders(block []byte, response *h2Response) error {
+	fields, err := c.decoder.DecodeFull(block)
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		response.Headers[strings.ToLower(field.Name)] = field.Value
+	}
+	return nil
+}
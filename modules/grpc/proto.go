@@ -0,0 +1,117 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errTruncated is returned for a protobuf message or gRPC frame cut short.
+var errTruncated = errors.New("truncated message")
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// appendVarint appends v in the protobuf varint encoding.
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendBytesField appends a length-delimited field.
+func appendBytesField(b []byte, field int, value []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|wireBytes)
+	b = appendVarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func readVarint(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errTruncated
+}
+
+// forEachField calls fn for each field of a protobuf message, with the
+// value of varint and fixed fields, or the data of length-delimited ones.
+func forEachField(b []byte, fn func(field int, wireType int, value uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n, err := readVarint(b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+		field, wireType := int(tag>>3), int(tag&7)
+		var value uint64
+		var data []byte
+		switch wireType {
+		case wireVarint:
+			if value, n, err = readVarint(b); err != nil {
+				return err
+			}
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			value, n = binary.LittleEndian.Uint64(b), 8
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			value, n = uint64(binary.LittleEndian.Uint32(b)), 4
+		case wireBytes:
+			length, m, err := readVarint(b)
+			if err != nil {
+				return err
+			}
+			if length > uint64(len(b)-m) {
+				return errTruncated
+			}
+			data, n = b[m:m+int(length)], m+int(length)
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+		b = b[n:]
+		if err := fn(field, wireType, value, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grpcFrame prefixes an uncompressed message with the gRPC message header.
+func grpcFrame(message []byte) []byte {
+	ret := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(ret[1:], uint32(len(message)))
+	return append(ret, message...)
+}
+
+// splitGRPCFrames splits a gRPC body into its messages. The flags byte of
+// each is returned too; gRPC-Web marks trailers with 0x80.
+func splitGRPCFrames(body []byte) (flags []byte, messages [][]byte, err error) {
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return flags, messages, errTruncated
+		}
+		length := binary.BigEndian.Uint32(body[1:5])
+		if uint64(length) > uint64(len(body)-5) {
+			return flags, messages, errTruncated
+		}
+		flags = append(flags, body[0])
+		messages = append(messages, body[5:5+length])
+		body = body[5+length:]
+	}
+	return flags, messages, nil
+}
@@ -0,0 +1,102 @@
+package grpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test messages, built with the same encoder the scanner uses.
+
+func listServicesResponse(services ...string) []byte {
+	var list []byte
+	for _, service := range services {
+		list = appendBytesField(list, 1, appendBytesField(nil, 1, []byte(service)))
+	}
+	return appendBytesField(nil, responseListServices, list)
+}
+
+func fileDescriptorResponse(descriptors ...[]byte) []byte {
+	var files []byte
+	for _, descriptor := range descriptors {
+		files = appendBytesField(files, 1, descriptor)
+	}
+	return appendBytesField(nil, responseFileDescriptors, files)
+}
+
+func greeterDescriptor() []byte {
+	method := appendBytesField(nil, 1, []byte("SayHello"))
+	method = appendBytesField(method, 2, []byte(".helloworld.HelloRequest"))
+	method = appendBytesField(method, 3, []byte(".helloworld.HelloReply"))
+	stream := appendBytesField(nil, 1, []byte("StreamHello"))
+	stream = appendVarint(stream, 6<<3|wireVarint)
+	stream = appendVarint(stream, 1)
+	service := appendBytesField(nil, 1, []byte("Greeter"))
+	service = appendBytesField(service, 2, method)
+	service = appendBytesField(service, 2, stream)
+	descriptor := appendBytesField(nil, 1, []byte("helloworld.proto"))
+	descriptor = appendBytesField(descriptor, 2, []byte("helloworld"))
+	return appendBytesField(descriptor, 6, service)
+}
+
+func TestVarint(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 300, 1<<63 + 5} {
+		got, n, err := readVarint(appendVarint(nil, v))
+		if err != nil || got != v || n != len(appendVarint(nil, v)) {
+			t.Errorf("%d: got %d (%d bytes): %v", v, got, n, err)
+		}
+	}
+	if _, _, err := readVarint([]byte{0x80, 0x80}); err != errTruncated {
+		t.Errorf("got %v for a truncated varint", err)
+	}
+}
+
+func TestParseReflectionResponse(t *testing.T) {
+	parsed, err := parseReflectionResponse(listServicesResponse("helloworld.Greeter", "grpc.reflection.v1alpha.ServerReflection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed.services, []string{"helloworld.Greeter", "grpc.reflection.v1alpha.ServerReflection"}) {
+		t.Errorf("services %v", parsed.services)
+	}
+
+	errorResponse := appendVarint(nil, 1<<3|wireVarint)
+	errorResponse = appendVarint(errorResponse, 5)
+	errorResponse = appendBytesField(errorResponse, 2, []byte("symbol not found"))
+	parsed, err = parseReflectionResponse(appendBytesField(nil, responseError, errorResponse))
+	if err != nil || parsed.errorCode != 5 || parsed.errorMessage != "symbol not found" {
+		t.Errorf("error response %+v: %v", parsed, err)
+	}
+
+	if _, err := parseReflectionResponse(listServicesResponse("a")[:4]); err != errTruncated {
+		t.Errorf("got %v for a truncated response", err)
+	}
+}
+
+func TestParseFileDescriptor(t *testing.T) {
+	methods := make(map[string][]*Method)
+	if err := parseFileDescriptor(greeterDescriptor(), methods); err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Method{
+		{Name: "SayHello", InputType: "helloworld.HelloRequest", OutputType: "helloworld.HelloReply"},
+		{Name: "StreamHello", ServerStreaming: true},
+	}
+	if !reflect.DeepEqual(methods["helloworld.Greeter"], expected) {
+		t.Errorf("got %v", methods)
+	}
+}
+
+func TestSplitGRPCFrames(t *testing.T) {
+	body := append(grpcFrame([]byte("one")), grpcFrame(nil)...)
+	body = append(body, 0x80, 0, 0, 0, 2, 'o', 'k')
+	flags, messages, err := splitGRPCFrames(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(flags, []byte{0, 0, 0x80}) || len(messages) != 3 || string(messages[0]) != "one" || string(messages[2]) != "ok" {
+		t.Errorf("flags %v, messages %q", flags, messages)
+	}
+	if _, _, err := splitGRPCFrames(body[:len(body)-1]); err != errTruncated {
+		t.Errorf("got %v for a truncated body", err)
+	}
+}
@@ -0,0 +1,177 @@
+package grpc
+
+import "strings"
+
+// The reflection services, tried in order: v1alpha is the most widely
+// deployed, v1 replaces it in newer servers.
+var reflectionServices = []string{
+	"grpc.reflection.v1alpha.ServerReflection",
+	"grpc.reflection.v1.ServerReflection",
+}
+
+// reflectionPath returns the path of the ServerReflectionInfo method.
+func reflectionPath(service string) string {
+	return "/" + service + "/ServerReflectionInfo"
+}
+
+// Fields of ServerReflectionRequest.
+const (
+	requestHost                 = 1
+	requestFileContainingSymbol = 4
+	requestListServices         = 7
+)
+
+// Fields of ServerReflectionResponse and its nested messages.
+const (
+	responseFileDescriptors = 4
+	responseListServices    = 6
+	responseError           = 7
+)
+
+// listServicesRequest returns a ServerReflectionRequest for list_services.
+func listServicesRequest(host string) []byte {
+	var ret []byte
+	if host != "" {
+		ret = appendBytesField(ret, requestHost, []byte(host))
+	}
+	return appendBytesField(ret, requestListServices, []byte("*"))
+}
+
+// fileContainingSymbolRequest returns a ServerReflectionRequest for the
+// file descriptors defining symbol.
+func fileContainingSymbolRequest(host string, symbol string) []byte {
+	var ret []byte
+	if host != "" {
+		ret = appendBytesField(ret, requestHost, []byte(host))
+	}
+	return appendBytesField(ret, requestFileContainingSymbol, []byte(symbol))
+}
+
+// reflectionResponse holds the fields of a ServerReflectionResponse used
+// by the scanner.
+type reflectionResponse struct {
+	services        []string
+	fileDescriptors [][]byte
+	errorCode       int
+	errorMessage    string
+}
+
+func parseReflectionResponse(message []byte) (*reflectionResponse, error) {
+	ret := new(reflectionResponse)
+	err := forEachField(message, func(field int, wireType int, value uint64, data []byte) error {
+		if wireType != wireBytes {
+			return nil
+		}
+		switch field {
+		case responseFileDescriptors:
+			// FileDescriptorResponse: repeated bytes file_descriptor_proto = 1.
+			return forEachField(data, func(field int, wireType int, value uint64, data []byte) error {
+				if field == 1 && wireType == wireBytes {
+					ret.fileDescriptors = append(ret.fileDescriptors, data)
+				}
+				return nil
+			})
+		case responseListServices:
+			// ListServiceResponse: repeated ServiceResponse service = 1,
+			// whose name is field 1.
+			return forEachField(data, func(field int, wireType int, value uint64, data []byte) error {
+				if field != 1 || wireType != wireBytes {
+					return nil
+				}
+				return forEachField(data, func(field int, wireType int, value uint64, data []byte) error {
+					if field == 1 && wireType == wireBytes {
+						ret.services = append(ret.services, string(data))
+					}
+					return nil
+				})
+			})
+		case responseError:
+			// ErrorResponse: int32 error_code = 1, string error_message = 2.
+			return forEachField(data, func(field int, wireType int, value uint64, data []byte) error {
+				switch {
+				case field == 1 && wireType == wireVarint:
+					ret.errorCode = int(int32(value))
+				case field == 2 && wireType == wireBytes:
+					ret.errorMessage = string(data)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// Method is a method of an exposed service.
+type Method struct {
+	Name            string `json:"name"`
+	InputType       string `json:"input_type,omitempty"`
+	OutputType      string `json:"output_type,omitempty"`
+	ClientStreaming bool   `json:"client_streaming,omitempty"`
+	ServerStreaming bool   `json:"server_streaming,omitempty"`
+}
+
+// Service is a service listed by the reflection service.
+type Service struct {
+	Name string `json:"name"`
+
+	// Methods are read from the service's file descriptor; they are
+	// missing if the server did not return it.
+	Methods []*Method `json:"methods,omitempty"`
+}
+
+// parseFileDescriptor returns the methods of the services defined in a
+// FileDescriptorProto, by fully qualified service name.
+func parseFileDescriptor(descriptor []byte, methods map[string][]*Method) error {
+	var pkg string
+	var services [][]byte
+	err := forEachField(descriptor, func(field int, wireType int, value uint64, data []byte) error {
+		switch {
+		case field == 2 && wireType == wireBytes:
+			pkg = string(data)
+		case field == 6 && wireType == wireBytes:
+			services = append(services, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		var name string
+		var serviceMethods []*Method
+		err := forEachField(service, func(field int, wireType int, value uint64, data []byte) error {
+			switch {
+			case field == 1 && wireType == wireBytes:
+				name = string(data)
+			case field == 2 && wireType == wireBytes:
+				method := new(Method)
+				serviceMethods = append(serviceMethods, method)
+				return forEachField(data, func(field int, wireType int, value uint64, data []byte) error {
+					switch {
+					case field == 1 && wireType == wireBytes:
+						method.Name = string(data)
+					case field == 2 && wireType == wireBytes:
+						method.InputType = strings.TrimPrefix(string(data), ".")
+					case field == 3 && wireType == wireBytes:
+						method.OutputType = strings.TrimPrefix(string(data), ".")
+					case field == 5 && wireType == wireVarint:
+						method.ClientStreaming = value != 0
+					case field == 6 && wireType == wireVarint:
+						method.ServerStreaming = value != 0
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if pkg != "" {
+			name = pkg + "." + name
+		}
+		methods[name] = serviceMethods
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+// Package grpc provides a zgrab2 module that probes gRPC servers for the
+// server reflection service.
+// Default Port: 50051 (TCP)
+//
+// The scanner speaks HTTP/2 with prior knowledge (h2c), or, with --tls,
+// over TLS with ALPN h2, and calls ServerReflectionInfo with a
+// list_services request, first on grpc.reflection.v1alpha and then on
+// grpc.reflection.v1 if that is not implemented. If reflection is enabled,
+// the file descriptor of each service is requested to list its methods.
+//
+// Any response carrying grpc-status identifies a gRPC server, even with
+// reflection disabled.
+//
+// With --grpc-web, the reflection call is also sent as a gRPC-Web request
+// over HTTP/1.1 on a new connection, to detect gRPC-Web endpoints and
+// proxies.
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+)
+
+// statusUnimplemented is the gRPC status of a call to an unknown method.
+const statusUnimplemented = 12
+
+// statusNames are the names of the gRPC status codes.
+var statusNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED",
+	"NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED",
+	"INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+// errNotGRPC is returned if the server speaks HTTP/2 but not gRPC.
+var errNotGRPC = errors.New("no grpc-status in the response")
+
+// ScanResults instances are returned by the module's Scan function.
+type ScanResults struct {
+	// Protocol is h2 over TLS or h2c.
+	Protocol string `json:"protocol,omitempty"`
+
+	// ALPN is the protocol negotiated with --tls.
+	ALPN string `json:"alpn,omitempty"`
+
+	// IsGRPC is true if the reflection call was answered with a gRPC
+	// status.
+	IsGRPC bool `json:"is_grpc"`
+
+	// ReflectionEnabled is true if a reflection service listed services.
+	ReflectionEnabled bool   `json:"reflection_enabled"`
+	ReflectionService string `json:"reflection_service,omitempty"`
+
+	// Status and StatusMessage are the grpc-status and grpc-message of the
+	// last list_services call.
+	Status        *int   `json:"status,omitempty"`
+	StatusName    string `json:"status_name,omitempty"`
+	StatusMessage string `json:"status_message,omitempty"`
+
+	// Services are the services listed, with their methods.
+	Services []*Service `json:"services,omitempty"`
+
+	// Error is the error of the file descriptor requests.
+	Error string `json:"error,omitempty"`
+
+	// GRPCWeb holds the results of --grpc-web.
+	GRPCWeb *GRPCWebResult `json:"grpc_web,omitempty"`
+
+	// TLSLog is the standard TLS log, if --tls is set.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// Flags holds the command-line configuration for the grpc scan module.
+// Populated by the framework.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	// UseTLS speaks HTTP/2 over TLS instead of h2c.
+	UseTLS bool `long:"tls" description:"Connect over TLS with ALPN h2 instead of cleartext HTTP/2"`
+
+	// Authority overrides the :authority, which is the target domain or IP.
+	Authority string `long:"authority" description:"The :authority (and reflection host) to send, instead of the target domain or IP"`
+
+	UserAgent   string `long:"user-agent" default:"grpc-go/1.25.0 zgrab/0.x" description:"Set a custom user agent"`
+	MaxServices int    `long:"max-services" default:"100" description:"Max number of services to request the methods of"`
+	MaxSize     int    `long:"max-size" default:"1024" description:"Max kilobytes of each response to read"`
+
+	// GRPCWeb also probes for a gRPC-Web endpoint.
+	GRPCWeb bool `long:"grpc-web" description:"Also send the reflection call as a gRPC-Web request over HTTP/1.1"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("grpc", "grpc", module.Description(), 50051, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Probe gRPC servers for server reflection and list the exposed services"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if flags.MaxSize <= 0 || flags.MaxServices < 0 {
+		log.Error("--max-size must be positive and --max-services not negative")
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "grpc"
+}
+
+// authority returns the :authority for the target.
+func (scanner *Scanner) authority(target *zgrab2.ScanTarget) string {
+	if scanner.config.Authority != "" {
+		return scanner.config.Authority
+	}
+	port := scanner.config.Port
+	if target.Port != nil {
+		port = *target.Port
+	}
+	return net.JoinHostPort(target.Host(), strconv.FormatUint(uint64(port), 10))
+}
+
+// open connects to the target, over TLS with the given ALPN protocols if
+// --tls is set.
+func (scanner *Scanner) open(target *zgrab2.ScanTarget, result *ScanResults, protocols ...string) (net.Conn, error) {
+	conn, err := target.Open(&scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(scanner.config.Timeout))
+	if !scanner.config.UseTLS {
+		return conn, nil
+	}
+	cfg, err := scanner.config.TLSFlags.GetTLSConfigForTarget(target)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	cfg.NextProtos = protocols
+	tlsConn := scanner.config.TLSFlags.GetWrappedConnection(conn, cfg)
+	if result != nil {
+		result.TLSLog = tlsConn.GetLog()
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	if result != nil {
+		result.ALPN = tlsConn.ConnectionState().NegotiatedProtocol
+	}
+	return tlsConn, nil
+}
+
+// grpcStatus returns the grpc-status of a response, or nil.
+func grpcStatus(headers map[string]string) *int {
+	value, ok := headers["grpc-status"]
+	if !ok {
+		return nil
+	}
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &status
+}
+
+// statusName returns the name of a gRPC status code.
+func statusName(status int) string {
+	if status >= 0 && status < len(statusNames) {
+		return statusNames[status]
+	}
+	return "CODE_" + strconv.Itoa(status)
+}
+
+// listServices calls list_services on each reflection service until one
+// is implemented.
+func (scanner *Scanner) listServices(conn *h2Conn, result *ScanResults) ([]string, string, error) {
+	for _, service := range reflectionServices {
+		response, err := conn.call(reflectionPath(service), grpcFrame(listServicesRequest(scanner.config.Authority)))
+		if err != nil {
+			return nil, "", err
+		}
+		if response.Reset != "" {
+			return nil, "", fmt.Errorf("stream reset: %s", response.Reset)
+		}
+		status := grpcStatus(response.Headers)
+		if status == nil {
+			return nil, "", errNotGRPC
+		}
+		result.IsGRPC = true
+		result.Status = status
+		result.StatusName = statusName(*status)
+		result.StatusMessage = response.Headers["grpc-message"]
+		if *status == statusUnimplemented {
+			continue
+		}
+		if *status != 0 {
+			return nil, "", nil
+		}
+		_, messages, err := splitGRPCFrames(response.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		var services []string
+		for _, message := range messages {
+			parsed, err := parseReflectionResponse(message)
+			if err != nil {
+				return nil, "", err
+			}
+			if parsed.errorCode != 0 {
+				result.StatusMessage = parsed.errorMessage
+			}
+			services = append(services, parsed.services...)
+		}
+		return services, service, nil
+	}
+	return nil, "", nil
+}
+
+// describeServices requests the file descriptors of the services and
+// returns their methods by service name.
+func (scanner *Scanner) describeServices(conn *h2Conn, reflectionService string, services []string) (map[string][]*Method, error) {
+	var body []byte
+	for _, service := range services {
+		body = append(body, grpcFrame(fileContainingSymbolRequest(scanner.config.Authority, service))...)
+	}
+	response, err := conn.call(reflectionPath(reflectionService), body)
+	if err != nil {
+		return nil, err
+	}
+	_, messages, err := splitGRPCFrames(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	methods := make(map[string][]*Method)
+	for _, message := range messages {
+		parsed, err := parseReflectionResponse(message)
+		if err != nil {
+			return methods, err
+		}
+		for _, descriptor := range parsed.fileDescriptors {
+			if err := parseFileDescriptor(descriptor, methods); err != nil {
+				return methods, err
+			}
+		}
+	}
+	return methods, nil
+}
+
+// probeReflection connects to the target and calls the reflection
+// service, filling in result.
+func (scanner *Scanner) probeReflection(target *zgrab2.ScanTarget, result *ScanResults) (zgrab2.ScanStatus, error) {
+	conn, err := scanner.open(target, result, http2.NextProtoTLS)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), err
+	}
+	defer conn.Close()
+	scheme := "http"
+	result.Protocol = "h2c"
+	if scanner.config.UseTLS {
+		if result.ALPN != http2.NextProtoTLS {
+			return zgrab2.SCAN_PROTOCOL_ERROR, fmt.Errorf("ALPN negotiated %q instead of h2", result.ALPN)
+		}
+		scheme = "https"
+		result.Protocol = http2.NextProtoTLS
+	}
+	h2, err := newH2Conn(conn, scheme, scanner.authority(target), scanner.config.UserAgent, scanner.config.MaxSize*1024)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), err
+	}
+
+	services, reflectionService, err := scanner.listServices(h2, result)
+	if err != nil {
+		status := zgrab2.TryGetScanStatus(err)
+		if status == zgrab2.SCAN_UNKNOWN_ERROR {
+			status = zgrab2.SCAN_PROTOCOL_ERROR
+		}
+		return status, err
+	}
+	if reflectionService == "" {
+		return zgrab2.SCAN_SUCCESS, nil
+	}
+	result.ReflectionEnabled = true
+	result.ReflectionService = reflectionService
+	for _, name := range services {
+		result.Services = append(result.Services, &Service{Name: name})
+	}
+	if len(services) > scanner.config.MaxServices {
+		services = services[:scanner.config.MaxServices]
+	}
+	if len(services) > 0 {
+		methods, err := scanner.describeServices(h2, reflectionService, services)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		for _, service := range result.Services {
+			service.Methods = methods[service.Name]
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, nil
+}
+
+// Scan performs the grpc scan.
+//  1. Open a TCP connection to the target port (default 50051), and if
+//     --tls is set, perform a TLS handshake with ALPN h2.
+//  2. Call list_services on the v1alpha, then the v1 reflection service.
+//  3. If services were listed, request their file descriptors in one call
+//     and record their methods.
+//  4. If --grpc-web is set, send the list_services call as gRPC-Web on a
+//     new connection; a gRPC-Web endpoint makes the scan successful even
+//     if HTTP/2 failed.
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	result := new(ScanResults)
+	status, err := scanner.probeReflection(&target, result)
+	if scanner.config.GRPCWeb {
+		result.GRPCWeb = scanner.probeGRPCWeb(&target)
+		if status != zgrab2.SCAN_SUCCESS && result.GRPCWeb.Detected {
+			return zgrab2.SCAN_SUCCESS, result, nil
+		}
+	}
+	if status != zgrab2.SCAN_SUCCESS && result.Protocol == "" && result.TLSLog == nil && result.GRPCWeb == nil {
+		// Nothing was received.
+		return status, nil, err
+	}
+	return status, result, err
+}
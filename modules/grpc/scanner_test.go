@@ -0,0 +1,126 @@
+package grpc
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// reflectionHandler implements the v1 reflection service only, over gRPC
+// and gRPC-Web.
+func reflectionHandler(w http.ResponseWriter, r *http.Request) {
+	web := strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc-web")
+	if !web && r.URL.Path != reflectionPath("grpc.reflection.v1.ServerReflection") {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "12")
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	_, requests, _ := splitGRPCFrames(body)
+	if web {
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+	} else {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+	}
+	for _, request := range requests {
+		forEachField(request, func(field int, wireType int, value uint64, data []byte) error {
+			switch {
+			case field == requestListServices:
+				w.Write(grpcFrame(listServicesResponse("helloworld.Greeter", "grpc.reflection.v1.ServerReflection")))
+			case field == requestFileContainingSymbol && string(data) == "helloworld.Greeter":
+				w.Write(grpcFrame(fileDescriptorResponse(greeterDescriptor())))
+			case field == requestFileContainingSymbol:
+				errorResponse := appendVarint(nil, 1<<3|wireVarint)
+				errorResponse = appendVarint(errorResponse, 5)
+				w.Write(grpcFrame(appendBytesField(nil, responseError, errorResponse)))
+			}
+			return nil
+		})
+	}
+	if web {
+		w.Write(append([]byte{0x80, 0, 0, 0, 15}, "grpc-status:0\r\n"...))
+	} else {
+		w.Header().Set("Grpc-Status", "0")
+	}
+}
+
+func getTestScanner(t *testing.T, server *httptest.Server) (*Scanner, zgrab2.ScanTarget) {
+	host, portString, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portString)
+	var module Module
+	flags := module.NewFlags().(*Flags)
+	flags.UserAgent = "grpc-go/1.25.0 zgrab/0.x"
+	flags.MaxServices = 100
+	flags.MaxSize = 1024
+	flags.Timeout = 5 * time.Second
+	flags.Port = uint(port)
+	scanner := module.NewScanner().(*Scanner)
+	scanner.Init(flags)
+	return scanner, zgrab2.ScanTarget{IP: net.ParseIP(host)}
+}
+
+func TestScan(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(reflectionHandler), &http2.Server{}))
+	defer server.Close()
+	scanner, target := getTestScanner(t, server)
+	scanner.config.GRPCWeb = true
+
+	status, res, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("status %s: %v", status, err)
+	}
+	result := res.(*ScanResults)
+	if !result.IsGRPC || !result.ReflectionEnabled || result.ReflectionService != "grpc.reflection.v1.ServerReflection" {
+		t.Errorf("grpc %v, reflection %v on %q", result.IsGRPC, result.ReflectionEnabled, result.ReflectionService)
+	}
+	if result.Protocol != "h2c" || result.StatusName != "OK" || result.Error != "" {
+		t.Errorf("protocol %q, status %q, error %q", result.Protocol, result.StatusName, result.Error)
+	}
+	if len(result.Services) != 2 || result.Services[0].Name != "helloworld.Greeter" || len(result.Services[0].Methods) != 2 {
+		t.Fatalf("services %+v", result.Services)
+	}
+	if result.Services[1].Methods != nil {
+		t.Errorf("methods for a service without descriptor: %+v", result.Services[1].Methods)
+	}
+
+	web := result.GRPCWeb
+	if web == nil || !web.Detected || web.Status == nil || *web.Status != 0 {
+		t.Fatalf("grpc-web %+v", web)
+	}
+	if !reflect.DeepEqual(web.Services, []string{"helloworld.Greeter", "grpc.reflection.v1.ServerReflection"}) {
+		t.Errorf("grpc-web services %v", web.Services)
+	}
+}
+
+func TestScanReflectionDisabled(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "12")
+		w.Header().Set("Grpc-Message", "unknown service")
+	}), &http2.Server{}))
+	defer server.Close()
+	scanner, target := getTestScanner(t, server)
+
+	status, res, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("status %s: %v", status, err)
+	}
+	result := res.(*ScanResults)
+	if !result.IsGRPC || result.ReflectionEnabled || result.StatusName != "UNIMPLEMENTED" || result.StatusMessage != "unknown service" {
+		t.Errorf("got %+v", result)
+	}
+}
@@ -0,0 +1,106 @@
+package grpc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+)
+
+// grpcWebContentType is the request content type of gRPC-Web.
+const grpcWebContentType = "application/grpc-web+proto"
+
+// GRPCWebResult is the result of --grpc-web.
+type GRPCWebResult struct {
+	// Detected is true if the response has a gRPC-Web content type or a
+	// gRPC status.
+	Detected bool `json:"detected"`
+
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+
+	// Status is the grpc-status, from the headers or the trailer frame.
+	Status *int `json:"status,omitempty"`
+
+	// Services are the services listed by reflection over gRPC-Web.
+	Services []string `json:"services,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// parseGRPCWebTrailers parses the header block of a gRPC-Web trailer
+// frame.
+func parseGRPCWebTrailers(block []byte) map[string]string {
+	ret := make(map[string]string)
+	for _, line := range strings.Split(string(block), "\r\n") {
+		if i := strings.IndexByte(line, ':'); i > 0 {
+			ret[strings.ToLower(strings.TrimSpace(line[:i]))] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return ret
+}
+
+// probeGRPCWeb sends the list_services call of the v1alpha reflection
+// service as a gRPC-Web request over HTTP/1.1.
+func (scanner *Scanner) probeGRPCWeb(target *zgrab2.ScanTarget) *GRPCWebResult {
+	ret := new(GRPCWebResult)
+	conn, err := scanner.open(target, nil, "http/1.1")
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer conn.Close()
+	scheme := "http"
+	if scanner.config.UseTLS {
+		scheme = "https"
+	}
+	request, err := http.NewRequest("POST", scheme+"://"+scanner.authority(target)+reflectionPath(reflectionServices[0]),
+		bytes.NewReader(grpcFrame(listServicesRequest(scanner.config.Authority))))
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	request.Header.Set("Content-Type", grpcWebContentType)
+	request.Header.Set("Accept", grpcWebContentType)
+	request.Header.Set("X-Grpc-Web", "1")
+	request.Header.Set("User-Agent", scanner.config.UserAgent)
+	if err := request.Write(conn); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	response, err := http.ReadResponse(bufio.NewReader(conn), request)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer response.Body.Close()
+	ret.StatusCode = response.StatusCode
+	ret.ContentType = response.Header.Get("Content-Type")
+	headers := map[string]string{"grpc-status": response.Header.Get("Grpc-Status")}
+	if headers["grpc-status"] == "" {
+		delete(headers, "grpc-status")
+	}
+	if strings.HasPrefix(ret.ContentType, "application/grpc-web") {
+		body, err := ioutil.ReadAll(io.LimitReader(response.Body, int64(scanner.config.MaxSize)*1024))
+		if err != nil {
+			ret.Error = err.Error()
+		}
+		flags, messages, _ := splitGRPCFrames(body)
+		for i, message := range messages {
+			if flags[i]&0x80 != 0 {
+				for key, value := range parseGRPCWebTrailers(message) {
+					headers[key] = value
+				}
+			} else if parsed, err := parseReflectionResponse(message); err == nil {
+				ret.Services = append(ret.Services, parsed.services...)
+			}
+		}
+	}
+	ret.Status = grpcStatus(headers)
+	ret.Detected = strings.HasPrefix(ret.ContentType, "application/grpc") || ret.Status != nil
+	return ret
+}
@@ -0,0 +1,382 @@
+package http
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+	"github.com/Positive-Engineer/zgrab2/lib/smb/ntlmssp"
+	"github.com/Positive-Engineer/zgrab2/lib/smb/smb/encoder"
+)
+
+// AuthChallenge is a challenge from a WWW-Authenticate header.
+type AuthChallenge struct {
+	// Scheme is the authentication scheme as sent, e.g. Basic or NTLM.
+	Scheme string `json:"scheme"`
+
+	Realm string `json:"realm,omitempty"`
+
+	// Params are the other auth-params, with lowercase names.
+	Params map[string]string `json:"params,omitempty"`
+
+	// Token is the token68 form of the challenge, e.g. an NTLM challenge
+	// message in base64.
+	Token string `json:"token,omitempty"`
+
+	// NTLM is the information in the NTLM challenge message, for the NTLM
+	// and Negotiate schemes.
+	NTLM *NTLMInfo `json:"ntlm,omitempty"`
+}
+
+// NTLMInfo is the server information in an NTLM challenge message.
+type NTLMInfo struct {
+	TargetName          string     `json:"target_name,omitempty"`
+	NetBIOSComputerName string     `json:"netbios_computer_name,omitempty"`
+	NetBIOSDomainName   string     `json:"netbios_domain_name,omitempty"`
+	DNSComputerName     string     `json:"dns_computer_name,omitempty"`
+	DNSDomainName       string     `json:"dns_domain_name,omitempty"`
+	DNSTreeName         string     `json:"dns_tree_name,omitempty"`
+	OSVersion           string     `json:"os_version,omitempty"`
+	Timestamp           *time.Time `json:"timestamp,omitempty"`
+	NegotiateFlags      uint32     `json:"negotiate_flags"`
+}
+
+// AuthResults holds the WWW-Authenticate challenges of the response and,
+// with --auth-user, the result of answering one of them.
+type AuthResults struct {
+	Challenges []*AuthChallenge `json:"challenges,omitempty"`
+
+	// Type is the scheme used to answer the challenge.
+	Type string `json:"type,omitempty"`
+
+	// Response is the response to the authenticated request.
+	Response *http.Response `json:"response,omitempty"`
+
+	// Authenticated is true if the authenticated request was not answered
+	// with another 401.
+	Authenticated bool `json:"authenticated,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// authTypes are the valid values of --auth-type.
+var authTypes = []string{"auto", "basic", "digest", "ntlm", "negotiate"}
+
+const authToken = "[!#$%&'*+.^_`|~0-9A-Za-z-]+"
+
+var (
+	authSchemeRegex = regexp.MustCompile(`^[\s,]*(` + authToken + `)`)
+	authToken68     = regexp.MustCompile(`^\s+([A-Za-z0-9\-._~+/]+=*)\s*(?:,|$)`)
+	authParamRegex  = regexp.MustCompile(`^[\s,]*(` + authToken + `)\s*=\s*("(?:[^"\\]|\\.)*"|[^,\s]*)\s*`)
+	authEscapeRegex = regexp.MustCompile(`\\(.)`)
+)
+
+// parseChallenges parses WWW-Authenticate header values, each of which may
+// hold several comma-separated challenges.
+func parseChallenges(headers []string) []*AuthChallenge {
+	var ret []*AuthChallenge
+	for _, header := range headers {
+		for rest := header; ; {
+			scheme := authSchemeRegex.FindStringSubmatch(rest)
+			if scheme == nil {
+				break
+			}
+			rest = rest[len(scheme[0]):]
+			challenge := &AuthChallenge{Scheme: scheme[1]}
+			ret = append(ret, challenge)
+			if token := authToken68.FindStringSubmatch(rest); token != nil {
+				challenge.Token = token[1]
+				rest = rest[len(token[0]):]
+				continue
+			}
+			for {
+				param := authParamRegex.FindStringSubmatch(rest)
+				if param == nil {
+					break
+				}
+				rest = rest[len(param[0]):]
+				name, value := strings.ToLower(param[1]), param[2]
+				if strings.HasPrefix(value, `"`) {
+					value = authEscapeRegex.ReplaceAllString(value[1:len(value)-1], "$1")
+				}
+				if name == "realm" {
+					challenge.Realm = value
+					continue
+				}
+				if challenge.Params == nil {
+					challenge.Params = make(map[string]string)
+				}
+				challenge.Params[name] = value
+			}
+		}
+	}
+	return ret
+}
+
+// findChallenge returns the challenge with the first of the given schemes
+// that is offered.
+func findChallenge(challenges []*AuthChallenge, schemes ...string) *AuthChallenge {
+	for _, scheme := range schemes {
+		for _, challenge := range challenges {
+			if strings.EqualFold(challenge.Scheme, scheme) {
+				return challenge
+			}
+		}
+	}
+	return nil
+}
+
+// parseNTLMChallenge decodes an NTLM challenge (type 2) message.
+func parseNTLMChallenge(token string) (challenge *ntlmssp.Challenge, info *NTLMInfo, err error) {
+	data, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) < 12 || string(data[:8]) != ntlmssp.Signature || binary.LittleEndian.Uint32(data[8:12]) != ntlmssp.TypeNtLmChallenge {
+		return nil, nil, errors.New("not an NTLM challenge message")
+	}
+	// The encoder does not check the offsets and lengths it is given.
+	defer func() {
+		if r := recover(); r != nil {
+			challenge, info, err = nil, nil, fmt.Errorf("invalid NTLM challenge message: %v", r)
+		}
+	}()
+	c := ntlmssp.NewChallenge()
+	if err := encoder.Unmarshal(data, &c); err != nil {
+		return nil, nil, err
+	}
+	info = &NTLMInfo{NegotiateFlags: c.NegotiateFlags}
+	info.TargetName, _ = encoder.FromUnicode(c.TargetName)
+	if c.NegotiateFlags&ntlmssp.FlgNegVersion != 0 && c.Version != 0 {
+		info.OSVersion = fmt.Sprintf("%d.%d.%d", c.Version&0xff, (c.Version>>8)&0xff, (c.Version>>16)&0xffff)
+	}
+	for _, pair := range *c.TargetInfo {
+		value, _ := encoder.FromUnicode(pair.Value)
+		switch pair.AvID {
+		case ntlmssp.MsvAvNbComputerName:
+			info.NetBIOSComputerName = value
+		case ntlmssp.MsvAvNbDomainName:
+			info.NetBIOSDomainName = value
+		case ntlmssp.MsvAvDnsComputerName:
+			info.DNSComputerName = value
+		case ntlmssp.MsvAvDnsDomainName:
+			info.DNSDomainName = value
+		case ntlmssp.MsvAvDnsTreeName:
+			info.DNSTreeName = value
+		case ntlmssp.MsvAvTimestamp:
+			if len(pair.Value) == 8 {
+				// 100ns intervals since 1601-01-01.
+				ft := int64(binary.LittleEndian.Uint64(pair.Value))
+				t := time.Unix((ft-116444736000000000)/10000000, 0).UTC()
+				info.Timestamp = &t
+			}
+		}
+	}
+	return &c, info, nil
+}
+
+// digestAuthorization returns the Authorization header answering a Digest
+// challenge (RFC 7616, with qop=auth if offered).
+func digestAuthorization(challenge *AuthChallenge, user, pass, method, uri, cnonce string) (string, error) {
+	algorithm := challenge.Params["algorithm"]
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %s", algorithm)
+	}
+	h := func(s string) string {
+		hash := newHash()
+		hash.Write([]byte(s))
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+	nonce := challenge.Params["nonce"]
+	ha1 := h(user + ":" + challenge.Realm + ":" + pass)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	qop := ""
+	for _, offered := range strings.Split(challenge.Params["qop"], ",") {
+		if strings.TrimSpace(offered) == "auth" {
+			qop = "auth"
+		}
+	}
+	fields := []string{
+		fmt.Sprintf("username=%q", user),
+		fmt.Sprintf("realm=%q", challenge.Realm),
+		fmt.Sprintf("nonce=%q", nonce),
+		fmt.Sprintf("uri=%q", uri),
+	}
+	if algorithm != "" {
+		fields = append(fields, "algorithm="+algorithm)
+	}
+	if qop != "" {
+		fields = append(fields, "qop="+qop, "nc=00000001", fmt.Sprintf("cnonce=%q", cnonce),
+			fmt.Sprintf("response=%q", h(ha1+":"+nonce+":00000001:"+cnonce+":"+qop+":"+ha2)))
+	} else {
+		fields = append(fields, fmt.Sprintf("response=%q", h(ha1+":"+nonce+":"+ha2)))
+	}
+	if opaque, ok := challenge.Params["opaque"]; ok {
+		fields = append(fields, fmt.Sprintf("opaque=%q", opaque))
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+// probeAuth records the challenges of the response to the main request,
+// retrieves the NTLM challenge message if NTLM is offered, and answers a
+// challenge if --auth-user is set. It returns nil if there is no challenge.
+func (scan *scan) probeAuth(useHTTPS bool) *AuthResults {
+	response := scan.results.Response
+	if response == nil {
+		return nil
+	}
+	challenges := parseChallenges(response.Header["Www-Authenticate"])
+	if len(challenges) == 0 {
+		return nil
+	}
+	ret := &AuthResults{Challenges: challenges}
+	if response.StatusCode != 401 {
+		return ret
+	}
+	config := scan.scanner.config
+	var challenge *AuthChallenge
+	switch strings.ToLower(config.AuthType) {
+	case "", "auto":
+		challenge = findChallenge(challenges, "ntlm", "negotiate", "digest", "basic")
+	default:
+		challenge = findChallenge(challenges, config.AuthType)
+	}
+	ntlm := findChallenge(challenges, "ntlm", "negotiate")
+	if config.AuthUser == "" || challenge == nil || challenge != ntlm {
+		// The server information is only sent in the NTLM handshake.
+		if ntlm != nil {
+			if err := scan.authNTLM(useHTTPS, ntlm, nil); err != nil {
+				ret.Error = err.Error()
+			}
+		}
+	}
+	if config.AuthUser == "" {
+		return ret
+	}
+	if challenge == nil {
+		ret.Error = fmt.Sprintf("no %s challenge to answer", config.AuthType)
+		return ret
+	}
+	ret.Type = strings.ToLower(challenge.Scheme)
+	var err error
+	switch ret.Type {
+	case "ntlm", "negotiate":
+		err = scan.authNTLM(useHTTPS, challenge, ret)
+	case "digest":
+		err = scan.authDigest(useHTTPS, challenge, ret)
+	case "basic":
+		credentials := base64.StdEncoding.EncodeToString([]byte(config.AuthUser + ":" + config.AuthPass))
+		fetch := scan.newFollowUpScan(useHTTPS)
+		defer fetch.Cleanup()
+		ret.Response, err = fetch.sendAuthorization("Basic " + credentials)
+	default:
+		err = fmt.Errorf("unsupported authentication scheme %s", challenge.Scheme)
+	}
+	if err != nil {
+		ret.Error = err.Error()
+	}
+	ret.Authenticated = ret.Response != nil && ret.Response.StatusCode != 401
+	return ret
+}
+
+// authDigest answers a Digest challenge.
+func (scan *scan) authDigest(useHTTPS bool, challenge *AuthChallenge, ret *AuthResults) error {
+	fetch := scan.newFollowUpScan(useHTTPS)
+	defer fetch.Cleanup()
+	u, err := url.Parse(fetch.url)
+	if err != nil {
+		return err
+	}
+	cnonce := make([]byte, 8)
+	rand.Read(cnonce)
+	config := scan.scanner.config
+	authorization, err := digestAuthorization(challenge, config.AuthUser, config.AuthPass, config.Method, u.RequestURI(), hex.EncodeToString(cnonce))
+	if err != nil {
+		return err
+	}
+	ret.Response, err = fetch.sendAuthorization(authorization)
+	return err
+}
+
+// authNTLM runs the NTLM handshake on one connection, recording the server
+// information in challenge. If ret is not nil, it answers the challenge
+// message with the credentials and records the response in ret.
+func (scan *scan) authNTLM(useHTTPS bool, challenge *AuthChallenge, ret *AuthResults) error {
+	fetch := scan.newFollowUpScan(useHTTPS)
+	defer fetch.Cleanup()
+	negotiate, err := encoder.Marshal(ntlmssp.NewNegotiate("", ""))
+	if err != nil {
+		return err
+	}
+	resp, err := fetch.sendAuthorization(challenge.Scheme + " " + base64.StdEncoding.EncodeToString(negotiate))
+	if err != nil {
+		return err
+	}
+	reply := findChallenge(parseChallenges(resp.Header["Www-Authenticate"]), challenge.Scheme)
+	if resp.StatusCode != 401 || reply == nil || reply.Token == "" {
+		return fmt.Errorf("no NTLM challenge message in response (status %d)", resp.StatusCode)
+	}
+	message, info, err := parseNTLMChallenge(reply.Token)
+	if err != nil {
+		return err
+	}
+	challenge.NTLM = info
+	if ret == nil {
+		return nil
+	}
+	config := scan.scanner.config
+	domain, user := "", config.AuthUser
+	if i := strings.IndexAny(user, `\/`); i >= 0 {
+		domain, user = user[:i], user[i+1:]
+	}
+	authenticate, err := encoder.Marshal(ntlmssp.NewAuthenticatePass(domain, user, "", config.AuthPass, *message))
+	if err != nil {
+		return err
+	}
+	ret.Response, err = fetch.sendAuthorization(challenge.Scheme + " " + base64.StdEncoding.EncodeToString(authenticate))
+	return err
+}
+
+// sendAuthorization repeats the main request with the given Authorization
+// header and reads the response, so that the connection can be reused.
+func (scan *scan) sendAuthorization(authorization string) (*http.Response, error) {
+	request, err := scan.newRequest()
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", authorization)
+	resp, err := scan.client.Do(request)
+	if resp != nil && resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		if urlError, ok := err.(*url.Error); ok {
+			err = urlError.Err
+		}
+		if resp == nil || !isRedirectStop(err) {
+			return nil, err
+		}
+	}
+	scan.readBody(resp)
+	return resp, nil
+}
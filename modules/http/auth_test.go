@@ -0,0 +1,137 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/smb/ntlmssp"
+	"github.com/Positive-Engineer/zgrab2/lib/smb/smb/encoder"
+)
+
+func TestParseChallenges(t *testing.T) {
+	challenges := parseChallenges([]string{
+		`Digest realm="a \"b\"", qop="auth,auth-int", nonce="abc", algorithm=MD5, Basic realm=x`,
+		`NTLM`,
+		`Negotiate TlRMTVNTUAACAAAA==`,
+	})
+	expected := []*AuthChallenge{
+		{Scheme: "Digest", Realm: `a "b"`, Params: map[string]string{"qop": "auth,auth-int", "nonce": "abc", "algorithm": "MD5"}},
+		{Scheme: "Basic", Realm: "x"},
+		{Scheme: "NTLM"},
+		{Scheme: "Negotiate", Token: "TlRMTVNTUAACAAAA=="},
+	}
+	if !reflect.DeepEqual(challenges, expected) {
+		for _, c := range challenges {
+			t.Logf("%+v", c)
+		}
+		t.Error("unexpected challenges")
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	// The example of RFC 7616 section 3.9.1.
+	challenge := parseChallenges([]string{`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`})[0]
+	authorization, err := digestAuthorization(challenge, "Mufasa", "Circle of Life", "GET", "/dir/index.html", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(authorization, `response="8ca523f5e9506fed4657c9700eebdbec"`) {
+		t.Errorf("unexpected authorization %s", authorization)
+	}
+}
+
+func testNTLMChallenge() string {
+	challenge := ntlmssp.NewChallenge()
+	challenge.TargetName = encoder.ToUnicode("CORP")
+	challenge.ServerChallenge = 0x0123456789abcdef
+	challenge.Version = 10 | 0<<8 | 17763<<16 | 15<<56
+	timestamp := make([]byte, 8)
+	binary.LittleEndian.PutUint64(timestamp, 132223104000000000) // 2020-01-01
+	challenge.TargetInfo = &ntlmssp.AvPairSlice{
+		{AvID: ntlmssp.MsvAvNbDomainName, AvLen: 8, Value: encoder.ToUnicode("CORP")},
+		{AvID: ntlmssp.MsvAvNbComputerName, AvLen: 6, Value: encoder.ToUnicode("WEB")},
+		{AvID: ntlmssp.MsvAvDnsDomainName, AvLen: 18, Value: encoder.ToUnicode("corp.test")},
+		{AvID: ntlmssp.MsvAvDnsComputerName, AvLen: 26, Value: encoder.ToUnicode("web.corp.test")},
+		{AvID: ntlmssp.MsvAvTimestamp, AvLen: 8, Value: timestamp},
+		{AvID: ntlmssp.MsvAvEOL},
+	}
+	data, err := encoder.Marshal(challenge)
+	if err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func ntlmMessageType(authorization string) uint32 {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "NTLM "))
+	if err != nil || len(data) < 12 || string(data[:8]) != ntlmssp.Signature {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(data[8:12])
+}
+
+func TestProbeAuth(t *testing.T) {
+	ntlmChallenge := testNTLMChallenge()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		switch {
+		case r.URL.Path == "/basic":
+			if user, pass, ok := r.BasicAuth(); ok && user == "admin" && pass == "secret" {
+				w.Write([]byte("ok"))
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="Router"`)
+		case ntlmMessageType(authorization) == ntlmssp.TypeNtLmNegotiate:
+			w.Header().Set("WWW-Authenticate", "NTLM "+ntlmChallenge)
+		case ntlmMessageType(authorization) == ntlmssp.TypeNtLmAuthenticate:
+			w.Write([]byte("ok"))
+			return
+		default:
+			w.Header().Add("WWW-Authenticate", "Negotiate")
+			w.Header().Add("WWW-Authenticate", "NTLM")
+			w.Header().Add("WWW-Authenticate", `Basic realm="Intranet"`)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	auth := result.(*Results).Auth
+	if auth == nil || len(auth.Challenges) != 3 || auth.Type != "" || auth.Error != "" {
+		t.Fatalf("unexpected auth results %+v", auth)
+	}
+	info := auth.Challenges[1].NTLM
+	if info == nil || info.TargetName != "CORP" || info.NetBIOSComputerName != "WEB" || info.DNSDomainName != "corp.test" ||
+		info.DNSComputerName != "web.corp.test" || info.OSVersion != "10.0.17763" || info.Timestamp == nil || info.Timestamp.Year() != 2020 {
+		t.Errorf("unexpected NTLM info %+v", info)
+	}
+
+	scanner.config.AuthUser = `CORP\admin`
+	scanner.config.AuthPass = "secret"
+	scanner.config.AuthType = "ntlm"
+	_, result, _ = scanner.Scan(target)
+	auth = result.(*Results).Auth
+	if auth.Type != "ntlm" || !auth.Authenticated || auth.Challenges[1].NTLM == nil {
+		t.Errorf("unexpected NTLM auth results %+v", auth)
+	}
+
+	scanner.config.Endpoint = "/basic"
+	scanner.config.AuthUser = "admin"
+	scanner.config.AuthType = "auto"
+	_, result, _ = scanner.Scan(target)
+	auth = result.(*Results).Auth
+	if auth.Type != "basic" || !auth.Authenticated || auth.Response.BodyText != "ok" || auth.Challenges[0].Realm != "Router" {
+		t.Errorf("unexpected basic auth results %+v", auth)
+	}
+}
@@ -0,0 +1,32 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestRequestBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + r.Header.Get("Content-Type") + " " + string(body)))
+	}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	scanner.config.Method = "POST"
+	scanner.config.ContentType = "application/json"
+	scanner.body = []byte(`{"jsonrpc":"2.0","method":"system.listMethods","id":1}`)
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	expected := `POST application/json {"jsonrpc":"2.0","method":"system.listMethods","id":1}`
+	if body := result.(*Results).Response.BodyText; body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+}
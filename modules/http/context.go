@@ -0,0 +1,38 @@
+package http
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+)
+
+var realmRegex = regexp.MustCompile(`(?i)realm="([^"]*)"`)
+
+// contextHostname returns the first non-wildcard hostname in the target
+// context, or the empty string.
+func contextHostname(ctx *zgrab2.TargetContext) string {
+	for _, name := range ctx.Get(zgrab2.ContextHostnames) {
+		if !strings.HasPrefix(name, "*.") {
+			return name
+		}
+	}
+	return ""
+}
+
+// recordContext adds the Server header and the WWW-Authenticate realms of
+// the response to the target context.
+func recordContext(ctx *zgrab2.TargetContext, response *http.Response) {
+	if response == nil {
+		return
+	}
+	if server := response.Header.Get("Server"); server != "" {
+		ctx.Set(zgrab2.ContextHTTPServer, server)
+	}
+	for _, challenge := range response.Header["Www-Authenticate"] {
+		for _, match := range realmRegex.FindAllStringSubmatch(challenge, -1) {
+			ctx.Add(zgrab2.ContextRealms, match[1])
+		}
+	}
+}
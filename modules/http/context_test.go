@@ -0,0 +1,40 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestContextHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "test-server")
+		w.Header().Set("WWW-Authenticate", `Basic realm="Router Admin"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("host=" + r.Host))
+	}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	scanner.config.ContextHost = true
+	target.Context = zgrab2.NewTargetContext()
+	target.Context.Add(zgrab2.ContextHostnames, "*.example.com", "www.example.com")
+
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	body := result.(*Results).Response.BodyText
+	if expected := "host=www.example.com:" + server.URL[len("http://127.0.0.1:"):]; body != expected {
+		t.Errorf("got body %q, expected %q", body, expected)
+	}
+	if server := target.Context.First(zgrab2.ContextHTTPServer); server != "test-server" {
+		t.Errorf("got server %q", server)
+	}
+	if realm := target.Context.First(zgrab2.ContextRealms); realm != "Router Admin" {
+		t.Errorf("got realm %q", realm)
+	}
+}
@@ -0,0 +1,156 @@
+package http
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+	"github.com/Positive-Engineer/zgrab2/lib/http/cookiejar"
+)
+
+// JarCookie is a cookie in the jar at the end of the scan, with --cookie-jar.
+type JarCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+
+	// Domain and Path are the scope of the cookie; HostOnly is true if
+	// the cookie had no Domain attribute and is only sent to Domain itself.
+	Domain   string `json:"domain"`
+	Path     string `json:"path"`
+	HostOnly bool   `json:"host_only,omitempty"`
+
+	Expires  string `json:"expires,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	HttpOnly bool   `json:"http_only,omitempty"`
+
+	// SetBy is the URL of the response that set the cookie.
+	SetBy string `json:"set_by"`
+}
+
+// EndpointResult is the result of the request for one of --extra-endpoints.
+type EndpointResult struct {
+	Endpoint string `json:"endpoint"`
+	Error    string `json:"error,omitempty"`
+
+	// Results holds the response, redirects and body info of the request.
+	Results
+}
+
+// recordingJar is a cookie jar that also keeps the cookies it was given,
+// since cookiejar.Jar can only be queried by URL.
+type recordingJar struct {
+	http.CookieJar
+
+	mutex   sync.Mutex
+	keys    []string
+	cookies map[string]*JarCookie
+}
+
+func newRecordingJar() *recordingJar {
+	jar, _ := cookiejar.New(nil)
+	return &recordingJar{CookieJar: jar, cookies: make(map[string]*JarCookie)}
+}
+
+// defaultCookiePath returns the default path of a cookie set by a response
+// for u (RFC 6265, section 5.1.4).
+func defaultCookiePath(u *url.URL) string {
+	path := u.Path
+	if !strings.HasPrefix(path, "/") || strings.Count(path, "/") == 1 {
+		return "/"
+	}
+	return path[:strings.LastIndex(path, "/")]
+}
+
+// SetCookies stores the cookies in the jar and records them, dropping the
+// ones they delete.
+func (jar *recordingJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	jar.CookieJar.SetCookies(u, cookies)
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	now := time.Now()
+	for _, cookie := range cookies {
+		record := &JarCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   strings.ToLower(strings.TrimPrefix(cookie.Domain, ".")),
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			SetBy:    u.String(),
+		}
+		if record.Domain == "" {
+			record.Domain, record.HostOnly = strings.ToLower(u.Hostname()), true
+		}
+		if !strings.HasPrefix(record.Path, "/") {
+			record.Path = defaultCookiePath(u)
+		}
+		if !cookie.Expires.IsZero() {
+			record.Expires = cookie.Expires.UTC().Format(time.RFC3339)
+		}
+		key := record.Domain + ";" + record.Path + ";" + record.Name
+		if cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(now)) {
+			delete(jar.cookies, key)
+			continue
+		}
+		if _, ok := jar.cookies[key]; !ok {
+			jar.keys = append(jar.keys, key)
+		}
+		jar.cookies[key] = record
+	}
+}
+
+// list returns the cookies in the jar, in the order they were first set.
+func (jar *recordingJar) list() []*JarCookie {
+	jar.mutex.Lock()
+	defer jar.mutex.Unlock()
+	var ret []*JarCookie
+	for _, key := range jar.keys {
+		if cookie, ok := jar.cookies[key]; ok {
+			ret = append(ret, cookie)
+		}
+	}
+	return ret
+}
+
+// newFollowUpScan returns a new scan of the target for a follow-up
+// request, sharing the cookie jar of scan if there is one.
+func (scan *scan) newFollowUpScan(useHTTPS bool) *scan {
+	ret := scan.scanner.newHTTPScan(scan.target, useHTTPS)
+	if scan.jar != nil {
+		ret.jar = scan.jar
+		ret.client.Jar = scan.jar
+	}
+	return ret
+}
+
+// fetchEndpoints requests each of --extra-endpoints on the target, in
+// order, after the main request.
+func (scan *scan) fetchEndpoints(useHTTPS bool, endpoints []string) []*EndpointResult {
+	var ret []*EndpointResult
+	for _, endpoint := range endpoints {
+		result := &EndpointResult{Endpoint: endpoint}
+		ret = append(ret, result)
+		fetch := scan.newFollowUpScan(useHTTPS)
+		base, err := url.Parse(fetch.url)
+		if err == nil {
+			var ref *url.URL
+			if ref, err = url.Parse(endpoint); err == nil {
+				fetch.url = base.ResolveReference(ref).String()
+				if grabErr := fetch.Grab(); grabErr != nil {
+					err = grabErr.Err
+				}
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		fetch.Cleanup()
+		if scan.scanner.config.OnlyBASE64 && fetch.results.Response != nil {
+			fetch.results.Response.BodyText = ""
+		}
+		result.Results = fetch.results
+	}
+	return ret
+}
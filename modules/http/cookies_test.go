@@ -0,0 +1,84 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestDefaultCookiePath(t *testing.T) {
+	for path, expected := range map[string]string{"": "/", "/": "/", "/login": "/", "/app/login": "/app", "/app/": "/app"} {
+		if got := defaultCookiePath(&url.URL{Path: path}); got != expected {
+			t.Errorf("%q: got %q, expected %q", path, got, expected)
+		}
+	}
+}
+
+// cookieHandler sets an affinity cookie and redirects to a consent page,
+// which sets a consent cookie if the affinity cookie is sent; /check needs
+// both.
+func cookieHandler(w http.ResponseWriter, r *http.Request) {
+	has := func(name string) bool {
+		_, err := r.Cookie(name)
+		return err == nil
+	}
+	switch r.URL.Path {
+	case "/":
+		http.SetCookie(w, &http.Cookie{Name: "affinity", Value: "node1", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "tracking", Value: "x", Path: "/"})
+		http.Redirect(w, r, "/consent", http.StatusFound)
+	case "/consent":
+		if !has("affinity") {
+			http.Error(w, "no affinity", http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "consent", Value: "yes", Path: "/", HttpOnly: true})
+		http.SetCookie(w, &http.Cookie{Name: "tracking", Path: "/", MaxAge: -1})
+		w.Write([]byte("ok"))
+	case "/check":
+		if !has("affinity") || !has("consent") {
+			http.Error(w, "missing cookies", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("welcome"))
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(cookieHandler))
+	defer server.Close()
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	scanner.config.MaxRedirects = 1
+	scanner.config.FollowLocalhostRedirects = true
+	scanner.config.CookieJar = true
+	scanner.endpoints = []string{"/check"}
+
+	status, res, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("status %s: %v", status, err)
+	}
+	results := res.(*Results)
+	if results.Response.StatusCode != http.StatusOK {
+		t.Errorf("redirect without the affinity cookie: %d", results.Response.StatusCode)
+	}
+	if len(results.Endpoints) != 1 || results.Endpoints[0].Response == nil || results.Endpoints[0].Response.StatusCode != http.StatusOK {
+		t.Fatalf("endpoints %+v", results.Endpoints)
+	}
+	jar := results.CookieJar
+	if len(jar) != 2 || jar[0].Name != "affinity" || jar[1].Name != "consent" || !jar[1].HttpOnly || !jar[1].HostOnly {
+		t.Fatalf("jar %+v", jar)
+	}
+	if u, _ := url.Parse(jar[1].SetBy); u.Path != "/consent" {
+		t.Errorf("consent cookie set by %s", jar[1].SetBy)
+	}
+
+	scanner.config.CookieJar = false
+	_, res, _ = scanner.Scan(target)
+	if results := res.(*Results); results.CookieJar != nil || results.Endpoints[0].Response.StatusCode != http.StatusForbidden {
+		t.Errorf("cookies kept without --cookie-jar")
+	}
+}
@@ -0,0 +1,211 @@
+package http
+
+import (
+	"bufio"
+	"encoding/xml"
+	"net/url"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+)
+
+// maxSitemaps bounds the number of sitemaps (including nested ones from a
+// sitemap index) fetched by --discover-paths.
+const maxSitemaps = 3
+
+// DiscoveredPath is a fetch made by --discover-paths.
+type DiscoveredPath struct {
+	URL string `json:"url"`
+
+	// Source is where the URL came from: robots.txt, sitemap, or default
+	// for /robots.txt and /sitemap.xml themselves.
+	Source string `json:"source"`
+
+	Response *http.Response `json:"response,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// DiscoveryResults holds the results of --discover-paths.
+type DiscoveryResults struct {
+	// Sources are the robots.txt and sitemap fetches.
+	Sources []*DiscoveredPath `json:"sources,omitempty"`
+
+	// Paths are the fetches of the paths they list, in order.
+	Paths []*DiscoveredPath `json:"paths,omitempty"`
+
+	// Skipped is the number of listed paths not fetched because of the
+	// limit.
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// robotsPaths returns the paths of the Allow and Disallow rules and the
+// Sitemap URLs in a robots.txt file. Wildcard rules are cut at the first
+// wildcard.
+func robotsPaths(body string) (paths []string, sitemaps []string) {
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[colon+1:])
+		switch strings.ToLower(strings.TrimSpace(line[:colon])) {
+		case "allow", "disallow":
+			if i := strings.IndexAny(value, "*$"); i >= 0 {
+				value = value[:i]
+			}
+			if strings.HasPrefix(value, "/") && value != "/" {
+				paths = append(paths, value)
+			}
+		case "sitemap":
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		}
+	}
+	return paths, sitemaps
+}
+
+// sitemapLocations returns the <loc> URLs of a sitemap, and whether it is a
+// sitemap index (listing other sitemaps).
+func sitemapLocations(body string) (locations []string, index bool) {
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	decoder.Strict = false
+	inLoc := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return locations, index
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "sitemapindex" {
+				index = true
+			}
+			inLoc = t.Name.Local == "loc"
+		case xml.CharData:
+			if inLoc {
+				if loc := strings.TrimSpace(string(t)); loc != "" {
+					locations = append(locations, loc)
+				}
+			}
+		case xml.EndElement:
+			inLoc = false
+		}
+	}
+}
+
+// discoverPaths fetches robots.txt and the sitemaps, then up to limit of the
+// paths they list on the target's host, each on the same new client.
+func (scan *scan) discoverPaths(useHTTPS bool, limit int) *DiscoveryResults {
+	fetch := scan.newFollowUpScan(useHTTPS)
+	defer fetch.Cleanup()
+	ret := new(DiscoveryResults)
+	base, err := url.Parse(fetch.url)
+	if err != nil {
+		ret.Sources = append(ret.Sources, &DiscoveredPath{Error: err.Error()})
+		return ret
+	}
+	// resolve returns the absolute URL of ref if it is on the target's host.
+	resolve := func(ref string) string {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return ""
+		}
+		u = base.ResolveReference(u)
+		if u.Host != base.Host || (u.Scheme != "http" && u.Scheme != "https") {
+			return ""
+		}
+		u.Fragment = ""
+		return u.String()
+	}
+
+	type listed struct {
+		ref, source string
+	}
+	var paths, sitemaps []listed
+	robots := fetch.fetchPath(resolve("/robots.txt"), "default")
+	ret.Sources = append(ret.Sources, robots)
+	if robots.Response != nil && robots.Response.StatusCode == 200 {
+		robotsPaths, robotsSitemaps := robotsPaths(robots.Response.BodyText)
+		for _, path := range robotsPaths {
+			paths = append(paths, listed{path, "robots.txt"})
+		}
+		for _, sitemap := range robotsSitemaps {
+			sitemaps = append(sitemaps, listed{sitemap, "robots.txt"})
+		}
+	}
+	if len(sitemaps) == 0 {
+		sitemaps = []listed{{"/sitemap.xml", "default"}}
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < len(sitemaps) && len(ret.Sources) <= maxSitemaps; i++ {
+		sitemapURL := resolve(sitemaps[i].ref)
+		if sitemapURL == "" || seen[sitemapURL] {
+			continue
+		}
+		seen[sitemapURL] = true
+		sitemap := fetch.fetchPath(sitemapURL, sitemaps[i].source)
+		ret.Sources = append(ret.Sources, sitemap)
+		if sitemap.Response == nil || sitemap.Response.StatusCode != 200 {
+			continue
+		}
+		locations, index := sitemapLocations(sitemap.Response.BodyText)
+		for _, location := range locations {
+			if index {
+				sitemaps = append(sitemaps, listed{location, "sitemap"})
+			} else {
+				paths = append(paths, listed{location, "sitemap"})
+			}
+		}
+	}
+
+	for _, path := range paths {
+		target := resolve(path.ref)
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+		if len(ret.Paths) >= limit {
+			ret.Skipped++
+			continue
+		}
+		ret.Paths = append(ret.Paths, fetch.fetchPath(target, path.source))
+	}
+	return ret
+}
+
+// fetchPath GETs target and reads the response.
+func (scan *scan) fetchPath(target string, source string) *DiscoveredPath {
+	ret := &DiscoveredPath{URL: target, Source: source}
+	if target == "" {
+		ret.Error = "not on the target's host"
+		return ret
+	}
+	request, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	request.Header.Set("Accept", "*/*")
+	resp, err := scan.client.Do(request)
+	if resp != nil && resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		if urlError, ok := err.(*url.Error); ok {
+			err = urlError.Err
+		}
+		if resp == nil || !isRedirectStop(err) {
+			ret.Error = err.Error()
+			return ret
+		}
+	}
+	ret.Response = resp
+	scan.readBody(resp)
+	return ret
+}
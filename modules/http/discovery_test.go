@@ -0,0 +1,89 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestRobotsPaths(t *testing.T) {
+	paths, sitemaps := robotsPaths(`User-agent: *
+Disallow: /admin/ # private
+Disallow: /
+Allow: /public/*.html$
+disallow:
+Disallow: *.php
+Sitemap: https://example.com/sitemap.xml
+`)
+	if !reflect.DeepEqual(paths, []string{"/admin/", "/public/"}) {
+		t.Errorf("paths: %v", paths)
+	}
+	if !reflect.DeepEqual(sitemaps, []string{"https://example.com/sitemap.xml"}) {
+		t.Errorf("sitemaps: %v", sitemaps)
+	}
+}
+
+func TestSitemapLocations(t *testing.T) {
+	locations, index := sitemapLocations(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc> https://example.com/a.xml </loc></sitemap>
+  <sitemap><loc>https://example.com/b.xml</loc><lastmod>2020-01-01</lastmod></sitemap>
+</sitemapindex>`)
+	if !index || !reflect.DeepEqual(locations, []string{"https://example.com/a.xml", "https://example.com/b.xml"}) {
+		t.Errorf("index %v: %v", index, locations)
+	}
+	locations, index = sitemapLocations(`<urlset><url><loc>/x</loc></url><url><loc>/y</loc></url>`)
+	if index || !reflect.DeepEqual(locations, []string{"/x", "/y"}) {
+		t.Errorf("index %v: %v", index, locations)
+	}
+}
+
+func TestDiscoverPaths(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private/\nDisallow: /tmp/\nSitemap: %s/index.xml\n", server.URL)
+		case "/index.xml":
+			fmt.Fprintf(w, "<sitemapindex><sitemap><loc>%s/pages.xml</loc></sitemap><sitemap><loc>http://elsewhere.example/x.xml</loc></sitemap></sitemapindex>", server.URL)
+		case "/pages.xml":
+			fmt.Fprintf(w, "<urlset><url><loc>%s/about</loc></url><url><loc>%s/private/</loc></url><url><loc>http://elsewhere.example/</loc></url></urlset>", server.URL, server.URL)
+		default:
+			w.Write([]byte("page " + r.URL.Path))
+		}
+	}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	scanner.config.DiscoverPaths = 2
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	discovery := result.(*Results).Discovery
+	if discovery == nil {
+		t.Fatal("no discovery results")
+	}
+	var sources []string
+	for _, source := range discovery.Sources {
+		sources = append(sources, source.URL)
+	}
+	expected := []string{server.URL + "/robots.txt", server.URL + "/index.xml", server.URL + "/pages.xml"}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("sources: %v", sources)
+	}
+	if len(discovery.Paths) != 2 || discovery.Skipped != 1 {
+		t.Fatalf("unexpected paths %+v, skipped %d", discovery.Paths, discovery.Skipped)
+	}
+	for i, path := range []string{"/private/", "/tmp/"} {
+		fetched := discovery.Paths[i]
+		if fetched.URL != server.URL+path || fetched.Source != "robots.txt" || fetched.Response == nil || fetched.Response.BodyText != "page "+path {
+			t.Errorf("path %d: %+v", i, fetched)
+		}
+	}
+}
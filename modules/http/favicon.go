@@ -0,0 +1,221 @@
+package http
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/url"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+	"golang.org/x/net/html"
+)
+
+// FaviconResult holds the result of --fetch-favicon.
+type FaviconResult struct {
+	// URL is the icon that was fetched: the first <link rel="icon"> of the
+	// page, or /favicon.ico.
+	URL string `json:"url"`
+
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size,omitempty"`
+
+	// MMH3 is the Shodan-compatible hash (http.favicon.hash): the signed
+	// 32-bit MurmurHash3 of the base64 encoding of the icon, with a newline
+	// after every 76 characters and at the end.
+	MMH3 *int32 `json:"mmh3,omitempty"`
+
+	// MD5 is the hex MD5 of the icon.
+	MD5 string `json:"md5,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// iconURL returns the href of the first <link> whose rel includes "icon" in
+// an HTML page.
+func iconURL(body string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			if string(name) == "body" {
+				return ""
+			}
+			if string(name) != "link" || !hasAttr {
+				continue
+			}
+			var rel, href string
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				switch string(key) {
+				case "rel":
+					rel = string(value)
+				case "href":
+					href = strings.TrimSpace(string(value))
+				}
+			}
+			for _, token := range strings.Fields(strings.ToLower(rel)) {
+				if token == "icon" && href != "" {
+					return href
+				}
+			}
+		}
+	}
+}
+
+// faviconHash returns the Shodan favicon hash of data.
+func faviconHash(data []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b bytes.Buffer
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteByte('\n')
+	return int32(murmur3(b.Bytes(), 0))
+}
+
+// murmur3 is MurmurHash3_x86_32.
+func murmur3(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	h := seed
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[4*i:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+	tail := data[4*n:]
+	var k uint32
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// decodeDataURL returns the content of a base64 data: URL.
+func decodeDataURL(u string) ([]byte, string, error) {
+	comma := strings.IndexByte(u, ',')
+	if comma < 0 {
+		return nil, "", errors.New("malformed data URL")
+	}
+	meta := u[len("data:"):comma]
+	if !strings.HasSuffix(meta, ";base64") {
+		unescaped, err := url.PathUnescape(u[comma+1:])
+		return []byte(unescaped), meta, err
+	}
+	data, err := base64.StdEncoding.DecodeString(u[comma+1:])
+	return data, strings.TrimSuffix(meta, ";base64"), err
+}
+
+// setHashes records the size and hashes of the icon.
+func (ret *FaviconResult) setHashes(data []byte) {
+	ret.Size = len(data)
+	hash := faviconHash(data)
+	ret.MMH3 = &hash
+	sum := md5.Sum(data)
+	ret.MD5 = hex.EncodeToString(sum[:])
+}
+
+// fetchFavicon downloads the icon of the page in the final response, on new
+// connections (following at most --max-redirects redirects).
+func (scan *scan) fetchFavicon(useHTTPS bool) *FaviconResult {
+	ret := new(FaviconResult)
+	base, err := url.Parse(scan.url)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	response := scan.results.Response
+	if response != nil && response.Request != nil && response.Request.URL != nil {
+		base = response.Request.URL
+	}
+	href := "/favicon.ico"
+	if response != nil {
+		if link := iconURL(response.BodyText); link != "" {
+			href = link
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(href), "data:") {
+		ret.URL = "data:"
+		data, contentType, err := decodeDataURL(href)
+		if err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		ret.ContentType = contentType
+		ret.setHashes(data)
+		return ret
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	ret.URL = base.ResolveReference(ref).String()
+
+	fetch := scan.newFollowUpScan(useHTTPS)
+	defer fetch.Cleanup()
+	request, err := http.NewRequest("GET", ret.URL, nil)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	request.Header.Set("Accept", "image/*,*/*")
+	resp, err := fetch.client.Do(request)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer resp.Body.Close()
+	ret.StatusCode = resp.StatusCode
+	ret.ContentType = resp.Header.Get("Content-Type")
+	if resp.StatusCode != 200 {
+		ret.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+		return ret
+	}
+	var data bytes.Buffer
+	if _, err := io.CopyN(&data, resp.Body, int64(scan.scanner.config.MaxSize)*1024); err != nil && err != io.EOF {
+		ret.Error = err.Error()
+		return ret
+	}
+	ret.setHashes(data.Bytes())
+	return ret
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestMurmur3(t *testing.T) {
+	for input, expected := range map[string]int32{
+		"":      0,
+		"hello": 613153351,
+		"foo":   -156908512,
+	} {
+		if got := int32(murmur3([]byte(input), 0)); got != expected {
+			t.Errorf("murmur3(%q) = %d, expected %d", input, got, expected)
+		}
+	}
+}
+
+func TestIconURL(t *testing.T) {
+	for body, expected := range map[string]string{
+		`<html><head><link rel="stylesheet" href="/a.css"><link rel="shortcut icon" href=" /static/x.ico "></head></html>`: "/static/x.ico",
+		`<link rel="apple-touch-icon" href="/touch.png"><link REL="Icon" href="i.png">`:                                    "i.png",
+		`<html><body><link rel="icon" href="/late.ico"></body></html>`:                                                     "",
+		`no html here`: "",
+	} {
+		if got := iconURL(body); got != expected {
+			t.Errorf("iconURL(%q) = %q, expected %q", body, got, expected)
+		}
+	}
+}
+
+func TestFetchFavicon(t *testing.T) {
+	icon := []byte("\x00\x00\x01\x00 not really an icon")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><link rel="icon" href="img/icon.ico"></head></html>`))
+		case "/img/icon.ico":
+			w.Header().Set("Content-Type", "image/x-icon")
+			w.Write(icon)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	scanner.config.FetchFavicon = true
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	favicon := result.(*Results).Favicon
+	if favicon == nil || favicon.URL != server.URL+"/img/icon.ico" || favicon.Error != "" || favicon.Size != len(icon) {
+		t.Fatalf("unexpected favicon result %+v", favicon)
+	}
+	sum := md5.Sum(icon)
+	if favicon.MMH3 == nil || *favicon.MMH3 != faviconHash(icon) || favicon.MD5 != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected hashes %+v", favicon)
+	}
+}
@@ -0,0 +1,304 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+)
+
+// Technology is a technology identified by --fingerprint.
+type Technology struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// stringList is a JSON string or list of strings.
+type stringList []string
+
+func (list *stringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*list = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(list))
+}
+
+// fingerprintRules is the Wappalyzer ruleset format: technologies by name,
+// and category names by ID. A file holding only technologies (like the
+// per-letter files of the Wappalyzer repository) is accepted as well.
+type fingerprintRules struct {
+	Categories map[string]struct {
+		Name string `json:"name"`
+	} `json:"categories"`
+	Technologies map[string]struct {
+		Cats      []int                 `json:"cats"`
+		Headers   map[string]stringList `json:"headers"`
+		Cookies   map[string]stringList `json:"cookies"`
+		Meta      map[string]stringList `json:"meta"`
+		HTML      stringList            `json:"html"`
+		ScriptSrc stringList            `json:"scriptSrc"`
+		Implies   stringList            `json:"implies"`
+	} `json:"technologies"`
+}
+
+// fingerprintPattern is a compiled Wappalyzer pattern: a regular expression,
+// optionally followed by "\;version:<template>" (and other tags, which are
+// ignored).
+type fingerprintPattern struct {
+	regex   *regexp.Regexp
+	version string
+}
+
+type technology struct {
+	name       string
+	categories []string
+	headers    map[string][]*fingerprintPattern
+	cookies    map[string][]*fingerprintPattern
+	meta       map[string][]*fingerprintPattern
+	html       []*fingerprintPattern
+	scriptSrc  []*fingerprintPattern
+	implies    []string
+}
+
+// fingerprinter matches responses against a ruleset.
+type fingerprinter struct {
+	technologies []*technology
+	byName       map[string]*technology
+}
+
+// loadFingerprints reads the ruleset in path, or the bundled one if path is
+// empty.
+func loadFingerprints(path string) (*fingerprinter, error) {
+	data := []byte(defaultFingerprintRules)
+	if path != "" {
+		var err error
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	var rules fingerprintRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if rules.Technologies == nil {
+		if err := json.Unmarshal(data, &rules.Technologies); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	ret := &fingerprinter{byName: make(map[string]*technology)}
+	for name, rule := range rules.Technologies {
+		tech := &technology{
+			name:      name,
+			headers:   compilePatternMap(name, rule.Headers, true),
+			cookies:   compilePatternMap(name, rule.Cookies, false),
+			meta:      compilePatternMap(name, rule.Meta, false),
+			html:      compilePatterns(name, rule.HTML),
+			scriptSrc: compilePatterns(name, rule.ScriptSrc),
+		}
+		for _, cat := range rule.Cats {
+			id := strconv.Itoa(cat)
+			if category, ok := rules.Categories[id]; ok && category.Name != "" {
+				id = category.Name
+			}
+			tech.categories = append(tech.categories, id)
+		}
+		for _, implied := range rule.Implies {
+			tech.implies = append(tech.implies, strings.SplitN(implied, `\;`, 2)[0])
+		}
+		ret.technologies = append(ret.technologies, tech)
+		ret.byName[name] = tech
+	}
+	return ret, nil
+}
+
+func compilePatterns(name string, patterns stringList) []*fingerprintPattern {
+	var ret []*fingerprintPattern
+	for _, pattern := range patterns {
+		parts := strings.Split(pattern, `\;`)
+		regex, err := regexp.Compile("(?i)" + parts[0])
+		if err != nil {
+			// Some Wappalyzer patterns use JavaScript-only syntax such as
+			// lookaheads.
+			log.Debugf("fingerprint %s: skipping pattern %q: %v", name, parts[0], err)
+			continue
+		}
+		p := &fingerprintPattern{regex: regex}
+		for _, tag := range parts[1:] {
+			if strings.HasPrefix(tag, "version:") {
+				p.version = strings.TrimPrefix(tag, "version:")
+			}
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+func compilePatternMap(name string, patterns map[string]stringList, canonical bool) map[string][]*fingerprintPattern {
+	if len(patterns) == 0 {
+		return nil
+	}
+	ret := make(map[string][]*fingerprintPattern, len(patterns))
+	for key, list := range patterns {
+		if canonical {
+			key = http.CanonicalHeaderKey(key)
+		} else {
+			key = strings.ToLower(key)
+		}
+		ret[key] = append(ret[key], compilePatterns(name, list)...)
+	}
+	return ret
+}
+
+var versionTernaryRegex = regexp.MustCompile(`\\(\d)\?([^:]*):(.*)`)
+
+// match returns whether the pattern matches value, and the version built
+// from the match.
+func (p *fingerprintPattern) match(value string) (bool, string) {
+	groups := p.regex.FindStringSubmatch(value)
+	if groups == nil {
+		return false, ""
+	}
+	if p.version == "" {
+		return true, ""
+	}
+	group := func(n string) string {
+		i, _ := strconv.Atoi(n)
+		if i < len(groups) {
+			return groups[i]
+		}
+		return ""
+	}
+	// \1?a:b is a if group 1 matched, b otherwise.
+	version := versionTernaryRegex.ReplaceAllStringFunc(p.version, func(t string) string {
+		m := versionTernaryRegex.FindStringSubmatch(t)
+		if group(m[1]) != "" {
+			return m[2]
+		}
+		return m[3]
+	})
+	for i := len(groups) - 1; i > 0; i-- {
+		version = strings.Replace(version, `\`+strconv.Itoa(i), groups[i], -1)
+	}
+	return true, strings.TrimSpace(version)
+}
+
+// pageElements extracts the script sources and meta tags of an HTML page.
+func pageElements(body string) (scripts []string, meta map[string][]string) {
+	meta = make(map[string][]string)
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return scripts, meta
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			tag := string(name)
+			if tag != "script" && tag != "meta" {
+				continue
+			}
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+			if tag == "script" && attrs["src"] != "" {
+				scripts = append(scripts, attrs["src"])
+			}
+			if tag == "meta" {
+				key := attrs["name"]
+				if key == "" {
+					key = attrs["property"]
+				}
+				if key != "" {
+					key = strings.ToLower(key)
+					meta[key] = append(meta[key], attrs["content"])
+				}
+			}
+		}
+	}
+}
+
+// identify returns the technologies matching the response, with the
+// technologies they imply, sorted by name.
+func (f *fingerprinter) identify(response *http.Response) []Technology {
+	if response == nil {
+		return nil
+	}
+	scripts, meta := pageElements(response.BodyText)
+	cookies := make(map[string][]string)
+	for _, cookie := range response.Cookies() {
+		name := strings.ToLower(cookie.Name)
+		cookies[name] = append(cookies[name], cookie.Value)
+	}
+	found := make(map[string]*Technology)
+	detect := func(tech *technology, patterns []*fingerprintPattern, values []string) {
+		for _, p := range patterns {
+			for _, value := range values {
+				ok, version := p.match(value)
+				if !ok {
+					continue
+				}
+				ret := found[tech.name]
+				if ret == nil {
+					ret = &Technology{Name: tech.name, Categories: tech.categories}
+					found[tech.name] = ret
+				}
+				if ret.Version == "" {
+					ret.Version = version
+				}
+			}
+		}
+	}
+	for _, tech := range f.technologies {
+		for name, patterns := range tech.headers {
+			detect(tech, patterns, response.Header[name])
+		}
+		for name, patterns := range tech.cookies {
+			detect(tech, patterns, cookies[name])
+		}
+		for name, patterns := range tech.meta {
+			detect(tech, patterns, meta[name])
+		}
+		detect(tech, tech.html, []string{response.BodyText})
+		detect(tech, tech.scriptSrc, scripts)
+	}
+	var queue []string
+	for name := range found {
+		queue = append(queue, name)
+	}
+	for len(queue) > 0 {
+		tech := f.byName[queue[0]]
+		queue = queue[1:]
+		if tech == nil {
+			continue
+		}
+		for _, implied := range tech.implies {
+			if _, ok := found[implied]; ok {
+				continue
+			}
+			ret := &Technology{Name: implied}
+			if impliedTech := f.byName[implied]; impliedTech != nil {
+				ret.Categories = impliedTech.categories
+			}
+			found[implied] = ret
+			queue = append(queue, implied)
+		}
+	}
+	ret := make([]Technology, 0, len(found))
+	for _, tech := range found {
+		ret = append(ret, *tech)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
@@ -0,0 +1,298 @@
+package http
+
+// defaultFingerprintRules is the ruleset bundled for --fingerprint, a subset
+// of the Wappalyzer technology definitions covering common servers, CDNs,
+// languages, CMSs, frameworks and administrative applications. Patterns are
+// matched case-insensitively; "\;version:\1" after a pattern builds the
+// version from its capture groups.
+const defaultFingerprintRules = `{
+  "categories": {
+    "1": {"name": "CMS"},
+    "3": {"name": "Database managers"},
+    "6": {"name": "Ecommerce"},
+    "10": {"name": "Analytics"},
+    "11": {"name": "Blogs"},
+    "12": {"name": "JavaScript frameworks"},
+    "16": {"name": "Security"},
+    "18": {"name": "Web frameworks"},
+    "22": {"name": "Web servers"},
+    "23": {"name": "Caching"},
+    "27": {"name": "Programming languages"},
+    "28": {"name": "Operating systems"},
+    "30": {"name": "Webmail"},
+    "31": {"name": "CDN"},
+    "34": {"name": "Databases"},
+    "42": {"name": "Tag managers"},
+    "44": {"name": "CI"},
+    "47": {"name": "Development"},
+    "59": {"name": "JavaScript libraries"},
+    "64": {"name": "Reverse proxies"},
+    "66": {"name": "UI frameworks"}
+  },
+  "technologies": {
+    "Nginx": {
+      "cats": [22, 64],
+      "headers": {"Server": "nginx(?:/([\\d.]+))?\\;version:\\1"}
+    },
+    "OpenResty": {
+      "cats": [22],
+      "headers": {"Server": "openresty(?:/([\\d.]+))?\\;version:\\1"},
+      "implies": "Nginx"
+    },
+    "Apache HTTP Server": {
+      "cats": [22],
+      "headers": {"Server": "(?:Apache(?:$|/([\\d.]+)|[^/-])|(?:^|\\b)HTTPD)\\;version:\\1"}
+    },
+    "Apache Tomcat": {
+      "cats": [22],
+      "headers": {
+        "Server": "^Apache-Coyote",
+        "X-Powered-By": "\\bTomcat\\b(?:-([\\d.]+))?\\;version:\\1"
+      },
+      "implies": "Java"
+    },
+    "Jetty": {
+      "cats": [22],
+      "headers": {"Server": "Jetty(?:\\(([\\d.]*\\d+))?\\;version:\\1"},
+      "implies": "Java"
+    },
+    "IIS": {
+      "cats": [22],
+      "headers": {"Server": "^(?:Microsoft-)?IIS(?:/([\\d.]+))?\\;version:\\1"},
+      "implies": "Windows Server"
+    },
+    "LiteSpeed": {
+      "cats": [22],
+      "headers": {"Server": "^LiteSpeed$"}
+    },
+    "Caddy": {
+      "cats": [22],
+      "headers": {"Server": "^Caddy$"}
+    },
+    "Envoy": {
+      "cats": [64],
+      "headers": {"Server": "^envoy$", "X-Envoy-Upstream-Service-Time": ""}
+    },
+    "Varnish": {
+      "cats": [23],
+      "headers": {"Via": "varnish(?: \\(Varnish/([\\d.]+)\\))?\\;version:\\1", "X-Varnish": ""}
+    },
+    "Cloudflare": {
+      "cats": [31],
+      "headers": {"Server": "^cloudflare$", "CF-RAY": ""},
+      "cookies": {"__cfduid": "", "__cf_bm": ""}
+    },
+    "Amazon CloudFront": {
+      "cats": [31],
+      "headers": {"X-Amz-Cf-Id": "", "Via": "\\(CloudFront\\)$"}
+    },
+    "Akamai": {
+      "cats": [31],
+      "headers": {"X-Akamai-Transformed": ""}
+    },
+    "Fastly": {
+      "cats": [31],
+      "headers": {"Fastly-Debug-Digest": "", "X-Served-By": "^cache-"}
+    },
+    "Windows Server": {
+      "cats": [28]
+    },
+    "PHP": {
+      "cats": [27],
+      "headers": {
+        "X-Powered-By": "^php/?([\\d.]+)?\\;version:\\1",
+        "Server": "php/?([\\d.]+)?\\;version:\\1"
+      },
+      "cookies": {"PHPSESSID": ""}
+    },
+    "Java": {
+      "cats": [27],
+      "cookies": {"JSESSIONID": ""}
+    },
+    "Node.js": {
+      "cats": [27]
+    },
+    "Python": {
+      "cats": [27]
+    },
+    "Ruby": {
+      "cats": [27]
+    },
+    "MySQL": {
+      "cats": [34]
+    },
+    "ASP.NET": {
+      "cats": [18],
+      "headers": {
+        "X-AspNet-Version": "(.+)\\;version:\\1",
+        "X-Powered-By": "^ASP\\.NET"
+      },
+      "cookies": {"ASP.NET_SessionId": ""},
+      "html": "<input[^>]+name=\"__VIEWSTATE"
+    },
+    "Express": {
+      "cats": [18, 22],
+      "headers": {"X-Powered-By": "^Express$"},
+      "implies": "Node.js"
+    },
+    "Next.js": {
+      "cats": [18],
+      "headers": {"X-Powered-By": "^Next\\.js ?([0-9.]+)?\\;version:\\1"},
+      "html": "<script[^>]+id=\"__NEXT_DATA__\"",
+      "implies": ["React", "Node.js"]
+    },
+    "Nuxt.js": {
+      "cats": [18],
+      "html": "<div [^>]*id=\"__nuxt\"",
+      "implies": "Vue.js"
+    },
+    "Django": {
+      "cats": [18],
+      "cookies": {"django_language": ""},
+      "html": "<input[^>]*name=[\"']csrfmiddlewaretoken",
+      "implies": "Python"
+    },
+    "Ruby on Rails": {
+      "cats": [18],
+      "headers": {"X-Powered-By": "mod_(?:rails|rack)", "Server": "mod_(?:rails|rack)"},
+      "meta": {"csrf-param": "^authenticity_token$"},
+      "implies": "Ruby"
+    },
+    "Laravel": {
+      "cats": [18],
+      "cookies": {"laravel_session": ""},
+      "implies": "PHP"
+    },
+    "WordPress": {
+      "cats": [1, 11],
+      "headers": {"Link": "rel=\"https://api\\.w\\.org/\""},
+      "meta": {"generator": "^WordPress ?([\\d.]+)?\\;version:\\1"},
+      "html": "<link[^>]+/wp-(?:content|includes)/",
+      "scriptSrc": "/wp-(?:content|includes)/",
+      "implies": ["PHP", "MySQL"]
+    },
+    "Drupal": {
+      "cats": [1],
+      "headers": {
+        "X-Drupal-Cache": "",
+        "X-Generator": "^Drupal(?:\\s([\\d.]+))?\\;version:\\1"
+      },
+      "meta": {"generator": "^Drupal(?:\\s([\\d.]+))?\\;version:\\1"},
+      "scriptSrc": "drupal\\.js",
+      "implies": "PHP"
+    },
+    "Joomla": {
+      "cats": [1],
+      "headers": {"X-Content-Encoded-By": "Joomla! ([\\d.]+)\\;version:\\1"},
+      "meta": {"generator": "Joomla!(?: ([\\d.]+))?\\;version:\\1"},
+      "implies": "PHP"
+    },
+    "1C-Bitrix": {
+      "cats": [1],
+      "headers": {"X-Powered-CMS": "Bitrix Site Manager"},
+      "scriptSrc": "/bitrix/(?:js|templates)/",
+      "implies": "PHP"
+    },
+    "Tilda": {
+      "cats": [1],
+      "scriptSrc": "tildacdn\\.com"
+    },
+    "Magento": {
+      "cats": [6],
+      "html": "Mage\\.Cookies",
+      "scriptSrc": "js/mage",
+      "implies": "PHP"
+    },
+    "Shopify": {
+      "cats": [6],
+      "headers": {"X-ShopId": "", "X-Shopify-Stage": ""},
+      "scriptSrc": "cdn\\.shopify\\.com"
+    },
+    "jQuery": {
+      "cats": [59],
+      "scriptSrc": [
+        "jquery[.-]([\\d.]*\\d)[^/]*\\.js\\;version:\\1",
+        "/([\\d.]+)/jquery(?:\\.min)?\\.js\\;version:\\1",
+        "jquery.*\\.js"
+      ]
+    },
+    "React": {
+      "cats": [12],
+      "html": "<[^>]+data-react",
+      "scriptSrc": "react(?:-dom)?[.-]([\\d.]*\\d)[^/]*\\.js\\;version:\\1"
+    },
+    "Vue.js": {
+      "cats": [12],
+      "html": "<[^>]+\\sdata-v(?:ue)?-",
+      "scriptSrc": [
+        "vue[.-]([\\d.]*\\d)[^/]*\\.js\\;version:\\1",
+        "/vue(?:\\.min)?\\.js"
+      ]
+    },
+    "Angular": {
+      "cats": [12],
+      "html": "<[^>]+ ng-version=\"([\\d.]+)\"\\;version:\\1"
+    },
+    "AngularJS": {
+      "cats": [12],
+      "html": "<(?:div|html)[^>]+ng-app=",
+      "scriptSrc": "angular[.-]([\\d.]*\\d)[^/]*\\.js\\;version:\\1"
+    },
+    "Bootstrap": {
+      "cats": [66],
+      "html": "<link[^>]+?href=\"[^\"]+bootstrap(?:[.-]([\\d.]+))?(?:\\.min)?\\.css\\;version:\\1",
+      "scriptSrc": "bootstrap(?:[.-]([\\d.]+))?(?:\\.min)?\\.js\\;version:\\1"
+    },
+    "Google Analytics": {
+      "cats": [10],
+      "scriptSrc": [
+        "google-analytics\\.com/(?:ga|urchin|analytics)\\.js",
+        "googletagmanager\\.com/gtag/js"
+      ]
+    },
+    "Google Tag Manager": {
+      "cats": [42],
+      "scriptSrc": "googletagmanager\\.com/gtm\\.js"
+    },
+    "Yandex.Metrika": {
+      "cats": [10],
+      "scriptSrc": "mc\\.yandex\\.ru/metrika/(?:tag|watch)\\.js"
+    },
+    "reCAPTCHA": {
+      "cats": [16],
+      "scriptSrc": "/recaptcha/api\\.js"
+    },
+    "HSTS": {
+      "cats": [16],
+      "headers": {"Strict-Transport-Security": ""}
+    },
+    "Jenkins": {
+      "cats": [44],
+      "headers": {"X-Jenkins": "([\\d.]+)\\;version:\\1"},
+      "implies": "Java"
+    },
+    "GitLab": {
+      "cats": [47],
+      "cookies": {"_gitlab_session": ""},
+      "meta": {"og:site_name": "^GitLab$"}
+    },
+    "Outlook Web App": {
+      "cats": [30],
+      "headers": {"X-OWA-Version": "([\\d.]+)\\;version:\\1"},
+      "html": "<link[^>]+/owa/auth/([\\d.]+)/themes/\\;version:\\1",
+      "implies": ["IIS", "ASP.NET"]
+    },
+    "Roundcube": {
+      "cats": [30],
+      "cookies": {"roundcube_sessid": ""},
+      "html": "<title>[^<]*Roundcube",
+      "implies": "PHP"
+    },
+    "phpMyAdmin": {
+      "cats": [3],
+      "cookies": {"phpMyAdmin": ""},
+      "html": "<title>phpMyAdmin",
+      "implies": ["PHP", "MySQL"]
+    }
+  }
+}`
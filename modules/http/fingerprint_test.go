@@ -0,0 +1,86 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestBundledFingerprintRules(t *testing.T) {
+	var rules fingerprintRules
+	if err := json.Unmarshal([]byte(defaultFingerprintRules), &rules); err != nil {
+		t.Fatal(err)
+	}
+	for name, rule := range rules.Technologies {
+		var patterns []string
+		patterns = append(patterns, rule.HTML...)
+		patterns = append(patterns, rule.ScriptSrc...)
+		for _, m := range []map[string]stringList{rule.Headers, rule.Cookies, rule.Meta} {
+			for _, list := range m {
+				patterns = append(patterns, list...)
+			}
+		}
+		for _, pattern := range patterns {
+			if _, err := regexp.Compile(strings.Split(pattern, `\;`)[0]); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+		for _, cat := range rule.Cats {
+			if _, ok := rules.Categories[strconv.Itoa(cat)]; !ok {
+				t.Errorf("%s: unknown category %d", name, cat)
+			}
+		}
+	}
+}
+
+func TestFingerprintVersion(t *testing.T) {
+	p := compilePatterns("test", stringList{`^foo(?:/([\d.]+))?(-beta)?\;version:\2?\1 beta:\1\;confidence:50`})[0]
+	for value, expected := range map[string]string{
+		"Foo/1.2":      "1.2",
+		"foo/1.2-beta": "1.2 beta",
+		"foo":          "",
+	} {
+		if ok, version := p.match(value); !ok || version != expected {
+			t.Errorf("%q: got %v %q, expected %q", value, ok, version, expected)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25.3")
+		w.Header().Set("X-Powered-By", "PHP/8.2.1")
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "abc"})
+		w.Write([]byte(`<html><head><meta name="generator" content="WordPress 6.4.2">` +
+			`<script src="/wp-includes/js/jquery/jquery-3.7.1.min.js"></script></head><body></body></html>`))
+	}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	var err error
+	if scanner.fingerprints, err = loadFingerprints(""); err != nil {
+		t.Fatal(err)
+	}
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	expected := []Technology{
+		{"MySQL", "", []string{"Databases"}},
+		{"Nginx", "1.25.3", []string{"Web servers", "Reverse proxies"}},
+		{"PHP", "8.2.1", []string{"Programming languages"}},
+		{"WordPress", "6.4.2", []string{"CMS", "Blogs"}},
+		{"jQuery", "3.7.1", []string{"JavaScript libraries"}},
+	}
+	if got := result.(*Results).Technologies; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v", got)
+	}
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// HTMLInfo holds the fields parsed from the body by --parse-html.
+type HTMLInfo struct {
+	Title     string `json:"title,omitempty"`
+	Generator string `json:"generator,omitempty"`
+	Canonical string `json:"canonical,omitempty"`
+
+	// Charset is the encoding of the body, from the Content-Type header,
+	// a BOM or a meta tag, or guessed from the content.
+	Charset string `json:"charset,omitempty"`
+
+	// BodySHA256 is the SHA-256 of the body read, in hex.
+	BodySHA256 string `json:"body_sha256,omitempty"`
+
+	// SimHash is the 64-bit SimHash of the words of the page text, in hex;
+	// similar pages have hashes differing in few bits.
+	SimHash string `json:"simhash,omitempty"`
+}
+
+// parseHTML extracts the HTMLInfo of a response read by Grab.
+func parseHTML(response *http.Response) *HTMLInfo {
+	if response == nil {
+		return nil
+	}
+	ret := &HTMLInfo{BodySHA256: hex.EncodeToString(response.BodySHA256)}
+	if raw, err := base64.StdEncoding.DecodeString(response.BodyBase64); err == nil && len(raw) > 0 {
+		_, ret.Charset, _ = charset.DetermineEncoding(raw, response.Header.Get("Content-Type"))
+	}
+
+	var words []string
+	inTitle, skip := false, 0
+	tokenizer := html.NewTokenizer(strings.NewReader(response.BodyText))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		switch tokenType {
+		case html.TextToken:
+			text := string(tokenizer.Text())
+			if inTitle && ret.Title == "" {
+				ret.Title = strings.Join(strings.Fields(text), " ")
+			}
+			if skip == 0 {
+				words = append(words, strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+					return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+				})...)
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "script", "style":
+				if skip > 0 {
+					skip--
+				}
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			tag := string(name)
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+			switch tag {
+			case "title":
+				inTitle = tokenType == html.StartTagToken
+			case "script", "style":
+				if tokenType == html.StartTagToken {
+					skip++
+				}
+			case "meta":
+				if strings.EqualFold(attrs["name"], "generator") && ret.Generator == "" {
+					ret.Generator = strings.TrimSpace(attrs["content"])
+				}
+			case "link":
+				for _, rel := range strings.Fields(attrs["rel"]) {
+					if strings.EqualFold(rel, "canonical") && ret.Canonical == "" {
+						ret.Canonical = strings.TrimSpace(attrs["href"])
+					}
+				}
+			}
+		}
+	}
+	if len(words) > 0 {
+		ret.SimHash = fmt.Sprintf("%016x", simHash(words))
+	}
+	return ret
+}
+
+// simHash returns the SimHash of the features, each hashed with 64-bit
+// FNV-1a and weighted by its number of occurrences.
+func simHash(features []string) uint64 {
+	var weights [64]int
+	for _, feature := range features {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for i := uint(0); i < 64; i++ {
+			if sum&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	var ret uint64
+	for i, weight := range weights {
+		if weight > 0 {
+			ret |= 1 << uint(i)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestParseHTML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=windows-1251")
+		w.Write([]byte(`<html><head>
+<title>
+  Router   Login
+</title>
+<meta name="Generator" content="WordPress 6.4">
+<link rel="alternate canonical" href="https://example.com/">
+<script>var ignored = "words";</script>
+</head><body><p>Welcome to the router</p></body></html>`))
+	}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	scanner.config.ParseHTML = true
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	info := result.(*Results).HTML
+	if info == nil || info.Title != "Router Login" || info.Generator != "WordPress 6.4" || info.Canonical != "https://example.com/" || info.Charset != "windows-1251" {
+		t.Fatalf("unexpected html info %+v", info)
+	}
+	if len(info.BodySHA256) != 64 {
+		t.Errorf("unexpected body hash %s", info.BodySHA256)
+	}
+	// The script is not part of the text.
+	expected := fmt.Sprintf("%016x", simHash(strings.Fields("router login welcome to the router")))
+	if info.SimHash != expected {
+		t.Errorf("simhash %s, expected %s", info.SimHash, expected)
+	}
+}
+
+func TestSimHash(t *testing.T) {
+	a := simHash(strings.Fields("the quick brown fox jumps over the lazy dog and runs away into the forest"))
+	b := simHash(strings.Fields("the quick brown fox jumps over the lazy cat and runs away into the forest"))
+	c := simHash(strings.Fields("completely different text about routers firmware and admin panels"))
+	if bits.OnesCount64(a^b) >= bits.OnesCount64(a^c) {
+		t.Errorf("similar texts are not closer: %d vs %d", bits.OnesCount64(a^b), bits.OnesCount64(a^c))
+	}
+}
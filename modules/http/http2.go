@@ -0,0 +1,407 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// HTTP2Frame is a summary of a frame received from the server.
+type HTTP2Frame struct {
+	Type     string `json:"type"`
+	StreamID uint32 `json:"stream_id"`
+	Flags    uint8  `json:"flags,omitempty"`
+	Length   uint32 `json:"length"`
+}
+
+// HTTP2Response is the response to the HTTP/2 request on stream 1.
+type HTTP2Response struct {
+	// Status is the value of the :status pseudo-header.
+	Status string `json:"status,omitempty"`
+
+	// PseudoHeaders are the pseudo-header fields, in the order received.
+	PseudoHeaders []string `json:"pseudo_headers,omitempty"`
+
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// Trailers are the fields of a HEADERS frame after the body.
+	Trailers map[string][]string `json:"trailers,omitempty"`
+
+	// HeaderIssues lists violations of the RFC 7540 section 8.1.2 header
+	// rules: pseudo-headers after regular fields, unknown or repeated
+	// pseudo-headers, uppercase names and connection-specific fields.
+	HeaderIssues []string `json:"header_issues,omitempty"`
+
+	BodyText   string `json:"body,omitempty"`
+	BodyBase64 string `json:"body_base64,omitempty"`
+	BodySHA256 []byte `json:"body_sha256,omitempty"`
+
+	// Complete is true if the stream was ended by the server (END_STREAM).
+	Complete bool `json:"complete"`
+
+	// ResetCode is the error code of a RST_STREAM for the stream.
+	ResetCode string `json:"reset_code,omitempty"`
+}
+
+// HTTP2Results holds the results of the --http2 probe.
+type HTTP2Results struct {
+	// ALPN is the protocol selected by the server in the TLS handshake.
+	ALPN string `json:"alpn,omitempty"`
+
+	// UpgradeStatusCode is the status of the response to the h2c upgrade
+	// request (101 if the server switched protocols).
+	UpgradeStatusCode int `json:"upgrade_status_code,omitempty"`
+
+	// Protocol is "h2" or "h2c" if HTTP/2 was spoken, empty otherwise.
+	Protocol string `json:"protocol,omitempty"`
+
+	// Settings are the parameters of the server's first SETTINGS frame, by
+	// name (unknown identifiers as UNKNOWN_SETTING_<id>).
+	Settings map[string]uint32 `json:"settings,omitempty"`
+
+	// WindowUpdate is the connection-level window increment sent by the
+	// server before the response.
+	WindowUpdate uint32 `json:"window_update,omitempty"`
+
+	Response *HTTP2Response `json:"response,omitempty"`
+
+	// Frames lists the frames received, up to the end of stream 1.
+	Frames []HTTP2Frame `json:"frames,omitempty"`
+
+	// GoAwayCode and GoAwayDebug are from a GOAWAY frame, if one was received.
+	GoAwayCode  string `json:"goaway_code,omitempty"`
+	GoAwayDebug string `json:"goaway_debug,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// maxHTTP2Frames bounds the frames read while waiting for the response.
+const maxHTTP2Frames = 256
+
+// connectionSpecificFields are forbidden in HTTP/2 (RFC 7540 section 8.1.2.2).
+var connectionSpecificFields = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// probeHTTP2 opens a new connection and tries to speak HTTP/2 to the
+// target: with ALPN over TLS, or with an h2c upgrade otherwise.
+func (scan *scan) probeHTTP2(useHTTPS bool) *HTTP2Results {
+	ret := new(HTTP2Results)
+	u, err := url.Parse(scan.url)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	conn, err := scan.target.Open(&scan.scanner.config.BaseFlags)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(scan.scanner.config.Timeout))
+
+	if useHTTPS {
+		cfg, err := scan.scanner.config.TLSFlags.GetTLSConfigForTarget(scan.target)
+		if err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		cfg.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+		tlsConn := scan.scanner.config.TLSFlags.GetWrappedConnection(conn, cfg)
+		if err := tlsConn.Handshake(); err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		ret.ALPN = tlsConn.ConnectionState().NegotiatedProtocol
+		if ret.ALPN != http2.NextProtoTLS {
+			return ret
+		}
+		ret.Protocol = http2.NextProtoTLS
+		conn = tlsConn
+	}
+
+	framer := http2.NewFramer(conn, conn)
+	framer.SetMaxReadFrameSize(1 << 20)
+	if useHTTPS {
+		if err := writeHTTP2Preface(conn, framer); err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		if err := writeHTTP2Request(framer, scan.scanner.config.Method, "https", u, scan.scanner.config.UserAgent); err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+	} else {
+		ok, err := scan.upgradeH2C(conn, u, ret)
+		if err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		if !ok {
+			return ret
+		}
+		ret.Protocol = "h2c"
+		// The upgrade request is stream 1; only the preface is sent.
+		if err := writeHTTP2Preface(conn, framer); err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+	}
+	if err := scan.readHTTP2Response(framer, ret); err != nil {
+		ret.Error = err.Error()
+	}
+	return ret
+}
+
+// writeHTTP2Preface sends the client connection preface and an empty
+// SETTINGS frame.
+func writeHTTP2Preface(conn net.Conn, framer *http2.Framer) error {
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		return err
+	}
+	return framer.WriteSettings()
+}
+
+// writeHTTP2Request sends the request as a HEADERS frame on stream 1.
+func writeHTTP2Request(framer *http2.Framer, method string, scheme string, u *url.URL, userAgent string) error {
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: method},
+		{Name: ":scheme", Value: scheme},
+		{Name: ":authority", Value: u.Host},
+		{Name: ":path", Value: u.RequestURI()},
+		{Name: "user-agent", Value: userAgent},
+		{Name: "accept", Value: "*/*"},
+	} {
+		if err := encoder.WriteField(field); err != nil {
+			return err
+		}
+	}
+	return framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: block.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+}
+
+// upgradeH2C sends an HTTP/1.1 request with an h2c upgrade and reads the
+// response headers. It returns true if the server switched protocols.
+func (scan *scan) upgradeH2C(conn net.Conn, u *url.URL, ret *HTTP2Results) (bool, error) {
+	var settings bytes.Buffer
+	if err := http2.NewFramer(&settings, nil).WriteSettings(); err != nil {
+		return false, err
+	}
+	// The HTTP2-Settings value is the SETTINGS payload, without the frame
+	// header.
+	payload := base64.RawURLEncoding.EncodeToString(settings.Bytes()[9:])
+	request := fmt.Sprintf("%s %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: %s\r\nAccept: */*\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: %s\r\n\r\n",
+		scan.scanner.config.Method, u.RequestURI(), u.Host, scan.scanner.config.UserAgent, payload)
+	if _, err := io.WriteString(conn, request); err != nil {
+		return false, err
+	}
+	// Read byte by byte so no HTTP/2 frame data is consumed past the
+	// headers.
+	var response []byte
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(response, []byte("\r\n\r\n")) {
+		if len(response) > 64*1024 {
+			return false, fmt.Errorf("upgrade response headers too long")
+		}
+		if _, err := conn.Read(b); err != nil {
+			return false, err
+		}
+		response = append(response, b[0])
+	}
+	if match := httpStatusLineRegex.FindSubmatch(response); match != nil {
+		ret.UpgradeStatusCode, _ = strconv.Atoi(string(match[1]))
+	}
+	return ret.UpgradeStatusCode == 101, nil
+}
+
+// readHTTP2Response reads frames until stream 1 ends, acknowledging the
+// server's SETTINGS and PINGs.
+func (scan *scan) readHTTP2Response(framer *http2.Framer, ret *HTTP2Results) error {
+	maxSize := scan.scanner.config.MaxSize * 1024
+	decoder := hpack.NewDecoder(4096, nil)
+	response := new(HTTP2Response)
+	ret.Response = response
+	var body bytes.Buffer
+	defer func() {
+		if body.Len() > 0 {
+			response.BodyText = body.String()
+			response.BodyBase64 = base64.StdEncoding.EncodeToString(body.Bytes())
+			sum := sha256.Sum256(body.Bytes())
+			response.BodySHA256 = sum[:]
+		}
+	}()
+
+	var block []byte
+	headersDone := false
+	for len(ret.Frames) < maxHTTP2Frames {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return err
+		}
+		header := frame.Header()
+		ret.Frames = append(ret.Frames, HTTP2Frame{
+			Type:     header.Type.String(),
+			StreamID: header.StreamID,
+			Flags:    uint8(header.Flags),
+			Length:   header.Length,
+		})
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			if ret.Settings == nil {
+				ret.Settings = make(map[string]uint32)
+				f.ForeachSetting(func(s http2.Setting) error {
+					ret.Settings[s.ID.String()] = s.Val
+					return nil
+				})
+			}
+			if err := framer.WriteSettingsAck(); err != nil {
+				return err
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				if err := framer.WritePing(true, f.Data); err != nil {
+					return err
+				}
+			}
+		case *http2.WindowUpdateFrame:
+			if f.StreamID == 0 && ret.WindowUpdate == 0 {
+				ret.WindowUpdate = f.Increment
+			}
+		case *http2.GoAwayFrame:
+			ret.GoAwayCode = f.ErrCode.String()
+			ret.GoAwayDebug = string(f.DebugData())
+			return nil
+		case *http2.RSTStreamFrame:
+			if f.StreamID == 1 {
+				response.ResetCode = f.ErrCode.String()
+				return nil
+			}
+		case *http2.HeadersFrame:
+			if f.StreamID != 1 {
+				continue
+			}
+			block = append(block[:0], f.HeaderBlockFragment()...)
+			if f.HeadersEnded() {
+				if err := decodeHTTP2Headers(decoder, block, response, headersDone); err != nil {
+					return err
+				}
+				headersDone = true
+			}
+			if f.StreamEnded() {
+				response.Complete = true
+				return nil
+			}
+		case *http2.ContinuationFrame:
+			if f.StreamID != 1 {
+				continue
+			}
+			block = append(block, f.HeaderBlockFragment()...)
+			if f.HeadersEnded() {
+				if err := decodeHTTP2Headers(decoder, block, response, headersDone); err != nil {
+					return err
+				}
+				headersDone = true
+			}
+		case *http2.DataFrame:
+			if f.StreamID != 1 {
+				continue
+			}
+			data := f.Data()
+			if room := maxSize - body.Len(); len(data) > room {
+				data = data[:room]
+			}
+			body.Write(data)
+			if f.StreamEnded() {
+				response.Complete = true
+				return nil
+			}
+			if body.Len() >= maxSize {
+				return nil
+			}
+			// Keep the server sending.
+			if n := uint32(len(f.Data())); n > 0 {
+				framer.WriteWindowUpdate(0, n)
+				framer.WriteWindowUpdate(1, n)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeHTTP2Headers decodes a header block into the response, recording
+// header rule violations. A block after the response headers holds the
+// trailers.
+func decodeHTTP2Headers(decoder *hpack.Decoder, block []byte, response *HTTP2Response, trailers bool) error {
+	fields, err := decoder.DecodeFull(block)
+	if err != nil {
+		return err
+	}
+	target := &response.Headers
+	if trailers {
+		target = &response.Trailers
+	}
+	if *target == nil {
+		*target = make(map[string][]string)
+	}
+	regular := false
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		if field.Name != strings.ToLower(field.Name) {
+			response.HeaderIssues = append(response.HeaderIssues, "uppercase field name "+field.Name)
+		}
+		if !field.IsPseudo() {
+			regular = true
+			name := strings.ToLower(field.Name)
+			if connectionSpecificFields[name] {
+				response.HeaderIssues = append(response.HeaderIssues, "connection-specific field "+name)
+			}
+			(*target)[name] = append((*target)[name], field.Value)
+			continue
+		}
+		switch {
+		case trailers:
+			response.HeaderIssues = append(response.HeaderIssues, "pseudo-header in trailers "+field.Name)
+		case regular:
+			response.HeaderIssues = append(response.HeaderIssues, "pseudo-header after regular field "+field.Name)
+		case field.Name != ":status":
+			response.HeaderIssues = append(response.HeaderIssues, "unknown response pseudo-header "+field.Name)
+		case seen[field.Name]:
+			response.HeaderIssues = append(response.HeaderIssues, "repeated pseudo-header "+field.Name)
+		}
+		seen[field.Name] = true
+		if !trailers {
+			response.PseudoHeaders = append(response.PseudoHeaders, field.Name)
+			if field.Name == ":status" && response.Status == "" {
+				response.Status = field.Value
+			}
+		}
+	}
+	if !trailers && response.Status == "" {
+		response.HeaderIssues = append(response.HeaderIssues, "missing :status")
+	}
+	return nil
+}
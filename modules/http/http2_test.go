@@ -0,0 +1,114 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func getTestServerScanner(t *testing.T, server *httptest.Server, useHTTPS bool) (*Scanner, zgrab2.ScanTarget) {
+	host, portString, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portString)
+	var module Module
+	flags := module.NewFlags().(*Flags)
+	flags.Endpoint = "/"
+	flags.Method = "GET"
+	flags.UserAgent = "Mozilla/5.0 zgrab/0.x"
+	flags.MaxSize = 256
+	flags.Timeout = 5 * time.Second
+	flags.Port = uint(port)
+	flags.UseHTTPS = useHTTPS
+	flags.HTTP2 = true
+	scanner := module.NewScanner()
+	scanner.Init(flags)
+	return scanner.(*Scanner), zgrab2.ScanTarget{IP: net.ParseIP(host)}
+}
+
+func http2TestHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "test")
+	w.Write([]byte("hello " + r.Proto))
+}
+
+func checkHTTP2Results(t *testing.T, result *HTTP2Results, protocol string) {
+	if result == nil {
+		t.Fatal("no http2 results")
+	}
+	if result.Error != "" {
+		t.Fatalf("http2 error: %s", result.Error)
+	}
+	if result.Protocol != protocol {
+		t.Errorf("got protocol %q, expected %q", result.Protocol, protocol)
+	}
+	if len(result.Settings) == 0 {
+		t.Error("no server SETTINGS recorded")
+	}
+	response := result.Response
+	if response == nil {
+		t.Fatal("no response")
+	}
+	if response.Status != "200" || !response.Complete {
+		t.Errorf("bad response %+v", response)
+	}
+	if response.BodyText != "hello HTTP/2.0" {
+		t.Errorf("got body %q", response.BodyText)
+	}
+	if len(response.Headers["server"]) != 1 || len(response.HeaderIssues) != 0 {
+		t.Errorf("bad headers %v, issues %v", response.Headers, response.HeaderIssues)
+	}
+}
+
+func TestHTTP2ALPN(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(http2TestHandler))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, true)
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	http2Result := result.(*Results).HTTP2
+	checkHTTP2Results(t, http2Result, "h2")
+	if http2Result.ALPN != "h2" {
+		t.Errorf("got ALPN %q", http2Result.ALPN)
+	}
+}
+
+func TestHTTP2H2CUpgrade(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(http2TestHandler), &http2.Server{}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	http2Result := result.(*Results).HTTP2
+	checkHTTP2Results(t, http2Result, "h2c")
+	if http2Result.UpgradeStatusCode != 101 {
+		t.Errorf("got upgrade status %d", http2Result.UpgradeStatusCode)
+	}
+}
+
+func TestHTTP2NotSupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(http2TestHandler))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	_, result, _ := scanner.Scan(target)
+	http2Result := result.(*Results).HTTP2
+	if http2Result == nil || http2Result.Protocol != "" || http2Result.UpgradeStatusCode != 200 {
+		t.Errorf("unexpected result %+v", http2Result)
+	}
+}
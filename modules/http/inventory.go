@@ -0,0 +1,95 @@
+package http
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+	"golang.org/x/net/html"
+)
+
+// listingTitleRegex matches the titles of the directory listings generated
+// by Apache, nginx, lighttpd, Python's http.server and the like.
+var listingTitleRegex = regexp.MustCompile(`(?i)^(index of|directory listing for) `)
+
+// listDirectory records the entries of a directory listing served as the
+// final response in an inventory. It returns nil unless the response is
+// a successful, unauthenticated directory listing. Only the links one
+// level below the listed directory are kept.
+func listDirectory(response *http.Response, flags *zgrab2.InventoryFlags) *zgrab2.Inventory {
+	if response == nil || response.StatusCode != 200 || response.Request == nil || response.Request.URL == nil {
+		return nil
+	}
+	base := response.Request.URL
+	dir := base.Path
+	if !strings.HasSuffix(dir, "/") {
+		dir = dir[:strings.LastIndex(dir, "/")+1]
+	}
+	var hrefs []string
+	title, inTitle := "", false
+	tokenizer := html.NewTokenizer(strings.NewReader(response.BodyText))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		switch tokenType {
+		case html.TextToken:
+			if inTitle {
+				title += string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "title" {
+				inTitle = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			inTitle = inTitle || string(name) == "title" && tokenType == html.StartTagToken
+			for string(name) == "a" && hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				if string(key) == "href" {
+					hrefs = append(hrefs, string(value))
+				}
+			}
+		}
+	}
+	title = strings.TrimSpace(title)
+	// IIS has no fixed title, but marks the directories in the listing.
+	iis := strings.Contains(response.BodyText, "&lt;dir&gt;")
+	if !listingTitleRegex.MatchString(title) && !iis {
+		return nil
+	}
+
+	inv := flags.NewInventory(dir)
+	seen := make(map[string]bool)
+	for _, href := range hrefs {
+		if strings.HasPrefix(href, "?") || strings.HasPrefix(href, "#") {
+			// Column sorting links and anchors.
+			continue
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+		target := base.ResolveReference(ref)
+		if target.Host != base.Host || !strings.HasPrefix(target.Path, dir) {
+			continue
+		}
+		name := strings.TrimPrefix(target.Path, dir)
+		entry := zgrab2.InventoryEntry{Name: strings.TrimSuffix(name, "/"), Type: zgrab2.InventoryFile}
+		if strings.HasSuffix(name, "/") {
+			entry.Type = zgrab2.InventoryDirectory
+		}
+		if entry.Name == "" || strings.Contains(entry.Name, "/") || seen[entry.Name] {
+			continue
+		}
+		seen[entry.Name] = true
+		if !inv.Add(entry) {
+			break
+		}
+	}
+	return inv
+}
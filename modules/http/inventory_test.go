@@ -0,0 +1,73 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+const apacheListing = `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 3.2 Final//EN">
+<html><head><title>Index of /pub</title></head><body>
+<h1>Index of /pub</h1>
+<table>
+<tr><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th></tr>
+<tr><td><a href="/">Parent Directory</a></td></tr>
+<tr><td><a href="backups/"><img src="/icons/folder.gif"></a></td><td><a href="backups/">backups/</a></td></tr>
+<tr><td><a href="db%20dump.sql">db dump.sql</a></td></tr>
+<tr><td><a href="/pub/notes.txt">notes.txt</a></td></tr>
+<tr><td><a href="http://example.com/pub/elsewhere">elsewhere</a></td></tr>
+<tr><td><a href="more.txt">more.txt</a></td></tr>
+</table></body></html>`
+
+func TestInventoryHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pub/" {
+			w.Write([]byte("<html><head><title>Welcome</title></head><body><a href=\"a/\">a</a></body></html>"))
+			return
+		}
+		w.Write([]byte(apacheListing))
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		endpoint  string
+		max       int
+		names     []string
+		truncated bool
+	}{
+		{"/", 10, nil, false},
+		{"/pub/", 10, []string{"backups", "db dump.sql", "notes.txt", "more.txt"}, false},
+		{"/pub/", 2, []string{"backups", "db dump.sql"}, true},
+	} {
+		scanner, target := getTestServerScanner(t, server, false)
+		scanner.config.HTTP2 = false
+		scanner.config.MaxSize = 64
+		scanner.config.Endpoint = test.endpoint
+		scanner.config.Inventory = true
+		scanner.config.InventoryMaxEntries = test.max
+		status, result, err := scanner.Scan(target)
+		if status != zgrab2.SCAN_SUCCESS {
+			t.Fatalf("scan failed: %s %v", status, err)
+		}
+		inv := result.(*Results).Inventory
+		if test.names == nil {
+			if inv != nil {
+				t.Errorf("%s: unexpected inventory %+v", test.endpoint, inv)
+			}
+			continue
+		}
+		if inv == nil || inv.Path != "/pub/" || inv.Truncated != test.truncated || len(inv.Entries) != len(test.names) {
+			t.Fatalf("%s: unexpected inventory %+v", test.endpoint, inv)
+		}
+		for i, name := range test.names {
+			if inv.Entries[i].Name != name {
+				t.Errorf("entry %d: got %s, expected %s", i, inv.Entries[i].Name, name)
+			}
+		}
+		if inv.Entries[0].Type != zgrab2.InventoryDirectory || inv.Entries[1].Type != zgrab2.InventoryFile {
+			t.Errorf("unexpected entries %+v", inv.Entries)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+)
+
+var (
+	// ErrRedirCrossHost is returned when a redirect points to another host
+	// and RedirectSameHost is set.
+	ErrRedirCrossHost = errors.New("Redirecting to another host")
+
+	// ErrRedirCrossScheme is returned when a redirect changes the scheme
+	// and RedirectSameScheme is set.
+	ErrRedirCrossScheme = errors.New("Redirecting to another scheme")
+)
+
+// RedirectHop is one response of the redirect chain.
+type RedirectHop struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Location   string      `json:"location,omitempty"`
+	Headers    http.Header `json:"headers,omitempty"`
+
+	// IP is the address the response was received from.
+	IP string `json:"ip,omitempty"`
+
+	// NotFollowed is why the redirect of the last hop was not followed.
+	NotFollowed string `json:"not_followed,omitempty"`
+}
+
+// isRedirectStop reports whether err is returned for a redirect that was
+// not followed, in which case the redirect response is the result.
+func isRedirectStop(err error) bool {
+	switch err {
+	case ErrRedirLocalhost, ErrTooManyRedirects, ErrRedirCrossHost, ErrRedirCrossScheme:
+		return true
+	}
+	return false
+}
+
+// checkRedirectPolicy applies --redirect-same-host and
+// --redirect-same-scheme to a redirect to req from the initial request.
+func (scan *scan) checkRedirectPolicy(req *http.Request, via []*http.Request) error {
+	if len(via) == 0 {
+		return nil
+	}
+	initial := via[0].URL
+	if scan.scanner.config.RedirectSameHost && req.URL.Hostname() != initial.Hostname() {
+		return ErrRedirCrossHost
+	}
+	if scan.scanner.config.RedirectSameScheme && req.URL.Scheme != initial.Scheme {
+		return ErrRedirCrossScheme
+	}
+	return nil
+}
+
+// recordRemoteAddr records the address a connection to addr was made to.
+func (scan *scan) recordRemoteAddr(addr string, conn net.Conn) {
+	if scan.remoteAddrs == nil {
+		scan.remoteAddrs = make(map[string]string)
+	}
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		scan.remoteAddrs[addr] = host
+	}
+}
+
+// redirectChain returns the hops of the redirect chain ending in the final
+// response, or nil if no redirect was received.
+func (scan *scan) redirectChain(final *http.Response, err error) []*RedirectHop {
+	if final == nil || (len(scan.results.RedirectResponseChain) == 0 && !isRedirectStop(err)) {
+		return nil
+	}
+	responses := scan.results.RedirectResponseChain
+	// With ErrTooManyRedirects, the final response is already in the chain.
+	if len(responses) == 0 || responses[len(responses)-1] != final {
+		responses = append(responses[:len(responses):len(responses)], final)
+	}
+	var ret []*RedirectHop
+	for _, res := range responses {
+		hop := &RedirectHop{
+			StatusCode: res.StatusCode,
+			Location:   res.Header.Get("Location"),
+			Headers:    res.Header,
+		}
+		if res.Request != nil && res.Request.URL != nil {
+			u := res.Request.URL
+			hop.URL = u.String()
+			port := u.Port()
+			if port == "" {
+				port = strconv.Itoa(int(protoToPort[u.Scheme]))
+			}
+			hop.IP = scan.remoteAddrs[net.JoinHostPort(u.Hostname(), port)]
+		}
+		ret = append(ret, hop)
+	}
+	if isRedirectStop(err) {
+		ret[len(ret)-1].NotFollowed = err.Error()
+	}
+	return ret
+}
+
+// omitRedirectTLSLogs drops the TLS logs of the requests after the first,
+// for --omit-redirect-tls-logs.
+func (scan *scan) omitRedirectTLSLogs() {
+	chain := scan.results.RedirectResponseChain
+	responses := append(chain[:len(chain):len(chain)], scan.results.Response)
+	for _, res := range responses[1:] {
+		if res != nil && res.Request != nil && res != responses[0] {
+			res.Request.TLSLog = nil
+		}
+	}
+}
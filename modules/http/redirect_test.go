@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// resetReadLimit sets the default read limit, which TestReadLimitHTTP
+// lowers, for the test, and restores it after.
+func resetReadLimit(t *testing.T) {
+	limit := zgrab2.DefaultBytesReadLimit
+	zgrab2.DefaultBytesReadLimit = 256 * 1024 * 1024
+	t.Cleanup(func() { zgrab2.DefaultBytesReadLimit = limit })
+}
+
+func TestRedirectChain(t *testing.T) {
+	resetReadLimit(t)
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer tlsServer.Close()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/next", http.StatusMovedPermanently)
+		case "/next":
+			http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+"/other", http.StatusFound)
+		case "/other":
+			http.Redirect(w, r, tlsServer.URL+"/", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	scanner.config.FollowLocalhostRedirects = true
+	scanner.config.MaxRedirects = 5
+	scanner.config.RedirectSameHost = true
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	redirects := result.(*Results).Redirects
+	if len(redirects) != 2 {
+		t.Fatalf("unexpected redirects %+v", redirects)
+	}
+	if redirects[0].URL != server.URL+"/" || redirects[0].StatusCode != 301 || redirects[0].Location != "/next" || redirects[0].IP != "127.0.0.1" {
+		t.Errorf("unexpected first hop %+v", redirects[0])
+	}
+	if redirects[1].StatusCode != 302 || redirects[1].NotFollowed != ErrRedirCrossHost.Error() || !strings.Contains(redirects[1].Location, "localhost") {
+		t.Errorf("unexpected last hop %+v", redirects[1])
+	}
+
+	scanner.config.RedirectSameHost = false
+	scanner.config.RedirectSameScheme = true
+	_, result, _ = scanner.Scan(target)
+	redirects = result.(*Results).Redirects
+	if len(redirects) != 3 || redirects[2].URL != strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+"/other" || redirects[2].NotFollowed != ErrRedirCrossScheme.Error() {
+		t.Errorf("unexpected redirects %+v", redirects)
+	}
+
+	scanner.config.RedirectSameScheme = false
+	_, result, _ = scanner.Scan(target)
+	redirects = result.(*Results).Redirects
+	if len(redirects) != 4 {
+		t.Fatalf("unexpected redirects %+v", redirects)
+	}
+	if last := redirects[3]; last.StatusCode != 200 || last.NotFollowed != "" || result.(*Results).Response.BodyText != "secure" {
+		t.Errorf("unexpected redirects %+v", redirects)
+	}
+	if result.(*Results).Response.Request.TLSLog == nil {
+		t.Error("no TLS log for the https hop")
+	}
+
+	scanner.config.OmitRedirectTLSLogs = true
+	_, result, _ = scanner.Scan(target)
+	if result.(*Results).Response.Request.TLSLog != nil {
+		t.Error("TLS log of the https hop not omitted")
+	}
+}
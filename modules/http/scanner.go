@@ -13,9 +13,11 @@ import (
 	"encoding/base64"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Positive-Engineer/zgrab2"
@@ -42,7 +44,8 @@ var (
 type Flags struct {
 	zgrab2.BaseFlags
 	zgrab2.TLSFlags
-	Method         string `long:"method" default:"GET" description:"Set HTTP request method type"`
+	zgrab2.InventoryFlags
+	Method         string `long:"method" default:"GET" description:"Set HTTP request method type (any token, e.g. POST, PUT, PROPFIND)"`
 	Endpoint       string `long:"endpoint" default:"/" description:"Send an HTTP request to an endpoint"`
 	UserAgent      string `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
 	RetryHTTPS     bool   `long:"retry-https" description:"If the initial request fails, reconnect and try with HTTPS."`
@@ -51,6 +54,18 @@ type Flags struct {
 	SingleContains string `long:"single-contain" description:"search bytes in response, set in base64."`
 	OnlyBASE64     bool   `long:"only-base64" description:"Output banner response from host only in base64."`
 
+	// MaxBodySize, MaxBodyTime and BodyHashOnly stream the body through
+	// SHA-256 without buffering more than --max-size of it.
+	MaxBodySize  int           `long:"max-body-size" description:"Read up to this many kilobytes of the body into the SHA-256, keeping only the first --max-size kilobytes (0 = --max-size)"`
+	MaxBodyTime  time.Duration `long:"max-body-time" description:"Stop reading the body after this long (0 = only --timeout applies)"`
+	BodyHashOnly bool          `long:"body-hash-only" description:"Only record the SHA-256 of the body (up to --max-body-size), not the body itself"`
+
+	// Body, BodyFile and ContentType describe the request body, e.g. for
+	// POST probes of SOAP or JSON-RPC endpoints.
+	Body        string `long:"body" description:"Send this request body"`
+	BodyFile    string `long:"body-file" description:"Send the contents of this file as the request body"`
+	ContentType string `long:"content-type" description:"Set the Content-Type header of the request"`
+
 	// FollowLocalhostRedirects overrides the default behavior to return
 	// ErrRedirLocalhost whenever a redirect points to localhost.
 	FollowLocalhostRedirects bool `long:"follow-localhost-redirects" description:"Follow HTTP redirects to localhost"`
@@ -62,7 +77,60 @@ type Flags struct {
 	// RedirectsSucceed causes the ErrTooManRedirects error to be suppressed
 	RedirectsSucceed bool `long:"redirects-succeed" description:"Redirects are always a success, even if max-redirects is exceeded"`
 
+	// RedirectSameHost and RedirectSameScheme stop at redirects leaving the
+	// initial host or scheme, keeping the redirect as the final response.
+	RedirectSameHost   bool `long:"redirect-same-host" description:"Don't follow redirects to a host other than the initial one"`
+	RedirectSameScheme bool `long:"redirect-same-scheme" description:"Don't follow redirects that change the scheme (http to https or back)"`
+
+	// OmitRedirectTLSLogs keeps only the TLS log of the initial request.
+	OmitRedirectTLSLogs bool `long:"omit-redirect-tls-logs" description:"Don't record the TLS handshake logs of requests made while following redirects"`
+
 	OverrideSH bool `long:"override-sig-hash" description:"Override the default SignatureAndHashes TLS option with more expansive default"`
+
+	// SmugglingProbes sends the CL.TE / TE.CL timing probes after the
+	// main request. Like the other follow-up probes, they are only sent if
+	// the main request got a response: the indicators compare the probes
+	// with a baseline, which a target that does not answer HTTP lacks.
+	SmugglingProbes  bool          `long:"smuggling-probes" description:"Send CL.TE / TE.CL request smuggling timing probes (each on a new connection) and report indicators, if the main request succeeded"`
+	SmugglingTimeout time.Duration `long:"smuggling-timeout" default:"5s" description:"How long to wait for a response to each smuggling probe"`
+
+	// ContextHost uses a hostname recorded in the target context by an
+	// earlier scanner (e.g. tls) for targets without a domain.
+	ContextHost bool `long:"context-host" description:"For targets without a domain, send the request for a hostname learned by an earlier module (e.g. from the tls certificate)"`
+
+	// HTTP2 repeats the request over HTTP/2 on a new connection.
+	HTTP2 bool `long:"http2" description:"Repeat the request over HTTP/2 (h2 via ALPN with --use-https, h2c upgrade otherwise) and record SETTINGS, frames and the response"`
+
+	// FetchFavicon downloads the page's icon after the main request.
+	FetchFavicon bool `long:"fetch-favicon" description:"Download the icon referenced in the page (or /favicon.ico) and record its Shodan MurmurHash3 and MD5"`
+
+	// Fingerprint matches the final response against a technology ruleset.
+	Fingerprint      bool   `long:"fingerprint" description:"Identify technologies from the response headers, cookies, scripts and body (Wappalyzer rules)"`
+	FingerprintRules string `long:"fingerprint-rules" description:"Wappalyzer-format JSON ruleset to use instead of the bundled one (implies --fingerprint)"`
+
+	// SequenceFile is a YAML or JSON file with a scripted series of requests.
+	SequenceFile string `long:"sequence" description:"YAML/JSON file with a sequence of requests (method, path, headers, body, expected status) to run per target, keeping cookies between steps"`
+
+	// DiscoverPaths is the number of paths from robots.txt and the sitemaps
+	// to fetch after the main request.
+	DiscoverPaths int `long:"discover-paths" description:"Fetch robots.txt and sitemap.xml, then up to this many of the paths they list on the target's host (0 = disabled)"`
+
+	// AuthUser and AuthPass are used to answer a 401 challenge.
+	AuthUser string `long:"auth-user" description:"Answer a 401 challenge with this user (DOMAIN\\user for NTLM)"`
+	AuthPass string `long:"auth-pass" description:"Password for --auth-user"`
+	AuthType string `long:"auth-type" default:"auto" description:"Challenge to answer with --auth-user: auto (the strongest offered), basic, digest, ntlm or negotiate"`
+
+	// ParseHTML extracts the title and other fields from the body.
+	ParseHTML bool `long:"parse-html" description:"Record the page title, meta generator, canonical link, charset, body SHA-256 and SimHash"`
+
+	// CookieJar keeps the cookies set during the scan of a target.
+	CookieJar bool `long:"cookie-jar" description:"Keep cookies across the redirect chain, --extra-endpoints and the follow-up requests on the same target, and record the final jar"`
+
+	// ExtraEndpoints are requested after the main request.
+	ExtraEndpoints string `long:"extra-endpoints" description:"Comma-separated further endpoints to request on the target, in order, after --endpoint"`
+
+	// VHostsFile lists virtual hosts to request from each target IP.
+	VHostsFile string `long:"vhosts-file" description:"File with one hostname per line; each target IP is also requested once per hostname, sent as Host header and SNI"`
 }
 
 // A Results object is returned by the HTTP module's Scanner.Scan()
@@ -74,6 +142,52 @@ type Results struct {
 	// RedirectResponseChain is non-empty is the scanner follows a redirect.
 	// It contains all redirect response prior to the final response.
 	RedirectResponseChain []*http.Response `json:"redirect_response_chain,omitempty"`
+
+	// Body describes how much of the body was read, with --max-body-size,
+	// --max-body-time or --body-hash-only.
+	Body *BodyInfo `json:"body_info,omitempty"`
+
+	// Redirects summarizes the redirect chain, including the final
+	// response, if a redirect was received.
+	Redirects []*RedirectHop `json:"redirects,omitempty"`
+
+	// Smuggling holds the results of --smuggling-probes.
+	Smuggling *SmugglingResults `json:"smuggling,omitempty"`
+
+	// HTTP2 holds the results of --http2.
+	HTTP2 *HTTP2Results `json:"http2,omitempty"`
+
+	// Favicon holds the results of --fetch-favicon.
+	Favicon *FaviconResult `json:"favicon,omitempty"`
+
+	// HTML holds the fields parsed by --parse-html.
+	HTML *HTMLInfo `json:"html,omitempty"`
+
+	// Inventory lists the entries of a directory listing served as the
+	// final response, with --inventory.
+	Inventory *zgrab2.Inventory `json:"inventory,omitempty"`
+
+	// Technologies are the technologies identified by --fingerprint.
+	Technologies []Technology `json:"technologies,omitempty"`
+
+	// Sequence holds the results of --sequence.
+	Sequence *SequenceResults `json:"sequence,omitempty"`
+
+	// Discovery holds the results of --discover-paths.
+	Discovery *DiscoveryResults `json:"discovery,omitempty"`
+
+	// Auth holds the WWW-Authenticate challenges of the response and the
+	// result of --auth-user.
+	Auth *AuthResults `json:"auth,omitempty"`
+
+	// Endpoints holds the results of --extra-endpoints.
+	Endpoints []*EndpointResult `json:"endpoints,omitempty"`
+
+	// CookieJar holds the cookies set during the scan, with --cookie-jar.
+	CookieJar []*JarCookie `json:"cookie_jar,omitempty"`
+
+	// VHosts holds the results of --vhosts-file, one per hostname.
+	VHosts []*VHostResult `json:"vhosts,omitempty"`
 }
 
 // Module is an implementation of the zgrab2.Module interface.
@@ -82,7 +196,12 @@ type Module struct {
 
 // Scanner is the implementation of the zgrab2.Scanner interface.
 type Scanner struct {
-	config *Flags
+	config       *Flags
+	fingerprints *fingerprinter
+	sequence     *Sequence
+	endpoints    []string
+	vhosts       []string
+	body         []byte
 }
 
 // scan holds the state for a single scan. This may entail multiple connections.
@@ -96,6 +215,13 @@ type scan struct {
 	results        Results
 	url            string
 	globalDeadline time.Time
+
+	// remoteAddrs maps the addresses dialed to the IPs connected to.
+	remoteAddrs map[string]string
+
+	// jar is the cookie jar shared by the requests to the target, with
+	// --cookie-jar.
+	jar *recordingJar
 }
 
 // NewFlags returns an empty Flags object.
@@ -108,6 +234,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Results)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Send an HTTP request and read the response, optionally following redirects."
@@ -115,6 +246,26 @@ func (module *Module) Description() string {
 
 // Validate performs any needed validation on the arguments
 func (flags *Flags) Validate(args []string) error {
+	if flags.MaxBodySize < 0 || flags.MaxBodyTime < 0 {
+		log.Error("--max-body-size and --max-body-time must not be negative")
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.Body != "" && flags.BodyFile != "" {
+		log.Error("Cannot set both --body and --body-file")
+		return zgrab2.ErrInvalidArguments
+	}
+	validAuthType := false
+	for _, authType := range authTypes {
+		validAuthType = validAuthType || strings.EqualFold(flags.AuthType, authType)
+	}
+	if flags.AuthType != "" && !validAuthType {
+		log.Errorf("Invalid --auth-type %s (must be one of %s)", flags.AuthType, strings.Join(authTypes, ", "))
+		return zgrab2.ErrInvalidArguments
+	}
+	if err := flags.InventoryFlags.Validate(); err != nil {
+		log.Error(err)
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
@@ -132,6 +283,40 @@ func (s *Scanner) Protocol() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	fl, _ := flags.(*Flags)
 	scanner.config = fl
+	scanner.body = []byte(fl.Body)
+	if fl.BodyFile != "" {
+		body, err := ioutil.ReadFile(fl.BodyFile)
+		if err != nil {
+			return err
+		}
+		scanner.body = body
+	}
+	if fl.Fingerprint || fl.FingerprintRules != "" {
+		fingerprints, err := loadFingerprints(fl.FingerprintRules)
+		if err != nil {
+			return err
+		}
+		scanner.fingerprints = fingerprints
+	}
+	if fl.SequenceFile != "" {
+		sequence, err := loadSequence(fl.SequenceFile)
+		if err != nil {
+			return err
+		}
+		scanner.sequence = sequence
+	}
+	for _, endpoint := range strings.Split(fl.ExtraEndpoints, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			scanner.endpoints = append(scanner.endpoints, endpoint)
+		}
+	}
+	if fl.VHostsFile != "" {
+		vhosts, err := loadVHosts(fl.VHostsFile)
+		if err != nil {
+			return err
+		}
+		scanner.vhosts = vhosts
+	}
 	return nil
 }
 
@@ -175,6 +360,7 @@ func (scan *scan) withDeadlineContext(ctx context.Context) context.Context {
 // add the connection to the list of connections to be cleaned up.
 func (scan *scan) dialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
 	dialer := zgrab2.GetTimeoutConnectionDialer(scan.scanner.config.Timeout)
+	dialer.Target = scan.target
 
 	switch network {
 	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
@@ -204,42 +390,52 @@ func (scan *scan) dialContext(ctx context.Context, network string, addr string)
 		}
 	}
 
-	timeoutContext, _ := context.WithTimeout(context.Background(), scan.scanner.config.Timeout)
+	timeoutContext, cancel := context.WithTimeout(ctx, scan.scanner.config.Timeout)
+	defer cancel()
 
 	conn, err := dialer.DialContext(scan.withDeadlineContext(timeoutContext), network, addr)
 	if err != nil {
 		return nil, err
 	}
 	scan.connections = append(scan.connections, conn)
+	scan.recordRemoteAddr(addr, conn)
 	return conn, nil
 }
 
 // getTLSDialer returns a Dial function that connects using the
 // zgrab2.GetTLSConnection()
+// tlsConfig returns the TLS configuration of the connections to t.
+func (scanner *Scanner) tlsConfig(t *zgrab2.ScanTarget) (*tls.Config, error) {
+	cfg, err := scanner.config.TLSFlags.GetTLSConfigForTarget(t)
+	if err != nil {
+		return nil, err
+	}
+	if scanner.config.OverrideSH {
+		cfg.SignatureAndHashes = []tls.SigAndHash{
+			{0x01, 0x04}, // rsa, sha256
+			{0x03, 0x04}, // ecdsa, sha256
+			{0x01, 0x02}, // rsa, sha1
+			{0x03, 0x02}, // ecdsa, sha1
+			{0x01, 0x04}, // rsa, sha256
+			{0x01, 0x05}, // rsa, sha384
+			{0x01, 0x06}, // rsa, sha512
+		}
+	}
+	return cfg, nil
+}
+
 func (scan *scan) getTLSDialer(t *zgrab2.ScanTarget) func(net, addr string) (net.Conn, error) {
 	return func(net, addr string) (net.Conn, error) {
-		outer, err := scan.dialContext(context.Background(), net, addr)
+		outer, err := scan.dialContext(t.Ctx(), net, addr)
 		if err != nil {
 			return nil, err
 		}
 
-		cfg, err := scan.scanner.config.TLSFlags.GetTLSConfigForTarget(t)
+		cfg, err := scan.scanner.tlsConfig(t)
 		if err != nil {
 			return nil, err
 		}
 
-		if scan.scanner.config.OverrideSH {
-			cfg.SignatureAndHashes = []tls.SigAndHash{
-				{0x01, 0x04}, // rsa, sha256
-				{0x03, 0x04}, // ecdsa, sha256
-				{0x01, 0x02}, // rsa, sha1
-				{0x03, 0x02}, // ecdsa, sha1
-				{0x01, 0x04}, // rsa, sha256
-				{0x01, 0x05}, // rsa, sha384
-				{0x01, 0x06}, // rsa, sha512
-			}
-		}
-
 		tlsConn := scan.scanner.config.TLSFlags.GetWrappedConnection(outer, cfg)
 
 		// lib/http/transport.go fills in the TLSLog in the http.Request instance(s)
@@ -276,6 +472,9 @@ func (scan *scan) getCheckRedirect() func(*http.Request, *http.Response, []*http
 		if !scan.scanner.config.FollowLocalhostRedirects && redirectsToLocalhost(req.URL.Hostname()) {
 			return ErrRedirLocalhost
 		}
+		if err := scan.checkRedirectPolicy(req, via); err != nil {
+			return err
+		}
 		scan.results.RedirectResponseChain = append(scan.results.RedirectResponseChain, res)
 		b := new(bytes.Buffer)
 		maxReadLen := int64(scan.scanner.config.MaxSize) * 1024
@@ -358,15 +557,59 @@ func (scanner *Scanner) newHTTPScan(t *zgrab2.ScanTarget, useHTTPS bool) *scan {
 	return &ret
 }
 
+// newRequest returns the configured request for the scan URL.
+func (scan *scan) newRequest() (*http.Request, error) {
+	var body io.Reader
+	if len(scan.scanner.body) > 0 {
+		body = bytes.NewReader(scan.scanner.body)
+	}
+	request, err := http.NewRequest(scan.scanner.config.Method, scan.url, body)
+	if err != nil {
+		return nil, err
+	}
+	// TODO: Headers from input?
+	request.Header.Set("Accept", "*/*")
+	if scan.scanner.config.ContentType != "" {
+		request.Header.Set("Content-Type", scan.scanner.config.ContentType)
+	}
+	return request, nil
+}
+
+// Preview implements zgrab2.ScannerPreview: the scan sends the ClientHello
+// with --use-https, then the first request. The requests of the other
+// options depend on the responses, and are not included.
+func (scanner *Scanner) Preview(t zgrab2.ScanTarget) ([]*zgrab2.ProbePreview, error) {
+	var ret []*zgrab2.ProbePreview
+	if scanner.config.UseHTTPS {
+		cfg, err := scanner.tlsConfig(&t)
+		if err != nil {
+			return nil, err
+		}
+		hello, err := zgrab2.PreviewClientHello(cfg)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, hello)
+	}
+	scan := scanner.newHTTPScan(&t, scanner.config.UseHTTPS)
+	request, err := scan.newRequest()
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", scanner.config.UserAgent)
+	var buf bytes.Buffer
+	if err := request.Write(&buf); err != nil {
+		return nil, err
+	}
+	return append(ret, &zgrab2.ProbePreview{Name: "HTTP request", Text: buf.String(), Data: buf.Bytes()}), nil
+}
+
 // Grab performs the HTTP scan -- implementation taken from zgrab/zlib/grabber.go
 func (scan *scan) Grab() *zgrab2.ScanError {
-	// TODO: Allow body?
-	request, err := http.NewRequest(scan.scanner.config.Method, scan.url, nil)
+	request, err := scan.newRequest()
 	if err != nil {
 		return zgrab2.NewScanError(zgrab2.SCAN_UNKNOWN_ERROR, err)
 	}
-	// TODO: Headers from input?
-	request.Header.Set("Accept", "*/*")
 	resp, err := scan.client.Do(request)
 	if resp != nil && resp.Body != nil {
 		defer resp.Body.Close()
@@ -377,9 +620,13 @@ func (scan *scan) Grab() *zgrab2.ScanError {
 			err = urlError.Err
 		}
 	}
+	scan.results.Redirects = scan.redirectChain(resp, err)
+	if scan.scanner.config.OmitRedirectTLSLogs {
+		scan.omitRedirectTLSLogs()
+	}
 	if err != nil {
 		switch err {
-		case ErrRedirLocalhost:
+		case ErrRedirLocalhost, ErrRedirCrossHost, ErrRedirCrossScheme:
 			break
 		case ErrTooManyRedirects:
 			if scan.scanner.config.RedirectsSucceed {
@@ -393,11 +640,20 @@ func (scan *scan) Grab() *zgrab2.ScanError {
 
 	buf := new(bytes.Buffer)
 	maxReadLen := int64(scan.scanner.config.MaxSize) * 1024
-	readLen := maxReadLen
-	if resp.ContentLength >= 0 && resp.ContentLength < maxReadLen {
-		readLen = resp.ContentLength
+	var bodySHA256 []byte
+	if config := scan.scanner.config; config.MaxBodySize > 0 || config.MaxBodyTime > 0 || config.BodyHashOnly {
+		keep := maxReadLen
+		if config.BodyHashOnly {
+			keep = 0
+		}
+		bodySHA256, scan.results.Body = scan.streamBody(resp.Body, buf, keep)
+	} else {
+		readLen := maxReadLen
+		if resp.ContentLength >= 0 && resp.ContentLength < maxReadLen {
+			readLen = resp.ContentLength
+		}
+		io.CopyN(buf, resp.Body, readLen)
 	}
-	io.CopyN(buf, resp.Body, readLen)
 	bufAsString := buf.String()
 
 	// do best effort attempt to determine the response's encoding
@@ -422,6 +678,9 @@ func (scan *scan) Grab() *zgrab2.ScanError {
 		m.Write(buf.Bytes())
 		scan.results.Response.BodySHA256 = m.Sum(nil)
 	}
+	if bodySHA256 != nil {
+		scan.results.Response.BodySHA256 = bodySHA256
+	}
 
 	return nil
 }
@@ -430,9 +689,56 @@ func (scan *scan) Grab() *zgrab2.ScanError {
 // the target. If the scanner is configured to follow redirects, this may entail
 // multiple TCP connections to hosts other than target.
 func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	if scanner.config.ContextHost && t.Domain == "" && t.IP != nil {
+		t.Domain = contextHostname(t.Context)
+	}
 	scan := scanner.newHTTPScan(&t, scanner.config.UseHTTPS)
 	defer scan.Cleanup()
+	if scanner.config.CookieJar {
+		scan.jar = newRecordingJar()
+		scan.client.Jar = scan.jar
+	}
 	err := scan.Grab()
+	if err == nil {
+		recordContext(t.Context, scan.results.Response)
+	}
+	if err == nil {
+		scan.results.Auth = scan.probeAuth(scanner.config.UseHTTPS)
+	}
+	if err == nil && scanner.config.SmugglingProbes {
+		scan.results.Smuggling = scan.probeSmuggling(scanner.config.UseHTTPS)
+	}
+	if err == nil && scanner.config.HTTP2 {
+		scan.results.HTTP2 = scan.probeHTTP2(scanner.config.UseHTTPS)
+	}
+	if err == nil && scanner.config.FetchFavicon {
+		scan.results.Favicon = scan.fetchFavicon(scanner.config.UseHTTPS)
+	}
+	if err == nil && scanner.config.ParseHTML {
+		scan.results.HTML = parseHTML(scan.results.Response)
+	}
+	if err == nil && scanner.config.Inventory {
+		scan.results.Inventory = listDirectory(scan.results.Response, &scanner.config.InventoryFlags)
+	}
+	if err == nil && scanner.fingerprints != nil {
+		scan.results.Technologies = scanner.fingerprints.identify(scan.results.Response)
+	}
+	if err == nil && scanner.sequence != nil {
+		scan.results.Sequence = scan.runSequence(scanner.sequence, scanner.config.UseHTTPS)
+	}
+	if err == nil && scanner.config.DiscoverPaths > 0 {
+		scan.results.Discovery = scan.discoverPaths(scanner.config.UseHTTPS, scanner.config.DiscoverPaths)
+	}
+	if err == nil && len(scanner.endpoints) > 0 {
+		scan.results.Endpoints = scan.fetchEndpoints(scanner.config.UseHTTPS, scanner.endpoints)
+	}
+	if scan.jar != nil {
+		scan.results.CookieJar = scan.jar.list()
+	}
+	if len(scanner.vhosts) > 0 {
+		// The virtual hosts may answer even if the bare IP does not.
+		scan.results.VHosts = scanner.scanVHosts(&t, scanner.config.UseHTTPS)
+	}
 	if err != nil {
 		if scanner.config.RetryHTTPS && !scanner.config.UseHTTPS {
 			scan.Cleanup()
@@ -0,0 +1,225 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+	"github.com/Positive-Engineer/zgrab2/lib/http/cookiejar"
+	"gopkg.in/yaml.v2"
+)
+
+// Sequence is a scripted series of requests, loaded from the YAML (or JSON)
+// file given in --sequence. The steps run in order on one client, which
+// keeps the cookies set by earlier responses.
+type Sequence struct {
+	Steps []*SequenceStep `yaml:"steps"`
+}
+
+// SequenceStep is one request of a Sequence. Path, Headers and Body may
+// refer to values extracted by earlier steps as {{name}}.
+type SequenceStep struct {
+	// Name identifies the step in the results.
+	Name string `yaml:"name"`
+
+	// Method defaults to GET.
+	Method string `yaml:"method"`
+
+	// Path is resolved against the target URL; it may also be an absolute
+	// URL.
+	Path string `yaml:"path"`
+
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+
+	// ExpectStatus, if set, lists the acceptable status codes.
+	ExpectStatus []int `yaml:"expect_status"`
+
+	// ExpectBody, if set, is a regular expression the body must match.
+	ExpectBody string `yaml:"expect_body"`
+
+	// Extract maps names to regular expressions; the first group (or the
+	// whole match) in the headers or body is stored under the name.
+	Extract map[string]string `yaml:"extract"`
+
+	expectBody *regexp.Regexp
+	extract    map[string]*regexp.Regexp
+}
+
+// SequenceStepResult is the outcome of one SequenceStep.
+type SequenceStepResult struct {
+	Name     string            `json:"name,omitempty"`
+	Method   string            `json:"method"`
+	URL      string            `json:"url"`
+	Response *http.Response    `json:"response,omitempty"`
+	Matched  bool              `json:"matched"`
+	Values   map[string]string `json:"values,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// SequenceResults holds the results of --sequence.
+type SequenceResults struct {
+	Steps []*SequenceStepResult `json:"steps"`
+
+	// Complete is true if every step ran and matched its expectations.
+	Complete bool `json:"complete"`
+}
+
+var sequenceVariableRegex = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// loadSequence reads and validates a sequence file.
+func loadSequence(path string) (*Sequence, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret Sequence
+	if err := yaml.UnmarshalStrict(data, &ret); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(ret.Steps) == 0 {
+		return nil, fmt.Errorf("%s: no steps", path)
+	}
+	for i, step := range ret.Steps {
+		if step.Method == "" {
+			step.Method = "GET"
+		}
+		if step.ExpectBody != "" {
+			if step.expectBody, err = regexp.Compile(step.ExpectBody); err != nil {
+				return nil, fmt.Errorf("%s: step %d: expect_body: %v", path, i+1, err)
+			}
+		}
+		step.extract = make(map[string]*regexp.Regexp, len(step.Extract))
+		for name, expr := range step.Extract {
+			if step.extract[name], err = regexp.Compile(expr); err != nil {
+				return nil, fmt.Errorf("%s: step %d: extract %s: %v", path, i+1, name, err)
+			}
+		}
+	}
+	return &ret, nil
+}
+
+// runSequence runs the sequence against the target on a new client with a
+// cookie jar (the one of --cookie-jar if set), stopping at the first step
+// that fails.
+func (scan *scan) runSequence(sequence *Sequence, useHTTPS bool) *SequenceResults {
+	run := scan.newFollowUpScan(useHTTPS)
+	defer run.Cleanup()
+	if run.client.Jar == nil {
+		run.client.Jar, _ = cookiejar.New(nil)
+	}
+	base, err := url.Parse(run.url)
+	if err != nil {
+		return &SequenceResults{Steps: []*SequenceStepResult{{Error: err.Error()}}}
+	}
+	values := make(map[string]string)
+	expand := func(s string) string {
+		return sequenceVariableRegex.ReplaceAllStringFunc(s, func(v string) string {
+			return values[sequenceVariableRegex.FindStringSubmatch(v)[1]]
+		})
+	}
+	ret := new(SequenceResults)
+	for _, step := range sequence.Steps {
+		result := &SequenceStepResult{Name: step.Name, Method: step.Method}
+		ret.Steps = append(ret.Steps, result)
+		if err := run.runStep(step, base, expand, result); err != nil {
+			result.Error = err.Error()
+			return ret
+		}
+		for name, value := range result.Values {
+			values[name] = value
+		}
+		if !result.Matched {
+			return ret
+		}
+	}
+	ret.Complete = true
+	return ret
+}
+
+func (scan *scan) runStep(step *SequenceStep, base *url.URL, expand func(string) string, result *SequenceStepResult) error {
+	ref, err := url.Parse(expand(step.Path))
+	if err != nil {
+		return err
+	}
+	result.URL = base.ResolveReference(ref).String()
+	var body io.Reader
+	if step.Body != "" {
+		body = strings.NewReader(expand(step.Body))
+	}
+	request, err := http.NewRequest(step.Method, result.URL, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "*/*")
+	for name, value := range step.Headers {
+		request.Header.Set(name, expand(value))
+	}
+	resp, err := scan.client.Do(request)
+	if resp != nil && resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		if urlError, ok := err.(*url.Error); ok {
+			err = urlError.Err
+		}
+		// As in Grab, a redirect that is not followed leaves the redirect
+		// response as the result of the step.
+		if resp == nil || !isRedirectStop(err) {
+			return err
+		}
+	}
+	result.Response = resp
+	scan.readBody(resp)
+
+	result.Matched = step.expectBody == nil || step.expectBody.MatchString(resp.BodyText)
+	if len(step.ExpectStatus) > 0 {
+		statusMatched := false
+		for _, status := range step.ExpectStatus {
+			statusMatched = statusMatched || status == resp.StatusCode
+		}
+		result.Matched = result.Matched && statusMatched
+	}
+	for name, regex := range step.extract {
+		match := regex.FindStringSubmatch(resp.BodyText)
+		for header, headerValues := range resp.Header {
+			for _, value := range headerValues {
+				if match == nil {
+					match = regex.FindStringSubmatch(header + ": " + value)
+				}
+			}
+		}
+		if match == nil {
+			continue
+		}
+		if result.Values == nil {
+			result.Values = make(map[string]string)
+		}
+		if len(match) > 1 {
+			result.Values[name] = match[1]
+		} else {
+			result.Values[name] = match[0]
+		}
+	}
+	return nil
+}
+
+// readBody reads up to --max-size of the body of a follow-up response into
+// BodyText, BodyBase64 and BodySHA256.
+func (scan *scan) readBody(resp *http.Response) {
+	b := new(bytes.Buffer)
+	io.CopyN(b, resp.Body, int64(scan.scanner.config.MaxSize)*1024)
+	resp.BodyText = b.String()
+	if len(resp.BodyText) > 0 {
+		resp.BodyBase64 = base64.StdEncoding.EncodeToString(b.Bytes())
+		sum := sha256.Sum256(b.Bytes())
+		resp.BodySHA256 = sum[:]
+	}
+}
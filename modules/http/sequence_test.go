@@ -0,0 +1,95 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+const testSequence = `
+steps:
+  - name: login-page
+    path: /login
+    expect_status: [200]
+    expect_body: '<form[^>]+action="/login"'
+    extract:
+      csrf: 'name="csrf" value="([^"]+)"'
+  - name: login
+    method: POST
+    path: /login
+    headers:
+      Content-Type: application/x-www-form-urlencoded
+    body: 'user=admin&password=admin&csrf={{csrf}}'
+    expect_status: [302]
+  - name: dashboard
+    path: /dashboard
+    expect_status: [200]
+    expect_body: Welcome
+`
+
+func TestSequence(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login" && r.Method == "GET":
+			http.SetCookie(w, &http.Cookie{Name: "pre", Value: "1", Path: "/"})
+			w.Write([]byte(`<form method="post" action="/login"><input name="csrf" value="tok123"></form>`))
+		case r.URL.Path == "/login" && r.Method == "POST":
+			if c, err := r.Cookie("pre"); err != nil || c.Value != "1" || r.FormValue("csrf") != "tok123" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s", Path: "/"})
+			w.Header().Set("Location", "/elsewhere")
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == "/dashboard":
+			if _, err := r.Cookie("session"); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("Welcome, admin"))
+		default:
+			w.Write([]byte("index"))
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "sequence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sequence.yaml")
+	if err := ioutil.WriteFile(path, []byte(testSequence), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	// Don't follow the redirect after the login so its status is checked.
+	scanner.config.MaxRedirects = 0
+	scanner.config.RedirectsSucceed = true
+	if scanner.sequence, err = loadSequence(path); err != nil {
+		t.Fatal(err)
+	}
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	sequence := result.(*Results).Sequence
+	if sequence == nil || len(sequence.Steps) != 3 {
+		t.Fatalf("unexpected sequence results %+v", sequence)
+	}
+	for _, step := range sequence.Steps {
+		if !step.Matched || step.Error != "" {
+			t.Errorf("step %s: %+v", step.Name, step)
+		}
+	}
+	if !sequence.Complete || sequence.Steps[0].Values["csrf"] != "tok123" {
+		t.Errorf("unexpected sequence results %+v", sequence)
+	}
+}
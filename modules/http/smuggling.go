@@ -0,0 +1,135 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// SmugglingProbe is the outcome of a single request smuggling probe.
+type SmugglingProbe struct {
+	// StatusCode is the status of the response, or 0 if none was received.
+	StatusCode int `json:"status_code,omitempty"`
+
+	// ElapsedMS is the time from sending the request to receiving the response
+	// headers (or giving up).
+	ElapsedMS int64 `json:"elapsed_ms"`
+
+	// TimedOut is true if no response arrived within --smuggling-timeout.
+	TimedOut bool `json:"timed_out"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// SmugglingResults holds the results of the --smuggling-probes requests. The
+// probes only look for the timing / response discrepancies caused by
+// front-end and back-end servers disagreeing on the request length; nothing
+// is smuggled.
+type SmugglingResults struct {
+	// Baseline is a well-formed POST request.
+	Baseline *SmugglingProbe `json:"baseline"`
+
+	// CLTE is a request that stalls a back-end honouring Transfer-Encoding
+	// behind a front-end honouring Content-Length.
+	CLTE *SmugglingProbe `json:"cl_te"`
+
+	// TECL is a request that stalls a back-end honouring Content-Length
+	// behind a front-end honouring Transfer-Encoding.
+	TECL *SmugglingProbe `json:"te_cl,omitempty"`
+
+	// CLTEIndicator is true if the CL.TE probe timed out while the baseline
+	// did not.
+	CLTEIndicator bool `json:"cl_te_indicator"`
+
+	// TECLIndicator is true if the TE.CL probe timed out while the baseline
+	// and the CL.TE probe did not.
+	TECLIndicator bool `json:"te_cl_indicator"`
+}
+
+var httpStatusLineRegex = regexp.MustCompile(`^HTTP/\d\.\d (\d{3})`)
+
+// smugglingRequest returns a POST request with the given extra headers and
+// body.
+func smugglingRequest(host string, path string, userAgent string, headers string, body string) []byte {
+	return []byte(fmt.Sprintf("POST %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: %s\r\nContent-Type: application/x-www-form-urlencoded\r\nConnection: close\r\n%s\r\n%s",
+		path, host, userAgent, headers, body))
+}
+
+// sendSmugglingProbe sends the request on a new connection and waits for
+// the response headers.
+func (scan *scan) sendSmugglingProbe(request []byte, useHTTPS bool) *SmugglingProbe {
+	ret := new(SmugglingProbe)
+	conn, err := scan.target.Open(&scan.scanner.config.BaseFlags)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer conn.Close()
+	if useHTTPS {
+		tlsConn, err := scan.scanner.config.TLSFlags.GetTLSConnectionForTarget(conn, scan.target)
+		if err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		conn = tlsConn
+	}
+	start := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	deadline := start.Add(scan.scanner.config.SmugglingTimeout)
+	var response []byte
+	buf := make([]byte, 4096)
+	for !bytes.Contains(response, []byte("\r\n\r\n")) {
+		conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if err != nil {
+			if zgrab2.IsTimeoutError(err) {
+				ret.TimedOut = true
+			} else if len(response) == 0 {
+				ret.Error = err.Error()
+			}
+			break
+		}
+	}
+	ret.ElapsedMS = int64(time.Since(start) / time.Millisecond)
+	if match := httpStatusLineRegex.FindSubmatch(response); match != nil {
+		ret.StatusCode, _ = strconv.Atoi(string(match[1]))
+	}
+	return ret
+}
+
+// probeSmuggling runs the CL.TE and TE.CL timing probes. The TE.CL probe is
+// skipped if the CL.TE probe timed out, since on a CL.TE chain it would leave
+// a partial request on the back-end connection.
+func (scan *scan) probeSmuggling(useHTTPS bool) *SmugglingResults {
+	u, err := url.Parse(scan.url)
+	if err != nil {
+		return nil
+	}
+	host, path, userAgent := u.Host, u.RequestURI(), scan.scanner.config.UserAgent
+	result := new(SmugglingResults)
+	result.Baseline = scan.sendSmugglingProbe(smugglingRequest(host, path, userAgent,
+		"Content-Length: 3\r\n", "x=1"), useHTTPS)
+	result.CLTE = scan.sendSmugglingProbe(smugglingRequest(host, path, userAgent,
+		"Transfer-Encoding: chunked\r\nContent-Length: 4\r\n", "1\r\nZ\r\nQ"), useHTTPS)
+	result.CLTEIndicator = result.CLTE.TimedOut && !result.Baseline.TimedOut
+	if result.CLTE.TimedOut {
+		return result
+	}
+	result.TECL = scan.sendSmugglingProbe(smugglingRequest(host, path, userAgent,
+		"Transfer-Encoding: chunked\r\nContent-Length: 6\r\n", "0\r\n\r\nX"), useHTTPS)
+	result.TECLIndicator = result.TECL.TimedOut && !result.Baseline.TimedOut
+	return result
+}
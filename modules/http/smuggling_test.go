@@ -0,0 +1,58 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func scanSmuggling(t *testing.T, handler http.HandlerFunc) *SmugglingResults {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	scanner.config.SmugglingProbes = true
+	scanner.config.SmugglingTimeout = 500 * time.Millisecond
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	smuggling := result.(*Results).Smuggling
+	if smuggling == nil || smuggling.Baseline == nil || smuggling.CLTE == nil {
+		t.Fatalf("got smuggling results %+v", smuggling)
+	}
+	if smuggling.Baseline.StatusCode != 200 || smuggling.Baseline.TimedOut || smuggling.Baseline.Error != "" {
+		t.Errorf("got baseline %+v", smuggling.Baseline)
+	}
+	return smuggling
+}
+
+func TestSmugglingDelayed(t *testing.T) {
+	// The server honours Transfer-Encoding over Content-Length, and waits
+	// for the rest of the chunked body of the CL.TE probe.
+	result := scanSmuggling(t, func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	})
+	if !result.CLTE.TimedOut || result.CLTE.StatusCode != 0 || result.CLTE.ElapsedMS < 500 || !result.CLTEIndicator {
+		t.Errorf("got CL.TE probe %+v, indicator %v", result.CLTE, result.CLTEIndicator)
+	}
+	// The TE.CL probe is skipped after a CL.TE indicator.
+	if result.TECL != nil || result.TECLIndicator {
+		t.Errorf("got TE.CL probe %+v, indicator %v", result.TECL, result.TECLIndicator)
+	}
+}
+
+func TestSmugglingNotDelayed(t *testing.T) {
+	// The server answers without reading the body.
+	result := scanSmuggling(t, func(w http.ResponseWriter, r *http.Request) {})
+	if result.CLTE.TimedOut || result.CLTE.StatusCode != 200 || result.CLTEIndicator {
+		t.Errorf("got CL.TE probe %+v, indicator %v", result.CLTE, result.CLTEIndicator)
+	}
+	if result.TECL == nil || result.TECL.TimedOut || result.TECL.StatusCode != 200 || result.TECLIndicator {
+		t.Errorf("got TE.CL probe %+v, indicator %v", result.TECL, result.TECLIndicator)
+	}
+}
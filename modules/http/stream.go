@@ -0,0 +1,98 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"time"
+)
+
+// BodyInfo describes a body read with --max-body-size, --max-body-time or
+// --body-hash-only.
+type BodyInfo struct {
+	// Length is the number of bytes read and hashed into BodySHA256.
+	Length int64 `json:"length"`
+
+	// Complete is true if the whole body was read.
+	Complete bool `json:"complete"`
+
+	// Limit is size or time if reading stopped at --max-body-size or
+	// --max-body-time.
+	Limit string `json:"limit,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+var errBodyTime = errors.New("body read time limit reached")
+
+// deadlineReader fails reads after deadline. A server trickling the body
+// is stopped at the first read after it; a silent one at the read timeout.
+type deadlineReader struct {
+	reader   io.Reader
+	deadline time.Time
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if !r.deadline.IsZero() && !time.Now().Before(r.deadline) {
+		return 0, errBodyTime
+	}
+	return r.reader.Read(p)
+}
+
+// prefixWriter keeps the first limit bytes written to it and discards the
+// rest.
+type prefixWriter struct {
+	buf   *bytes.Buffer
+	limit int64
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if keep := w.limit - int64(w.buf.Len()); keep > 0 {
+		if int64(len(p)) < keep {
+			keep = int64(len(p))
+		}
+		w.buf.Write(p[:keep])
+	}
+	return len(p), nil
+}
+
+// streamBody reads the body through SHA-256 up to --max-body-size and
+// --max-body-time without buffering it, keeping the first keep bytes in buf.
+func (scan *scan) streamBody(body io.Reader, buf *bytes.Buffer, keep int64) ([]byte, *BodyInfo) {
+	config := scan.scanner.config
+	limit := int64(config.MaxSize) * 1024
+	if config.MaxBodySize > 0 {
+		limit = int64(config.MaxBodySize) * 1024
+	}
+	reader := &deadlineReader{reader: body}
+	if config.MaxBodyTime > 0 {
+		reader.deadline = time.Now().Add(config.MaxBodyTime)
+	}
+	hash := sha256.New()
+	info := new(BodyInfo)
+	var err error
+	info.Length, err = io.Copy(io.MultiWriter(hash, &prefixWriter{buf: buf, limit: keep}), io.LimitReader(reader, limit))
+	switch {
+	case err == errBodyTime:
+		info.Limit = "time"
+	case err != nil:
+		info.Error = err.Error()
+	case info.Length < limit:
+		info.Complete = true
+	default:
+		// Exactly limit bytes were read; check whether there is more.
+		n, err := reader.Read(make([]byte, 1))
+		switch {
+		case n > 0:
+			info.Limit = "size"
+		case err == errBodyTime:
+			info.Limit = "time"
+		case err == io.EOF:
+			info.Complete = true
+		case err != nil:
+			info.Error = err.Error()
+		}
+	}
+	return hash.Sum(nil), info
+}
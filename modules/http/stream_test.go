@@ -0,0 +1,70 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestStreamBody(t *testing.T) {
+	resetReadLimit(t)
+	large := bytes.Repeat([]byte("0123456789abcdef"), 8*1024) // 128 KB
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			for i := 0; i < 50; i++ {
+				w.Write([]byte("x"))
+				w.(http.Flusher).Flush()
+				time.Sleep(20 * time.Millisecond)
+			}
+		default:
+			w.Write(large)
+		}
+	}))
+	defer server.Close()
+
+	scanner, target := getTestServerScanner(t, server, false)
+	scanner.config.HTTP2 = false
+	scanner.config.MaxSize = 1
+	scanner.config.MaxBodySize = 256
+	status, result, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	results := result.(*Results)
+	sum := sha256.Sum256(large)
+	if info := results.Body; info == nil || !info.Complete || info.Length != int64(len(large)) || info.Limit != "" {
+		t.Errorf("unexpected body info %+v", info)
+	}
+	if !bytes.Equal(results.Response.BodySHA256, sum[:]) || len(results.Response.BodyText) != 1024 {
+		t.Errorf("unexpected body: %d bytes kept", len(results.Response.BodyText))
+	}
+
+	scanner.config.MaxBodySize = 64
+	scanner.config.BodyHashOnly = true
+	_, result, _ = scanner.Scan(target)
+	results = result.(*Results)
+	sum = sha256.Sum256(large[:64*1024])
+	if info := results.Body; info.Complete || info.Length != 64*1024 || info.Limit != "size" {
+		t.Errorf("unexpected body info %+v", info)
+	}
+	if !bytes.Equal(results.Response.BodySHA256, sum[:]) || results.Response.BodyText != "" || results.Response.BodyBase64 != "" {
+		t.Error("unexpected body with --body-hash-only")
+	}
+
+	scanner.config.Endpoint = "/slow"
+	scanner.config.MaxBodyTime = 200 * time.Millisecond
+	start := time.Now()
+	_, result, _ = scanner.Scan(target)
+	if info := result.(*Results).Body; info.Complete || info.Limit != "time" || info.Length == 0 || info.Length >= 50 {
+		t.Errorf("unexpected body info %+v", info)
+	}
+	if elapsed := time.Since(start); elapsed > 700*time.Millisecond {
+		t.Errorf("slow body read for %s", elapsed)
+	}
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// VHostResult is the result of the request for one name of --vhosts-file.
+type VHostResult struct {
+	Host   string            `json:"host"`
+	Status zgrab2.ScanStatus `json:"status"`
+	Error  string            `json:"error,omitempty"`
+
+	// Results holds the response, redirects and body info of the request.
+	Results
+}
+
+// loadVHosts reads a --vhosts-file: one hostname per line. Empty lines and
+// lines starting with # are skipped, and duplicates are dropped.
+func loadVHosts(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var ret []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		host := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if host == "" || strings.HasPrefix(host, "#") {
+			continue
+		}
+		if strings.ContainsAny(host, " /:@") {
+			return nil, fmt.Errorf("%s:%d: not a hostname: %q", path, line, scanner.Text())
+		}
+		if !seen[host] {
+			seen[host] = true
+			ret = append(ret, host)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// scanVHosts sends the configured request to the target IP once per
+// virtual host, with the name as Host header and SNI. Targets without an
+// IP are not scanned.
+func (scanner *Scanner) scanVHosts(t *zgrab2.ScanTarget, useHTTPS bool) []*VHostResult {
+	if t.IP == nil {
+		return nil
+	}
+	ret := make([]*VHostResult, 0, len(scanner.vhosts))
+	for _, host := range scanner.vhosts {
+		target := *t
+		target.Domain = host
+		scan := scanner.newHTTPScan(&target, useHTTPS)
+		result := &VHostResult{Host: host, Status: zgrab2.SCAN_SUCCESS}
+		if err := scan.Grab(); err != nil {
+			result.Status = err.Status
+			result.Error = err.Err.Error()
+		}
+		scan.Cleanup()
+		if scanner.config.OnlyBASE64 && scan.results.Response != nil {
+			scan.results.Response.BodyText = ""
+		}
+		result.Results = scan.results
+		ret = append(ret, result)
+	}
+	return ret
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func writeVHostsFile(t *testing.T, contents string) string {
+	file, err := ioutil.TempFile("", "vhosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestLoadVHosts(t *testing.T) {
+	path := writeVHostsFile(t, "# shared hosting\nA.example.com\n\nb.example.com\na.example.com\n")
+	defer os.Remove(path)
+	vhosts, err := loadVHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vhosts, []string{"a.example.com", "b.example.com"}) {
+		t.Errorf("got %v", vhosts)
+	}
+
+	bad := writeVHostsFile(t, "a.example.com\nhttp://b.example.com/\n")
+	defer os.Remove(bad)
+	if _, err := loadVHosts(bad); err == nil {
+		t.Error("no error for a URL")
+	}
+}
+
+func TestScanVHosts(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.Host)
+		if host == "missing.example.com" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(host + " " + r.TLS.ServerName))
+	}))
+	defer server.Close()
+	scanner, target := getTestServerScanner(t, server, true)
+	scanner.config.HTTP2 = false
+	scanner.vhosts = []string{"a.example.com", "missing.example.com"}
+
+	status, res, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("status %s: %v", status, err)
+	}
+	vhosts := res.(*Results).VHosts
+	if len(vhosts) != 2 {
+		t.Fatalf("got %d vhost results", len(vhosts))
+	}
+	if vhosts[0].Host != "a.example.com" || vhosts[0].Status != zgrab2.SCAN_SUCCESS {
+		t.Errorf("first vhost: %+v", vhosts[0])
+	}
+	if body := vhosts[0].Response.BodyText; body != "a.example.com a.example.com" {
+		t.Errorf("Host header and SNI: %q", body)
+	}
+	if vhosts[1].Response.StatusCode != http.StatusNotFound {
+		t.Errorf("second vhost status code %d", vhosts[1].Response.StatusCode)
+	}
+
+	target.IP = nil
+	target.Domain = "localhost"
+	if status, res, _ := scanner.Scan(target); status == zgrab2.SCAN_SUCCESS && res.(*Results).VHosts != nil {
+		t.Error("virtual hosts scanned for a target without IP")
+	}
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestWatchdogClosesHungScan(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	// The server reads the request and never answers; closed is signaled
+	// when the client closes the connection.
+	closed := make(chan struct{}, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 4096)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				closed <- struct{}{}
+				return
+			}
+		}
+	}()
+
+	var module Module
+	flags := module.NewFlags().(*Flags)
+	flags.Endpoint = "/"
+	flags.Method = "GET"
+	flags.UserAgent = "Mozilla/5.0 zgrab/0.x"
+	flags.MaxSize = 256
+	flags.Timeout = 10 * time.Second
+	flags.Port = uint(listener.Addr().(*net.TCPAddr).Port)
+	modules := zgrab2.NewModuleSet()
+	modules.AddModule("http", &module)
+	grabs := make(chan *zgrab2.Grab, 1)
+	runner, err := zgrab2.NewRunner(zgrab2.RunnerOptions{
+		Modules: modules,
+		Flags:   map[string]zgrab2.ScanFlags{"http": flags},
+		Input: func(ch chan<- zgrab2.ScanTarget) error {
+			ch <- zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")}
+			return nil
+		},
+		Output:          func(grab *zgrab2.Grab) { grabs <- grab },
+		WatchdogTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := runner.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if status := (<-grabs).Data["http"].Status; status != zgrab2.SCAN_WATCHDOG_TIMEOUT {
+		t.Errorf("got status %s", status)
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the connection of the abandoned scan is still open")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("took %s", elapsed)
+	}
+}
@@ -0,0 +1,296 @@
+package http3
+
+import (
+	"errors"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// headerField is a decoded field line.
+type headerField struct {
+	name, value string
+}
+
+// qpackStaticTable is the QPACK static table (RFC 9204, appendix A).
+var qpackStaticTable = [...]headerField{
+	{":authority", ""},
+	{":path", "/"},
+	{"age", "0"},
+	{"content-disposition", ""},
+	{"content-length", "0"},
+	{"cookie", ""},
+	{"date", ""},
+	{"etag", ""},
+	{"if-modified-since", ""},
+	{"if-none-match", ""},
+	{"last-modified", ""},
+	{"link", ""},
+	{"location", ""},
+	{"referer", ""},
+	{"set-cookie", ""},
+	{":method", "CONNECT"},
+	{":method", "DELETE"},
+	{":method", "GET"},
+	{":method", "HEAD"},
+	{":method", "OPTIONS"},
+	{":method", "POST"},
+	{":method", "PUT"},
+	{":scheme", "http"},
+	{":scheme", "https"},
+	{":status", "103"},
+	{":status", "200"},
+	{":status", "304"},
+	{":status", "404"},
+	{":status", "503"},
+	{"accept", "*/*"},
+	{"accept", "application/dns-message"},
+	{"accept-encoding", "gzip, deflate, br"},
+	{"accept-ranges", "bytes"},
+	{"access-control-allow-headers", "cache-control"},
+	{"access-control-allow-headers", "content-type"},
+	{"access-control-allow-origin", "*"},
+	{"cache-control", "max-age=0"},
+	{"cache-control", "max-age=2592000"},
+	{"cache-control", "max-age=604800"},
+	{"cache-control", "no-cache"},
+	{"cache-control", "no-store"},
+	{"cache-control", "public, max-age=31536000"},
+	{"content-encoding", "br"},
+	{"content-encoding", "gzip"},
+	{"content-type", "application/dns-message"},
+	{"content-type", "application/javascript"},
+	{"content-type", "application/json"},
+	{"content-type", "application/x-www-form-urlencoded"},
+	{"content-type", "image/gif"},
+	{"content-type", "image/jpeg"},
+	{"content-type", "image/png"},
+	{"content-type", "text/css"},
+	{"content-type", "text/html; charset=utf-8"},
+	{"content-type", "text/plain"},
+	{"content-type", "text/plain;charset=utf-8"},
+	{"range", "bytes=0-"},
+	{"strict-transport-security", "max-age=31536000"},
+	{"strict-transport-security", "max-age=31536000; includesubdomains"},
+	{"strict-transport-security", "max-age=31536000; includesubdomains; preload"},
+	{"vary", "accept-encoding"},
+	{"vary", "origin"},
+	{"x-content-type-options", "nosniff"},
+	{"x-xss-protection", "1; mode=block"},
+	{":status", "100"},
+	{":status", "204"},
+	{":status", "206"},
+	{":status", "302"},
+	{":status", "400"},
+	{":status", "403"},
+	{":status", "421"},
+	{":status", "425"},
+	{":status", "500"},
+	{"accept-language", ""},
+	{"access-control-allow-credentials", "FALSE"},
+	{"access-control-allow-credentials", "TRUE"},
+	{"access-control-allow-headers", "*"},
+	{"access-control-allow-methods", "get"},
+	{"access-control-allow-methods", "get, post, options"},
+	{"access-control-allow-methods", "options"},
+	{"access-control-expose-headers", "content-length"},
+	{"access-control-request-headers", "content-type"},
+	{"access-control-request-method", "get"},
+	{"access-control-request-method", "post"},
+	{"alt-svc", "clear"},
+	{"authorization", ""},
+	{"content-security-policy", "script-src 'none'; object-src 'none'; base-uri 'none'"},
+	{"early-data", "1"},
+	{"expect-ct", ""},
+	{"forwarded", ""},
+	{"if-range", ""},
+	{"origin", ""},
+	{"purpose", "prefetch"},
+	{"server", ""},
+	{"timing-allow-origin", "*"},
+	{"upgrade-insecure-requests", "1"},
+	{"user-agent", ""},
+	{"x-forwarded-for", ""},
+	{"x-frame-options", "deny"},
+	{"x-frame-options", "sameorigin"},
+}
+
+var (
+	errQPACKMalformed = errors.New("qpack: malformed field section")
+
+	// errQPACKDynamic is returned for references to the dynamic table, which
+	// the server may not use since we advertise a capacity of 0.
+	errQPACKDynamic = errors.New("qpack: reference to the dynamic table")
+)
+
+// appendPrefixInt appends an integer with an n-bit prefix (RFC 7541, section
+// 5.1); flags are the bits of the first byte above the prefix.
+func appendPrefixInt(b []byte, flags byte, n uint, v uint64) []byte {
+	max := uint64(1)<<n - 1
+	if v < max {
+		return append(b, flags|byte(v))
+	}
+	b = append(b, flags|byte(max))
+	for v -= max; v >= 0x80; v >>= 7 {
+		b = append(b, byte(v)|0x80)
+	}
+	return append(b, byte(v))
+}
+
+// readPrefixInt decodes an integer with an n-bit prefix and returns it with
+// the rest of b.
+func readPrefixInt(b []byte, n uint) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, errQPACKMalformed
+	}
+	max := uint64(1)<<n - 1
+	v := uint64(b[0]) & max
+	b = b[1:]
+	if v < max {
+		return v, b, nil
+	}
+	for shift := uint(0); shift < 63; shift += 7 {
+		if len(b) == 0 {
+			return 0, nil, errQPACKMalformed
+		}
+		c := b[0]
+		b = b[1:]
+		v += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, b, nil
+		}
+	}
+	return 0, nil, errQPACKMalformed
+}
+
+// readString decodes a string literal whose length has an n-bit prefix, with
+// the Huffman flag just above it.
+func readString(b []byte, n uint) (string, []byte, error) {
+	if len(b) == 0 {
+		return "", nil, errQPACKMalformed
+	}
+	huffman := b[0]&(1<<n) != 0
+	length, b, err := readPrefixInt(b, n)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(b)) < length {
+		return "", nil, errQPACKMalformed
+	}
+	raw := b[:length]
+	b = b[length:]
+	if !huffman {
+		return string(raw), b, nil
+	}
+	s, err := hpack.HuffmanDecodeToString(raw)
+	if err != nil {
+		return "", nil, errQPACKMalformed
+	}
+	return s, b, nil
+}
+
+func staticEntry(index uint64) (headerField, error) {
+	if index >= uint64(len(qpackStaticTable)) {
+		return headerField{}, errQPACKMalformed
+	}
+	return qpackStaticTable[index], nil
+}
+
+// encodeFields encodes a field section using only the static table and
+// literals, so no encoder stream is needed.
+func encodeFields(fields []headerField) []byte {
+	b := []byte{0, 0} // Required Insert Count and Delta Base
+	for _, f := range fields {
+		nameIndex := -1
+		fullIndex := -1
+		for i, entry := range qpackStaticTable {
+			if entry.name != f.name {
+				continue
+			}
+			if nameIndex < 0 {
+				nameIndex = i
+			}
+			if entry.value == f.value {
+				fullIndex = i
+				break
+			}
+		}
+		switch {
+		case fullIndex >= 0:
+			b = appendPrefixInt(b, 0xc0, 6, uint64(fullIndex))
+		case nameIndex >= 0:
+			b = appendPrefixInt(b, 0x50, 4, uint64(nameIndex))
+			b = appendPrefixInt(b, 0, 7, uint64(len(f.value)))
+			b = append(b, f.value...)
+		default:
+			b = appendPrefixInt(b, 0x20, 3, uint64(len(f.name)))
+			b = append(b, f.name...)
+			b = appendPrefixInt(b, 0, 7, uint64(len(f.value)))
+			b = append(b, f.value...)
+		}
+	}
+	return b
+}
+
+// decodeFields decodes a field section that does not reference the dynamic
+// table.
+func decodeFields(b []byte) ([]headerField, error) {
+	insertCount, b, err := readPrefixInt(b, 8)
+	if err != nil {
+		return nil, err
+	}
+	if insertCount != 0 {
+		return nil, errQPACKDynamic
+	}
+	if _, b, err = readPrefixInt(b, 7); err != nil {
+		return nil, err
+	}
+	var fields []headerField
+	for len(b) > 0 {
+		var f headerField
+		c := b[0]
+		switch {
+		case c&0x80 != 0:
+			// Indexed field line.
+			if c&0x40 == 0 {
+				return nil, errQPACKDynamic
+			}
+			var index uint64
+			if index, b, err = readPrefixInt(b, 6); err != nil {
+				return nil, err
+			}
+			if f, err = staticEntry(index); err != nil {
+				return nil, err
+			}
+		case c&0x40 != 0:
+			// Literal field line with name reference.
+			if c&0x10 == 0 {
+				return nil, errQPACKDynamic
+			}
+			var index uint64
+			if index, b, err = readPrefixInt(b, 4); err != nil {
+				return nil, err
+			}
+			entry, err := staticEntry(index)
+			if err != nil {
+				return nil, err
+			}
+			f.name = entry.name
+			if f.value, b, err = readString(b, 7); err != nil {
+				return nil, err
+			}
+		case c&0x20 != 0:
+			// Literal field line with literal name.
+			if f.name, b, err = readString(b, 3); err != nil {
+				return nil, err
+			}
+			if f.value, b, err = readString(b, 7); err != nil {
+				return nil, err
+			}
+		default:
+			// Post-base references.
+			return nil, errQPACKDynamic
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
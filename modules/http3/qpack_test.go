@@ -0,0 +1,93 @@
+package http3
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2/lib/quic"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestQPACKRoundTrip(t *testing.T) {
+	fields := []headerField{
+		{":method", "GET"},                        // indexed
+		{":authority", "example.com"},             // name reference
+		{"x-custom", "value"},                     // literal name
+		{"user-agent", string(make([]byte, 300))}, // multi-byte length
+	}
+	decoded, err := decodeFields(encodeFields(fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, fields) {
+		t.Errorf("got %q", decoded)
+	}
+}
+
+func TestQPACKHuffmanAndDynamic(t *testing.T) {
+	// :status 200 indexed, then server with a Huffman-coded value.
+	value := hpack.AppendHuffmanString(nil, "nginx")
+	b := []byte{0, 0, 0xc0 | 25, 0x50 | 0x0f, 92 - 15}
+	b = appendPrefixInt(b, 0x80, 7, uint64(len(value)))
+	b = append(b, value...)
+	fields, err := decodeFields(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []headerField{{":status", "200"}, {"server", "nginx"}}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("got %q", fields)
+	}
+	if _, err := decodeFields([]byte{1, 0, 0x80}); err != errQPACKDynamic {
+		t.Errorf("expected a dynamic table error, got %v", err)
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	var data []byte
+	data = appendFrame(data, frameTypeHeaders, encodeFields([]headerField{{":status", "103"}, {"link", "</a.css>"}}))
+	data = appendFrame(data, frameTypeHeaders, encodeFields([]headerField{{":status", "200"}, {"content-type", "text/plain"}}))
+	data = appendFrame(data, 0x21, []byte("reserved frame type"))
+	data = appendFrame(data, frameTypeData, []byte("hello, "))
+	data = appendFrame(data, frameTypeData, []byte("world"))
+	data = appendFrame(data, frameTypeHeaders, encodeFields([]headerField{{"x-trailer", "1"}}))
+	response, err := parseResponse(data, true, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "200" || !reflect.DeepEqual(response.InterimStatuses, []string{"103"}) || !response.Complete {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if response.BodyText != "hello, world" || response.Headers["content-type"][0] != "text/plain" || response.Trailers["x-trailer"][0] != "1" {
+		t.Errorf("unexpected response %+v", response)
+	}
+
+	// Cut in the middle of the body.
+	response, err = parseResponse(data[:len(data)-20], false, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.BodyText != "hello, w" || response.Complete {
+		t.Errorf("unexpected truncated response %+v", response)
+	}
+
+	if _, err := parseResponse(nil, true, 1024); err != errNoResponse {
+		t.Errorf("expected errNoResponse, got %v", err)
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	var payload []byte
+	for _, v := range []uint64{0x01, 0, 0x06, 16384, 0x21 + 0x1f*3, 7, 0x4242, 1} {
+		payload = quic.AppendVarint(payload, v)
+	}
+	settings := parseSettings(payload)
+	expected := map[string]uint64{
+		"SETTINGS_QPACK_MAX_TABLE_CAPACITY": 0,
+		"SETTINGS_MAX_FIELD_SECTION_SIZE":   16384,
+		"UNKNOWN_SETTING_0x4242":            1,
+	}
+	if !reflect.DeepEqual(settings, expected) {
+		t.Errorf("got %v", settings)
+	}
+}
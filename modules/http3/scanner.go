@@ -0,0 +1,484 @@
+// Package http3 provides a zgrab2 module that sends an HTTP/3 request over
+// QUIC (UDP) and records the QUIC version, the server's transport
+// parameters, certificates and HTTP/3 settings, and the response.
+//
+// The QUIC client (lib/quic) only speaks version 1 with
+// TLS_AES_128_GCM_SHA256 and X25519, which every QUIC server must support.
+// With --probe-versions, a packet with a reserved version is sent first to
+// list all versions the server supports.
+package http3
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/quic"
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zcrypto/x509"
+)
+
+// Flags holds the command-line configuration for the http3 scan module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	Method        string `long:"method" default:"GET" description:"Set HTTP request method type"`
+	Endpoint      string `long:"endpoint" default:"/" description:"Send an HTTP request to an endpoint"`
+	UserAgent     string `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
+	ServerName    string `long:"server-name" description:"Server name for SNI and :authority (default: the target's domain)"`
+	MaxSize       int    `long:"max-size" default:"256" description:"Max kilobytes to read in response to an HTTP request"`
+	ProbeVersions bool   `long:"probe-versions" description:"Before the request, list the QUIC versions the server supports with a version negotiation probe"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Response is the response to the HTTP/3 request on stream 0.
+type Response struct {
+	// Status is the value of the :status pseudo-header of the final
+	// response.
+	Status string `json:"status,omitempty"`
+
+	// InterimStatuses are the statuses of 1xx responses before it.
+	InterimStatuses []string `json:"interim_statuses,omitempty"`
+
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// Trailers are the fields of a HEADERS frame after the body.
+	Trailers map[string][]string `json:"trailers,omitempty"`
+
+	BodyText   string `json:"body,omitempty"`
+	BodySHA256 []byte `json:"body_sha256,omitempty"`
+
+	// Complete is true if the server ended the stream.
+	Complete bool `json:"complete"`
+}
+
+// Results is the output of the http3 module.
+type Results struct {
+	// SupportedVersions are the versions from the server's Version
+	// Negotiation packet, with --probe-versions or if version 1 is refused.
+	SupportedVersions []string `json:"supported_versions,omitempty"`
+
+	// Version is the QUIC version of the connection.
+	Version string `json:"version,omitempty"`
+
+	// Handshake holds the QUIC handshake details: Retry, cipher suite, ALPN
+	// and transport parameters.
+	Handshake *quic.HandshakeLog `json:"handshake,omitempty"`
+
+	// Certificates are the server's certificates, leaf first (unverified).
+	Certificates []*x509.Certificate `json:"certificates,omitempty"`
+
+	// Settings are the parameters of the SETTINGS frame on the server's
+	// control stream, by name (unknown identifiers as
+	// UNKNOWN_SETTING_<id>).
+	Settings map[string]uint64 `json:"settings,omitempty"`
+
+	// GoAwayID is the stream ID from a GOAWAY frame, if one was received.
+	GoAwayID *uint64 `json:"goaway_id,omitempty"`
+
+	Response *Response `json:"response,omitempty"`
+
+	// ConnectionClose is the server's CONNECTION_CLOSE, if it sent one.
+	ConnectionClose *quic.CloseError `json:"connection_close,omitempty"`
+}
+
+// HTTP/3 frame and stream types (RFC 9114, sections 6.2 and 7.2).
+const (
+	frameTypeData     = 0x00
+	frameTypeHeaders  = 0x01
+	frameTypeSettings = 0x04
+	frameTypeGoAway   = 0x07
+
+	streamTypeControl = 0x00
+
+	// requestStreamID and controlStreamID are the client's first
+	// bidirectional and unidirectional streams.
+	requestStreamID = 0
+	controlStreamID = 2
+
+	// h3NoError is the H3_NO_ERROR application error code.
+	h3NoError = 0x100
+)
+
+// defaultTimeout bounds the scan if --timeout is 0, since nothing else
+// would end a UDP exchange.
+const defaultTimeout = 10 * time.Second
+
+var settingNames = map[uint64]string{
+	0x01:       "SETTINGS_QPACK_MAX_TABLE_CAPACITY",
+	0x06:       "SETTINGS_MAX_FIELD_SECTION_SIZE",
+	0x07:       "SETTINGS_QPACK_BLOCKED_STREAMS",
+	0x08:       "SETTINGS_ENABLE_CONNECT_PROTOCOL",
+	0x33:       "SETTINGS_H3_DATAGRAM",
+	0x2b603742: "SETTINGS_ENABLE_WEBTRANSPORT",
+}
+
+var errNoResponse = errors.New("http3: no response headers")
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("http3", "HTTP/3", module.Description(), 443, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send an HTTP/3 request over QUIC and record the QUIC handshake and the response"
+}
+
+// Validate checks that the flags are valid.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "http3"
+}
+
+// VersionNames returns the names of QUIC versions.
+func VersionNames(versions []uint32) []string {
+	ret := make([]string, len(versions))
+	for i, v := range versions {
+		ret[i] = quic.VersionName(v)
+	}
+	return ret
+}
+
+func (scanner *Scanner) deadline() time.Time {
+	if scanner.config.Timeout > 0 {
+		return time.Now().Add(scanner.config.Timeout)
+	}
+	return time.Now().Add(defaultTimeout)
+}
+
+// Scan performs the QUIC handshake and sends the HTTP/3 request.
+func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := t.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	results := new(Results)
+
+	if scanner.config.ProbeVersions {
+		versions, err := quic.ProbeVersions(conn, scanner.deadline())
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		results.SupportedVersions = VersionNames(versions)
+		supported := false
+		for _, v := range versions {
+			supported = supported || v == quic.Version1
+		}
+		if !supported {
+			return zgrab2.SCAN_PROTOCOL_ERROR, results, &quic.VersionNegotiationError{Versions: versions}
+		}
+	}
+
+	serverName := scanner.config.ServerName
+	if serverName == "" {
+		serverName = t.Domain
+	}
+	client := quic.Client(conn, &quic.Config{ServerName: serverName, NextProtos: []string{"h3"}})
+	client.SetDeadline(scanner.deadline())
+	if err := client.Handshake(); err != nil {
+		switch e := err.(type) {
+		case *quic.VersionNegotiationError:
+			results.SupportedVersions = VersionNames(e.Versions)
+			return zgrab2.SCAN_PROTOCOL_ERROR, results, err
+		case *quic.CloseError:
+			results.Handshake = client.Log()
+			results.ConnectionClose = e
+			return zgrab2.SCAN_APPLICATION_ERROR, results, err
+		}
+		if handshake := client.Log(); handshake.Retry || handshake.CipherSuite != 0 {
+			results.Handshake = handshake
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results.Version = quic.VersionName(quic.Version1)
+	results.Handshake = client.Log()
+	for _, der := range client.Log().Certificates {
+		if cert, err := x509.ParseCertificate(der); err == nil {
+			results.Certificates = append(results.Certificates, cert)
+		}
+	}
+	if len(results.Certificates) > 0 {
+		t.Context.RecordCertificate(results.Certificates[0])
+	}
+	if alpn := client.Log().ALPN; alpn != "" {
+		t.Context.Set(zgrab2.ContextALPN, alpn)
+	}
+
+	err = scanner.request(client, &t, serverName)
+	scanner.readControlStream(client, results)
+	data, complete := client.Stream(requestStreamID)
+	response, parseErr := parseResponse(data, complete, scanner.config.MaxSize*1024)
+	results.Response = response
+	if closeErr, ok := err.(*quic.CloseError); ok {
+		results.ConnectionClose = closeErr
+		return zgrab2.SCAN_APPLICATION_ERROR, results, err
+	}
+	client.Close(h3NoError, "")
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), results, err
+	}
+	if parseErr != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, parseErr
+	}
+	if server := response.Headers["server"]; len(server) > 0 {
+		t.Context.Set(zgrab2.ContextHTTPServer, server[0])
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
+
+// request opens the control stream, sends the request and reads until the
+// response is complete or MaxSize is exceeded.
+func (scanner *Scanner) request(client *quic.Conn, t *zgrab2.ScanTarget, serverName string) error {
+	// An empty SETTINGS frame: all defaults, in particular no dynamic table.
+	control := quic.AppendVarint(nil, streamTypeControl)
+	control = appendFrame(control, frameTypeSettings, nil)
+	if err := client.SendStream(controlStreamID, control, false); err != nil {
+		return err
+	}
+
+	authority := serverName
+	if authority == "" {
+		authority = t.IP.String()
+		if t.IP.To4() == nil {
+			authority = "[" + authority + "]"
+		}
+	}
+	port := uint(scanner.config.Port)
+	if t.Port != nil {
+		port = *t.Port
+	}
+	if port != 443 {
+		authority += ":" + strconv.Itoa(int(port))
+	}
+	fields := []headerField{
+		{":method", scanner.config.Method},
+		{":scheme", "https"},
+		{":authority", authority},
+		{":path", scanner.config.Endpoint},
+		{"user-agent", scanner.config.UserAgent},
+		{"accept", "*/*"},
+	}
+	request := appendFrame(nil, frameTypeHeaders, encodeFields(fields))
+	if err := client.SendStream(requestStreamID, request, true); err != nil {
+		return err
+	}
+	maxSize := scanner.config.MaxSize * 1024
+	return client.ReadStreams(func() bool {
+		data, complete := client.Stream(requestStreamID)
+		return complete || len(data) > maxSize
+	})
+}
+
+func appendFrame(b []byte, typ uint64, payload []byte) []byte {
+	b = quic.AppendVarint(b, typ)
+	b = quic.AppendVarint(b, uint64(len(payload)))
+	return append(b, payload...)
+}
+
+// readFrame splits the first frame off data. If only part of the payload
+// was received, it is returned with complete set to false.
+func readFrame(data []byte) (typ uint64, payload []byte, rest []byte, complete bool, ok bool) {
+	typ, n := quic.ReadVarint(data)
+	if n == 0 {
+		return 0, nil, nil, false, false
+	}
+	length, m := quic.ReadVarint(data[n:])
+	if m == 0 {
+		return 0, nil, nil, false, false
+	}
+	data = data[n+m:]
+	if uint64(len(data)) < length {
+		return typ, data, nil, false, true
+	}
+	return typ, data[:length], data[length:], true, true
+}
+
+// readControlStream records the SETTINGS and GOAWAY frames of the server's
+// control stream, the server-initiated unidirectional stream starting with
+// stream type 0.
+func (scanner *Scanner) readControlStream(client *quic.Conn, results *Results) {
+	for _, id := range client.StreamIDs() {
+		if id%4 != 3 {
+			continue
+		}
+		data, _ := client.Stream(id)
+		streamType, n := quic.ReadVarint(data)
+		if n == 0 || streamType != streamTypeControl {
+			continue
+		}
+		for data = data[n:]; len(data) > 0; {
+			typ, payload, rest, complete, ok := readFrame(data)
+			if !ok || !complete {
+				break
+			}
+			data = rest
+			switch typ {
+			case frameTypeSettings:
+				results.Settings = parseSettings(payload)
+			case frameTypeGoAway:
+				if id, n := quic.ReadVarint(payload); n > 0 {
+					results.GoAwayID = &id
+				}
+			}
+		}
+	}
+}
+
+func parseSettings(payload []byte) map[string]uint64 {
+	ret := make(map[string]uint64)
+	for len(payload) > 0 {
+		id, n := quic.ReadVarint(payload)
+		if n == 0 {
+			break
+		}
+		value, m := quic.ReadVarint(payload[n:])
+		if m == 0 {
+			break
+		}
+		payload = payload[n+m:]
+		if name, ok := settingNames[id]; ok {
+			ret[name] = value
+		} else if id < 0x21 || (id-0x21)%0x1f != 0 {
+			// Reserved (GREASE) identifiers, 0x1f * N + 0x21, are skipped.
+			ret[fmt.Sprintf("UNKNOWN_SETTING_0x%x", id)] = value
+		}
+	}
+	return ret
+}
+
+func addField(m *map[string][]string, f headerField) {
+	if *m == nil {
+		*m = make(map[string][]string)
+	}
+	(*m)[f.name] = append((*m)[f.name], f.value)
+}
+
+// parseResponse parses the frames of the request stream. The body is cut at
+// maxSize bytes.
+func parseResponse(data []byte, complete bool, maxSize int) (*Response, error) {
+	response := &Response{Complete: complete}
+	var body []byte
+	final := false
+	for len(data) > 0 {
+		typ, payload, rest, frameComplete, ok := readFrame(data)
+		if !ok {
+			break
+		}
+		data = rest
+		switch typ {
+		case frameTypeHeaders:
+			if !frameComplete {
+				break
+			}
+			fields, err := decodeFields(payload)
+			if err != nil {
+				return response, err
+			}
+			if final {
+				for _, f := range fields {
+					addField(&response.Trailers, f)
+				}
+				continue
+			}
+			var status string
+			for _, f := range fields {
+				if f.name == ":status" {
+					status = f.value
+				}
+			}
+			if len(status) == 3 && status[0] == '1' {
+				response.InterimStatuses = append(response.InterimStatuses, status)
+				continue
+			}
+			final = true
+			response.Status = status
+			for _, f := range fields {
+				if len(f.name) > 0 && f.name[0] != ':' {
+					addField(&response.Headers, f)
+				}
+			}
+		case frameTypeData:
+			body = append(body, payload...)
+		}
+		if !frameComplete {
+			break
+		}
+	}
+	if len(body) > maxSize {
+		body = body[:maxSize]
+	}
+	if len(body) > 0 {
+		response.BodyText = string(body)
+		sum := sha256.Sum256(body)
+		response.BodySHA256 = sum[:]
+	}
+	if !final {
+		return response, errNoResponse
+	}
+	return response, nil
+}
@@ -0,0 +1,115 @@
+package imap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CapabilityResults lists the capabilities of the server before and after
+// STARTTLS, and the authentication it offers.
+type CapabilityResults struct {
+	// Capabilities is the response to the first CAPABILITY command.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// StartTLSCapabilities is the response to CAPABILITY after STARTTLS.
+	StartTLSCapabilities []string `json:"starttls_capabilities,omitempty"`
+
+	// Added and Removed are the capabilities gained and lost after
+	// STARTTLS.
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+
+	// AuthMechanisms are the SASL mechanisms (AUTH=) of the last
+	// CAPABILITY response.
+	AuthMechanisms []string `json:"auth_mechanisms,omitempty"`
+
+	// CleartextAuthMechanisms are the SASL mechanisms offered before TLS
+	// was negotiated, i.e. over an unencrypted connection.
+	CleartextAuthMechanisms []string `json:"cleartext_auth_mechanisms,omitempty"`
+
+	// LoginDisabled is true if the last CAPABILITY response has
+	// LOGINDISABLED.
+	LoginDisabled bool `json:"login_disabled"`
+
+	// CleartextLogin is true if the LOGIN command was allowed (no
+	// LOGINDISABLED) over an unencrypted connection.
+	CleartextLogin bool `json:"cleartext_login"`
+
+	// AuthProbes are the server's answers to starting an AUTHENTICATE
+	// exchange with each mechanism (--auth-probe).
+	AuthProbes []AuthProbe `json:"auth_probes,omitempty"`
+}
+
+// AuthProbe is the server's answer to an AUTHENTICATE command that was
+// cancelled without sending credentials.
+type AuthProbe struct {
+	Mechanism string `json:"mechanism"`
+
+	// Accepted is true if the server started the exchange with a
+	// continuation request.
+	Accepted bool `json:"accepted"`
+
+	// Response is the continuation request or tagged status line of the
+	// server's answer, after any untagged responses; for
+	// challenge-response mechanisms it holds the server's challenge.
+	Response string `json:"response"`
+}
+
+// authResponseRegex matches an answer to AUTHENTICATE ending with a
+// continuation request or a tagged status line, i.e. a line that is not an
+// untagged "*" response.
+var authResponseRegex = regexp.MustCompile(`(?:^|\n)[^*\n][^\n]*\n$`)
+
+// capabilityRegex matches the untagged CAPABILITY response, or the
+// CAPABILITY response code of a greeting.
+var capabilityRegex = regexp.MustCompile(`(?i)(?:^|\n)\* CAPABILITY ([^\r\n]*)|\[CAPABILITY ([^\]]*)\]`)
+
+// parseCapabilities returns the capabilities of a response, uppercased.
+func parseCapabilities(response string) []string {
+	match := capabilityRegex.FindStringSubmatch(response)
+	if match == nil {
+		return nil
+	}
+	list := match[1]
+	if list == "" {
+		list = match[2]
+	}
+	var capabilities []string
+	for _, capability := range strings.Fields(list) {
+		capabilities = append(capabilities, strings.ToUpper(capability))
+	}
+	return capabilities
+}
+
+// probeAuth starts an AUTHENTICATE exchange with each mechanism and cancels
+// it with "*" (RFC 3501, section 6.2.2) as soon as the server sends a
+// continuation request.
+func probeAuth(conn *Connection, mechanisms []string) ([]AuthProbe, error) {
+	probes := make([]AuthProbe, 0, len(mechanisms))
+	for _, mechanism := range mechanisms {
+		tag := conn.nextTag()
+		if _, err := conn.Conn.Write([]byte(fmt.Sprintf("%s AUTHENTICATE %s\r\n", tag, mechanism))); err != nil {
+			return probes, err
+		}
+		ret, err := conn.readUntil(authResponseRegex)
+		if err != nil {
+			return probes, err
+		}
+		// Skip the untagged responses sent before the answer.
+		lines := strings.Split(strings.TrimRight(ret, "\r\n"), "\n")
+		answer := strings.TrimSpace(lines[len(lines)-1])
+		probe := AuthProbe{Mechanism: mechanism, Response: answer}
+		if strings.HasPrefix(answer, "+") {
+			probe.Accepted = true
+			if _, err := conn.Conn.Write([]byte("*\r\n")); err != nil {
+				return probes, err
+			}
+			if _, err := conn.readUntil(taggedEndRegex(tag)); err != nil {
+				return probes, err
+			}
+		}
+		probes = append(probes, probe)
+	}
+	return probes, nil
+}
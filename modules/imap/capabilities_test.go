@@ -0,0 +1,126 @@
+package imap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/testutil"
+)
+
+// serveIMAP accepts one connection of a server offering STARTTLS, LOGIN
+// only after TLS, and AUTH=PLAIN, whose continuation request follows an
+// untagged response.
+func serveIMAP(t *testing.T) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	cert := testutil.Certificate(t, "imap.example.com")
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { conn.Close() }()
+		fmt.Fprint(conn, "* OK IMAP4rev1 ready\r\n")
+		secure := false
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				fmt.Fprint(conn, "* BAD\r\n")
+				continue
+			}
+			tag, command := fields[0], strings.ToUpper(fields[1])
+			switch {
+			case command == "CAPABILITY" && !secure:
+				fmt.Fprintf(conn, "* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED\r\n%s OK done\r\n", tag)
+			case command == "CAPABILITY":
+				fmt.Fprintf(conn, "* CAPABILITY IMAP4rev1 AUTH=PLAIN AUTH=XOAUTH2\r\n%s OK done\r\n", tag)
+			case command == "STARTTLS":
+				fmt.Fprintf(conn, "%s OK Begin TLS negotiation now\r\n", tag)
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				conn, secure = tlsConn, true
+				reader = bufio.NewReader(conn)
+			case command == "AUTHENTICATE" && fields[2] == "PLAIN":
+				fmt.Fprint(conn, "* OK [ALERT] Authentication attempts are logged\r\n+ \r\n")
+				if line, err := reader.ReadString('\n'); err != nil || line != "*\r\n" {
+					return
+				}
+				fmt.Fprintf(conn, "%s BAD AUTHENTICATE cancelled\r\n", tag)
+			case command == "AUTHENTICATE":
+				fmt.Fprintf(conn, "%s NO Unsupported mechanism\r\n", tag)
+			default:
+				fmt.Fprintf(conn, "%s BAD Unknown command\r\n", tag)
+			}
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestCapabilitiesStartTLS(t *testing.T) {
+	flags := &Flags{
+		BaseFlags: zgrab2.BaseFlags{Port: serveIMAP(t), Timeout: 5 * time.Second},
+		AuthProbe: true,
+	}
+	if err := flags.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	var scanner Scanner
+	scanner.Init(flags)
+	status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	results := result.(*ScanResults)
+	if results.TLSLog == nil || results.TLSLog.ServerCertificates() == nil {
+		t.Fatalf("no TLS log: %+v", results)
+	}
+	if cn := results.TLSLog.ServerCertificates().Certificate.Parsed.Subject.CommonName; cn != "imap.example.com" {
+		t.Errorf("unexpected certificate %s", cn)
+	}
+	caps := results.Capabilities
+	if !reflect.DeepEqual(caps.Capabilities, []string{"IMAP4REV1", "STARTTLS", "LOGINDISABLED"}) || !reflect.DeepEqual(caps.StartTLSCapabilities, []string{"IMAP4REV1", "AUTH=PLAIN", "AUTH=XOAUTH2"}) {
+		t.Errorf("unexpected capabilities %+v", caps)
+	}
+	if !reflect.DeepEqual(caps.Added, []string{"AUTH=PLAIN", "AUTH=XOAUTH2"}) || !reflect.DeepEqual(caps.Removed, []string{"STARTTLS", "LOGINDISABLED"}) {
+		t.Errorf("unexpected delta %v %v", caps.Added, caps.Removed)
+	}
+	if caps.CleartextLogin || caps.LoginDisabled || caps.CleartextAuthMechanisms != nil {
+		t.Errorf("unexpected login results %+v", caps)
+	}
+	expected := []AuthProbe{
+		{Mechanism: "PLAIN", Accepted: true, Response: "+"},
+		{Mechanism: "XOAUTH2", Response: "a005 NO Unsupported mechanism"},
+	}
+	if !reflect.DeepEqual(caps.AuthProbes, expected) {
+		t.Errorf("unexpected auth probes %+v", caps.AuthProbes)
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	for response, expected := range map[string][]string{
+		"* CAPABILITY IMAP4rev1 SASL-IR AUTH=PLAIN\r\na002 OK done\r\n":    {"IMAP4REV1", "SASL-IR", "AUTH=PLAIN"},
+		"* OK [CAPABILITY IMAP4rev1 LITERAL+ STARTTLS] Dovecot ready.\r\n": {"IMAP4REV1", "LITERAL+", "STARTTLS"},
+		"a002 OK done\r\n": nil,
+	} {
+		if capabilities := parseCapabilities(response); !reflect.DeepEqual(capabilities, expected) {
+			t.Errorf("parseCapabilities(%q) = %v", response, capabilities)
+		}
+	}
+}
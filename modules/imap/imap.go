@@ -1,6 +1,7 @@
 package imap
 
 import (
+	"fmt"
 	"io"
 	"net"
 	"regexp"
@@ -16,16 +17,31 @@ const readBufferSize int = 0x10000
 // Connection wraps the state and access to the SMTP connection.
 type Connection struct {
 	Conn net.Conn
+
+	// TruncatedByTimeout is set if a read timed out before the end of a
+	// response; the partial response is still returned.
+	TruncatedByTimeout bool
+
+	// tags is the number of tagged commands sent with SendTaggedCommand.
+	tags int
 }
 
 // ReadResponse reads from the connection until it matches the imapEndRegex. Copied from the original zgrab.
 // TODO: Catch corner cases
 func (conn *Connection) ReadResponse() (string, error) {
+	return conn.readUntil(imapStatusEndRegex)
+}
+
+// readUntil reads from the connection until the data read matches expr.
+func (conn *Connection) readUntil(expr *regexp.Regexp) (string, error) {
 	ret := make([]byte, readBufferSize)
-	n, err := zgrab2.ReadUntilRegex(conn.Conn, ret, imapStatusEndRegex)
+	n, err := zgrab2.ReadUntilRegex(conn.Conn, ret, expr)
 	if err != nil && err != io.EOF && !zgrab2.IsTimeoutError(err) {
 		return "", err
 	}
+	if zgrab2.TruncatedByTimeout(n, err) {
+		conn.TruncatedByTimeout = true
+	}
 	return string(ret[:n]), nil
 }
 
@@ -36,3 +52,25 @@ func (conn *Connection) SendCommand(cmd string) (string, error) {
 	}
 	return conn.ReadResponse()
 }
+
+// nextTag returns the tag of the next tagged command. The tags start at
+// a002, a001 being used by STARTTLS and CLOSE.
+func (conn *Connection) nextTag() string {
+	conn.tags++
+	return fmt.Sprintf("a%03d", conn.tags+1)
+}
+
+// taggedEndRegex matches a response ending with the tagged status line.
+func taggedEndRegex(tag string) *regexp.Regexp {
+	return regexp.MustCompile(`(?:^|\n)` + tag + ` [^\n]*\n$`)
+}
+
+// SendTaggedCommand sends a command with a new tag, and reads the untagged
+// responses up to the tagged status line.
+func (conn *Connection) SendTaggedCommand(cmd string) (string, error) {
+	tag := conn.nextTag()
+	if _, err := conn.Conn.Write([]byte(tag + " " + cmd + "\r\n")); err != nil {
+		return "", err
+	}
+	return conn.readUntil(taggedEndRegex(tag))
+}
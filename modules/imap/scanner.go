@@ -12,6 +12,13 @@
 // --imaps does not change the default port number from 143, so
 // it should usually be coupled with e.g. --port 993.
 //
+// The --capabilities flag tells the scanner to send CAPABILITY, upgrade the
+// connection with STARTTLS if the server offers it, and send CAPABILITY
+// again, recording the capabilities before and after TLS, the AUTH=
+// mechanisms and whether LOGIN is disabled. With --auth-probe, an
+// AUTHENTICATE exchange with each mechanism is started and cancelled
+// before any credentials are sent.
+//
 // The --send-close flag tells the scanner to send a CLOSE command
 // before disconnecting.
 //
@@ -29,6 +36,8 @@ import (
 	"strings"
 
 	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/mailcaps"
+	"github.com/Positive-Engineer/zgrab2/lib/mailsoftware"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -40,11 +49,27 @@ type ScanResults struct {
 	// StartTLS is the server's response to the STARTTLS command, if it is sent.
 	StartTLS string `json:"starttls,omitempty"`
 
+	// Capability is the server's response to the CAPABILITY command sent by
+	// --capabilities, and CapabilityStartTLS the response after STARTTLS.
+	Capability         string `json:"capability,omitempty"`
+	CapabilityStartTLS string `json:"capability_starttls,omitempty"`
+
+	// Capabilities holds the results of --capabilities.
+	Capabilities *CapabilityResults `json:"capabilities,omitempty"`
+
 	// CLOSE is the server's response to the CLOSE command, if it is sent.
 	CLOSE string `json:"close,omitempty"`
 
 	// TLSLog is the standard TLS log, if --starttls or --imaps is enabled.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// TruncatedByTimeout is true if a response was cut short by a read
+	// timeout; the partial response is kept.
+	TruncatedByTimeout bool `json:"truncated_by_timeout,omitempty"`
+
+	// Software is the server software named in the banner, with its
+	// release date and end of life status.
+	Software *mailsoftware.Software `json:"software,omitempty"`
 }
 
 // Flags holds the command-line configuration for the IMAP scan module.
@@ -62,8 +87,17 @@ type Flags struct {
 	// StartTLS indicates that the client should attempt to update the connection to TLS.
 	StartTLS bool `long:"starttls" description:"Send STLS before negotiating"`
 
+	// Capabilities enables the CAPABILITY, STARTTLS, CAPABILITY walk.
+	Capabilities bool `long:"capabilities" description:"Send CAPABILITY, upgrade with STARTTLS if offered and send CAPABILITY again, recording the capabilities, how they changed and the authentication offered"`
+
+	// AuthProbe enables starting (and cancelling) each AUTH= mechanism.
+	AuthProbe bool `long:"auth-probe" description:"Start an AUTHENTICATE exchange with each offered mechanism and cancel it before sending credentials. Implies --capabilities."`
+
 	// Verbose indicates that there should be more verbose logging.
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+
+	// SoftwareTable replaces the built-in mail server release table.
+	SoftwareTable string `long:"software-table" description:"CSV file of product,version,release,released,eol rows replacing the built-in mail server release table"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -94,6 +128,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Fetch an IMAP banner, optionally over TLS"
@@ -107,6 +146,9 @@ func (flags *Flags) Validate(args []string) error {
 		log.Error("Cannot send both --starttls and --imaps")
 		return zgrab2.ErrInvalidArguments
 	}
+	if flags.AuthProbe {
+		flags.Capabilities = true
+	}
 	return nil
 }
 
@@ -119,6 +161,9 @@ func (flags *Flags) Help() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*Flags)
 	scanner.config = f
+	if f.SoftwareTable != "" {
+		return mailsoftware.LoadTable(f.SoftwareTable)
+	}
 	return nil
 }
 
@@ -149,6 +194,29 @@ func getIMAPError(response string) error {
 	return fmt.Errorf("error: %s", response)
 }
 
+// getTaggedError returns an error unless the tagged status line ending a
+// response is OK.
+func getTaggedError(response string) error {
+	lines := strings.Split(strings.TrimRight(response, "\r\n"), "\n")
+	if fields := strings.Fields(lines[len(lines)-1]); len(fields) >= 2 && strings.EqualFold(fields[1], "OK") {
+		return nil
+	}
+	return fmt.Errorf("error: %s", strings.TrimSpace(response))
+}
+
+// sendCapability sends CAPABILITY and returns the response and the
+// capabilities.
+func sendCapability(conn *Connection) (string, []string, error) {
+	ret, err := conn.SendTaggedCommand("CAPABILITY")
+	if err != nil {
+		return ret, nil, err
+	}
+	if err := getTaggedError(ret); err != nil {
+		return ret, nil, err
+	}
+	return ret, parseCapabilities(ret), nil
+}
+
 // Check the contents of the IMAP banner and return a relevant ScanStatus
 func VerifyIMAPContents(banner string) zgrab2.ScanStatus {
 	lowerBanner := strings.ToLower(banner)
@@ -177,8 +245,12 @@ func VerifyIMAPContents(banner string) zgrab2.ScanStatus {
 // 2. If --imaps is set, perform a TLS handshake using the command-line
 //    flags.
 // 3. Read the banner.
-// 6. If --starttls is sent, send a001 STARTTLS, read the result, negotiate a
-//    TLS connection using the command-line flags.
+// 4. If --capabilities is set, send CAPABILITY.
+// 5. If --starttls is sent, or --capabilities is set and the server offers
+//    STARTTLS, send a001 STARTTLS, read the result, negotiate a TLS
+//    connection using the command-line flags.
+// 6. If --capabilities is set, send CAPABILITY again after STARTTLS, and
+//    with --auth-probe start and cancel each AUTHENTICATE mechanism.
 // 7. If --send-close is sent, send a001 CLOSE and read the result.
 // 8. Close the connection.
 func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
@@ -211,7 +283,25 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		return sr, nil, errors.New("Invalid response for IMAP")
 	}
 	result.Banner = banner
-	if scanner.config.StartTLS {
+	result.Software = mailsoftware.Identify(banner)
+	startTLS := scanner.config.StartTLS
+	if scanner.config.Capabilities {
+		ret, capabilities, err := sendCapability(&conn)
+		result.Capability = ret
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		caps := &CapabilityResults{Capabilities: capabilities}
+		caps.AuthMechanisms = mailcaps.Mechanisms(capabilities, "AUTH")
+		caps.LoginDisabled = mailcaps.Has(capabilities, "LOGINDISABLED")
+		if !scanner.config.IMAPSecure {
+			caps.CleartextAuthMechanisms = caps.AuthMechanisms
+			caps.CleartextLogin = !caps.LoginDisabled
+			startTLS = startTLS || mailcaps.Has(capabilities, "STARTTLS")
+		}
+		result.Capabilities = caps
+	}
+	if startTLS {
 		ret, err := conn.SendCommand("a001 STARTTLS")
 		if err != nil {
 			return zgrab2.TryGetScanStatus(err), result, err
@@ -229,6 +319,23 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 		conn.Conn = tlsConn
+		if caps := result.Capabilities; caps != nil {
+			ret, capabilities, err := sendCapability(&conn)
+			result.CapabilityStartTLS = ret
+			if err != nil {
+				return zgrab2.TryGetScanStatus(err), result, err
+			}
+			caps.StartTLSCapabilities = capabilities
+			caps.Added, caps.Removed = mailcaps.Delta(caps.Capabilities, capabilities)
+			caps.AuthMechanisms = mailcaps.Mechanisms(capabilities, "AUTH")
+			caps.LoginDisabled = mailcaps.Has(capabilities, "LOGINDISABLED")
+		}
+	}
+	if caps := result.Capabilities; caps != nil && scanner.config.AuthProbe {
+		caps.AuthProbes, err = probeAuth(&conn, caps.AuthMechanisms)
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
 	}
 	if scanner.config.SendCLOSE {
 		ret, err := conn.SendCommand("a001 CLOSE")
@@ -239,5 +346,6 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		}
 		result.CLOSE = ret
 	}
+	result.TruncatedByTimeout = conn.TruncatedByTimeout
 	return sr, result, nil
 }
@@ -125,8 +125,14 @@ func getPrinterAttributesRequest(major, minor int8, uri string, tls bool) *bytes
 	AttributeByteString(0x48, "attributes-natural-language", "en-us", &b)
 	//printer-uri
 	AttributeByteString(0x45, "printer-uri", ConvertURIToIPP(uri, tls), &b)
-	//requested-attributes
-	AttributeByteString(0x44, "requested-attributes", "all", &b)
+	//requested-attributes, with the additional values of the set named ""
+	for i, attr := range requestedAttributes {
+		name := ""
+		if i == 0 {
+			name = "requested-attributes"
+		}
+		AttributeByteString(0x44, name, attr, &b)
+	}
 
 	//end-of-attributes-tag = 3
 	b.Write([]byte{3})
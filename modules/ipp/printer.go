@@ -0,0 +1,344 @@
+package ipp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Value tags of the attributes parsed into PrinterInfo (RFC 8010 Section 3.5.2).
+const (
+	tagBoolean       byte = 0x22
+	tagEnum          byte = 0x23
+	tagTextWithLang  byte = 0x35
+	tagNameWithLang  byte = 0x36
+	tagKeyword       byte = 0x44
+	tagURI           byte = 0x45
+	tagMimeMediaType byte = 0x49
+)
+
+// requestedAttributes are requested in addition to "all", since some printers
+// leave them out of "all".
+var requestedAttributes = []string{
+	"all",
+	"printer-make-and-model",
+	"printer-firmware-name",
+	"printer-firmware-string-version",
+	"printer-device-id",
+	"document-format-supported",
+	"operations-supported",
+	"uri-authentication-supported",
+	"uri-security-supported",
+	"printer-is-accepting-jobs",
+	"printer-state",
+}
+
+// operationNames names the IPP and CUPS operations of operations-supported.
+var operationNames = map[int32]string{
+	0x0002: "Print-Job",
+	0x0003: "Print-URI",
+	0x0004: "Validate-Job",
+	0x0005: "Create-Job",
+	0x0006: "Send-Document",
+	0x0007: "Send-URI",
+	0x0008: "Cancel-Job",
+	0x0009: "Get-Job-Attributes",
+	0x000a: "Get-Jobs",
+	0x000b: "Get-Printer-Attributes",
+	0x000c: "Hold-Job",
+	0x000d: "Release-Job",
+	0x000e: "Restart-Job",
+	0x0010: "Pause-Printer",
+	0x0011: "Resume-Printer",
+	0x0012: "Purge-Jobs",
+	0x0013: "Set-Printer-Attributes",
+	0x0014: "Set-Job-Attributes",
+	0x0015: "Get-Printer-Supported-Values",
+	0x0016: "Create-Printer-Subscriptions",
+	0x0017: "Create-Job-Subscriptions",
+	0x0018: "Get-Subscription-Attributes",
+	0x0019: "Get-Subscriptions",
+	0x001a: "Renew-Subscription",
+	0x001b: "Cancel-Subscription",
+	0x001c: "Get-Notifications",
+	0x0022: "Enable-Printer",
+	0x0023: "Disable-Printer",
+	0x0039: "Cancel-My-Jobs",
+	0x003b: "Close-Job",
+	0x003c: "Identify-Printer",
+	0x4001: "CUPS-Get-Default",
+	0x4002: "CUPS-Get-Printers",
+	0x4003: "CUPS-Add-Modify-Printer",
+	0x4004: "CUPS-Delete-Printer",
+	0x4005: "CUPS-Get-Classes",
+	0x4006: "CUPS-Add-Modify-Class",
+	0x4007: "CUPS-Delete-Class",
+	0x4008: "CUPS-Accept-Jobs",
+	0x4009: "CUPS-Reject-Jobs",
+	0x400a: "CUPS-Set-Default",
+	0x400b: "CUPS-Get-Devices",
+	0x400c: "CUPS-Get-PPDs",
+	0x400d: "CUPS-Move-Job",
+	0x400e: "CUPS-Authenticate-Job",
+	0x400f: "CUPS-Get-PPD",
+	0x4027: "CUPS-Get-Document",
+	0x4028: "CUPS-Create-Local-Printer",
+}
+
+// printerStates names the values of printer-state.
+var printerStates = map[int32]string{
+	3: "idle",
+	4: "processing",
+	5: "stopped",
+}
+
+// statusNames names the IPP status codes returned to Validate-Job.
+var statusNames = map[uint16]string{
+	0x0000: "successful-ok",
+	0x0001: "successful-ok-ignored-or-substituted-attributes",
+	0x0002: "successful-ok-conflicting-attributes",
+	0x0400: "client-error-bad-request",
+	0x0401: "client-error-forbidden",
+	0x0402: "client-error-not-authenticated",
+	0x0403: "client-error-not-authorized",
+	0x0404: "client-error-not-possible",
+	0x0406: "client-error-not-found",
+	0x040a: "client-error-document-format-not-supported",
+	0x040b: "client-error-attributes-or-values-not-supported",
+	0x0500: "server-error-internal-error",
+	0x0501: "server-error-operation-not-supported",
+	0x0503: "server-error-version-not-supported",
+	0x0506: "server-error-not-accepting-jobs",
+}
+
+// PrinterInfo holds the typed values of the main printer attributes of the
+// Get-Printer-Attributes response.
+type PrinterInfo struct {
+	Name         string `json:"name,omitempty"`
+	Info         string `json:"info,omitempty"`
+	Location     string `json:"location,omitempty"`
+	MakeAndModel string `json:"make_and_model,omitempty"`
+	DeviceID     string `json:"device_id,omitempty"`
+	UUID         string `json:"uuid,omitempty"`
+
+	// FirmwareNames and FirmwareVersions are the parallel
+	// printer-firmware-name and printer-firmware-string-version values.
+	FirmwareNames    []string `json:"firmware_names,omitempty"`
+	FirmwareVersions []string `json:"firmware_versions,omitempty"`
+
+	State         string `json:"state,omitempty"`
+	AcceptingJobs *bool  `json:"accepting_jobs,omitempty"`
+
+	DocumentFormats []string `json:"document_formats,omitempty"`
+	Operations      []string `json:"operations,omitempty"`
+
+	// URIAuthentication and URISecurity are the parallel
+	// uri-authentication-supported and uri-security-supported values for the
+	// printer URIs.
+	URIAuthentication []string `json:"uri_authentication,omitempty"`
+	URISecurity       []string `json:"uri_security,omitempty"`
+
+	// AuthRequired is true if every printer URI requires authentication,
+	// i.e. none of them uses "none" or "requesting-user-name".
+	AuthRequired bool `json:"auth_required"`
+}
+
+// PrintJobCheck is the response to a Validate-Job request without
+// credentials, which checks whether a Print-Job would be accepted without
+// printing anything.
+type PrintJobCheck struct {
+	// HTTPStatus is the HTTP status of the response, e.g. 401 if the
+	// printer requires HTTP authentication.
+	HTTPStatus int `json:"http_status,omitempty"`
+
+	StatusCode uint16 `json:"status_code"`
+	Status     string `json:"status,omitempty"`
+
+	// Allowed is true if the printer accepts the job without
+	// authentication.
+	Allowed bool `json:"allowed"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// stringValues returns the values of attr as strings.
+func stringValues(attr *Attribute) []string {
+	ret := make([]string, 0, len(attr.Values))
+	for _, value := range attr.Values {
+		b := value.Bytes
+		if attr.ValueTag == tagTextWithLang || attr.ValueTag == tagNameWithLang {
+			// The natural language and the text, each with a 2-byte length.
+			if len(b) >= 2 && len(b) >= 4+int(binary.BigEndian.Uint16(b)) {
+				b = b[4+int(binary.BigEndian.Uint16(b)):]
+			}
+		}
+		ret = append(ret, string(b))
+	}
+	return ret
+}
+
+// intValues returns the values of an integer or enum attribute.
+func intValues(attr *Attribute) []int32 {
+	var ret []int32
+	for _, value := range attr.Values {
+		if len(value.Bytes) == 4 {
+			ret = append(ret, int32(binary.BigEndian.Uint32(value.Bytes)))
+		}
+	}
+	return ret
+}
+
+// firstString returns the first value of attr, if any.
+func firstString(attr *Attribute) string {
+	if values := stringValues(attr); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// newPrinterInfo returns the PrinterInfo for the attributes of a
+// Get-Printer-Attributes response; the first attribute of each name is used.
+func newPrinterInfo(attrs []*Attribute) *PrinterInfo {
+	ret := new(PrinterInfo)
+	seen := make(map[string]bool)
+	for _, attr := range attrs {
+		if seen[attr.Name] {
+			continue
+		}
+		seen[attr.Name] = true
+		switch attr.Name {
+		case "printer-name":
+			ret.Name = firstString(attr)
+		case "printer-info":
+			ret.Info = firstString(attr)
+		case "printer-location":
+			ret.Location = firstString(attr)
+		case "printer-make-and-model":
+			ret.MakeAndModel = firstString(attr)
+		case "printer-device-id":
+			ret.DeviceID = firstString(attr)
+		case "printer-uuid":
+			ret.UUID = firstString(attr)
+		case "printer-firmware-name":
+			ret.FirmwareNames = stringValues(attr)
+		case "printer-firmware-string-version":
+			ret.FirmwareVersions = stringValues(attr)
+		case "printer-state":
+			if values := intValues(attr); len(values) > 0 {
+				ret.State = printerStates[values[0]]
+			}
+		case "printer-is-accepting-jobs":
+			if len(attr.Values) > 0 && len(attr.Values[0].Bytes) == 1 {
+				accepting := attr.Values[0].Bytes[0] != 0
+				ret.AcceptingJobs = &accepting
+			}
+		case "document-format-supported":
+			ret.DocumentFormats = stringValues(attr)
+		case "operations-supported":
+			for _, op := range intValues(attr) {
+				name, ok := operationNames[op]
+				if !ok {
+					name = fmt.Sprintf("0x%04x", op)
+				}
+				ret.Operations = append(ret.Operations, name)
+			}
+		case "uri-authentication-supported":
+			ret.URIAuthentication = stringValues(attr)
+		case "uri-security-supported":
+			ret.URISecurity = stringValues(attr)
+		}
+	}
+	ret.AuthRequired = len(ret.URIAuthentication) > 0
+	for _, auth := range ret.URIAuthentication {
+		if auth == "none" || auth == "requesting-user-name" {
+			ret.AuthRequired = false
+		}
+	}
+	return ret
+}
+
+// validateJobFormat returns the document-format of the Validate-Job
+// request: application/octet-stream if supported, otherwise the first
+// supported format.
+func validateJobFormat(printer *PrinterInfo) string {
+	if printer == nil || len(printer.DocumentFormats) == 0 {
+		return "application/octet-stream"
+	}
+	for _, format := range printer.DocumentFormats {
+		if format == "application/octet-stream" {
+			return format
+		}
+	}
+	return printer.DocumentFormats[0]
+}
+
+// getValidateJobRequest returns a Validate-Job request without credentials.
+func getValidateJobRequest(major, minor int8, uri string, tls bool, format string) *bytes.Buffer {
+	var b bytes.Buffer
+	//version
+	b.Write([]byte{byte(major), byte(minor)})
+	//operation-id = validate-job
+	b.Write([]byte{0, 4})
+	//request-id = 2
+	b.Write([]byte{0, 0, 0, 2})
+	//operation-attributes-tag = 1 (begins an attribute-group)
+	b.Write([]byte{1})
+
+	AttributeByteString(0x47, "attributes-charset", "utf-8", &b)
+	AttributeByteString(0x48, "attributes-natural-language", "en-us", &b)
+	AttributeByteString(tagURI, "printer-uri", ConvertURIToIPP(uri, tls), &b)
+	AttributeByteString(0x42, "requesting-user-name", "anonymous", &b)
+	AttributeByteString(0x42, "job-name", "zgrab", &b)
+	AttributeByteString(tagMimeMediaType, "document-format", format, &b)
+
+	//end-of-attributes-tag = 3
+	b.Write([]byte{3})
+
+	return &b
+}
+
+// checkPrintJob sends a Validate-Job request, which the printer answers as
+// it would a Print-Job without printing anything.
+func (scanner *Scanner) checkPrintJob(scan *scan, version *version) *PrintJobCheck {
+	ret := new(PrintJobCheck)
+	body := getValidateJobRequest(version.Major, version.Minor, scan.url, scan.tls, validateJobFormat(scan.results.Printer))
+	resp, err := sendIPPRequest(scan, body)
+	if resp != nil {
+		ret.HTTPStatus = resp.StatusCode
+	}
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	b := bufferFromBody(resp, scanner).Bytes()
+	if resp.StatusCode != 200 {
+		return ret
+	}
+	if len(b) < 4 {
+		ret.Error = "response too short"
+		return ret
+	}
+	ret.StatusCode = binary.BigEndian.Uint16(b[2:4])
+	ret.Status = statusNames[ret.StatusCode]
+	if ret.Status == "" {
+		ret.Status = fmt.Sprintf("0x%04x", ret.StatusCode)
+	}
+	// Status codes 0x0000-0x00ff are successful.
+	ret.Allowed = ret.StatusCode < 0x0100 && scan.results.Printer.supportsOperation("Print-Job")
+	return ret
+}
+
+// supportsOperation returns true if operations-supported lists the
+// operation, or is missing.
+func (printer *PrinterInfo) supportsOperation(name string) bool {
+	if printer == nil || len(printer.Operations) == 0 {
+		return true
+	}
+	for _, op := range printer.Operations {
+		if strings.EqualFold(op, name) {
+			return true
+		}
+	}
+	return false
+}
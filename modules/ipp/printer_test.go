@@ -0,0 +1,158 @@
+package ipp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// ippAttribute encodes an attribute with one or more values.
+func ippAttribute(b *bytes.Buffer, tag byte, name string, values ...[]byte) {
+	for i, value := range values {
+		b.WriteByte(tag)
+		if i > 0 {
+			name = ""
+		}
+		binary.Write(b, binary.BigEndian, int16(len(name)))
+		b.WriteString(name)
+		binary.Write(b, binary.BigEndian, int16(len(value)))
+		b.Write(value)
+	}
+}
+
+func enumValue(v int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v))
+	return b
+}
+
+// printerAttributesResponse is a Get-Printer-Attributes response of a printer
+// without authentication.
+func printerAttributesResponse() []byte {
+	var b bytes.Buffer
+	b.Write([]byte{2, 0, 0, 0, 0, 0, 0, 1, 1})
+	ippAttribute(&b, 0x47, "attributes-charset", []byte("utf-8"))
+	b.WriteByte(4)
+	ippAttribute(&b, 0x45, "printer-uri-supported", []byte("ipp://printer/ipp"))
+	ippAttribute(&b, tagKeyword, "uri-authentication-supported", []byte("none"))
+	ippAttribute(&b, tagKeyword, "uri-security-supported", []byte("none"))
+	ippAttribute(&b, 0x42, "printer-name", []byte("office"))
+	ippAttribute(&b, 0x41, "printer-make-and-model", []byte("Acme LaserJet 9"))
+	ippAttribute(&b, 0x42, "printer-firmware-name", []byte("main"), []byte("boot"))
+	ippAttribute(&b, 0x41, "printer-firmware-string-version", []byte("1.2.3"), []byte("0.9"))
+	ippAttribute(&b, tagEnum, "printer-state", enumValue(3))
+	ippAttribute(&b, tagBoolean, "printer-is-accepting-jobs", []byte{1})
+	ippAttribute(&b, tagMimeMediaType, "document-format-supported", []byte("application/pdf"), []byte("image/pwg-raster"))
+	ippAttribute(&b, tagEnum, "operations-supported", enumValue(0x0002), enumValue(0x0004), enumValue(0x000b), enumValue(0x7000))
+	ippAttribute(&b, tagKeyword, "ipp-versions-supported", []byte("1.1"), []byte("2.0"))
+	b.WriteByte(3)
+	return b.Bytes()
+}
+
+// serveIPP answers Get-Printer-Attributes, and Validate-Job with the given
+// status code.
+func serveIPP(t *testing.T, validateStatus uint16) uint {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if len(body) < 4 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		switch binary.BigEndian.Uint16(body[2:4]) {
+		case 0x000b:
+			w.Write(printerAttributesResponse())
+		case 0x0004:
+			response := []byte{2, 0, 0, 0, 0, 0, 0, 2, 1, 3}
+			binary.BigEndian.PutUint16(response[2:4], validateStatus)
+			w.Write(response)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return uint(p)
+}
+
+func scanIPP(t *testing.T, validateStatus uint16) *ScanResults {
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags:     zgrab2.BaseFlags{Port: serveIPP(t, validateStatus), Timeout: 5 * time.Second},
+		MaxSize:       256,
+		UserAgent:     "zgrab",
+		CheckPrintJob: true,
+	}
+	if err := scanner.Init(flags); err != nil {
+		t.Fatal(err)
+	}
+	status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	return result.(*ScanResults)
+}
+
+func TestPrinterInfo(t *testing.T) {
+	results := scanIPP(t, 0x0000)
+	accepting := true
+	expected := &PrinterInfo{
+		Name:              "office",
+		MakeAndModel:      "Acme LaserJet 9",
+		FirmwareNames:     []string{"main", "boot"},
+		FirmwareVersions:  []string{"1.2.3", "0.9"},
+		State:             "idle",
+		AcceptingJobs:     &accepting,
+		DocumentFormats:   []string{"application/pdf", "image/pwg-raster"},
+		Operations:        []string{"Print-Job", "Validate-Job", "Get-Printer-Attributes", "0x7000"},
+		URIAuthentication: []string{"none"},
+		URISecurity:       []string{"none"},
+	}
+	if !reflect.DeepEqual(results.Printer, expected) {
+		t.Errorf("unexpected printer info %+v", results.Printer)
+	}
+	if check := results.PrintJob; check == nil || !check.Allowed || check.Status != "successful-ok" {
+		t.Errorf("unexpected print job check %+v", check)
+	}
+}
+
+func TestPrintJobNotAuthenticated(t *testing.T) {
+	results := scanIPP(t, 0x0402)
+	if check := results.PrintJob; check == nil || check.Allowed || check.Status != "client-error-not-authenticated" {
+		t.Errorf("unexpected print job check %+v", check)
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	attrs := []*Attribute{{
+		Name:     "uri-authentication-supported",
+		ValueTag: tagKeyword,
+		Values:   []Value{{Bytes: []byte("basic")}, {Bytes: []byte("digest")}},
+	}}
+	if !newPrinterInfo(attrs).AuthRequired {
+		t.Error("expected authentication to be required")
+	}
+	attrs[0].Values = append(attrs[0].Values, Value{Bytes: []byte("requesting-user-name")})
+	if newPrinterInfo(attrs).AuthRequired {
+		t.Error("expected authentication not to be required")
+	}
+}
+
+func TestValidateJobFormat(t *testing.T) {
+	if format := validateJobFormat(&PrinterInfo{DocumentFormats: []string{"application/pdf", "application/octet-stream"}}); format != "application/octet-stream" {
+		t.Errorf("got %s", format)
+	}
+	if format := validateJobFormat(&PrinterInfo{DocumentFormats: []string{"application/pdf"}}); format != "application/pdf" {
+		t.Errorf("got %s", format)
+	}
+}
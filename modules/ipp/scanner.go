@@ -4,6 +4,7 @@ package ipp
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
@@ -75,6 +76,13 @@ type ScanResults struct {
 	AttributeIPPVersions []string     `json:"attr_ipp_versions,omitempty"`
 	AttributePrinterURIs []string     `json:"attr_printer_uris,omitempty"`
 
+	// Printer holds the typed printer attributes of the
+	// Get-Printer-Attributes response.
+	Printer *PrinterInfo `json:"printer,omitempty"`
+
+	// PrintJob is the result of the --check-print-job Validate-Job request.
+	PrintJob *PrintJobCheck `json:"print_job,omitempty"`
+
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
 }
 
@@ -97,6 +105,8 @@ type Flags struct {
 
 	// TODO: Maybe separately implement both an ipps connection and upgrade to https
 	IPPSecure bool `long:"ipps" description:"Perform a TLS handshake immediately upon connecting."`
+
+	CheckPrintJob bool `long:"check-print-job" description:"Send a Validate-Job request without credentials to check whether the printer accepts unauthenticated print jobs. Nothing is printed."`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -134,6 +144,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for printers via IPP"
@@ -571,6 +586,10 @@ func (scanner *Scanner) Grab(scan *scan, target *zgrab2.ScanTarget, version *ver
 	if err := scanner.tryReadAttributes(scan.results.Response, scan); err != nil {
 		return err
 	}
+	scan.results.Printer = newPrinterInfo(scan.results.Attributes)
+	if scanner.config.CheckPrintJob {
+		scan.results.PrintJob = scanner.checkPrintJob(scan, version)
+	}
 	if scan.results.CUPSVersion != "" {
 		err := scanner.augmentWithCUPSData(scan, target, version)
 		if err != nil {
@@ -622,9 +641,9 @@ func (scan *scan) getCheckRedirect(scanner *Scanner) func(*http.Request, *http.R
 }
 
 // Taken from zgrab2 http library, slightly modified to use slightly leaner scan object
-func (scan *scan) getTLSDialer(scanner *Scanner) func(net, addr string) (net.Conn, error) {
+func (scan *scan) getTLSDialer(scanner *Scanner, dialer *zgrab2.Dialer) func(net, addr string) (net.Conn, error) {
 	return func(net, addr string) (net.Conn, error) {
-		outer, err := zgrab2.DialTimeoutConnection(net, addr, scanner.config.BaseFlags.Timeout, 0)
+		outer, err := dialer.DialContext(context.Background(), net, addr)
 		if err != nil {
 			return nil, err
 		}
@@ -664,8 +683,12 @@ func (scanner *Scanner) newIPPScan(target *zgrab2.ScanTarget, tls bool) *scan {
 		DisableCompression:  false,
 		MaxIdleConnsPerHost: scanner.config.MaxRedirects,
 	}
-	transport.DialTLS = newScan.getTLSDialer(scanner)
-	transport.DialContext = zgrab2.GetTimeoutConnectionDialer(scanner.config.Timeout).DialContext
+	// The connections are dialed through the target, with the options of
+	// its runner.
+	dialer := zgrab2.GetTimeoutConnectionDialer(scanner.config.Timeout)
+	dialer.Target = target
+	transport.DialTLS = newScan.getTLSDialer(scanner, dialer)
+	transport.DialContext = dialer.DialContext
 	newScan.client.CheckRedirect = newScan.getCheckRedirect(scanner)
 	newScan.client.UserAgent = scanner.config.UserAgent
 	newScan.client.Transport = transport
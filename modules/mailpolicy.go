@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/Positive-Engineer/zgrab2/modules/mailpolicy"
+
+func init() {
+	mailpolicy.RegisterModule()
+}
@@ -0,0 +1,197 @@
+// Package mailpolicy provides a zgrab2 module that checks the DANE and
+// MTA-STS policies of a mail domain without connecting to its servers.
+//
+// For a target domain, the module looks up the MX hosts (or uses the domain
+// itself if it has none), the TLSA records of each host on the module port
+// (default 25), and the MTA-STS record and policy of the domain, and reports
+// whether every host is covered: DANE requires DNSSEC-validated MX and
+// usable TLSA records for every host, MTA-STS a valid policy whose mx
+// patterns match every host. Lookups use the --dns-resolver resolver.
+//
+// The certificates of the servers are checked by the smtp module's
+// --mail-policy option.
+package mailpolicy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/mailpolicy"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxMXHosts bounds the MX hosts checked per domain.
+const maxMXHosts = 10
+
+// Flags holds the command-line configuration for the mailpolicy module.
+type Flags struct {
+	zgrab2.BaseFlags
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// MXHost is a mail server of the domain and its policies.
+type MXHost struct {
+	Host       string `json:"host"`
+	Preference uint16 `json:"preference"`
+
+	DANE *mailpolicy.DANEResult `json:"dane"`
+
+	// MTASTSMatch is true if the host matches the mx patterns of the
+	// MTA-STS policy.
+	MTASTSMatch bool `json:"mta_sts_match"`
+}
+
+// Results holds the policies of a mail domain.
+type Results struct {
+	Domain string `json:"domain"`
+
+	// MXAuthenticated is true if the resolver validated the MX records
+	// with DNSSEC, which DANE requires.
+	MXAuthenticated bool `json:"mx_authenticated"`
+
+	// ImplicitMX is true if the domain has no MX records, so that mail is
+	// delivered to the domain itself.
+	ImplicitMX bool `json:"implicit_mx,omitempty"`
+
+	MX     []MXHost                 `json:"mx,omitempty"`
+	MTASTS *mailpolicy.MTASTSResult `json:"mta_sts"`
+
+	// DANEConformant is true if the MX records are authenticated and every
+	// host has usable TLSA records.
+	DANEConformant bool `json:"dane_conformant"`
+
+	// MTASTSConformant is true if the domain has a valid MTA-STS policy in
+	// enforce or testing mode whose mx patterns match every host.
+	MTASTSConformant bool `json:"mta_sts_conformant"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("mailpolicy", "mail domain DANE and MTA-STS policies", module.Description(), 25, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Check the DANE TLSA records and MTA-STS policy of a mail domain"
+}
+
+// Validate checks that the flags are valid.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "mailpolicy"
+}
+
+// Scan looks up the policies of the target domain. Lookup failures of TLSA
+// records and of the MTA-STS policy are recorded in the results; only a
+// failed MX lookup fails the scan.
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	domain := strings.TrimSuffix(target.Domain, ".")
+	if domain == "" {
+		return zgrab2.SCAN_UNKNOWN_ERROR, nil, errors.New("mailpolicy needs a domain name target")
+	}
+	port := scanner.config.Port
+	if target.Port != nil {
+		port = *target.Port
+	}
+	timeout := scanner.config.Timeout
+
+	response, err := zgrab2.LookupDNS(domain, zgrab2.DNSTypeMX, timeout)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	if response.RCode != 0 {
+		return zgrab2.SCAN_APPLICATION_ERROR, nil, fmt.Errorf("MX lookup of %s failed with rcode %d", domain, response.RCode)
+	}
+	result := &Results{Domain: domain, MXAuthenticated: response.Authenticated}
+	for _, answer := range response.Answers {
+		// A null MX (RFC 7505) has the root as exchange.
+		if answer.Target != "" {
+			result.MX = append(result.MX, MXHost{Host: answer.Target, Preference: answer.Preference})
+		}
+	}
+	if len(response.Answers) == 0 {
+		result.ImplicitMX = true
+		result.MX = []MXHost{{Host: domain}}
+	}
+	sort.SliceStable(result.MX, func(i, j int) bool {
+		return result.MX[i].Preference < result.MX[j].Preference
+	})
+	if len(result.MX) > maxMXHosts {
+		result.MX = result.MX[:maxMXHosts]
+	}
+
+	result.MTASTS = mailpolicy.FetchMTASTS(domain, timeout)
+	result.DANEConformant = result.MXAuthenticated && len(result.MX) > 0
+	result.MTASTSConformant = result.MTASTS.Policy != nil && result.MTASTS.Policy.Mode != "none" && len(result.MX) > 0
+	for i := range result.MX {
+		host := &result.MX[i]
+		host.DANE = mailpolicy.LookupDANE(host.Host, port, timeout)
+		result.DANEConformant = result.DANEConformant && host.DANE.Usable
+		if policy := result.MTASTS.Policy; policy != nil {
+			host.MTASTSMatch = policy.MatchMX(host.Host)
+		}
+		result.MTASTSConformant = result.MTASTSConformant && host.MTASTSMatch
+	}
+	return zgrab2.SCAN_SUCCESS, result, nil
+}
@@ -0,0 +1,345 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+const (
+	// FunctionCodeReadCoils identifies the Read Coils function.
+	FunctionCodeReadCoils = FunctionCode(0x01)
+
+	// FunctionCodeReadHoldingRegisters identifies the Read Holding Registers function.
+	FunctionCodeReadHoldingRegisters = FunctionCode(0x03)
+)
+
+// Exception codes returned by a gateway for a unit it cannot reach.
+const (
+	exceptionGatewayPathUnavailable = 0x0A
+	exceptionGatewayTargetFailed    = 0x0B
+)
+
+// maxReadCount bounds the number of coils or registers read by
+// --read-coils and --read-registers.
+const maxReadCount = 16
+
+// maxDeviceIDRequests bounds the number of requests sent to walk the device
+// identification objects.
+const maxDeviceIDRequests = 32
+
+// deviceIDCategories are the Read Device ID codes walked by --device-id-walk,
+// with the first object ID of each category.
+var deviceIDCategories = []struct {
+	code        byte
+	name        string
+	firstObject byte
+}{
+	{0x01, "basic", 0x00},
+	{0x02, "regular", 0x03},
+	{0x03, "extended", 0x80},
+}
+
+// DeviceIdentification is the set of identification objects of all
+// categories supported by the device.
+type DeviceIdentification struct {
+	// ConformityLevel is the conformity level of the first response.
+	ConformityLevel int `json:"conformity_level"`
+
+	// Categories are the categories that were read, e.g. "basic", "regular".
+	Categories []string `json:"categories,omitempty"`
+
+	// Objects are the objects returned for all categories.
+	Objects MEIObjectSet `json:"objects,omitempty"`
+
+	// Requests is the number of requests sent.
+	Requests int `json:"requests"`
+
+	// Error is set if the walk stopped early.
+	Error string `json:"error,omitempty"`
+}
+
+// Sample is the response to a read of a small range of coils or holding
+// registers.
+type Sample struct {
+	Address uint16 `json:"address"`
+
+	// Coils or Registers are the values read, starting at Address.
+	Coils     []bool   `json:"coils,omitempty"`
+	Registers []uint16 `json:"registers,omitempty"`
+
+	// Exception is the exception returned instead of the values. It still
+	// shows that the unit responds.
+	Exception *ExceptionResponse `json:"exception,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// UnitResult is the result for one unit ID of --unit-id-range.
+type UnitResult struct {
+	UnitID int `json:"unit_id"`
+
+	// Responded is true if the unit answered, even with an exception; a
+	// gateway exception (0x0A or 0x0B) does not count.
+	Responded bool `json:"responded"`
+
+	// Event is the response to the device identification request, along
+	// with the enabled checks.
+	Event *ModbusEvent `json:"event,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// isGatewayException returns true if the exception was returned by a gateway
+// for an unreachable unit.
+func (e *ExceptionResponse) isGatewayException() bool {
+	return e != nil && (e.ExceptionType == exceptionGatewayPathUnavailable || e.ExceptionType == exceptionGatewayTargetFailed)
+}
+
+// parseUnitIDRange parses a unit ID range of the form "first-last", or a
+// single unit ID.
+func parseUnitIDRange(value string) (first uint8, last uint8, err error) {
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) == 1 {
+		parts = append(parts, parts[0])
+	}
+	var bounds [2]uint8
+	for i, part := range parts {
+		n, err := strconv.ParseUint(strings.TrimSpace(part), 0, 8)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid unit ID range %q", value)
+		}
+		bounds[i] = uint8(n)
+	}
+	if bounds[0] > bounds[1] {
+		return 0, 0, fmt.Errorf("invalid unit ID range %q", value)
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// request sends req and reads the response. Once a request fails, the
+// connection is marked as failed, since a late response would be read as the
+// response to the next request.
+func (c *Conn) request(req *ModbusRequest) (*ModbusResponse, error) {
+	data, err := c.MarshalRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	for w := 0; w < len(data); {
+		written, err := c.getUnderlyingConn().Write(data[w:])
+		w += written
+		if err != nil {
+			c.failed = true
+			return nil, err
+		}
+	}
+	res, err := c.GetModbusResponse()
+	if res == nil && err == nil {
+		err = errors.New("modbus: empty response")
+	}
+	if err != nil {
+		c.failed = true
+	}
+	return res, err
+}
+
+// walkDeviceID reads the objects of each Read Device ID category up to the
+// device's conformity level, following MoreFollows / NextObjectID.
+func (c *Conn) walkDeviceID(unitID uint8) *DeviceIdentification {
+	ret := new(DeviceIdentification)
+	seen := make(map[MEIObjectID]bool)
+	for _, category := range deviceIDCategories {
+		if ret.Requests > 0 && ret.ConformityLevel&0x7F < int(category.code) {
+			break
+		}
+		objectID := category.firstObject
+		for {
+			if ret.Requests == maxDeviceIDRequests {
+				ret.Error = "too many requests"
+				return ret
+			}
+			ret.Requests++
+			res, err := c.request(&ModbusRequest{
+				UnitID:   int(unitID),
+				Function: FunctionCodeMEI,
+				Data:     []byte{0x0E, category.code, objectID},
+			})
+			if res == nil {
+				ret.Error = err.Error()
+				return ret
+			}
+			if res.IsException() {
+				ex, _ := res.getExceptionResponse(false)
+				ret.Error = fmt.Sprintf("%s category: exception 0x%02x", category.name, ex.ExceptionType)
+				return ret
+			}
+			mei, err := res.getMEIResponse(category.code, c.scanner.config.Strict)
+			if err != nil {
+				ret.Error = err.Error()
+				return ret
+			}
+			if ret.Requests == 1 {
+				ret.ConformityLevel = mei.ConformityLevel
+			}
+			for _, obj := range mei.Objects {
+				// Devices may return the lower categories' objects too.
+				if obj.Value != "" && !seen[obj.OID] {
+					seen[obj.OID] = true
+					ret.Objects = append(ret.Objects, obj)
+				}
+			}
+			if !mei.MoreFollows {
+				break
+			}
+			if mei.NextObjectID <= int(objectID) {
+				ret.Error = fmt.Sprintf("%s category: invalid next object ID 0x%02x", category.name, mei.NextObjectID)
+				return ret
+			}
+			objectID = byte(mei.NextObjectID)
+		}
+		ret.Categories = append(ret.Categories, category.name)
+	}
+	return ret
+}
+
+// readSample reads the configured range of coils or holding registers.
+func (c *Conn) readSample(unitID uint8, function FunctionCode) *Sample {
+	config := c.scanner.config
+	ret := &Sample{Address: config.ReadAddress}
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:2], config.ReadAddress)
+	binary.BigEndian.PutUint16(data[2:4], config.ReadCount)
+	res, err := c.request(&ModbusRequest{UnitID: int(unitID), Function: function, Data: data})
+	if res == nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	if res.IsException() {
+		ret.Exception, _ = res.getExceptionResponse(false)
+		return ret
+	}
+	if err := ret.parse(res, function, int(config.ReadCount)); err != nil {
+		ret.Error = err.Error()
+	}
+	return ret
+}
+
+// parse decodes count values from a Read Coils or Read Holding Registers
+// response.
+func (s *Sample) parse(res *ModbusResponse, function FunctionCode, count int) error {
+	if res.Function != function {
+		return fmt.Errorf("invalid response function code 0x%02x", res.Function)
+	}
+	if len(res.Data) < 1 || int(res.Data[0]) != len(res.Data)-1 {
+		return errors.New("invalid byte count")
+	}
+	values := res.Data[1:]
+	switch function {
+	case FunctionCodeReadCoils:
+		if len(values) < (count+7)/8 {
+			return errors.New("response too short")
+		}
+		s.Coils = make([]bool, count)
+		for i := range s.Coils {
+			s.Coils[i] = values[i/8]&(1<<uint(i%8)) != 0
+		}
+	case FunctionCodeReadHoldingRegisters:
+		if len(values) < 2*count {
+			return errors.New("response too short")
+		}
+		s.Registers = make([]uint16, count)
+		for i := range s.Registers {
+			s.Registers[i] = binary.BigEndian.Uint16(values[2*i:])
+		}
+	}
+	return nil
+}
+
+// runChecks runs the enabled device identification walk and coil / register
+// reads for the unit that answered with event.
+func (c *Conn) runChecks(unitID uint8, event *ModbusEvent) {
+	config := c.scanner.config
+	if event.ExceptionResponse.isGatewayException() {
+		return
+	}
+	if config.DeviceIDWalk && event.MEIResponse != nil {
+		event.DeviceIdentification = c.walkDeviceID(unitID)
+		if len(event.DeviceIdentification.Objects) > 0 {
+			// The regular category may name the product.
+			event.ICSDevice = (&MEIResponse{Objects: event.DeviceIdentification.Objects}).icsDevice()
+		}
+	}
+	if config.ReadCoils {
+		event.Coils = c.readSample(unitID, FunctionCodeReadCoils)
+	}
+	if config.ReadRegisters {
+		event.Registers = c.readSample(unitID, FunctionCodeReadHoldingRegisters)
+	}
+}
+
+// probeUnit sends the device identification request of the scan to the unit,
+// and runs the enabled checks if it responds.
+func (c *Conn) probeUnit(unitID uint8) (*ModbusEvent, error) {
+	config := c.scanner.config
+	res, err := c.request(&ModbusRequest{
+		UnitID:   int(unitID),
+		Function: FunctionCodeMEI,
+		Data:     []byte{0x0E, 0x01, config.ObjectID},
+	})
+	if res == nil {
+		return nil, err
+	}
+	if res.Function&0x7F != FunctionCodeMEI {
+		return nil, fmt.Errorf("invalid response function code 0x%02x", res.Function)
+	}
+	if config.Strict && res.UnitID != int(unitID) {
+		return nil, fmt.Errorf("invalid response unit ID 0x%02x", res.UnitID)
+	}
+	event, err := res.getEvent(config.Strict)
+	if err != nil {
+		return nil, err
+	}
+	c.runChecks(unitID, event)
+	return event, nil
+}
+
+// sweepUnits probes each unit ID of --unit-id-range. The units share a
+// connection, which is reopened after a failed request.
+func (scanner *Scanner) sweepUnits(target *zgrab2.ScanTarget) []*UnitResult {
+	var c *Conn
+	defer func() {
+		if c != nil {
+			c.Conn.Close()
+		}
+	}()
+	ret := make([]*UnitResult, 0, int(scanner.lastUnitID)-int(scanner.firstUnitID)+1)
+	for id := int(scanner.firstUnitID); id <= int(scanner.lastUnitID); id++ {
+		unit := &UnitResult{UnitID: id}
+		ret = append(ret, unit)
+		if c == nil {
+			conn, err := target.Open(&scanner.config.BaseFlags)
+			if err != nil {
+				unit.Error = err.Error()
+				continue
+			}
+			c = &Conn{Conn: conn, scanner: scanner}
+		}
+		event, err := c.probeUnit(uint8(id))
+		if err != nil {
+			unit.Error = err.Error()
+		}
+		if event != nil {
+			unit.Event = event
+			unit.Responded = !event.ExceptionResponse.isGatewayException()
+		}
+		if c.failed {
+			c.Conn.Close()
+			c = nil
+		}
+	}
+	return ret
+}
@@ -0,0 +1,166 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// meiObjects encodes the objects of a Read Device ID response.
+func meiObjects(objects ...MEIObject) []byte {
+	var ret []byte
+	for _, obj := range objects {
+		ret = append(ret, byte(obj.OID), byte(len(obj.Value)))
+		ret = append(ret, obj.Value...)
+	}
+	return ret
+}
+
+// deviceIDResponse returns the response data of unit 1 to a Read Device ID
+// request: the basic category takes two requests, the regular and extended
+// categories one each.
+func deviceIDResponse(code, objectID byte) []byte {
+	header := func(more bool, next byte, count byte) []byte {
+		ret := []byte{0x0E, code, 0x83, 0x00, next, count}
+		if more {
+			ret[3] = 0xFF
+		}
+		return ret
+	}
+	switch {
+	case code == 0x01 && objectID < 2:
+		return append(header(true, 2, 2), meiObjects(MEIObject{OIDVendor, "Acme"}, MEIObject{OIDProductCode, "PLC-1"})...)
+	case code == 0x01:
+		return append(header(false, 0, 1), meiObjects(MEIObject{OIDRevision, "V1.2"})...)
+	case code == 0x02:
+		return append(header(false, 0, 2), meiObjects(MEIObject{OIDVendorURL, "http://acme"}, MEIObject{OIDProductName, "Acme PLC"})...)
+	default:
+		return append(header(false, 0, 1), meiObjects(MEIObject{0x80, "ext"})...)
+	}
+}
+
+// serveModbus answers for unit 1, and with a gateway exception for other
+// units.
+func serveModbus(t *testing.T) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					header := make([]byte, 7)
+					if _, err := io.ReadFull(conn, header); err != nil {
+						return
+					}
+					body := make([]byte, binary.BigEndian.Uint16(header[4:6])-1)
+					if _, err := io.ReadFull(conn, body); err != nil {
+						return
+					}
+					function, data := body[0], body[1:]
+					var response []byte
+					switch {
+					case header[6] != 1:
+						response = []byte{function | 0x80, exceptionGatewayTargetFailed}
+					case function == 0x2B:
+						response = append([]byte{function}, deviceIDResponse(data[1], data[2])...)
+					case function == 0x01:
+						response = []byte{function, 1, 0x05}
+					default:
+						response = []byte{function, 16}
+						for i := 0; i < 8; i++ {
+							response = append(response, 0, byte(10*i))
+						}
+					}
+					binary.BigEndian.PutUint16(header[4:6], uint16(len(response)+1))
+					conn.Write(append(header, response...))
+				}
+			}(conn)
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestExtendedProbe(t *testing.T) {
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags:     zgrab2.BaseFlags{Port: serveModbus(t), Timeout: 5 * time.Second},
+		UnitID:        1,
+		RequestID:     0x5A47,
+		DeviceIDWalk:  true,
+		ReadCoils:     true,
+		ReadRegisters: true,
+		ReadCount:     8,
+		UnitIDRange:   "1-2",
+	}
+	if err := scanner.Init(flags); err != nil {
+		t.Fatal(err)
+	}
+	status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	event := result.(*ModbusEvent)
+	expected := &DeviceIdentification{
+		ConformityLevel: 0x83,
+		Categories:      []string{"basic", "regular", "extended"},
+		Objects: MEIObjectSet{
+			{OIDVendor, "Acme"},
+			{OIDProductCode, "PLC-1"},
+			{OIDRevision, "V1.2"},
+			{OIDVendorURL, "http://acme"},
+			{OIDProductName, "Acme PLC"},
+			{0x80, "ext"},
+		},
+		Requests: 4,
+	}
+	if !reflect.DeepEqual(event.DeviceIdentification, expected) {
+		t.Errorf("unexpected device identification %+v", event.DeviceIdentification)
+	}
+	if event.ICSDevice == nil || event.ICSDevice.Product != "Acme PLC" {
+		t.Errorf("unexpected ICS device %+v", event.ICSDevice)
+	}
+	coils := []bool{true, false, true, false, false, false, false, false}
+	if event.Coils == nil || !reflect.DeepEqual(event.Coils.Coils, coils) {
+		t.Errorf("unexpected coils %+v", event.Coils)
+	}
+	registers := []uint16{0, 10, 20, 30, 40, 50, 60, 70}
+	if event.Registers == nil || !reflect.DeepEqual(event.Registers.Registers, registers) {
+		t.Errorf("unexpected registers %+v", event.Registers)
+	}
+	if len(event.Units) != 2 {
+		t.Fatalf("expected 2 units, got %d", len(event.Units))
+	}
+	if unit := event.Units[0]; !unit.Responded || unit.Event == nil || unit.Event.Coils == nil || unit.Error != "" {
+		t.Errorf("unexpected unit 1 result %+v", unit)
+	}
+	if unit := event.Units[1]; unit.Responded || unit.Event == nil || unit.Event.ExceptionResponse == nil || unit.Event.Coils != nil {
+		t.Errorf("unexpected unit 2 result %+v", unit)
+	}
+}
+
+func TestParseUnitIDRange(t *testing.T) {
+	if first, last, err := parseUnitIDRange("1-16"); err != nil || first != 1 || last != 16 {
+		t.Errorf("got %d-%d, %v", first, last, err)
+	}
+	if first, last, err := parseUnitIDRange("5"); err != nil || first != 5 || last != 5 {
+		t.Errorf("got %d-%d, %v", first, last, err)
+	}
+	for _, value := range []string{"16-1", "1-256", "a"} {
+		if _, _, err := parseUnitIDRange(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+
+	"github.com/Positive-Engineer/zgrab2"
 )
 
 // MEIResponse is the parsed data field from the 0x2B/0x0E response.
@@ -156,6 +158,19 @@ type ModbusEvent struct {
 
 	// Raw is the full raw response from the server, including the header.
 	Raw []byte `json:"raw,omitempty"`
+
+	// ICSDevice summarizes the device identification objects.
+	ICSDevice *zgrab2.ICSDevice `json:"ics_device,omitempty"`
+
+	// DeviceIdentification holds the objects of all categories (--device-id-walk).
+	DeviceIdentification *DeviceIdentification `json:"device_identification,omitempty"`
+
+	// Coils and Registers are the values read with --read-coils and --read-registers.
+	Coils     *Sample `json:"coils,omitempty"`
+	Registers *Sample `json:"registers,omitempty"`
+
+	// Units are the results for each unit ID of --unit-id-range.
+	Units []*UnitResult `json:"units,omitempty"`
 }
 
 // IsException returns true if this response indicates an exception has occurred.
@@ -181,15 +196,40 @@ func (m *ModbusResponse) getEvent(strict bool) (*ModbusEvent, error) {
 		ret.ExceptionResponse = ex
 	} else {
 		// TODO: This is only valid for 0x0E.
-		mei, err := m.getMEIResponse(strict)
+		mei, err := m.getMEIResponse(0x01, strict)
 		if err != nil {
 			return nil, err
 		}
 		ret.MEIResponse = mei
 	}
+	ret.ICSDevice = ret.MEIResponse.icsDevice()
 	return ret, nil
 }
 
+// icsDevice returns the ICSDevice for the identification objects; the
+// product is the product name, or the model name or product code if that
+// is missing. A nil response (e.g. an exception) only identifies the
+// protocol.
+func (m *MEIResponse) icsDevice() *zgrab2.ICSDevice {
+	objects := make(map[MEIObjectID]string)
+	if m != nil {
+		for _, obj := range m.Objects {
+			// Objects past a truncated one are left zero.
+			if obj.Value != "" {
+				objects[obj.OID] = obj.Value
+			}
+		}
+	}
+	product := objects[OIDProductName]
+	if product == "" {
+		product = objects[OIDModelName]
+	}
+	if product == "" {
+		product = objects[OIDProductCode]
+	}
+	return zgrab2.NewICSDevice("modbus", objects[OIDVendor], product, objects[OIDRevision], "")
+}
+
 func (m *ModbusResponse) getExceptionResponse(strict bool) (*ExceptionResponse, error) {
 	exceptionFunction := m.Function & 0x7F
 	var exceptionType byte
@@ -204,7 +244,9 @@ func (m *ModbusResponse) getExceptionResponse(strict bool) (*ExceptionResponse,
 	}, nil
 }
 
-func (m *ModbusResponse) getMEIResponse(strict bool) (*MEIResponse, error) {
+// getMEIResponse parses the response to a Read Device ID request with the
+// given code (0x01 basic, 0x02 regular, 0x03 extended, 0x04 specific).
+func (m *ModbusResponse) getMEIResponse(readType byte, strict bool) (*MEIResponse, error) {
 	if m.Function != FunctionCodeMEI {
 		return nil, fmt.Errorf("Invalid function code 0x%02x", m.Function)
 	}
@@ -215,10 +257,8 @@ func (m *ModbusResponse) getMEIResponse(strict bool) (*MEIResponse, error) {
 	if meiType != 0x0E {
 		return nil, fmt.Errorf("Invalid response data (expected 0xee, got 0x%02x)", meiType)
 	}
-	// TODO: Allow different values here
-	readType := m.Data[1]
-	if readType != 1 {
-		return nil, fmt.Errorf("Invalid response data (expected 0x01, got 0x%02x)", readType)
+	if m.Data[1] != readType {
+		return nil, fmt.Errorf("Invalid response data (expected 0x%02x, got 0x%02x)", readType, m.Data[1])
 	}
 	conformityLevel := m.Data[2]
 	moreFollows := (m.Data[3] != 0)
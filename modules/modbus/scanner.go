@@ -14,6 +14,16 @@
 // The --strict flag allows turning on new validity checks beyond those
 // done in the original zgrab, to help rule out false matches.
 //
+// The --device-id-walk flag reads all basic, regular and extended device
+// identification objects the device's conformity level allows, following
+// MoreFollows / NextObjectID.
+//
+// The --read-coils and --read-registers flags read --read-count (at most 16)
+// coils or holding registers from --read-address, to confirm the unit responds.
+//
+// The --unit-id-range flag (e.g. 1-16) probes each unit ID of the range after
+// the main probe, with the same device identification request and checks.
+//
 // The output is the same as the original ZGrab: a "modbus event" object,
 // with either the parsed MEI response or the parsed exception info.
 // The only addition is a "raw" field containing the raw response data.
@@ -38,6 +48,13 @@ type Flags struct {
 	Strict    bool   `long:"strict" description:"If set, perform stricter checks on the response data to get fewer false positives"`
 	RequestID uint16 `long:"request-id" description:"Override the default request ID." default:"0x5A47"`
 	Verbose   bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+
+	DeviceIDWalk  bool   `long:"device-id-walk" description:"Read all basic, regular and extended device identification objects"`
+	ReadCoils     bool   `long:"read-coils" description:"Read a small range of coils"`
+	ReadRegisters bool   `long:"read-registers" description:"Read a small range of holding registers"`
+	ReadAddress   uint16 `long:"read-address" description:"The first coil / register to read" default:"0"`
+	ReadCount     uint16 `long:"read-count" description:"The number of coils / registers to read (at most 16)" default:"8"`
+	UnitIDRange   string `long:"unit-id-range" description:"Also probe each unit ID of the range, e.g. 1-16"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -47,6 +64,10 @@ type Module struct {
 // Scanner implements the zgrab2.Scanner interface.
 type Scanner struct {
 	config *Flags
+
+	// firstUnitID and lastUnitID bound --unit-id-range.
+	firstUnitID uint8
+	lastUnitID  uint8
 }
 
 // RegisterModule registers the zgrab2 module.
@@ -68,6 +89,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(ModbusEvent)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for Modbus devices, usually PLCs as part of a SCADA system"
@@ -83,6 +109,16 @@ func (flags *Flags) Validate(args []string) error {
 			log.Warnf("ObjectIDs 0x07...0x7F are reserved (requested 0x%02x)", flags.ObjectID)
 		}
 	}
+	if (flags.ReadCoils || flags.ReadRegisters) && (flags.ReadCount == 0 || flags.ReadCount > maxReadCount) {
+		log.Errorf("--read-count must be between 1 and %d", maxReadCount)
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.UnitIDRange != "" {
+		if _, _, err := parseUnitIDRange(flags.UnitIDRange); err != nil {
+			log.Error(err)
+			return zgrab2.ErrInvalidArguments
+		}
+	}
 	return nil
 }
 
@@ -95,6 +131,13 @@ func (flags *Flags) Help() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*Flags)
 	scanner.config = f
+	if f.UnitIDRange != "" {
+		first, last, err := parseUnitIDRange(f.UnitIDRange)
+		if err != nil {
+			return err
+		}
+		scanner.firstUnitID, scanner.lastUnitID = first, last
+	}
 	return nil
 }
 
@@ -123,6 +166,9 @@ func (scanner *Scanner) Protocol() string {
 type Conn struct {
 	Conn    net.Conn
 	scanner *Scanner
+
+	// failed is set once a request failed.
+	failed bool
 }
 
 func (c *Conn) getUnderlyingConn() net.Conn {
@@ -156,20 +202,7 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		},
 	}
 
-	data, err := c.MarshalRequest(&req)
-	if err != nil {
-		log.Fatalf("Unexpected error marshaling modbus packet: %v", err)
-	}
-	w := 0
-	for w < len(data) {
-		written, err := c.getUnderlyingConn().Write(data[w:])
-		w += written
-		if err != nil {
-			return zgrab2.TryGetScanStatus(err), nil, err
-		}
-	}
-
-	res, err := c.GetModbusResponse()
+	res, err := c.request(&req)
 	if res == nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -202,6 +235,11 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
 	}
 
+	c.runChecks(scanner.config.UnitID, ret)
+	if scanner.config.UnitIDRange != "" {
+		ret.Units = scanner.sweepUnits(&target)
+	}
+
 	status := zgrab2.SCAN_SUCCESS
 	if res.IsException() {
 		// Note the exception, but note that the modbus protocol was detected
@@ -0,0 +1,89 @@
+package mongodb
+
+import (
+	"gopkg.in/mgo.v2/bson"
+)
+
+// errUnauthorized is the error code of commands refused because they
+// require authentication.
+const errUnauthorized = 13
+
+// Database is an entry of the listDatabases response.
+type Database struct {
+	Name       string `json:"name"`
+	SizeOnDisk int64  `json:"size_on_disk"`
+	Empty      bool   `json:"empty,omitempty"`
+}
+
+// DatabaseList is the response to listDatabases.
+type DatabaseList struct {
+	// TotalSize is the sum of the sizes of all databases, in bytes.
+	TotalSize int64      `json:"total_size"`
+	Databases []Database `json:"databases,omitempty"`
+
+	// Error is set if listDatabases failed, e.g. because authentication is
+	// required.
+	Error string `json:"error,omitempty"`
+}
+
+// AuthCheck tells whether the server requires authentication.
+type AuthCheck struct {
+	// Enforced is true if the server refused listDatabases as unauthorized,
+	// i.e. access control (SCRAM by default) is enabled.
+	Enforced bool `json:"enforced"`
+
+	// Response is the error of listDatabases, if it failed.
+	Response string `json:"response,omitempty"`
+
+	// Mechanisms are the authentication mechanisms enabled on the server,
+	// if getParameter was allowed.
+	Mechanisms []string `json:"mechanisms,omitempty"`
+}
+
+// listDatabases runs listDatabases, and returns its result along with the
+// error code of the reply (0 on success). It is run once per scan, for
+// --list-databases, --check-auth and --estimate-data alike.
+func listDatabases(conn *Connection, wireVersion int32) (*DatabaseList, int64) {
+	ret := new(DatabaseList)
+	list, err := runCommand(conn, wireVersion, "admin", bson.D{{Name: "listDatabases", Value: 1}})
+	if err != nil {
+		ret.Error = err.Error()
+		return ret, toInt64(list["code"])
+	}
+	ret.TotalSize = toInt64(list["totalSize"])
+	databases, _ := list["databases"].([]interface{})
+	for _, entry := range databases {
+		db, ok := entry.(bson.M)
+		if !ok {
+			continue
+		}
+		name, _ := db["name"].(string)
+		empty, _ := db["empty"].(bool)
+		ret.Databases = append(ret.Databases, Database{Name: name, SizeOnDisk: toInt64(db["sizeOnDisk"]), Empty: empty})
+	}
+	return ret, 0
+}
+
+// getParameters runs getParameter "*" and returns all server parameters.
+func getParameters(conn *Connection, wireVersion int32) (bson.M, error) {
+	parameters, err := runCommand(conn, wireVersion, "admin", bson.D{{Name: "getParameter", Value: "*"}})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"ok", "$clusterTime", "operationTime"} {
+		delete(parameters, name)
+	}
+	return parameters, nil
+}
+
+// authMechanisms returns the authenticationMechanisms parameter.
+func authMechanisms(parameters bson.M) []string {
+	var ret []string
+	mechanisms, _ := parameters["authenticationMechanisms"].([]interface{})
+	for _, mechanism := range mechanisms {
+		if name, ok := mechanism.(string); ok {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,184 @@
+package mongodb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// reply encodes document as an OP_REPLY, or as an OP_MSG if opMsg is set.
+func reply(t *testing.T, document interface{}, opMsg bool) []byte {
+	body, err := bson.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg []byte
+	if opMsg {
+		msg = getOpMsg(append([]byte{0}, body...))
+	} else {
+		msg = make([]byte, MSGHEADER_LEN+20)
+		binary.LittleEndian.PutUint32(msg[12:], OP_REPLY)
+		binary.LittleEndian.PutUint32(msg[MSGHEADER_LEN+16:], 1)
+		msg = append(msg, body...)
+		binary.LittleEndian.PutUint32(msg, uint32(len(msg)))
+	}
+	return msg
+}
+
+// serveMongoDB accepts one connection of a server that answers isMaster and
+// buildInfo, and refuses all other commands if auth is set. The names of
+// the commands received are sent on the returned channel.
+func serveMongoDB(t *testing.T, auth bool) (uint, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	commands := make(chan string, 100)
+	go func() {
+		netConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer netConn.Close()
+		conn := &Connection{conn: netConn}
+		for {
+			msg, err := conn.ReadMsg()
+			if err != nil {
+				return
+			}
+			var command bson.D
+			opMsg := binary.LittleEndian.Uint32(msg[12:]) == OP_MSG
+			if opMsg {
+				bson.Unmarshal(msg[MSGHEADER_LEN+5:], &command)
+			} else {
+				// flags, collection name, numberToSkip, numberToReturn
+				offset := MSGHEADER_LEN + 4
+				offset += bytes.IndexByte(msg[offset:], 0) + 1 + 8
+				bson.Unmarshal(msg[offset:], &command)
+			}
+			var response bson.M
+			commands <- command[0].Name
+			switch name := command[0].Name; {
+			case name == "isMaster":
+				response = bson.M{"ismaster": true, "maxWireVersion": 17, "ok": 1}
+			case name == "buildinfo":
+				response = bson.M{"version": "7.0.5", "allocator": "tcmalloc", "bits": 64, "storageEngines": []string{"wiredTiger"}, "ok": 1}
+			case auth:
+				response = bson.M{"ok": 0, "code": 13, "codeName": "Unauthorized", "errmsg": "command " + name + " requires authentication"}
+			case name == "listDatabases":
+				response = bson.M{"databases": []bson.M{{"name": "admin", "sizeOnDisk": 40960, "empty": false}, {"name": "shop", "sizeOnDisk": 1 << 20, "empty": false}}, "totalSize": 40960 + 1<<20, "ok": 1}
+			case name == "dbStats":
+				response = bson.M{"db": command[1].Value, "collections": 3, "objects": 1000, "dataSize": 1 << 16, "storageSize": 1 << 17, "ok": 1}
+			case name == "getParameter":
+				response = bson.M{"authenticationMechanisms": []string{"SCRAM-SHA-1", "SCRAM-SHA-256"}, "enableLocalhostAuthBypass": true, "ok": 1}
+			default:
+				response = bson.M{"ok": 0, "code": 59, "errmsg": "no such command"}
+			}
+			if err := conn.Write(reply(t, response, opMsg)); err != nil {
+				return
+			}
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port), commands
+}
+
+func scanMongoDB(t *testing.T, auth bool) *Result {
+	var scanner Scanner
+	port, _ := serveMongoDB(t, auth)
+	flags := &Flags{
+		BaseFlags:     zgrab2.BaseFlags{Port: port, Timeout: 5 * time.Second},
+		ListDatabases: true,
+		GetParameters: true,
+		CheckAuth:     true,
+	}
+	scanner.Init(flags)
+	status, ret, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	return *ret.(**Result)
+}
+
+func TestEnumerate(t *testing.T) {
+	result := scanMongoDB(t, false)
+	if info := result.BuildInfo; info.Version != "7.0.5" || info.Allocator != "tcmalloc" || info.Bits != 64 || !reflect.DeepEqual(info.StorageEngines, []string{"wiredTiger"}) {
+		t.Errorf("unexpected build info %+v", info)
+	}
+	expected := &DatabaseList{
+		TotalSize: 40960 + 1<<20,
+		Databases: []Database{{Name: "admin", SizeOnDisk: 40960}, {Name: "shop", SizeOnDisk: 1 << 20}},
+	}
+	if !reflect.DeepEqual(result.Databases, expected) {
+		t.Errorf("unexpected databases %+v", result.Databases)
+	}
+	if result.Parameters["enableLocalhostAuthBypass"] != true || result.Parameters["ok"] != nil {
+		t.Errorf("unexpected parameters %v", result.Parameters)
+	}
+	expectedAuth := &AuthCheck{Mechanisms: []string{"SCRAM-SHA-1", "SCRAM-SHA-256"}}
+	if !reflect.DeepEqual(result.AuthCheck, expectedAuth) {
+		t.Errorf("unexpected auth check %+v", result.AuthCheck)
+	}
+}
+
+func TestEnumerateAuth(t *testing.T) {
+	result := scanMongoDB(t, true)
+	if result.Databases == nil || result.Databases.Error == "" || result.Databases.Databases != nil {
+		t.Errorf("unexpected databases %+v", result.Databases)
+	}
+	if result.Parameters != nil || result.ParametersError == "" {
+		t.Errorf("unexpected parameters %v (%s)", result.Parameters, result.ParametersError)
+	}
+	if check := result.AuthCheck; !check.Enforced || check.Response == "" || check.Mechanisms != nil {
+		t.Errorf("unexpected auth check %+v", check)
+	}
+}
+
+func TestEstimateData(t *testing.T) {
+	var scanner Scanner
+	port, commands := serveMongoDB(t, false)
+	flags := &Flags{
+		BaseFlags:            zgrab2.BaseFlags{Port: port, Timeout: 5 * time.Second},
+		ListDatabases:        true,
+		CheckAuth:            true,
+		EstimateData:         true,
+		EstimateMaxDatabases: 1,
+	}
+	scanner.Init(flags)
+	status, ret, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	result := *ret.(**Result)
+	expected := &DataEstimate{
+		TotalSize: 40960 + 1<<20,
+		Databases: []DatabaseEstimate{
+			{Database: Database{Name: "admin", SizeOnDisk: 40960}, Collections: 3, Objects: 1000, DataSize: 1 << 16, StorageSize: 1 << 17},
+			{Database: Database{Name: "shop", SizeOnDisk: 1 << 20}},
+		},
+		Truncated: true,
+	}
+	if !reflect.DeepEqual(result.DataEstimate, expected) {
+		t.Errorf("unexpected estimate %+v", result.DataEstimate)
+	}
+	if result.Databases == nil || len(result.Databases.Databases) != 2 || result.AuthCheck == nil || result.AuthCheck.Enforced {
+		t.Errorf("unexpected databases %+v, auth check %+v", result.Databases, result.AuthCheck)
+	}
+
+	// The replies were read, so all the commands were received.
+	count := 0
+	for len(commands) > 0 {
+		if <-commands == "listDatabases" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("listDatabases was sent %d times", count)
+	}
+}
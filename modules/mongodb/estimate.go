@@ -0,0 +1,131 @@
+package mongodb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DatabaseEstimate holds the size counters of a single database: its
+// listDatabases entry, and its dbStats counters.
+type DatabaseEstimate struct {
+	Database
+
+	// The following are from dbStats, which is only run for the first
+	// --estimate-max-databases databases.
+	Collections int64  `json:"collections,omitempty"`
+	Objects     int64  `json:"objects,omitempty"`
+	DataSize    int64  `json:"data_size,omitempty"`
+	StorageSize int64  `json:"storage_size,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// DataEstimate quantifies the data held by a server that lists its
+// databases without authentication. It is computed from the listDatabases
+// and dbStats counters only; no documents are read.
+type DataEstimate struct {
+	// TotalSize is the totalSize reported by listDatabases, in bytes.
+	TotalSize int64 `json:"total_size"`
+
+	Databases []DatabaseEstimate `json:"databases,omitempty"`
+
+	// Truncated is true if dbStats was skipped for some databases because of
+	// --estimate-max-databases.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Error is set if listDatabases failed, e.g. because authentication is
+	// required.
+	Error string `json:"error,omitempty"`
+}
+
+// runCommand runs a command against the given database and returns the reply
+// document. Servers with wire version 6 (MongoDB 3.6) or later get an
+// OP_MSG, older ones an OP_QUERY on <database>.$cmd.
+func runCommand(conn *Connection, wireVersion int32, database string, command bson.D) (bson.M, error) {
+	var msg []byte
+	if wireVersion >= 6 {
+		body, err := bson.Marshal(append(command, bson.DocElem{Name: "$db", Value: database}))
+		if err != nil {
+			return nil, err
+		}
+		msg = getOpMsg(append([]byte{0}, body...))
+	} else {
+		query, err := bson.Marshal(command)
+		if err != nil {
+			return nil, err
+		}
+		msg = getOpQuery(database+".$cmd", query)
+	}
+	if err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	reply, err := conn.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) < MSGHEADER_LEN {
+		return nil, fmt.Errorf("Server truncated message (%d bytes)", len(reply))
+	}
+	var offset int
+	switch opCode := binary.LittleEndian.Uint32(reply[12:16]); opCode {
+	case OP_MSG:
+		offset = MSGHEADER_LEN + 5
+	case OP_REPLY:
+		offset = MSGHEADER_LEN + 20
+	default:
+		return nil, fmt.Errorf("Unexpected reply opcode %d", opCode)
+	}
+	if len(reply) < offset+4 {
+		return nil, fmt.Errorf("Server truncated message - no reply doc (%d bytes)", len(reply))
+	}
+	document := bson.M{}
+	if err := bson.Unmarshal(reply[offset:], &document); err != nil {
+		return nil, fmt.Errorf("Server sent invalid BSON reply doc: %v", err)
+	}
+	if toInt64(document["ok"]) != 1 {
+		return document, fmt.Errorf("%s failed: %v", command[0].Name, document["errmsg"])
+	}
+	return document, nil
+}
+
+// toInt64 converts a BSON number of any type to an int64.
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// estimateData runs dbStats on up to maxDatabases of the databases listed
+// by listDatabases.
+func estimateData(conn *Connection, wireVersion int32, list *DatabaseList, maxDatabases int) *DataEstimate {
+	ret := &DataEstimate{TotalSize: list.TotalSize, Error: list.Error}
+	for _, db := range list.Databases {
+		ret.Databases = append(ret.Databases, DatabaseEstimate{Database: db})
+	}
+	for i := range ret.Databases {
+		if i >= maxDatabases {
+			ret.Truncated = true
+			break
+		}
+		db := &ret.Databases[i]
+		stats, err := runCommand(conn, wireVersion, db.Name, bson.D{{Name: "dbStats", Value: 1}})
+		if err != nil {
+			db.Error = err.Error()
+			continue
+		}
+		db.Collections = toInt64(stats["collections"])
+		db.Objects = toInt64(stats["objects"])
+		db.DataSize = toInt64(stats["dataSize"])
+		db.StorageSize = toInt64(stats["storageSize"])
+	}
+	return ret
+}
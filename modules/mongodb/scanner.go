@@ -19,6 +19,13 @@ type Flags struct {
 	zgrab2.BaseFlags
 	GetLogs  bool `long:"show-logs" description:"Request logs from MongoDB(GetLogs)."`
 	OnlyLogs bool `long:"only-logs" description:"Show results only with logs from MongoDB."`
+
+	EstimateData         bool `long:"estimate-data" description:"If the databases can be listed without authentication, estimate the amount of stored data (listDatabases sizes, dbStats counters). No documents are read."`
+	EstimateMaxDatabases int  `long:"estimate-max-databases" default:"20" description:"Maximum number of databases to run dbStats on with --estimate-data"`
+
+	ListDatabases bool `long:"list-databases" description:"Run listDatabases and report the database names and sizes, if allowed without authentication"`
+	GetParameters bool `long:"get-parameters" description:"Run getParameter to report all server parameters, if allowed without authentication"`
+	CheckAuth     bool `long:"check-auth" description:"Report whether the server enforces authentication, from the response to listDatabases"`
 }
 
 // Scanner implements the zgrab2.Scanner interface
@@ -179,6 +186,19 @@ type BuildInfo_t struct {
 	Version          string             `bson:"version,omitempty" json:"version,omitempty"`
 	GitVersion       string             `bson:"gitVersion,omitempty" json:"git_version,omitempty"`
 	BuildEnvironment BuildEnvironment_t `bson:"buildEnvironment,omitempty" json:"build_environment,omitempty"`
+	Modules          []string           `bson:"modules,omitempty" json:"modules,omitempty"`
+	Allocator        string             `bson:"allocator,omitempty" json:"allocator,omitempty"`
+	JavascriptEngine string             `bson:"javascriptEngine,omitempty" json:"javascript_engine,omitempty"`
+	Bits             int32              `bson:"bits,omitempty" json:"bits,omitempty"`
+	Debug            bool               `bson:"debug,omitempty" json:"debug,omitempty"`
+	StorageEngines   []string           `bson:"storageEngines,omitempty" json:"storage_engines,omitempty"`
+	OpenSSL          *OpenSSL_t         `bson:"openssl,omitempty" json:"openssl,omitempty"`
+}
+
+// OpenSSL_t holds the OpenSSL versions the server was built and runs with
+type OpenSSL_t struct {
+	Running  string `bson:"running,omitempty" json:"running,omitempty"`
+	Compiled string `bson:"compiled,omitempty" json:"compiled,omitempty"`
 }
 
 // IsMaster_t holds the data returned by an isMaster query
@@ -204,6 +224,22 @@ type Result struct {
 	IsMaster  *IsMaster_t  `json:"is_master,omitempty"`
 	BuildInfo *BuildInfo_t `json:"build_info,omitempty"`
 	LogsInfo  *LogsInfo_t  `json:"logs_info,omitempty"`
+
+	// DataEstimate is only included if --estimate-data is set.
+	DataEstimate *DataEstimate `json:"data_estimate,omitempty"`
+
+	// Databases is only included if --list-databases is set.
+	Databases *DatabaseList `json:"databases,omitempty"`
+
+	// Parameters holds the server parameters; only included if
+	// --get-parameters is set and getParameter succeeded.
+	Parameters bson.M `json:"parameters,omitempty"`
+
+	// ParametersError is set if getParameter failed.
+	ParametersError string `json:"parameters_error,omitempty"`
+
+	// AuthCheck is only included if --check-auth is set.
+	AuthCheck *AuthCheck `json:"auth_check,omitempty"`
 }
 
 // Init initializes the scanner
@@ -257,6 +293,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Result)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Perform a handshake with a MongoDB server"
@@ -409,6 +450,33 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			result.LogsInfo = _tmp
 		}
 	}
+	wireVersion := result.IsMaster.MaxWireVersion
+	var databases *DatabaseList
+	if scanner.config.ListDatabases || scanner.config.CheckAuth || scanner.config.EstimateData {
+		var code int64
+		databases, code = listDatabases(scan.conn, wireVersion)
+		if scanner.config.ListDatabases {
+			result.Databases = databases
+		}
+		if scanner.config.CheckAuth {
+			result.AuthCheck = &AuthCheck{Enforced: code == errUnauthorized, Response: databases.Error}
+		}
+	}
+	if scanner.config.GetParameters || scanner.config.CheckAuth {
+		parameters, err := getParameters(scan.conn, wireVersion)
+		if scanner.config.GetParameters {
+			result.Parameters = parameters
+			if err != nil {
+				result.ParametersError = err.Error()
+			}
+		}
+		if scanner.config.CheckAuth {
+			result.AuthCheck.Mechanisms = authMechanisms(parameters)
+		}
+	}
+	if scanner.config.EstimateData {
+		result.DataEstimate = estimateData(scan.conn, wireVersion, databases, scanner.config.EstimateMaxDatabases)
+	}
 	if !(scanner.config.OnlyLogs) {
 		return zgrab2.SCAN_SUCCESS, &result, err
 	} else {
@@ -0,0 +1,153 @@
+package mssql
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// SQL Server Resolution Protocol (MC-SQLR) message types.
+const (
+	// browserUnicastEx (CLNT_UCAST_EX) asks for all instances of a server.
+	browserUnicastEx = 0x03
+
+	// browserResponse (SVR_RESP) is the header of the server's response.
+	browserResponse = 0x05
+)
+
+// ErrInvalidBrowserResponse is returned if the SQL Browser response is not
+// a SVR_RESP message.
+var ErrInvalidBrowserResponse = errors.New("invalid SQL Browser response")
+
+// BrowserInstance is an instance advertised by the SQL Browser service.
+type BrowserInstance struct {
+	ServerName   string `json:"server_name,omitempty"`
+	InstanceName string `json:"instance_name,omitempty"`
+	IsClustered  bool   `json:"is_clustered"`
+	Version      string `json:"version,omitempty"`
+
+	// TCPPort is the TCP port the instance listens on, if TCP is enabled.
+	TCPPort uint `json:"tcp_port,omitempty"`
+
+	// NamedPipe is the name of the instance's named pipe, if enabled.
+	NamedPipe string `json:"named_pipe,omitempty"`
+
+	// Protocols are the remaining protocol parameters, e.g. "rpc" or
+	// "via".
+	Protocols map[string]string `json:"protocols,omitempty"`
+
+	// Prelogin is the result of the PRELOGIN handshake on TCPPort, with
+	// --browser-prelogin.
+	Prelogin *ScanResults `json:"prelogin,omitempty"`
+
+	// PreloginError is the error of the PRELOGIN handshake, if it failed.
+	PreloginError string `json:"prelogin_error,omitempty"`
+}
+
+// BrowserResult is the SQL Browser's response to CLNT_UCAST_EX.
+type BrowserResult struct {
+	Instances []*BrowserInstance `json:"instances,omitempty"`
+
+	// Error is set if the query failed, e.g. if nothing answered on the
+	// SQL Browser port.
+	Error string `json:"error,omitempty"`
+}
+
+// parseBrowserResponse parses the instances of a SVR_RESP message. Each
+// instance is a list of semicolon-separated names and values, ending with
+// two semicolons.
+func parseBrowserResponse(buf []byte) ([]*BrowserInstance, error) {
+	if len(buf) < 3 || buf[0] != browserResponse {
+		return nil, ErrInvalidBrowserResponse
+	}
+	size := int(binary.LittleEndian.Uint16(buf[1:3]))
+	data := buf[3:]
+	if size < len(data) {
+		data = data[:size]
+	}
+	var ret []*BrowserInstance
+	for _, entry := range strings.Split(string(data), ";;") {
+		fields := strings.Split(entry, ";")
+		if len(fields) < 2 {
+			continue
+		}
+		instance := new(BrowserInstance)
+		for i := 0; i+1 < len(fields); i += 2 {
+			value := fields[i+1]
+			switch strings.ToLower(fields[i]) {
+			case "servername":
+				instance.ServerName = value
+			case "instancename":
+				instance.InstanceName = value
+			case "isclustered":
+				instance.IsClustered = strings.EqualFold(value, "Yes")
+			case "version":
+				instance.Version = value
+			case "tcp":
+				port, err := strconv.ParseUint(value, 10, 16)
+				if err == nil {
+					instance.TCPPort = uint(port)
+				}
+			case "np":
+				instance.NamedPipe = value
+			default:
+				if instance.Protocols == nil {
+					instance.Protocols = make(map[string]string)
+				}
+				instance.Protocols[fields[i]] = value
+			}
+		}
+		ret = append(ret, instance)
+	}
+	return ret, nil
+}
+
+// queryBrowser sends CLNT_UCAST_EX to the SQL Browser service over UDP,
+// and with --browser-prelogin does a PRELOGIN handshake with each instance
+// that listens on TCP.
+func (scanner *Scanner) queryBrowser(target zgrab2.ScanTarget) *BrowserResult {
+	ret := new(BrowserResult)
+	browserTarget := target
+	port := scanner.config.BrowserPort
+	browserTarget.Port = &port
+	conn, err := browserTarget.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte{browserUnicastEx}); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	// The response is a single datagram of up to 3 + 0xffff bytes.
+	buf := make([]byte, 3+0xffff)
+	n, err := conn.Read(buf)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	if ret.Instances, err = parseBrowserResponse(buf[:n]); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	if !scanner.config.BrowserPrelogin {
+		return ret
+	}
+	for _, instance := range ret.Instances {
+		if instance.TCPPort == 0 {
+			continue
+		}
+		instanceTarget := target
+		instancePort := instance.TCPPort
+		instanceTarget.Port = &instancePort
+		_, instance.Prelogin, err = scanner.prelogin(instanceTarget)
+		if err != nil {
+			instance.PreloginError = err.Error()
+		}
+	}
+	return ret
+}
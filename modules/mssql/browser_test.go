@@ -0,0 +1,97 @@
+package mssql
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+const testBrowserData = "ServerName;SQL01;InstanceName;MSSQLSERVER;IsClustered;No;Version;15.0.2000.5;tcp;1433;np;\\\\SQL01\\pipe\\sql\\query;;" +
+	"ServerName;SQL01;InstanceName;SQLEXPRESS;IsClustered;No;Version;16.0.1000.6;rpc;SQL01;;"
+
+// browserMessage returns a SVR_RESP message with the given data.
+func browserMessage(data string) []byte {
+	ret := []byte{browserResponse, 0, 0}
+	binary.LittleEndian.PutUint16(ret[1:], uint16(len(data)))
+	return append(ret, data...)
+}
+
+func TestParseBrowserResponse(t *testing.T) {
+	instances, err := parseBrowserResponse(browserMessage(testBrowserData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*BrowserInstance{
+		{ServerName: "SQL01", InstanceName: "MSSQLSERVER", Version: "15.0.2000.5", TCPPort: 1433, NamedPipe: `\\SQL01\pipe\sql\query`},
+		{ServerName: "SQL01", InstanceName: "SQLEXPRESS", Version: "16.0.1000.6", Protocols: map[string]string{"rpc": "SQL01"}},
+	}
+	if !reflect.DeepEqual(instances, expected) {
+		t.Errorf("unexpected instances %+v %+v", instances[0], instances[1])
+	}
+	if _, err := parseBrowserResponse([]byte{0x04}); err != ErrInvalidBrowserResponse {
+		t.Errorf("expected ErrInvalidBrowserResponse, got %v", err)
+	}
+}
+
+// closedPort returns a local TCP port nothing listens on.
+func closedPort(t *testing.T) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// serveBrowser answers one CLNT_UCAST_EX request with data.
+func serveBrowser(t *testing.T, data string) uint {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 16)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil || n != 1 || buf[0] != browserUnicastEx {
+			return
+		}
+		conn.WriteTo(browserMessage(data), addr)
+	}()
+	return uint(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func TestBrowser(t *testing.T) {
+	port := closedPort(t)
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags:       zgrab2.BaseFlags{Port: port, Timeout: 5 * time.Second},
+		EncryptMode:     "ENCRYPT_ON",
+		BrowserPort:     serveBrowser(t, "ServerName;SQL01;InstanceName;SQLEXPRESS;IsClustered;Yes;Version;16.0.1000.6;tcp;"+strconv.FormatUint(uint64(port), 10)+";;"),
+		BrowserPrelogin: true,
+	}
+	if err := flags.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	scanner.Init(flags)
+	status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status == zgrab2.SCAN_SUCCESS || err == nil {
+		t.Errorf("expected PRELOGIN on closed port %d to fail, got %s", port, status)
+	}
+	browser := result.(*ScanResults).Browser
+	if browser == nil || browser.Error != "" || len(browser.Instances) != 1 {
+		t.Fatalf("unexpected browser result %+v", browser)
+	}
+	instance := browser.Instances[0]
+	if instance.InstanceName != "SQLEXPRESS" || !instance.IsClustered || instance.TCPPort != port {
+		t.Errorf("unexpected instance %+v", instance)
+	}
+	if instance.Prelogin != nil || instance.PreloginError == "" {
+		t.Errorf("expected a PRELOGIN error, got %+v", instance)
+	}
+}
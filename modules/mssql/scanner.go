@@ -7,6 +7,10 @@
 //
 // The scan performs a PRELOGIN and if possible does a TLS handshake.
 //
+// With --browser, it also queries the SQL Browser service (UDP 1434) for
+// the server's instances, and with --browser-prelogin performs the PRELOGIN
+// against the TCP port of each of them.
+//
 // The output is the the server version and instance name, and if applicable the
 // TLS output.
 package mssql
@@ -39,14 +43,22 @@ type ScanResults struct {
 
 	// TLSLog is the shared TLS handshake/scan log.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// Browser is the list of instances advertised by the SQL Browser
+	// service, with --browser.
+	Browser *BrowserResult `json:"browser,omitempty"`
 }
 
 // Flags defines the command-line configuration options for the module.
 type Flags struct {
 	zgrab2.BaseFlags
 	zgrab2.TLSFlags
-	EncryptMode string `long:"encrypt-mode" description:"The type of encryption to request in the pre-login step. One of ENCRYPT_ON, ENCRYPT_OFF, ENCRYPT_NOT_SUP." default:"ENCRYPT_ON"`
-	Verbose     bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	zgrab2.UDPFlags
+	EncryptMode     string `long:"encrypt-mode" description:"The type of encryption to request in the pre-login step. One of ENCRYPT_ON, ENCRYPT_OFF, ENCRYPT_NOT_SUP." default:"ENCRYPT_ON"`
+	Verbose         bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	Browser         bool   `long:"browser" description:"Query the SQL Browser service over UDP for the server's instances"`
+	BrowserPort     uint   `long:"browser-port" description:"The UDP port of the SQL Browser service" default:"1434"`
+	BrowserPrelogin bool   `long:"browser-prelogin" description:"Perform the PRELOGIN handshake with each instance listening on TCP (implies --browser)"`
 }
 
 // Module is the implementation of zgrab2.Module for the MSSQL protocol.
@@ -69,13 +81,21 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Perform a handshake for MSSQL databases"
 }
 
-// Validate does nothing in this module.
+// Validate checks the flags; --browser-prelogin implies --browser.
 func (flags *Flags) Validate(args []string) error {
+	if flags.BrowserPrelogin {
+		flags.Browser = true
+	}
 	return nil
 }
 
@@ -114,14 +134,36 @@ func (scanner *Scanner) GetTrigger() string {
 	return scanner.config.Trigger
 }
 
-// Scan performs the MSSQL scan.
+// Scan performs the MSSQL scan: the SQL Browser query if enabled, then the
+// PRELOGIN handshake on the target port. The Browser results are kept even if
+// the handshake fails.
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	var browser *BrowserResult
+	if scanner.config.Browser {
+		browser = scanner.queryBrowser(target)
+	}
+	status, result, err := scanner.prelogin(target)
+	if browser != nil {
+		if result == nil {
+			result = &ScanResults{}
+		}
+		result.Browser = browser
+	}
+	if result == nil {
+		// No MSSQL service was found.
+		return status, nil, err
+	}
+	return status, result, err
+}
+
+// prelogin performs the PRELOGIN handshake.
 // 1. Open a TCP connection to the target port (default 1433).
 // 2. Send a PRELOGIN packet to the server.
 // 3. Read the PRELOGIN response from the server.
 // 4. If the server encrypt mode is EncryptModeNotSupported, break.
 // 5. Perform a TLS handshake, with the packets wrapped in TDS headers.
 // 6. Decode the Version and InstanceName from the PRELOGIN response
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+func (scanner *Scanner) prelogin(target zgrab2.ScanTarget) (zgrab2.ScanStatus, *ScanResults, error) {
 	conn, err := target.Open(&scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
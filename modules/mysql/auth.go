@@ -0,0 +1,102 @@
+package mysql
+
+import (
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+// probeUser is the user of the plaintext login attempt of --auth-report
+// when --user is not set.
+const probeUser = "zgrab2"
+
+// AuthReport describes how the server authenticates clients.
+type AuthReport struct {
+	// Plugin is the default authentication plugin of the server.
+	Plugin string `json:"plugin,omitempty"`
+
+	// TLSSupported is true if the server offered CLIENT_SSL.
+	TLSSupported bool `json:"tls_supported"`
+
+	// TLSRequired is true if logins without TLS are refused, either by
+	// require_secure_transport or, for the tested user, by REQUIRE SSL.
+	// It is omitted if that could not be determined.
+	TLSRequired *bool `json:"tls_required,omitempty"`
+
+	// Credential is the result of logging in with --user and --password,
+	// over TLS if the server supports it.
+	Credential *mysql.AuthResult `json:"credential,omitempty"`
+
+	// PlaintextProbe is the result of logging in without TLS on a second
+	// connection, as --user (or a made-up user) with --password.
+	PlaintextProbe *mysql.AuthResult `json:"plaintext_probe,omitempty"`
+}
+
+// isError returns true if the login was refused with the given error ID.
+func isError(result *mysql.AuthResult, id string) bool {
+	return result != nil && result.Error != nil && result.Error.GetErrorID() == id
+}
+
+// tlsRequired infers whether TLS is required from the login attempts, or
+// returns nil if it is not known.
+func (report *AuthReport) tlsRequired() *bool {
+	required := true
+	switch {
+	case !report.TLSSupported:
+		required = false
+	case report.PlaintextProbe == nil:
+		return nil
+	case report.PlaintextProbe.Success:
+		required = false
+	case isError(report.PlaintextProbe, "ER_SECURE_TRANSPORT_REQUIRED"):
+	case report.Credential != nil && report.Credential.Success && isError(report.PlaintextProbe, "ER_ACCESS_DENIED_ERROR"):
+		// The same credential only works over TLS.
+	default:
+		return nil
+	}
+	return &required
+}
+
+// probePlaintext opens a second connection and tries to log in without
+// TLS.
+func (s *Scanner) probePlaintext(t zgrab2.ScanTarget) (*mysql.AuthResult, error) {
+	conn, err := t.Open(&s.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	sql := mysql.NewConnection(&mysql.Config{})
+	defer sql.Disconnect()
+	if err := sql.Connect(conn); err != nil {
+		return nil, err
+	}
+	user := s.config.User
+	if user == "" {
+		user = probeUser
+	}
+	return sql.Authenticate(user, s.config.Password)
+}
+
+// getAuthReport tests the credential on the scan's connection, if one was
+// given, and with --auth-report probes a plaintext login.
+func (s *Scanner) getAuthReport(t zgrab2.ScanTarget, sql *mysql.Connection) (*AuthReport, error) {
+	handshake := sql.GetHandshake()
+	report := &AuthReport{
+		Plugin:       handshake.AuthPluginName,
+		TLSSupported: handshake.CapabilityFlags&mysql.CLIENT_SSL != 0,
+	}
+	if s.config.User != "" {
+		var err error
+		if report.Credential, err = sql.Authenticate(s.config.User, s.config.Password); err != nil {
+			return report, err
+		}
+	}
+	if s.config.AuthReport && report.TLSSupported {
+		probe, err := s.probePlaintext(t)
+		if err != nil {
+			log.Debugf("Plaintext login probe failed: %v", err)
+		}
+		report.PlaintextProbe = probe
+	}
+	report.TLSRequired = report.tlsRequired()
+	return report, nil
+}
@@ -0,0 +1,162 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/mysql"
+	"github.com/Positive-Engineer/zgrab2/lib/testutil"
+)
+
+var testNonce = []byte("abcdefgh0123456789ij")
+
+// handshake returns the body of the server's initial packet.
+func handshake() []byte {
+	capabilities := mysql.CLIENT_PROTOCOL_41 | mysql.CLIENT_SSL | mysql.CLIENT_SECURE_CONNECTION | mysql.CLIENT_PLUGIN_AUTH
+	var buf bytes.Buffer
+	buf.WriteByte(0x0a)
+	buf.WriteString("8.0.36\x00")
+	buf.Write([]byte{1, 0, 0, 0})
+	buf.Write(testNonce[:8])
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.LittleEndian, uint16(capabilities))
+	buf.WriteByte(0xff)
+	buf.Write([]byte{2, 0})
+	binary.Write(&buf, binary.LittleEndian, uint16(capabilities>>16))
+	buf.WriteByte(21)
+	buf.Write(make([]byte, 10))
+	buf.Write(testNonce[8:])
+	buf.WriteByte(0)
+	buf.WriteString(mysql.CachingSHA2PasswordPlugin + "\x00")
+	return buf.Bytes()
+}
+
+func writePacket(conn net.Conn, seq byte, body []byte) {
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, uint32(len(body)))
+	header[3] = seq
+	conn.Write(append(header, body...))
+}
+
+func readPacket(conn net.Conn) (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return 0, nil, err
+	}
+	seq := header[3]
+	header[3] = 0
+	body := make([]byte, binary.LittleEndian.Uint32(header[:]))
+	_, err := io.ReadFull(conn, body)
+	return seq, body, err
+}
+
+// errPacket returns the body of an ERR packet.
+func errPacket(code uint16, state string, message string) []byte {
+	body := []byte{0xff, byte(code), byte(code >> 8), '#'}
+	return append(append(body, state...), message...)
+}
+
+// serveMySQL accepts connections of a server with require_secure_transport
+// that only knows the user "admin" with the password "secret", which has
+// to go through caching_sha2_password's full authentication.
+func serveMySQL(t *testing.T) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	config := &tls.Config{Certificates: []tls.Certificate{testutil.Certificate(t, "mysql.example.com")}}
+	stage1 := sha256.Sum256([]byte("secret"))
+	stage2 := sha256.Sum256(stage1[:])
+	scramble := sha256.Sum256(append(stage2[:], testNonce...))
+	for i := range scramble {
+		scramble[i] ^= stage1[i]
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				writePacket(conn, 0, handshake())
+				seq, body, err := readPacket(conn)
+				if err != nil {
+					return
+				}
+				if len(body) == 32 {
+					tlsConn := tls.Server(conn, config)
+					if err := tlsConn.Handshake(); err != nil {
+						return
+					}
+					conn = tlsConn
+					if seq, body, err = readPacket(conn); err != nil {
+						return
+					}
+				} else {
+					writePacket(conn, seq+1, errPacket(3159, "HY000", "Connections using insecure transport are prohibited while --require_secure_transport=ON."))
+					return
+				}
+				user := body[32 : 32+bytes.IndexByte(body[32:], 0)]
+				response := body[32+len(user)+2:]
+				response = response[:body[32+len(user)+1]]
+				if string(user) != "admin" || !bytes.Equal(response, scramble[:]) {
+					writePacket(conn, seq+1, errPacket(1045, "28000", "Access denied for user"))
+					return
+				}
+				writePacket(conn, seq+1, []byte{0x01, 0x04})
+				if seq, body, err = readPacket(conn); err != nil || string(body) != "secret\x00" {
+					return
+				}
+				writePacket(conn, seq+1, []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})
+			}(conn)
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestAuthReport(t *testing.T) {
+	port := serveMySQL(t)
+	for _, password := range []string{"secret", "wrong"} {
+		var scanner Scanner
+		flags := &Flags{
+			BaseFlags:  zgrab2.BaseFlags{Port: port, Timeout: 5 * time.Second},
+			AuthReport: true,
+			User:       "admin",
+			Password:   password,
+		}
+		scanner.Init(flags)
+		status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+		if status != zgrab2.SCAN_SUCCESS || err != nil {
+			t.Fatalf("scan failed: %s %v", status, err)
+		}
+		auth := result.(*ScanResults).Auth
+		if auth == nil || auth.Plugin != mysql.CachingSHA2PasswordPlugin || !auth.TLSSupported {
+			t.Fatalf("unexpected auth report %+v", auth)
+		}
+		if auth.TLSRequired == nil || !*auth.TLSRequired {
+			t.Errorf("TLS should be required")
+		}
+		if probe := auth.PlaintextProbe; probe == nil || probe.Secure || !isError(probe, "ER_SECURE_TRANSPORT_REQUIRED") {
+			t.Errorf("unexpected plaintext probe %+v", probe)
+		}
+		credential := auth.Credential
+		if credential == nil || !credential.Secure || credential.Username != "admin" {
+			t.Fatalf("unexpected credential %+v", credential)
+		}
+		if password == "secret" && (!credential.Success || !credential.FullAuthRequired) {
+			t.Errorf("login with %s should succeed: %+v", password, credential)
+		}
+		if password == "wrong" && (credential.Success || !isError(credential, "ER_ACCESS_DENIED_ERROR")) {
+			t.Errorf("login with %s should fail: %+v", password, credential)
+		}
+	}
+}
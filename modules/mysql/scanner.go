@@ -1,7 +1,8 @@
 // Package mysql provides the mysql implementation of the zgrab2.Module.
 // Grabs the HandshakePacket (or ERRPacket) that the server sends
 // immediately upon connecting, and then if applicable negotiate an SSL
-// connection.
+// connection. Optionally, it tests a credential and reports whether the
+// server requires TLS.
 package mysql
 
 import (
@@ -71,6 +72,10 @@ type ScanResults struct {
 
 	// TLSLog contains the usual shared TLS logs.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// Auth is the authentication report, only set with --auth-report or
+	// --user.
+	Auth *AuthReport `json:"auth,omitempty"`
 }
 
 // Put the error into the results.
@@ -134,7 +139,10 @@ func readResultsFromConnectionLog(connectionLog *mysql.ConnectionLog) *ScanResul
 type Flags struct {
 	zgrab2.BaseFlags
 	zgrab2.TLSFlags
-	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	Verbose    bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	AuthReport bool   `long:"auth-report" description:"Report the authentication plugin, and whether TLS is required by trying to log in without TLS on a second connection"`
+	User       string `long:"user" description:"Log in as this user to test the credential, over TLS if supported"`
+	Password   string `long:"password" description:"Password of --user"`
 }
 
 // Module is the implementation of the zgrab2.Module interface.
@@ -165,6 +173,11 @@ func (m *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (m *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (m *Module) Description() string {
 	return "Perform a handshake with a MySQL database"
@@ -172,6 +185,10 @@ func (m *Module) Description() string {
 
 // Validate validates the flags and returns nil on success.
 func (f *Flags) Validate(args []string) error {
+	if f.Password != "" && f.User == "" {
+		log.Error("--password requires --user")
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
@@ -214,9 +231,12 @@ func (scanner *Scanner) GetTrigger() string {
 // 1. Connects and waits to receive the handshake packet.
 // 2. If the server supports SSL, send an SSLRequest packet, then
 //    perform the standard TLS actions.
-// 3. Process and return the results.
+// 3. With --user, log in over the same connection; with --auth-report,
+//    also try to log in without TLS on a second connection.
+// 4. Process and return the results.
 func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
 	var tlsConn *zgrab2.TLSConnection
+	var auth *AuthReport
 	sql := mysql.NewConnection(&mysql.Config{})
 	defer func() {
 		recovered := recover()
@@ -225,10 +245,14 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 			status = zgrab2.TryGetScanStatus(thrown)
 			// TODO FIXME: do more to distinguish errors
 		}
-		result = readResultsFromConnectionLog(&sql.ConnectionLog)
-		if tlsConn != nil {
-			result.(*ScanResults).TLSLog = tlsConn.GetLog()
+		results := readResultsFromConnectionLog(&sql.ConnectionLog)
+		if results != nil {
+			if tlsConn != nil {
+				results.TLSLog = tlsConn.GetLog()
+			}
+			results.Auth = auth
 		}
+		result = results
 	}()
 	defer sql.Disconnect()
 	var err error
@@ -252,6 +276,11 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 		// Replace sql.Connection to allow hypothetical future calls to go over the secure connection
 		sql.Connection = tlsConn
 	}
+	if s.config.AuthReport || s.config.User != "" {
+		if auth, err = s.getAuthReport(t, sql); err != nil {
+			panic(err)
+		}
+	}
 	// If we made it this far, the scan was a success. The result will be grabbed in the defer block above.
 	return zgrab2.SCAN_SUCCESS, nil, nil
 }
@@ -0,0 +1,585 @@
+package nmap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTotalWait is the wait for the response to a probe without a
+// totalwaitms directive, as in nmap.
+const defaultTotalWait = 5 * time.Second
+
+// defaultTCPWrappedWait is the tcpwrappedms of a NULL probe without one.
+const defaultTCPWrappedWait = 2 * time.Second
+
+// unsupportedPatternError is a regular expression of a match line that Go
+// cannot compile.
+type unsupportedPatternError struct {
+	err error
+}
+
+func (e *unsupportedPatternError) Error() string {
+	return e.err.Error()
+}
+
+// Database is a parsed nmap-service-probes file.
+type Database struct {
+	// Probes are the probes in the order of the file.
+	Probes []*Probe
+
+	// Exclude are the ports no probes are sent to, by protocol.
+	Exclude map[string]portSet
+
+	// Skipped is the number of match lines whose regular expression is not
+	// supported by Go (e.g. backreferences or lookarounds).
+	Skipped int
+}
+
+// Probe is a Probe directive and the lines after it.
+type Probe struct {
+	// Protocol is TCP or UDP.
+	Protocol string
+	Name     string
+	Data     []byte
+
+	Ports    portSet
+	SSLPorts portSet
+
+	// Rarity is from 1 (often useful) to 9 (seldom).
+	Rarity int
+
+	TotalWait      time.Duration
+	TCPWrappedWait time.Duration
+
+	// Fallback names the probes whose matches are also tried on the
+	// responses to this one.
+	Fallback []string
+	Matches  []*Match
+
+	fallbacks []*Probe
+}
+
+// Match is a match or softmatch line.
+type Match struct {
+	Service string
+
+	// Soft is true for a softmatch: the service is known, but the other
+	// probes may tell more.
+	Soft bool
+
+	// The version fields, as templates referring to the groups of the
+	// regular expression ($1, $P(1), $SUBST(1,"a","b"), $I(1,">")).
+	Product    string
+	Version    string
+	Info       string
+	Hostname   string
+	OS         string
+	DeviceType string
+	CPE        []string
+
+	regex *regexp.Regexp
+}
+
+// portRange is an inclusive range of ports.
+type portRange struct {
+	low, high uint
+}
+
+// portSet is a list of port ranges.
+type portSet []portRange
+
+// contains returns true if port is in one of the ranges.
+func (set portSet) contains(port uint) bool {
+	for _, r := range set {
+		if port >= r.low && port <= r.high {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePorts parses a port list such as 21-25,80,T:9100,U:161. The ports
+// after a T: or U: prefix only belong to that protocol, so the list is
+// returned by protocol.
+func parsePorts(spec string) (map[string]portSet, error) {
+	ret := make(map[string]portSet)
+	protocols := []string{"TCP", "UDP"}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case strings.HasPrefix(part, "T:"):
+			protocols, part = []string{"TCP"}, part[2:]
+		case strings.HasPrefix(part, "U:"):
+			protocols, part = []string{"UDP"}, part[2:]
+		}
+		if part == "" {
+			continue
+		}
+		low, high := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			low, high = part[:i], part[i+1:]
+		}
+		l, err := strconv.ParseUint(low, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		h, err := strconv.ParseUint(high, 10, 16)
+		if err != nil || h < l {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		for _, protocol := range protocols {
+			ret[protocol] = append(ret[protocol], portRange{uint(l), uint(h)})
+		}
+	}
+	return ret, nil
+}
+
+// unescape decodes the C-style escapes of a probe string.
+func unescape(s string) ([]byte, error) {
+	var ret []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			ret = append(ret, c)
+			continue
+		}
+		if i++; i == len(s) {
+			return nil, errors.New("trailing backslash")
+		}
+		switch c = s[i]; c {
+		case '0':
+			ret = append(ret, 0)
+		case 'a':
+			ret = append(ret, '\a')
+		case 'b':
+			ret = append(ret, '\b')
+		case 'f':
+			ret = append(ret, '\f')
+		case 'n':
+			ret = append(ret, '\n')
+		case 'r':
+			ret = append(ret, '\r')
+		case 't':
+			ret = append(ret, '\t')
+		case 'v':
+			ret = append(ret, '\v')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, errors.New("truncated \\x escape")
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid \\x escape %q", s[i-1:i+3])
+			}
+			ret = append(ret, byte(v))
+			i += 2
+		default:
+			ret = append(ret, c)
+		}
+	}
+	return ret, nil
+}
+
+// latin1 maps each byte of b to the rune of the same value, so that Go
+// regular expressions, which match runes, match the bytes of the responses
+// as PCRE does, and \xHH matches the byte HH.
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// fromLatin1 reverses latin1.
+func fromLatin1(s string) []byte {
+	ret := make([]byte, 0, len(s))
+	for _, r := range s {
+		ret = append(ret, byte(r))
+	}
+	return ret
+}
+
+// delimited splits s, which starts with a delimiter, into the text up to the
+// next delimiter and what follows it.
+func delimited(s string) (string, string, error) {
+	if s == "" {
+		return "", "", errors.New("missing delimiter")
+	}
+	end := strings.IndexByte(s[1:], s[0])
+	if end < 0 {
+		return "", "", fmt.Errorf("unterminated %c...%c", s[0], s[0])
+	}
+	return s[1 : end+1], s[end+2:], nil
+}
+
+// compilePattern compiles the regular expression of a match line, in the
+// PCRE dialect of nmap, with its i and s options.
+func compilePattern(pattern string, options string) (*regexp.Regexp, error) {
+	prefix := ""
+	for _, option := range options {
+		switch option {
+		case 'i', 's':
+			prefix += string(option)
+		}
+	}
+	if prefix != "" {
+		prefix = "(?" + prefix + ")"
+	}
+	// \Z is the end, or before a final newline.
+	pattern = strings.Replace(pattern, `\Z`, `\n?\z`, -1)
+	return regexp.Compile(prefix + latin1([]byte(pattern)))
+}
+
+// parseMatch parses the rest of a match or softmatch line.
+func parseMatch(line string, soft bool) (*Match, error) {
+	line = strings.TrimSpace(line)
+	space := strings.IndexAny(line, " \t")
+	if space < 0 {
+		return nil, errors.New("missing pattern")
+	}
+	match := &Match{Service: line[:space], Soft: soft}
+	rest := strings.TrimLeft(line[space:], " \t")
+	if !strings.HasPrefix(rest, "m") {
+		return nil, errors.New("missing m/pattern/")
+	}
+	pattern, rest, err := delimited(rest[1:])
+	if err != nil {
+		return nil, err
+	}
+	options := rest
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		options, rest = rest[:i], rest[i:]
+	} else {
+		rest = ""
+	}
+	if match.regex, err = compilePattern(pattern, options); err != nil {
+		return nil, &unsupportedPatternError{err}
+	}
+	for rest = strings.TrimLeft(rest, " \t"); rest != ""; rest = strings.TrimLeft(rest, " \t") {
+		name := rest[:1]
+		if strings.HasPrefix(rest, "cpe:") {
+			name = "cpe:"
+		}
+		var value string
+		if value, rest, err = delimited(rest[len(name):]); err != nil {
+			return nil, fmt.Errorf("field %s: %v", name, err)
+		}
+		// Skip the flags of the field, such as the a of a CPE.
+		if i := strings.IndexAny(rest, " \t"); i >= 0 {
+			rest = rest[i:]
+		} else {
+			rest = ""
+		}
+		switch name {
+		case "p":
+			match.Product = value
+		case "v":
+			match.Version = value
+		case "i":
+			match.Info = value
+		case "h":
+			match.Hostname = value
+		case "o":
+			match.OS = value
+		case "d":
+			match.DeviceType = value
+		case "cpe:":
+			match.CPE = append(match.CPE, "cpe:/"+value)
+		default:
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+	}
+	return match, nil
+}
+
+// parseProbe parses the rest of a Probe line.
+func parseProbe(line string) (*Probe, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, errors.New("expected: Probe <protocol> <name> q|<string>|")
+	}
+	probe := &Probe{Protocol: fields[0], Name: fields[1], TotalWait: defaultTotalWait}
+	if probe.Protocol != "TCP" && probe.Protocol != "UDP" {
+		return nil, fmt.Errorf("unknown protocol %s", probe.Protocol)
+	}
+	rest := strings.TrimSpace(line)
+	rest = strings.TrimLeft(rest[len(fields[0]):], " \t")
+	rest = strings.TrimLeft(rest[len(fields[1]):], " \t")
+	if !strings.HasPrefix(rest, "q") {
+		return nil, errors.New("missing q|string|")
+	}
+	data, _, err := delimited(rest[1:])
+	if err != nil {
+		return nil, err
+	}
+	if probe.Data, err = unescape(data); err != nil {
+		return nil, err
+	}
+	return probe, nil
+}
+
+// ParseDatabase reads an nmap-service-probes file. Match lines whose regular
+// expression Go cannot compile are skipped and counted.
+func ParseDatabase(r io.Reader) (*Database, error) {
+	db := &Database{Exclude: make(map[string]portSet)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var probe *Probe
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		directive, rest := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			directive, rest = line[:i], strings.TrimSpace(line[i:])
+		}
+		var err error
+		if directive == "Probe" {
+			if probe, err = parseProbe(rest); err == nil {
+				db.Probes = append(db.Probes, probe)
+			}
+		} else if directive == "Exclude" {
+			db.Exclude, err = parsePorts(rest)
+		} else if probe == nil {
+			err = fmt.Errorf("%s before the first Probe", directive)
+		} else {
+			err = probe.parseDirective(directive, rest, db)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", number, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Probe)
+	for _, probe := range db.Probes {
+		byName[probe.Protocol+"/"+probe.Name] = probe
+	}
+	for _, probe := range db.Probes {
+		for _, name := range probe.Fallback {
+			if fallback := byName[probe.Protocol+"/"+name]; fallback != nil && fallback != probe {
+				probe.fallbacks = append(probe.fallbacks, fallback)
+			}
+		}
+	}
+	return db, nil
+}
+
+// parseDirective parses a directive of the probe.
+func (probe *Probe) parseDirective(directive string, rest string, db *Database) error {
+	switch directive {
+	case "match", "softmatch":
+		match, err := parseMatch(rest, directive == "softmatch")
+		if err != nil {
+			if _, ok := err.(*unsupportedPatternError); ok {
+				db.Skipped++
+				return nil
+			}
+			return err
+		}
+		probe.Matches = append(probe.Matches, match)
+	case "ports", "sslports":
+		ports, err := parsePorts(rest)
+		if err != nil {
+			return err
+		}
+		if directive == "ports" {
+			probe.Ports = ports[probe.Protocol]
+		} else {
+			probe.SSLPorts = ports[probe.Protocol]
+		}
+	case "rarity":
+		rarity, err := strconv.Atoi(rest)
+		if err != nil {
+			return fmt.Errorf("invalid rarity %q", rest)
+		}
+		probe.Rarity = rarity
+	case "totalwaitms", "tcpwrappedms":
+		ms, err := strconv.Atoi(rest)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", directive, rest)
+		}
+		if directive == "totalwaitms" {
+			probe.TotalWait = time.Duration(ms) * time.Millisecond
+		} else {
+			probe.TCPWrappedWait = time.Duration(ms) * time.Millisecond
+		}
+	case "fallback":
+		for _, name := range strings.Split(rest, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				probe.Fallback = append(probe.Fallback, name)
+			}
+		}
+	default:
+		// Unknown directives are ignored, as in nmap.
+	}
+	return nil
+}
+
+var (
+	databasesMutex sync.Mutex
+	databases      = make(map[string]*Database)
+)
+
+// LoadDatabase reads the nmap-service-probes file at path. The databases are
+// kept by path, so that the scanners of a scan share them.
+func LoadDatabase(path string) (*Database, error) {
+	databasesMutex.Lock()
+	defer databasesMutex.Unlock()
+	if db, ok := databases[path]; ok {
+		return db, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db, err := ParseDatabase(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	databases[path] = db
+	return db, nil
+}
+
+// nullProbe returns the NULL probe of a protocol, which sends nothing and
+// waits for the greeting of the server, or nil.
+func (db *Database) nullProbe(protocol string) *Probe {
+	for _, probe := range db.Probes {
+		if probe.Protocol == protocol && len(probe.Data) == 0 {
+			return probe
+		}
+	}
+	return nil
+}
+
+// probesFor returns the probes to send to port, in the order of nmap: the
+// NULL probe, then those listing the port (in sslports inside TLS), then the
+// others of rarity up to intensity.
+func (db *Database) probesFor(protocol string, port uint, tls bool, intensity int) []*Probe {
+	var ret []*Probe
+	null := db.nullProbe(protocol)
+	if null != nil && protocol == "TCP" {
+		ret = append(ret, null)
+	}
+	var others []*Probe
+	for _, probe := range db.Probes {
+		if probe.Protocol != protocol || probe == null {
+			continue
+		}
+		listed := probe.Ports.contains(port)
+		if tls {
+			listed = probe.SSLPorts.contains(port)
+		}
+		if listed {
+			ret = append(ret, probe)
+		} else if probe.Rarity <= intensity {
+			others = append(others, probe)
+		}
+	}
+	return append(ret, others...)
+}
+
+// matchesService returns true if the probe, or one of its fallbacks, has a
+// match line for service, so that it may tell more about a softmatch.
+func (probe *Probe) matchesService(service string) bool {
+	for _, p := range append([]*Probe{probe}, probe.fallbacks...) {
+		for _, match := range p.Matches {
+			if match.Service == service && !match.Soft {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match returns the first match line of the probe, of its fallbacks, and of
+// null (unless nil) that matches response, preferring a match to a
+// softmatch, with the groups of its regular expression.
+func (probe *Probe) match(response []byte, null *Probe) (*Match, [][]byte) {
+	probes := append([]*Probe{probe}, probe.fallbacks...)
+	if null != nil && null != probe {
+		probes = append(probes, null)
+	}
+	text := latin1(response)
+	var soft *Match
+	var softGroups [][]byte
+	for _, p := range probes {
+		for _, match := range p.Matches {
+			if soft != nil && match.Soft {
+				continue
+			}
+			groups := match.regex.FindStringSubmatch(text)
+			if groups == nil {
+				continue
+			}
+			ret := make([][]byte, len(groups))
+			for i, group := range groups {
+				ret[i] = fromLatin1(group)
+			}
+			if !match.Soft {
+				return match, ret
+			}
+			soft, softGroups = match, ret
+		}
+	}
+	return soft, softGroups
+}
+
+// templateFunc matches the $P(n), $SUBST(n,"a","b") and $I(n,"<") helpers
+// of the version templates, and their plain $n groups.
+var templateFunc = regexp.MustCompile(`\$(?:P\((\d)\)|SUBST\((\d),"([^"]*)","([^"]*)"\)|I\((\d),"([<>])"\)|(\d))`)
+
+// expand substitutes the groups of a match into a version template.
+func expand(template string, groups [][]byte) string {
+	group := func(s string) []byte {
+		i, _ := strconv.Atoi(s)
+		if i < len(groups) {
+			return groups[i]
+		}
+		return nil
+	}
+	return templateFunc.ReplaceAllStringFunc(template, func(s string) string {
+		m := templateFunc.FindStringSubmatch(s)
+		switch {
+		case m[1] != "":
+			// Only the printable characters.
+			var b []byte
+			for _, c := range group(m[1]) {
+				if c >= 0x20 && c < 0x7f {
+					b = append(b, c)
+				}
+			}
+			return string(b)
+		case m[2] != "":
+			return string(bytes.Replace(group(m[2]), []byte(m[3]), []byte(m[4]), -1))
+		case m[5] != "":
+			// An unsigned integer of up to 8 bytes.
+			b := group(m[5])
+			if len(b) > 8 {
+				return ""
+			}
+			var padded [8]byte
+			if m[6] == ">" {
+				copy(padded[8-len(b):], b)
+				return strconv.FormatUint(binary.BigEndian.Uint64(padded[:]), 10)
+			}
+			copy(padded[:], b)
+			return strconv.FormatUint(binary.LittleEndian.Uint64(padded[:]), 10)
+		}
+		return string(group(m[7]))
+	})
+}
@@ -0,0 +1,149 @@
+package nmap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDatabase = `# A few lines in the format of nmap-service-probes.
+Exclude T:9100-9107
+
+Probe TCP NULL q||
+totalwaitms 6000
+tcpwrappedms 3000
+match ssh m|^SSH-([\d.]+)-OpenSSH_([\w._-]+)[ -]{1,2}Ubuntu[ -_]([^\r\n]+)\r?\n| p/OpenSSH/ v/$2 Ubuntu $3/ i/protocol $1/ o/Linux/ cpe:/a:openbsd:openssh:$2/ cpe:/o:canonical:ubuntu_linux/a
+match ftp m/^220 ([-.\w]+) FTP server \(Version (\d+)\.(\d+)\) ready\.\r\n/ p/NetBSD ftpd/ v/$P(2).$3/ h/$1/
+softmatch ftp m/^220[ -]/
+match weird m=^(\w+)\1$=
+
+Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+rarity 1
+ports 1,70,79,80-85,8080
+sslports 443
+fallback NULL
+match http m|^HTTP/1\.[01] \d\d\d .*\r\nServer: nginx/([\d.]+)|s p/nginx/ v/$1/ cpe:/a:igor_sysoev:nginx:$1/
+match binary m|^\x01\x02(..)| p/binary/ v/$I(1,">")/
+softmatch http m|^HTTP/1\.[01] \d\d\d|
+
+Probe TCP Help q|HELP\r\n|
+rarity 8
+match smtp m|^214 |i
+
+Probe UDP DNSStatusRequest q|\0\0\x10\0\0\0\0\0\0\0\0\0|
+rarity 1
+ports 53
+`
+
+func TestParseDatabase(t *testing.T) {
+	db, err := ParseDatabase(strings.NewReader(testDatabase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Probes) != 4 || db.Skipped != 1 {
+		t.Fatalf("got %d probes, %d skipped", len(db.Probes), db.Skipped)
+	}
+	if !db.Exclude["TCP"].contains(9101) || db.Exclude["UDP"].contains(9101) {
+		t.Errorf("got exclude %v", db.Exclude)
+	}
+	null, get, udp := db.Probes[0], db.Probes[1], db.Probes[3]
+	if len(null.Data) != 0 || null.TotalWait != 6*time.Second || null.TCPWrappedWait != 3*time.Second || len(null.Matches) != 3 {
+		t.Errorf("got NULL probe %+v", null)
+	}
+	if string(get.Data) != "GET / HTTP/1.0\r\n\r\n" || get.Rarity != 1 || !get.Ports.contains(82) || get.Ports.contains(86) || !get.SSLPorts.contains(443) {
+		t.Errorf("got GetRequest probe %+v", get)
+	}
+	if len(get.fallbacks) != 1 || get.fallbacks[0] != null {
+		t.Errorf("got fallbacks %v", get.fallbacks)
+	}
+	if string(udp.Data) != "\x00\x00\x10\x00\x00\x00\x00\x00\x00\x00\x00\x00" || udp.Protocol != "UDP" {
+		t.Errorf("got UDP probe %+v", udp)
+	}
+	if ssh := null.Matches[0]; ssh.Service != "ssh" || ssh.Product != "OpenSSH" || ssh.OS != "Linux" || len(ssh.CPE) != 2 || ssh.CPE[1] != "cpe:/o:canonical:ubuntu_linux" {
+		t.Errorf("got ssh match %+v", ssh)
+	}
+
+	names := func(probes []*Probe) []string {
+		var ret []string
+		for _, probe := range probes {
+			ret = append(ret, probe.Name)
+		}
+		return ret
+	}
+	if got := names(db.probesFor("TCP", 22, false, 7)); !reflect.DeepEqual(got, []string{"NULL", "GetRequest"}) {
+		t.Errorf("probes for 22: %v", got)
+	}
+	if got := names(db.probesFor("TCP", 22, false, 9)); !reflect.DeepEqual(got, []string{"NULL", "GetRequest", "Help"}) {
+		t.Errorf("probes for 22 at intensity 9: %v", got)
+	}
+	if got := names(db.probesFor("TCP", 80, false, 0)); !reflect.DeepEqual(got, []string{"NULL", "GetRequest"}) {
+		t.Errorf("probes for 80 at intensity 0: %v", got)
+	}
+	if got := names(db.probesFor("UDP", 53, false, 0)); !reflect.DeepEqual(got, []string{"DNSStatusRequest"}) {
+		t.Errorf("UDP probes for 53: %v", got)
+	}
+
+	for _, bad := range []string{
+		"match ssh m|^SSH|\n",
+		"Probe TCP NULL q|\n",
+		"Probe SCTP NULL q||\n",
+		"Probe TCP NULL q||\nmatch ssh m|^SSH| x/unknown/\n",
+		"Probe TCP NULL q||\nports 80-\n",
+	} {
+		if _, err := ParseDatabase(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	db, err := ParseDatabase(strings.NewReader(testDatabase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	null, get := db.Probes[0], db.Probes[1]
+	for _, test := range []struct {
+		probe    *Probe
+		response string
+		service  string
+		soft     bool
+		version  string
+	}{
+		{null, "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1\r\n", "ssh", false, "8.9p1 Ubuntu 3ubuntu0.1"},
+		{null, "220 ftp.example.org FTP server (Version 7.2) ready.\r\n", "ftp", false, "7.2"},
+		{null, "220 welcome\r\n", "ftp", true, ""},
+		{get, "HTTP/1.1 200 OK\r\nServer: nginx/1.18.0\r\n\r\n", "http", false, "1.18.0"},
+		{get, "HTTP/1.1 200 OK\r\nServer: Apache\r\n\r\n", "http", true, ""},
+		{get, "\x01\x02\x01\x00rest", "binary", false, "256"},
+		// The NULL probe is the fallback of the GetRequest probe.
+		{get, "SSH-2.0-OpenSSH_7.4 Ubuntu-10\n", "ssh", false, "7.4 Ubuntu 10"},
+		{get, "nothing\r\n", "", false, ""},
+	} {
+		match, groups := test.probe.match([]byte(test.response), nil)
+		if match == nil {
+			if test.service != "" {
+				t.Errorf("%q: no match", test.response)
+			}
+			continue
+		}
+		if match.Service != test.service || match.Soft != test.soft || expand(match.Version, groups) != test.version {
+			t.Errorf("%q: got %s (soft %v) version %q", test.response, match.Service, match.Soft, expand(match.Version, groups))
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	groups := [][]byte{[]byte("all"), []byte("1_2\x00"), []byte("\x10\x00")}
+	for template, expected := range map[string]string{
+		"$1":                  "1_2\x00",
+		"v$P(1)":              "v1_2",
+		`$SUBST(1,"_",".")`:   "1.2\x00",
+		`$I(2,"<") $I(2,">")`: "16 4096",
+		"$9 and $":            " and $",
+	} {
+		if got := expand(template, groups); got != expected {
+			t.Errorf("%s: got %q, expected %q", template, got, expected)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+// Package nmap provides a zgrab2 module that identifies services and their
+// versions with the probes and match lines of nmap's service detection.
+//
+// It loads an nmap-service-probes database (--service-probes) and, like
+// nmap -sV, sends the probes to each target in turn, each on a new
+// connection: the NULL probe first, which waits for a greeting, then the
+// probes listing the target's port, then the other probes of rarity up to
+// --intensity. Each response is checked against the match lines of its
+// probe, of the probe's fallbacks, and of the NULL probe. The first match
+// gives the service, and the product, version and other fields, with the
+// groups of its regular expression substituted; a softmatch gives the
+// service only, and the scan goes on with the probes that may tell its
+// version. When the service is ssl, the probes are repeated inside TLS.
+//
+// The regular expressions of nmap are PCRE; the few that Go does not
+// support, such as those with backreferences or lookarounds, are skipped.
+package nmap
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxResponseLength bounds the probe responses kept in the output.
+const maxResponseLength = 512
+
+// maxReadLength bounds the responses read, as in zgrab2.ReadAvailable.
+const maxReadLength = 512 * 1024
+
+var (
+	errNotIdentified = errors.New("service not identified")
+	errPortExcluded  = errors.New("port excluded by the service probes database")
+)
+
+// Flags holds the command-line configuration for the nmap module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+	zgrab2.UDPFlags
+
+	ServiceProbes string        `long:"service-probes" default:"/usr/share/nmap/nmap-service-probes" description:"Path to the nmap-service-probes database"`
+	Intensity     int           `long:"intensity" default:"7" description:"Also send the probes of rarity up to this (0-9), as nmap's --version-intensity"`
+	ProbeWait     time.Duration `long:"probe-wait" default:"5s" description:"Longest wait for the response to a probe, if its totalwaitms is longer"`
+	UDP           bool          `long:"udp" description:"Send the UDP probes instead of the TCP ones"`
+	NoSSL         bool          `long:"no-ssl" description:"Do not repeat the probes inside TLS when the service is ssl"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config   *Flags
+	database *Database
+}
+
+// ProbeResult is the outcome of a single probe.
+type ProbeResult struct {
+	Name string `json:"name"`
+
+	// TLS is true if the probe was sent inside a TLS session.
+	TLS bool `json:"tls,omitempty"`
+
+	// Response is the start of what the server sent.
+	Response string `json:"response,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Results is the output of the nmap module.
+type Results struct {
+	// Service is the nmap name of the service, e.g. http or ssh, or
+	// tcpwrapped if the server closed the connection without a word.
+	Service string `json:"service,omitempty"`
+
+	Product    string   `json:"product,omitempty"`
+	Version    string   `json:"version,omitempty"`
+	Info       string   `json:"info,omitempty"`
+	Hostname   string   `json:"hostname,omitempty"`
+	OS         string   `json:"os,omitempty"`
+	DeviceType string   `json:"device_type,omitempty"`
+	CPE        []string `json:"cpe,omitempty"`
+
+	// SoftMatch is true if only a softmatch identified the service.
+	SoftMatch bool `json:"soft_match,omitempty"`
+
+	// Tunnel is ssl if the service was identified inside TLS.
+	Tunnel string `json:"tunnel,omitempty"`
+
+	// Probe is the probe whose response identified the service.
+	Probe string `json:"probe,omitempty"`
+
+	Probes []*ProbeResult `json:"probes,omitempty"`
+
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("nmap", "Nmap service detection", module.Description(), 80, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Identify services and versions with the probes of an nmap-service-probes database"
+}
+
+// Validate checks that the flags are valid.
+func (flags *Flags) Validate(args []string) error {
+	if flags.ServiceProbes == "" {
+		log.Error("--service-probes is required")
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.Intensity < 0 || flags.Intensity > 9 {
+		log.Error("--intensity must be between 0 and 9")
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.ProbeWait <= 0 {
+		log.Error("--probe-wait must be positive")
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner and loads the probes database.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	db, err := LoadDatabase(f.ServiceProbes)
+	if err != nil {
+		return err
+	}
+	if db.Skipped > 0 {
+		log.Debugf("%s: skipped %d match lines not supported by Go regular expressions", f.ServiceProbes, db.Skipped)
+	}
+	scanner.database = db
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "nmap"
+}
+
+// protocol returns the protocol of the probes to send.
+func (scanner *Scanner) protocol() string {
+	if scanner.config.UDP {
+		return "UDP"
+	}
+	return "TCP"
+}
+
+// truncate returns the start of a response for the output.
+func truncate(response []byte) string {
+	if len(response) > maxResponseLength {
+		response = response[:maxResponseLength]
+	}
+	return string(response)
+}
+
+// identification collects the probe results of a scan.
+type identification struct {
+	results *Results
+
+	// match is the best match so far, a softmatch until a match is found.
+	match *Match
+
+	// connected is set once a connection to the target succeeded.
+	connected bool
+
+	// err is the first connection error.
+	err error
+}
+
+// record takes a match of the response to probe, unless it is a softmatch
+// and there is already one.
+func (id *identification) record(probe *Probe, match *Match, groups [][]byte) {
+	if match == nil || (match.Soft && id.match != nil) {
+		return
+	}
+	id.match = match
+	results := id.results
+	results.Service = match.Service
+	results.SoftMatch = match.Soft
+	results.Probe = probe.Name
+	results.Product = expand(match.Product, groups)
+	results.Version = expand(match.Version, groups)
+	results.Info = expand(match.Info, groups)
+	results.Hostname = expand(match.Hostname, groups)
+	results.OS = expand(match.OS, groups)
+	results.DeviceType = expand(match.DeviceType, groups)
+	results.CPE = nil
+	for _, cpe := range match.CPE {
+		results.CPE = append(results.CPE, expand(cpe, groups))
+	}
+}
+
+// identified returns true once a match (not a softmatch) was found.
+func (id *identification) identified() bool {
+	return id.match != nil && !id.match.Soft
+}
+
+// open connects to the target, and performs the TLS handshake if tls is set.
+func (scanner *Scanner) open(id *identification, target *zgrab2.ScanTarget, tls bool) (net.Conn, error) {
+	if scanner.config.UDP {
+		conn, err := target.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
+		if err == nil {
+			id.connected = true
+		}
+		return conn, err
+	}
+	conn, err := target.Open(&scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	id.connected = true
+	if !tls {
+		return conn, nil
+	}
+	tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	err = tlsConn.Handshake()
+	if id.results.TLSLog == nil {
+		id.results.TLSLog = tlsConn.GetLog()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	target.Context.RecordTLS(tlsConn)
+	return tlsConn, nil
+}
+
+// exchange sends the probe and reads the response until it matches, the
+// server closes the connection, or the wait of the probe is over. closed is
+// set if the server closed the connection.
+func (scanner *Scanner) exchange(conn net.Conn, probe *Probe, null *Probe) (response []byte, match *Match, groups [][]byte, closed bool, err error) {
+	if len(probe.Data) > 0 {
+		if _, err = conn.Write(probe.Data); err != nil {
+			return nil, nil, nil, false, err
+		}
+	}
+	wait := probe.TotalWait
+	if wait > scanner.config.ProbeWait {
+		wait = scanner.config.ProbeWait
+	}
+	deadline := time.Now().Add(wait)
+	buf := make([]byte, 8192)
+	for time.Now().Before(deadline) {
+		if err = conn.SetReadDeadline(deadline); err != nil {
+			return response, match, groups, false, err
+		}
+		n, readErr := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if n > 0 {
+			if match, groups = probe.match(response, null); match != nil && !match.Soft {
+				return response, match, groups, false, nil
+			}
+		}
+		if readErr != nil {
+			if zgrab2.IsTimeoutError(readErr) {
+				return response, match, groups, false, nil
+			}
+			return response, match, groups, true, nil
+		}
+		if len(response) >= maxReadLength {
+			break
+		}
+	}
+	return response, match, groups, false, nil
+}
+
+// probe runs the probes of the target, inside TLS if tls is set, until one
+// identifies the service.
+func (scanner *Scanner) probe(id *identification, target *zgrab2.ScanTarget, port uint, tls bool) {
+	protocol := scanner.protocol()
+	var null *Probe
+	if protocol == "TCP" {
+		null = scanner.database.nullProbe(protocol)
+	}
+	for _, probe := range scanner.database.probesFor(protocol, port, tls, scanner.config.Intensity) {
+		if id.identified() || target.Ctx().Err() != nil {
+			return
+		}
+		if id.match != nil && !probe.matchesService(id.match.Service) {
+			// The probe cannot tell more about the softmatch.
+			continue
+		}
+		result := &ProbeResult{Name: probe.Name, TLS: tls}
+		id.results.Probes = append(id.results.Probes, result)
+		start := time.Now()
+		conn, err := scanner.open(id, target, tls)
+		if err != nil {
+			result.Error = err.Error()
+			if id.err == nil {
+				id.err = err
+			}
+			// Without a connection, no other probe gets a response.
+			return
+		}
+		response, match, groups, closed, err := scanner.exchange(conn, probe, null)
+		conn.Close()
+		result.Response = truncate(response)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		id.record(probe, match, groups)
+		if probe == null && len(response) == 0 && closed && !tls {
+			wrapped := probe.TCPWrappedWait
+			if wrapped == 0 {
+				wrapped = defaultTCPWrappedWait
+			}
+			if time.Since(start) < wrapped {
+				// The server closes the connections before a word,
+				// e.g. behind tcpwrappers.
+				id.results.Service = "tcpwrapped"
+				return
+			}
+		}
+	}
+}
+
+// Scan identifies the service of the target.
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	port := scanner.config.Port
+	if target.Port != nil {
+		port = *target.Port
+	}
+	if scanner.database.Exclude[scanner.protocol()].contains(port) {
+		return zgrab2.SCAN_BLOCKED, nil, errPortExcluded
+	}
+	id := &identification{results: new(Results)}
+	scanner.probe(id, &target, port, false)
+	if id.identified() && id.match.Service == "ssl" && !scanner.config.NoSSL && !scanner.config.UDP {
+		inner := &identification{results: new(Results)}
+		scanner.probe(inner, &target, port, true)
+		id.results.Probes = append(id.results.Probes, inner.results.Probes...)
+		id.results.TLSLog = inner.results.TLSLog
+		if inner.match != nil {
+			probes, tlsLog := id.results.Probes, id.results.TLSLog
+			*id.results = *inner.results
+			id.results.Probes, id.results.TLSLog = probes, tlsLog
+			id.results.Tunnel = "ssl"
+		}
+	}
+	if err := target.Ctx().Err(); err != nil {
+		return zgrab2.SCAN_CANCELED, id.results, err
+	}
+	results := id.results
+	if results.Service == "" {
+		if !id.connected && id.err != nil {
+			// The port could not be reached at all.
+			return zgrab2.TryGetScanStatus(id.err), nil, id.err
+		}
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, errNotIdentified
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,114 @@
+package nmap
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// serve accepts connections and hands them to handle.
+func serve(t *testing.T, handle func(net.Conn)) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func scan(t *testing.T, port uint) (zgrab2.ScanStatus, *Results) {
+	path := filepath.Join(t.TempDir(), "nmap-service-probes")
+	if err := ioutil.WriteFile(path, []byte(testDatabase), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags:     zgrab2.BaseFlags{Port: port, Timeout: 5 * time.Second},
+		ServiceProbes: path,
+		Intensity:     7,
+		ProbeWait:     300 * time.Millisecond,
+	}
+	if err := scanner.Init(flags); err != nil {
+		t.Fatal(err)
+	}
+	target := zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1"), Context: zgrab2.NewTargetContext()}
+	status, result, _ := scanner.Scan(target)
+	results, _ := result.(*Results)
+	return status, results
+}
+
+func TestScanGreeting(t *testing.T) {
+	port := serve(t, func(conn net.Conn) {
+		conn.Write([]byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1\r\n"))
+		time.Sleep(time.Second)
+	})
+	status, results := scan(t, port)
+	if status != zgrab2.SCAN_SUCCESS || results.Service != "ssh" || results.Version != "8.9p1 Ubuntu 3ubuntu0.1" || results.Probe != "NULL" || len(results.Probes) != 1 {
+		t.Fatalf("got %s %+v", status, results)
+	}
+	if len(results.CPE) != 2 || results.CPE[0] != "cpe:/a:openbsd:openssh:8.9p1" {
+		t.Errorf("got CPE %v", results.CPE)
+	}
+}
+
+func TestScanSoftMatch(t *testing.T) {
+	// The softmatch of the silent NULL probe is completed by GetRequest.
+	port := serve(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "GET ") {
+			return
+		}
+		conn.Write([]byte("HTTP/1.0 200 OK\r\n"))
+		time.Sleep(50 * time.Millisecond)
+		conn.Write([]byte("Server: nginx/1.25.3\r\n\r\n"))
+	})
+	status, results := scan(t, port)
+	if status != zgrab2.SCAN_SUCCESS || results.Service != "http" || results.Product != "nginx" || results.Version != "1.25.3" || results.SoftMatch || results.Probe != "GetRequest" {
+		t.Fatalf("got %s %+v", status, results)
+	}
+}
+
+func TestScanTCPWrapped(t *testing.T) {
+	port := serve(t, func(conn net.Conn) {})
+	status, results := scan(t, port)
+	if status != zgrab2.SCAN_SUCCESS || results.Service != "tcpwrapped" {
+		t.Fatalf("got %s %+v", status, results)
+	}
+}
+
+func TestScanNotIdentified(t *testing.T) {
+	port := serve(t, func(conn net.Conn) {
+		conn.Write([]byte("hello\r\n"))
+		time.Sleep(time.Second)
+	})
+	status, results := scan(t, port)
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || results.Service != "" || len(results.Probes) != 2 || results.Probes[0].Response != "hello\r\n" {
+		t.Fatalf("got %s %+v", status, results)
+	}
+}
+
+func TestLoadDatabaseMissing(t *testing.T) {
+	if _, err := LoadDatabase(filepath.Join(os.TempDir(), "no-such-nmap-service-probes")); err == nil {
+		t.Error("missing database loaded")
+	}
+}
@@ -0,0 +1,219 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ControlOpReadVar is the CTL_OP_READVAR opcode of a mode 6 (control) packet.
+// With association ID 0 it reads the system variables.
+const ControlOpReadVar uint8 = 2
+
+// maxResponsePackets bounds the number of packets read for a single mode 6 or
+// mode 7 request; ntpd sends at most 100 packets in response to monlist.
+const maxResponsePackets = 128
+
+// ErrControlResponse is returned if a mode 6 response does not match the
+// request.
+var ErrControlResponse = errors.New("unexpected control response")
+
+// ControlError is the error code of a mode 6 response with the error bit set.
+type ControlError uint8
+
+// Error implements the error interface.
+func (err ControlError) Error() string {
+	return fmt.Sprintf("control error %d", uint8(err))
+}
+
+// ControlHeader is the header of a mode 6 (control) packet, as defined in
+// RFC 9327.
+type ControlHeader struct {
+	Version       uint8           `json:"version"`
+	Mode          AssociationMode `json:"mode"`
+	IsResponse    bool            `json:"is_response"`
+	IsError       bool            `json:"is_error"`
+	HasMore       bool            `json:"has_more"`
+	OpCode        uint8           `json:"opcode"`
+	Sequence      uint16          `json:"sequence"`
+	Status        uint16          `json:"status"`
+	AssociationID uint16          `json:"association_id"`
+	Offset        uint16          `json:"offset"`
+	Count         uint16          `json:"count"`
+}
+
+// Encode encodes the header as the 12 bytes of a mode 6 packet.
+func (header *ControlHeader) Encode() ([]byte, error) {
+	if (header.Mode>>3) != 0 || (header.Version>>3) != 0 || (header.OpCode>>5) != 0 {
+		return nil, ErrInvalidHeader
+	}
+	ret := make([]byte, 12)
+	ret[0] = uint8(header.Mode) | (header.Version << 3)
+	ret[1] = header.OpCode
+	if header.IsResponse {
+		ret[1] |= 0x80
+	}
+	if header.IsError {
+		ret[1] |= 0x40
+	}
+	if header.HasMore {
+		ret[1] |= 0x20
+	}
+	binary.BigEndian.PutUint16(ret[2:4], header.Sequence)
+	binary.BigEndian.PutUint16(ret[4:6], header.Status)
+	binary.BigEndian.PutUint16(ret[6:8], header.AssociationID)
+	binary.BigEndian.PutUint16(ret[8:10], header.Offset)
+	binary.BigEndian.PutUint16(ret[10:12], header.Count)
+	return ret, nil
+}
+
+// decodeControlHeader decodes a mode 6 header from the first 12 bytes of buf.
+func decodeControlHeader(buf []byte) (*ControlHeader, error) {
+	if len(buf) < 12 {
+		return nil, ErrInvalidHeader
+	}
+	return &ControlHeader{
+		Version:       buf[0] >> 3 & 0x07,
+		Mode:          AssociationMode(buf[0] & 0x07),
+		IsResponse:    buf[1]&0x80 != 0,
+		IsError:       buf[1]&0x40 != 0,
+		HasMore:       buf[1]&0x20 != 0,
+		OpCode:        buf[1] & 0x1f,
+		Sequence:      binary.BigEndian.Uint16(buf[2:4]),
+		Status:        binary.BigEndian.Uint16(buf[4:6]),
+		AssociationID: binary.BigEndian.Uint16(buf[6:8]),
+		Offset:        binary.BigEndian.Uint16(buf[8:10]),
+		Count:         binary.BigEndian.Uint16(buf[10:12]),
+	}, nil
+}
+
+// Amplification compares the size of a request with the total size of its
+// response packets (UDP payloads).
+type Amplification struct {
+	RequestSize  int `json:"request_size"`
+	ResponseSize int `json:"response_size"`
+	Packets      int `json:"packets"`
+
+	// Ratio is ResponseSize / RequestSize.
+	Ratio float64 `json:"ratio"`
+}
+
+// addPacket counts a response packet of the given size.
+func (amp *Amplification) addPacket(size int) {
+	amp.Packets++
+	amp.ResponseSize += size
+	if amp.RequestSize > 0 {
+		amp.Ratio = float64(amp.ResponseSize) / float64(amp.RequestSize)
+	}
+}
+
+// ReadVarResult is the response to a mode 6 READVAR request for the system
+// variables.
+type ReadVarResult struct {
+	// Variables are all of the returned system variables.
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// Version, System, Processor and RefID are the values of the version,
+	// system, processor and refid variables.
+	Version   string `json:"version,omitempty"`
+	System    string `json:"system,omitempty"`
+	Processor string `json:"processor,omitempty"`
+	RefID     string `json:"refid,omitempty"`
+
+	// Header is the header of the first response packet. Debug only.
+	Header *ControlHeader `json:"header,omitempty" zgrab:"debug"`
+
+	// Amplification is the size of the request and of the response.
+	Amplification *Amplification `json:"amplification,omitempty"`
+}
+
+// parseVariables parses a comma-separated list of name=value pairs, where
+// values may be quoted strings containing commas.
+func parseVariables(data string) map[string]string {
+	ret := make(map[string]string)
+	var fields []string
+	quoted := false
+	start := 0
+	for i, c := range data {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			fields = append(fields, data[start:i])
+			start = i + 1
+		}
+	}
+	fields = append(fields, data[start:])
+	for _, field := range fields {
+		field = strings.TrimSpace(strings.TrimRight(field, "\x00"))
+		if field == "" {
+			continue
+		}
+		name, value := field, ""
+		if i := strings.Index(field, "="); i >= 0 {
+			name, value = field[:i], field[i+1:]
+		}
+		ret[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return ret
+}
+
+// ReadVar sends a mode 6 READVAR request for the system variables, and
+// reassembles the (possibly fragmented) response into result.ReadVar.
+func (scanner *Scanner) ReadVar(sock net.Conn, result *Results) error {
+	request, err := (&ControlHeader{
+		Version:  scanner.config.Version,
+		Mode:     Control,
+		OpCode:   ControlOpReadVar,
+		Sequence: 1,
+	}).Encode()
+	if err != nil {
+		return err
+	}
+	readVar := &ReadVarResult{Amplification: &Amplification{RequestSize: len(request)}}
+	result.ReadVar = readVar
+	if _, err := sock.Write(request); err != nil {
+		return err
+	}
+	var data []byte
+	buf := make([]byte, 1024)
+	for i := 0; i < maxResponsePackets; i++ {
+		n, err := sock.Read(buf)
+		if err != nil {
+			return err
+		}
+		header, err := decodeControlHeader(buf[:n])
+		if err != nil {
+			return err
+		}
+		if header.Mode != Control || !header.IsResponse || header.OpCode != ControlOpReadVar || header.Sequence != 1 {
+			return ErrControlResponse
+		}
+		readVar.Amplification.addPacket(n)
+		if readVar.Header == nil {
+			readVar.Header = header
+		}
+		if header.IsError {
+			return ControlError(header.Status >> 8)
+		}
+		end := int(header.Offset) + int(header.Count)
+		if 12+int(header.Count) > n {
+			return ErrInvalidResponse
+		}
+		if end > len(data) {
+			data = append(data, make([]byte, end-len(data))...)
+		}
+		copy(data[header.Offset:end], buf[12:12+int(header.Count)])
+		if !header.HasMore {
+			break
+		}
+	}
+	readVar.Variables = parseVariables(string(data))
+	readVar.Version = readVar.Variables["version"]
+	readVar.System = readVar.Variables["system"]
+	readVar.Processor = readVar.Variables["processor"]
+	readVar.RefID = readVar.Variables["refid"]
+	return nil
+}
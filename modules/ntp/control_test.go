@@ -0,0 +1,128 @@
+package ntp
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+const testVariables = `version="ntpd 4.2.6p5@1.2349-o Fri Jul 22 17:30:51 UTC 2016 (1)", processor="x86_64", system="Linux/3.10.0-1160.el7.x86_64", leap=00, stratum=2, refid=192.0.2.1, tc=10`
+
+func TestParseVariables(t *testing.T) {
+	expected := map[string]string{
+		"version":   "ntpd 4.2.6p5@1.2349-o Fri Jul 22 17:30:51 UTC 2016 (1)",
+		"processor": "x86_64",
+		"system":    "Linux/3.10.0-1160.el7.x86_64",
+		"leap":      "00",
+		"stratum":   "2",
+		"refid":     "192.0.2.1",
+		"tc":        "10",
+	}
+	if got := parseVariables(testVariables + "\r\n"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected variables %v", got)
+	}
+}
+
+// controlPacket returns a READVAR response fragment with the given data.
+func controlPacket(t *testing.T, offset int, data string, more bool) []byte {
+	header, err := (&ControlHeader{
+		Version:    2,
+		Mode:       Control,
+		IsResponse: true,
+		HasMore:    more,
+		OpCode:     ControlOpReadVar,
+		Sequence:   1,
+		Offset:     uint16(offset),
+		Count:      uint16(len(data)),
+	}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(header, data...)
+}
+
+// monlistPacket returns a monlist response packet with two 72-byte items.
+func monlistPacket(t *testing.T, more bool) []byte {
+	header, err := (&PrivatePacketHeader{
+		IsResponse:           true,
+		HasMore:              more,
+		Version:              2,
+		Mode:                 Private,
+		ImplementationNumber: ImplXNTPD,
+		RequestCode:          ReqMonGetList1,
+		NumItems:             2,
+		ItemSize:             72,
+	}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(header, make([]byte, 2*72)...)
+}
+
+// serveNTP answers READVAR with two fragments and monlist with three
+// packets.
+func serveNTP(t *testing.T) uint {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	half := len(testVariables) / 2
+	responses := map[AssociationMode][][]byte{
+		Control: {
+			controlPacket(t, 0, testVariables[:half], true),
+			controlPacket(t, half, testVariables[half:], false),
+		},
+		Private: {monlistPacket(t, true), monlistPacket(t, true), monlistPacket(t, false)},
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n == 0 {
+				continue
+			}
+			for _, response := range responses[AssociationMode(buf[0]&0x07)] {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+	return uint(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func TestAmplification(t *testing.T) {
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags:   zgrab2.BaseFlags{Port: serveNTP(t), Timeout: 5 * time.Second},
+		Version:     2,
+		SkipGetTime: true,
+		MonList:     true,
+		ReadVar:     true,
+		RequestCode: "REQ_MON_GETLIST_1",
+	}
+	scanner.Init(flags)
+	status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	results := result.(*Results)
+	readVar := results.ReadVar
+	if readVar == nil || readVar.RefID != "192.0.2.1" || readVar.System != "Linux/3.10.0-1160.el7.x86_64" || readVar.Processor != "x86_64" {
+		t.Fatalf("unexpected readvar result %+v", readVar)
+	}
+	expected := &Amplification{RequestSize: 12, ResponseSize: 24 + len(testVariables), Packets: 2}
+	expected.Ratio = float64(expected.ResponseSize) / 12
+	if !reflect.DeepEqual(readVar.Amplification, expected) {
+		t.Errorf("unexpected readvar amplification %+v", readVar.Amplification)
+	}
+	expected = &Amplification{RequestSize: 48, ResponseSize: 3 * (8 + 2*72), Packets: 3, Ratio: 3 * (8 + 2*72) / 48.0}
+	if !reflect.DeepEqual(results.MonListAmplification, expected) {
+		t.Errorf("unexpected monlist amplification %+v", results.MonListAmplification)
+	}
+}
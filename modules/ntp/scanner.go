@@ -3,7 +3,10 @@
 //
 // The default scan does a standard get time request.
 //
-// Passing the monlist flag will check for the DDoS-amplifying MONLIST command.
+// Passing the monlist flag will check for the DDoS-amplifying MONLIST command,
+// and the readvar flag will read the system variables (mode 6 READVAR), which
+// is amplification-prone as well. Both record the size of the request and of
+// the response.
 //
 // The results of the scan are the version number and the time returned by the
 // server, and if verbose results are enabled, the entire parsed response
@@ -789,6 +792,15 @@ type Results struct {
 	// MonListHeader is the header returned by the call to monlist.
 	// Only present if --monlist is set. Debug only.
 	MonListHeader *PrivatePacketHeader `json:"monlist_header,omitempty" zgrab:"debug"`
+
+	// MonListAmplification is the size of the monlist request and of all of
+	// the response packets.
+	// Only present if --monlist is set and the server responded.
+	MonListAmplification *Amplification `json:"monlist_amplification,omitempty"`
+
+	// ReadVar is the response to the mode 6 READVAR request.
+	// Only present if --readvar is set.
+	ReadVar *ReadVarResult `json:"readvar,omitempty"`
 }
 
 // Flags holds the command-line flags for the scanner.
@@ -800,6 +812,7 @@ type Flags struct {
 	LeapIndicator uint8  `long:"leap-indicator" description:"The LI value to pass to the Server. Default 3 (Unknown)"`
 	SkipGetTime   bool   `long:"skip-get-time" description:"If set, don't request the Server time"`
 	MonList       bool   `long:"monlist" description:"Perform a ReqMonGetList request"`
+	ReadVar       bool   `long:"readvar" description:"Perform a mode 6 READVAR request for the system variables"`
 	RequestCode   string `long:"request-code" description:"Specify a request code for MonList other than ReqMonGetList" default:"REQ_MON_GETLIST"`
 }
 
@@ -831,6 +844,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Results)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Scan for NTP"
@@ -953,6 +971,11 @@ func (scanner *Scanner) MonList(sock net.Conn, result *Results) (zgrab2.ScanStat
 	}
 	if header != nil {
 		result.MonListHeader = header
+		result.MonListAmplification = &Amplification{RequestSize: 8 + len(body)}
+		result.MonListAmplification.addPacket(8 + len(ret))
+		if err == nil && header.HasMore {
+			scanner.countMorePackets(sock, header, result.MonListAmplification)
+		}
 	}
 	if err != nil {
 		switch {
@@ -968,6 +991,26 @@ func (scanner *Scanner) MonList(sock net.Conn, result *Results) (zgrab2.ScanStat
 	return zgrab2.SCAN_SUCCESS, err
 }
 
+// countMorePackets reads the remaining packets of a multi-packet mode 7
+// response, until one without the "more" bit, and counts them in amp.
+func (scanner *Scanner) countMorePackets(sock net.Conn, first *PrivatePacketHeader, amp *Amplification) {
+	buf := make([]byte, 1024)
+	for amp.Packets < maxResponsePackets {
+		n, err := sock.Read(buf)
+		if err != nil {
+			return
+		}
+		header, err := decodePrivatePacketHeader(buf[:n])
+		if err != nil || header.Mode != Private || !header.IsResponse || header.RequestCode != first.RequestCode {
+			return
+		}
+		amp.addPacket(n)
+		if !header.HasMore {
+			return
+		}
+	}
+}
+
 // GetTime sends a "Client" packet to the Server and reads / returns the response
 func (scanner *Scanner) GetTime(sock net.Conn) (*NTPHeader, error) {
 	outPacket := NTPHeader{}
@@ -999,13 +1042,17 @@ func (scanner *Scanner) GetTime(sock net.Conn) (*NTPHeader, error) {
 // line arguments as follows:
 // 1. If SkipGetTime is not set, send a GetTime packet to the server and read
 //    the response packet into the result.
-// 2. If MonList is set, send a MONLIST packet to the server and read the
+// 2. If ReadVar is set, send a READVAR packet to the server and read the
+//    system variables into the result.
+// 3. If MonList is set, send a MONLIST packet to the server and read the
 //    response packet into the result.
 // The presence of an NTP service at the target can be inferred by a non-nil
 // result -- if the service does not return any data or if the response is not
 // a valid NTP packet, then the result will be nil.
 // The presence of a DDoS-amplifying target can be inferred by
-// result.MonListReponse being present.
+// result.MonListReponse being present, or result.ReadVar.Variables; the
+// amplification ratios are in result.MonListAmplification and
+// result.ReadVar.Amplification.
 func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	sock, err := t.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
 	if err != nil {
@@ -1024,10 +1071,16 @@ func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{
 		result.Time = &temp
 		result.Version = &inPacket.Version
 	}
+	var readVarErr error
+	if scanner.config.ReadVar {
+		// Run monlist even if READVAR fails, since servers often restrict
+		// one but not the other.
+		readVarErr = scanner.ReadVar(sock, result)
+	}
 	if scanner.config.MonList {
 		status, err := scanner.MonList(sock, result)
 		if err != nil {
-			if scanner.config.SkipGetTime {
+			if scanner.config.SkipGetTime && (!scanner.config.ReadVar || readVarErr != nil) {
 				// TODO: Currently, returning a non-nil result means that the service was positively detected.
 				// It may be safer to add an explicit flag for this (status == success is not sufficient, since e.g. you can get a timeout after positively identifying the service)
 				// This also means that partial TLS handshakes cannot be returned
@@ -1036,6 +1089,18 @@ func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{
 			return status, result, err
 		}
 	}
+	if readVarErr != nil {
+		status := zgrab2.TryGetScanStatus(readVarErr)
+		if _, ok := readVarErr.(ControlError); ok {
+			status = zgrab2.SCAN_APPLICATION_ERROR
+		} else if readVarErr == ErrControlResponse || readVarErr == ErrInvalidResponse {
+			status = zgrab2.SCAN_PROTOCOL_ERROR
+		}
+		if scanner.config.SkipGetTime && result.ReadVar.Header == nil && result.MonListResponse == nil {
+			return status, nil, readVarErr
+		}
+		return status, result, readVarErr
+	}
 
 	return zgrab2.SCAN_SUCCESS, result, nil
 }
@@ -142,16 +142,16 @@ func u16Flag(v string) uint16 {
 	return uint16(ret)
 }
 
-// Connect to the server and do a handshake with the given config.
-func (conn *Connection) Connect(connectDescriptor string) (*HandshakeLog, error) {
-	result := HandshakeLog{}
+// newConnectPacket returns a Connect packet with the configured options and
+// the given connect descriptor.
+func (conn *Connection) newConnectPacket(connectDescriptor string) (*TNSConnect, error) {
 	extraData := []byte{}
 	if len(connectDescriptor)+len(extraData)+0x3A > 0x7fff {
 		return nil, ErrInvalidInput
 	}
 
 	// TODO: Variable fields in the connect descriptor (e.g. host?)
-	connectPacket := &TNSConnect{
+	return &TNSConnect{
 		Version:                 conn.scanner.config.Version,
 		MinVersion:              conn.scanner.config.MinVersion,
 		GlobalServiceOptions:    ServiceOptions(u16Flag(conn.scanner.config.GlobalServiceOptions)),
@@ -171,6 +171,15 @@ func (conn *Connection) Connect(connectDescriptor string) (*HandshakeLog, error)
 		ConnectionID1:           [8]byte{0, 0, 0, 0, 0, 0, 0, 0},
 		Unknown3A:               extraData,
 		ConnectDescriptor:       connectDescriptor,
+	}, nil
+}
+
+// Connect to the server and do a handshake with the given config.
+func (conn *Connection) Connect(connectDescriptor string) (*HandshakeLog, error) {
+	result := HandshakeLog{}
+	connectPacket, err := conn.newConnectPacket(connectDescriptor)
+	if err != nil {
+		return nil, err
 	}
 	response, err := conn.SendPacket(connectPacket)
 
@@ -0,0 +1,314 @@
+package oracle
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// Responses to a Connect packet.
+const (
+	responseAccept   = "accept"
+	responseRefuse   = "refuse"
+	responseRedirect = "redirect"
+)
+
+// Connect descriptors of the listener commands.
+const (
+	versionDescriptor  = "(CONNECT_DATA=(COMMAND=VERSION))"
+	registerDescriptor = "(CONNECT_DATA=(COMMAND=service_register_NSGR))"
+)
+
+// maxVersionPackets bounds the number of Data packets read after the
+// listener accepted the VERSION command.
+const maxVersionPackets = 16
+
+// Listener errors meaning that the service is known, but cannot take the
+// connection. Other errors, e.g. 12505 (unknown SID) or 12514 (unknown
+// service), mean that it is not known.
+var knownServiceErrors = map[string]bool{
+	"12516": true, // no available handler with matching protocol stack
+	"12518": true, // could not hand off client connection
+	"12519": true, // no appropriate service handler found
+	"12520": true, // no available handler for requested type of server
+	"12526": true, // all appropriate instances are in restricted mode
+	"12527": true, // all instances are in restricted mode or blocking
+	"12528": true, // all appropriate instances are blocking new connections
+}
+
+// bannerRegex matches the first line of the listener's version banner, e.g.
+// "TNSLSNR for Linux: Version 19.0.0.0.0 - Production".
+var bannerRegex = regexp.MustCompile(`TNSLSNR for ([^:]+): Version ([0-9.]+)(?: - (\w+))?`)
+
+// ListenerVersion is the listener's response to the VERSION command.
+type ListenerVersion struct {
+	// Response is "accept", "refuse" or "redirect".
+	Response string `json:"response"`
+
+	// DescriptorRaw is the descriptor returned by the listener.
+	DescriptorRaw string `json:"descriptor_raw,omitempty"`
+
+	// Version is the DESCRIPTION.VSNNUM of the descriptor, in dotted-decimal
+	// format.
+	Version string `json:"version,omitempty"`
+
+	// ErrorCode is the DESCRIPTION.ERR of the descriptor; e.g. 1189 if the
+	// listener refuses remote administration.
+	ErrorCode string `json:"error_code,omitempty"`
+
+	// Banner is the text returned after the listener accepted the command.
+	Banner string `json:"banner,omitempty"`
+
+	// Platform, BannerVersion and Edition are parsed from the banner.
+	Platform      string `json:"platform,omitempty"`
+	BannerVersion string `json:"banner_version,omitempty"`
+	Edition       string `json:"edition,omitempty"`
+
+	// Error is set if the command failed.
+	Error string `json:"error,omitempty"`
+}
+
+// SIDCheck is the listener's response to a connect descriptor with a SID or
+// service name.
+type SIDCheck struct {
+	// Name is the SID or service name.
+	Name string `json:"name"`
+
+	// Type is "sid" or "service_name".
+	Type string `json:"type"`
+
+	// Acknowledged is true if the listener knows the SID or service.
+	Acknowledged bool `json:"acknowledged"`
+
+	// Response is "accept", "refuse" or "redirect".
+	Response string `json:"response,omitempty"`
+
+	// ErrorCode is the DESCRIPTION.ERR of the Refuse packet.
+	ErrorCode string `json:"error_code,omitempty"`
+
+	// Error is set if the check failed.
+	Error string `json:"error,omitempty"`
+}
+
+// PoisonCheck tells whether the listener accepts remote service
+// registration, which allows TNS poisoning (CVE-2012-1675).
+type PoisonCheck struct {
+	// Susceptible is true if the listener accepted the registration
+	// command. Nothing is registered: the connection is closed right after.
+	Susceptible bool `json:"susceptible"`
+
+	// Response is "accept", "refuse" or "redirect".
+	Response string `json:"response,omitempty"`
+
+	// ErrorCode is the DESCRIPTION.ERR of the Refuse packet, e.g. 12508 or
+	// 1169 if registration is restricted to local or valid nodes.
+	ErrorCode string `json:"error_code,omitempty"`
+
+	// Error is set if the check failed.
+	Error string `json:"error,omitempty"`
+}
+
+// splitList splits a comma-separated flag value.
+func splitList(value string) []string {
+	var ret []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// openConnection opens a new connection to the target, wrapped in TLS if
+// --tcps is set.
+func (scanner *Scanner) openConnection(t *zgrab2.ScanTarget) (*Connection, error) {
+	sock, err := t.Open(&scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	if scanner.config.TCPS {
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(sock)
+		if err != nil {
+			sock.Close()
+			return nil, err
+		}
+		if err = tlsConn.Handshake(); err != nil {
+			sock.Close()
+			return nil, err
+		}
+		sock = tlsConn
+	}
+	return &Connection{
+		conn:      sock,
+		scanner:   scanner,
+		target:    t,
+		tnsDriver: scanner.getTNSDriver(),
+	}, nil
+}
+
+// probe sends a Connect packet with the descriptor on a new connection, and
+// returns the open connection and the response. The caller closes the
+// connection.
+func (scanner *Scanner) probe(t *zgrab2.ScanTarget, descriptor string) (*Connection, TNSPacketBody, error) {
+	conn, err := scanner.openConnection(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	connectPacket, err := conn.newConnectPacket(descriptor)
+	if err != nil {
+		conn.conn.Close()
+		return nil, nil, err
+	}
+	response, err := conn.SendPacket(connectPacket)
+	if err != nil {
+		conn.conn.Close()
+		return nil, nil, err
+	}
+	return conn, response, nil
+}
+
+// describeResponse returns the type of the response to a Connect packet,
+// and the descriptor it carries.
+func describeResponse(response TNSPacketBody) (string, string, error) {
+	switch resp := response.(type) {
+	case *TNSAccept:
+		return responseAccept, string(resp.AcceptData), nil
+	case *TNSRefuse:
+		return responseRefuse, string(resp.Data), nil
+	case *TNSRedirect:
+		return responseRedirect, string(resp.Data), nil
+	}
+	return "", "", ErrUnexpectedResponse
+}
+
+// descriptorValue returns the first value of key in the raw descriptor, or
+// "" if there is none.
+func descriptorValue(raw string, key string) string {
+	descriptor, err := DecodeDescriptor(raw)
+	if err != nil {
+		return ""
+	}
+	if values := descriptor.GetValues(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// getListenerVersion sends the VERSION command, and reads the banner if the
+// listener accepts it.
+func (scanner *Scanner) getListenerVersion(t *zgrab2.ScanTarget) (*ListenerVersion, error) {
+	conn, response, err := scanner.probe(t, versionDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.conn.Close()
+	ret := new(ListenerVersion)
+	if ret.Response, ret.DescriptorRaw, err = describeResponse(response); err != nil {
+		return ret, err
+	}
+	if vsnnum := descriptorValue(ret.DescriptorRaw, "DESCRIPTION.VSNNUM"); vsnnum != "" {
+		if v, err := strconv.ParseUint(vsnnum, 10, 32); err == nil {
+			ret.Version = ReleaseVersion(v).String()
+		}
+	}
+	ret.ErrorCode = descriptorValue(ret.DescriptorRaw, "DESCRIPTION.ERR")
+	if ret.Response != responseAccept {
+		return ret, nil
+	}
+	var banner []byte
+	for i := 0; i < maxVersionPackets; i++ {
+		packet, err := conn.readPacket()
+		if err != nil {
+			break
+		}
+		data, ok := packet.Body.(*TNSData)
+		if !ok {
+			break
+		}
+		banner = append(banner, data.Data...)
+		if data.DataFlags&DFEOF != 0 {
+			break
+		}
+	}
+	ret.Banner = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, string(banner)))
+	if m := bannerRegex.FindStringSubmatch(ret.Banner); m != nil {
+		ret.Platform, ret.BannerVersion, ret.Edition = m[1], m[2], m[3]
+	}
+	return ret, nil
+}
+
+// checkSID connects with a descriptor for the given SID or service name.
+func (scanner *Scanner) checkSID(t *zgrab2.ScanTarget, typ string, name string) *SIDCheck {
+	ret := &SIDCheck{Name: name, Type: typ}
+	descriptor := fmt.Sprintf("(DESCRIPTION=(CONNECT_DATA=(%s=%s)(CID=(PROGRAM=zgrab2))))", strings.ToUpper(typ), name)
+	conn, response, err := scanner.probe(t, descriptor)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer conn.conn.Close()
+	var raw string
+	if ret.Response, raw, err = describeResponse(response); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	switch ret.Response {
+	case responseAccept, responseRedirect:
+		ret.Acknowledged = true
+	case responseRefuse:
+		ret.ErrorCode = descriptorValue(raw, "DESCRIPTION.ERR")
+		ret.Acknowledged = knownServiceErrors[ret.ErrorCode]
+	}
+	return ret
+}
+
+// checkPoison sends the service registration command, without registering
+// anything.
+func (scanner *Scanner) checkPoison(t *zgrab2.ScanTarget) *PoisonCheck {
+	ret := new(PoisonCheck)
+	conn, response, err := scanner.probe(t, registerDescriptor)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer conn.conn.Close()
+	var raw string
+	if ret.Response, raw, err = describeResponse(response); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	ret.Susceptible = ret.Response == responseAccept
+	ret.ErrorCode = descriptorValue(raw, "DESCRIPTION.ERR")
+	return ret
+}
+
+// enumerate runs the optional listener checks.
+func (scanner *Scanner) enumerate(t *zgrab2.ScanTarget, results *ScanResults) {
+	if scanner.config.ListenerVersion {
+		version, err := scanner.getListenerVersion(t)
+		if err != nil {
+			if version == nil {
+				version = new(ListenerVersion)
+			}
+			version.Error = err.Error()
+		}
+		results.ListenerVersion = version
+	}
+	for _, sid := range splitList(scanner.config.SIDs) {
+		results.SIDs = append(results.SIDs, scanner.checkSID(t, "sid", sid))
+	}
+	for _, name := range splitList(scanner.config.ServiceNames) {
+		results.SIDs = append(results.SIDs, scanner.checkSID(t, "service_name", name))
+	}
+	if scanner.config.CheckPoison {
+		results.TNSPoison = scanner.checkPoison(t)
+	}
+}
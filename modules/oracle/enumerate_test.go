@@ -0,0 +1,138 @@
+package oracle
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+const testBanner = "TNSLSNR for Linux: Version 19.0.0.0.0 - Production\nTNS for Linux: Version 19.0.0.0.0 - Production"
+
+// refuse returns a Refuse packet with the given DESCRIPTION.ERR.
+func refuse(code string) *TNSRefuse {
+	data := []byte("(DESCRIPTION=(TMP=)(VSNNUM=318767104)(ERR=" + code + ")(ERROR_STACK=(ERROR=(CODE=" + code + ")(EMFI=4))))")
+	return &TNSRefuse{AppReason: 0x22, DataLength: uint16(len(data)), Data: data}
+}
+
+// accept returns an Accept packet with the given descriptor.
+func accept(descriptor string) *TNSAccept {
+	return &TNSAccept{
+		Version:    0x013a,
+		SDU:        0x2000,
+		TDU:        0xffff,
+		ByteOrder:  defaultByteOrder,
+		DataLength: uint16(len(descriptor)),
+		DataOffset: 32,
+		Unknown18:  make([]byte, 8),
+		AcceptData: []byte(descriptor),
+	}
+}
+
+// serveListener accepts connections of a listener that knows the SID ORCL,
+// answers the VERSION command and accepts remote service registration.
+func serveListener(t *testing.T) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	driver := &TNSDriver{Mode: TNSModeOld}
+	write := func(conn net.Conn, body TNSPacketBody) {
+		data, err := driver.EncodePacket(&TNSPacket{Body: body})
+		if err == nil {
+			conn.Write(data)
+		}
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				packet, err := driver.ReadTNSPacket(conn)
+				if err != nil {
+					return
+				}
+				connect, ok := packet.Body.(*TNSConnect)
+				if !ok {
+					return
+				}
+				switch descriptor := connect.ConnectDescriptor; {
+				case descriptor == versionDescriptor:
+					write(conn, accept("(DESCRIPTION=(TMP=)(VSNNUM=318767104)(ERR=0)(ALIAS=LISTENER))"))
+					write(conn, &TNSData{DataFlags: DFEOF, Data: []byte("\x00\x00" + testBanner + "\n")})
+				case descriptor == registerDescriptor:
+					write(conn, accept("(DESCRIPTION=(TMP=)(VSNNUM=318767104)(ERR=0))"))
+				case strings.Contains(descriptor, "(SID=ORCL)"):
+					write(conn, accept(""))
+				case strings.Contains(descriptor, "(SID="):
+					write(conn, refuse("12505"))
+				case strings.Contains(descriptor, "(SERVICE_NAME="):
+					write(conn, refuse("12514"))
+				default:
+					write(conn, refuse("12504"))
+				}
+			}(conn)
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestEnumerate(t *testing.T) {
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags:              zgrab2.BaseFlags{Port: serveListener(t), Timeout: 5 * time.Second},
+		Version:                312,
+		MinVersion:             300,
+		ReleaseVersion:         "11.2.0.4.0",
+		GlobalServiceOptions:   "0x0C41",
+		SDU:                    "0x2000",
+		TDU:                    "0xFFFF",
+		ProtocolCharacterisics: "0x7F08",
+		ConnectFlags:           "0x4141",
+		ListenerVersion:        true,
+		SIDs:                   "ORCL, XE",
+		ServiceNames:           "orclpdb",
+		CheckPoison:            true,
+	}
+	if err := scanner.Init(flags); err != nil {
+		t.Fatal(err)
+	}
+	_, result, _ := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	results, ok := result.(*ScanResults)
+	if !ok || results == nil {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	version := results.ListenerVersion
+	if version == nil || version.Error != "" || version.Response != responseAccept {
+		t.Fatalf("unexpected listener version %+v", version)
+	}
+	if version.Version != "19.0.0.0.0" || version.Banner != testBanner {
+		t.Errorf("unexpected listener version %+v", version)
+	}
+	if version.Platform != "Linux" || version.BannerVersion != "19.0.0.0.0" || version.Edition != "Production" {
+		t.Errorf("unexpected banner fields %+v", version)
+	}
+	expected := []SIDCheck{
+		{Name: "ORCL", Type: "sid", Acknowledged: true, Response: responseAccept},
+		{Name: "XE", Type: "sid", Response: responseRefuse, ErrorCode: "12505"},
+		{Name: "orclpdb", Type: "service_name", Response: responseRefuse, ErrorCode: "12514"},
+	}
+	if len(results.SIDs) != len(expected) {
+		t.Fatalf("expected %d SID checks, got %d", len(expected), len(results.SIDs))
+	}
+	for i, check := range results.SIDs {
+		if *check != expected[i] {
+			t.Errorf("SID check %d: expected %+v, got %+v", i, expected[i], *check)
+		}
+	}
+	poison := results.TNSPoison
+	if poison == nil || !poison.Susceptible || poison.Error != "" {
+		t.Errorf("unexpected poison check %+v", poison)
+	}
+}
@@ -16,6 +16,11 @@
 // Sending an intentionally invalid --connect-descriptor can force a Refuse
 // response, which should include a version number.
 //
+// Further checks use one connection each: --listener-version sends the
+// listener's VERSION command, --sids and --service-names report which of the
+// given names the listener knows, and --check-poison tells whether the
+// listener accepts remote service registration (TNS poisoning).
+//
 // The output includes the server's protocol version and any component release
 // versions that are returned.
 package oracle
@@ -36,6 +41,16 @@ type ScanResults struct {
 	// TLSLog contains the log of the TLS handshake (and any additional
 	// configured TLS scan operations).
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// ListenerVersion is the response to the VERSION command, with
+	// --listener-version.
+	ListenerVersion *ListenerVersion `json:"listener_version,omitempty"`
+
+	// SIDs are the responses for each of --sids and --service-names.
+	SIDs []*SIDCheck `json:"sids,omitempty"`
+
+	// TNSPoison is the result of --check-poison.
+	TNSPoison *PoisonCheck `json:"tns_poison,omitempty"`
 }
 
 // Flags holds the command-line configuration for the HTTP scan module.
@@ -92,6 +107,19 @@ type Flags struct {
 	// Verbose causes more verbose logging, and includes debug fields inthe scan
 	// results.
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+
+	// ListenerVersion sends the VERSION command to the listener.
+	ListenerVersion bool `long:"listener-version" description:"Send the listener VERSION command and parse the version banner"`
+
+	// SIDs is a comma-separated list of SIDs to try.
+	SIDs string `long:"sids" description:"Comma-separated list of SIDs to check the listener for"`
+
+	// ServiceNames is a comma-separated list of service names to try.
+	ServiceNames string `long:"service-names" description:"Comma-separated list of service names to check the listener for"`
+
+	// CheckPoison checks whether the listener accepts remote service
+	// registration.
+	CheckPoison bool `long:"check-poison" description:"Check whether the listener accepts remote service registration (TNS poisoning, CVE-2012-1675); nothing is registered"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -122,6 +150,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Perform a handshake with Oracle database servers"
@@ -216,7 +249,10 @@ func (scanner *Scanner) getTNSDriver() *TNSDriver {
 //  7. Pull the server protocol version and other flags from the Accept packet
 //     into the results, then send a Native Security Negotiation Data packet.
 //  8. If the response is not a Data packet, exit with SCAN_APPLICATION_ERROR.
-//  9. Pull the versions out of the response and exit with SCAN_SUCCESS.
+//  9. Pull the versions out of the response.
+//  10. If a TNS response was received, run the optional listener checks
+//      (VERSION command, SIDs and service names, TNS poisoning), each on a
+//      new connection, then exit with SCAN_SUCCESS.
 func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	var results *ScanResults
 
@@ -261,6 +297,7 @@ func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{
 			results = new(ScanResults)
 		}
 		results.Handshake = handshakeLog
+		scanner.enumerate(&t, results)
 	}
 
 	if err != nil {
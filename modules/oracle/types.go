@@ -838,7 +838,7 @@ func (packet *TNSRefuse) Encode() ([]byte, error) {
 
 // GetType identifies the packet as PacketTypeRefuse.
 func (packet *TNSRefuse) GetType() PacketType {
-	return PacketTypeRedirect
+	return PacketTypeRefuse
 }
 
 // ReadTNSRefuse reads a TNSRefuse packet from the stream, which should
@@ -1523,6 +1523,8 @@ func (driver *TNSDriver) ReadTNSPacket(reader io.Reader) (*TNSPacket, error) {
 		body, err = ReadTNSAccept(reader, header)
 	case PacketTypeRefuse:
 		body, err = ReadTNSRefuse(reader, header)
+	case PacketTypeRedirect:
+		body, err = ReadTNSRedirect(reader, header)
 	case PacketTypeResend:
 		body, err = ReadTNSResend(reader, header)
 	case PacketTypeData:
@@ -0,0 +1,83 @@
+package pop3
+
+import (
+	"strings"
+)
+
+// CapabilityResults lists the capabilities of the server before and after
+// STLS, and the authentication it offers.
+type CapabilityResults struct {
+	// Capabilities are the lines of the response to the first CAPA
+	// command (RFC 2449), with their parameters.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// StartTLSCapabilities are the capabilities after STLS.
+	StartTLSCapabilities []string `json:"starttls_capabilities,omitempty"`
+
+	// Added and Removed are the capabilities gained and lost after STLS.
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+
+	// AuthMechanisms are the SASL mechanisms of the last CAPA response.
+	AuthMechanisms []string `json:"auth_mechanisms,omitempty"`
+
+	// CleartextAuthMechanisms are the SASL mechanisms offered before TLS
+	// was negotiated, i.e. over an unencrypted connection.
+	CleartextAuthMechanisms []string `json:"cleartext_auth_mechanisms,omitempty"`
+
+	// CleartextUser is true if USER/PASS authentication was offered over
+	// an unencrypted connection.
+	CleartextUser bool `json:"cleartext_user"`
+
+	// AuthProbes are the server's answers to starting an AUTH exchange with
+	// each mechanism (--auth-probe).
+	AuthProbes []AuthProbe `json:"auth_probes,omitempty"`
+}
+
+// AuthProbe is the server's answer to an AUTH command that was cancelled
+// without sending credentials.
+type AuthProbe struct {
+	Mechanism string `json:"mechanism"`
+
+	// Accepted is true if the server started the exchange with a
+	// continuation ("+ ").
+	Accepted bool `json:"accepted"`
+
+	// Response is the server's answer; for challenge-response mechanisms
+	// it holds the server's challenge.
+	Response string `json:"response"`
+}
+
+// parseCAPA returns the capability lines of a CAPA response, without the
+// status line and the terminating ".".
+func parseCAPA(response string) []string {
+	var capabilities []string
+	lines := strings.Split(strings.TrimRight(response, "\r\n"), "\n")
+	for _, line := range lines[1:] {
+		if line = strings.TrimSpace(line); line != "" && line != "." {
+			capabilities = append(capabilities, line)
+		}
+	}
+	return capabilities
+}
+
+// probeAuth starts an AUTH exchange with each mechanism and cancels it with
+// "*" (RFC 5034) as soon as the server sends a continuation.
+func probeAuth(conn *Connection, mechanisms []string) ([]AuthProbe, error) {
+	probes := make([]AuthProbe, 0, len(mechanisms))
+	for _, mechanism := range mechanisms {
+		ret, err := conn.SendCommand("AUTH " + mechanism)
+		if err != nil {
+			return probes, err
+		}
+		probe := AuthProbe{Mechanism: mechanism, Response: strings.TrimSpace(ret)}
+		if strings.HasPrefix(ret, "+ ") || strings.TrimSpace(ret) == "+" {
+			probe.Accepted = true
+			if _, err := conn.SendCommand("*"); err != nil {
+				return probes, err
+			}
+		}
+		probes = append(probes, probe)
+	}
+	return probes, nil
+}
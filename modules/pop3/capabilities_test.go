@@ -0,0 +1,86 @@
+package pop3
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// servePOP3 accepts one connection of a server offering USER and SASL PLAIN
+// and CRAM-MD5, sending its CAPA response in several writes.
+func servePOP3(t *testing.T) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "+OK POP3 ready\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch strings.TrimSpace(line) {
+			case "CAPA":
+				fmt.Fprint(conn, "+OK Capability list follows\r\n")
+				time.Sleep(10 * time.Millisecond)
+				fmt.Fprint(conn, "TOP\r\nUSER\r\n")
+				time.Sleep(10 * time.Millisecond)
+				fmt.Fprint(conn, "SASL PLAIN CRAM-MD5\r\n.\r\n")
+			case "AUTH PLAIN":
+				fmt.Fprint(conn, "+ \r\n")
+			case "AUTH CRAM-MD5":
+				fmt.Fprint(conn, "+ PDEyMzRAZXhhbXBsZS5jb20+\r\n")
+			case "*":
+				fmt.Fprint(conn, "-ERR Authentication cancelled\r\n")
+			default:
+				fmt.Fprint(conn, "-ERR Unknown command\r\n")
+			}
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestCapabilities(t *testing.T) {
+	flags := &Flags{
+		BaseFlags: zgrab2.BaseFlags{Port: servePOP3(t), Timeout: 5 * time.Second},
+		AuthProbe: true,
+	}
+	if err := flags.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	var scanner Scanner
+	scanner.Init(flags)
+	status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	results := result.(*ScanResults)
+	caps := results.Capabilities
+	if caps == nil || !reflect.DeepEqual(caps.Capabilities, []string{"TOP", "USER", "SASL PLAIN CRAM-MD5"}) {
+		t.Fatalf("unexpected capabilities %+v (%q)", caps, results.CAPA)
+	}
+	if !caps.CleartextUser || !reflect.DeepEqual(caps.CleartextAuthMechanisms, []string{"PLAIN", "CRAM-MD5"}) || results.TLSLog != nil {
+		t.Errorf("unexpected results %+v", caps)
+	}
+	expected := []AuthProbe{
+		{Mechanism: "PLAIN", Accepted: true, Response: "+"},
+		{Mechanism: "CRAM-MD5", Accepted: true, Response: "+ PDEyMzRAZXhhbXBsZS5jb20+"},
+	}
+	if !reflect.DeepEqual(caps.AuthProbes, expected) {
+		t.Errorf("unexpected auth probes %+v", caps.AuthProbes)
+	}
+}
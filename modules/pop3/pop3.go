@@ -14,22 +14,38 @@ import (
 // This is the regex used in zgrab.
 var pop3EndRegex = regexp.MustCompile(`(?:\r\n\.\r\n$)|(?:\r\n$)`)
 
+// pop3MultilineEndRegex matches a complete multi-line response (RFC 1939,
+// section 3), or a single-line error.
+var pop3MultilineEndRegex = regexp.MustCompile(`(?s)^(?:-[^\n]*\n|\+.*\n\.\r?\n)$`)
+
 const readBufferSize int = 0x10000
 
 // Connection wraps the state and access to the SMTP connection.
 type Connection struct {
 	Conn net.Conn
+
+	// TruncatedByTimeout is set if a read timed out before the end of a
+	// response; the partial response is still returned.
+	TruncatedByTimeout bool
 }
 
 // ReadResponse reads from the connection until it matches the pop3EndRegex. Copied from the original zgrab.
 // TODO: Catch corner cases
 func (conn *Connection) ReadResponse() (string, error) {
+	return conn.readUntil(pop3EndRegex)
+}
+
+// readUntil reads from the connection until the data read matches expr.
+func (conn *Connection) readUntil(expr *regexp.Regexp) (string, error) {
 	ret := make([]byte, readBufferSize)
-	n, err := zgrab2.ReadUntilRegex(conn.Conn, ret, pop3EndRegex)
+	n, err := zgrab2.ReadUntilRegex(conn.Conn, ret, expr)
 	// Don't quit for timeouts since we might have gotten relevant data still
 	if err != nil && err != io.EOF && !zgrab2.IsTimeoutError(err) {
 		return "", err
 	}
+	if zgrab2.TruncatedByTimeout(n, err) {
+		conn.TruncatedByTimeout = true
+	}
 	return string(ret[:n]), nil
 }
 
@@ -40,3 +56,12 @@ func (conn *Connection) SendCommand(cmd string) (string, error) {
 	}
 	return conn.ReadResponse()
 }
+
+// SendMultilineCommand sends a command whose successful response is
+// multi-line, and reads the response up to the terminating ".".
+func (conn *Connection) SendMultilineCommand(cmd string) (string, error) {
+	if _, err := conn.Conn.Write([]byte(cmd + "\r\n")); err != nil {
+		return "", err
+	}
+	return conn.readUntil(pop3MultilineEndRegex)
+}
@@ -15,6 +15,12 @@
 // --pop3s does not change the default port number from 110, so
 // it should usually be coupled with e.g. --port 995.
 //
+// The --capabilities flag tells the scanner to send CAPA, upgrade the
+// connection with STLS if the server offers it, and send CAPA again,
+// recording the capabilities before and after TLS and the SASL mechanisms
+// offered. With --auth-probe, an AUTH exchange with each mechanism is
+// started and cancelled before any credentials are sent.
+//
 // The --send-quit flag tells the scanner to send a QUIT command
 // before disconnecting.
 //
@@ -31,6 +37,8 @@ import (
 	"strings"
 
 	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/mailcaps"
+	"github.com/Positive-Engineer/zgrab2/lib/mailsoftware"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -48,11 +56,27 @@ type ScanResults struct {
 	// StartTLS is the server's response to the STARTTLS command, if it is sent.
 	StartTLS string `json:"starttls,omitempty"`
 
+	// CAPA is the server's response to the CAPA command sent by
+	// --capabilities, and CAPAStartTLS the response after STLS.
+	CAPA         string `json:"capa,omitempty"`
+	CAPAStartTLS string `json:"capa_starttls,omitempty"`
+
+	// Capabilities holds the results of --capabilities.
+	Capabilities *CapabilityResults `json:"capabilities,omitempty"`
+
 	// QUIT is the server's response to the QUIT command, if it is sent.
 	QUIT string `json:"quit,omitempty"`
 
 	// TLSLog is the standard TLS log, if --starttls or --pop3s is enabled.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// TruncatedByTimeout is true if a response was cut short by a read
+	// timeout; the partial response is kept.
+	TruncatedByTimeout bool `json:"truncated_by_timeout,omitempty"`
+
+	// Software is the server software named in the banner, with its
+	// release date and end of life status.
+	Software *mailsoftware.Software `json:"software,omitempty"`
 }
 
 // Flags holds the command-line configuration for the POP3 scan module.
@@ -76,8 +100,17 @@ type Flags struct {
 	// StartTLS indicates that the client should attempt to update the connection to TLS.
 	StartTLS bool `long:"starttls" description:"Send STLS before negotiating"`
 
+	// Capabilities enables the CAPA, STLS, CAPA walk.
+	Capabilities bool `long:"capabilities" description:"Send CAPA, upgrade with STLS if offered and send CAPA again, recording the capabilities, how they changed and the authentication offered"`
+
+	// AuthProbe enables starting (and cancelling) each SASL mechanism.
+	AuthProbe bool `long:"auth-probe" description:"Start an AUTH exchange with each offered SASL mechanism and cancel it before sending credentials. Implies --capabilities."`
+
 	// Verbose indicates that there should be more verbose logging.
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+
+	// SoftwareTable replaces the built-in mail server release table.
+	SoftwareTable string `long:"software-table" description:"CSV file of product,version,release,released,eol rows replacing the built-in mail server release table"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -108,6 +141,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Fetch POP3 banners, optionally over TLS"
@@ -121,6 +159,9 @@ func (flags *Flags) Validate(args []string) error {
 		log.Error("Cannot send both --starttls and --pop3s")
 		return zgrab2.ErrInvalidArguments
 	}
+	if flags.AuthProbe {
+		flags.Capabilities = true
+	}
 	return nil
 }
 
@@ -133,6 +174,9 @@ func (flags *Flags) Help() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*Flags)
 	scanner.config = f
+	if f.SoftwareTable != "" {
+		return mailsoftware.LoadTable(f.SoftwareTable)
+	}
 	return nil
 }
 
@@ -163,6 +207,18 @@ func getPOP3Error(response string) error {
 	return fmt.Errorf("POP3 error: %s", response[1:])
 }
 
+// sendCAPA sends CAPA and returns the response and the capabilities.
+func sendCAPA(conn *Connection) (string, []string, error) {
+	ret, err := conn.SendMultilineCommand("CAPA")
+	if err != nil {
+		return ret, nil, err
+	}
+	if err := getPOP3Error(ret); err != nil {
+		return ret, nil, err
+	}
+	return ret, parseCAPA(ret), nil
+}
+
 // Check the contents of the POP3 header and return a relevant ScanStatus
 func VerifyPOP3Contents(banner string) zgrab2.ScanStatus {
 	lowerBanner := strings.ToLower(banner)
@@ -191,10 +247,14 @@ func VerifyPOP3Contents(banner string) zgrab2.ScanStatus {
 // 3. Read the banner.
 // 4. If --send-help is sent, send HELP, read the result.
 // 5. If --send-noop is sent, send NOOP, read the result.
-// 6. If --starttls is sent, send STLS, read the result, negotiate a
-//    TLS connection using the command-line flags.
-// 7. If --send-quit is sent, send QUIT and read the result.
-// 8. Close the connection.
+// 6. If --capabilities is set, send CAPA.
+// 7. If --starttls is sent, or --capabilities is set and the server offers
+//    STLS, send STLS, read the result, negotiate a TLS connection using the
+//    command-line flags.
+// 8. If --capabilities is set, send CAPA again after STLS, and with
+//    --auth-probe start and cancel each SASL mechanism.
+// 9. If --send-quit is sent, send QUIT and read the result.
+// 10. Close the connection.
 func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	c, err := target.Open(&scanner.config.BaseFlags)
 	if err != nil {
@@ -225,6 +285,7 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		return sr, nil, errors.New("Invalid response for POP3")
 	}
 	result.Banner = banner
+	result.Software = mailsoftware.Identify(banner)
 	if scanner.config.SendHELP {
 		ret, err := conn.SendCommand("HELP")
 		if err != nil {
@@ -239,7 +300,23 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		}
 		result.NOOP = ret
 	}
-	if scanner.config.StartTLS {
+	startTLS := scanner.config.StartTLS
+	if scanner.config.Capabilities {
+		ret, capabilities, err := sendCAPA(&conn)
+		result.CAPA = ret
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		caps := &CapabilityResults{Capabilities: capabilities}
+		caps.AuthMechanisms = mailcaps.Mechanisms(capabilities, "SASL")
+		if !scanner.config.POP3Secure {
+			caps.CleartextAuthMechanisms = caps.AuthMechanisms
+			caps.CleartextUser = mailcaps.Has(capabilities, "USER")
+			startTLS = startTLS || mailcaps.Has(capabilities, "STLS")
+		}
+		result.Capabilities = caps
+	}
+	if startTLS {
 		ret, err := conn.SendCommand("STLS")
 		if err != nil {
 			return zgrab2.TryGetScanStatus(err), result, err
@@ -257,6 +334,22 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 		conn.Conn = tlsConn
+		if caps := result.Capabilities; caps != nil {
+			ret, capabilities, err := sendCAPA(&conn)
+			result.CAPAStartTLS = ret
+			if err != nil {
+				return zgrab2.TryGetScanStatus(err), result, err
+			}
+			caps.StartTLSCapabilities = capabilities
+			caps.Added, caps.Removed = mailcaps.Delta(caps.Capabilities, capabilities)
+			caps.AuthMechanisms = mailcaps.Mechanisms(capabilities, "SASL")
+		}
+	}
+	if caps := result.Capabilities; caps != nil && scanner.config.AuthProbe {
+		caps.AuthProbes, err = probeAuth(&conn, caps.AuthMechanisms)
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
 	}
 	if scanner.config.SendQUIT {
 		ret, err := conn.SendCommand("QUIT")
@@ -267,5 +360,6 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		}
 		result.QUIT = ret
 	}
+	result.TruncatedByTimeout = conn.TruncatedByTimeout
 	return sr, result, nil
 }
@@ -0,0 +1,359 @@
+package postgres
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// defaultAuthUser is the user of the StartupMessages of --auth-report when
+// --user is not set.
+const defaultAuthUser = "postgres"
+
+// sqlStateInvalidAuthorization is the SQLSTATE of errors refusing the
+// connection before authentication, e.g. when no pg_hba.conf entry matches.
+const sqlStateInvalidAuthorization = "28000"
+
+// scramSHA256 is the SASL mechanism used to test credentials.
+const scramSHA256 = "SCRAM-SHA-256"
+
+// Codes of the 'R'-type packets handled when testing a credential.
+const (
+	authOK                = 0
+	authCleartextPassword = 3
+	authMD5Password       = 5
+	authSASL              = 10
+	authSASLContinue      = 11
+	authSASLFinal         = 12
+)
+
+// maxAuthRounds bounds the number of packets read while authenticating.
+const maxAuthRounds = 8
+
+// AuthOffer is the server's response to a StartupMessage for the user.
+type AuthOffer struct {
+	// Mode is the authentication mode the server asked for, e.g.
+	// "password_md5" or "sasl"; "ok" means no password is needed.
+	Mode string `json:"mode,omitempty"`
+
+	// SASLMechanisms are the mechanisms offered in "sasl" mode.
+	SASLMechanisms []string `json:"sasl_mechanisms,omitempty"`
+
+	// Error is the error returned instead, e.g. if no pg_hba.conf entry
+	// matches.
+	Error *PostgresError `json:"error,omitempty"`
+}
+
+// CredentialCheck is the result of logging in with --password.
+type CredentialCheck struct {
+	// Mode is the authentication mode, or SASL mechanism, that was used.
+	Mode string `json:"mode,omitempty"`
+
+	// Secure is true if the password was sent over TLS.
+	Secure bool `json:"secure"`
+
+	// Success is true if the server accepted the password.
+	Success bool `json:"success"`
+
+	// Error is the error returned by the server, or describes why the
+	// exchange was aborted.
+	Error *PostgresError `json:"error,omitempty"`
+}
+
+// AuthReport describes how the server authenticates the user.
+type AuthReport struct {
+	// User is the user sent in the StartupMessages.
+	User string `json:"user"`
+
+	// Plaintext is the response without TLS.
+	Plaintext *AuthOffer `json:"plaintext,omitempty"`
+
+	// TLS is the response over TLS, if the server supports it.
+	TLS *AuthOffer `json:"tls,omitempty"`
+
+	// TLSRequired is true if the connection was refused without TLS but
+	// not with it, i.e. pg_hba.conf only has hostssl entries that match.
+	TLSRequired bool `json:"tls_required"`
+
+	// Credential is the result of logging in with --password, over TLS if
+	// supported.
+	Credential *CredentialCheck `json:"credential,omitempty"`
+}
+
+// authError returns a PostgresError for an exchange the client aborted.
+func authError(format string, args ...interface{}) *PostgresError {
+	return &PostgresError{
+		"severity": "client",
+		"message":  fmt.Sprintf(format, args...),
+	}
+}
+
+// startAuth sends a StartupMessage for the user and returns the server's
+// response, along with the 'R'-type packet if there was one.
+func (s *Scanner) startAuth(sql *Connection, user string) (*AuthOffer, *ServerPacket, *zgrab2.ScanError) {
+	kvps := s.getDefaultKVPs()
+	kvps["user"] = user
+	if s.Config.Database != "" {
+		kvps["database"] = s.Config.Database
+	}
+	if err := sql.SendStartupMessage(s.Config.ProtocolVersion, kvps); err != nil {
+		return nil, nil, zgrab2.NewScanError(zgrab2.SCAN_PROTOCOL_ERROR, err)
+	}
+	response, readErr := sql.ReadPacket()
+	if readErr != nil {
+		return nil, nil, readErr
+	}
+	offer := new(AuthOffer)
+	switch {
+	case response.Type == 'E':
+		offer.Error = decodeError(response.Body)
+		return offer, nil, nil
+	case response.Type != 'R' || len(response.Body) < 4:
+		offer.Error = response.ToError()
+		return offer, nil, nil
+	}
+	mode := decodeAuthMode(response.Body)
+	offer.Mode = mode.Mode
+	if binary.BigEndian.Uint32(response.Body) == authSASL {
+		offer.SASLMechanisms = splitNulList(mode.Payload)
+	}
+	return offer, response, nil
+}
+
+// splitNulList splits a list of NUL-terminated strings.
+func splitNulList(buf []byte) []string {
+	var ret []string
+	for _, part := range strings.Split(string(buf), "\x00") {
+		if part != "" {
+			ret = append(ret, part)
+		}
+	}
+	return ret
+}
+
+// getAuthReport sends StartupMessages for the user with and without TLS,
+// and tests --password if set.
+func (s *Scanner) getAuthReport(t *zgrab2.ScanTarget, mgr *connectionManager) (*AuthReport, *zgrab2.ScanError) {
+	report := &AuthReport{User: s.Config.User}
+	if report.User == "" {
+		report.User = defaultAuthUser
+	}
+	sql, connectErr := s.newConnection(t, mgr, true)
+	if connectErr != nil {
+		return report, connectErr
+	}
+	defer mgr.closeConnection(sql)
+	offer, request, scanErr := s.startAuth(sql, report.User)
+	if scanErr != nil {
+		return report, scanErr
+	}
+	report.Plaintext = offer
+	if !s.Config.SkipSSL {
+		secure, connectErr := s.newConnection(t, mgr, false)
+		if connectErr != nil {
+			return report, connectErr
+		}
+		defer mgr.closeConnection(secure)
+		if secure.IsSSL {
+			if report.TLS, request, scanErr = s.startAuth(secure, report.User); scanErr != nil {
+				return report, scanErr
+			}
+			sql = secure
+		}
+	}
+	report.TLSRequired = report.TLS != nil && report.TLS.Error == nil &&
+		report.Plaintext.Error != nil && (*report.Plaintext.Error)["code"] == sqlStateInvalidAuthorization
+	if s.Config.Password != "" && request != nil {
+		report.Credential, scanErr = authenticate(sql, request, report.User, s.Config.Password)
+	}
+	return report, scanErr
+}
+
+// authenticate answers the authentication request with the password,
+// until the server accepts or rejects it.
+func authenticate(sql *Connection, request *ServerPacket, user string, password string) (*CredentialCheck, *zgrab2.ScanError) {
+	ret := &CredentialCheck{Secure: sql.IsSSL}
+	var scram *scramClient
+	for i := 0; i < maxAuthRounds; i++ {
+		if request.Type == 'E' {
+			ret.Error = decodeError(request.Body)
+			return ret, nil
+		}
+		if request.Type != 'R' || len(request.Body) < 4 {
+			ret.Error = request.ToError()
+			return ret, nil
+		}
+		var err error
+		payload := request.Body[4:]
+		switch binary.BigEndian.Uint32(request.Body) {
+		case authOK:
+			ret.Success = true
+			return ret, nil
+		case authCleartextPassword:
+			ret.Mode = decodeAuthMode(request.Body).Mode
+			err = sql.SendMessage('p', append([]byte(password), 0))
+		case authMD5Password:
+			ret.Mode = decodeAuthMode(request.Body).Mode
+			if len(payload) != 4 {
+				ret.Error = request.ToError()
+				return ret, nil
+			}
+			err = sql.SendMessage('p', append([]byte(md5Password(user, password, payload)), 0))
+		case authSASL:
+			ret.Mode = scramSHA256
+			mechanisms := splitNulList(payload)
+			if !containsString(mechanisms, scramSHA256) {
+				ret.Error = authError("unsupported SASL mechanisms %s", strings.Join(mechanisms, ", "))
+				return ret, nil
+			}
+			if scram, err = newSCRAMClient(password); err == nil {
+				err = sql.SendMessage('p', scram.initialResponse())
+			}
+		case authSASLContinue:
+			var response []byte
+			if scram == nil {
+				ret.Error = request.ToError()
+				return ret, nil
+			}
+			if response, err = scram.finalMessage(string(payload)); err != nil {
+				ret.Error = authError("%s", err)
+				return ret, nil
+			}
+			err = sql.SendMessage('p', response)
+		case authSASLFinal:
+			if scram == nil || !scram.verify(string(payload)) {
+				ret.Error = authError("invalid server signature")
+				return ret, nil
+			}
+		default:
+			ret.Mode = decodeAuthMode(request.Body).Mode
+			ret.Error = authError("unsupported authentication mode %s", ret.Mode)
+			return ret, nil
+		}
+		if err != nil {
+			return ret, zgrab2.DetectScanError(err)
+		}
+		var readErr *zgrab2.ScanError
+		if request, readErr = sql.ReadPacket(); readErr != nil {
+			return ret, readErr
+		}
+	}
+	return ret, zgrab2.NewScanError(zgrab2.SCAN_PROTOCOL_ERROR, fmt.Errorf("too many authentication packets"))
+}
+
+// containsString returns true if list contains value.
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// md5Password returns the response to an MD5 password request:
+// "md5" + md5(md5(password + user) + salt), in hex.
+func md5Password(user string, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+// scramClient is the client side of a SCRAM-SHA-256 exchange (RFC 5802,
+// RFC 7677), without channel binding.
+type scramClient struct {
+	password        string
+	clientFirstBare string
+	nonce           string
+	authMessage     string
+	saltedPassword  []byte
+}
+
+// newSCRAMClient returns a scramClient with a random nonce.
+func newSCRAMClient(password string) (*scramClient, error) {
+	random := make([]byte, 18)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	nonce := base64.StdEncoding.EncodeToString(random)
+	// The server uses the user of the StartupMessage, so n is empty.
+	return &scramClient{password: password, nonce: nonce, clientFirstBare: "n=,r=" + nonce}, nil
+}
+
+// initialResponse returns the body of the SASLInitialResponse message.
+func (c *scramClient) initialResponse() []byte {
+	clientFirst := "n,," + c.clientFirstBare
+	ret := append([]byte(scramSHA256), 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(ret[len(scramSHA256)+1:], uint32(len(clientFirst)))
+	return append(ret, clientFirst...)
+}
+
+// scramAttributes parses the comma-separated attributes of a SCRAM
+// message.
+func scramAttributes(message string) map[string]string {
+	ret := make(map[string]string)
+	for _, attribute := range strings.Split(message, ",") {
+		if len(attribute) > 2 && attribute[1] == '=' {
+			ret[attribute[:1]] = attribute[2:]
+		}
+	}
+	return ret
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(message))
+	return h.Sum(nil)
+}
+
+// finalMessage returns the client-final-message for the
+// server-first-message.
+func (c *scramClient) finalMessage(serverFirst string) ([]byte, error) {
+	attributes := scramAttributes(serverFirst)
+	nonce := attributes["r"]
+	if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+		return nil, fmt.Errorf("invalid server nonce %q", nonce)
+	}
+	salt, err := base64.StdEncoding.DecodeString(attributes["s"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %s", err)
+	}
+	iterations, err := strconv.Atoi(attributes["i"])
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("invalid iteration count %q", attributes["i"])
+	}
+	c.saltedPassword = pbkdf2.Key([]byte(c.password), salt, iterations, sha256.Size, sha256.New)
+	// "biws" is base64("n,,"), the GS2 header without channel binding.
+	withoutProof := "c=biws,r=" + nonce
+	c.authMessage = c.clientFirstBare + "," + serverFirst + "," + withoutProof
+	clientKey := hmacSHA256(c.saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	signature := hmacSHA256(storedKey[:], c.authMessage)
+	for i := range clientKey {
+		clientKey[i] ^= signature[i]
+	}
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(clientKey)), nil
+}
+
+// verify checks the server signature of the server-final-message.
+func (c *scramClient) verify(serverFinal string) bool {
+	if c.saltedPassword == nil {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(scramAttributes(serverFinal)["v"])
+	if err != nil {
+		return false
+	}
+	serverKey := hmacSHA256(c.saltedPassword, "Server Key")
+	return hmac.Equal(signature, hmacSHA256(serverKey, c.authMessage))
+}
@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/testutil"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// writeMessage writes a typed server message.
+func writeMessage(conn net.Conn, msgType byte, body ...[]byte) {
+	joined := bytes.Join(body, nil)
+	header := []byte{msgType, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(joined)+4))
+	conn.Write(append(header, joined...))
+}
+
+// writeAuth writes an 'R'-type message with the given code.
+func writeAuth(conn net.Conn, code uint32, payload string) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], code)
+	writeMessage(conn, 'R', buf[:], []byte(payload))
+}
+
+func writeError(conn net.Conn, code string, message string) {
+	writeMessage(conn, 'E', []byte("SFATAL\x00C"+code+"\x00M"+message+"\x00\x00"))
+}
+
+// readMessage reads a typed client message, or an untyped one such as the
+// StartupMessage.
+func readMessage(conn net.Conn, typed bool) ([]byte, error) {
+	if typed {
+		var msgType [1]byte
+		if _, err := io.ReadFull(conn, msgType[:]); err != nil {
+			return nil, err
+		}
+	}
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(length[:])-4)
+	_, err := io.ReadFull(conn, body)
+	return body, err
+}
+
+// serveSCRAM runs the server side of SCRAM-SHA-256 for the password
+// "secret", and returns true if the client proved it knows it.
+func serveSCRAM(conn net.Conn) bool {
+	body, err := readMessage(conn, true)
+	if err != nil || !bytes.HasPrefix(body, []byte(scramSHA256+"\x00")) {
+		return false
+	}
+	clientFirst := string(body[len(scramSHA256)+5:])
+	clientFirstBare := strings.TrimPrefix(clientFirst, "n,,")
+	salt := []byte("0123456789abcdef")
+	serverFirst := "r=" + scramAttributes(clientFirstBare)["r"] + "server-nonce,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+	writeAuth(conn, authSASLContinue, serverFirst)
+	body, err = readMessage(conn, true)
+	if err != nil {
+		return false
+	}
+	clientFinal := string(body)
+	withoutProof := clientFinal[:strings.Index(clientFinal, ",p=")]
+	authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+	saltedPassword := pbkdf2.Key([]byte("secret"), salt, 4096, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	signature := hmacSHA256(storedKey[:], authMessage)
+	for i := range clientKey {
+		clientKey[i] ^= signature[i]
+	}
+	proof, _ := base64.StdEncoding.DecodeString(scramAttributes(clientFinal)["p"])
+	if !hmac.Equal(proof, clientKey) {
+		return false
+	}
+	serverKey := hmacSHA256(saltedPassword, "Server Key")
+	writeAuth(conn, authSASLFinal, "v="+base64.StdEncoding.EncodeToString(hmacSHA256(serverKey, authMessage)))
+	return true
+}
+
+// servePostgres accepts connections of a server that only allows the user
+// "admin" over SSL (hostssl), authenticated with SCRAM-SHA-256.
+func servePostgres(t *testing.T) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	config := &tls.Config{Certificates: []tls.Certificate{testutil.Certificate(t, "postgres.example.com")}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				body, err := readMessage(conn, false)
+				if err != nil {
+					return
+				}
+				secure := false
+				if binary.BigEndian.Uint32(body) == postgresSSLRequest {
+					conn.Write([]byte{'S'})
+					tlsConn := tls.Server(conn, config)
+					if err := tlsConn.Handshake(); err != nil {
+						return
+					}
+					conn, secure = tlsConn, true
+					if body, err = readMessage(conn, false); err != nil {
+						return
+					}
+				}
+				if binary.BigEndian.Uint32(body) != 3<<16 {
+					writeError(conn, "0A000", "unsupported frontend protocol")
+					return
+				}
+				parameters := strings.Split(string(body[4:]), "\x00")
+				user := ""
+				for i := 0; i+1 < len(parameters); i += 2 {
+					if parameters[i] == "user" {
+						user = parameters[i+1]
+					}
+				}
+				switch {
+				case user == "":
+					writeError(conn, "28000", "no PostgreSQL user name specified in startup packet")
+				case !secure:
+					writeError(conn, "28000", `no pg_hba.conf entry for host "127.0.0.1", user "`+user+`", database "`+user+`", no encryption`)
+				default:
+					writeAuth(conn, authSASL, "SCRAM-SHA-256\x00SCRAM-SHA-256-PLUS\x00\x00")
+					if user != "admin" || !serveSCRAM(conn) {
+						writeError(conn, "28P01", `password authentication failed for user "`+user+`"`)
+						return
+					}
+					writeAuth(conn, authOK, "")
+					writeMessage(conn, 'Z', []byte{'I'})
+				}
+			}(conn)
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestAuthReport(t *testing.T) {
+	// The StartupMessage with --user waits for the timeout, since the server
+	// waits for the SASL response.
+	port := servePostgres(t)
+	for _, password := range []string{"secret", "wrong"} {
+		var scanner Scanner
+		flags := &Flags{
+			BaseFlags:       zgrab2.BaseFlags{Port: port, Timeout: time.Second},
+			ProtocolVersion: "3.0",
+			User:            "admin",
+			AuthReport:      true,
+			Password:        password,
+		}
+		scanner.Init(flags)
+		status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+		if status != zgrab2.SCAN_SUCCESS || err != nil {
+			t.Fatalf("scan failed: %s %v", status, err)
+		}
+		auth := result.(*Results).Auth
+		if auth == nil || auth.User != "admin" || !auth.TLSRequired {
+			t.Fatalf("unexpected auth report %+v", auth)
+		}
+		if auth.Plaintext == nil || auth.Plaintext.Error == nil || (*auth.Plaintext.Error)["code"] != "28000" {
+			t.Errorf("unexpected plaintext offer %+v", auth.Plaintext)
+		}
+		expected := &AuthOffer{Mode: "sasl", SASLMechanisms: []string{"SCRAM-SHA-256", "SCRAM-SHA-256-PLUS"}}
+		if !reflect.DeepEqual(auth.TLS, expected) {
+			t.Errorf("unexpected TLS offer %+v", auth.TLS)
+		}
+		credential := auth.Credential
+		if credential == nil || !credential.Secure || credential.Mode != scramSHA256 {
+			t.Fatalf("unexpected credential check %+v", credential)
+		}
+		if password == "secret" && (!credential.Success || credential.Error != nil) {
+			t.Errorf("login with %s should succeed: %+v", password, credential)
+		}
+		if password == "wrong" && (credential.Success || credential.Error == nil || (*credential.Error)["code"] != "28P01") {
+			t.Errorf("login with %s should fail: %+v", password, credential)
+		}
+	}
+}
+
+func TestMD5Password(t *testing.T) {
+	if got := md5Password("admin", "secret", []byte{1, 2, 3, 4}); got != "md5429bdacea953a35c4ece3ab61a18f27f" {
+		t.Errorf("unexpected md5 password %s", got)
+	}
+}
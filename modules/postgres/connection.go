@@ -94,6 +94,17 @@ func (c *Connection) Send(body []byte) error {
 	return err
 }
 
+// SendMessage sends a typed client message, e.g. a 'p'-type
+// PasswordMessage: the type, a big-endian uint32 length and the body.
+func (c *Connection) SendMessage(msgType byte, body []byte) error {
+	toSend := make([]byte, len(body)+5)
+	toSend[0] = msgType
+	binary.BigEndian.PutUint32(toSend[1:], uint32(len(body)+4))
+	copy(toSend[5:], body)
+	_, err := c.Connection.Write(toSend)
+	return err
+}
+
 // SendU32 sends an uint32 packet to the server.
 func (c *Connection) SendU32(val uint32) error {
 	toSend := make([]byte, 8)
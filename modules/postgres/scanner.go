@@ -7,6 +7,8 @@
 // may allow additional data, such as detailed server parameters, to be
 // collected. Absent these, version information must be inferred from
 // the values in the results (e.g. line numbers in error strings).
+// With --auth-report or --password, it also reports the authentication
+// mode offered to a user with and without TLS, and tests the password.
 package postgres
 
 import (
@@ -77,6 +79,10 @@ type Results struct {
 	// TransactionStatus is the value of the 'Z'-type packet returned by
 	// the server after the final StartupMessage.
 	TransactionStatus string `json:"transaction_status,omitempty"`
+
+	// Auth is the authentication report, only set with --auth-report or
+	// --password.
+	Auth *AuthReport `json:"auth,omitempty"`
 }
 
 // PostgresError is parsed the payload of an 'E'-type packet, mapping
@@ -124,6 +130,8 @@ type Flags struct {
 	User            string `long:"user" description:"Username to pass to StartupMessage. If omitted, no user will be sent." default:""`
 	Database        string `long:"database" description:"Database to pass to StartupMessage. If omitted, none will be sent." default:""`
 	ApplicationName string `long:"application-name" description:"application_name value to pass in StartupMessage. If omitted, none will be sent." default:""`
+	AuthReport      bool   `long:"auth-report" description:"Report the authentication mode and SASL mechanisms offered to --user (default postgres) with and without SSL, and whether SSL is required"`
+	Password        string `long:"password" description:"Log in as --user with this password, over SSL if supported. Cleartext password requests are answered without SSL if the server does not support it." default:""`
 }
 
 // Scanner is the zgrab2 scanner type for the postgres protocol
@@ -280,6 +288,11 @@ func (m *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (m *Module) NewResult() interface{} {
+	return new(Results)
+}
+
 // Description returns an overview of this module.
 func (m *Module) Description() string {
 	return "Perform a handshake with a PostgreSQL server"
@@ -287,6 +300,10 @@ func (m *Module) Description() string {
 
 // Validate checks the arguments; on success, returns nil.
 func (f *Flags) Validate(args []string) error {
+	if f.Password != "" && f.User == "" {
+		log.Error("--password requires --user")
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
@@ -389,6 +406,9 @@ func (s *Scanner) getDefaultKVPs() map[string]string {
 //    any/all of user/database/application-name. This is where it gets
 //    backend_key_data, server_parameters, authentication_mode,
 //    transaction_status and user_startup_error.
+// 5. Only with --auth-report or --password: sends a StartupMessage for the
+//    user with and without TLS, and answers the authentication request
+//    with the password. This is where it gets auth.
 //
 // * NOTE: TLS is only used for the first connection, and then only if
 //   both client and server support it.
@@ -532,6 +552,15 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 			return err.Unpack(&results)
 		}
 	}
+
+	// Report the authentication modes, and test the password if provided
+	if s.Config.AuthReport || s.Config.Password != "" {
+		var err *zgrab2.ScanError
+		results.Auth, err = s.getAuthReport(&t, mgr)
+		if err != nil {
+			return err.Unpack(&results)
+		}
+	}
 	return zgrab2.SCAN_SUCCESS, &results, thrown
 }
 
@@ -0,0 +1,130 @@
+// Package quic provides a zgrab2 module that detects QUIC services of any
+// application protocol with a version negotiation probe: the server must
+// answer a packet with a reserved version with the list of versions it
+// supports (RFC 9000, section 6), before any handshake or ALPN check.
+package quic
+
+import (
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/quic"
+	log "github.com/sirupsen/logrus"
+)
+
+// Flags holds the command-line configuration for the quic scan module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the quic module.
+type Results struct {
+	// Versions are the supported versions from the server's Version
+	// Negotiation packet, by name (e.g. v1, v2, draft-29, gquic-Q046).
+	Versions []string `json:"versions"`
+
+	// SupportsV1 is true if version 1 is among them.
+	SupportsV1 bool `json:"supports_v1"`
+}
+
+// defaultTimeout bounds the probe if --timeout is 0.
+const defaultTimeout = 10 * time.Second
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("quic", "QUIC", module.Description(), 443, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Detect QUIC services and list their supported versions with a version negotiation probe"
+}
+
+// Validate checks that the flags are valid.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "quic"
+}
+
+// Scan sends the version negotiation probe.
+func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := t.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	timeout := scanner.config.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	versions, err := quic.ProbeVersions(conn, time.Now().Add(timeout))
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results := &Results{Versions: make([]string, len(versions))}
+	for i, v := range versions {
+		results.Versions[i] = quic.VersionName(v)
+		results.SupportsV1 = results.SupportsV1 || v == quic.Version1
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,88 @@
+package redis
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DataEstimate quantifies the data held by a server that answered INFO,
+// i.e. one that does not require authentication (or accepted --password).
+// It is computed from counters only; no keys or values are read.
+type DataEstimate struct {
+	// Keys is the total number of keys in all databases, from the keyspace
+	// section of INFO.
+	Keys uint64 `json:"keys"`
+
+	// Expires is the number of those keys that have a TTL.
+	Expires uint64 `json:"expires,omitempty"`
+
+	// Databases maps each non-empty database (db0, db1, ...) to its number of
+	// keys.
+	Databases map[string]uint64 `json:"databases,omitempty"`
+
+	// DBSize is the response to DBSIZE, the number of keys in the default
+	// database; it is present even if the keyspace section is missing.
+	DBSize *uint64 `json:"dbsize,omitempty"`
+
+	// UsedMemory is the used_memory field of INFO, in bytes.
+	UsedMemory uint64 `json:"used_memory,omitempty"`
+
+	// UsedMemoryDataset is the used_memory_dataset field of INFO: the memory
+	// used by the data itself, without server overhead.
+	UsedMemoryDataset uint64 `json:"used_memory_dataset,omitempty"`
+}
+
+// parseDataEstimate reads the key and memory counters from an INFO response.
+func parseDataEstimate(info string) *DataEstimate {
+	ret := &DataEstimate{Databases: make(map[string]uint64)}
+	for _, line := range strings.Split(info, "\r\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name, value := parts[0], parts[1]
+		switch {
+		case name == "used_memory":
+			ret.UsedMemory, _ = strconv.ParseUint(value, 10, 64)
+		case name == "used_memory_dataset":
+			ret.UsedMemoryDataset, _ = strconv.ParseUint(value, 10, 64)
+		case strings.HasPrefix(name, "db"):
+			// db0:keys=1,expires=0,avg_ttl=0
+			for _, field := range strings.Split(value, ",") {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				n, err := strconv.ParseUint(kv[1], 10, 64)
+				if err != nil {
+					continue
+				}
+				switch kv[0] {
+				case "keys":
+					ret.Databases[name] = n
+					ret.Keys += n
+				case "expires":
+					ret.Expires += n
+				}
+			}
+		}
+	}
+	if len(ret.Databases) == 0 {
+		ret.Databases = nil
+	}
+	return ret
+}
+
+// estimateData fills in the DataEstimate from the INFO response and DBSIZE.
+func (scan *scan) estimateData(info string) (*DataEstimate, error) {
+	ret := parseDataEstimate(info)
+	resp, err := scan.SendCommand(scan.scanner.commandMappings["DBSIZE"])
+	if err != nil {
+		return ret, err
+	}
+	if n, ok := resp.(Integer); ok && n >= 0 {
+		size := uint64(n)
+		ret.DBSize = &size
+	}
+	return ret, nil
+}
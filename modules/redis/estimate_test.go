@@ -0,0 +1,24 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDataEstimate(t *testing.T) {
+	info := "# Memory\r\nused_memory:5368709120\r\nused_memory_dataset:4294967296\r\n\r\n" +
+		"# Keyspace\r\ndb0:keys=10,expires=2,avg_ttl=100\r\ndb3:keys=5,expires=0,avg_ttl=0\r\n"
+	expected := &DataEstimate{
+		Keys:              15,
+		Expires:           2,
+		Databases:         map[string]uint64{"db0": 10, "db3": 5},
+		UsedMemory:        5368709120,
+		UsedMemoryDataset: 4294967296,
+	}
+	if actual := parseDataEstimate(info); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got %+v, expected %+v", actual, expected)
+	}
+	if actual := parseDataEstimate("# Keyspace\r\n"); actual.Keys != 0 || actual.Databases != nil {
+		t.Errorf("empty keyspace: got %+v", actual)
+	}
+}
@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// HelloResult is the server's answer to HELLO 3, which switches the
+// connection to RESP3 (Redis 6 and later).
+type HelloResult struct {
+	// Error is the error response of servers that do not support HELLO or
+	// RESP3, which keep using RESP2.
+	Error string `json:"error,omitempty"`
+
+	Server   string   `json:"server,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Protocol int64    `json:"proto,omitempty"`
+	ID       int64    `json:"id,omitempty"`
+	Mode     string   `json:"mode,omitempty"`
+	Role     string   `json:"role,omitempty"`
+	Modules  []string `json:"modules,omitempty"`
+}
+
+// WriteCheck is the result of storing and deleting a new key.
+type WriteCheck struct {
+	// Key is the random key that was set.
+	Key string `json:"key"`
+
+	// SetResponse is the response to SET.
+	SetResponse string `json:"set_response"`
+
+	// DelResponse is the response to DEL, only sent if SET succeeded.
+	DelResponse string `json:"del_response,omitempty"`
+
+	// Writable is true if the server stored the key: without
+	// authentication, unless --password is set.
+	Writable bool `json:"writable"`
+}
+
+// hello sends HELLO 3 and parses the server's properties.
+func (scan *scan) hello() (*HelloResult, error) {
+	resp, err := scan.SendCommand(scan.scanner.commandMappings["HELLO"], "3")
+	if err != nil {
+		return nil, err
+	}
+	ret := new(HelloResult)
+	properties, ok := resp.(RedisMap)
+	if !ok {
+		ret.Error = forceToString(resp)
+		return ret, nil
+	}
+	for _, entry := range properties {
+		key, _ := textOf(entry.Key)
+		switch value := entry.Value.(type) {
+		case Integer:
+			switch key {
+			case "proto":
+				ret.Protocol = int64(value)
+			case "id":
+				ret.ID = int64(value)
+			}
+		case RedisArray:
+			if key != "modules" {
+				continue
+			}
+			for _, module := range value {
+				if m, ok := module.(RedisMap); ok {
+					if name, ok := textOf(m.Get("name")); ok {
+						ret.Modules = append(ret.Modules, name)
+					}
+				}
+			}
+		default:
+			text, _ := textOf(value)
+			switch key {
+			case "server":
+				ret.Server = text
+			case "version":
+				ret.Version = text
+			case "mode":
+				ret.Mode = text
+			case "role":
+				ret.Role = text
+			}
+		}
+	}
+	return ret, nil
+}
+
+// getInfoSections sends INFO for each of the sections, and returns the
+// responses by section.
+func (scan *scan) getInfoSections(sections []string) (map[string]string, error) {
+	ret := make(map[string]string, len(sections))
+	for _, section := range sections {
+		resp, err := scan.SendCommand(scan.scanner.commandMappings["INFO"], section)
+		if err != nil {
+			return ret, err
+		}
+		ret[section] = forceToString(resp)
+		if text, ok := textOf(resp); ok {
+			parseInfo(scan.result, text)
+		}
+	}
+	return ret, nil
+}
+
+// getConfigDir returns the working directory of the server, where it writes
+// its snapshots, from CONFIG GET dir; or the error response.
+func (scan *scan) getConfigDir() (string, error) {
+	resp, err := scan.SendCommand(scan.scanner.commandMappings["CONFIG"], "GET", "dir")
+	if err != nil {
+		return "", err
+	}
+	switch v := resp.(type) {
+	case RedisArray:
+		// RESP2: a flat array of names and values
+		if len(v) == 2 {
+			dir, _ := textOf(v[1])
+			return dir, nil
+		}
+		return "", nil
+	case RedisMap:
+		dir, _ := textOf(v.Get("dir"))
+		return dir, nil
+	}
+	return forceToString(resp), nil
+}
+
+// checkWrite sets a new random key that expires after a minute, and deletes
+// it again if that succeeded. Existing keys are never overwritten (NX).
+func (scan *scan) checkWrite() (*WriteCheck, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	ret := &WriteCheck{Key: "zgrab2-write-check-" + hex.EncodeToString(random)}
+	resp, err := scan.SendCommand(scan.scanner.commandMappings["SET"], ret.Key, "1", "EX", "60", "NX")
+	if err != nil {
+		return ret, err
+	}
+	ret.SetResponse = forceToString(resp)
+	if text, ok := resp.(SimpleString); !ok || !strings.EqualFold(string(text), "OK") {
+		return ret, nil
+	}
+	ret.Writable = true
+	resp, err = scan.SendCommand(scan.scanner.commandMappings["DEL"], ret.Key)
+	if err != nil {
+		return ret, err
+	}
+	ret.DelResponse = forceToString(resp)
+	return ret, nil
+}
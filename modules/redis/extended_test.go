@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// serveRedis accepts one connection of an unauthenticated Redis 7 server
+// in cluster mode, answering in RESP3 after HELLO 3.
+func serveRedis(t *testing.T) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		netConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer netConn.Close()
+		conn := &Connection{conn: netConn}
+		for {
+			request, err := conn.ReadRedisValue()
+			if err != nil {
+				return
+			}
+			var args []string
+			for _, arg := range request.(RedisArray) {
+				args = append(args, string(arg.(BulkString)))
+			}
+			var reply RedisValue
+			switch strings.Join(args, " ") {
+			case "PING":
+				reply = SimpleString("PONG")
+			case "HELLO 3":
+				reply = RedisMap{
+					{BulkString("server"), BulkString("redis")},
+					{BulkString("version"), BulkString("7.2.4")},
+					{BulkString("proto"), Integer(3)},
+					{BulkString("id"), Integer(7)},
+					{BulkString("mode"), BulkString("cluster")},
+					{BulkString("role"), BulkString("master")},
+					{BulkString("modules"), RedisArray{RedisMap{{BulkString("name"), BulkString("search")}}}},
+				}
+			case "INFO":
+				reply = VerbatimString("txt:# Server\r\nredis_version:7.2.4\r\nredis_mode:cluster\r\n\r\n# Replication\r\nrole:master\r\nconnected_slaves:2\r\n")
+			case "INFO cluster":
+				reply = VerbatimString("txt:# Cluster\r\ncluster_enabled:1\r\n")
+			case "CONFIG GET dir":
+				reply = RedisMap{{BulkString("dir"), BulkString("/data")}}
+			case "QUIT":
+				conn.WriteRedisValue(SimpleString("OK"))
+				return
+			default:
+				if args[0] == "SET" && len(args) == 6 && strings.HasPrefix(args[1], "zgrab2-write-check-") && args[5] == "NX" {
+					reply = SimpleString("OK")
+				} else if args[0] == "DEL" {
+					reply = Integer(1)
+				} else {
+					reply = ErrorMessage("ERR unknown command '" + args[0] + "'")
+				}
+			}
+			if err := conn.WriteRedisValue(reply); err != nil {
+				return
+			}
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestExtendedScan(t *testing.T) {
+	var scanner Scanner
+	flags := &Flags{
+		BaseFlags:    zgrab2.BaseFlags{Port: serveRedis(t), Timeout: 5 * time.Second},
+		InfoSections: "cluster",
+		ConfigDir:    true,
+		WriteCheck:   true,
+		RESP3:        true,
+	}
+	scanner.Init(flags)
+	status, ret, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("scan failed: %s %v", status, err)
+	}
+	result := *ret.(**Result)
+	expectedHello := &HelloResult{Server: "redis", Version: "7.2.4", Protocol: 3, ID: 7, Mode: "cluster", Role: "master", Modules: []string{"search"}}
+	if !reflect.DeepEqual(result.Hello, expectedHello) {
+		t.Errorf("unexpected hello %+v", result.Hello)
+	}
+	if result.Version != "7.2.4" || result.Role != "master" || result.ConnectedSlaves != 2 || !result.ClusterEnabled {
+		t.Errorf("unexpected info %+v", result)
+	}
+	if result.ConfigDir != "/data" || result.InfoSections["cluster"] != "# Cluster\r\ncluster_enabled:1\r\n" {
+		t.Errorf("unexpected config dir %q or sections %q", result.ConfigDir, result.InfoSections)
+	}
+	if check := result.WriteCheck; check == nil || !check.Writable || check.SetResponse != "OK" || check.DelResponse != "1" {
+		t.Errorf("unexpected write check %+v", check)
+	}
+	if result.QuitResponse != "OK" {
+		t.Errorf("unexpected quit response %q", result.QuitResponse)
+	}
+}
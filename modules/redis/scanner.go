@@ -37,6 +37,11 @@ type Flags struct {
 	Password         string `long:"password" description:"Set a password to use to authenticate to the server. WARNING: This is sent in the clear."`
 	DoInline         bool   `long:"inline" description:"Send commands using the inline syntax"`
 	Verbose          bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	EstimateData     bool   `long:"estimate-data" description:"If INFO succeeds (no authentication required), estimate the amount of stored data from key counts (INFO keyspace, DBSIZE) and memory usage. No keys or values are read."`
+	InfoSections     string `long:"info-sections" description:"Comma-separated list of INFO sections to request separately, e.g. replication,cluster,persistence"`
+	ConfigDir        bool   `long:"config-dir" description:"Send CONFIG GET dir to read the server's working directory"`
+	WriteCheck       bool   `long:"write-check" description:"Check whether the server accepts writes by setting a new random key (expiring after 60s, never overwriting) and deleting it. WARNING: This modifies the target's data."`
+	RESP3            bool   `long:"resp3" description:"Send HELLO 3 to switch to the RESP3 protocol and record the server properties"`
 }
 
 // Module implements the zgrab2.Module interface
@@ -142,10 +147,44 @@ type Result struct {
 	// if present. It specifies the total number of commands processed by the server.
 	CommandsProcessed uint32 `json:"total_commands_processed,omitempty"`
 
+	// Role is read from the InfoResponse (the field "role"), if present:
+	// master or slave.
+	Role string `json:"role,omitempty"`
+
+	// MasterHost is read from the InfoResponse (the field "master_host") of
+	// a replica, if present.
+	MasterHost string `json:"master_host,omitempty"`
+
+	// ConnectedSlaves is read from the InfoResponse (the field
+	// "connected_slaves"), if present.
+	ConnectedSlaves uint32 `json:"connected_slaves,omitempty"`
+
+	// ClusterEnabled is read from the InfoResponse (the field
+	// "cluster_enabled"), if present.
+	ClusterEnabled bool `json:"cluster_enabled,omitempty"`
+
+	// Hello is the response to HELLO 3; only included if --resp3 is set.
+	Hello *HelloResult `json:"hello,omitempty"`
+
+	// InfoSections maps each section of --info-sections to the response to
+	// INFO <section>.
+	InfoSections map[string]string `json:"info_sections,omitempty"`
+
+	// ConfigDir is the server's working directory, from CONFIG GET dir, or
+	// the error response; only included if --config-dir is set.
+	ConfigDir string `json:"config_dir,omitempty"`
+
+	// WriteCheck is only included if --write-check is set.
+	WriteCheck *WriteCheck `json:"write_check,omitempty"`
+
 	// NonexistentResponse is the response to the non-existent command; even if
 	// auth is required, this may give a different error than existing commands.
 	NonexistentResponse string `json:"nonexistent_response,omitempty"`
 
+	// DataEstimate is only included if --estimate-data is set and INFO
+	// succeeded.
+	DataEstimate *DataEstimate `json:"data_estimate,omitempty"`
+
 	// CustomResponses is an array that holds the commands, arguments, and
 	// responses from user-inputted commands.
 	CustomResponses []CustomResponse `json:"custom_responses,omitempty"`
@@ -175,6 +214,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Result)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for Redis"
@@ -267,6 +311,11 @@ func (scanner *Scanner) initCommands() error {
 		"AUTH":        "AUTH",
 		"INFO":        "INFO",
 		"NONEXISTENT": "NONEXISTENT",
+		"DBSIZE":      "DBSIZE",
+		"HELLO":       "HELLO",
+		"CONFIG":      "CONFIG",
+		"SET":         "SET",
+		"DEL":         "DEL",
 		"QUIT":        "QUIT",
 	}
 
@@ -342,8 +391,18 @@ func forceToString(val RedisValue) string {
 		return fmt.Sprintf("(Error: %s)", string(v))
 	case NullType:
 		return "<null>"
-	case RedisArray:
+	case VerbatimString:
+		return v.Text()
+	case Boolean:
+		return fmt.Sprintf("%t", bool(v))
+	case Double:
+		return string(v)
+	case BigNumber:
+		return string(v)
+	case RedisArray, RedisSet, RedisPush:
 		return "(Unexpected array)"
+	case RedisMap:
+		return "(Unexpected map)"
 	default:
 		panic("unreachable")
 	}
@@ -363,10 +422,74 @@ func convToUint32(s string) uint32 {
 	return uint32(s64)
 }
 
+// parseInfo reads the version and server properties from an INFO response.
+func parseInfo(result *Result, info string) {
+	for _, line := range strings.Split(info, "\r\n") {
+		linePrefixSuffix := strings.SplitN(line, ":", 2)
+		prefix := linePrefixSuffix[0]
+		var suffix string
+		if len(linePrefixSuffix) > 1 {
+			suffix = linePrefixSuffix[1]
+		}
+		switch prefix {
+		case "redis_version":
+			result.Version = suffix
+			versionSegments := strings.SplitN(suffix, ".", 3)
+			if len(versionSegments) > 0 {
+				major := convToUint32(versionSegments[0])
+				result.Major = &major
+			}
+			if len(versionSegments) > 1 {
+				minor := convToUint32(versionSegments[1])
+				result.Minor = &minor
+			}
+			if len(versionSegments) > 2 {
+				patchlevel := convToUint32(versionSegments[2])
+				result.Patchlevel = &patchlevel
+			}
+		case "os":
+			result.OS = suffix
+		case "arch_bits":
+			result.ArchBits = suffix
+		case "redis_mode":
+			result.Mode = suffix
+		case "redis_git_sha1":
+			result.GitSha1 = suffix
+		case "redis_build_id":
+			result.BuildID = suffix
+		case "gcc_version":
+			result.GCCVersion = suffix
+		case "mem_allocator":
+			result.MemAllocator = suffix
+		case "uptime_in_seconds":
+			result.Uptime = convToUint32(suffix)
+		case "used_memory":
+			result.UsedMemory = convToUint32(suffix)
+		case "total_connections_received":
+			result.ConnectionsReceived = convToUint32(suffix)
+		case "total_commands_processed":
+			result.CommandsProcessed = convToUint32(suffix)
+		case "role":
+			result.Role = suffix
+		case "master_host":
+			result.MasterHost = suffix
+		case "connected_slaves":
+			result.ConnectedSlaves = convToUint32(suffix)
+		case "cluster_enabled":
+			result.ClusterEnabled = suffix == "1"
+		}
+	}
+}
+
 // Scan executes the following commands:
 // 1. PING
 // 2. (only if --password is provided) AUTH <password>
+// 2a. (only if --resp3 is provided) HELLO 3
 // 3. INFO
+// 3a. (only if --estimate-data is provided and INFO succeeded) DBSIZE
+// 3b. (only if --info-sections is provided) INFO <section> for each section
+// 3c. (only if --config-dir is provided) CONFIG GET dir
+// 3d. (only if --write-check is provided) SET <random key> 1 EX 60 NX, then DEL
 // 4. NONEXISTENT
 // 5. (only if --custom-commands is provided) CustomCommands <args>
 // 6. QUIT
@@ -396,60 +519,44 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		}
 		result.AuthResponse = forceToString(authResponse)
 	}
+	if scanner.config.RESP3 {
+		result.Hello, err = scan.hello()
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+	}
 	infoResponse, err := scan.SendCommand(scanner.commandMappings["INFO"])
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), result, err
 	}
 	result.InfoResponse = forceToString(infoResponse)
-	if infoResponseBulk, ok := infoResponse.(BulkString); ok {
-		for _, line := range strings.Split(string(infoResponseBulk), "\r\n") {
-			linePrefixSuffix := strings.SplitN(line, ":", 2)
-			prefix := linePrefixSuffix[0]
-			var suffix string
-			if len(linePrefixSuffix) > 1 {
-				suffix = linePrefixSuffix[1]
-			}
-			switch prefix {
-			case "redis_version":
-				result.Version = suffix
-				versionSegments := strings.SplitN(suffix, ".", 3)
-				if len(versionSegments) > 0 {
-					major := convToUint32(versionSegments[0])
-					result.Major = &major
-				}
-				if len(versionSegments) > 1 {
-					minor := convToUint32(versionSegments[1])
-					result.Minor = &minor
-				}
-				if len(versionSegments) > 2 {
-					patchlevel := convToUint32(versionSegments[2])
-					result.Patchlevel = &patchlevel
-				}
-			case "os":
-				result.OS = suffix
-			case "arch_bits":
-				result.ArchBits = suffix
-			case "redis_mode":
-				result.Mode = suffix
-			case "redis_git_sha1":
-				result.GitSha1 = suffix
-			case "redis_build_id":
-				result.BuildID = suffix
-			case "gcc_version":
-				result.GCCVersion = suffix
-			case "mem_allocator":
-				result.MemAllocator = suffix
-			case "uptime_in_seconds":
-				result.Uptime = convToUint32(suffix)
-			case "used_memory":
-				result.UsedMemory = convToUint32(suffix)
-			case "total_connections_received":
-				result.ConnectionsReceived = convToUint32(suffix)
-			case "total_commands_processed":
-				result.CommandsProcessed = convToUint32(suffix)
+	if info, ok := textOf(infoResponse); ok {
+		parseInfo(result, info)
+		if scanner.config.EstimateData {
+			result.DataEstimate, err = scan.estimateData(info)
+			if err != nil {
+				return zgrab2.TryGetScanStatus(err), result, err
 			}
 		}
 	}
+	if scanner.config.InfoSections != "" {
+		result.InfoSections, err = scan.getInfoSections(strings.Split(scanner.config.InfoSections, ","))
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+	}
+	if scanner.config.ConfigDir {
+		result.ConfigDir, err = scan.getConfigDir()
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+	}
+	if scanner.config.WriteCheck {
+		result.WriteCheck, err = scan.checkWrite()
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+	}
 	bogusResponse, err := scan.SendCommand(scanner.commandMappings["NONEXISTENT"])
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), result, err
@@ -43,6 +43,27 @@ const (
 
 	// TypeArray identifies Array ([]RedisValue) types
 	TypeArray = "array"
+
+	// TypeMap identifies RESP3 Map (key/value pairs) values
+	TypeMap = "map"
+
+	// TypeSet identifies RESP3 Set ([]RedisValue) values
+	TypeSet = "set"
+
+	// TypePush identifies RESP3 Push ([]RedisValue) values
+	TypePush = "push"
+
+	// TypeBoolean identifies RESP3 Boolean (bool) values
+	TypeBoolean = "boolean"
+
+	// TypeDouble identifies RESP3 Double (string) values
+	TypeDouble = "double"
+
+	// TypeBigNumber identifies RESP3 Big Number (string) values
+	TypeBigNumber = "big number"
+
+	// TypeVerbatimString identifies RESP3 Verbatim String ([]byte) values
+	TypeVerbatimString = "verbatim string"
 )
 
 // RedisValue is implemented by any redis that can be returned by the server
@@ -179,6 +200,167 @@ func (array RedisArray) Encode() []byte {
 	return ret
 }
 
+// RedisMap type -- a RESP3 map, as a list of key/value pairs in the order
+// they were sent.
+// See https://github.com/redis/redis-specifications/blob/master/protocol/RESP3.md
+type RedisMap []RedisMapEntry
+
+// RedisMapEntry is a key/value pair of a RedisMap.
+type RedisMapEntry struct {
+	Key   RedisValue
+	Value RedisValue
+}
+
+// Type identifies this instance as a TypeMap
+func (RedisMap) Type() RedisType {
+	return TypeMap
+}
+
+// Encode returns the encoding of the map, e.g.
+// "%<base10Size>\r\n<key 1><value 1>..."
+func (m RedisMap) Encode() []byte {
+	ret := []byte(fmt.Sprintf("%%%d\r\n", len(m)))
+	for _, entry := range m {
+		ret = append(ret, entry.Key.Encode()...)
+		ret = append(ret, entry.Value.Encode()...)
+	}
+	return ret
+}
+
+// Get returns the value of the entry whose key is the (simple or bulk)
+// string key, or nil.
+func (m RedisMap) Get(key string) RedisValue {
+	for _, entry := range m {
+		if text, ok := textOf(entry.Key); ok && text == key {
+			return entry.Value
+		}
+	}
+	return nil
+}
+
+// RedisSet type -- a RESP3 set of other RedisValues.
+type RedisSet []RedisValue
+
+// Type identifies this instance as a TypeSet
+func (RedisSet) Type() RedisType {
+	return TypeSet
+}
+
+// Encode returns the encoding of the set ("~<base10Size>\r\n<element 1>...")
+func (set RedisSet) Encode() []byte {
+	return encodeAggregate('~', set)
+}
+
+// RedisPush type -- a RESP3 out-of-band message sent by the server.
+type RedisPush []RedisValue
+
+// Type identifies this instance as a TypePush
+func (RedisPush) Type() RedisType {
+	return TypePush
+}
+
+// Encode returns the encoding of the push ("><base10Size>\r\n<element 1>...")
+func (push RedisPush) Encode() []byte {
+	return encodeAggregate('>', push)
+}
+
+// Boolean type -- a RESP3 boolean, "#t" or "#f".
+type Boolean bool
+
+// Type identifies this instance as a TypeBoolean
+func (Boolean) Type() RedisType {
+	return TypeBoolean
+}
+
+// Encode returns the encoding of the boolean ("#t\r\n" or "#f\r\n")
+func (val Boolean) Encode() []byte {
+	if val {
+		return []byte("#t\r\n")
+	}
+	return []byte("#f\r\n")
+}
+
+// Double type -- a RESP3 floating point number, kept as sent (it may be
+// "inf", "-inf" or "nan").
+type Double string
+
+// Type identifies this instance as a TypeDouble
+func (Double) Type() RedisType {
+	return TypeDouble
+}
+
+// Encode returns the encoding of the double (",<value>\r\n")
+func (val Double) Encode() []byte {
+	return []byte("," + val + "\r\n")
+}
+
+// BigNumber type -- a RESP3 integer of arbitrary size, kept as sent.
+type BigNumber string
+
+// Type identifies this instance as a TypeBigNumber
+func (BigNumber) Type() RedisType {
+	return TypeBigNumber
+}
+
+// Encode returns the encoding of the big number ("(<value>\r\n")
+func (val BigNumber) Encode() []byte {
+	return []byte("(" + val + "\r\n")
+}
+
+// VerbatimString type -- a RESP3 bulk string prefixed with a three letter
+// format and a colon, e.g. "txt:Some string".
+type VerbatimString []byte
+
+// Type identifies this instance as a TypeVerbatimString
+func (VerbatimString) Type() RedisType {
+	return TypeVerbatimString
+}
+
+// Encode returns the encoding of this value ("=<base10Length>\r\n<value>\r\n")
+func (str VerbatimString) Encode() []byte {
+	ret := []byte(fmt.Sprintf("=%d\r\n", len(str)))
+	ret = append(ret, str...)
+	return append(ret, '\r', '\n')
+}
+
+// Format returns the format of the string, e.g. "txt" or "mkd".
+func (str VerbatimString) Format() string {
+	if len(str) < 4 || str[3] != ':' {
+		return ""
+	}
+	return string(str[:3])
+}
+
+// Text returns the string without its format.
+func (str VerbatimString) Text() string {
+	if str.Format() == "" {
+		return string(str)
+	}
+	return string(str[4:])
+}
+
+// encodeAggregate encodes elements with the given type identifier.
+func encodeAggregate(identifier byte, elements []RedisValue) []byte {
+	ret := []byte(fmt.Sprintf("%c%d\r\n", identifier, len(elements)))
+	for _, item := range elements {
+		ret = append(ret, item.Encode()...)
+	}
+	return ret
+}
+
+// textOf returns the text of a simple, bulk or verbatim string.
+func textOf(val RedisValue) (string, bool) {
+	switch v := val.(type) {
+	case SimpleString:
+		return string(v), true
+	case BulkString:
+		return string(v), true
+	case VerbatimString:
+		return v.Text(), true
+	}
+	return "", false
+}
+
 // read reads the next n bytes from the connection, using the read buffer if
 // available
 func (conn *Connection) read(n int) ([]byte, error) {
@@ -305,13 +487,32 @@ func (conn *Connection) readErrorMessage() (RedisValue, error) {
 // The array is returned, and the next read will start at the first byte
 // following the terminal LF of the array's terminal element.
 func (conn *Connection) readRedisArray() (RedisValue, error) {
+	elements, err := conn.readElements(1)
+	if err != nil {
+		return nil, err
+	}
+	if elements == nil {
+		return NullValue, nil
+	}
+	return RedisArray(elements), nil
+}
+
+// readElements reads the length of an aggregate type, followed by
+// valuesPerElement values for each element. A null aggregate (length -1)
+// is returned as nil.
+func (conn *Connection) readElements(valuesPerElement int64) ([]RedisValue, error) {
 	numElements, err := conn.readInt()
 	if err != nil {
 		return nil, err
 	}
-	ret := make(RedisArray, numElements)
-	var i int64
-	for i = 0; i < numElements; i++ {
+	if numElements == -1 {
+		return nil, nil
+	}
+	if numElements < 0 || numElements > 1024*1024 {
+		return nil, ErrBadLength
+	}
+	ret := make([]RedisValue, numElements*valuesPerElement)
+	for i := range ret {
 		ret[i], err = conn.ReadRedisValue()
 		if err != nil {
 			return nil, err
@@ -320,6 +521,49 @@ func (conn *Connection) readRedisArray() (RedisValue, error) {
 	return ret, nil
 }
 
+// readRedisMap reads a RedisMap from the connection, assuming that the type
+// identifier ("%") has already been consumed.
+func (conn *Connection) readRedisMap() (RedisValue, error) {
+	elements, err := conn.readElements(2)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(RedisMap, len(elements)/2)
+	for i := range ret {
+		ret[i] = RedisMapEntry{Key: elements[2*i], Value: elements[2*i+1]}
+	}
+	return ret, nil
+}
+
+// readBoolean reads a Boolean from the connection, assuming that the type
+// identifier ("#") has already been consumed.
+func (conn *Connection) readBoolean() (RedisValue, error) {
+	body, err := conn.readUntilCRLF()
+	if err != nil {
+		return nil, err
+	}
+	switch string(body) {
+	case "t":
+		return Boolean(true), nil
+	case "f":
+		return Boolean(false), nil
+	}
+	return nil, ErrInvalidData
+}
+
+// readNull reads a RESP3 null ("_\r\n"), assuming that the type identifier
+// has already been consumed. It is returned as the NullValue.
+func (conn *Connection) readNull() (RedisValue, error) {
+	body, err := conn.readUntilCRLF()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) != 0 {
+		return nil, ErrInvalidData
+	}
+	return NullValue, nil
+}
+
 // redisDataReader is a function that reads a RedisValue from a connection.
 type redisDataReader func(*Connection) (RedisValue, error)
 
@@ -411,6 +655,47 @@ func (conn *Connection) ReadRedisValue() (RedisValue, error) {
 			'-': func(conn *Connection) (RedisValue, error) { return conn.readErrorMessage() },
 			'$': func(conn *Connection) (RedisValue, error) { return conn.readBulkString() },
 			'*': func(conn *Connection) (RedisValue, error) { return conn.readRedisArray() },
+			// RESP3 types, sent after HELLO 3
+			'%': func(conn *Connection) (RedisValue, error) { return conn.readRedisMap() },
+			'~': func(conn *Connection) (RedisValue, error) {
+				elements, err := conn.readElements(1)
+				return RedisSet(elements), err
+			},
+			'>': func(conn *Connection) (RedisValue, error) {
+				elements, err := conn.readElements(1)
+				return RedisPush(elements), err
+			},
+			'|': func(conn *Connection) (RedisValue, error) {
+				// Attributes describe the value that follows; skip them.
+				if _, err := conn.readRedisMap(); err != nil {
+					return nil, err
+				}
+				return conn.ReadRedisValue()
+			},
+			'_': func(conn *Connection) (RedisValue, error) { return conn.readNull() },
+			'#': func(conn *Connection) (RedisValue, error) { return conn.readBoolean() },
+			',': func(conn *Connection) (RedisValue, error) {
+				body, err := conn.readUntilCRLF()
+				return Double(body), err
+			},
+			'(': func(conn *Connection) (RedisValue, error) {
+				body, err := conn.readUntilCRLF()
+				return BigNumber(body), err
+			},
+			'=': func(conn *Connection) (RedisValue, error) {
+				val, err := conn.readBulkString()
+				if str, ok := val.(BulkString); ok {
+					return VerbatimString(str), err
+				}
+				return val, err
+			},
+			'!': func(conn *Connection) (RedisValue, error) {
+				val, err := conn.readBulkString()
+				if str, ok := val.(BulkString); ok {
+					return ErrorMessage(str), err
+				}
+				return val, err
+			},
 		}
 	}
 	v, err := conn.read(1)
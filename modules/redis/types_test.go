@@ -353,3 +353,40 @@ func TestRedisArray(t *testing.T) {
 		writeThenRead(t, conn, io, expectedEncoding, redisValue)
 	}
 }
+
+// resp3Values maps RESP3 encodings to the corresponding value (Note: reverse key/value order from other maps)
+var resp3Values = map[string]RedisValue{
+	"%2\r\n+server\r\n$5\r\nredis\r\n+proto\r\n:3\r\n": RedisMap{
+		{SimpleString("server"), BulkString("redis")},
+		{SimpleString("proto"), Integer(3)},
+	},
+	"~2\r\n+a\r\n:1\r\n":              RedisSet{SimpleString("a"), Integer(1)},
+	">2\r\n+message\r\n$3\r\nfoo\r\n": RedisPush{SimpleString("message"), BulkString("foo")},
+	"#t\r\n":                          Boolean(true),
+	",-1.5\r\n":                       Double("-1.5"),
+	"(3492890328409238509324850943850943825024385\r\n": BigNumber("3492890328409238509324850943850943825024385"),
+	"=15\r\ntxt:Some string\r\n":                       VerbatimString("txt:Some string"),
+}
+
+// TestRESP3 checks that RESP3 values are encoded/decoded as expected, and
+// that nulls, blob errors and attributes are decoded.
+func TestRESP3(t *testing.T) {
+	conn, io := getConnection()
+	for encoding, value := range resp3Values {
+		writeThenRead(t, conn, io, encoding, value)
+	}
+	for encoding, expected := range map[string]RedisValue{
+		"_\r\n":                      NullValue,
+		"*-1\r\n":                    NullValue,
+		"!9\r\nERR error\r\n":        ErrorMessage("ERR error"),
+		"|1\r\n+ttl\r\n:3\r\n:5\r\n": Integer(5),
+	} {
+		io.Provide([]byte(encoding))
+		if err := compareRedisValues(rawRead(t, conn), expected); err != nil {
+			t.Errorf("%q: %v", encoding, err)
+		}
+	}
+	if text := VerbatimString("txt:Some string").Text(); text != "Some string" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
@@ -1,8 +1,11 @@
 package siemens
 
+import "github.com/Positive-Engineer/zgrab2"
+
 // S7Log is the output type for the Siemens S7 scan.
 type S7Log struct {
-	// IsS7 indicates that S7 was actually detected, so it should always be true.
+	// IsS7 indicates that classic S7comm was detected. It is only false if
+	// the PLC was detected through S7comm-plus alone.
 	IsS7 bool `json:"is_s7"`
 
 	// System is the first field returned in the component ID response.
@@ -46,4 +49,49 @@ type S7Log struct {
 
 	// Fiirmware is the third field returned in the module identification response.
 	Firmware string `json:"firmware,omitempty"`
+
+	// ProtectionLevel is the protection level of the CPU (--protection-level).
+	ProtectionLevel *ProtectionLevel `json:"protection_level,omitempty"`
+
+	// S7CommPlus is the result of the S7comm-plus probe (--s7comm-plus).
+	S7CommPlus *S7CommPlusLog `json:"s7comm_plus,omitempty"`
+
+	// ICSDevice summarizes the fields above; the product is the module
+	// type, or the system name if that is missing. For a PLC that only
+	// speaks S7comm-plus, it is the order number.
+	ICSDevice *zgrab2.ICSDevice `json:"ics_device,omitempty"`
+}
+
+// ProtectionLevel is the protection data of the CPU, read from SZL 0x0232
+// index 4.
+type ProtectionLevel struct {
+	// ModeSelectorLevel is the protection level set with the mode selector (1-3).
+	ModeSelectorLevel uint16 `json:"mode_selector_level"`
+
+	// PasswordLevel is the protection level set in the parameters (0-3);
+	// 0 means that no password is set.
+	PasswordLevel uint16 `json:"password_level"`
+
+	// Level is the effective protection level of the CPU.
+	Level uint16 `json:"level"`
+
+	// ModeSelector is the position of the mode selector: RUN, RUN-P, STOP or MRES.
+	ModeSelector string `json:"mode_selector,omitempty"`
+}
+
+func (log *S7Log) icsDevice() *zgrab2.ICSDevice {
+	product := log.ModuleType
+	if product == "" {
+		product = log.System
+	}
+	firmware := log.Firmware
+	if plus := log.S7CommPlus; plus != nil {
+		if product == "" {
+			product = plus.Hardware
+		}
+		if firmware == "" {
+			firmware = plus.Firmware
+		}
+	}
+	return zgrab2.NewICSDevice("siemens", "Siemens", product, firmware, log.SerialNumber)
 }
@@ -171,6 +171,8 @@ const (
 	S7_SZL_READ                     = byte(0x01)
 	S7_SZL_MODULE_IDENTIFICATION    = uint16(0x11)
 	S7_SZL_COMPONENT_IDENTIFICATION = uint16(0x1c)
+	S7_SZL_PROTECTION_LEVEL         = uint16(0x232)
+	S7_SZL_PROTECTION_LEVEL_INDEX   = uint16(0x04)
 	S7_DATA_BYTE_OFFSET             = 12 // offset for real data
 )
 
@@ -12,7 +12,8 @@ import (
 type ReconnectFunction func() (net.Conn, error)
 
 // GetS7Banner scans the target for S7 information, reconnecting if necessary.
-func GetS7Banner(logStruct *S7Log, connection net.Conn, reconnect ReconnectFunction) (err error) {
+// If readProtection is set, it also reads the protection level of the CPU.
+func GetS7Banner(logStruct *S7Log, connection net.Conn, reconnect ReconnectFunction, readProtection bool) (err error) {
 	// Attempt connection
 	var connPacketBytes, connResponseBytes []byte
 	connPacketBytes, err = makeCOTPConnectionPacketBytes(uint16(0x102), uint16(0x100))
@@ -55,19 +56,27 @@ func GetS7Banner(logStruct *S7Log, connection net.Conn, reconnect ReconnectFunct
 	logStruct.IsS7 = true
 
 	// Make Module Identification request
-	moduleIdentificationResponse, err := readRequest(connection, S7_SZL_MODULE_IDENTIFICATION)
+	moduleIdentificationResponse, err := readRequest(connection, S7_SZL_MODULE_IDENTIFICATION, 1)
 	if err != nil {
 		return nil // mask errors after detecting IsS7
 	}
 	parseModuleIdentificatioNRequest(logStruct, &moduleIdentificationResponse)
 
 	// Make Component Identification request
-	componentIdentificationResponse, err := readRequest(connection, S7_SZL_COMPONENT_IDENTIFICATION)
+	componentIdentificationResponse, err := readRequest(connection, S7_SZL_COMPONENT_IDENTIFICATION, 1)
 	if err != nil {
 		return nil // mask errors after detecting IsS7
 	}
 	parseComponentIdentificationResponse(logStruct, &componentIdentificationResponse)
 
+	if readProtection {
+		protectionLevelResponse, err := readRequest(connection, S7_SZL_PROTECTION_LEVEL, S7_SZL_PROTECTION_LEVEL_INDEX)
+		if err != nil {
+			return nil // mask errors after detecting IsS7
+		}
+		parseProtectionLevelResponse(logStruct, &protectionLevelResponse)
+	}
+
 	return nil
 }
 
@@ -174,7 +183,7 @@ func makeReadRequestParamBytes(data []byte) (bytes []byte) {
 	return bytes
 }
 
-func makeReadRequestDataBytes(szlId uint16) []byte {
+func makeReadRequestDataBytes(szlId uint16, szlIndex uint16) []byte {
 	bytes := make([]byte, 0, 4)
 	bytes = append(bytes, byte(0xff))
 	bytes = append(bytes, byte(0x09))
@@ -183,15 +192,15 @@ func makeReadRequestDataBytes(szlId uint16) []byte {
 	bytes = append(bytes, uint16BytesHolder...)
 	binary.BigEndian.PutUint16(uint16BytesHolder, szlId)
 	bytes = append(bytes, uint16BytesHolder...) // szl id
-	binary.BigEndian.PutUint16(uint16BytesHolder, 1)
+	binary.BigEndian.PutUint16(uint16BytesHolder, szlIndex)
 	bytes = append(bytes, uint16BytesHolder...) // szl index
 
 	return bytes
 }
 
-func makeReadRequestBytes(szlId uint16) ([]byte, error) {
-	readRequestParamBytes := makeReadRequestParamBytes(makeReadRequestDataBytes(szlId))
-	readRequestBytes, err := makeRequestPacketBytes(S7_REQUEST_USER_DATA, readRequestParamBytes, makeReadRequestDataBytes(szlId))
+func makeReadRequestBytes(szlId uint16, szlIndex uint16) ([]byte, error) {
+	readRequestParamBytes := makeReadRequestParamBytes(makeReadRequestDataBytes(szlId, szlIndex))
+	readRequestBytes, err := makeRequestPacketBytes(S7_REQUEST_USER_DATA, readRequestParamBytes, makeReadRequestDataBytes(szlId, szlIndex))
 	if err != nil {
 		return nil, err
 	}
@@ -280,8 +289,40 @@ func parseModuleIdentificatioNRequest(logStruct *S7Log, s7Packet *S7Packet) erro
 	return nil
 }
 
-func readRequest(connection net.Conn, slzId uint16) (packet S7Packet, err error) {
-	readRequestBytes, err := makeReadRequestBytes(slzId)
+// modeSelectorPositions names the positions of the mode selector in the
+// protection level SZL.
+var modeSelectorPositions = map[uint16]string{
+	1: "RUN",
+	2: "RUN-P",
+	3: "STOP",
+	4: "MRES",
+}
+
+// parseProtectionLevelResponse parses the record of SZL 0x0232 index 4:
+// index, protection level of the mode selector, password protection level,
+// effective protection level and mode selector position.
+func parseProtectionLevelResponse(logStruct *S7Log, s7Packet *S7Packet) error {
+	if len(s7Packet.Data) < S7_DATA_BYTE_OFFSET+10 {
+		return errS7PacketTooShort
+	}
+	if s7Packet.Data[0] != 0xff {
+		// The return code of the data item is not success.
+		return errInvalidPacket
+	}
+
+	record := s7Packet.Data[S7_DATA_BYTE_OFFSET:]
+	logStruct.ProtectionLevel = &ProtectionLevel{
+		ModeSelectorLevel: binary.BigEndian.Uint16(record[2:4]),
+		PasswordLevel:     binary.BigEndian.Uint16(record[4:6]),
+		Level:             binary.BigEndian.Uint16(record[6:8]),
+		ModeSelector:      modeSelectorPositions[binary.BigEndian.Uint16(record[8:10])],
+	}
+
+	return nil
+}
+
+func readRequest(connection net.Conn, slzId uint16, slzIndex uint16) (packet S7Packet, err error) {
+	readRequestBytes, err := makeReadRequestBytes(slzId, slzIndex)
 	if err != nil {
 		return packet, err
 	}
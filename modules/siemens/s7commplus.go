@@ -0,0 +1,281 @@
+package siemens
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// S7comm-plus is the protocol of the S7-1200 and S7-1500 PLCs. Its frames are
+// carried in COTP data packets like classic S7comm, but start with 0x72.
+const (
+	S7_PLUS_PROTOCOL_ID        = byte(0x72)
+	S7_PLUS_OPCODE_REQUEST     = byte(0x31)
+	S7_PLUS_OPCODE_RESPONSE    = byte(0x32)
+	S7_PLUS_FUNC_CREATE_OBJECT = uint16(0x04ca)
+)
+
+// S7comm-plus item tags and value types.
+const (
+	s7PlusStartOfObject = byte(0xa1)
+	s7PlusTerminator    = byte(0xa2)
+	s7PlusAttribute     = byte(0xa3)
+	s7PlusTypeUDInt     = byte(0x04)
+	s7PlusTypeRID       = byte(0x12)
+	s7PlusTypeWString   = byte(0x15)
+)
+
+// S7comm-plus object and attribute IDs used by the CreateObject request.
+const (
+	s7PlusObjectNullServerSession         = uint32(0x120)
+	s7PlusObjectServerSessionContainer    = uint32(285)
+	s7PlusClassServerSession              = uint32(287)
+	s7PlusClassSubscriptionContainer      = uint32(255)
+	s7PlusAttributeObjectVariableTypeName = uint32(233)
+)
+
+// s7PlusTSAP is the destination TSAP of an HMI connection to an S7-1200/1500.
+var s7PlusTSAP = []byte("SIMATIC-ROOT-HMI")
+
+// s7PlusVersionPattern matches the ServerSessionVersion string returned in the
+// CreateObject response, e.g. "1;6ES7 214-1AG40-0XB0 ;V4.4".
+var s7PlusVersionPattern = regexp.MustCompile(`^\d+;([^;]+);\s*(V[0-9.]+)`)
+
+// S7CommPlusLog is the output of the S7comm-plus probe.
+type S7CommPlusLog struct {
+	// Version is the protocol version of the response header (1, 2 or 3).
+	Version byte `json:"version"`
+
+	// SessionID is the ID of the session object created by the PLC.
+	SessionID uint32 `json:"session_id,omitempty"`
+
+	// SessionVersion is the raw ServerSessionVersion string.
+	SessionVersion string `json:"session_version,omitempty"`
+
+	// Hardware is the order number of the PLC, e.g. "6ES7 214-1AG40-0XB0".
+	Hardware string `json:"hardware,omitempty"`
+
+	// Firmware is the firmware version of the PLC, e.g. "V4.4".
+	Firmware string `json:"firmware,omitempty"`
+}
+
+// appendVLQ appends value as a S7comm-plus variable-length quantity: big
+// endian groups of 7 bits, with the high bit set on all but the last byte.
+func appendVLQ(bytes []byte, value uint32) []byte {
+	var groups []byte
+	for {
+		groups = append([]byte{byte(value & 0x7f)}, groups...)
+		value >>= 7
+		if value == 0 {
+			break
+		}
+	}
+	for i := 0; i < len(groups)-1; i++ {
+		groups[i] |= 0x80
+	}
+	return append(bytes, groups...)
+}
+
+// readVLQ decodes a variable-length quantity from the start of bytes, and
+// returns the value and its length.
+func readVLQ(bytes []byte) (uint32, int, error) {
+	var value uint32
+	for i := 0; i < len(bytes) && i < 5; i++ {
+		value = value<<7 | uint32(bytes[i]&0x7f)
+		if bytes[i]&0x80 == 0 {
+			return value, i + 1, nil
+		}
+	}
+	return 0, 0, errInvalidPacket
+}
+
+// appendWStringAttribute appends an attribute with a WString value.
+func appendWStringAttribute(bytes []byte, id uint32, value string) []byte {
+	bytes = appendVLQ(append(bytes, s7PlusAttribute), id)
+	bytes = append(bytes, 0x00, s7PlusTypeWString)
+	bytes = appendVLQ(bytes, uint32(len(value)))
+	return append(bytes, value...)
+}
+
+// appendObjectStart appends the start of an object of the given class.
+func appendObjectStart(bytes []byte, relationID uint32, classID uint32) []byte {
+	uint32BytesHolder := make([]byte, 4)
+	binary.BigEndian.PutUint32(uint32BytesHolder, relationID)
+	bytes = append(append(bytes, s7PlusStartOfObject), uint32BytesHolder...)
+	bytes = appendVLQ(bytes, classID)
+	return append(bytes, 0x00, 0x00) // class flags, attribute ID
+}
+
+// makeS7PlusCreateObjectBytes returns the CreateObject request that opens a
+// session, as sent by an HMI. The PLC answers without authentication.
+func makeS7PlusCreateObjectBytes() ([]byte, error) {
+	uint16BytesHolder := make([]byte, 2)
+	uint32BytesHolder := make([]byte, 4)
+
+	data := []byte{S7_PLUS_OPCODE_REQUEST, 0x00, 0x00}
+	binary.BigEndian.PutUint16(uint16BytesHolder, S7_PLUS_FUNC_CREATE_OBJECT)
+	data = append(data, uint16BytesHolder...)
+	data = append(data, 0x00, 0x00) // reserved
+	binary.BigEndian.PutUint16(uint16BytesHolder, 1)
+	data = append(data, uint16BytesHolder...) // sequence number
+	binary.BigEndian.PutUint32(uint32BytesHolder, s7PlusObjectNullServerSession)
+	data = append(data, uint32BytesHolder...) // session ID
+	data = append(data, 0x36)                 // transport flags
+
+	binary.BigEndian.PutUint32(uint32BytesHolder, s7PlusObjectServerSessionContainer)
+	data = append(data, uint32BytesHolder...) // request ID
+	data = append(data, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00)
+
+	data = appendObjectStart(data, 0xd3, s7PlusClassServerSession)
+	data = appendWStringAttribute(data, s7PlusAttributeObjectVariableTypeName, "ServerSession_ZGRAB")
+	data = appendWStringAttribute(data, 289, "1:::6.0:::TCP/IP")
+	data = appendWStringAttribute(data, 296, "")
+	data = appendWStringAttribute(data, 297, "")
+	data = appendWStringAttribute(data, 298, "zgrab")
+	data = appendVLQ(append(data, s7PlusAttribute), 299)
+	data = append(data, 0x00, s7PlusTypeUDInt, 0x01)
+	data = appendVLQ(append(data, s7PlusAttribute), 300)
+	data = append(data, 0x00, s7PlusTypeRID, 0x01, 0xc9, 0xc3, 0x82)
+	data = appendWStringAttribute(data, 301, "")
+	data = appendObjectStart(data, 0xd3, s7PlusClassSubscriptionContainer)
+	data = appendWStringAttribute(data, s7PlusAttributeObjectVariableTypeName, "SubscriptionContainer")
+	data = append(data, s7PlusTerminator, s7PlusTerminator)
+	data = append(data, 0x00, 0x00, 0x00, 0x00)
+
+	bytes := make([]byte, 0, 4+len(data)+4)
+	bytes = append(bytes, S7_PLUS_PROTOCOL_ID, 0x01) // protocol ID, version
+	binary.BigEndian.PutUint16(uint16BytesHolder, uint16(len(data)))
+	bytes = append(bytes, uint16BytesHolder...)
+	bytes = append(bytes, data...)
+	bytes = append(bytes, S7_PLUS_PROTOCOL_ID, 0x01, 0x00, 0x00) // trailer
+
+	var cotpDataPacket COTPDataPacket
+	cotpDataPacket.Data = bytes
+	cotpDataPacketBytes, err := cotpDataPacket.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var tpktPacket TPKTPacket
+	tpktPacket.Data = cotpDataPacketBytes
+	return tpktPacket.Marshal()
+}
+
+// makeS7PlusConnectionPacketBytes returns a COTP connection request for the
+// SIMATIC-ROOT-HMI TSAP.
+func makeS7PlusConnectionPacketBytes() ([]byte, error) {
+	bytes := []byte{
+		0x00,       // length, set below
+		0xe0,       // connection request code
+		0x00, 0x00, // destination reference
+		0x00, 0x01, // source reference
+		0x00,                   // class 0
+		0xc1, 0x02, 0x06, 0x00, // calling TSAP
+		0xc2, byte(len(s7PlusTSAP)),
+	}
+	bytes = append(bytes, s7PlusTSAP...)
+	bytes = append(bytes, 0xc0, 0x01, 0x0a) // proposed maximum TPDU size
+	bytes[0] = byte(len(bytes) - 1)
+
+	var tpktPacket TPKTPacket
+	tpktPacket.Data = bytes
+	return tpktPacket.Marshal()
+}
+
+// wStrings returns the WString values of the attributes in the payload of a
+// S7comm-plus response, without decoding the objects.
+func wStrings(payload []byte) []string {
+	var ret []string
+	for i := 0; i+2 < len(payload); i++ {
+		if payload[i] != 0x00 || payload[i+1] != s7PlusTypeWString {
+			continue
+		}
+		length, n, err := readVLQ(payload[i+2:])
+		if err != nil || length == 0 || i+2+n+int(length) > len(payload) {
+			continue
+		}
+		value := string(payload[i+2+n : i+2+n+int(length)])
+		if strings.IndexFunc(value, func(c rune) bool { return c < 0x20 || c > 0x7e }) >= 0 {
+			continue
+		}
+		ret = append(ret, value)
+		i += 1 + n + int(length)
+	}
+	return ret
+}
+
+// parseS7PlusCreateObjectResponse parses the header of the CreateObject
+// response and the ServerSessionVersion string into logStruct.
+func parseS7PlusCreateObjectResponse(logStruct *S7CommPlusLog, bytes []byte) error {
+	if len(bytes) < 14 {
+		return errS7PacketTooShort
+	}
+	if bytes[0] != S7_PLUS_PROTOCOL_ID {
+		return errNotS7
+	}
+	logStruct.Version = bytes[1]
+	if bytes[4] != S7_PLUS_OPCODE_RESPONSE || binary.BigEndian.Uint16(bytes[7:9]) != S7_PLUS_FUNC_CREATE_OBJECT {
+		return errors.New("not a CreateObject response")
+	}
+	// The sequence number and transport flags are followed by the return
+	// value, and the IDs of the created objects, the session first.
+	payload := bytes[14:]
+	if _, n, err := readVLQ(payload); err == nil && n < len(payload) && payload[n] > 0 {
+		if sessionID, _, err := readVLQ(payload[n+1:]); err == nil {
+			logStruct.SessionID = sessionID
+		}
+	}
+	for _, value := range wStrings(payload) {
+		if match := s7PlusVersionPattern.FindStringSubmatch(value); match != nil {
+			logStruct.SessionVersion = value
+			logStruct.Hardware = strings.TrimSpace(match[1])
+			logStruct.Firmware = match[2]
+			break
+		}
+	}
+	return nil
+}
+
+// GetS7CommPlusBanner connects to the SIMATIC-ROOT-HMI TSAP, sends a
+// CreateObject request and parses the response. It returns nil if the target
+// does not speak S7comm-plus.
+func GetS7CommPlusBanner(connection net.Conn) (*S7CommPlusLog, error) {
+	connPacketBytes, err := makeS7PlusConnectionPacketBytes()
+	if err != nil {
+		return nil, err
+	}
+	connResponseBytes, err := sendRequestReadResponse(connection, connPacketBytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := unmarshalCOTPConnectionResponse(connResponseBytes); err != nil {
+		return nil, err
+	}
+
+	requestBytes, err := makeS7PlusCreateObjectBytes()
+	if err != nil {
+		return nil, err
+	}
+	responseBytes, err := sendRequestReadResponse(connection, requestBytes)
+	if err != nil {
+		return nil, err
+	}
+	var tpktPacket TPKTPacket
+	var cotpDataPacket COTPDataPacket
+	if err := tpktPacket.Unmarshal(responseBytes); err != nil {
+		return nil, err
+	}
+	if err := cotpDataPacket.Unmarshal(tpktPacket.Data); err != nil {
+		return nil, err
+	}
+	logStruct := new(S7CommPlusLog)
+	err = parseS7PlusCreateObjectResponse(logStruct, cotpDataPacket.Data)
+	if err == errNotS7 || err == errS7PacketTooShort {
+		return nil, err
+	}
+	// Other errors mean that the PLC speaks S7comm-plus, but did not answer
+	// the request with a session.
+	return logStruct, nil
+}
@@ -0,0 +1,122 @@
+package siemens
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestVLQ(t *testing.T) {
+	for _, value := range []uint32{0, 0x7f, 233, 306, 0x4000, 0xffffffff} {
+		encoded := appendVLQ(nil, value)
+		decoded, n, err := readVLQ(encoded)
+		if err != nil || decoded != value || n != len(encoded) {
+			t.Errorf("%d: encoded % x, decoded %d (%d bytes), %v", value, encoded, decoded, n, err)
+		}
+	}
+	if encoded := appendVLQ(nil, 289); !bytes.Equal(encoded, []byte{0x82, 0x21}) {
+		t.Errorf("unexpected encoding % x", encoded)
+	}
+}
+
+func TestCreateObjectRequest(t *testing.T) {
+	request, err := makeS7PlusCreateObjectBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(binary.BigEndian.Uint16(request[2:4])) != len(request) {
+		t.Errorf("TPKT length %d, request length %d", binary.BigEndian.Uint16(request[2:4]), len(request))
+	}
+	frame := request[7:]
+	if frame[0] != S7_PLUS_PROTOCOL_ID || int(binary.BigEndian.Uint16(frame[2:4])) != len(frame)-8 {
+		t.Errorf("unexpected frame header % x", frame[:4])
+	}
+	if !bytes.HasSuffix(frame, []byte{S7_PLUS_PROTOCOL_ID, 0x01, 0x00, 0x00}) {
+		t.Errorf("missing trailer")
+	}
+}
+
+// createObjectResponse returns a CreateObject response for the session
+// 0x3a8, with the ServerSessionVersion attribute.
+func createObjectResponse() []byte {
+	data := []byte{S7_PLUS_OPCODE_RESPONSE, 0, 0, 0x04, 0xca, 0, 0, 0, 1, 0}
+	data = append(data, 0x00, 0x02)    // return value, object ID count
+	data = appendVLQ(data, 0x3a8)      // session ID
+	data = appendVLQ(data, 0x70000200) // second object ID
+	data = appendObjectStart(data, 0x3a8, s7PlusClassServerSession)
+	data = appendWStringAttribute(data, s7PlusAttributeObjectVariableTypeName, "ServerSession_1")
+	data = appendVLQ(append(data, s7PlusAttribute), 306)
+	data = append(data, 0x00, 0x17, 0x00, 0x00, 0x01, 0x3a) // struct
+	data = appendVLQ(data, 319)
+	data = append(data, 0x00, s7PlusTypeWString)
+	version := "1;6ES7 214-1AG40-0XB0 ;V4.4"
+	data = appendVLQ(data, uint32(len(version)))
+	data = append(data, version...)
+	data = append(data, 0x00, s7PlusTerminator, 0, 0, 0, 0)
+	frame := []byte{S7_PLUS_PROTOCOL_ID, 0x01, byte(len(data) >> 8), byte(len(data))}
+	return append(append(frame, data...), S7_PLUS_PROTOCOL_ID, 0x01, 0, 0)
+}
+
+func TestParseCreateObjectResponse(t *testing.T) {
+	var log S7CommPlusLog
+	if err := parseS7PlusCreateObjectResponse(&log, createObjectResponse()); err != nil {
+		t.Fatal(err)
+	}
+	expected := S7CommPlusLog{
+		Version:        1,
+		SessionID:      0x3a8,
+		SessionVersion: "1;6ES7 214-1AG40-0XB0 ;V4.4",
+		Hardware:       "6ES7 214-1AG40-0XB0",
+		Firmware:       "V4.4",
+	}
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("got %+v, expected %+v", log, expected)
+	}
+}
+
+func TestGetS7CommPlusBanner(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		// Connection confirmation, then the CreateObject response.
+		if _, err := server.Read(buf); err != nil || !bytes.Contains(buf, s7PlusTSAP) {
+			return
+		}
+		server.Write([]byte{0x03, 0x00, 0x00, 0x07, 0x02, 0xd0, 0x00})
+		if _, err := server.Read(buf); err != nil {
+			return
+		}
+		packet, _ := (&COTPDataPacket{Data: createObjectResponse()}).Marshal()
+		response, _ := (&TPKTPacket{Data: packet}).Marshal()
+		server.Write(response)
+	}()
+	// The timeout connection resets the read deadline left by ReadAvailable.
+	log, err := GetS7CommPlusBanner(zgrab2.NewTimeoutConnection(context.Background(), client, time.Second, 0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log == nil || log.Hardware != "6ES7 214-1AG40-0XB0" || log.Firmware != "V4.4" {
+		t.Errorf("unexpected result %+v", log)
+	}
+}
+
+func TestParseProtectionLevelResponse(t *testing.T) {
+	data := []byte{0xff, 0x09, 0x00, 0x14, 0x02, 0x32, 0x00, 0x04, 0x00, 0x14, 0x00, 0x01}
+	data = append(data, 0x00, 0x04, 0x00, 0x01, 0x00, 0x03, 0x00, 0x03, 0x00, 0x02, 0x00, 0x00)
+	var log S7Log
+	if err := parseProtectionLevelResponse(&log, &S7Packet{Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	expected := ProtectionLevel{ModeSelectorLevel: 1, PasswordLevel: 3, Level: 3, ModeSelector: "RUN-P"}
+	if log.ProtectionLevel == nil || *log.ProtectionLevel != expected {
+		t.Errorf("got %+v, expected %+v", log.ProtectionLevel, expected)
+	}
+}
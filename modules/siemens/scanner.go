@@ -1,6 +1,14 @@
 // Package siemens provides a zgrab2 module that scans for Siemens S7.
 // Default port: TCP 102
 // Ported from the original zgrab. Input and output are identical.
+//
+// The --protection-level flag also reads the protection level of the CPU
+// (SZL 0x0232).
+//
+// The --s7comm-plus flag also probes for S7comm-plus, the protocol of the
+// S7-1200 and S7-1500 PLCs, on a separate connection to the SIMATIC-ROOT-HMI
+// TSAP, and reports the hardware order number and firmware version of the
+// session version string.
 package siemens
 
 import (
@@ -15,7 +23,9 @@ import (
 type Flags struct {
 	zgrab2.BaseFlags
 	// TODO: configurable TSAP source / destination, etc
-	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	Verbose         bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	ProtectionLevel bool `long:"protection-level" description:"Read the protection level of the CPU"`
+	S7CommPlus      bool `long:"s7comm-plus" description:"Also probe for S7comm-plus (S7-1200/1500)"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -46,6 +56,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(S7Log)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for Siemens S7 devices"
@@ -97,7 +112,9 @@ func (scanner *Scanner) Protocol() string {
 // 4. Negotiate S7
 // 5. Request to read the module identification (and store it in the output)
 // 6. Request to read the component identification (and store it in the output)
-// 7. Return the output
+// 7. With --protection-level, request to read the protection level
+// 8. With --s7comm-plus, reconnect and send a S7comm-plus CreateObject request
+// 9. Return the output
 func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	conn, err := target.Open(&scanner.config.BaseFlags)
 	if err != nil {
@@ -106,9 +123,21 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	defer conn.Close()
 	result := new(S7Log)
 
-	err = GetS7Banner(result, conn, func() (net.Conn, error) { return target.Open(&scanner.config.BaseFlags) })
-	if !result.IsS7 {
+	err = GetS7Banner(result, conn, func() (net.Conn, error) { return target.Open(&scanner.config.BaseFlags) }, scanner.config.ProtectionLevel)
+	if scanner.config.S7CommPlus {
+		if plusConn, plusErr := target.Open(&scanner.config.BaseFlags); plusErr == nil {
+			result.S7CommPlus, _ = GetS7CommPlusBanner(plusConn)
+			plusConn.Close()
+			if result.S7CommPlus != nil {
+				// S7comm-plus was detected even if classic S7comm failed.
+				err = nil
+			}
+		}
+	}
+	if !result.IsS7 && result.S7CommPlus == nil {
 		result = nil
+	} else {
+		result.ICSDevice = result.icsDevice()
 	}
 	return zgrab2.TryGetScanStatus(err), result, err
 }
@@ -3,6 +3,8 @@
 package smb
 
 import (
+	"net"
+
 	"github.com/Positive-Engineer/zgrab2"
 	"github.com/Positive-Engineer/zgrab2/lib/smb/smb"
 	log "github.com/sirupsen/logrus"
@@ -13,9 +15,20 @@ import (
 type Flags struct {
 	zgrab2.BaseFlags
 
+	// InventoryFlags list the shares if an anonymous login is accepted
+	// (implies --setup-session).
+	zgrab2.InventoryFlags
+
 	// SetupSession tells the client to continue the handshake up to the point where credentials would be needed.
 	SetupSession bool `long:"setup-session" description:"After getting the response from the negotiation request, send a setup session packet."`
 
+	// Dialects negotiates each dialect on its own connection.
+	Dialects bool `long:"dialects" description:"Negotiate each dialect (SMB 1.0 to 3.1.1) on its own connection, and report signing and encryption support for each"`
+
+	// EnumerateShares lists the shares and their access level if an
+	// anonymous login is accepted (implies --setup-session).
+	EnumerateShares bool `long:"enumerate-shares" description:"If an anonymous login is accepted, list the shares and connect to each to report its access level (bounded by --inventory-max-entries)"`
+
 	// Verbose requests more verbose logging / output.
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
 }
@@ -48,6 +61,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(smb.SMBLog)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for SMB servers (Windows filesharing / SAMBA)"
@@ -57,6 +75,10 @@ func (module *Module) Description() string {
 // On success, returns nil.
 // On failure, returns an error instance describing the error.
 func (flags *Flags) Validate(args []string) error {
+	if err := flags.InventoryFlags.Validate(); err != nil {
+		log.Error(err)
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
@@ -103,8 +125,28 @@ func (scanner *Scanner) Protocol() string {
 // 4. If --setup-session is not set, exit with success.
 // 5. Send a setup session packet to the server with appropriate values
 // 6. Read the response from the server; on failure, exit with the log so far.
-// 7. Return the log.
+// 7. If --inventory or --enumerate-shares is set, complete the session setup
+//    as anonymous and, if that is accepted, list the shares over the srvsvc
+//    pipe; with --enumerate-shares, connect to each share to get its access
+//    level.
+// 8. If --dialects is set and a server was found, negotiate each dialect on
+//    a new connection.
+// 9. Return the log.
 func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	status, result, err := scanner.getLog(target)
+	if result == nil {
+		return status, nil, err
+	}
+	if scanner.config.Dialects {
+		result.Dialects = smb.NegotiateDialects(func() (net.Conn, error) {
+			return target.Open(&scanner.config.BaseFlags)
+		}, scanner.config.Verbose)
+	}
+	return status, result, err
+}
+
+// getLog does steps 1-7 of Scan.
+func (scanner *Scanner) getLog(target zgrab2.ScanTarget) (zgrab2.ScanStatus, *smb.SMBLog, error) {
 	conn, err := target.Open(&scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
@@ -113,7 +155,13 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	var result *smb.SMBLog
 	setupSession := scanner.config.SetupSession
 	verbose := scanner.config.Verbose
-	result, err = smb.GetSMBLog(conn, setupSession, false, verbose)
+	if scanner.config.EnumerateShares {
+		result, err = smb.EnumerateShares(conn, &scanner.config.InventoryFlags, scanner.config.Inventory, verbose)
+	} else if scanner.config.Inventory {
+		result, err = smb.GetSMBInventory(conn, &scanner.config.InventoryFlags, verbose)
+	} else {
+		result, err = smb.GetSMBLog(conn, setupSession, false, verbose)
+	}
 	if err != nil {
 		if result == nil {
 			conn.Close()
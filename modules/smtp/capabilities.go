@@ -0,0 +1,130 @@
+package smtp
+
+import (
+	"strings"
+)
+
+// CapabilityResults lists the EHLO capabilities of the server before and
+// after STARTTLS, and the AUTH mechanisms it offers.
+type CapabilityResults struct {
+	// Capabilities are the EHLO keywords (with their parameters) of the
+	// first EHLO response.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// StartTLSCapabilities are the EHLO keywords of the response to the
+	// EHLO sent after STARTTLS.
+	StartTLSCapabilities []string `json:"starttls_capabilities,omitempty"`
+
+	// Added and Removed are the capabilities gained and lost after
+	// STARTTLS.
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+
+	// AuthMechanisms are the SASL mechanisms of the last EHLO response.
+	AuthMechanisms []string `json:"auth_mechanisms,omitempty"`
+
+	// CleartextAuthMechanisms are the SASL mechanisms offered before TLS
+	// was negotiated, i.e. over an unencrypted connection.
+	CleartextAuthMechanisms []string `json:"cleartext_auth_mechanisms,omitempty"`
+
+	// AuthProbes are the server's answers to starting an exchange with
+	// each AUTH mechanism (--auth-probe).
+	AuthProbes []AuthProbe `json:"auth_probes,omitempty"`
+}
+
+// AuthProbe is the server's answer to an AUTH command that was cancelled
+// without sending credentials.
+type AuthProbe struct {
+	Mechanism string `json:"mechanism"`
+
+	// Code is the reply code to the AUTH command; 334 means the server
+	// started the exchange.
+	Code int `json:"code"`
+
+	// Response is the reply to the AUTH command. For challenge-response
+	// mechanisms such as CRAM-MD5 and NTLM it holds the server's challenge.
+	Response string `json:"response"`
+}
+
+// RelayResults holds the answers to a mail transaction addressed to a
+// foreign recipient (--relay-probe). DATA is never sent.
+type RelayResults struct {
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient"`
+
+	// MailFrom and RcptTo are the replies to MAIL FROM and RCPT TO. RCPT
+	// TO is only sent if MAIL FROM was accepted.
+	MailFrom string `json:"mail_from,omitempty"`
+	RcptTo   string `json:"rcpt_to,omitempty"`
+
+	// OpenRelay is true if the recipient was accepted without
+	// authentication. Some servers accept any recipient and bounce the
+	// message later, so this indicates rather than proves an open relay.
+	OpenRelay bool `json:"open_relay"`
+}
+
+// parseEHLO returns the capability lines of an EHLO response, without the
+// reply codes and the greeting line.
+func parseEHLO(response string) []string {
+	var capabilities []string
+	lines := strings.Split(strings.TrimRight(response, "\r\n"), "\n")
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if len(line) < 4 {
+			continue
+		}
+		if line = strings.TrimSpace(line[4:]); line != "" {
+			capabilities = append(capabilities, line)
+		}
+	}
+	return capabilities
+}
+
+// probeAuth starts an exchange with each mechanism and cancels it with "*"
+// (RFC 4954) as soon as the server sends a challenge.
+func probeAuth(conn *Connection, mechanisms []string) ([]AuthProbe, error) {
+	probes := make([]AuthProbe, 0, len(mechanisms))
+	for _, mechanism := range mechanisms {
+		ret, err := conn.SendCommand("AUTH " + mechanism)
+		if err != nil {
+			return probes, err
+		}
+		code, err := getSMTPCode(ret)
+		if err != nil {
+			return probes, err
+		}
+		probes = append(probes, AuthProbe{Mechanism: mechanism, Code: code, Response: strings.TrimSpace(ret)})
+		if code == 334 {
+			if _, err := conn.SendCommand("*"); err != nil {
+				return probes, err
+			}
+		}
+	}
+	return probes, nil
+}
+
+// probeRelay sends MAIL FROM and RCPT TO for the --relay-from and
+// --relay-rcpt addresses, then aborts the transaction with RSET.
+func (scanner *Scanner) probeRelay(conn *Connection) (*RelayResults, error) {
+	result := &RelayResults{Sender: scanner.config.RelayFrom, Recipient: scanner.config.RelayRcpt}
+	ret, err := conn.SendCommand("MAIL FROM:<" + result.Sender + ">")
+	if err != nil {
+		return result, err
+	}
+	result.MailFrom = strings.TrimSpace(ret)
+	if code, err := getSMTPCode(ret); err != nil || code < 200 || code >= 300 {
+		return result, err
+	}
+	ret, err = conn.SendCommand("RCPT TO:<" + result.Recipient + ">")
+	if err != nil {
+		return result, err
+	}
+	result.RcptTo = strings.TrimSpace(ret)
+	code, err := getSMTPCode(ret)
+	if err != nil {
+		return result, err
+	}
+	result.OpenRelay = code >= 200 && code < 300
+	_, err = conn.SendCommand("RSET")
+	return result, err
+}
@@ -0,0 +1,128 @@
+package smtp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// serveSMTP accepts one connection, offering AUTH PLAIN and CRAM-MD5 and
+// accepting recipients in relayDomain. The commands received are sent on
+// the returned channel.
+func serveSMTP(t *testing.T, relayDomain string) (uint, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	commands := make(chan string, 32)
+	go func() {
+		defer close(commands)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "220 mx.example.org ESMTP\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			commands <- line
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				fmt.Fprint(conn, "250-mx.example.org\r\n250-PIPELINING\r\n250-AUTH PLAIN CRAM-MD5\r\n250-AUTH=PLAIN\r\n250 8BITMIME\r\n")
+			case line == "AUTH PLAIN":
+				fmt.Fprint(conn, "334 \r\n")
+			case line == "AUTH CRAM-MD5":
+				fmt.Fprint(conn, "334 PDEyMzRAbXguZXhhbXBsZS5vcmc+\r\n")
+			case line == "*":
+				fmt.Fprint(conn, "501 5.7.0 Authentication aborted\r\n")
+			case strings.HasPrefix(line, "MAIL FROM:"), line == "RSET", line == "QUIT":
+				fmt.Fprint(conn, "250 2.0.0 Ok\r\n")
+			case strings.HasPrefix(line, "RCPT TO:"):
+				if strings.HasSuffix(line, "@"+relayDomain+">") {
+					fmt.Fprint(conn, "250 2.1.5 Ok\r\n")
+				} else {
+					fmt.Fprint(conn, "554 5.7.1 Relay access denied\r\n")
+				}
+			default:
+				fmt.Fprint(conn, "502 5.5.2 Error: command not recognized\r\n")
+			}
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port), commands
+}
+
+func TestCapabilitiesAuthAndRelay(t *testing.T) {
+	for _, test := range []struct {
+		relayDomain string
+		openRelay   bool
+	}{
+		{"example.net", false},
+		{"example.com", true},
+	} {
+		port, commands := serveSMTP(t, test.relayDomain)
+		flags := &Flags{
+			BaseFlags:  zgrab2.BaseFlags{Port: port, Timeout: 5 * time.Second},
+			AuthProbe:  true,
+			RelayProbe: true,
+			RelayRcpt:  "relay-probe@example.com",
+			SendQUIT:   true,
+		}
+		if err := flags.Validate(nil); err != nil {
+			t.Fatal(err)
+		}
+		var scanner Scanner
+		scanner.Init(flags)
+		status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+		if status != zgrab2.SCAN_SUCCESS || err != nil {
+			t.Fatalf("scan failed: %s %v", status, err)
+		}
+		results := result.(*ScanResults)
+		caps := results.Capabilities
+		if caps == nil || !reflect.DeepEqual(caps.Capabilities, []string{"PIPELINING", "AUTH PLAIN CRAM-MD5", "AUTH=PLAIN", "8BITMIME"}) {
+			t.Fatalf("unexpected capabilities %+v", caps)
+		}
+		if !reflect.DeepEqual(caps.AuthMechanisms, []string{"PLAIN", "CRAM-MD5"}) || !reflect.DeepEqual(caps.CleartextAuthMechanisms, caps.AuthMechanisms) {
+			t.Errorf("unexpected mechanisms %v %v", caps.AuthMechanisms, caps.CleartextAuthMechanisms)
+		}
+		if len(caps.AuthProbes) != 2 || caps.AuthProbes[1].Code != 334 || caps.AuthProbes[1].Response != "334 PDEyMzRAbXguZXhhbXBsZS5vcmc+" {
+			t.Errorf("unexpected auth probes %+v", caps.AuthProbes)
+		}
+		if results.EHLOStartTLS != "" || caps.StartTLSCapabilities != nil {
+			t.Errorf("STARTTLS was not offered: %+v", results)
+		}
+		if results.Relay == nil || results.Relay.OpenRelay != test.openRelay || results.Relay.Sender != "" || results.Relay.MailFrom != "250 2.0.0 Ok" {
+			t.Errorf("unexpected relay results %+v", results.Relay)
+		}
+
+		var sent []string
+		for command := range commands {
+			sent = append(sent, command)
+		}
+		expected := []string{"EHLO", "AUTH PLAIN", "*", "AUTH CRAM-MD5", "*", "MAIL FROM:<>", "RCPT TO:<relay-probe@example.com>", "RSET", "QUIT"}
+		if !reflect.DeepEqual(sent, expected) {
+			t.Errorf("sent %q, expected %q", sent, expected)
+		}
+	}
+}
+
+func TestParseEHLO(t *testing.T) {
+	capabilities := parseEHLO("250-mx.example.org\r\n250-STARTTLS\r\n250-SIZE 10240000\r\n250 8BITMIME\r\n")
+	if !reflect.DeepEqual(capabilities, []string{"STARTTLS", "SIZE 10240000", "8BITMIME"}) {
+		t.Errorf("unexpected capabilities %v", capabilities)
+	}
+	if caps := parseEHLO("250 mx.example.org\r\n"); caps != nil {
+		t.Errorf("unexpected capabilities %v", caps)
+	}
+}
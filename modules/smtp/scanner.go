@@ -16,6 +16,27 @@
 // and then negotiate a TLS connection.
 // The scanner uses the standard TLS flags for the handshake.
 //
+// The --capabilities flag sends EHLO, upgrades the connection with STARTTLS
+// if the server offers it, and sends EHLO again, recording the capabilities
+// before and after TLS and the AUTH mechanisms offered. With --auth-probe,
+// an exchange with each mechanism is started and cancelled before any
+// credentials are sent.
+//
+// The --relay-probe flag sends MAIL FROM and RCPT TO for a foreign
+// recipient (--relay-rcpt) and aborts the transaction before DATA,
+// recording whether the server would relay.
+//
+// The --mail-policy flag checks the certificate presented after STARTTLS
+// (or with --smtps) against the DANE TLSA records of the target's domain
+// name and the MTA-STS policy of --mail-policy-domain, reporting whether a
+// sender enforcing them would deliver to the server. Targets without a
+// domain name are not checked.
+//
+// The --smuggling-probes flag runs additional probes, each on its own
+// connection, recording whether the server accepts commands terminated by a
+// bare LF or CR and answers pipelined commands. With --smuggling-rcpt,
+// non-standard end-of-data sequences are tested as well.
+//
 // The --send-quit flag tells the scanner to send a QUIT command.
 //
 // So, if no flags are specified, the scanner simply reads the banner
@@ -30,9 +51,15 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/mailpolicy"
+	"github.com/Positive-Engineer/zgrab2/lib/mailcaps"
+	"github.com/Positive-Engineer/zgrab2/lib/mailsoftware"
 	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zcrypto/tls"
+	"github.com/zmap/zcrypto/x509"
 )
 
 // ErrInvalidResponse is returned when the server returns an invalid or unexpected response.
@@ -64,6 +91,30 @@ type ScanResults struct {
 
 	// TLSLog is the standard TLS log, if STARTTLS is sent.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// TruncatedByTimeout is true if a response was cut short by a read
+	// timeout; the partial response is kept.
+	TruncatedByTimeout bool `json:"truncated_by_timeout,omitempty"`
+
+	// Software is the server software named in the banner, with its
+	// release date and end of life status.
+	Software *mailsoftware.Software `json:"software,omitempty"`
+
+	// EHLOStartTLS is the server's response to the EHLO command sent after
+	// STARTTLS with --capabilities.
+	EHLOStartTLS string `json:"ehlo_starttls,omitempty"`
+
+	// Capabilities holds the results of --capabilities.
+	Capabilities *CapabilityResults `json:"capabilities,omitempty"`
+
+	// Relay holds the results of --relay-probe.
+	Relay *RelayResults `json:"relay,omitempty"`
+
+	// MailPolicy holds the results of --mail-policy.
+	MailPolicy *mailpolicy.Results `json:"mail_policy,omitempty"`
+
+	// Smuggling holds the results of the --smuggling-probes checks.
+	Smuggling *SmugglingResults `json:"smuggling,omitempty"`
 }
 
 // Flags holds the command-line configuration for the HTTP scan module.
@@ -96,8 +147,41 @@ type Flags struct {
 	// StartTLS indicates that the client should attempt to update the connection to TLS.
 	StartTLS bool `long:"starttls" description:"Send STARTTLS before negotiating"`
 
+	// Capabilities enables the EHLO, STARTTLS, EHLO walk.
+	Capabilities bool `long:"capabilities" description:"Send EHLO, upgrade with STARTTLS if offered and send EHLO again, recording the capabilities, how they changed and the AUTH mechanisms. Implies --send-ehlo."`
+
+	// AuthProbe enables starting (and cancelling) each AUTH mechanism.
+	AuthProbe bool `long:"auth-probe" description:"Start an AUTH exchange with each offered mechanism and cancel it before sending credentials. Implies --capabilities."`
+
+	// RelayProbe enables the open relay check.
+	RelayProbe bool `long:"relay-probe" description:"Send MAIL FROM and RCPT TO for a foreign recipient, then RSET (DATA is never sent), recording whether the server would relay. Implies --send-ehlo."`
+
+	// RelayFrom is the sender used by the relay probe.
+	RelayFrom string `long:"relay-from" description:"Sender address for --relay-probe (default: the null sender)"`
+
+	// RelayRcpt is the foreign recipient used by the relay probe.
+	RelayRcpt string `long:"relay-rcpt" default:"relay-probe@example.com" description:"Recipient address for --relay-probe; it should be in a domain the server is not responsible for"`
+
+	// MailPolicy enables the DANE and MTA-STS checks.
+	MailPolicy bool `long:"mail-policy" description:"Check the certificate against the DANE TLSA records of the target's domain name (looked up with --dns-resolver) and the MTA-STS policy of --mail-policy-domain. Implies --starttls unless --smtps is set."`
+
+	// MailPolicyDomain is the mail domain whose MTA-STS policy is checked.
+	MailPolicyDomain string `long:"mail-policy-domain" description:"Mail domain whose MTA-STS policy applies to the scanned servers (default: the target's domain name)"`
+
+	// SmugglingProbes enables the line ending and pipelining probes.
+	SmugglingProbes bool `long:"smuggling-probes" description:"Probe how the server handles bare LF / CR line endings and pipelined commands (each probe on a new connection)"`
+
+	// SmugglingRcpt is the recipient used to test end-of-data variants.
+	SmugglingRcpt string `long:"smuggling-rcpt" description:"Also test non-standard end-of-data sequences for mail to this recipient. The probe contacts the recipient: the server is asked to accept mail for it (MAIL FROM, RCPT TO), which may verify it with its mail system, then the transaction is reset before DATA and no message is sent. Use a mailbox you control."`
+
+	// SmugglingTimeout is how long to wait for a reply in each probe.
+	SmugglingTimeout time.Duration `long:"smuggling-timeout" default:"2s" description:"How long to wait for a reply to each smuggling probe"`
+
 	// Verbose indicates that there should be more verbose logging.
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+
+	// SoftwareTable replaces the built-in mail server release table.
+	SoftwareTable string `long:"software-table" description:"CSV file of product,version,release,released,eol rows replacing the built-in mail server release table"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -107,6 +191,10 @@ type Module struct {
 // Scanner implements the zgrab2.Scanner interface.
 type Scanner struct {
 	config *Flags
+
+	// roots are the MTA-STS trust anchors: --root-cas, or the system CA
+	// bundle.
+	roots *x509.CertPool
 }
 
 // RegisterModule registers the zgrab2 module.
@@ -128,6 +216,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Fetch an SMTP server banner, optionally over TLS"
@@ -147,8 +240,20 @@ func (flags *Flags) Validate(args []string) error {
 	if flags.HELODomain != "" {
 		flags.SendHELO = true
 	}
+	if flags.AuthProbe {
+		flags.Capabilities = true
+	}
+	if flags.Capabilities || flags.RelayProbe {
+		flags.SendEHLO = true
+	}
+	if flags.MailPolicy && !flags.SMTPSecure {
+		flags.StartTLS = true
+	}
+	if flags.SmugglingRcpt != "" {
+		flags.SmugglingProbes = true
+	}
 	if flags.SendHELO && flags.SendEHLO {
-		log.Errorln("Cannot provide both EHLO and HELO")
+		log.Errorln("Cannot provide both EHLO and HELO (--capabilities and --relay-probe send EHLO)")
 		return zgrab2.ErrInvalidArguments
 	}
 	return nil
@@ -163,6 +268,16 @@ func (flags *Flags) Help() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*Flags)
 	scanner.config = f
+	if f.MailPolicy {
+		roots, err := mailpolicy.LoadRoots(f.RootCAs)
+		if err != nil {
+			return err
+		}
+		scanner.roots = roots
+	}
+	if f.SoftwareTable != "" {
+		return mailsoftware.LoadTable(f.SoftwareTable)
+	}
 	return nil
 }
 
@@ -233,10 +348,17 @@ func VerifySMTPContents(banner string) (zgrab2.ScanStatus, int) {
 // 4. If --send-ehlo or --send-helo is sent, send the corresponding EHLO
 //    or HELO command.
 // 5. If --send-help is sent, send HELP, read the result.
-// 6. If --starttls is sent, send STARTTLS, read the result, negotiate a
-//    TLS connection.
-// 7. If --send-quit is sent, send QUIT and read the result.
-// 8. Close the connection.
+// 6. If --starttls is sent, or --capabilities is set and the server offers
+//    STARTTLS, send STARTTLS, read the result, negotiate a TLS connection.
+// 7. If --capabilities is set, send EHLO again after STARTTLS, and with
+//    --auth-probe start and cancel each AUTH mechanism.
+// 8. If --relay-probe is set, send MAIL FROM, RCPT TO and RSET.
+// 9. If --mail-policy is set, check the certificate against the DANE and
+//    MTA-STS policies.
+// 10. If --smuggling-probes is set, run the smuggling probes on separate
+//     connections.
+// 11. If --send-quit is sent, send QUIT and read the result.
+// 12. Close the connection.
 func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	c, err := target.Open(&scanner.config.BaseFlags)
 	if err != nil {
@@ -271,6 +393,7 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		return sr, nil, errors.New("Invalid response for SMTP")
 	}
 	result.Banner = banner
+	result.Software = mailsoftware.Identify(banner)
 	if scanner.config.SendHELO {
 		ret, err := conn.SendCommand(getCommand("HELO", scanner.config.HELODomain))
 		if err != nil {
@@ -284,6 +407,13 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 		result.EHLO = ret
+		if scanner.config.Capabilities {
+			result.Capabilities = &CapabilityResults{Capabilities: parseEHLO(ret)}
+			result.Capabilities.AuthMechanisms = mailcaps.Mechanisms(result.Capabilities.Capabilities, "AUTH")
+			if !scanner.config.SMTPSecure {
+				result.Capabilities.CleartextAuthMechanisms = result.Capabilities.AuthMechanisms
+			}
+		}
 	}
 	if scanner.config.SendHELP {
 		ret, err := conn.SendCommand("HELP")
@@ -292,7 +422,11 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		}
 		result.HELP = ret
 	}
-	if scanner.config.StartTLS {
+	startTLS := scanner.config.StartTLS
+	if caps := result.Capabilities; caps != nil && !scanner.config.SMTPSecure && mailcaps.Has(caps.Capabilities, "STARTTLS") {
+		startTLS = true
+	}
+	if startTLS {
 		ret, err := conn.SendCommand("STARTTLS")
 		if err != nil {
 			return zgrab2.TryGetScanStatus(err), result, err
@@ -314,6 +448,34 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 		conn.Conn = tlsConn
+		if caps := result.Capabilities; caps != nil {
+			ret, err := conn.SendCommand(getCommand("EHLO", scanner.config.EHLODomain))
+			if err != nil {
+				return zgrab2.TryGetScanStatus(err), result, err
+			}
+			result.EHLOStartTLS = ret
+			caps.StartTLSCapabilities = parseEHLO(ret)
+			caps.Added, caps.Removed = mailcaps.Delta(caps.Capabilities, caps.StartTLSCapabilities)
+			caps.AuthMechanisms = mailcaps.Mechanisms(caps.StartTLSCapabilities, "AUTH")
+		}
+	}
+	if caps := result.Capabilities; caps != nil && scanner.config.AuthProbe {
+		caps.AuthProbes, err = probeAuth(&conn, caps.AuthMechanisms)
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+	}
+	if scanner.config.RelayProbe {
+		result.Relay, err = scanner.probeRelay(&conn)
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+	}
+	if scanner.config.MailPolicy && target.Domain != "" {
+		result.MailPolicy = scanner.checkMailPolicy(&target, result.TLSLog)
+	}
+	if scanner.config.SmugglingProbes {
+		result.Smuggling = scanner.probeSmuggling(&target)
 	}
 	if scanner.config.SendQUIT {
 		ret, err := conn.SendCommand("QUIT")
@@ -324,8 +486,39 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		}
 		result.QUIT = ret
 	}
+	result.TruncatedByTimeout = conn.TruncatedByTimeout
 	if sr == zgrab2.SCAN_APPLICATION_ERROR {
 		return sr, result, fmt.Errorf("SMTP error code %d returned in banner grab", bannerResponseCode)
 	}
 	return sr, result, nil
 }
+
+// checkMailPolicy checks the certificates of tlsLog (nil without TLS), up
+// to the first one that does not parse, against the DANE policy of the target's domain name and the MTA-STS
+// policy of the mail domain.
+func (scanner *Scanner) checkMailPolicy(target *zgrab2.ScanTarget, tlsLog *zgrab2.TLSLog) *mailpolicy.Results {
+	port := scanner.config.Port
+	if target.Port != nil {
+		port = *target.Port
+	}
+	domain := scanner.config.MailPolicyDomain
+	if domain == "" {
+		domain = target.Domain
+	}
+	var chain []*x509.Certificate
+	if tlsLog != nil {
+		if certs := tlsLog.ServerCertificates(); certs != nil {
+			for _, cert := range append([]tls.SimpleCertificate{certs.Certificate}, certs.Chain...) {
+				parsed := cert.Parsed
+				if parsed == nil {
+					parsed, _ = x509.ParseCertificate(cert.Raw)
+				}
+				if parsed == nil {
+					break
+				}
+				chain = append(chain, parsed)
+			}
+		}
+	}
+	return mailpolicy.Check(target.Domain, port, domain, chain, scanner.roots, scanner.config.Timeout)
+}
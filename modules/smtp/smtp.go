@@ -17,6 +17,10 @@ const readBufferSize int = 0x10000
 // Connection wraps the state and access to the SMTP connection.
 type Connection struct {
 	Conn net.Conn
+
+	// TruncatedByTimeout is set if a read timed out before the end of a
+	// response; the partial response is still returned.
+	TruncatedByTimeout bool
 }
 
 // ReadResponse reads from the connection until it matches the smtpEndRegex. Copied from the original zgrab.
@@ -27,6 +31,9 @@ func (conn *Connection) ReadResponse() (string, error) {
 	if err != nil && err != io.EOF && !zgrab2.IsTimeoutError(err) {
 		return "", err
 	}
+	if zgrab2.TruncatedByTimeout(n, err) {
+		conn.TruncatedByTimeout = true
+	}
 	return string(ret[:n]), nil
 }
 
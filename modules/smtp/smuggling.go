@@ -0,0 +1,236 @@
+package smtp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// SmugglingResults describes how the server parses line endings and
+// pipelined input, which determines its exposure to SMTP smuggling.
+type SmugglingResults struct {
+	// PipeliningAdvertised is true if PIPELINING is listed in the EHLO
+	// response.
+	PipeliningAdvertised bool `json:"pipelining_advertised"`
+
+	// PipelinedResponses is true if the server answered every command of a
+	// batch sent in a single write.
+	PipelinedResponses bool `json:"pipelined_responses"`
+
+	// BareLFCommand is true if the server accepted a command terminated by a
+	// bare LF.
+	BareLFCommand bool `json:"bare_lf_command"`
+
+	// BareCRCommand is true if the server accepted a command terminated by a
+	// bare CR.
+	BareCRCommand bool `json:"bare_cr_command"`
+
+	// EndOfData maps each non-standard end-of-data sequence to whether the
+	// server splits lines at both of its line endings, so that it would take
+	// it as the end of the message. Only tested when --smuggling-rcpt is
+	// given; no message is sent.
+	EndOfData map[string]bool `json:"end_of_data,omitempty"`
+
+	// Errors holds the errors of probes that could not be completed.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// endOfDataVariants are the malformed "<CRLF>.<CRLF>" sequences tested,
+// "<A>.<B>" with the line endings A and B.
+var endOfDataVariants = []struct {
+	name     string
+	sequence string
+}{
+	{"lf.lf", "\n.\n"},
+	{"lf.crlf", "\n.\r\n"},
+	{"cr.cr", "\r.\r"},
+	{"cr.crlf", "\r.\r\n"},
+	{"crlf.lf", "\r\n.\n"},
+	{"crlf.cr", "\r\n.\r"},
+}
+
+// smtpFinalLineRegex matches the last line of a (possibly multi-line) reply.
+var smtpFinalLineRegex = regexp.MustCompile(`(?m)^(\d\d\d)(?:[ \r][^\n]*)?\n`)
+
+// probeSession opens a new connection, reads the banner and sends EHLO
+// (plus STARTTLS, if configured), and returns the connection and the EHLO
+// response.
+func (scanner *Scanner) probeSession(target *zgrab2.ScanTarget) (*Connection, string, error) {
+	c, err := target.Open(&scanner.config.BaseFlags)
+	if err != nil {
+		return nil, "", err
+	}
+	conn := &Connection{Conn: c}
+	if scanner.config.SMTPSecure {
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(c)
+		if err != nil {
+			c.Close()
+			return nil, "", err
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			c.Close()
+			return nil, "", err
+		}
+		conn.Conn = tlsConn
+	}
+	if _, err := conn.ReadResponse(); err != nil {
+		conn.Conn.Close()
+		return nil, "", err
+	}
+	ehlo, err := conn.SendCommand(getCommand("EHLO", scanner.config.EHLODomain))
+	if err != nil {
+		conn.Conn.Close()
+		return nil, "", err
+	}
+	if scanner.config.StartTLS {
+		if _, err := conn.SendCommand("STARTTLS"); err != nil {
+			conn.Conn.Close()
+			return nil, "", err
+		}
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(conn.Conn)
+		if err != nil {
+			conn.Conn.Close()
+			return nil, "", err
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Conn.Close()
+			return nil, "", err
+		}
+		conn.Conn = tlsConn
+		if ehlo, err = conn.SendCommand(getCommand("EHLO", scanner.config.EHLODomain)); err != nil {
+			conn.Conn.Close()
+			return nil, "", err
+		}
+	}
+	return conn, ehlo, nil
+}
+
+// readReplies reads until count complete replies have been received or the
+// probe timeout expires, and returns the reply codes seen.
+func (scanner *Scanner) readReplies(conn *Connection, count int) []int {
+	var codes []int
+	var data []byte
+	buf := make([]byte, 4096)
+	deadline := time.Now().Add(scanner.config.SmugglingTimeout)
+	for len(codes) < count && time.Now().Before(deadline) {
+		conn.Conn.SetReadDeadline(deadline)
+		n, err := conn.Conn.Read(buf)
+		data = append(data, buf[:n]...)
+		codes = codes[:0]
+		for _, match := range smtpFinalLineRegex.FindAllSubmatch(data, -1) {
+			code, _ := strconv.Atoi(string(match[1]))
+			codes = append(codes, code)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return codes
+}
+
+// probeCommandTerminator checks whether a NOOP terminated by the given
+// sequence is answered.
+func (scanner *Scanner) probeCommandTerminator(target *zgrab2.ScanTarget, terminator string) (bool, error) {
+	conn, _, err := scanner.probeSession(target)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Conn.Close()
+	if _, err := conn.Conn.Write([]byte("NOOP" + terminator)); err != nil {
+		return false, err
+	}
+	codes := scanner.readReplies(conn, 1)
+	return len(codes) > 0 && codes[0] >= 200 && codes[0] < 300, nil
+}
+
+// probePipelining sends three commands in a single write and checks that
+// all of them are answered.
+func (scanner *Scanner) probePipelining(target *zgrab2.ScanTarget, result *SmugglingResults) error {
+	conn, ehlo, err := scanner.probeSession(target)
+	if err != nil {
+		return err
+	}
+	defer conn.Conn.Close()
+	result.PipeliningAdvertised = strings.Contains(strings.ToUpper(ehlo), "PIPELINING")
+	if _, err := conn.Conn.Write([]byte("NOOP\r\nRSET\r\nNOOP\r\n")); err != nil {
+		return err
+	}
+	result.PipelinedResponses = len(scanner.readReplies(conn, 3)) == 3
+	return nil
+}
+
+// probeEndOfData checks whether the server would take the variant
+// "<A>.<B>" as the end of the data, without ever entering the DATA phase:
+// the server is asked to accept mail for --smuggling-rcpt, the transaction
+// is reset, and the variant is accepted if "NOOP<A>NOOP<B>" is answered with
+// two 2xx replies, i.e. the server splits lines at both A and B. A server
+// that does not split at A sees one malformed command, and one that does
+// not split at B waits for the end of the second NOOP.
+func (scanner *Scanner) probeEndOfData(target *zgrab2.ScanTarget, sequence string) (bool, error) {
+	conn, _, err := scanner.probeSession(target)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Conn.Close()
+	commands := []string{"MAIL FROM:<>", "RCPT TO:<" + scanner.config.SmugglingRcpt + ">", "RSET"}
+	for _, cmd := range commands {
+		ret, err := conn.SendCommand(cmd)
+		if err != nil {
+			return false, err
+		}
+		code, err := getSMTPCode(ret)
+		if err != nil {
+			return false, err
+		}
+		if code >= 400 {
+			return false, fmt.Errorf("%s rejected: %s", cmd, strings.TrimSpace(ret))
+		}
+	}
+	dot := strings.Index(sequence, ".")
+	if _, err := conn.Conn.Write([]byte("NOOP" + sequence[:dot] + "NOOP" + sequence[dot+1:])); err != nil {
+		return false, err
+	}
+	codes := scanner.readReplies(conn, 2)
+	conn.Conn.Write([]byte("QUIT\r\n"))
+	for _, code := range codes {
+		if code < 200 || code >= 300 {
+			return false, nil
+		}
+	}
+	return len(codes) == 2, nil
+}
+
+// probeSmuggling runs all of the smuggling probes, each on its own
+// connection.
+func (scanner *Scanner) probeSmuggling(target *zgrab2.ScanTarget) *SmugglingResults {
+	result := &SmugglingResults{Errors: make(map[string]string)}
+	var err error
+	if err = scanner.probePipelining(target, result); err != nil {
+		result.Errors["pipelining"] = err.Error()
+	}
+	if result.BareLFCommand, err = scanner.probeCommandTerminator(target, "\n"); err != nil {
+		result.Errors["bare_lf_command"] = err.Error()
+	}
+	if result.BareCRCommand, err = scanner.probeCommandTerminator(target, "\r"); err != nil {
+		result.Errors["bare_cr_command"] = err.Error()
+	}
+	if scanner.config.SmugglingRcpt != "" {
+		result.EndOfData = make(map[string]bool)
+		for _, variant := range endOfDataVariants {
+			accepted, err := scanner.probeEndOfData(target, variant.sequence)
+			if err != nil {
+				result.Errors["end_of_data_"+variant.name] = err.Error()
+				continue
+			}
+			result.EndOfData[variant.name] = accepted
+		}
+	}
+	if len(result.Errors) == 0 {
+		result.Errors = nil
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package smtp
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// serveLineEndings runs an SMTP server that ends lines at CRLF, or also at a
+// bare LF if bareLF is set. The commands received are sent on the returned
+// channel.
+func serveLineEndings(t *testing.T, bareLF bool) (uint, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	commands := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			conn.Write([]byte("220 mx.example.com ESMTP\r\n"))
+			for {
+				line, err := reader.ReadString('\n')
+				for !bareLF && err == nil && !strings.HasSuffix(line, "\r\n") {
+					var more string
+					more, err = reader.ReadString('\n')
+					line += more
+				}
+				if err != nil {
+					break
+				}
+				line = strings.TrimRight(line, "\r\n")
+				commands <- line
+				switch {
+				case strings.HasPrefix(line, "EHLO"):
+					conn.Write([]byte("250-mx.example.com\r\n250 PIPELINING\r\n"))
+				case line == "DATA":
+					conn.Write([]byte("354 End data with <CR><LF>.<CR><LF>\r\n"))
+				case line == "QUIT":
+					conn.Write([]byte("221 Bye\r\n"))
+				case line == "NOOP" || line == "RSET" || strings.HasPrefix(line, "MAIL") || strings.HasPrefix(line, "RCPT"):
+					conn.Write([]byte("250 Ok\r\n"))
+				default:
+					conn.Write([]byte("502 5.5.2 Error: command not recognized\r\n"))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port), commands
+}
+
+func TestProbeEndOfData(t *testing.T) {
+	// A server splitting lines at a bare LF takes the variants made of LF
+	// and CRLF as the end of the data.
+	accepted := map[string]bool{"lf.lf": true, "lf.crlf": true, "crlf.lf": true}
+	for _, bareLF := range []bool{true, false} {
+		port, commands := serveLineEndings(t, bareLF)
+		flags := &Flags{
+			BaseFlags:        zgrab2.BaseFlags{Port: port, Timeout: 5 * time.Second},
+			EHLODomain:       "client.example.com",
+			SmugglingRcpt:    "probe@example.com",
+			SmugglingTimeout: 200 * time.Millisecond,
+		}
+		scanner := &Scanner{config: flags}
+		target := &zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")}
+		for _, variant := range endOfDataVariants {
+			ok, err := scanner.probeEndOfData(target, variant.sequence)
+			if err != nil {
+				t.Fatalf("%s: %v", variant.name, err)
+			}
+			if want := bareLF && accepted[variant.name]; ok != want {
+				t.Errorf("%s with bare LF %v: got %v, expected %v", variant.name, bareLF, ok, want)
+			}
+		}
+		// The transaction is reset before DATA: no message is sent.
+		resets := 0
+		for done := false; !done; {
+			select {
+			case command := <-commands:
+				if command == "DATA" {
+					t.Error("DATA sent")
+				}
+				if command == "RSET" {
+					resets++
+				}
+			case <-time.After(100 * time.Millisecond):
+				done = true
+			}
+		}
+		if resets != len(endOfDataVariants) {
+			t.Errorf("got %d RSET, expected %d", resets, len(endOfDataVariants))
+		}
+	}
+}
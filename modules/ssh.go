@@ -1,6 +1,9 @@
 package modules
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"strconv"
 	"strings"
@@ -22,6 +25,10 @@ type SSHFlags struct {
 	GexPreferredBits  uint   `long:"gex-preferred-bits" description:"The preferred number of bits for the DH GEX prime." default:"2048"`
 	HelloOnly         bool   `long:"hello-only" description:"Limit scan to the initial hello message"`
 	Verbose           bool   `long:"verbose" description:"Output additional information, including SSH client properties from the SSH handshake."`
+	AllHostKeys       bool   `long:"all-host-keys" description:"Collect every type of host key the server offers (rsa, ecdsa, ed25519, dss) with one more handshake for each"`
+	AuthUser          string `long:"auth-user" description:"Username for the 'none' authentication request and for --auth-password and --auth-key"`
+	AuthPassword      string `long:"auth-password" description:"Try to log in once with this password, for authorized audits; the outcome is reported in auth_attempt"`
+	AuthKey           string `long:"auth-key" description:"Try to log in once with the unencrypted private key in this PEM file, for authorized audits; the outcome is reported in auth_attempt"`
 }
 
 type SSHModule struct {
@@ -29,6 +36,9 @@ type SSHModule struct {
 
 type SSHScanner struct {
 	config *SSHFlags
+
+	// auth are the methods tried with --auth-password and --auth-key.
+	auth []ssh.AuthMethod
 }
 
 func init() {
@@ -51,12 +61,21 @@ func (m *SSHModule) NewScanner() zgrab2.Scanner {
 	return new(SSHScanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (m *SSHModule) NewResult() interface{} {
+	return new(ssh.HandshakeLog)
+}
+
 // Description returns an overview of this module.
 func (m *SSHModule) Description() string {
 	return "Fetch an SSH server banner and collect key exchange information"
 }
 
 func (f *SSHFlags) Validate(args []string) error {
+	if (f.AuthPassword != "" || f.AuthKey != "") && f.AuthUser == "" {
+		log.Error("--auth-password and --auth-key require --auth-user")
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
@@ -67,6 +86,20 @@ func (f *SSHFlags) Help() string {
 func (s *SSHScanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*SSHFlags)
 	s.config = f
+	if f.AuthPassword != "" {
+		s.auth = append(s.auth, ssh.Password(f.AuthPassword))
+	}
+	if f.AuthKey != "" {
+		pemBytes, err := ioutil.ReadFile(f.AuthKey)
+		if err != nil {
+			return err
+		}
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			return fmt.Errorf("invalid --auth-key: %v", err)
+		}
+		s.auth = append(s.auth, ssh.PublicKeys(signer))
+	}
 	return nil
 }
 
@@ -82,6 +115,68 @@ func (s *SSHScanner) GetTrigger() string {
 	return s.config.Trigger
 }
 
+// collectHostKey performs a handshake offering only algorithms, and
+// returns the server's host key. The connection is dropped once the key is
+// verified, before authentication.
+func (s *SSHScanner) collectHostKey(rhost string, algorithms []string) (ssh.PublicKey, error) {
+	config := ssh.MakeSSHConfig()
+	config.Timeout = s.config.Timeout
+	config.ConnLog = new(ssh.HandshakeLog)
+	config.ClientVersion = s.config.ClientID
+	config.HostKeyAlgorithms = algorithms
+	if err := config.SetKexAlgorithms(s.config.KexAlgorithms); err != nil {
+		return nil, err
+	}
+	if err := config.SetCiphers(s.config.Ciphers); err != nil {
+		return nil, err
+	}
+	config.GexMinBits = s.config.GexMinBits
+	config.GexMaxBits = s.config.GexMaxBits
+	config.GexPreferredBits = s.config.GexPreferredBits
+	var hostKey ssh.PublicKey
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKey = key
+		return errHostKeyCollected
+	}
+	client, err := ssh.Dial("tcp", rhost, config)
+	if client != nil {
+		client.Close()
+	}
+	if hostKey != nil {
+		return hostKey, nil
+	}
+	if err == nil {
+		err = errors.New("no host key received")
+	}
+	return nil, err
+}
+
+// errHostKeyCollected ends the handshakes of collectHostKey.
+var errHostKeyCollected = errors.New("host key collected")
+
+// collectHostKeys collects the host key of each family offered in the
+// server's KEXINIT.
+func (s *SSHScanner) collectHostKeys(rhost string, serverKex *ssh.KexInitMsg) []*ssh.HostKey {
+	var ret []*ssh.HostKey
+	for i := range ssh.HostKeyFamilies {
+		family := &ssh.HostKeyFamilies[i]
+		algorithms := family.OfferedBy(serverKex)
+		if len(algorithms) == 0 {
+			continue
+		}
+		hostKey := &ssh.HostKey{Family: family.Name, Algorithms: algorithms}
+		ret = append(ret, hostKey)
+		key, err := s.collectHostKey(rhost, algorithms)
+		if err != nil {
+			hostKey.Error = err.Error()
+			continue
+		}
+		hostKey.Key = ssh.LogServerHostKey(key.Marshal())
+		hostKey.Fingerprint = ssh.FingerprintSHA256(key)
+	}
+	return ret
+}
+
 func (s *SSHScanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	data := new(ssh.HandshakeLog)
 
@@ -110,7 +205,10 @@ func (s *SSHScanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{},
 		log.Fatal(err)
 	}
 	sshConfig.Verbose = s.config.Verbose
-	sshConfig.DontAuthenticate = s.config.CollectUserAuth
+	sshConfig.DontAuthenticate = s.config.CollectUserAuth && len(s.auth) == 0
+	sshConfig.TryAuth = len(s.auth) > 0
+	sshConfig.Auth = s.auth
+	sshConfig.User = s.config.AuthUser
 	sshConfig.GexMinBits = s.config.GexMinBits
 	sshConfig.GexMaxBits = s.config.GexMaxBits
 	sshConfig.GexPreferredBits = s.config.GexPreferredBits
@@ -118,7 +216,15 @@ func (s *SSHScanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{},
 		data.Banner = strings.TrimSpace(banner)
 		return nil
 	}
-	_, err := ssh.Dial("tcp", rhost, sshConfig)
+	client, err := ssh.Dial("tcp", rhost, sshConfig)
+	if client != nil {
+		client.Close()
+	}
+	data.FeatureFlags = ssh.ComputeFeatureFlags(data)
+	data.WeakAlgorithms = ssh.ComputeWeakAlgorithms(data)
+	if s.config.AllHostKeys && !s.config.HelloOnly && data.ServerKex != nil {
+		data.HostKeys = s.collectHostKeys(rhost, data.ServerKex)
+	}
 	// TODO FIXME: Distinguish error types
 	status := zgrab2.TryGetScanStatus(err)
 	return status, data, err
@@ -0,0 +1,211 @@
+package modules
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/ssh"
+	"golang.org/x/crypto/ed25519"
+)
+
+// serveSSH runs an SSH server with config until the end of the test, and
+// returns its port.
+func serveSSH(t *testing.T, config *ssh.ServerConfig) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// sshTestFlags returns the default flags of the ssh module.
+func sshTestFlags() *SSHFlags {
+	defaults := ssh.MakeSSHConfig()
+	flags := &SSHFlags{
+		ClientID:          "SSH-2.0-Go",
+		HostKeyAlgorithms: strings.Join(defaults.HostKeyAlgorithms, ","),
+		KexAlgorithms:     strings.Join(defaults.KeyExchanges, ","),
+		Ciphers:           strings.Join(defaults.Ciphers, ","),
+		GexMinBits:        1024,
+		GexMaxBits:        8192,
+		GexPreferredBits:  2048,
+	}
+	flags.Timeout = 5 * time.Second
+	return flags
+}
+
+func TestSSHAllHostKeys(t *testing.T) {
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	fingerprints := make(map[string]string)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for family, key := range map[string]interface{}{"rsa": rsaKey, "ecdsa": ecdsaKey, "ed25519": &ed25519Key} {
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverConfig.AddHostKey(signer)
+		fingerprints[family] = ssh.FingerprintSHA256(signer.PublicKey())
+	}
+
+	port := serveSSH(t, serverConfig)
+	flags := sshTestFlags()
+	flags.AllHostKeys = true
+	var scanner SSHScanner
+	scanner.Init(flags)
+	_, result, _ := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1"), Port: &port})
+	hostKeys := result.(*ssh.HandshakeLog).HostKeys
+	if len(hostKeys) != 3 {
+		t.Fatalf("got %d host keys, expected 3", len(hostKeys))
+	}
+	for _, hostKey := range hostKeys {
+		if hostKey.Error != "" {
+			t.Errorf("%s: %s", hostKey.Family, hostKey.Error)
+			continue
+		}
+		if hostKey.Fingerprint != fingerprints[hostKey.Family] {
+			t.Errorf("%s: fingerprint %s, expected %s", hostKey.Family, hostKey.Fingerprint, fingerprints[hostKey.Family])
+		}
+		if hostKey.Key == nil || hostKey.Key.Algorithm != hostKey.Algorithms[0] {
+			t.Errorf("%s: unexpected key %+v for algorithms %v", hostKey.Family, hostKey.Key, hostKey.Algorithms)
+		}
+	}
+}
+
+func TestSSHAuthAttempt(t *testing.T) {
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "audit" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("denied")
+		},
+	}
+	serverConfig.AddHostKey(signer)
+	port := serveSSH(t, serverConfig)
+	target := zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1"), Port: &port}
+
+	flags := sshTestFlags()
+	flags.CollectUserAuth = true
+	var scanner SSHScanner
+	scanner.Init(flags)
+	status, result, err := scanner.Scan(target)
+	data := result.(*ssh.HandshakeLog)
+	if status != zgrab2.SCAN_SUCCESS || data.AuthAttempt != nil || !reflect.DeepEqual(data.UserAuth, []string{"password"}) {
+		t.Errorf("--userauth: status %s, error %v, userauth %v, attempt %+v", status, err, data.UserAuth, data.AuthAttempt)
+	}
+
+	for _, test := range []struct {
+		password string
+		success  bool
+	}{
+		{"wrong", false},
+		{"secret", true},
+	} {
+		flags := sshTestFlags()
+		flags.AuthUser = "audit"
+		flags.AuthPassword = test.password
+		var scanner SSHScanner
+		if err := scanner.Init(flags); err != nil {
+			t.Fatal(err)
+		}
+		status, result, err := scanner.Scan(target)
+		if status != zgrab2.SCAN_SUCCESS {
+			t.Errorf("%s: status %s, error %v", test.password, status, err)
+			continue
+		}
+		attempt := result.(*ssh.HandshakeLog).AuthAttempt
+		if attempt == nil || attempt.User != "audit" || attempt.Success != test.success || !reflect.DeepEqual(attempt.Tried, []string{"password"}) {
+			t.Errorf("%s: unexpected attempt %+v", test.password, attempt)
+			continue
+		}
+		if test.success && attempt.Method != "password" || !test.success && attempt.Error == "" {
+			t.Errorf("%s: unexpected attempt %+v", test.password, attempt)
+		}
+	}
+}
+
+func TestSSHHASSH(t *testing.T) {
+	client := &ssh.KexInitMsg{
+		KexAlgos:                []string{"curve25519-sha256"},
+		CiphersClientServer:     []string{"aes128-ctr"},
+		MACsClientServer:        []string{"hmac-sha1"},
+		CompressionClientServer: []string{"none"},
+	}
+	server := &ssh.KexInitMsg{
+		KexAlgos:                []string{"curve25519-sha256", "diffie-hellman-group14-sha256"},
+		CiphersClientServer:     []string{"aes128-ctr"},
+		CiphersServerClient:     []string{"aes128-ctr", "aes256-gcm@openssh.com"},
+		MACsServerClient:        []string{"hmac-sha2-256"},
+		CompressionServerClient: []string{"none", "zlib@openssh.com"},
+	}
+	hassh := ssh.ComputeHASSH(client, server)
+	if hassh.Client != "7fffb234014b2a6c335168b9683cbb70" || hassh.ClientAlgorithms != "curve25519-sha256;aes128-ctr;hmac-sha1;none" {
+		t.Errorf("unexpected hassh %s (%s)", hassh.Client, hassh.ClientAlgorithms)
+	}
+	if hassh.Server != "7b3f76e580e44aea1e396d8af55a8228" || hassh.ServerAlgorithms != "curve25519-sha256,diffie-hellman-group14-sha256;aes128-ctr,aes256-gcm@openssh.com;hmac-sha2-256;none,zlib@openssh.com" {
+		t.Errorf("unexpected hasshServer %s (%s)", hassh.Server, hassh.ServerAlgorithms)
+	}
+
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+	port := serveSSH(t, serverConfig)
+	var scanner SSHScanner
+	scanner.Init(sshTestFlags())
+	_, result, _ := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1"), Port: &port})
+	data := result.(*ssh.HandshakeLog)
+	if data.HASSH == nil || data.ServerKex == nil {
+		t.Fatal("no HASSH in the handshake log")
+	}
+	if expected := ssh.ComputeHASSH(nil, data.ServerKex).Server; data.HASSH.Server != expected || data.HASSH.Client == "" {
+		t.Errorf("unexpected HASSH %+v, expected hasshServer %s", data.HASSH, expected)
+	}
+}
@@ -0,0 +1,69 @@
+package telnet
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Login prompt types.
+const (
+	PromptUsername = "username"
+	PromptPassword = "password"
+	PromptShell    = "shell"
+)
+
+// LoginPrompt is the classification of a telnet banner.
+type LoginPrompt struct {
+	// Vendor is the vendor the banner matched, if any.
+	Vendor string `json:"vendor,omitempty"`
+
+	// Prompt is the kind of prompt the banner ends with: "username",
+	// "password", "shell" (a command prompt, without logging in) or empty.
+	Prompt string `json:"prompt,omitempty"`
+
+	// PromptLine is the last line of the banner.
+	PromptLine string `json:"prompt_line,omitempty"`
+}
+
+// vendorPatterns map vendors to patterns of their banners and prompts.
+var vendorPatterns = []struct {
+	vendor  string
+	pattern *regexp.Regexp
+}{
+	{"Cisco", regexp.MustCompile(`(?i)\bcisco\b|User Access Verification`)},
+	{"Huawei", regexp.MustCompile(`(?i)\bhuawei\b|(?m)^\s*Login authentication\s*$|(?m)^<[^<>\r\n]+>\r?$`)},
+	{"MikroTik", regexp.MustCompile(`(?i)\bmikrotik\b|RouterOS`)},
+	{"BusyBox", regexp.MustCompile(`(?i)\bbusybox\b|built-in shell \(ash\)`)},
+}
+
+var (
+	usernamePromptRegex = regexp.MustCompile(`(?i)(?:user ?name|login|user|account)\s*:$`)
+	passwordPromptRegex = regexp.MustCompile(`(?i)pass(?:word|code)?\s*:$`)
+	shellPromptRegex    = regexp.MustCompile(`[#$%>]$`)
+)
+
+// classifyBanner returns the vendor and prompt of a banner, or nil if the
+// banner is empty.
+func classifyBanner(banner string) *LoginPrompt {
+	lines := strings.Split(strings.TrimSpace(strings.Replace(banner, "\r", "\n", -1)), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if last == "" {
+		return nil
+	}
+	result := &LoginPrompt{PromptLine: last}
+	for _, vendor := range vendorPatterns {
+		if vendor.pattern.MatchString(banner) {
+			result.Vendor = vendor.vendor
+			break
+		}
+	}
+	switch {
+	case usernamePromptRegex.MatchString(last):
+		result.Prompt = PromptUsername
+	case passwordPromptRegex.MatchString(last):
+		result.Prompt = PromptPassword
+	case shellPromptRegex.MatchString(last):
+		result.Prompt = PromptShell
+	}
+	return result
+}
@@ -30,6 +30,22 @@ type TelnetLog struct {
 
 	// Dont is the list of options that the server requests the client *not* use.
 	Dont []TelnetOption `json:"dont,omitempty"`
+
+	// Subnegotiations is the list of options for which the server sent a
+	// subnegotiation, e.g. to ask for the terminal type.
+	Subnegotiations []TelnetOption `json:"subnegotiations,omitempty"`
+
+	// OptionFingerprint is the server's option requests in the order they
+	// were received, e.g. "do:24,do:32,will:1,will:3", for comparing
+	// implementations.
+	OptionFingerprint string `json:"option_fingerprint,omitempty"`
+
+	// LoginPrompt classifies the banner.
+	LoginPrompt *LoginPrompt `json:"login_prompt,omitempty"`
+
+	// TruncatedByTimeout is true if the server was still sending the banner
+	// when the connection's timeout expired.
+	TruncatedByTimeout bool `json:"truncated_by_timeout,omitempty"`
 }
 
 // isTelnet checks if this struct represents having actually detected a Telnet service.
@@ -0,0 +1,165 @@
+package telnet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Options a client accepts when negotiating fully.
+const (
+	optBinary       = byte(0)
+	optEcho         = byte(1)
+	optSuppressGA   = byte(3)
+	optTerminalType = byte(24)
+	optWindowSize   = byte(31)
+)
+
+// terminalType is the terminal type reported to servers that ask for it
+// (RFC 1091).
+const terminalType = "VT100"
+
+// maxSubnegotiationLength bounds an unterminated subnegotiation kept across
+// reads.
+const maxSubnegotiationLength = 1024
+
+// negotiator parses the telnet commands in the data sent by the server and
+// builds the replies, either refusing every option or, if full is set,
+// accepting those an ordinary terminal client accepts.
+type negotiator struct {
+	full bool
+	log  *TelnetLog
+
+	// answered holds the requests that were already answered, so that a
+	// repeated request does not start a negotiation loop.
+	answered map[[2]byte]bool
+
+	// sequence is the server's requests in the order received.
+	sequence []string
+
+	// pending is an incomplete command at the end of the last read.
+	pending []byte
+
+	// goAhead is true once the server sent a go ahead.
+	goAhead bool
+
+	err error
+}
+
+func newNegotiator(logStruct *TelnetLog, full bool) *negotiator {
+	return &negotiator{full: full, log: logStruct, answered: make(map[[2]byte]bool)}
+}
+
+// process strips the telnet commands from buf and returns the remaining
+// data and the replies to send.
+func (n *negotiator) process(buf []byte) (data, reply []byte) {
+	buf = append(n.pending, buf...)
+	n.pending = nil
+	for i := 0; i < len(buf); {
+		if buf[i] != IAC {
+			data = append(data, buf[i])
+			i++
+			continue
+		}
+		if i+1 == len(buf) {
+			n.pending = buf[i:]
+			break
+		}
+		switch cmd := buf[i+1]; {
+		case cmd == IAC:
+			data = append(data, IAC)
+			i += 2
+		case cmd >= WILL:
+			if i+2 == len(buf) {
+				n.pending = buf[i:]
+				return data, reply
+			}
+			reply = append(reply, n.negotiate(cmd, buf[i+2])...)
+			i += IAC_CMD_LENGTH
+		case cmd == SB:
+			end := strings.Index(string(buf[i+2:]), string([]byte{IAC, SE}))
+			if end == -1 {
+				if len(buf)-i > maxSubnegotiationLength {
+					n.err = errors.New("Unterminated telnet subnegotiation")
+				} else {
+					n.pending = buf[i:]
+				}
+				return data, reply
+			}
+			reply = append(reply, n.subnegotiate(buf[i+2:i+2+end])...)
+			i += 2 + end + 2
+		default:
+			if cmd == GO_AHEAD {
+				n.goAhead = true
+			}
+			i += 2
+		}
+	}
+	return data, reply
+}
+
+// negotiate records a WILL, WONT, DO or DONT request and returns the reply.
+func (n *negotiator) negotiate(cmd, option byte) []byte {
+	opt := TelnetOption(option)
+	switch cmd {
+	case WILL:
+		n.log.Will = append(n.log.Will, opt)
+		n.sequence = append(n.sequence, fmt.Sprintf("will:%d", option))
+	case DO:
+		n.log.Do = append(n.log.Do, opt)
+		n.sequence = append(n.sequence, fmt.Sprintf("do:%d", option))
+	case WONT:
+		n.log.Wont = append(n.log.Wont, opt)
+		n.sequence = append(n.sequence, fmt.Sprintf("wont:%d", option))
+	case DONT:
+		n.log.Dont = append(n.log.Dont, opt)
+		n.sequence = append(n.sequence, fmt.Sprintf("dont:%d", option))
+	}
+	key := [2]byte{cmd, option}
+	if n.answered[key] {
+		return nil
+	}
+	n.answered[key] = true
+	switch cmd {
+	case WILL:
+		if n.full && (option == optBinary || option == optEcho || option == optSuppressGA) {
+			return []byte{IAC, DO, option}
+		}
+		return []byte{IAC, DONT, option}
+	case DO:
+		if n.full && (option == optBinary || option == optSuppressGA || option == optTerminalType) {
+			return []byte{IAC, WILL, option}
+		}
+		if n.full && option == optWindowSize {
+			// Report an 80x24 window right away (RFC 1073).
+			return []byte{IAC, WILL, option, IAC, SB, option, 0, 80, 0, 24, IAC, SE}
+		}
+		return []byte{IAC, WONT, option}
+	case WONT:
+		return []byte{IAC, DONT, option}
+	default:
+		return []byte{IAC, WONT, option}
+	}
+}
+
+// subnegotiate records a subnegotiation and returns the reply, if any.
+func (n *negotiator) subnegotiate(sub []byte) []byte {
+	if len(sub) == 0 {
+		return nil
+	}
+	n.log.Subnegotiations = append(n.log.Subnegotiations, TelnetOption(sub[0]))
+	n.sequence = append(n.sequence, fmt.Sprintf("sb:%d", sub[0]))
+	if n.full && sub[0] == optTerminalType && len(sub) > 1 && sub[1] == 1 {
+		// IAC SB TERMINAL-TYPE IS ... IAC SE
+		reply := []byte{IAC, SB, optTerminalType, 0}
+		reply = append(reply, terminalType...)
+		return append(reply, IAC, SE)
+	}
+	return nil
+}
+
+// fingerprint returns the server's requests in the order received, e.g.
+// "do:24,do:32,will:1,will:3".
+func (n *negotiator) fingerprint() string {
+	return strings.Join(n.sequence, ",")
+}
@@ -5,10 +5,14 @@
 // that will be read for the banner.
 //
 // The scan negotiates the options and attempts to grab the banner, using the
-// same behavior as the original zgrab.
+// same behavior as the original zgrab. By default all options are refused;
+// the --negotiate flag accepts the options an ordinary terminal client
+// accepts (echo, suppress go ahead, terminal type, window size), which some
+// devices require before showing the login prompt.
 //
 // The output contains the banner and the negotiated options, in the same
-// format as the original zgrab.
+// format as the original zgrab, the order of the server's option requests as
+// a fingerprint, and a classification of the login prompt.
 package telnet
 
 import (
@@ -22,6 +26,7 @@ type Flags struct {
 	zgrab2.BaseFlags
 	MaxReadSize int  `long:"max-read-size" description:"Set the maximum number of bytes to read when grabbing the banner" default:"65536"`
 	Verbose     bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	Negotiate   bool `long:"negotiate" description:"Accept the options a terminal client accepts instead of refusing all of them"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -52,6 +57,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(TelnetLog)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Fetch a telnet banner"
@@ -104,7 +114,7 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	}
 	defer conn.Close()
 	result := new(TelnetLog)
-	if err := GetTelnetBanner(result, conn, scanner.config.MaxReadSize); err != nil {
+	if err := getTelnetBanner(result, conn, scanner.config.MaxReadSize, newNegotiator(result, scanner.config.Negotiate)); err != nil {
 		return zgrab2.TryGetScanStatus(err), result.getResult(), err
 	}
 	return zgrab2.SCAN_SUCCESS, result, nil
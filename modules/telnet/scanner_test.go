@@ -0,0 +1,156 @@
+package telnet
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// serveTelnet accepts one connection of a server that asks for the
+// terminal type and window size, offers to echo, and only sends its banner
+// once it has asked for the terminal type if the client agreed to send it.
+// The client's replies are sent to replies.
+func serveTelnet(t *testing.T, banner string, replies chan<- []byte) uint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte{IAC, DO, optTerminalType, IAC, DO, optWindowSize, IAC, WILL, optEcho, IAC, WILL, optSuppressGA})
+		buf := make([]byte, 1024)
+		n, err := io.ReadAtLeast(conn, buf, 12)
+		if err != nil {
+			return
+		}
+		reply := append([]byte(nil), buf[:n]...)
+		if bytes.Contains(reply, []byte{IAC, WILL, optTerminalType}) {
+			conn.Write([]byte{IAC, SB, optTerminalType, 1, IAC, SE})
+			n, err = io.ReadAtLeast(conn, buf, 4+len(terminalType)+2)
+			if err != nil {
+				return
+			}
+			reply = append(reply, buf[:n]...)
+		}
+		replies <- reply
+		conn.Write([]byte(banner))
+		time.Sleep(100 * time.Millisecond)
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestNegotiate(t *testing.T) {
+	banner := "\r\n\r\nUser Access Verification\r\n\r\nUsername: "
+	for _, negotiate := range []bool{false, true} {
+		replies := make(chan []byte, 1)
+		var scanner Scanner
+		flags := &Flags{
+			BaseFlags:   zgrab2.BaseFlags{Port: serveTelnet(t, banner, replies), Timeout: 5 * time.Second},
+			MaxReadSize: 65536,
+			Negotiate:   negotiate,
+		}
+		scanner.Init(flags)
+		status, result, err := scanner.Scan(zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+		if status != zgrab2.SCAN_SUCCESS || err != nil {
+			t.Fatalf("scan failed: %s %v", status, err)
+		}
+		log := result.(*TelnetLog)
+		if log.Banner != banner {
+			t.Errorf("unexpected banner %q", log.Banner)
+		}
+		expected := &LoginPrompt{Vendor: "Cisco", Prompt: PromptUsername, PromptLine: "Username:"}
+		if !reflect.DeepEqual(log.LoginPrompt, expected) {
+			t.Errorf("unexpected login prompt %+v", log.LoginPrompt)
+		}
+		reply := <-replies
+		if !negotiate {
+			if log.OptionFingerprint != "do:24,do:31,will:1,will:3" {
+				t.Errorf("unexpected fingerprint %s", log.OptionFingerprint)
+			}
+			if !bytes.Equal(reply, []byte{IAC, WONT, 24, IAC, WONT, 31, IAC, DONT, 1, IAC, DONT, 3}) {
+				t.Errorf("unexpected reply %v", reply)
+			}
+			continue
+		}
+		if log.OptionFingerprint != "do:24,do:31,will:1,will:3,sb:24" {
+			t.Errorf("unexpected fingerprint %s", log.OptionFingerprint)
+		}
+		expectedReply := []byte{IAC, WILL, 24, IAC, WILL, 31, IAC, SB, 31, 0, 80, 0, 24, IAC, SE, IAC, DO, 1, IAC, DO, 3}
+		expectedReply = append(expectedReply, IAC, SB, 24, 0, 'V', 'T', '1', '0', '0', IAC, SE)
+		if !bytes.Equal(reply, expectedReply) {
+			t.Errorf("unexpected reply %v", reply)
+		}
+	}
+}
+
+func TestClassifyBanner(t *testing.T) {
+	for banner, expected := range map[string]*LoginPrompt{
+		"\r\nLogin authentication\r\n\r\n\r\nUsername:":          {Vendor: "Huawei", Prompt: PromptUsername, PromptLine: "Username:"},
+		"\r\n\r\nMikroTik v6.49.7 (stable)\r\nLogin: ":           {Vendor: "MikroTik", Prompt: PromptUsername, PromptLine: "Login:"},
+		"\r\n\r\nBusyBox v1.22.1 built-in shell (ash)\r\n\r\n# ": {Vendor: "BusyBox", Prompt: PromptShell, PromptLine: "#"},
+		"Ubuntu 22.04 LTS\r\nhost login: foo\r\nPassword: ":      {Prompt: PromptPassword, PromptLine: "Password:"},
+		"\r\n": nil,
+	} {
+		if prompt := classifyBanner(banner); !reflect.DeepEqual(prompt, expected) {
+			t.Errorf("classifyBanner(%q) = %+v", banner, prompt)
+		}
+	}
+}
+
+// timeoutError is a net.Error timeout other than zgrab2.ErrTotalTimeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// scriptedConn returns its reads in turn, the last one with err.
+type scriptedConn struct {
+	net.Conn
+	reads [][]byte
+	err   error
+}
+
+func (c *scriptedConn) Read(b []byte) (int, error) {
+	if len(c.reads) == 0 {
+		return 0, c.err
+	}
+	n := copy(b, c.reads[0])
+	c.reads = c.reads[1:]
+	if len(c.reads) == 0 {
+		return n, c.err
+	}
+	return n, nil
+}
+
+func (c *scriptedConn) Write(b []byte) (int, error)     { return len(b), nil }
+func (c *scriptedConn) SetReadDeadline(time.Time) error { return nil }
+
+func TestTruncatedByTimeout(t *testing.T) {
+	for _, err := range []error{timeoutError{}, zgrab2.ErrTotalTimeout, io.EOF} {
+		conn := &scriptedConn{
+			reads: [][]byte{{IAC, WILL, optEcho}, []byte("\r\n"), []byte("Username: ")},
+			err:   err,
+		}
+		var log TelnetLog
+		if err := GetTelnetBanner(&log, conn, 65536); err != nil {
+			t.Fatalf("%v: %v", conn.err, err)
+		}
+		if want := err != io.EOF; log.TruncatedByTimeout != want {
+			t.Errorf("%v: got truncated_by_timeout %v, expected %v", err, log.TruncatedByTimeout, want)
+		}
+		if log.Banner != "\r\nUsername: " {
+			t.Errorf("%v: got banner %q", err, log.Banner)
+		}
+	}
+}
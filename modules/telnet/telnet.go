@@ -18,7 +18,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net"
 	"time"
@@ -43,9 +42,15 @@ const (
 	// WILL means these options will be used.
 	WILL = byte(0xfb)
 
+	// SB marks the beginning of a subnegotiation.
+	SB = byte(0xfa)
+
 	// GO_AHEAD is the special go ahead command.
 	GO_AHEAD = byte(0xf9)
 
+	// SE marks the end of a subnegotiation.
+	SE = byte(0xf0)
+
 	// IAC_CMD_LENGTH gives the length of the special IAC command (inclusive).
 	IAC_CMD_LENGTH = 3
 
@@ -93,9 +98,13 @@ func (opt *TelnetOption) UnmarshalJSON(b []byte) error {
 }
 
 // GetTelnetBanner attempts to negotiate the options and fetch the telnet banner over the given connection, reading at
-// most maxReadSize bytes.
+// most maxReadSize bytes. All options offered by the server are refused.
 func GetTelnetBanner(logStruct *TelnetLog, conn net.Conn, maxReadSize int) (err error) {
-	if err = NegotiateOptions(logStruct, conn); err != nil {
+	return getTelnetBanner(logStruct, conn, maxReadSize, newNegotiator(logStruct, false))
+}
+
+func getTelnetBanner(logStruct *TelnetLog, conn net.Conn, maxReadSize int, n *negotiator) (err error) {
+	if err = negotiateOptions(logStruct, conn, n); err != nil {
 		return err
 	}
 	// Keep reading until READ_BUFFER_LENGTH chunks until
@@ -104,13 +113,24 @@ func GetTelnetBanner(logStruct *TelnetLog, conn net.Conn, maxReadSize int) (err
 	//  (c) the banner is maxReadSize bytes long [taking into account the fact that logStruct.Banner may already have some data from NegotiateOptions]
 	bannerSlice, err := zgrab2.ReadAvailableWithOptions(conn, READ_BUFFER_LENGTH, 500*time.Millisecond, 0, maxReadSize-len(logStruct.Banner))
 	if bannerSlice != nil {
-		// If there is an IAC embedded in the "banner", ignore bytes from that point on.
-		if iacIndex := getIACIndex(bannerSlice); iacIndex != -1 {
+		if n.full {
+			// Servers that were sent a window size or terminal type often
+			// negotiate further options before the login prompt; answer
+			// them and keep the data around them.
+			data, reply := n.process(bannerSlice)
+			if len(reply) > 0 {
+				conn.Write(reply)
+			}
+			bannerSlice = data
+		} else if iacIndex := getIACIndex(bannerSlice); iacIndex != -1 {
+			// If there is an IAC embedded in the "banner", ignore bytes from that point on.
 			bannerSlice = bannerSlice[0:iacIndex]
 		}
 		// append to any data we already read during NegotiateOptions
 		logStruct.Banner += string(bannerSlice)
 	}
+	logStruct.OptionFingerprint = n.fingerprint()
+	logStruct.TruncatedByTimeout = zgrab2.TruncatedByTimeout(len(bannerSlice), err)
 	// Timeouts on the first read are feasible, since the banner may have been read during the negotiation, so ignore them.
 	if err != nil && err != io.EOF && !zgrab2.IsTimeoutError(err) {
 		return err
@@ -119,89 +139,42 @@ func GetTelnetBanner(logStruct *TelnetLog, conn net.Conn, maxReadSize int) (err
 	if !logStruct.isTelnet() {
 		return zgrab2.NewScanError(zgrab2.SCAN_PROTOCOL_ERROR, errors.New("Invalid response for Telnet"))
 	}
+	logStruct.LoginPrompt = classifyBanner(logStruct.Banner)
 	return nil
 }
 
-// NegotiateOptions attempts to negotiate the connection options over the given connection.
+// NegotiateOptions attempts to negotiate the connection options over the given connection, refusing all options
+// offered by the server.
 func NegotiateOptions(logStruct *TelnetLog, conn net.Conn) error {
-	var readBuffer, retBuffer []byte
-	var option, optionType, returnOptionType byte
-	var iacIndex, firstUnreadIndex, numBytes, numDataBytes int
-	var err error
-
-	for finishedNegotiating := false; finishedNegotiating == false; {
-		readBuffer = make([]byte, READ_BUFFER_LENGTH)
-		retBuffer = nil
-		numBytes, err = conn.Read(readBuffer)
-		numDataBytes = numBytes
+	return negotiateOptions(logStruct, conn, newNegotiator(logStruct, false))
+}
 
+// negotiateOptions reads and answers option negotiations until the server sends data or a go ahead.
+func negotiateOptions(logStruct *TelnetLog, conn net.Conn, n *negotiator) error {
+	readBuffer := make([]byte, READ_BUFFER_LENGTH)
+	for {
+		numBytes, err := conn.Read(readBuffer)
 		if err != nil {
 			return err
 		}
-
 		if numBytes == len(readBuffer) {
 			return errors.New("Not enough buffer space for telnet options")
 		}
-
-		// Negotiate options
-
-		for iacIndex = getIACIndex(readBuffer); iacIndex != -1; iacIndex = getIACIndex(readBuffer) {
-			firstUnreadIndex = 0
-			optionType = readBuffer[iacIndex+1]
-			option = readBuffer[iacIndex+2]
-
-			// ignore go ahead
-			if optionType == GO_AHEAD {
-				readBuffer = readBuffer[0:iacIndex]
-				numBytes = iacIndex
-				firstUnreadIndex = 0
-				break
-			}
-
-			// record all offered options
-			opt := TelnetOption(option)
-			if optionType == WILL {
-				logStruct.Will = append(logStruct.Will, opt)
-			} else if optionType == DO {
-				logStruct.Do = append(logStruct.Do, opt)
-			} else if optionType == WONT {
-				logStruct.Wont = append(logStruct.Wont, opt)
-			} else if optionType == DONT {
-				logStruct.Dont = append(logStruct.Dont, opt)
-			}
-
-			// reject all offered options
-			if optionType == WILL || optionType == WONT {
-				returnOptionType = DONT
-			} else if optionType == DO || optionType == DONT {
-				returnOptionType = WONT
-			} else {
-				return errors.New("Unsupported telnet IAC option type" + fmt.Sprintf("%d", optionType))
+		data, reply := n.process(readBuffer[:numBytes])
+		if n.err != nil {
+			return n.err
+		}
+		if len(reply) > 0 {
+			if _, err = conn.Write(reply); err != nil {
+				return err
 			}
-
-			retBuffer = append(retBuffer, IAC)
-			retBuffer = append(retBuffer, returnOptionType)
-			retBuffer = append(retBuffer, option)
-
-			firstUnreadIndex = iacIndex + IAC_CMD_LENGTH
-			numDataBytes -= firstUnreadIndex
-			readBuffer = readBuffer[firstUnreadIndex:]
 		}
-
-		if _, err = conn.Write(retBuffer); err != nil {
-			return err
+		if len(data) > 0 || n.goAhead {
+			// no more IAC commands, just read the resulting data
+			logStruct.Banner = string(data)
+			return nil
 		}
-
-		numIACBytes := numBytes - numDataBytes
-		finishedNegotiating = numBytes != numIACBytes
-	}
-
-	// no more IAC commands, just read the resulting data
-	if numDataBytes >= 0 {
-		logStruct.Banner = string(readBuffer[0:numDataBytes])
 	}
-
-	return nil
 }
 
 func getIACIndex(buffer []byte) int {
@@ -1,26 +1,52 @@
 package modules
 
 import (
-	"encoding/hex"
 	"github.com/Positive-Engineer/zgrab2"
 	log "github.com/sirupsen/logrus"
-	"strconv"
+	"strings"
 )
 
 type TLSFlags struct {
 	zgrab2.BaseFlags
 	zgrab2.TLSFlags
-	FilterFingerprintMD5    string `long:"filter-md5" description:"filter results with fingerprint md5."`
-	FilterFingerprintSHA1   string `long:"filter-sha1" description:"filter results with fingerprint sha1."`
-	FilterFingerprintSHA256 string `long:"filter-sha256" description:"filter results with fingerprint sha256."`
-	FilterFingerprintSerial string `long:"filter-serialnumber" description:"filter results with fingerprint serial number in dec."`
+	FilterFingerprintFile   string `long:"filter-fingerprint-file" description:"Only output results whose certificate chain matches a fingerprint in this file (MD5, SHA-1 or SHA-256 in hex, one per line)"`
+	FilterFingerprintSerial string `long:"filter-serialnumber" description:"Only output results whose certificate chain has one of these comma-separated serial numbers (decimal digits, or hex with 0x prefix or colon-separated bytes)"`
+	FilterSerialFile        string `long:"filter-serialnumber-file" description:"File of certificate serial numbers for --filter-serialnumber, one per line"`
+	PQProbe                 bool   `long:"pq-probe" description:"After the handshake, check whether the server negotiates a post-quantum hybrid key exchange group in TLS 1.3"`
+	PQGroups                string `long:"pq-groups" default:"X25519MLKEM768,X25519Kyber768Draft00,SecP256r1MLKEM768,x25519,secp256r1,secp384r1" description:"Comma-separated list of groups (names or hex values) to offer with --pq-probe, in order of preference"`
+	TestResumption          bool   `long:"test-resumption" description:"After the handshake, check whether the server resumes sessions by session ID, session ticket and TLS 1.3 PSK"`
+	ALPNMatrix              bool   `long:"alpn-matrix" description:"After the handshake, repeat it offering each of --alpn-protocols in turn and report which ones the server selects"`
+	ALPNProtocols           string `long:"alpn-protocols" default:"h2,http/1.1,h3,acme-tls/1,imap,xmpp-client" description:"Comma-separated list of ALPN protocols to try with --alpn-matrix"`
+	Tolerance               bool   `long:"tolerance" description:"After the handshake, send ClientHellos with GREASE values (RFC 8701), unknown extensions and large sizes, and report which ones the server or a middlebox rejects"`
+	EarlyData               bool   `long:"early-data" description:"Research: check whether the server accepts TLS 1.3 0-RTT early data (a HEAD request) with a resumption ticket, and whether it accepts a replay of it"`
+	ExportKeyingMaterial    bool   `long:"export-keying-material" description:"Research: export keying material (RFC 5705 / RFC 8446) from an additional handshake"`
+	EKMLabel                string `long:"ekm-label" default:"EXPERIMENTAL-zgrab2" description:"Exporter label for --export-keying-material"`
+	EKMContext              string `long:"ekm-context" description:"Exporter context for --export-keying-material (empty means no context)"`
+	EKMLength               int    `long:"ekm-length" default:"32" description:"Number of bytes to export with --export-keying-material"`
 }
 
 type TLSModule struct {
 }
 
 type TLSScanner struct {
-	config *TLSFlags
+	config        *TLSFlags
+	pqGroups      []uint16
+	alpnProtocols []string
+	fingerprints  fingerprintSet
+	serials       serialSet
+}
+
+// TLSResults is the output of the tls module: the handshake log, plus the
+// results of any additional probes.
+type TLSResults struct {
+	*zgrab2.TLSLog
+	Hostname       *HostnameVerification `json:"hostname_verification,omitempty"`
+	PostQuantum    *PostQuantumResult    `json:"post_quantum,omitempty"`
+	Resumption     *ResumptionResult     `json:"resumption,omitempty"`
+	ALPN           *ALPNMatrixResult     `json:"alpn_matrix,omitempty"`
+	Tolerance      *ToleranceResult      `json:"tolerance,omitempty"`
+	EarlyData      *EarlyDataResult      `json:"early_data,omitempty"`
+	KeyingMaterial *KeyingMaterial       `json:"keying_material,omitempty"`
 }
 
 func init() {
@@ -39,12 +65,25 @@ func (m *TLSModule) NewScanner() zgrab2.Scanner {
 	return new(TLSScanner)
 }
 
+// NewResult returns a new value of the type of the scan results.
+func (m *TLSModule) NewResult() interface{} {
+	return new(TLSResults)
+}
+
 // Description returns an overview of this module.
 func (m *TLSModule) Description() string {
 	return "Perform a TLS handshake"
 }
 
 func (f *TLSFlags) Validate(args []string) error {
+	if f.ExportKeyingMaterial && f.EKMLength <= 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	if f.PQProbe {
+		if _, err := parseTLSGroups(f.PQGroups); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -58,6 +97,35 @@ func (s *TLSScanner) Init(flags zgrab2.ScanFlags) error {
 		return zgrab2.ErrMismatchedFlags
 	}
 	s.config = f
+	if f.PQProbe {
+		groups, err := parseTLSGroups(f.PQGroups)
+		if err != nil {
+			log.Fatalf("invalid --pq-groups: %s", err)
+		}
+		s.pqGroups = groups
+	}
+	if f.FilterFingerprintFile != "" {
+		fingerprints, err := loadFingerprintFile(f.FilterFingerprintFile)
+		if err != nil {
+			log.Fatalf("invalid --filter-fingerprint-file: %s", err)
+		}
+		log.Infof("Loaded %d certificate fingerprints from %s", len(fingerprints), f.FilterFingerprintFile)
+		s.fingerprints = fingerprints
+	}
+	if f.FilterFingerprintSerial != "" || f.FilterSerialFile != "" {
+		serials, err := loadSerials(f.FilterFingerprintSerial, f.FilterSerialFile)
+		if err != nil {
+			log.Fatalf("invalid --filter-serialnumber: %s", err)
+		}
+		s.serials = serials
+	}
+	if f.ALPNMatrix {
+		for _, proto := range strings.Split(f.ALPNProtocols, ",") {
+			if proto = strings.TrimSpace(proto); proto != "" {
+				s.alpnProtocols = append(s.alpnProtocols, proto)
+			}
+		}
+	}
 	return nil
 }
 
@@ -96,77 +164,51 @@ func (s *TLSScanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{},
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	LogDataTLS := conn.GetLog()
+	t.Context.RecordTLS(conn)
+	result := &TLSResults{TLSLog: LogDataTLS}
+	result.Hostname = verifyHostnames(LogDataTLS.HandshakeLog, LogDataTLS.ServerCertificates(), t.Domain, t.IP)
+	if s.config.PQProbe {
+		result.PostQuantum = s.probePostQuantum(&t)
+	}
+	if s.config.TestResumption {
+		result.Resumption = s.testResumption(&t, LogDataTLS)
+	}
+	if s.config.ALPNMatrix {
+		result.ALPN = s.probeALPNMatrix(&t)
+	}
+	if s.config.Tolerance {
+		result.Tolerance = s.probeTolerance(&t)
+	}
+	if s.config.EarlyData {
+		result.EarlyData = s.probeEarlyData(&t)
+	}
+	if s.config.ExportKeyingMaterial {
+		result.KeyingMaterial = s.exportKeyingMaterial(&t)
+	}
+	certs := LogDataTLS.ServerCertificates()
 	switch {
-	case len(s.config.FilterFingerprintMD5) > 0:
-		_cert_md5 := LogDataTLS.HandshakeLog.ServerCertificates.Certificate.Parsed.FingerprintMD5
-		cert_md5 := hex.EncodeToString(_cert_md5[:])
-		filter_md5 := s.config.FilterFingerprintMD5
-		if cert_md5 == filter_md5 {
-			return zgrab2.SCAN_SUCCESS, LogDataTLS, nil
-		}
-		if LogDataTLS.HandshakeLog.ServerCertificates.Chain != nil {
-			for _, value := range LogDataTLS.HandshakeLog.ServerCertificates.Chain {
-				_cert_md5 := value.Parsed.FingerprintMD5
-				cert_md5 := hex.EncodeToString(_cert_md5[:])
-				if cert_md5 == filter_md5 {
-					return zgrab2.SCAN_SUCCESS, LogDataTLS, nil
-				}
-			}
+	case s.fingerprints != nil:
+		if s.fingerprints.contains(certs) {
+			return zgrab2.SCAN_SUCCESS, result, nil
 		}
 		return zgrab2.SCAN_SUCCESS_NOTCONTAIN, nil, nil
-	case len(s.config.FilterFingerprintSHA1) > 0:
-		_cert_sha1 := LogDataTLS.HandshakeLog.ServerCertificates.Certificate.Parsed.FingerprintSHA1
-		cert_sha1 := hex.EncodeToString(_cert_sha1[:])
-		filter_sha1 := s.config.FilterFingerprintSHA1
-		if cert_sha1 == filter_sha1 {
-			return zgrab2.SCAN_SUCCESS, LogDataTLS, nil
-		}
-		if LogDataTLS.HandshakeLog.ServerCertificates.Chain != nil {
-			for _, value := range LogDataTLS.HandshakeLog.ServerCertificates.Chain {
-				_cert_sha1 := value.Parsed.FingerprintSHA1
-				cert_sha1 := hex.EncodeToString(_cert_sha1[:])
-				if cert_sha1 == filter_sha1 {
-					return zgrab2.SCAN_SUCCESS, LogDataTLS, nil
-				}
-			}
-		}
-		return zgrab2.SCAN_SUCCESS_NOTCONTAIN, nil, nil
-	case len(s.config.FilterFingerprintSHA256) > 0:
-		_cert_sha256 := LogDataTLS.HandshakeLog.ServerCertificates.Certificate.Parsed.FingerprintSHA256
-		cert_sha256 := hex.EncodeToString(_cert_sha256[:])
-		filter_sha256 := s.config.FilterFingerprintSHA256
-		if cert_sha256 == filter_sha256 {
-			return zgrab2.SCAN_SUCCESS, LogDataTLS, nil
-		}
-		if LogDataTLS.HandshakeLog.ServerCertificates.Chain != nil {
-			for _, value := range LogDataTLS.HandshakeLog.ServerCertificates.Chain {
-				_cert_sha256 := value.Parsed.FingerprintSHA256
-				cert_sha256 := hex.EncodeToString(_cert_sha256[:])
-				if cert_sha256 == filter_sha256 {
-					return zgrab2.SCAN_SUCCESS, LogDataTLS, nil
-				}
-			}
-		}
-		return zgrab2.SCAN_SUCCESS_NOTCONTAIN, nil, nil
-	case len(s.config.FilterFingerprintSerial) > 0:
-		_cert_serial := LogDataTLS.HandshakeLog.ServerCertificates.Certificate.Parsed.SerialNumber.Uint64()
-		cert_serial := strconv.FormatUint(_cert_serial, 10)
-		filter_serialnumber := s.config.FilterFingerprintSerial
-		if filter_serialnumber == cert_serial {
-			return zgrab2.SCAN_SUCCESS, LogDataTLS, nil
-		}
-		if LogDataTLS.HandshakeLog.ServerCertificates.Chain != nil {
-			for _, value := range LogDataTLS.HandshakeLog.ServerCertificates.Chain {
-				_cert_serial := value.Parsed.SerialNumber.Uint64()
-				cert_serial := strconv.FormatUint(_cert_serial, 10)
-				if filter_serialnumber == cert_serial {
-					return zgrab2.SCAN_SUCCESS, LogDataTLS, nil
-				}
-			}
+	case s.serials != nil:
+		if s.serials.contains(certs) {
+			return zgrab2.SCAN_SUCCESS, result, nil
 		}
 		return zgrab2.SCAN_SUCCESS_NOTCONTAIN, nil, nil
 	}
-	return zgrab2.SCAN_SUCCESS, LogDataTLS, nil
+	return zgrab2.SCAN_SUCCESS, result, nil
+}
+
+// Preview implements zgrab2.ScannerPreview: the scan sends the ClientHello
+// of the flags.
+func (s *TLSScanner) Preview(t zgrab2.ScanTarget) ([]*zgrab2.ProbePreview, error) {
+	hello, err := s.config.TLSFlags.PreviewClientHello(&t)
+	if err != nil {
+		return nil, err
+	}
+	return []*zgrab2.ProbePreview{hello}, nil
 }
 
 // Protocol returns the protocol identifer for the scanner.
@@ -0,0 +1,74 @@
+package modules
+
+import (
+	gotls "crypto/tls"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// ALPNProbe is the result of one handshake in the ALPN matrix.
+type ALPNProbe struct {
+	// Offered is the ALPN list sent in the ClientHello.
+	Offered []string `json:"offered"`
+
+	// Selected is the protocol the server chose, if any.
+	Selected string `json:"selected,omitempty"`
+
+	// Version is the negotiated TLS version.
+	Version uint16 `json:"version,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// ALPNMatrixResult holds the results of --alpn-matrix.
+type ALPNMatrixResult struct {
+	// Probes has one handshake per protocol, each offering only that
+	// protocol.
+	Probes []*ALPNProbe `json:"probes"`
+
+	// Supported lists the protocols the server selected when offered alone.
+	Supported []string `json:"supported,omitempty"`
+
+	// Preferred is the protocol the server selected when offered all of
+	// them at once.
+	Preferred *ALPNProbe `json:"preferred,omitempty"`
+}
+
+// probeALPN performs a handshake offering the given ALPN list.
+func (s *TLSScanner) probeALPN(t *zgrab2.ScanTarget, protocols []string) *ALPNProbe {
+	ret := &ALPNProbe{Offered: protocols}
+	conn, err := t.Open(&s.config.BaseFlags)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	defer conn.Close()
+	cfg := s.stdTLSConfig(t)
+	cfg.NextProtos = protocols
+	tlsConn := gotls.Client(conn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	state := tlsConn.ConnectionState()
+	ret.Selected = state.NegotiatedProtocol
+	ret.Version = state.Version
+	return ret
+}
+
+// probeALPNMatrix offers each of the configured protocols on its own, then
+// all of them together.
+func (s *TLSScanner) probeALPNMatrix(t *zgrab2.ScanTarget) *ALPNMatrixResult {
+	result := new(ALPNMatrixResult)
+	for _, proto := range s.alpnProtocols {
+		probe := s.probeALPN(t, []string{proto})
+		result.Probes = append(result.Probes, probe)
+		if probe.Selected == proto {
+			result.Supported = append(result.Supported, proto)
+		}
+	}
+	if len(s.alpnProtocols) > 1 {
+		result.Preferred = s.probeALPN(t, s.alpnProtocols)
+	}
+	return result
+}
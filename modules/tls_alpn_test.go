@@ -0,0 +1,43 @@
+package modules
+
+import (
+	"crypto/tls"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+func TestProbeALPNMatrix(t *testing.T) {
+	scanner := serveResumption(t, &tls.Config{NextProtos: []string{"h2", "http/1.1"}})
+	scanner.config.ALPNMatrix = true
+	scanner.config.ALPNProtocols = "http/1.1, h2,imap,"
+	if err := scanner.Init(scanner.config); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scanner.alpnProtocols, []string{"http/1.1", "h2", "imap"}) {
+		t.Fatalf("got protocols %q", scanner.alpnProtocols)
+	}
+
+	result := scanner.probeALPNMatrix(&zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if len(result.Probes) != 3 {
+		t.Fatalf("got %d probes", len(result.Probes))
+	}
+	for i, selected := range []string{"http/1.1", "h2", ""} {
+		probe := result.Probes[i]
+		if probe.Selected != selected || !reflect.DeepEqual(probe.Offered, scanner.alpnProtocols[i:i+1]) {
+			t.Errorf("probe %d: offered %q, selected %q", i, probe.Offered, probe.Selected)
+		}
+		if (probe.Error == "") != (selected != "") || (selected != "" && probe.Version != tls.VersionTLS13) {
+			t.Errorf("probe %d: version %x, error %q", i, probe.Version, probe.Error)
+		}
+	}
+	// The server rejects the unsupported protocol, and prefers its own order.
+	if !reflect.DeepEqual(result.Supported, []string{"http/1.1", "h2"}) {
+		t.Errorf("got supported %q", result.Supported)
+	}
+	if result.Preferred == nil || result.Preferred.Selected != "h2" || result.Preferred.Error != "" {
+		t.Errorf("got preferred %+v", result.Preferred)
+	}
+}
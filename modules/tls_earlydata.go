@@ -0,0 +1,289 @@
+package modules
+
+import (
+	gotls "crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+)
+
+// EarlyDataResult is the outcome of the --early-data test.
+type EarlyDataResult struct {
+	// TicketReceived is true if a full TLS 1.3 handshake produced a session
+	// ticket.
+	TicketReceived bool `json:"ticket_received"`
+
+	// MaxEarlyDataSize is the max_early_data_size of the ticket; early data
+	// is only sent if the request fits.
+	MaxEarlyDataSize uint32 `json:"max_early_data_size"`
+
+	// Resumed is true if the server accepted the ticket (PSK) in the 0-RTT
+	// handshake.
+	Resumed bool `json:"resumed"`
+
+	// Accepted is true if the server accepted the early data.
+	Accepted bool `json:"accepted"`
+
+	// ReplayAccepted is true if the server also accepted the same early data
+	// with the same ticket on a second connection, i.e. it has no 0-RTT
+	// anti-replay protection. Only tested if Accepted is true.
+	ReplayAccepted bool `json:"replay_accepted"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// KeyingMaterial is the output of --export-keying-material.
+type KeyingMaterial struct {
+	Version string `json:"version,omitempty"`
+	Label   string `json:"label"`
+	Context string `json:"context,omitempty"`
+
+	// Material is the hex-encoded exported keying material.
+	Material string `json:"material,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// earlyDataTicket is a resumption ticket together with its PSK.
+type earlyDataTicket struct {
+	*rawtls.NewSessionTicket
+	psk      []byte
+	received time.Time
+}
+
+// earlyDataHello returns a TLS 1.3-only ClientHello restricted to what
+// rawtls can complete (TLS_AES_128_GCM_SHA256 with X25519), and the private
+// key for its key share.
+func (s *TLSScanner) earlyDataHello(t *zgrab2.ScanTarget) (*rawtls.ClientHello, []byte) {
+	private, share := rawtls.GenerateX25519()
+	hello := rawtls.NewClientHello(s.rawServerName(t), []uint16{rawtls.GroupX25519}, []rawtls.KeyShare{share})
+	hello.CipherSuites = []uint16{rawtls.CipherSuiteAES128GCMSHA256}
+	hello.Set(rawtls.SupportedVersionsExtension([]uint16{rawtls.VersionTLS13}))
+	hello.Add(rawtls.ALPNExtension([]string{"http/1.1"}))
+	return hello, private
+}
+
+// readServerHello13 reads the ServerHello, checks that it can be handled,
+// adds it to the transcript and moves the key schedule to the handshake
+// secret.
+func readServerHello13(hr *rawtls.HandshakeReader, ks *rawtls.KeySchedule, private []byte) (*rawtls.ServerHello, error) {
+	msgType, body, err := hr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if msgType != rawtls.HandshakeTypeServerHello {
+		return nil, fmt.Errorf("tls: unexpected handshake message type %d", msgType)
+	}
+	sh, err := rawtls.ParseServerHello(body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case sh.HelloRetryRequest:
+		return nil, fmt.Errorf("tls: server sent a HelloRetryRequest")
+	case sh.SelectedVersion != rawtls.VersionTLS13:
+		return nil, fmt.Errorf("tls: server did not negotiate TLS 1.3")
+	case sh.CipherSuite != rawtls.CipherSuiteAES128GCMSHA256:
+		return nil, fmt.Errorf("tls: server selected cipher suite 0x%04x; only TLS_AES_128_GCM_SHA256 is supported", sh.CipherSuite)
+	}
+	shared, err := rawtls.X25519SharedSecret(private, sh.ServerKeyShare())
+	if err != nil {
+		return nil, err
+	}
+	ks.AddMessage(rawtls.HandshakeMessage(msgType, body))
+	ks.Advance(shared)
+	return sh, nil
+}
+
+// earlyDataTicket performs a full TLS 1.3 handshake and waits for the first
+// NewSessionTicket.
+func (s *TLSScanner) earlyDataTicket(t *zgrab2.ScanTarget) (*earlyDataTicket, error) {
+	conn, err := t.Open(&s.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	hello, private := s.earlyDataHello(t)
+	msg := hello.Marshal()
+	ks := rawtls.NewKeySchedule(nil)
+	ks.AddMessage(msg)
+	if _, err := conn.Write(rawtls.WrapRecords(rawtls.RecordTypeHandshake, rawtls.VersionTLS10, msg)); err != nil {
+		return nil, err
+	}
+	hr := rawtls.NewHandshakeReader(conn)
+	if _, err := readServerHello13(hr, ks, private); err != nil {
+		return nil, err
+	}
+	clientSecret := ks.DeriveSecret("c hs traffic")
+	hr.SetProtection(rawtls.NewRecordProtection(ks.DeriveSecret("s hs traffic")))
+	for {
+		msgType, body, err := hr.Next()
+		if err != nil {
+			return nil, err
+		}
+		ks.AddMessage(rawtls.HandshakeMessage(msgType, body))
+		if msgType == rawtls.HandshakeTypeFinished {
+			break
+		}
+	}
+	ks.Advance(nil)
+	serverSecret := ks.DeriveSecret("s ap traffic")
+	finished := rawtls.HandshakeMessage(rawtls.HandshakeTypeFinished, rawtls.FinishedMAC(clientSecret, ks.TranscriptHash()))
+	ks.AddMessage(finished)
+	if _, err := conn.Write(rawtls.NewRecordProtection(clientSecret).Seal(rawtls.RecordTypeHandshake, finished)); err != nil {
+		return nil, err
+	}
+	resumptionSecret := ks.DeriveSecret("res master")
+	hr.SetProtection(rawtls.NewRecordProtection(serverSecret))
+	for {
+		msgType, body, err := hr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if msgType != rawtls.HandshakeTypeNewSessionTicket {
+			continue
+		}
+		ticket, err := rawtls.ParseNewSessionTicket(body)
+		if err != nil {
+			return nil, err
+		}
+		return &earlyDataTicket{
+			NewSessionTicket: ticket,
+			psk:              rawtls.ResumptionPSK(resumptionSecret, ticket.Nonce),
+			received:         time.Now(),
+		}, nil
+	}
+}
+
+// sendEarlyData resumes the ticket and sends request as early data in the
+// same flight as the ClientHello. The server's EncryptedExtensions say
+// whether the early data was accepted; the handshake is not completed.
+func (s *TLSScanner) sendEarlyData(t *zgrab2.ScanTarget, ticket *earlyDataTicket, request []byte) (resumed bool, accepted bool, err error) {
+	conn, err := t.Open(&s.config.BaseFlags)
+	if err != nil {
+		return false, false, err
+	}
+	defer conn.Close()
+	hello, private := s.earlyDataHello(t)
+	hello.Add(rawtls.Extension{Type: rawtls.ExtensionEarlyData})
+	age := uint32(time.Since(ticket.received)/time.Millisecond) + ticket.AgeAdd
+	hello.Add(rawtls.PreSharedKeyExtension(ticket.Ticket, age))
+	ks := rawtls.NewKeySchedule(ticket.psk)
+	msg := hello.Marshal()
+	rawtls.SetBinder(msg, ks.BinderKey())
+	ks.AddMessage(msg)
+	flight := rawtls.WrapRecords(rawtls.RecordTypeHandshake, rawtls.VersionTLS10, msg)
+	flight = append(flight, rawtls.NewRecordProtection(ks.DeriveSecret("c e traffic")).Seal(rawtls.RecordTypeApplicationData, request)...)
+	if _, err := conn.Write(flight); err != nil {
+		return false, false, err
+	}
+	hr := rawtls.NewHandshakeReader(conn)
+	sh, err := readServerHello13(hr, ks, private)
+	if err != nil {
+		return false, false, err
+	}
+	if sh.Extension(rawtls.ExtensionPreSharedKey) == nil {
+		// A full handshake; early data is necessarily rejected.
+		return false, false, nil
+	}
+	resumed = true
+	hr.SetProtection(rawtls.NewRecordProtection(ks.DeriveSecret("s hs traffic")))
+	msgType, body, err := hr.Next()
+	if err != nil {
+		return resumed, false, err
+	}
+	if msgType != rawtls.HandshakeTypeEncryptedExtensions {
+		return resumed, false, fmt.Errorf("tls: unexpected handshake message type %d", msgType)
+	}
+	exts, err := rawtls.ParseEncryptedExtensions(body)
+	if err != nil {
+		return resumed, false, err
+	}
+	for _, ext := range exts {
+		if ext.Type == rawtls.ExtensionEarlyData {
+			accepted = true
+		}
+	}
+	return resumed, accepted, nil
+}
+
+// probeEarlyData obtains a ticket and tries to use it for 0-RTT early data
+// carrying a HEAD request; if the server accepts, the same early data is
+// replayed with the same ticket.
+func (s *TLSScanner) probeEarlyData(t *zgrab2.ScanTarget) *EarlyDataResult {
+	ret := new(EarlyDataResult)
+	ticket, err := s.earlyDataTicket(t)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	ret.TicketReceived = true
+	ret.MaxEarlyDataSize = ticket.MaxEarlyData
+	host := s.rawServerName(t)
+	if host == "" && t.IP != nil {
+		host = t.IP.String()
+	}
+	request := []byte(fmt.Sprintf("HEAD / HTTP/1.1\r\nHost: %s\r\nUser-Agent: zgrab2\r\nConnection: close\r\n\r\n", host))
+	if int(ticket.MaxEarlyData) < len(request) {
+		return ret
+	}
+	if ret.Resumed, ret.Accepted, err = s.sendEarlyData(t, ticket, request); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	if !ret.Accepted {
+		return ret
+	}
+	if _, ret.ReplayAccepted, err = s.sendEarlyData(t, ticket, request); err != nil {
+		ret.Error = err.Error()
+	}
+	return ret
+}
+
+// exportKeyingMaterial performs a separate handshake with the standard
+// library (zcrypto has no exporter) and exports keying material from it.
+func (s *TLSScanner) exportKeyingMaterial(t *zgrab2.ScanTarget) *KeyingMaterial {
+	ret := &KeyingMaterial{Label: s.config.EKMLabel, Context: s.config.EKMContext}
+	conn, err := t.Open(&s.config.BaseFlags)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	tlsConn := gotls.Client(conn, s.stdTLSConfig(t))
+	defer tlsConn.Close()
+	if err := tlsConn.Handshake(); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	state := tlsConn.ConnectionState()
+	ret.Version = tlsVersionName(state.Version)
+	var context []byte
+	if s.config.EKMContext != "" {
+		context = []byte(s.config.EKMContext)
+	}
+	material, err := state.ExportKeyingMaterial(s.config.EKMLabel, context, s.config.EKMLength)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	ret.Material = hex.EncodeToString(material)
+	return ret
+}
+
+// tlsVersionName returns the name of a standard library TLS version.
+func tlsVersionName(version uint16) string {
+	switch version {
+	case gotls.VersionTLS10:
+		return "TLSv1.0"
+	case gotls.VersionTLS11:
+		return "TLSv1.1"
+	case gotls.VersionTLS12:
+		return "TLSv1.2"
+	case gotls.VersionTLS13:
+		return "TLSv1.3"
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
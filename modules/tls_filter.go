@@ -0,0 +1,166 @@
+package modules
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/zmap/zcrypto/tls"
+)
+
+// fingerprintSet is a set of certificate fingerprints (MD5, SHA-1 and
+// SHA-256 mixed), keyed by lowercase hex. The hash type of an entry follows
+// from its length.
+type fingerprintSet map[string]struct{}
+
+// loadFingerprintFile reads a --filter-fingerprint-file: one fingerprint per
+// line, in hex with optional colons. Empty lines and lines starting with #
+// are skipped.
+func loadFingerprintFile(path string) (fingerprintSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	set := make(fingerprintSet)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fp := strings.TrimSpace(scanner.Text())
+		if fp == "" || strings.HasPrefix(fp, "#") {
+			continue
+		}
+		fp = strings.ToLower(strings.Replace(fp, ":", "", -1))
+		if _, err := hex.DecodeString(fp); err != nil {
+			return nil, fmt.Errorf("%s:%d: fingerprint is not hex: %q", path, line, scanner.Text())
+		}
+		switch len(fp) {
+		case 2 * md5.Size, 2 * sha1.Size, 2 * sha256.Size:
+			set[fp] = struct{}{}
+		default:
+			return nil, fmt.Errorf("%s:%d: fingerprint is not an MD5, SHA-1 or SHA-256 hash: %q", path, line, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// contains reports whether any of the certificates (leaf or chain) has one
+// of the fingerprints in the set.
+func (set fingerprintSet) contains(certs *tls.Certificates) bool {
+	if certs == nil {
+		return false
+	}
+	raws := [][]byte{certs.Certificate.Raw}
+	for _, cert := range certs.Chain {
+		raws = append(raws, cert.Raw)
+	}
+	for _, raw := range raws {
+		if len(raw) == 0 {
+			continue
+		}
+		md5sum, sha1sum, sha256sum := md5.Sum(raw), sha1.Sum(raw), sha256.Sum256(raw)
+		for _, sum := range [][]byte{md5sum[:], sha1sum[:], sha256sum[:]} {
+			if _, ok := set[hex.EncodeToString(sum)]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serialSet is a set of certificate serial numbers, keyed by their decimal
+// representation.
+type serialSet map[string]struct{}
+
+// parseSerial parses a certificate serial number. Serials with a 0x prefix
+// or colon-separated bytes are read as hex, and plain digits as decimal.
+func parseSerial(s string) (*big.Int, error) {
+	in := s
+	s = strings.ToLower(strings.TrimSpace(s))
+	base := 10
+	if strings.HasPrefix(s, "0x") {
+		s, base = s[2:], 16
+	} else if strings.Contains(s, ":") {
+		for _, b := range strings.Split(s, ":") {
+			if len(b) == 0 || len(b) > 2 {
+				return nil, fmt.Errorf("invalid serial number %q", in)
+			}
+		}
+		s, base = strings.Replace(s, ":", "", -1), 16
+	}
+	serial, ok := new(big.Int).SetString(s, base)
+	if !ok || s == "" || serial.Sign() < 0 {
+		return nil, fmt.Errorf("invalid serial number %q", in)
+	}
+	return serial, nil
+}
+
+// loadSerials builds the set of serials from the comma-separated list and
+// the file (one serial per line, # comments), either of which may be empty.
+func loadSerials(list string, path string) (serialSet, error) {
+	set := make(serialSet)
+	add := func(s string) error {
+		serial, err := parseSerial(s)
+		if err != nil {
+			return err
+		}
+		set[serial.String()] = struct{}{}
+		return nil
+	}
+	for _, s := range strings.Split(list, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		if err := add(s); err != nil {
+			return nil, err
+		}
+	}
+	if path == "" {
+		return set, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		if err := add(s); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// contains reports whether any of the certificates (leaf or chain) has one
+// of the serials in the set.
+func (set serialSet) contains(certs *tls.Certificates) bool {
+	if certs == nil {
+		return false
+	}
+	all := append([]tls.SimpleCertificate{certs.Certificate}, certs.Chain...)
+	for _, cert := range all {
+		if cert.Parsed == nil || cert.Parsed.SerialNumber == nil {
+			continue
+		}
+		if _, ok := set[cert.Parsed.SerialNumber.String()]; ok {
+			return true
+		}
+	}
+	return false
+}
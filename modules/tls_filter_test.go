@@ -0,0 +1,152 @@
+package modules
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/zmap/zcrypto/tls"
+)
+
+// writeFingerprintFile writes the lines to a temporary file and returns
+// its path.
+func writeFingerprintFile(t *testing.T, lines ...string) string {
+	dir, err := ioutil.TempDir("", "zgrab2-fingerprints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "fingerprints")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFingerprintFile(t *testing.T) {
+	path := writeFingerprintFile(t,
+		"# known certificates",
+		"",
+		"  D4:1D:8C:D9:8F:00:B2:04:E9:80:09:98:EC:F8:42:7E  ",
+		"da39a3ee5e6b4b0d3255bfef95601890afd80709",
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	)
+	set, err := loadFingerprintFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fp := range []string{"d41d8cd98f00b204e9800998ecf8427e", "da39a3ee5e6b4b0d3255bfef95601890afd80709", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"} {
+		if _, ok := set[fp]; !ok {
+			t.Errorf("missing fingerprint %s", fp)
+		}
+	}
+	if len(set) != 3 {
+		t.Errorf("got %d fingerprints", len(set))
+	}
+
+	for _, bad := range []string{"not hex at all", "d41d8cd98f00b204", "d41d8cd98f00b204e9800998ecf8427"} {
+		if _, err := loadFingerprintFile(writeFingerprintFile(t, "# ok", bad)); err == nil || !strings.Contains(err.Error(), ":2:") {
+			t.Errorf("%q: got error %v", bad, err)
+		}
+	}
+	if _, err := loadFingerprintFile(filepath.Join(os.TempDir(), "zgrab2-no-such-file")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestFingerprintSetContains(t *testing.T) {
+	leaf, chain := []byte("leaf certificate"), []byte("intermediate certificate")
+	certs := &tls.Certificates{
+		Certificate: tls.SimpleCertificate{Raw: leaf},
+		Chain:       []tls.SimpleCertificate{{Raw: chain}},
+	}
+	md5sum, sha1sum, sha256sum := md5.Sum(leaf), sha1.Sum(chain), sha256.Sum256(chain)
+	for _, fp := range []string{hex.EncodeToString(md5sum[:]), hex.EncodeToString(sha1sum[:]), hex.EncodeToString(sha256sum[:])} {
+		set := fingerprintSet{fp: {}}
+		if !set.contains(certs) {
+			t.Errorf("%s: no match", fp)
+		}
+		if set.contains(nil) || set.contains(&tls.Certificates{}) {
+			t.Errorf("%s: matched no certificates", fp)
+		}
+	}
+	other := sha256.Sum256([]byte("other certificate"))
+	if (fingerprintSet{hex.EncodeToString(other[:]): {}}).contains(certs) {
+		t.Error("matched an unknown fingerprint")
+	}
+}
+
+func TestScanFilterFingerprintFile(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	sum := sha256.Sum256(server.Certificate().Raw)
+	target := zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")}
+	for _, fp := range []string{hex.EncodeToString(sum[:]), strings.Repeat("00", sha256.Size)} {
+		flags := new(TLSFlags)
+		flags.Port = uint(server.Listener.Addr().(*net.TCPAddr).Port)
+		flags.Timeout = 5 * time.Second
+		flags.FilterFingerprintFile = writeFingerprintFile(t, fp)
+		scanner := new(TLSScanner)
+		if err := scanner.Init(flags); err != nil {
+			t.Fatal(err)
+		}
+		status, result, err := scanner.Scan(target)
+		if err != nil {
+			t.Fatalf("%s: %v", fp, err)
+		}
+		matches := fp == hex.EncodeToString(sum[:])
+		if matches && (status != zgrab2.SCAN_SUCCESS || result == nil) {
+			t.Errorf("%s: got status %s, result %v", fp, status, result)
+		}
+		if !matches && (status != zgrab2.SCAN_SUCCESS_NOTCONTAIN || result != nil) {
+			t.Errorf("%s: got status %s, result %v", fp, status, result)
+		}
+	}
+}
+
+func TestParseSerial(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"1234", "1234"},
+		{"0x4d2", "1234"},
+		{"04:d2", "1234"},
+		{"04:D2", "1234"},
+		{"0X4D2", "1234"},
+		// Digits-only hex needs the 0x prefix or colons.
+		{"0x1234", "4660"},
+		{"12:34", "4660"},
+		{"12345678901234567890123456789", "12345678901234567890123456789"},
+		{"0x0123456789abcdef0123456789abcdef", "1512366075204170929049582354406559215"},
+	}
+	for _, test := range tests {
+		serial, err := parseSerial(test.in)
+		if err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+		if serial.String() != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.in, serial, test.expected)
+		}
+	}
+	for _, in := range []string{"", "0x", "zz", "12.5", "4d2", "-1", "12::34", "123:4"} {
+		if _, err := parseSerial(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package modules
+
+import (
+	"net"
+	"strings"
+
+	"github.com/zmap/zcrypto/tls"
+	"github.com/zmap/zcrypto/x509"
+)
+
+// HostnameMatch reports whether the leaf certificate is valid for a name,
+// following RFC 6125: the subject alternative names are used if there are
+// any, and the subject common name only if there are none.
+type HostnameMatch struct {
+	Name  string `json:"name"`
+	Valid bool   `json:"valid"`
+
+	// MatchType is exact or wildcard.
+	MatchType string `json:"match_type,omitempty"`
+
+	// Source is where the matching name is: san or cn.
+	Source string `json:"source,omitempty"`
+
+	// MatchedName is the certificate name that matched.
+	MatchedName string `json:"matched_name,omitempty"`
+
+	// CommonNameMatch is true if the common name matches although the
+	// certificate has subject alternative names, so that only clients
+	// still falling back to the common name accept it.
+	CommonNameMatch bool `json:"common_name_match,omitempty"`
+}
+
+// HostnameVerification reports whether the leaf certificate is valid for
+// the SNI sent and the input domain (or IP, if there is no domain),
+// independently of chain validation.
+type HostnameVerification struct {
+	SNI    *HostnameMatch `json:"sni,omitempty"`
+	Domain *HostnameMatch `json:"domain,omitempty"`
+	IP     *HostnameMatch `json:"ip,omitempty"`
+}
+
+// normalizeHostname lowercases a hostname and strips its trailing dot.
+func normalizeHostname(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// matchHostnamePattern matches a hostname against a certificate name,
+// returning exact, wildcard or the empty string. A wildcard is only valid
+// as the whole leftmost label, and covers exactly one label.
+func matchHostnamePattern(pattern, host string) string {
+	pattern = normalizeHostname(pattern)
+	if pattern == "" || host == "" {
+		return ""
+	}
+	if pattern == host {
+		return "exact"
+	}
+	if !strings.HasPrefix(pattern, "*.") || strings.Count(pattern, ".") < 2 {
+		return ""
+	}
+	i := strings.IndexByte(host, '.')
+	if i <= 0 || host[i:] != pattern[1:] {
+		return ""
+	}
+	return "wildcard"
+}
+
+// matchHostname checks the certificate against name, which may be an IP
+// address.
+func matchHostname(cert *x509.Certificate, name string) *HostnameMatch {
+	ret := &HostnameMatch{Name: name}
+	host := normalizeHostname(name)
+	if ip := net.ParseIP(host); ip != nil {
+		for _, certIP := range cert.IPAddresses {
+			if certIP.Equal(ip) {
+				ret.Valid, ret.MatchType, ret.Source, ret.MatchedName = true, "exact", "san", certIP.String()
+				return ret
+			}
+		}
+		return ret
+	}
+	for _, san := range cert.DNSNames {
+		if match := matchHostnamePattern(san, host); match != "" {
+			ret.Valid, ret.MatchType, ret.Source, ret.MatchedName = true, match, "san", san
+			return ret
+		}
+	}
+	if match := matchHostnamePattern(cert.Subject.CommonName, host); match != "" {
+		if len(cert.DNSNames) > 0 || len(cert.IPAddresses) > 0 {
+			ret.CommonNameMatch = true
+			return ret
+		}
+		ret.Valid, ret.MatchType, ret.Source, ret.MatchedName = true, match, "cn", cert.Subject.CommonName
+	}
+	return ret
+}
+
+// verifyHostnames checks the leaf certificate against the SNI sent and the
+// input domain or IP. It returns nil if there is no parsed leaf.
+func verifyHostnames(handshake *tls.ServerHandshake, certs *tls.Certificates, domain string, ip net.IP) *HostnameVerification {
+	if certs == nil || certs.Certificate.Parsed == nil {
+		return nil
+	}
+	leaf := certs.Certificate.Parsed
+	ret := new(HostnameVerification)
+	if handshake != nil && handshake.ClientHello != nil && handshake.ClientHello.ServerName != "" {
+		ret.SNI = matchHostname(leaf, handshake.ClientHello.ServerName)
+	}
+	if domain != "" {
+		ret.Domain = matchHostname(leaf, domain)
+	} else if ip != nil {
+		ret.IP = matchHostname(leaf, ip.String())
+	}
+	return ret
+}
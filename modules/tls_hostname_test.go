@@ -0,0 +1,64 @@
+package modules
+
+import (
+	"net"
+	"testing"
+
+	"github.com/zmap/zcrypto/tls"
+	"github.com/zmap/zcrypto/x509"
+	"github.com/zmap/zcrypto/x509/pkix"
+)
+
+func TestMatchHostname(t *testing.T) {
+	san := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "legacy.example.com"},
+		DNSNames:    []string{"example.com", "*.example.com", "*.a.b.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+	}
+	cnOnly := &x509.Certificate{Subject: pkix.Name{CommonName: "*.example.net"}}
+	tests := []struct {
+		cert   *x509.Certificate
+		name   string
+		valid  bool
+		match  string
+		source string
+		cn     bool
+	}{
+		{san, "Example.COM.", true, "exact", "san", false},
+		{san, "www.example.com", true, "wildcard", "san", false},
+		{san, "a.www.example.com", false, "", "", false},
+		{san, "c.a.b.example.com", true, "wildcard", "san", false},
+		{san, "legacy.example.com", true, "wildcard", "san", false},
+		{san, "example.org", false, "", "", false},
+		{san, "192.0.2.1", true, "exact", "san", false},
+		{san, "192.0.2.2", false, "", "", false},
+		{cnOnly, "www.example.net", true, "wildcard", "cn", false},
+		{cnOnly, "example.net", false, "", "", false},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "host.test"}, DNSNames: []string{"other.test"}}, "host.test", false, "", "", true},
+	}
+	for _, test := range tests {
+		ret := matchHostname(test.cert, test.name)
+		if ret.Valid != test.valid || ret.MatchType != test.match || ret.Source != test.source || ret.CommonNameMatch != test.cn {
+			t.Errorf("%s: unexpected %+v", test.name, ret)
+		}
+	}
+	if matchHostnamePattern("*.com", "example.com") != "" || matchHostnamePattern("w*.example.com", "www.example.com") != "" {
+		t.Error("invalid wildcards matched")
+	}
+}
+
+func TestVerifyHostnames(t *testing.T) {
+	certs := &tls.Certificates{Certificate: tls.SimpleCertificate{Parsed: &x509.Certificate{DNSNames: []string{"www.example.com"}}}}
+	handshake := &tls.ServerHandshake{ClientHello: &tls.ClientHello{ServerName: "www.example.com"}}
+	ret := verifyHostnames(handshake, certs, "example.com", net.ParseIP("192.0.2.1"))
+	if ret.SNI == nil || !ret.SNI.Valid || ret.Domain == nil || ret.Domain.Valid || ret.IP != nil {
+		t.Errorf("unexpected %+v", ret)
+	}
+	ret = verifyHostnames(&tls.ServerHandshake{}, certs, "", net.ParseIP("192.0.2.1"))
+	if ret.SNI != nil || ret.Domain != nil || ret.IP == nil || ret.IP.Valid {
+		t.Errorf("unexpected %+v", ret)
+	}
+	if verifyHostnames(handshake, nil, "example.com", nil) != nil {
+		t.Error("expected nil without certificates")
+	}
+}
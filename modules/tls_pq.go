@@ -0,0 +1,125 @@
+package modules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+)
+
+// tlsGroups maps the names accepted by --pq-groups to TLS NamedGroup values.
+var tlsGroups = map[string]uint16{
+	"secp256r1":                0x0017,
+	"secp384r1":                0x0018,
+	"secp521r1":                0x0019,
+	"x25519":                   0x001d,
+	"x448":                     0x001e,
+	"MLKEM512":                 0x0200,
+	"MLKEM768":                 0x0201,
+	"MLKEM1024":                0x0202,
+	"SecP256r1MLKEM768":        0x11eb,
+	"X25519MLKEM768":           0x11ec,
+	"SecP384r1MLKEM1024":       0x11ed,
+	"X25519Kyber768Draft00":    0x6399,
+	"SecP256r1Kyber768Draft00": 0x639a,
+}
+
+// postQuantumGroups are the groups whose key exchange includes a
+// post-quantum KEM.
+var postQuantumGroups = map[uint16]bool{
+	0x0200: true,
+	0x0201: true,
+	0x0202: true,
+	0x11eb: true,
+	0x11ec: true,
+	0x11ed: true,
+	0x6399: true,
+	0x639a: true,
+}
+
+// tlsGroupName returns the name of a NamedGroup, or its hex value if
+// unknown.
+func tlsGroupName(group uint16) string {
+	for name, id := range tlsGroups {
+		if id == group {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", group)
+}
+
+// parseTLSGroups parses a comma-separated list of group names or hex values.
+func parseTLSGroups(list string) ([]uint16, error) {
+	var ret []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if id, ok := tlsGroups[name]; ok {
+			ret = append(ret, id)
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(name, "0x"), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("unknown TLS group %q", name)
+		}
+		ret = append(ret, uint16(id))
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no TLS groups given")
+	}
+	return ret, nil
+}
+
+// PostQuantumResult records which key exchange group the server picks when
+// offered post-quantum hybrid groups.
+type PostQuantumResult struct {
+	OfferedGroups []string `json:"offered_groups"`
+
+	// SelectedGroup is the group the server chose, by name.
+	SelectedGroup   string `json:"selected_group,omitempty"`
+	SelectedGroupID uint16 `json:"selected_group_id,omitempty"`
+
+	// HelloRetryRequest is true if the server named its group in a
+	// HelloRetryRequest (the probe sends no key shares, so a TLS 1.3 server
+	// always has to).
+	HelloRetryRequest bool `json:"hello_retry_request"`
+
+	SelectedVersion uint16 `json:"selected_version,omitempty"`
+
+	// PostQuantum is true if the selected group includes a post-quantum KEM.
+	PostQuantum bool `json:"post_quantum"`
+
+	Alert string `json:"alert,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// probePostQuantum offers the configured groups with no key shares in a
+// TLS 1.3 ClientHello and records the group the server asks for.
+func (s *TLSScanner) probePostQuantum(t *zgrab2.ScanTarget) *PostQuantumResult {
+	result := new(PostQuantumResult)
+	for _, group := range s.pqGroups {
+		result.OfferedGroups = append(result.OfferedGroups, tlsGroupName(group))
+	}
+	hello := rawtls.NewClientHello(s.rawServerName(t), s.pqGroups, nil)
+	serverHello, err := s.sendRawHello(t, hello)
+	if err != nil {
+		if alert, ok := err.(*rawtls.AlertError); ok {
+			result.Alert = rawtls.AlertName(alert.Description)
+		} else {
+			result.Error = err.Error()
+		}
+		return result
+	}
+	result.HelloRetryRequest = serverHello.HelloRetryRequest
+	result.SelectedVersion = serverHello.SelectedVersion
+	if serverHello.SelectedGroup != 0 {
+		result.SelectedGroupID = serverHello.SelectedGroup
+		result.SelectedGroup = tlsGroupName(serverHello.SelectedGroup)
+		result.PostQuantum = postQuantumGroups[serverHello.SelectedGroup]
+	}
+	return result
+}
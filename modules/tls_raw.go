@@ -0,0 +1,44 @@
+package modules
+
+import (
+	gotls "crypto/tls"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+)
+
+// rawServerName returns the SNI value that the main handshake would use, so
+// that the extra probes talk to the same virtual host.
+func (s *TLSScanner) rawServerName(t *zgrab2.ScanTarget) string {
+	if s.config.ServerName != "" {
+		return s.config.ServerName
+	}
+	if s.config.NoSNI {
+		return ""
+	}
+	return t.Domain
+}
+
+// stdTLSConfig returns a configuration for the standard library TLS client,
+// which is used for the probes that need a complete TLS 1.3 handshake.
+func (s *TLSScanner) stdTLSConfig(t *zgrab2.ScanTarget) *gotls.Config {
+	return &gotls.Config{
+		ServerName:         s.rawServerName(t),
+		InsecureSkipVerify: true,
+	}
+}
+
+// sendRawHello opens a new connection to the target, sends the given
+// ClientHello and returns the server's ServerHello. Alerts are returned as
+// *rawtls.AlertError.
+func (s *TLSScanner) sendRawHello(t *zgrab2.ScanTarget, hello *rawtls.ClientHello) (*rawtls.ServerHello, error) {
+	conn, err := t.Open(&s.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(hello.Records()); err != nil {
+		return nil, err
+	}
+	return rawtls.ReadServerHello(conn)
+}
@@ -0,0 +1,167 @@
+package modules
+
+import (
+	"bytes"
+	gotls "crypto/tls"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+	"github.com/zmap/zcrypto/tls"
+)
+
+// ResumptionAttempt is the outcome of one resumption mechanism.
+type ResumptionAttempt struct {
+	// Offered is true if the first handshake gave us something to resume
+	// (a session ID or a ticket).
+	Offered bool `json:"offered"`
+
+	// Resumed is true if the server accepted the abbreviated handshake.
+	Resumed bool `json:"resumed"`
+
+	// LifetimeHint is the ticket lifetime (in seconds) sent by the server.
+	LifetimeHint uint32 `json:"lifetime_hint,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// ResumptionResult reports which session resumption mechanisms the server
+// supports.
+type ResumptionResult struct {
+	// SessionID is TLS 1.2 resumption by session ID, using the ID from the
+	// main handshake.
+	SessionID *ResumptionAttempt `json:"session_id,omitempty"`
+
+	// SessionTicket is TLS 1.2 resumption with an RFC 5077 session ticket.
+	SessionTicket *ResumptionAttempt `json:"session_ticket,omitempty"`
+
+	// TLS13 is TLS 1.3 PSK resumption with a NewSessionTicket ticket. Sending
+	// 0-RTT data is not supported by the TLS stacks available here, so only
+	// plain resumption is measured.
+	TLS13 *ResumptionAttempt `json:"tls13,omitempty"`
+}
+
+// testResumption tries each resumption mechanism on fresh connections.
+func (s *TLSScanner) testResumption(t *zgrab2.ScanTarget, handshake *zgrab2.TLSLog) *ResumptionResult {
+	return &ResumptionResult{
+		SessionID:     s.resumeSessionID(t, handshake),
+		SessionTicket: s.resumeSessionTicket(t),
+		TLS13:         s.resumeTLS13(t),
+	}
+}
+
+// resumeSessionID offers the session ID from the main handshake in a new
+// ClientHello. A server that resumes echoes the ID back in its ServerHello,
+// so there is no need to complete the handshake.
+func (s *TLSScanner) resumeSessionID(t *zgrab2.ScanTarget, handshake *zgrab2.TLSLog) *ResumptionAttempt {
+	ret := new(ResumptionAttempt)
+	serverHello := handshake.HandshakeLog.ServerHello
+	if serverHello == nil || len(serverHello.SessionID) == 0 {
+		return ret
+	}
+	ret.Offered = true
+	hello := &rawtls.ClientHello{
+		Version:      uint16(serverHello.Version),
+		SessionID:    serverHello.SessionID,
+		CipherSuites: []uint16{uint16(serverHello.CipherSuite)},
+	}
+	if name := s.rawServerName(t); name != "" {
+		hello.Add(rawtls.ServerNameExtension(name))
+	}
+	if serverHello.ExtendedMasterSecret {
+		hello.Add(rawtls.Extension{Type: rawtls.ExtensionExtendedMasterSecret})
+	}
+	hello.Add(rawtls.Extension{Type: rawtls.ExtensionRenegotiationInfo, Data: []byte{0}})
+	hello.Add(rawtls.SupportedGroupsExtension([]uint16{0x0017, 0x0018, 0x0019}))
+	hello.Add(rawtls.Extension{Type: rawtls.ExtensionECPointFormats, Data: []byte{1, 0}})
+	hello.Add(rawtls.SignatureAlgorithmsExtension(rawtls.DefaultSignatureAlgorithms))
+	resumed, err := s.sendRawHello(t, hello)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	ret.Resumed = bytes.Equal(resumed.SessionID, serverHello.SessionID)
+	return ret
+}
+
+// resumeSessionTicket performs two full handshakes sharing a session cache,
+// so that the second offers the ticket received in the first.
+func (s *TLSScanner) resumeSessionTicket(t *zgrab2.ScanTarget) *ResumptionAttempt {
+	ret := new(ResumptionAttempt)
+	cfg, err := s.config.TLSFlags.GetTLSConfigForTarget(t)
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	cfg.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	cfg.SessionTicketsDisabled = false
+	for i := 0; i < 2; i++ {
+		conn, err := t.Open(&s.config.BaseFlags)
+		if err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		tlsConn := s.config.TLSFlags.GetWrappedConnection(conn, cfg)
+		err = tlsConn.Handshake()
+		state := tlsConn.ConnectionState()
+		handshakeLog := tlsConn.GetHandshakeLog()
+		tlsConn.Close()
+		if err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		if i == 0 {
+			if handshakeLog.SessionTicket == nil {
+				return ret
+			}
+			ret.Offered = true
+			ret.LifetimeHint = handshakeLog.SessionTicket.LifetimeHint
+			continue
+		}
+		ret.Resumed = state.DidResume
+	}
+	return ret
+}
+
+// resumeTLS13 performs two TLS 1.3 handshakes with the standard library,
+// which (unlike zcrypto) supports TLS 1.3, and checks whether the second
+// resumed the session from the first.
+func (s *TLSScanner) resumeTLS13(t *zgrab2.ScanTarget) *ResumptionAttempt {
+	ret := new(ResumptionAttempt)
+	cfg := s.stdTLSConfig(t)
+	cfg.MinVersion = gotls.VersionTLS13
+	cfg.ClientSessionCache = gotls.NewLRUClientSessionCache(1)
+	cacheKey := cfg.ServerName
+	for i := 0; i < 2; i++ {
+		conn, err := t.Open(&s.config.BaseFlags)
+		if err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+		if cacheKey == "" {
+			cacheKey = conn.RemoteAddr().String()
+		}
+		tlsConn := gotls.Client(conn, cfg)
+		err = tlsConn.Handshake()
+		if err != nil {
+			tlsConn.Close()
+			ret.Error = err.Error()
+			return ret
+		}
+		if i == 0 {
+			// TLS 1.3 tickets are sent after the handshake; a read is needed
+			// to process them.
+			tlsConn.SetReadDeadline(time.Now().Add(time.Second))
+			tlsConn.Read(make([]byte, 1))
+			tlsConn.Close()
+			if _, ok := cfg.ClientSessionCache.Get(cacheKey); !ok {
+				return ret
+			}
+			ret.Offered = true
+			continue
+		}
+		ret.Resumed = tlsConn.ConnectionState().DidResume
+		tlsConn.Close()
+	}
+	return ret
+}
@@ -0,0 +1,65 @@
+package modules
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	ztls "github.com/zmap/zcrypto/tls"
+)
+
+// serveResumption runs a TLS server with the given configuration and returns
+// a scanner of it.
+func serveResumption(t *testing.T, cfg *tls.Config) *TLSScanner {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = cfg
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	flags := new(TLSFlags)
+	flags.Port = uint(server.Listener.Addr().(*net.TCPAddr).Port)
+	flags.Timeout = 5 * time.Second
+	return &TLSScanner{config: flags}
+}
+
+func TestResumeSessionTicket(t *testing.T) {
+	scanner := serveResumption(t, &tls.Config{MaxVersion: tls.VersionTLS12})
+	target := &zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")}
+	if ticket := scanner.resumeSessionTicket(target); !ticket.Offered || !ticket.Resumed || ticket.Error != "" {
+		t.Errorf("got session ticket attempt %+v", ticket)
+	}
+	// A TLS 1.2 server fails the TLS 1.3 attempt, which is not offered.
+	if tls13 := scanner.resumeTLS13(target); tls13.Offered || tls13.Resumed || tls13.Error == "" {
+		t.Errorf("got TLS 1.3 attempt %+v", tls13)
+	}
+
+	// Without a session ID in the ServerHello, there is nothing to resume.
+	handshake := &zgrab2.TLSLog{HandshakeLog: &ztls.ServerHandshake{ServerHello: &ztls.ServerHello{}}}
+	if id := scanner.resumeSessionID(target, handshake); id.Offered || id.Resumed || id.Error != "" {
+		t.Errorf("got session ID attempt %+v", id)
+	}
+
+	scanner = serveResumption(t, &tls.Config{MaxVersion: tls.VersionTLS12, SessionTicketsDisabled: true})
+	if ticket := scanner.resumeSessionTicket(target); ticket.Offered || ticket.Resumed || ticket.Error != "" {
+		t.Errorf("got session ticket attempt %+v without tickets", ticket)
+	}
+}
+
+func TestResumeTLS13(t *testing.T) {
+	scanner := serveResumption(t, &tls.Config{MinVersion: tls.VersionTLS13})
+	target := &zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")}
+	if tls13 := scanner.resumeTLS13(target); !tls13.Offered || !tls13.Resumed || tls13.Error != "" {
+		t.Errorf("got TLS 1.3 attempt %+v", tls13)
+	}
+
+	scanner = serveResumption(t, &tls.Config{MinVersion: tls.VersionTLS13, SessionTicketsDisabled: true})
+	if tls13 := scanner.resumeTLS13(target); tls13.Offered || tls13.Resumed {
+		t.Errorf("got TLS 1.3 attempt %+v without tickets", tls13)
+	}
+}
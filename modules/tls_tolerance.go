@@ -0,0 +1,135 @@
+package modules
+
+import (
+	"fmt"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+)
+
+// unassignedExtension is an extension type with no IANA assignment, sent
+// by the unknown extension variants.
+const unassignedExtension = 0x7e57
+
+// toleranceGroups are offered in supported_groups by all variants.
+var toleranceGroups = []uint16{0x001d, 0x0017, 0x0018}
+
+// toleranceVariant is a change to the baseline ClientHello that a compliant
+// server must accept.
+type toleranceVariant struct {
+	name   string
+	modify func(hello *rawtls.ClientHello)
+}
+
+var toleranceVariants = []toleranceVariant{
+	{"baseline", func(hello *rawtls.ClientHello) {}},
+	{"grease", addGREASE},
+	{"unknown_extension", func(hello *rawtls.ClientHello) {
+		hello.Add(rawtls.Extension{Type: unassignedExtension, Data: []byte("zgrab2 tolerance")})
+	}},
+	// Some servers fail to parse an empty extension at the end of the list.
+	{"empty_last_extension", func(hello *rawtls.ClientHello) {
+		hello.Add(rawtls.Extension{Type: unassignedExtension})
+	}},
+	{"many_extensions", func(hello *rawtls.ClientHello) {
+		for i := 0; i < 64; i++ {
+			hello.Add(rawtls.Extension{Type: unassignedExtension + uint16(i), Data: []byte{byte(i)}})
+		}
+	}},
+	// Some implementations hang on ClientHellos of 256 to 511 bytes, which
+	// RFC 7685 padding was introduced to avoid.
+	{"length_300", func(hello *rawtls.ClientHello) { hello.PadTo(300) }},
+	{"length_512", func(hello *rawtls.ClientHello) { hello.PadTo(512) }},
+	// Larger than a record, as with post-quantum key shares.
+	{"length_17000", func(hello *rawtls.ClientHello) { hello.PadTo(17000) }},
+}
+
+// addGREASE adds GREASE values (RFC 8701) where a client such as Chrome
+// sends them: first in the cipher suites, groups, signature algorithms and
+// versions, a key share for a GREASE group, and empty and non-empty GREASE
+// extensions at the start and end of the list.
+func addGREASE(hello *rawtls.ClientHello) {
+	hello.CipherSuites = append([]uint16{rawtls.GREASE(0)}, hello.CipherSuites...)
+	hello.Set(rawtls.SupportedGroupsExtension(append([]uint16{rawtls.GREASE(1)}, toleranceGroups...)))
+	hello.Set(rawtls.SignatureAlgorithmsExtension(append([]uint16{rawtls.GREASE(2)}, rawtls.DefaultSignatureAlgorithms...)))
+	hello.Set(rawtls.SupportedVersionsExtension([]uint16{rawtls.GREASE(3), rawtls.VersionTLS13, rawtls.VersionTLS12}))
+	hello.Set(rawtls.KeyShareExtension([]rawtls.KeyShare{{Group: rawtls.GREASE(1), KeyExchange: []byte{0}}}))
+	hello.Extensions = append([]rawtls.Extension{{Type: rawtls.GREASE(4)}}, hello.Extensions...)
+	hello.Add(rawtls.Extension{Type: rawtls.GREASE(5), Data: []byte{0}})
+}
+
+// ToleranceProbe is the server's response to one ClientHello variant.
+type ToleranceProbe struct {
+	Variant     string `json:"variant"`
+	HelloLength int    `json:"hello_length"`
+
+	// Accepted is true if the server answered with a ServerHello or
+	// HelloRetryRequest.
+	Accepted        bool   `json:"accepted"`
+	SelectedVersion uint16 `json:"selected_version,omitempty"`
+	CipherSuite     uint16 `json:"cipher_suite,omitempty"`
+
+	// Violation describes a ServerHello selecting a GREASE value or
+	// echoing an extension the server cannot know.
+	Violation string `json:"violation,omitempty"`
+
+	Alert string `json:"alert,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ToleranceResult records which ClientHello variants break the handshake
+// with the server or a middlebox in front of it.
+type ToleranceResult struct {
+	Probes []*ToleranceProbe `json:"probes"`
+
+	// Intolerant are the variants not accepted, or accepted with a
+	// violation, although the baseline was accepted.
+	Intolerant []string `json:"intolerant,omitempty"`
+}
+
+// toleranceViolation returns a description of a GREASE value or unknown
+// extension in the ServerHello, or "".
+func toleranceViolation(hello *rawtls.ServerHello) string {
+	switch {
+	case rawtls.IsGREASE(hello.CipherSuite):
+		return fmt.Sprintf("selected GREASE cipher suite 0x%04x", hello.CipherSuite)
+	case rawtls.IsGREASE(hello.SelectedVersion):
+		return fmt.Sprintf("selected GREASE version 0x%04x", hello.SelectedVersion)
+	case rawtls.IsGREASE(hello.SelectedGroup):
+		return fmt.Sprintf("selected GREASE group 0x%04x", hello.SelectedGroup)
+	}
+	for _, ext := range hello.Extensions {
+		if rawtls.IsGREASE(ext.Type) || ext.Type >= unassignedExtension && ext.Type < unassignedExtension+64 {
+			return fmt.Sprintf("echoed extension 0x%04x", ext.Type)
+		}
+	}
+	return ""
+}
+
+// probeTolerance sends each ClientHello variant on a new connection.
+func (s *TLSScanner) probeTolerance(t *zgrab2.ScanTarget) *ToleranceResult {
+	result := new(ToleranceResult)
+	for _, variant := range toleranceVariants {
+		hello := rawtls.NewClientHello(s.rawServerName(t), toleranceGroups, nil)
+		variant.modify(hello)
+		probe := &ToleranceProbe{Variant: variant.name, HelloLength: len(hello.Marshal())}
+		result.Probes = append(result.Probes, probe)
+		serverHello, err := s.sendRawHello(t, hello)
+		if err != nil {
+			if alert, ok := err.(*rawtls.AlertError); ok {
+				probe.Alert = rawtls.AlertName(alert.Description)
+			} else {
+				probe.Error = err.Error()
+			}
+		} else {
+			probe.Accepted = true
+			probe.SelectedVersion = serverHello.SelectedVersion
+			probe.CipherSuite = serverHello.CipherSuite
+			probe.Violation = toleranceViolation(serverHello)
+		}
+		if baseline := result.Probes[0]; baseline.Accepted && probe != baseline && (!probe.Accepted || probe.Violation != "") {
+			result.Intolerant = append(result.Intolerant, variant.name)
+		}
+	}
+	return result
+}
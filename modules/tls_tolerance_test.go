@@ -0,0 +1,90 @@
+package modules
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+)
+
+// serveTolerance runs a proxy to a TLS server that drops ClientHello
+// records of 256 to 511 bytes, as some middleboxes do, and returns its
+// port.
+func serveTolerance(t *testing.T) uint {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				header := make([]byte, 5)
+				if _, err := io.ReadFull(conn, header); err != nil {
+					return
+				}
+				if length := binary.BigEndian.Uint16(header[3:]); length >= 256 && length < 512 {
+					return
+				}
+				backend, err := net.Dial("tcp", server.Listener.Addr().String())
+				if err != nil {
+					return
+				}
+				defer backend.Close()
+				backend.Write(header)
+				go io.Copy(backend, conn)
+				io.Copy(conn, backend)
+			}()
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestProbeTolerance(t *testing.T) {
+	port := serveTolerance(t)
+	flags := new(TLSFlags)
+	flags.Port = port
+	flags.Timeout = 5 * time.Second
+	scanner := &TLSScanner{config: flags}
+	result := scanner.probeTolerance(&zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+
+	if len(result.Probes) != len(toleranceVariants) {
+		t.Fatalf("got %d probes, expected %d", len(result.Probes), len(toleranceVariants))
+	}
+	var intolerant []string
+	for _, probe := range result.Probes {
+		// The ClientHello is sent in a single record up to 16384 bytes.
+		dropped := probe.HelloLength >= 256 && probe.HelloLength < 512
+		if probe.Accepted == dropped {
+			t.Errorf("%s (%d bytes): accepted %v, error %q, alert %q", probe.Variant, probe.HelloLength, probe.Accepted, probe.Error, probe.Alert)
+		}
+		if probe.Violation != "" {
+			t.Errorf("%s: violation %s", probe.Variant, probe.Violation)
+		}
+		if dropped {
+			intolerant = append(intolerant, probe.Variant)
+		}
+		if probe.Accepted && probe.SelectedVersion != 0x0304 {
+			t.Errorf("%s: selected version 0x%04x", probe.Variant, probe.SelectedVersion)
+		}
+	}
+	if len(intolerant) == 0 || len(result.Intolerant) != len(intolerant) {
+		t.Errorf("intolerant %v, expected %v", result.Intolerant, intolerant)
+	}
+}
@@ -0,0 +1,340 @@
+package tlsvuln
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+)
+
+// HeartbleedResult is the outcome of the Heartbleed check.
+type HeartbleedResult struct {
+	HeartbeatEnabled bool `json:"heartbeat_enabled"`
+	Vulnerable       bool `json:"vulnerable"`
+}
+
+// CCSInjectionResult is the outcome of the CCS injection check.
+type CCSInjectionResult struct {
+	// Vulnerable is true if the server accepted a ChangeCipherSpec before
+	// the key exchange without sending an alert.
+	Vulnerable bool `json:"vulnerable"`
+
+	// Response is the server's reaction to the early ChangeCipherSpec:
+	// an alert name, "timeout" or "closed".
+	Response string `json:"response"`
+}
+
+// ROBOTResult is the outcome of the ROBOT check.
+type ROBOTResult struct {
+	// RSAKeyExchange is true if the server accepted an RSA key exchange
+	// cipher suite; without one the server cannot be vulnerable.
+	RSAKeyExchange bool `json:"rsa_key_exchange"`
+
+	// Vulnerable is true if the server's reaction to a malformed
+	// ClientKeyExchange variant differed from its reaction to the correct
+	// one, i.e. it exposes a padding oracle.
+	Vulnerable bool `json:"vulnerable"`
+
+	// Responses maps each variant to the server's reaction.
+	Responses map[string]string `json:"responses,omitempty"`
+
+	// Errors maps the variants whose attempts all failed before the server
+	// reacted (e.g. the connection or the handshake failed) to the last
+	// error. They are left out of the comparison.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// RenegotiationResult is the outcome of the renegotiation check.
+type RenegotiationResult struct {
+	// SecureRenegotiation is true if the server answered with the RFC 5746
+	// renegotiation_info extension.
+	SecureRenegotiation bool `json:"secure_renegotiation"`
+
+	// Vulnerable is true if the server does not support secure
+	// renegotiation, and so is exposed to CVE-2009-3555 if it allows
+	// renegotiation at all.
+	Vulnerable bool `json:"vulnerable"`
+}
+
+// robotRetries is how many more times a ROBOT attempt that failed before
+// the server's reaction is made.
+const robotRetries = 2
+
+var (
+	// legacyCipherSuites are offered by the CCS injection and renegotiation
+	// checks.
+	legacyCipherSuites = []uint16{
+		0xc02f, 0xc030, 0xc02b, 0xc02c, 0xc013, 0xc014, 0xc009, 0xc00a,
+		0x009c, 0x009d, 0x003c, 0x003d, 0x002f, 0x0035, 0x000a,
+	}
+
+	// rsaCipherSuites are the RSA key exchange suites offered by the ROBOT
+	// check.
+	rsaCipherSuites = []uint16{0x009c, 0x009d, 0x003c, 0x003d, 0x002f, 0x0035, 0x000a}
+)
+
+// errNoRSAKey is returned if the server's certificate does not hold an RSA
+// key.
+var errNoRSAKey = errors.New("server certificate does not contain an RSA key")
+
+func (scanner *Scanner) serverName(target *zgrab2.ScanTarget) string {
+	if scanner.config.ServerName != "" {
+		return scanner.config.ServerName
+	}
+	if scanner.config.NoSNI {
+		return ""
+	}
+	return target.Domain
+}
+
+// serverFlight sends the ClientHello and reads the server's first flight up
+// to ServerHelloDone. It returns the ServerHello and the DER certificates.
+func serverFlight(conn net.Conn, hello *rawtls.ClientHello) (*rawtls.ServerHello, [][]byte, error) {
+	if _, err := conn.Write(hello.Records()); err != nil {
+		return nil, nil, err
+	}
+	reader := rawtls.NewHandshakeReader(conn)
+	var serverHello *rawtls.ServerHello
+	var certs [][]byte
+	for {
+		msgType, body, err := reader.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch msgType {
+		case rawtls.HandshakeTypeServerHello:
+			if serverHello, err = rawtls.ParseServerHello(body); err != nil {
+				return nil, nil, err
+			}
+		case rawtls.HandshakeTypeCertificate:
+			certs = parseCertificateList(body)
+		case rawtls.HandshakeTypeServerHelloDone:
+			if serverHello == nil {
+				return nil, nil, rawtls.ErrMalformed
+			}
+			return serverHello, certs, nil
+		}
+	}
+}
+
+// parseCertificateList splits a (pre-1.3) Certificate message body.
+func parseCertificateList(body []byte) [][]byte {
+	var ret [][]byte
+	if len(body) < 3 {
+		return nil
+	}
+	body = body[3:]
+	for len(body) >= 3 {
+		length := int(body[0])<<16 | int(body[1])<<8 | int(body[2])
+		if len(body) < 3+length {
+			break
+		}
+		ret = append(ret, body[3:3+length])
+		body = body[3+length:]
+	}
+	return ret
+}
+
+// serverReaction reads the server's next record and describes it.
+func serverReaction(conn net.Conn) string {
+	recordType, fragment, err := rawtls.ReadRecord(conn)
+	switch {
+	case err == nil && recordType == rawtls.RecordTypeAlert && len(fragment) >= 2:
+		return "alert:" + rawtls.AlertName(fragment[1])
+	case err == nil:
+		return "record"
+	case zgrab2.IsTimeoutError(err):
+		return "timeout"
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return "closed"
+	default:
+		return "error"
+	}
+}
+
+// checkHeartbleed performs a handshake with the heartbeat extension and
+// sends a malformed heartbeat request.
+func (scanner *Scanner) checkHeartbleed(target *zgrab2.ScanTarget) (*HeartbleedResult, error) {
+	conn, err := target.OpenTLS(&scanner.config.BaseFlags, &scanner.config.TLSFlags)
+	if conn != nil {
+		defer conn.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	ret := new(HeartbleedResult)
+	if heartbleed := conn.GetLog().HeartbleedLog; heartbleed != nil {
+		ret.HeartbeatEnabled = heartbleed.HeartbeatEnabled
+		ret.Vulnerable = heartbleed.Vulnerable
+	}
+	return ret, nil
+}
+
+// checkCCSInjection sends a ChangeCipherSpec right after the server's first
+// flight, before any key exchange. A patched server answers with an
+// unexpected_message alert; a vulnerable one silently accepts it.
+func (scanner *Scanner) checkCCSInjection(target *zgrab2.ScanTarget) (*CCSInjectionResult, error) {
+	conn, err := target.Open(&scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	hello := rawtls.NewLegacyClientHello(scanner.serverName(target), rawtls.VersionTLS12, legacyCipherSuites)
+	serverHello, _, err := serverFlight(conn, hello)
+	if err != nil {
+		return nil, err
+	}
+	ccs := rawtls.WrapRecords(rawtls.RecordTypeChangeCipherSpec, serverHello.Version, []byte{1})
+	if _, err := conn.Write(ccs); err != nil {
+		return nil, err
+	}
+	ret := &CCSInjectionResult{Response: serverReaction(conn)}
+	ret.Vulnerable = ret.Response == "timeout"
+	return ret, nil
+}
+
+// robotVariants builds the premaster secret encodings used by the ROBOT
+// check, for a modulus of k bytes: a correctly padded one and four with
+// different PKCS #1 v1.5 defects. As in robot-detect, the padding and the
+// random bytes are fixed and nonzero, so the only zero bytes are the ones
+// each variant places.
+func robotVariants(k int, version uint16) map[string][]byte {
+	pad := bytes.Repeat([]byte{0xab, 0xcd}, (k-3-48+1)/2)[:k-3-48]
+	random := bytes.Repeat([]byte{0x41}, 46)
+	versionBytes := []byte{byte(version >> 8), byte(version)}
+	build := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	return map[string][]byte{
+		"correct":           build([]byte{0x00, 0x02}, pad, []byte{0x00}, versionBytes, random),
+		"wrong_first_bytes": build([]byte{0x41, 0x17}, pad, []byte{0x00}, versionBytes, random),
+		"wrong_zero_pos":    build([]byte{0x00, 0x02}, pad, []byte{0x11}, random, []byte{0x00, 0x11}),
+		"missing_zero":      build([]byte{0x00, 0x02}, pad, []byte{0x11, 0x11, 0x11}, random),
+		"wrong_version":     build([]byte{0x00, 0x02}, pad, []byte{0x00, 0x02, 0x02}, random),
+	}
+}
+
+// robotAttempt runs one handshake with the given encoded premaster secret
+// and returns the server's reaction to the final flight.
+func (scanner *Scanner) robotAttempt(target *zgrab2.ScanTarget, encoded []byte) (string, *rsa.PublicKey, error) {
+	conn, err := target.Open(&scanner.config.BaseFlags)
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close()
+	hello := rawtls.NewLegacyClientHello(scanner.serverName(target), rawtls.VersionTLS12, rsaCipherSuites)
+	serverHello, certs, err := serverFlight(conn, hello)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(certs) == 0 {
+		return "", nil, errNoRSAKey
+	}
+	cert, err := x509.ParseCertificate(certs[0])
+	if err != nil {
+		return "", nil, err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return "", nil, errNoRSAKey
+	}
+	if encoded == nil {
+		return "", key, nil
+	}
+	// Textbook RSA, since the plaintext is deliberately malformed.
+	m := new(big.Int).SetBytes(encoded)
+	c := new(big.Int).Exp(m, big.NewInt(int64(key.E)), key.N)
+	ciphertext := make([]byte, (key.N.BitLen()+7)/8)
+	raw := c.Bytes()
+	copy(ciphertext[len(ciphertext)-len(raw):], raw)
+
+	cke := make([]byte, 2, 2+len(ciphertext))
+	binary.BigEndian.PutUint16(cke, uint16(len(ciphertext)))
+	cke = append(cke, ciphertext...)
+	finished := make([]byte, 40)
+	rand.Read(finished)
+	var flight []byte
+	flight = append(flight, rawtls.WrapRecords(rawtls.RecordTypeHandshake, serverHello.Version,
+		rawtls.HandshakeMessage(rawtls.HandshakeTypeClientKeyExchange, cke))...)
+	flight = append(flight, rawtls.WrapRecords(rawtls.RecordTypeChangeCipherSpec, serverHello.Version, []byte{1})...)
+	flight = append(flight, rawtls.WrapRecords(rawtls.RecordTypeHandshake, serverHello.Version, finished)...)
+	if _, err := conn.Write(flight); err != nil {
+		return "", nil, err
+	}
+	return serverReaction(conn), key, nil
+}
+
+// checkROBOT sends ClientKeyExchange messages whose premaster secrets have
+// different padding defects. A server without an oracle reacts the same
+// way to all of them. An attempt that fails before the server reacts is
+// retried, and left out of the comparison if it keeps failing, so that an
+// unreliable network is not mistaken for an oracle.
+func (scanner *Scanner) checkROBOT(target *zgrab2.ScanTarget) (*ROBOTResult, error) {
+	ret := new(ROBOTResult)
+	_, key, err := scanner.robotAttempt(target, nil)
+	if err != nil {
+		if _, ok := err.(*rawtls.AlertError); ok {
+			// No RSA key exchange suite was acceptable.
+			return ret, nil
+		}
+		return nil, err
+	}
+	ret.RSAKeyExchange = true
+	ret.Responses = make(map[string]string)
+	ret.Errors = make(map[string]string)
+	k := (key.N.BitLen() + 7) / 8
+	for name, encoded := range robotVariants(k, rawtls.VersionTLS12) {
+		var reaction string
+		for i := 0; i <= robotRetries; i++ {
+			if reaction, _, err = scanner.robotAttempt(target, encoded); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			ret.Errors[name] = err.Error()
+			continue
+		}
+		ret.Responses[name] = reaction
+	}
+	if correct, ok := ret.Responses["correct"]; ok {
+		for _, reaction := range ret.Responses {
+			if reaction != correct {
+				ret.Vulnerable = true
+			}
+		}
+	}
+	if len(ret.Errors) == 0 {
+		ret.Errors = nil
+	}
+	return ret, nil
+}
+
+// checkRenegotiation checks whether the ServerHello carries the RFC 5746
+// renegotiation_info extension.
+func (scanner *Scanner) checkRenegotiation(target *zgrab2.ScanTarget) (*RenegotiationResult, error) {
+	conn, err := target.Open(&scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	hello := rawtls.NewLegacyClientHello(scanner.serverName(target), rawtls.VersionTLS12, legacyCipherSuites)
+	if _, err := conn.Write(hello.Records()); err != nil {
+		return nil, err
+	}
+	serverHello, err := rawtls.ReadServerHello(conn)
+	if err != nil {
+		return nil, err
+	}
+	ret := new(RenegotiationResult)
+	ret.SecureRenegotiation = serverHello.Extension(rawtls.ExtensionRenegotiationInfo) != nil
+	ret.Vulnerable = !ret.SecureRenegotiation
+	return ret, nil
+}
@@ -0,0 +1,115 @@
+package tlsvuln
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/rawtls"
+)
+
+func TestROBOTVariants(t *testing.T) {
+	const k = 256
+	variants := robotVariants(k, 0x0303)
+	if len(variants) != 5 {
+		t.Fatalf("got %d variants, expected 5", len(variants))
+	}
+	for name, encoded := range variants {
+		if len(encoded) != k {
+			t.Errorf("%s: length %d, expected %d", name, len(encoded), k)
+		}
+	}
+	correct := variants["correct"]
+	if !bytes.Equal(correct[:2], []byte{0x00, 0x02}) || correct[k-49] != 0x00 || !bytes.Equal(correct[k-48:k-46], []byte{0x03, 0x03}) {
+		t.Errorf("correct variant is not PKCS #1 v1.5 padded: %x", correct)
+	}
+	if bytes.IndexByte(variants["missing_zero"][2:], 0x00) >= 0 {
+		t.Errorf("missing_zero variant contains a zero separator")
+	}
+}
+
+// serveROBOT runs a server that negotiates TLS_RSA_WITH_AES_128_CBC_SHA with
+// an RSA certificate and answers every ClientKeyExchange flight with the
+// same alert. The connections for which fail returns true are closed right
+// after the ClientHello.
+func serveROBOT(t *testing.T, fail func(n int) bool) uint {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "robot.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverHello := append([]byte{0x03, 0x03}, make([]byte, 32)...)
+	serverHello = append(serverHello, 0, 0x00, 0x2f, 0)
+	certificate := []byte{0, byte((len(der) + 3) >> 8), byte(len(der) + 3), 0, byte(len(der) >> 8), byte(len(der))}
+	certificate = append(certificate, der...)
+	var flight []byte
+	flight = append(flight, rawtls.HandshakeMessage(rawtls.HandshakeTypeServerHello, serverHello)...)
+	flight = append(flight, rawtls.HandshakeMessage(rawtls.HandshakeTypeCertificate, certificate)...)
+	flight = append(flight, rawtls.HandshakeMessage(rawtls.HandshakeTypeServerHelloDone, nil)...)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if _, _, err := rawtls.ReadRecord(conn); err != nil || fail(n) {
+				conn.Close()
+				continue
+			}
+			conn.Write(rawtls.WrapRecords(rawtls.RecordTypeHandshake, rawtls.VersionTLS12, flight))
+			if _, _, err := rawtls.ReadRecord(conn); err == nil {
+				conn.Write(rawtls.WrapRecords(rawtls.RecordTypeAlert, rawtls.VersionTLS12, []byte{2, 20}))
+			}
+			conn.Close()
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestROBOTTransportErrors(t *testing.T) {
+	// Connection 0 fetches the key. The first variant fails on all of its
+	// attempts, and the second one on its first attempt only.
+	port := serveROBOT(t, func(n int) bool {
+		return n >= 1 && n <= 1+robotRetries || n == 2+robotRetries
+	})
+	scanner := &Scanner{config: &Flags{CheckROBOT: true}}
+	scanner.config.Port = port
+	scanner.config.Timeout = 5 * time.Second
+	result, err := scanner.checkROBOT(&zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.RSAKeyExchange || result.Vulnerable {
+		t.Errorf("got RSA key exchange %v, vulnerable %v", result.RSAKeyExchange, result.Vulnerable)
+	}
+	if len(result.Errors) != 1 || len(result.Responses) != 4 {
+		t.Fatalf("got responses %v, errors %v", result.Responses, result.Errors)
+	}
+	for name, reaction := range result.Responses {
+		if reaction != "alert:bad_record_mac" {
+			t.Errorf("%s: got reaction %s", name, reaction)
+		}
+	}
+}
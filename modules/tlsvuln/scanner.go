@@ -0,0 +1,158 @@
+// Package tlsvuln provides a zgrab2 module that runs active checks for
+// well-known TLS implementation vulnerabilities: Heartbleed (CVE-2014-0160),
+// CCS injection (CVE-2014-0224), ROBOT (Bleichenbacher's RSA padding oracle)
+// and insecure (pre-RFC 5746) renegotiation.
+//
+// Every check is opt-in (--heartbleed, --ccs-injection, --robot,
+// --renegotiation, or --all) and runs on its own connection(s). The checks
+// stop at detection: no memory is dumped and no key material is recovered.
+package tlsvuln
+
+import (
+	"github.com/Positive-Engineer/zgrab2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Flags holds the command-line configuration for the tlsvuln module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	// The Heartbleed check is enabled with the standard --heartbleed TLS flag.
+	CheckCCSInjection  bool `long:"ccs-injection" description:"Check for OpenSSL CCS injection (CVE-2014-0224)"`
+	CheckROBOT         bool `long:"robot" description:"Check for a Bleichenbacher RSA padding oracle (ROBOT)"`
+	CheckRenegotiation bool `long:"renegotiation" description:"Check whether the server supports secure renegotiation (RFC 5746)"`
+	All                bool `long:"all" description:"Run all checks"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results holds the outcome of each check that was run.
+type Results struct {
+	Heartbleed    *HeartbleedResult    `json:"heartbleed,omitempty"`
+	CCSInjection  *CCSInjectionResult  `json:"ccs_injection,omitempty"`
+	ROBOT         *ROBOTResult         `json:"robot,omitempty"`
+	Renegotiation *RenegotiationResult `json:"renegotiation,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("tlsvuln", "TLS vulnerability checks", module.Description(), 443, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Check for Heartbleed, CCS injection, ROBOT and insecure renegotiation"
+}
+
+// Validate checks that the flags are valid.
+func (flags *Flags) Validate(args []string) error {
+	if flags.All {
+		flags.Heartbleed = true
+		flags.CheckCCSInjection = true
+		flags.CheckROBOT = true
+		flags.CheckRenegotiation = true
+	}
+	if !flags.Heartbleed && !flags.CheckCCSInjection && !flags.CheckROBOT && !flags.CheckRenegotiation {
+		log.Errorln("tlsvuln: no checks selected (use --heartbleed, --ccs-injection, --robot, --renegotiation or --all)")
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "tlsvuln"
+}
+
+// Scan runs each of the selected checks. The scan succeeds if at least one
+// check could be completed.
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	result := new(Results)
+	var lastErr error
+	completed := 0
+	record := func(err error) {
+		if err != nil {
+			lastErr = err
+		} else {
+			completed++
+		}
+	}
+	if scanner.config.Heartbleed {
+		var err error
+		result.Heartbleed, err = scanner.checkHeartbleed(&target)
+		record(err)
+	}
+	if scanner.config.CheckCCSInjection {
+		var err error
+		result.CCSInjection, err = scanner.checkCCSInjection(&target)
+		record(err)
+	}
+	if scanner.config.CheckROBOT {
+		var err error
+		result.ROBOT, err = scanner.checkROBOT(&target)
+		record(err)
+	}
+	if scanner.config.CheckRenegotiation {
+		var err error
+		result.Renegotiation, err = scanner.checkRenegotiation(&target)
+		record(err)
+	}
+	if completed == 0 {
+		return zgrab2.TryGetScanStatus(lastErr), result, lastErr
+	}
+	return zgrab2.SCAN_SUCCESS, result, nil
+}
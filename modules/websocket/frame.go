@@ -0,0 +1,189 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// Frame opcodes (RFC 6455, section 5.2).
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+var opcodeNames = map[byte]string{
+	opContinuation: "continuation",
+	opText:         "text",
+	opBinary:       "binary",
+	opClose:        "close",
+	opPing:         "ping",
+	opPong:         "pong",
+}
+
+var (
+	// errFrameTooLarge is returned for a frame or message over the size
+	// limit.
+	errFrameTooLarge = errors.New("websocket frame too large")
+
+	// errBadFrame is returned for a frame violating RFC 6455.
+	errBadFrame = errors.New("invalid websocket frame")
+)
+
+// Frame is a frame received from the server. Fragmented messages are
+// reassembled, so Payload is the whole message.
+type Frame struct {
+	Opcode     byte   `json:"opcode"`
+	OpcodeName string `json:"opcode_name,omitempty"`
+	Length     int    `json:"length"`
+
+	// Masked is true if the server masked the frame, which RFC 6455
+	// forbids.
+	Masked bool `json:"masked,omitempty"`
+
+	Payload []byte `json:"payload,omitempty"`
+
+	// Text is the payload of a text frame.
+	Text string `json:"text,omitempty"`
+
+	// CloseCode and CloseReason are the payload of a close frame.
+	CloseCode   uint16 `json:"close_code,omitempty"`
+	CloseReason string `json:"close_reason,omitempty"`
+}
+
+// writeFrame writes a single masked frame, as clients must send them.
+func writeFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode, 0}
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	header[1] |= 0x80
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	header = append(header, mask...)
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+	_, err := w.Write(append(header, masked...))
+	return err
+}
+
+// readRawFrame reads one frame, unmasking it if needed.
+func readRawFrame(r *bufio.Reader, maxSize int) (fin bool, opcode byte, masked bool, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	fin, opcode, masked = header[0]&0x80 != 0, header[0]&0x0f, header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(r, ext); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(r, ext); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if opcode >= opClose && (!fin || length > 125) {
+		err = errBadFrame
+		return
+	}
+	if length > uint64(maxSize) {
+		err = errFrameTooLarge
+		return
+	}
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err = io.ReadFull(r, mask); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	for i := range mask {
+		for j := i; j < len(payload); j += 4 {
+			payload[j] ^= mask[i]
+		}
+	}
+	return
+}
+
+// readFrame reads the next data or close frame, answering pings and
+// reassembling fragmented messages of up to maxSize bytes.
+func readFrame(r *bufio.Reader, w io.Writer, maxSize int) (*Frame, error) {
+	var ret *Frame
+	for {
+		fin, opcode, masked, payload, err := readRawFrame(r, maxSize)
+		if err != nil {
+			return ret, err
+		}
+		switch {
+		case opcode == opPing:
+			if err := writeFrame(w, opPong, payload); err != nil {
+				return ret, err
+			}
+			continue
+		case opcode == opPong:
+			continue
+		case opcode == opContinuation:
+			if ret == nil {
+				return nil, errBadFrame
+			}
+			if len(ret.Payload)+len(payload) > maxSize {
+				return ret, errFrameTooLarge
+			}
+			ret.Payload = append(ret.Payload, payload...)
+		default:
+			if ret != nil {
+				// A new message before the previous one was finished.
+				return ret, errBadFrame
+			}
+			ret = &Frame{Opcode: opcode, OpcodeName: opcodeNames[opcode], Payload: payload}
+		}
+		ret.Masked = ret.Masked || masked
+		if fin {
+			break
+		}
+	}
+	ret.Length = len(ret.Payload)
+	switch ret.Opcode {
+	case opText:
+		if utf8.Valid(ret.Payload) {
+			ret.Text = string(ret.Payload)
+		}
+	case opClose:
+		if len(ret.Payload) >= 2 {
+			ret.CloseCode = binary.BigEndian.Uint16(ret.Payload)
+			ret.CloseReason = string(ret.Payload[2:])
+		}
+	}
+	return ret, nil
+}
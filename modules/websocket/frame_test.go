@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+// serverFrame returns an unmasked frame, as servers send them.
+func serverFrame(fin bool, opcode byte, payload string) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	return append([]byte{first, byte(len(payload))}, payload...)
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, length := range []int{0, 125, 126, 0xffff, 0x10000} {
+		payload := bytes.Repeat([]byte{'x'}, length)
+		buf := new(bytes.Buffer)
+		if err := writeFrame(buf, opBinary, payload); err != nil {
+			t.Fatal(err)
+		}
+		fin, opcode, masked, got, err := readRawFrame(bufio.NewReader(buf), 0x10000)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", length, err)
+		}
+		if !fin || opcode != opBinary || !masked || !bytes.Equal(got, payload) {
+			t.Errorf("%d bytes: fin %v, opcode %d, masked %v, %d bytes", length, fin, opcode, masked, len(got))
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	var input []byte
+	input = append(input, serverFrame(true, opPing, "hi")...)
+	input = append(input, serverFrame(false, opText, "hello, ")...)
+	input = append(input, serverFrame(true, opContinuation, "world")...)
+	input = append(input, serverFrame(true, opClose, "\x03\xe9bye")...)
+	reader := bufio.NewReader(bytes.NewReader(input))
+	written := new(bytes.Buffer)
+
+	frame, err := readFrame(reader, written, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.OpcodeName != "text" || frame.Text != "hello, world" || frame.Length != 12 {
+		t.Errorf("got %+v", frame)
+	}
+	if _, opcode, _, payload, err := readRawFrame(bufio.NewReader(written), 1024); err != nil || opcode != opPong || string(payload) != "hi" {
+		t.Errorf("ping answered with opcode %d %q: %v", opcode, payload, err)
+	}
+
+	frame, err = readFrame(reader, written, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.OpcodeName != "close" || frame.CloseCode != 1001 || frame.CloseReason != "bye" {
+		t.Errorf("got %+v", frame)
+	}
+
+	if _, err := readFrame(bufio.NewReader(bytes.NewReader(serverFrame(true, opText, "too long"))), written, 4); err != errFrameTooLarge {
+		t.Errorf("got %v for an oversized frame", err)
+	}
+}
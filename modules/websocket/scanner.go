@@ -0,0 +1,349 @@
+// Package websocket provides a zgrab2 module that probes for WebSocket
+// endpoints.
+// Default Port: 80 (TCP)
+//
+// The scanner sends an HTTP/1.1 Upgrade request for --path and checks the
+// answer against RFC 6455: the status must be 101, the Upgrade and
+// Connection headers must ask for websocket, and Sec-WebSocket-Accept must
+// match the Sec-WebSocket-Key sent. The subprotocol and extensions the
+// server selected are recorded.
+//
+// The --wss flag performs a TLS handshake before sending the request, using
+// the standard TLS flags.
+//
+// If --message is set and the upgrade succeeded, it is sent as a text (or,
+// with --binary, a binary) frame and the first data or close frame of the
+// reply is recorded; pings received meanwhile are answered.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"github.com/Positive-Engineer/zgrab2/lib/http"
+	log "github.com/sirupsen/logrus"
+)
+
+// acceptGUID is appended to the key to compute Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// errNotUpgraded is returned if the server did not switch protocols.
+var errNotUpgraded = errors.New("server did not upgrade to websocket")
+
+// ScanResults instances are returned by the module's Scan function.
+type ScanResults struct {
+	// Response is the response to the Upgrade request.
+	Response *http.Response `json:"response,omitempty"`
+
+	// Upgraded is true if the server answered 101 with the Upgrade and
+	// Connection headers required by RFC 6455.
+	Upgraded bool `json:"upgraded"`
+
+	// Key is the Sec-WebSocket-Key sent, and Accept the
+	// Sec-WebSocket-Accept received.
+	Key    string `json:"key"`
+	Accept string `json:"accept,omitempty"`
+
+	// AcceptValid is true if Accept is derived from Key as RFC 6455
+	// requires.
+	AcceptValid bool `json:"accept_valid"`
+
+	// Subprotocol is the subprotocol selected by the server; Extensions
+	// are the extensions it accepted.
+	Subprotocol string   `json:"subprotocol,omitempty"`
+	Extensions  []string `json:"extensions,omitempty"`
+
+	// Version is the Sec-WebSocket-Version header, which servers send with
+	// a 426 for unsupported versions.
+	Version string `json:"version,omitempty"`
+
+	// Reply is the first frame received after sending --message.
+	Reply *Frame `json:"reply,omitempty"`
+
+	// TLSLog is the standard TLS log, if --wss is set.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// Flags holds the command-line configuration for the websocket scan module.
+// Populated by the framework.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	// Path is the request target of the Upgrade request.
+	Path string `long:"path" default:"/" description:"Path (and query) to send the Upgrade request for"`
+
+	// Host overrides the Host header, which is the target domain or IP.
+	Host string `long:"host" description:"Host header to send, instead of the target domain or IP"`
+
+	// Origin is sent as the Origin header, which some servers require.
+	Origin string `long:"origin" description:"Origin header to send"`
+
+	// Subprotocols are offered in Sec-WebSocket-Protocol.
+	Subprotocols string `long:"subprotocols" description:"Comma-separated subprotocols to offer in Sec-WebSocket-Protocol"`
+
+	UserAgent string `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
+
+	// UseTLS performs a TLS handshake before the Upgrade request.
+	UseTLS bool `long:"wss" description:"Perform a TLS handshake immediately upon connecting"`
+
+	// Message is sent once upgraded, and the reply is recorded.
+	Message string `long:"message" description:"Send this message once upgraded and record the first frame of the reply"`
+	Binary  bool   `long:"binary" description:"Send --message as a binary frame; it is then given in hex"`
+
+	MaxSize int `long:"max-size" default:"64" description:"Max kilobytes of the reply to --message to read"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config  *Flags
+	message []byte
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("websocket", "websocket", module.Description(), 80, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResult returns a new value of the type of the scan results.
+func (module *Module) NewResult() interface{} {
+	return new(ScanResults)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Probe for WebSocket endpoints with an HTTP Upgrade request"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if !strings.HasPrefix(flags.Path, "/") {
+		log.Error("--path must start with /")
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.Binary {
+		if _, err := hex.DecodeString(flags.Message); err != nil {
+			log.Errorf("--message is not hex: %v", err)
+			return zgrab2.ErrInvalidArguments
+		}
+	}
+	if flags.MaxSize <= 0 {
+		log.Error("--max-size must be positive")
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, _ := flags.(*Flags)
+	scanner.config = f
+	scanner.message = []byte(f.Message)
+	if f.Binary {
+		scanner.message, _ = hex.DecodeString(f.Message)
+	}
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "websocket"
+}
+
+// acceptKey returns the Sec-WebSocket-Accept for a Sec-WebSocket-Key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContainsToken reports whether a comma-separated header contains
+// the token, case-insensitively.
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newRequest returns the Upgrade request for the target and a fresh key.
+func (scanner *Scanner) newRequest(target *zgrab2.ScanTarget) (*http.Request, string, error) {
+	host := scanner.config.Host
+	if host == "" {
+		host = target.Host()
+		port := scanner.config.Port
+		if target.Port != nil {
+			port = *target.Port
+		}
+		if (scanner.config.UseTLS && port != 443) || (!scanner.config.UseTLS && port != 80) {
+			host = net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+		}
+	}
+	scheme := "http"
+	if scanner.config.UseTLS {
+		scheme = "https"
+	}
+	u, err := url.Parse(scheme + "://" + host + scanner.config.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	request, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	request.Header.Set("User-Agent", scanner.config.UserAgent)
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	if scanner.config.Origin != "" {
+		request.Header.Set("Origin", scanner.config.Origin)
+	}
+	if scanner.config.Subprotocols != "" {
+		request.Header.Set("Sec-WebSocket-Protocol", scanner.config.Subprotocols)
+	}
+	return request, key, nil
+}
+
+// Scan performs the websocket scan.
+//  1. Open a TCP connection to the target port (default 80).
+//  2. If --wss is set, perform a TLS handshake using the command-line flags.
+//  3. Send the Upgrade request and read the response.
+//  4. Validate the upgrade and record the selected subprotocol and
+//     extensions.
+//  5. If --message is set, send it and read the first frame of the reply.
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(&scanner.config.BaseFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	result := new(ScanResults)
+	if scanner.config.UseTLS {
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnectionForTarget(conn, &target)
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		result.TLSLog = tlsConn.GetLog()
+		if err := tlsConn.Handshake(); err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		conn = tlsConn
+	}
+
+	request, key, err := scanner.newRequest(&target)
+	if err != nil {
+		return zgrab2.SCAN_UNKNOWN_ERROR, nil, err
+	}
+	result.Key = key
+	if err := request.Write(conn); err != nil {
+		return zgrab2.TryGetScanStatus(err), result, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		if zgrab2.TryGetScanStatus(err) == zgrab2.SCAN_UNKNOWN_ERROR {
+			return zgrab2.SCAN_PROTOCOL_ERROR, result, err
+		}
+		return zgrab2.TryGetScanStatus(err), result, err
+	}
+	result.Response = response
+	result.Accept = response.Header.Get("Sec-WebSocket-Accept")
+	result.AcceptValid = result.Accept == acceptKey(key)
+	result.Subprotocol = response.Header.Get("Sec-WebSocket-Protocol")
+	result.Version = response.Header.Get("Sec-WebSocket-Version")
+	for _, value := range response.Header["Sec-Websocket-Extensions"] {
+		for _, extension := range strings.Split(value, ",") {
+			if extension = strings.TrimSpace(extension); extension != "" {
+				result.Extensions = append(result.Extensions, extension)
+			}
+		}
+	}
+	result.Upgraded = response.StatusCode == http.StatusSwitchingProtocols &&
+		headerContainsToken(response.Header, "Upgrade", "websocket") &&
+		headerContainsToken(response.Header, "Connection", "upgrade")
+	if !result.Upgraded {
+		return zgrab2.SCAN_APPLICATION_ERROR, result, errNotUpgraded
+	}
+
+	if len(scanner.message) > 0 {
+		opcode := byte(opText)
+		if scanner.config.Binary {
+			opcode = opBinary
+		}
+		if err := writeFrame(conn, opcode, scanner.message); err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		reply, err := readFrame(reader, conn, scanner.config.MaxSize*1024)
+		result.Reply = reply
+		if err != nil {
+			if err == errBadFrame || err == errFrameTooLarge {
+				return zgrab2.SCAN_PROTOCOL_ERROR, result, fmt.Errorf("reading reply: %v", err)
+			}
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		// Close politely; the server's close frame is not awaited.
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		writeFrame(conn, opClose, []byte{0x03, 0xe8})
+	}
+	return zgrab2.SCAN_SUCCESS, result, nil
+}
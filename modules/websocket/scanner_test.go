@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Positive-Engineer/zgrab2"
+	"golang.org/x/net/websocket"
+)
+
+func getTestScanner(t *testing.T, server *httptest.Server, path string) (*Scanner, zgrab2.ScanTarget) {
+	host, portString, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portString)
+	var module Module
+	flags := module.NewFlags().(*Flags)
+	flags.Path = path
+	flags.UserAgent = "Mozilla/5.0 zgrab/0.x"
+	flags.MaxSize = 64
+	flags.Timeout = 5 * time.Second
+	flags.Port = uint(port)
+	flags.Subprotocols = "chat, superchat"
+	flags.Message = "ping"
+	scanner := module.NewScanner().(*Scanner)
+	scanner.Init(flags)
+	return scanner, zgrab2.ScanTarget{IP: net.ParseIP(host)}
+}
+
+func TestScan(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/ws", websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			config.Protocol = config.Protocol[1:]
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			var message string
+			websocket.Message.Receive(ws, &message)
+			websocket.Message.Send(ws, "echo: "+message)
+		},
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	scanner, target := getTestScanner(t, server, "/ws")
+	status, res, err := scanner.Scan(target)
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("status %s: %v", status, err)
+	}
+	result := res.(*ScanResults)
+	if !result.Upgraded || !result.AcceptValid {
+		t.Errorf("upgraded %v, accept valid %v", result.Upgraded, result.AcceptValid)
+	}
+	if result.Subprotocol != "superchat" {
+		t.Errorf("subprotocol %q", result.Subprotocol)
+	}
+	if result.Reply == nil || result.Reply.Text != "echo: ping" {
+		t.Errorf("reply %+v", result.Reply)
+	}
+
+	scanner, target = getTestScanner(t, server, "/")
+	status, res, _ = scanner.Scan(target)
+	if status != zgrab2.SCAN_APPLICATION_ERROR || res.(*ScanResults).Response.StatusCode != http.StatusNotFound {
+		t.Errorf("status %s for a path without websocket", status)
+	}
+}
@@ -9,6 +9,12 @@ type Monitor struct {
 	statusesChan chan moduleStatus
 	// Callback is invoked after each scan.
 	Callback func(string)
+
+	// targets, stats and total are the counts of the summary: the targets
+	// scanned, and the scans of each scanner and of all of them.
+	targets uint64
+	stats   map[string]*scanStats
+	total   *scanStats
 }
 
 // State contains the respective number of successes and failures
@@ -21,6 +27,14 @@ type State struct {
 type moduleStatus struct {
 	name string
 	st   status
+
+	// The status, error category, duration in milliseconds and traffic of
+	// the scan, for the summary.
+	status   ScanStatus
+	category ErrorCategory
+	duration float64
+	read     uint64
+	written  uint64
 }
 
 type status uint
@@ -28,6 +42,8 @@ type status uint
 const (
 	statusSuccess status = iota
 	statusFailure status = iota
+	// statusTarget reports a target scanned, rather than a scan.
+	statusTarget status = iota
 )
 
 // GetStatuses returns a mapping from scanner names to the current number
@@ -43,16 +59,51 @@ func (m *Monitor) Stop() {
 	close(m.statusesChan)
 }
 
+// report sends the status of a scan of the named scanner and its response,
+// with the traffic of its connections, if m is not nil.
+func (m *Monitor) report(name string, st status, res *ScanResponse, traffic *trafficLog) {
+	if m == nil {
+		return
+	}
+	scan := moduleStatus{name: name, st: st, status: res.Status}
+	if res.Error != nil {
+		scan.category = res.Error.Category
+	}
+	if res.Timing != nil {
+		scan.duration = res.Timing.Duration
+	}
+	scan.read, scan.written = traffic.bytes()
+	m.statusesChan <- scan
+}
+
+// reportTarget counts a target scanned, if m is not nil.
+func (m *Monitor) reportTarget() {
+	if m != nil {
+		m.statusesChan <- moduleStatus{st: statusTarget}
+	}
+}
+
 // MakeMonitor returns a Monitor object that can be used to collect and send
 // the status of a running scan
 func MakeMonitor(statusChanSize int, wg *sync.WaitGroup) *Monitor {
 	m := new(Monitor)
 	m.statusesChan = make(chan moduleStatus, statusChanSize)
 	m.states = make(map[string]*State, 10)
+	m.stats = make(map[string]*scanStats, 10)
+	m.total = newScanStats()
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for s := range m.statusesChan {
+			if s.st == statusTarget {
+				m.targets++
+				continue
+			}
+			if m.stats[s.name] == nil {
+				m.stats[s.name] = newScanStats()
+			}
+			m.stats[s.name].add(&s)
+			m.total.add(&s)
 			if m.states[s.name] == nil {
 				m.states[s.name] = new(State)
 			}
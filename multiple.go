@@ -1,10 +1,18 @@
 package zgrab2
 
-import "errors"
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	flags "github.com/zmap/zflags"
+)
 
 // MultipleCommand contains the command line options for running
 type MultipleCommand struct {
 	ConfigFileName  string `short:"c" long:"config-file" default:"-" description:"Config filename, use - for stdin"`
+	ConfigFormat    string `long:"config-format" default:"auto" choice:"auto" choice:"ini" choice:"yaml" choice:"json" description:"Format of the config file; auto uses the file extension (.ini, .yaml, .yml, .json) or the contents"`
 	ContinueOnError bool   `long:"continue-on-error" description:"If proceeding protocols error, do not run following protocols (default: true)"`
 	BreakOnSuccess  bool   `long:"break-on-success" description:"If proceeding protocols succeed, do not run following protocols (default: false)"`
 }
@@ -22,3 +30,28 @@ func (x *MultipleCommand) Validate(args []string) error {
 func (x *MultipleCommand) Help() string {
 	return ""
 }
+
+// Parse reads the config file, in INI or in YAML or JSON (see
+// MultipleConfigToIni), and returns the module types and flags of its
+// module sections.
+func (x *MultipleCommand) Parse(iniParser *flags.IniParser) ([]string, []interface{}, error) {
+	var data []byte
+	var err error
+	if x.ConfigFileName == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(x.ConfigFileName)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if isMultipleConfigYAML(x.ConfigFormat, x.ConfigFileName, data) {
+		if data, err = MultipleConfigToIni(data); err != nil {
+			return nil, nil, err
+		}
+	} else if x.ConfigFileName != "-" {
+		// Keep the file name in the errors.
+		return iniParser.ParseFile(x.ConfigFileName)
+	}
+	return iniParser.Parse(bytes.NewReader(data))
+}
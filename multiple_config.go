@@ -0,0 +1,185 @@
+package zgrab2
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// multipleConfig is the YAML or JSON form of the multiple command's config
+// file:
+//
+//	options:              # framework options, as [Application Options]
+//	  senders: 100
+//	defaults:             # flags of every module that has them
+//	  timeout: 5s
+//	modules:
+//	  - module: http      # module type, as the INI section name
+//	    name: http80
+//	    port: ${HTTP_PORT:-80}
+//	  - module: ssh
+//	    port: 22
+//
+// String values may reference environment variables as ${NAME}, or
+// ${NAME:-default} for a default if NAME is unset or empty; $$ is a literal $.
+type multipleConfig struct {
+	Options  map[string]interface{}   `yaml:"options"`
+	Defaults map[string]interface{}   `yaml:"defaults"`
+	Modules  []map[string]interface{} `yaml:"modules"`
+}
+
+// envReference matches $$ and the ${NAME} and ${NAME:-default} references.
+var envReference = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces the environment variable references in value.
+func expandEnv(value string) (string, error) {
+	var err error
+	ret := envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		match := envReference.FindStringSubmatch(ref)
+		if v := os.Getenv(match[1]); v != "" {
+			return v
+		}
+		if match[2] != "" {
+			return match[3]
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", match[1])
+		}
+		return ""
+	})
+	return ret, err
+}
+
+// iniValues returns the INI values of a flag: one per element of a list, and
+// KEY:VALUE for each entry of a map.
+func iniValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return []string{""}, nil
+	case string:
+		expanded, err := expandEnv(v)
+		return []string{expanded}, err
+	case []interface{}:
+		var ret []string
+		for _, elem := range v {
+			if _, nested := elem.([]interface{}); nested {
+				return nil, fmt.Errorf("nested lists are not supported")
+			}
+			values, err := iniValues(elem)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, values...)
+		}
+		return ret, nil
+	case map[interface{}]interface{}:
+		var ret []string
+		for key, elem := range v {
+			values, err := iniValues(elem)
+			if err != nil || len(values) != 1 {
+				return nil, fmt.Errorf("invalid value of map key %v", key)
+			}
+			ret = append(ret, fmt.Sprintf("%v:%s", key, values[0]))
+		}
+		sort.Strings(ret)
+		return ret, nil
+	}
+	return []string{fmt.Sprint(value)}, nil
+}
+
+// writeIniSection writes a section with the flags, in order of name.
+func writeIniSection(buf *bytes.Buffer, section string, flags map[string]interface{}) error {
+	fmt.Fprintf(buf, "[%s]\n", section)
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values, err := iniValues(flags[name])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %s", section, name, err)
+		}
+		for _, value := range values {
+			fmt.Fprintf(buf, "%s = %s\n", name, strconv.Quote(value))
+		}
+	}
+	buf.WriteString("\n")
+	return nil
+}
+
+// moduleHasFlag returns true if the module's command has a flag of that name.
+func moduleHasFlag(module string, name string) bool {
+	cmd := parser.Find(module)
+	return cmd != nil && cmd.Group.FindOptionByLongName(name) != nil
+}
+
+// MultipleConfigToIni converts a YAML or JSON config file of the multiple
+// command into the INI format read by the IniParser. The defaults are added
+// to each module that has the flag and does not set it.
+func MultipleConfigToIni(data []byte) ([]byte, error) {
+	var config multipleConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if len(config.Options) > 0 {
+		if err := writeIniSection(&buf, "Application Options", config.Options); err != nil {
+			return nil, err
+		}
+	}
+	for i, block := range config.Modules {
+		module, _ := block["module"].(string)
+		if module == "" {
+			return nil, fmt.Errorf("modules[%d]: module is required", i)
+		}
+		if GetModule(module) == nil {
+			return nil, fmt.Errorf("modules[%d]: unknown module %q", i, module)
+		}
+		flags := make(map[string]interface{}, len(block)+len(config.Defaults))
+		for name, value := range config.Defaults {
+			if moduleHasFlag(module, name) {
+				flags[name] = value
+			}
+		}
+		for name, value := range block {
+			if name != "module" {
+				flags[name] = value
+			}
+		}
+		if err := writeIniSection(&buf, module, flags); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// isMultipleConfigYAML returns true if the config file is in YAML or JSON
+// rather than INI, given --config-format or the file name and contents.
+func isMultipleConfigYAML(format string, fileName string, data []byte) bool {
+	switch format {
+	case "ini":
+		return false
+	case "yaml", "json":
+		return true
+	}
+	switch strings.ToLower(fileName[strings.LastIndex(fileName, ".")+1:]) {
+	case "yaml", "yml", "json":
+		return true
+	case "ini":
+		return false
+	}
+	// An INI file starts with a section, comments or key = value lines.
+	trimmed := bytes.TrimSpace(data)
+	return bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("modules:")) ||
+		bytes.HasPrefix(trimmed, []byte("options:")) || bytes.HasPrefix(trimmed, []byte("defaults:"))
+}
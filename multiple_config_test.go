@@ -0,0 +1,153 @@
+package zgrab2
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type configTestFlags struct {
+	BaseFlags
+	UseHTTPS bool     `long:"use-https"`
+	Headers  []string `long:"header"`
+}
+
+func (f *configTestFlags) Validate(args []string) error { return nil }
+func (f *configTestFlags) Help() string                 { return "" }
+
+type configTestModule struct{}
+
+func (m *configTestModule) NewFlags() interface{} { return new(configTestFlags) }
+func (m *configTestModule) NewScanner() Scanner   { return nil }
+func (m *configTestModule) Description() string   { return "config test" }
+
+type configOtherFlags struct {
+	BaseFlags
+}
+
+func (f *configOtherFlags) Validate(args []string) error { return nil }
+func (f *configOtherFlags) Help() string                 { return "" }
+
+type configOtherModule struct{}
+
+func (m *configOtherModule) NewFlags() interface{} { return new(configOtherFlags) }
+func (m *configOtherModule) NewScanner() Scanner   { return nil }
+func (m *configOtherModule) Description() string   { return "config test" }
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("ZGRAB2_TEST_PORT", "8080")
+	defer os.Unsetenv("ZGRAB2_TEST_PORT")
+	tests := map[string]string{
+		"${ZGRAB2_TEST_PORT}":            "8080",
+		"x${ZGRAB2_TEST_UNSET:-80}y":     "x80y",
+		"$$HOME ${ZGRAB2_TEST_PORT:-80}": "$HOME 8080",
+		"$HOME":                          "$HOME",
+	}
+	for value, expected := range tests {
+		if actual, err := expandEnv(value); err != nil || actual != expected {
+			t.Errorf("%q: got %q, %v", value, actual, err)
+		}
+	}
+	if _, err := expandEnv("${ZGRAB2_TEST_UNSET}"); err == nil {
+		t.Error("expected an error for an unset variable")
+	}
+}
+
+func TestMultipleConfigToIni(t *testing.T) {
+	if GetModule("configtest") == nil {
+		if _, err := AddCommand("configtest", "config test", "config test", 80, new(configTestModule)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := AddCommand("configother", "config test", "config test", 81, new(configOtherModule)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv("ZGRAB2_TEST_PORT", "8443")
+	defer os.Unsetenv("ZGRAB2_TEST_PORT")
+	ini, err := MultipleConfigToIni([]byte(`
+defaults:
+  timeout: 3s
+  use-https: true
+modules:
+  - module: configtest
+    name: https
+    port: ${ZGRAB2_TEST_PORT}
+    header: ["X-A: 1", "X-B: 2"]
+  - module: configother
+    timeout: 1s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[configtest]
+header = "X-A: 1"
+header = "X-B: 2"
+name = "https"
+port = "8443"
+timeout = "3s"
+use-https = "true"
+
+[configother]
+timeout = "1s"
+
+`
+	if string(ini) != expected {
+		t.Fatalf("got\n%s", ini)
+	}
+
+	modTypes, flags, err := NewIniParser().Parse(bytes.NewReader(ini))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modTypes) != 2 {
+		t.Fatalf("got modules %v", modTypes)
+	}
+	for i, modType := range modTypes {
+		switch f := flags[i].(type) {
+		case *configTestFlags:
+			if modType != "configtest" || f.Port != 8443 || f.Timeout != 3*time.Second || !f.UseHTTPS || !reflect.DeepEqual(f.Headers, []string{"X-A: 1", "X-B: 2"}) {
+				t.Errorf("unexpected flags %+v", f)
+			}
+		case *configOtherFlags:
+			if modType != "configother" || f.Timeout != time.Second || f.Port != 81 {
+				t.Errorf("unexpected flags %+v", f)
+			}
+		default:
+			t.Errorf("unexpected module %s", modType)
+		}
+	}
+
+	for _, bad := range []string{
+		`modules: [{name: x}]`,
+		`modules: [{module: missing}]`,
+		`modules: [{module: configtest, port: "${ZGRAB2_TEST_UNSET}"}]`,
+		`unknown: 1`,
+	} {
+		if _, err := MultipleConfigToIni([]byte(bad)); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+}
+
+func TestIsMultipleConfigYAML(t *testing.T) {
+	tests := []struct {
+		format, file, data string
+		expected           bool
+	}{
+		{"auto", "scan.yaml", "", true},
+		{"auto", "scan.json", "", true},
+		{"auto", "scan.ini", "modules:", false},
+		{"auto", "-", "[http]\nport=80", false},
+		{"auto", "-", "modules:\n  - module: http", true},
+		{"auto", "-", `{"modules": []}`, true},
+		{"yaml", "scan.ini", "", true},
+		{"ini", "scan.yaml", "", false},
+	}
+	for _, test := range tests {
+		if actual := isMultipleConfigYAML(test.format, test.file, []byte(test.data)); actual != test.expected {
+			t.Errorf("%+v: got %v", test, actual)
+		}
+	}
+}
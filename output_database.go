@@ -0,0 +1,266 @@
+package zgrab2
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// databaseDialect is an SQL database of --output-database. Its database/sql
+// driver is not imported here, so that programs embedding zgrab2 do not link
+// (and build with cgo) the drivers they do not use; the zgrab2 binary
+// imports them in package bin.
+type databaseDialect struct {
+	driver string
+
+	// driverPackage is the import path of the driver.
+	driverPackage string
+
+	// createTable is the statement creating the table %s if it does not
+	// exist.
+	createTable string
+
+	// placeholder returns the placeholder of the i-th parameter, from 1.
+	placeholder func(i int) string
+}
+
+var databaseDialects = map[string]databaseDialect{
+	"postgres": {
+		driver:        "postgres",
+		driverPackage: "github.com/lib/pq",
+		createTable: `CREATE TABLE IF NOT EXISTS %s (
+	id BIGSERIAL PRIMARY KEY,
+	ip TEXT,
+	domain TEXT,
+	port INTEGER,
+	module TEXT,
+	status TEXT NOT NULL,
+	timestamp TIMESTAMPTZ,
+	data JSONB NOT NULL
+)`,
+		placeholder: func(i int) string { return fmt.Sprintf("$%d", i) },
+	},
+	"sqlite": {
+		driver:        "sqlite3",
+		driverPackage: "github.com/mattn/go-sqlite3",
+		createTable: `CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER PRIMARY KEY,
+	ip TEXT,
+	domain TEXT,
+	port INTEGER,
+	module TEXT,
+	status TEXT NOT NULL,
+	timestamp TEXT,
+	data TEXT NOT NULL
+)`,
+		placeholder: func(int) string { return "?" },
+	},
+}
+
+// tableName matches the table names of --output-database-table, which are
+// not quoted.
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseDatabaseURL returns the dialect and the data source name of an
+// --output-database URL: postgres://... or postgresql://..., passed as is
+// to the driver, or sqlite:PATH.
+func parseDatabaseURL(url string) (*databaseDialect, string, error) {
+	switch {
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		dialect := databaseDialects["postgres"]
+		return &dialect, url, nil
+	case strings.HasPrefix(url, "sqlite:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(url, "sqlite:"), "//")
+		if path == "" {
+			return nil, "", fmt.Errorf("missing path in %q", url)
+		}
+		dialect := databaseDialects["sqlite"]
+		return &dialect, path, nil
+	}
+	return nil, "", fmt.Errorf("unsupported database %q, expected postgres://... or sqlite:PATH", url)
+}
+
+// databaseRow is a row of the results table: a scanner response of a
+// record, or the whole record if it has no responses.
+type databaseRow struct {
+	ip, domain, module, status, timestamp string
+	port                                  *uint
+	data                                  []byte
+}
+
+// databaseRows returns the rows of an output record, one for each of its
+// scanners by name.
+func databaseRows(result []byte) ([]databaseRow, error) {
+	var record struct {
+		IP     string                     `json:"ip"`
+		Domain string                     `json:"domain"`
+		Port   *uint                      `json:"port"`
+		Data   map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(result, &record); err != nil {
+		return nil, err
+	}
+	if len(record.Data) == 0 {
+		return []databaseRow{{
+			ip:     record.IP,
+			domain: record.Domain,
+			port:   record.Port,
+			status: string(recordStatus(result)),
+			data:   result,
+		}}, nil
+	}
+	names := make([]string, 0, len(record.Data))
+	for name := range record.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make([]databaseRow, 0, len(names))
+	for _, name := range names {
+		var response struct {
+			Status    string `json:"status"`
+			Timestamp string `json:"timestamp"`
+		}
+		if err := json.Unmarshal(record.Data[name], &response); err != nil {
+			return nil, err
+		}
+		rows = append(rows, databaseRow{
+			ip:        record.IP,
+			domain:    record.Domain,
+			port:      record.Port,
+			module:    name,
+			status:    response.Status,
+			timestamp: response.Timestamp,
+			data:      record.Data[name],
+		})
+	}
+	return rows, nil
+}
+
+// nullString returns s, or nil for the NULL of an empty string.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// databaseSink inserts the output records into the table of
+// --output-database-table, creating it if needed. The rows of
+// --output-database-batch records are inserted in a transaction.
+type databaseSink struct {
+	db        *sql.DB
+	insert    string
+	batchSize int
+}
+
+// newDatabaseSink returns the databaseSink of the --output-database-*
+// options, or nil without --output-database.
+func newDatabaseSink(c *Config) (*databaseSink, error) {
+	if c.OutputDatabase == "" {
+		return nil, nil
+	}
+	if !tableName.MatchString(c.DatabaseTable) {
+		return nil, fmt.Errorf("invalid --output-database-table %q", c.DatabaseTable)
+	}
+	if c.DatabaseBatch <= 0 {
+		return nil, fmt.Errorf("invalid --output-database-batch %d", c.DatabaseBatch)
+	}
+	dialect, dsn, err := parseDatabaseURL(c.OutputDatabase)
+	if err != nil {
+		return nil, err
+	}
+	return openDatabaseSink(dialect, dsn, c.DatabaseTable, c.DatabaseBatch)
+}
+
+func openDatabaseSink(dialect *databaseDialect, dsn string, table string, batchSize int) (*databaseSink, error) {
+	registered := sql.Drivers()
+	if i := sort.SearchStrings(registered, dialect.driver); i == len(registered) || registered[i] != dialect.driver {
+		return nil, fmt.Errorf("the %s driver is not linked in: import _ %q", dialect.driver, dialect.driverPackage)
+	}
+	db, err := sql.Open(dialect.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(fmt.Sprintf(dialect.createTable, table)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create the table %s: %v", table, err)
+	}
+	placeholders := make([]string, 7)
+	for i := range placeholders {
+		placeholders[i] = dialect.placeholder(i + 1)
+	}
+	return &databaseSink{
+		db:        db,
+		insert:    fmt.Sprintf("INSERT INTO %s (ip, domain, port, module, status, timestamp, data) VALUES (%s)", table, strings.Join(placeholders, ", ")),
+		batchSize: batchSize,
+	}, nil
+}
+
+// insertBatch inserts the rows of the records in a transaction.
+func (d *databaseSink) insertBatch(records [][]byte) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(d.insert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, record := range records {
+		rows, err := databaseRows(record)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for _, row := range rows {
+			var port interface{}
+			if row.port != nil {
+				port = int64(*row.port)
+			}
+			if _, err := stmt.Exec(nullString(row.ip), nullString(row.domain), port, nullString(row.module), row.status, nullString(row.timestamp), string(row.data)); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// wrap returns an OutputResultsFunc that passes the results on to next, and
+// inserts them into the database. A failed insert stops the output.
+func (d *databaseSink) wrap(next OutputResultsFunc) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		defer d.db.Close()
+		passed := make(chan []byte)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- next(passed)
+		}()
+		batch := make([][]byte, 0, d.batchSize)
+		for result := range results {
+			if batch = append(batch, result); len(batch) >= d.batchSize {
+				if err := d.insertBatch(batch); err != nil {
+					return fmt.Errorf("--output-database: %v", err)
+				}
+				batch = batch[:0]
+			}
+			select {
+			case passed <- result:
+			case err := <-errs:
+				return err
+			}
+		}
+		if len(batch) > 0 {
+			if err := d.insertBatch(batch); err != nil {
+				return fmt.Errorf("--output-database: %v", err)
+			}
+		}
+		close(passed)
+		return <-errs
+	}
+}
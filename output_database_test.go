@@ -0,0 +1,86 @@
+package zgrab2
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestParseDatabaseURL(t *testing.T) {
+	for url, expected := range map[string]string{
+		"postgres://scan@localhost/results?sslmode=disable": "postgres://scan@localhost/results?sslmode=disable",
+		"sqlite:results.db":        "results.db",
+		"sqlite:///tmp/results.db": "/tmp/results.db",
+	} {
+		if _, dsn, err := parseDatabaseURL(url); err != nil || dsn != expected {
+			t.Errorf("%s: got %q, %v, expected %q", url, dsn, err, expected)
+		}
+	}
+	for _, url := range []string{"mysql://localhost/results", "sqlite:", "results.db"} {
+		if _, _, err := parseDatabaseURL(url); err == nil {
+			t.Errorf("%s accepted", url)
+		}
+	}
+	if _, err := newDatabaseSink(&Config{OutputDatabase: "sqlite:x.db", DatabaseTable: "results; DROP TABLE x", DatabaseBatch: 1}); err == nil {
+		t.Error("invalid table name accepted")
+	}
+}
+
+func TestDatabaseSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	d, err := newDatabaseSink(&Config{OutputDatabase: "sqlite:" + path, DatabaseTable: "results", DatabaseBatch: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output int
+	outputFunc := d.wrap(func(results <-chan []byte) error {
+		for range results {
+			output++
+		}
+		return nil
+	})
+	results := make(chan []byte, 3)
+	results <- []byte(`{"ip":"192.0.2.1","port":8443,"data":{"tls":{"status":"success","protocol":"tls","timestamp":"2020-01-01T00:00:00Z","result":{"version":771}},"http":{"status":"io-timeout","protocol":"http"}}}`)
+	results <- []byte(`{"domain":"example.invalid","resolution":{"error":"no such host"}}`)
+	results <- []byte(`{"ip":"192.0.2.2","data":{"tls":{"status":"connection-refused","protocol":"tls"}}}`)
+	close(results)
+	if err := outputFunc(results); err != nil {
+		t.Fatal(err)
+	}
+	if output != 3 {
+		t.Errorf("expected all 3 results to be passed through, got %d", output)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT ip, domain, port, module, status, timestamp, data FROM results ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got [][]interface{}
+	for rows.Next() {
+		var ip, domain, module, timestamp sql.NullString
+		var port sql.NullInt64
+		var status, data string
+		if err := rows.Scan(&ip, &domain, &port, &module, &status, &timestamp, &data); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, []interface{}{ip.String, domain.String, port.Int64, module.String, status, timestamp.String, data})
+	}
+	expected := [][]interface{}{
+		{"192.0.2.1", "", int64(8443), "http", "io-timeout", "", `{"status":"io-timeout","protocol":"http"}`},
+		{"192.0.2.1", "", int64(8443), "tls", "success", "2020-01-01T00:00:00Z", `{"status":"success","protocol":"tls","timestamp":"2020-01-01T00:00:00Z","result":{"version":771}}`},
+		{"", "example.invalid", int64(0), "", "dns-error", "", `{"domain":"example.invalid","resolution":{"error":"no such host"}}`},
+		{"192.0.2.2", "", int64(0), "tls", "connection-refused", "", `{"status":"connection-refused","protocol":"tls"}`},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v\nexpected %v", got, expected)
+	}
+}
@@ -0,0 +1,272 @@
+package zgrab2
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// outputCompressor wraps the output file w in a compressing writer, which
+// is closed before the file to write the end of the stream.
+type outputCompressor struct {
+	ext    string
+	writer func(w io.Writer) (io.WriteCloser, error)
+}
+
+// outputCompressors are the compressions of --output-compress, by name.
+var outputCompressors = map[string]outputCompressor{
+	"gzip": {".gz", func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	}},
+	"zstd": {".zst", newZstdWriter},
+}
+
+// zstdWriter compresses with the zstd command, which must be in the PATH.
+type zstdWriter struct {
+	stdin io.WriteCloser
+	cmd   *exec.Cmd
+}
+
+func newZstdWriter(w io.Writer) (io.WriteCloser, error) {
+	cmd := exec.Command("zstd", "-q", "-c")
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("--output-compress=zstd: %v", err)
+	}
+	return &zstdWriter{stdin: stdin, cmd: cmd}, nil
+}
+
+func (z *zstdWriter) Write(b []byte) (int, error) {
+	return z.stdin.Write(b)
+}
+
+// Close ends the stream and waits until zstd has written it.
+func (z *zstdWriter) Close() error {
+	if err := z.stdin.Close(); err != nil {
+		return err
+	}
+	return z.cmd.Wait()
+}
+
+// commandOutput returns the output file of the commands that write to it
+// directly, which are not compressed or rotated.
+func commandOutput() (io.Writer, error) {
+	if config.outputFile == nil {
+		return nil, errors.New("--output-compress and --output-rotate-* only apply to the output of scans")
+	}
+	return config.outputFile, nil
+}
+
+// parseByteSize parses a size in bytes with an optional binary suffix K, M,
+// G or T (e.g. 512M, 1G).
+func parseByteSize(s string) (int64, error) {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	shift := uint(0)
+	if n := len(value); n > 0 {
+		if i := strings.IndexByte("KMGT", value[n-1]); i >= 0 {
+			shift = 10 * uint(i+1)
+			value = value[:n-1]
+		}
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 || size > (1<<62)>>shift {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size << shift, nil
+}
+
+// outputFiles writes the output to the files of --output-file, compressed
+// with --output-compress and rotated to a new file when it reaches
+// --output-rotate-size, or after --output-rotate-interval.
+type outputFiles struct {
+	name       string
+	compressor *outputCompressor
+	rotateSize int64
+	rotateTime time.Duration
+	append     bool
+
+	// index is the number of the current file, when rotating.
+	index int
+}
+
+func (o *outputFiles) rotating() bool {
+	return o.rotateSize > 0 || o.rotateTime > 0
+}
+
+// fileName returns the name of the index-th file: with rotation, the index
+// is inserted before the extension of the output file name, as in
+// results.000001.json.gz.
+func (o *outputFiles) fileName(index int) string {
+	name := o.name
+	if o.rotating() {
+		ext := filepath.Ext(name)
+		name = fmt.Sprintf("%s.%06d%s", strings.TrimSuffix(name, ext), index, ext)
+	}
+	if o.compressor != nil {
+		name += o.compressor.ext
+	}
+	return name
+}
+
+// outputFile is an open output file. The records are written to the
+// compressor, if any, which writes to the file.
+type outputFile struct {
+	file       *os.File
+	compressor io.WriteCloser
+
+	// initial is the size of the file when it was opened for appending, and
+	// written the bytes written to it since, updated atomically.
+	initial int64
+	written int64
+}
+
+func (f *outputFile) Write(b []byte) (int, error) {
+	if f.compressor != nil {
+		return f.compressor.Write(b)
+	}
+	return f.write(b)
+}
+
+func (f *outputFile) write(b []byte) (int, error) {
+	n, err := f.file.Write(b)
+	atomic.AddInt64(&f.written, int64(n))
+	return n, err
+}
+
+// fileWriter is the writer of the compressor, which counts the compressed
+// bytes.
+type fileWriter struct {
+	f *outputFile
+}
+
+func (w fileWriter) Write(b []byte) (int, error) {
+	return w.f.write(b)
+}
+
+// Close ends the compressed stream and closes the file, unless it is
+// stdout.
+func (f *outputFile) Close() error {
+	if f.compressor != nil {
+		if err := f.compressor.Close(); err != nil {
+			return err
+		}
+	}
+	if f.file == os.Stdout {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// open opens the next output file. When appending, rotation continues with
+// the first file that does not exist.
+func (o *outputFiles) open() (*outputFile, error) {
+	ret := new(outputFile)
+	if o.name == "-" {
+		ret.file = os.Stdout
+	} else {
+		o.index++
+		if o.append && o.rotating() {
+			for {
+				if _, err := os.Stat(o.fileName(o.index)); os.IsNotExist(err) {
+					break
+				}
+				o.index++
+			}
+		}
+		var err error
+		if o.append {
+			ret.file, err = os.OpenFile(o.fileName(o.index), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		} else {
+			ret.file, err = os.Create(o.fileName(o.index))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info, err := ret.file.Stat(); err == nil {
+			ret.initial = info.Size()
+		}
+	}
+	if o.compressor != nil {
+		// Compressed streams, e.g. gzip members, can be concatenated, so
+		// that a resumed scan appends a new one.
+		var err error
+		if ret.compressor, err = o.compressor.writer(fileWriter{ret}); err != nil {
+			ret.file.Close()
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// full returns true if the file f opened at start is to be rotated.
+func (o *outputFiles) full(f *outputFile, start time.Time) bool {
+	if o.rotateSize > 0 && atomic.LoadInt64(&f.written) >= o.rotateSize {
+		return true
+	}
+	return o.rotateTime > 0 && time.Since(start) >= o.rotateTime
+}
+
+// results returns an OutputResultsFunc that writes the results in a format
+// of --output-format to the output files. Each file is written from the
+// start by the format, e.g. with its own CSV header. A file is rotated
+// after the record that fills it; the size is that of the data written to
+// the file, so it may exceed --output-rotate-size by the buffered output.
+func (o *outputFiles) results(format OutputFormat, fields []string) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		for first := true; ; first = false {
+			// The next file is only opened for a record, but the first
+			// is opened even if there are none.
+			result, ok := <-results
+			if !ok && !first {
+				return nil
+			}
+			f, err := o.open()
+			if err != nil {
+				return err
+			}
+			output, err := format(f, fields)
+			if err != nil {
+				f.Close()
+				return err
+			}
+			records := make(chan []byte)
+			done := make(chan error, 1)
+			go func() {
+				err := output(records)
+				// The rest of the records are drained if the output
+				// failed, so that the sender does not block.
+				for range records {
+				}
+				done <- err
+			}()
+			start := time.Now()
+			for ; ok; result, ok = <-results {
+				records <- result
+				if o.full(f, start) {
+					break
+				}
+			}
+			close(records)
+			err = <-done
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil || !ok {
+				return err
+			}
+		}
+	}
+}
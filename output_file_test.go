@@ -0,0 +1,141 @@
+package zgrab2
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for s, expected := range map[string]int64{"100": 100, "2k": 2048, "512M": 512 << 20, "1G": 1 << 30, "1GB": 1 << 30, "3T": 3 << 40} {
+		if size, err := parseByteSize(s); err != nil || size != expected {
+			t.Errorf("%s: got %d, %v, expected %d", s, size, err, expected)
+		}
+	}
+	for _, s := range []string{"", "G", "-1", "1X", "1.5G", "99999999999T"} {
+		if _, err := parseByteSize(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+// writeOutput writes n records through the output files in CSV.
+func writeOutput(t *testing.T, files *outputFiles, n int) {
+	results := make(chan []byte, n)
+	for i := 0; i < n; i++ {
+		results <- []byte(fmt.Sprintf(`{"ip":"10.0.0.%d"}`, i))
+	}
+	close(results)
+	if err := files.results(OutputResultsCSVFunc, []string{"ip"})(results); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readGzip(t *testing.T, name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestOutputFilesRotate(t *testing.T) {
+	dir := t.TempDir()
+	compressor := outputCompressors["gzip"]
+	files := &outputFiles{name: filepath.Join(dir, "results.csv"), compressor: &compressor, rotateTime: time.Nanosecond}
+	// Each file times out after a record.
+	writeOutput(t, files, 3)
+	for i := 0; i < 3; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("results.%06d.csv.gz", i+1))
+		if got := readGzip(t, name); got != fmt.Sprintf("ip\n10.0.0.%d\n", i) {
+			t.Errorf("%s: %q", name, got)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*")); len(matches) != 3 {
+		t.Errorf("files %v, expected 3", matches)
+	}
+
+	// A resumed scan continues with the next file.
+	files = &outputFiles{name: filepath.Join(dir, "results.csv"), compressor: &compressor, rotateTime: time.Nanosecond, append: true}
+	writeOutput(t, files, 1)
+	if got := readGzip(t, filepath.Join(dir, "results.000004.csv.gz")); got != "ip\n10.0.0.0\n" {
+		t.Errorf("resumed file: %q", got)
+	}
+}
+
+func TestOutputFilesRotateSize(t *testing.T) {
+	dir := t.TempDir()
+	files := &outputFiles{name: filepath.Join(dir, "results.json"), rotateSize: 64 << 10}
+	record := fmt.Sprintf(`{"domain":"%s"}`, strings.Repeat("x", 1000))
+	results := make(chan []byte, 1000)
+	for i := 0; i < 1000; i++ {
+		results <- []byte(record)
+	}
+	close(results)
+	if err := files.results(GetOutputFormat("json"), nil)(results); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "results.*.json"))
+	if len(matches) < 2 {
+		t.Fatalf("files %v", matches)
+	}
+	lines := 0
+	for i, name := range matches {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < len(matches)-1 && len(data) < 64<<10 {
+			t.Errorf("%s rotated at %d bytes", name, len(data))
+		}
+		lines += strings.Count(string(data), "\n")
+	}
+	if lines != 1000 {
+		t.Errorf("%d records written, expected 1000", lines)
+	}
+}
+
+func TestOutputFilesAppend(t *testing.T) {
+	dir := t.TempDir()
+	compressor := outputCompressors["gzip"]
+	files := &outputFiles{name: filepath.Join(dir, "results.csv"), compressor: &compressor}
+	writeOutput(t, files, 2)
+	files.append = true
+	files.index = 0
+	writeOutput(t, files, 1)
+	// gzip members are concatenated, and the header is not written again.
+	if got := readGzip(t, filepath.Join(dir, "results.csv.gz")); got != "ip\n10.0.0.0\n10.0.0.1\n10.0.0.0\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestOutputFilesZstd(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd is not installed")
+	}
+	dir := t.TempDir()
+	compressor := outputCompressors["zstd"]
+	writeOutput(t, &outputFiles{name: filepath.Join(dir, "results.csv"), compressor: &compressor}, 2)
+	data, err := exec.Command("zstd", "-d", "-c", filepath.Join(dir, "results.csv.zst")).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "ip\n10.0.0.0\n10.0.0.1\n") {
+		t.Errorf("got %q", data)
+	}
+}
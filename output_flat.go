@@ -0,0 +1,275 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// OutputFormat returns the OutputResultsFunc writing the JSON output records
+// to w in a format of --output-format, with the --output-fields if the
+// format selects fields.
+type OutputFormat func(w io.Writer, fields []string) (OutputResultsFunc, error)
+
+// outputFormats are the formats of --output-format, by name.
+var outputFormats = map[string]OutputFormat{
+	"json":       withoutFields("json", OutputResultsWriterFunc),
+	"protobuf":   withoutFields("protobuf", OutputResultsProtobufFunc),
+	"msgpack":    withoutFields("msgpack", OutputResultsMsgpackFunc),
+	"csv":        OutputResultsCSVFunc,
+	"jsonl-flat": OutputResultsFlatJSONFunc,
+}
+
+// RegisterOutputFormat adds a format to --output-format.
+func RegisterOutputFormat(name string, format OutputFormat) {
+	outputFormats[name] = format
+}
+
+// GetOutputFormat returns the registered --output-format, or nil.
+func GetOutputFormat(name string) OutputFormat {
+	return outputFormats[name]
+}
+
+// withoutFields adapts the output of a format that writes whole records.
+func withoutFields(name string, output func(w io.Writer) OutputResultsFunc) OutputFormat {
+	return func(w io.Writer, fields []string) (OutputResultsFunc, error) {
+		if len(fields) > 0 {
+			return nil, fmt.Errorf("--output-fields is not supported by --output-format=%s", name)
+		}
+		return output(w), nil
+	}
+}
+
+// recordKeys are the top-level keys of the output records. Other field
+// names start with a scanner name.
+var recordKeys = map[string]bool{
+	"ip":             true,
+	"domain":         true,
+	"port":           true,
+	"resolution":     true,
+	"data":           true,
+	"schema_version": true,
+}
+
+// outputField is a field of --output-fields: a path in the output record
+// such as ip or data.tls.status, or starting with a scanner name, in which
+// case it is looked up in the scanner's response, and then in its result
+// (e.g. tls.status, http.response.status_code).
+type outputField struct {
+	name  string
+	paths []filterPath
+}
+
+func parseOutputFields(fields []string) ([]outputField, error) {
+	ret := make([]outputField, 0, len(fields))
+	for _, name := range fields {
+		node, err := parseFilterPath(&filterToken{kind: "path", text: "." + name})
+		if err != nil {
+			return nil, err
+		}
+		path := node.(filterPath)
+		if len(path) == 0 {
+			return nil, fmt.Errorf("empty output field")
+		}
+		field := outputField{name: name}
+		if first, ok := path[0].(string); ok && !recordKeys[first] {
+			scanner := filterPath{"data", first}
+			field.paths = []filterPath{
+				append(append(filterPath{}, scanner...), path[1:]...),
+				append(append(filterPath{}, scanner...), append(filterPath{"result"}, path[1:]...)...),
+			}
+		} else {
+			field.paths = []filterPath{path}
+		}
+		ret = append(ret, field)
+	}
+	return ret, nil
+}
+
+// value returns the value of the field in record, or nil.
+func (f *outputField) value(record interface{}) interface{} {
+	for _, path := range f.paths {
+		if v := path.eval(record); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// decodeRecord decodes a JSON output record, keeping numbers as written.
+func decodeRecord(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var ret interface{}
+	if err := decoder.Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// flattenRecord adds the leaves of v to ret, by their path from prefix.
+// Arrays are flattened by index, as in a[0].
+func flattenRecord(prefix string, v interface{}, ret map[string]interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 {
+			break
+		}
+		for key, child := range value {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenRecord(key, child, ret)
+		}
+		return
+	case []interface{}:
+		if len(value) == 0 {
+			break
+		}
+		for i, child := range value {
+			flattenRecord(fmt.Sprintf("%s[%d]", prefix, i), child, ret)
+		}
+		return
+	}
+	ret[prefix] = v
+}
+
+// csvValue returns the text of a value in a CSV cell: strings as is, other
+// values in JSON, and nothing for a missing value.
+func csvValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// hasData returns true if w is a file that is not empty, as when the output
+// is appended to with --resume.
+func hasData(w io.Writer) bool {
+	switch f := w.(type) {
+	case *outputFile:
+		return f.initial > 0
+	case *os.File:
+		info, err := f.Stat()
+		return err == nil && info.Mode().IsRegular() && info.Size() > 0
+	}
+	return false
+}
+
+// OutputResultsCSVFunc returns an OutputResultsFunc that writes the fields of
+// the results to w as CSV, after a header row with the field names unless w
+// is a file that already has data.
+func OutputResultsCSVFunc(w io.Writer, fields []string) (OutputResultsFunc, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("--output-format=csv requires --output-fields")
+	}
+	columns, err := parseOutputFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	return func(results <-chan []byte) error {
+		writer := csv.NewWriter(w)
+		defer writer.Flush()
+		if !hasData(w) {
+			if err := writer.Write(fields); err != nil {
+				return err
+			}
+		}
+		row := make([]string, len(columns))
+		for result := range results {
+			record, err := decodeRecord(result)
+			if err != nil {
+				return err
+			}
+			for i := range columns {
+				if row[i], err = csvValue(columns[i].value(record)); err != nil {
+					return err
+				}
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// OutputResultsFlatJSONFunc returns an OutputResultsFunc that writes the
+// results to w as JSON lines of one level, keyed by field name: the fields if
+// given, in order and null if missing, or else every leaf of the record by
+// its path, e.g. data.http.result.response.status_code.
+func OutputResultsFlatJSONFunc(w io.Writer, fields []string) (OutputResultsFunc, error) {
+	columns, err := parseOutputFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(w)
+	return func(results <-chan []byte) error {
+		defer buf.Flush()
+		for result := range results {
+			record, err := decodeRecord(result)
+			if err != nil {
+				return err
+			}
+			var keys []string
+			values := make(map[string]interface{})
+			if len(columns) > 0 {
+				for i := range columns {
+					keys = append(keys, columns[i].name)
+					values[columns[i].name] = columns[i].value(record)
+				}
+			} else {
+				flattenRecord("", record, values)
+				for key := range values {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+			}
+			line, err := encodeFlatRecord(keys, values)
+			if err != nil {
+				return err
+			}
+			if _, err := buf.Write(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// encodeFlatRecord encodes the values as a JSON object line, with the keys
+// in order.
+func encodeFlatRecord(keys []string, values map[string]interface{}) ([]byte, error) {
+	var ret strings.Builder
+	ret.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			ret.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(values[key])
+		if err != nil {
+			return nil, err
+		}
+		ret.Write(k)
+		ret.WriteByte(':')
+		ret.Write(v)
+	}
+	ret.WriteString("}\n")
+	return []byte(ret.String()), nil
+}
@@ -0,0 +1,102 @@
+package zgrab2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+var flatResults = []string{
+	`{"ip":"10.0.0.1","port":443,"data":{"tls":{"status":"success","protocol":"tls","result":{"certificates":["a","b"],"version":771}},"http":{"status":"success","protocol":"http","result":{"response":{"status_code":200,"headers":{"server":["nginx, 1.2"]}}}}},"schema_version":1}`,
+	`{"domain":"example.com","data":{"tls":{"status":"io-timeout","protocol":"tls","error":{"category":"timeout","message":"i/o timeout"}}}}`,
+}
+
+func outputFlat(t *testing.T, format OutputFormat, w *bytes.Buffer, fields ...string) string {
+	output, err := format(w, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan []byte, len(flatResults))
+	for _, result := range flatResults {
+		results <- []byte(result)
+	}
+	close(results)
+	if err := output(results); err != nil {
+		t.Fatal(err)
+	}
+	return w.String()
+}
+
+func TestOutputResultsCSV(t *testing.T) {
+	got := outputFlat(t, OutputResultsCSVFunc, new(bytes.Buffer), "ip", "domain", "port", "tls.status", "tls.certificates", "tls.version", "http.response.status_code", "http.response.headers.server[0]", "tls.error.category")
+	expected := "ip,domain,port,tls.status,tls.certificates,tls.version,http.response.status_code,http.response.headers.server[0],tls.error.category\n" +
+		`10.0.0.1,,443,success,"[""a"",""b""]",771,200,"nginx, 1.2",` + "\n" +
+		",example.com,,io-timeout,,,,,timeout\n"
+	if got != expected {
+		t.Errorf("got\n%s\nexpected\n%s", got, expected)
+	}
+
+	if _, err := OutputResultsCSVFunc(new(bytes.Buffer), nil); err == nil {
+		t.Error("csv without fields accepted")
+	}
+	if _, err := OutputResultsCSVFunc(new(bytes.Buffer), []string{"tls.certificates[x]"}); err == nil {
+		t.Error("bad field accepted")
+	}
+}
+
+func TestOutputResultsCSVAppend(t *testing.T) {
+	f, err := ioutil.TempFile("", "zgrab2-csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.WriteString("ip\n10.0.0.2\n"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := OutputResultsCSVFunc(f, []string{"ip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan []byte, 1)
+	results <- []byte(flatResults[0])
+	close(results)
+	if err := output(results); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ip\n10.0.0.2\n10.0.0.1\n" {
+		t.Errorf("header written again when appending: %q", data)
+	}
+}
+
+func TestOutputResultsFlatJSON(t *testing.T) {
+	got := outputFlat(t, OutputResultsFlatJSONFunc, new(bytes.Buffer), "ip", "tls.status", "http.response.status_code")
+	expected := `{"ip":"10.0.0.1","tls.status":"success","http.response.status_code":200}` + "\n" +
+		`{"ip":null,"tls.status":"io-timeout","http.response.status_code":null}` + "\n"
+	if got != expected {
+		t.Errorf("got\n%s\nexpected\n%s", got, expected)
+	}
+
+	got = outputFlat(t, OutputResultsFlatJSONFunc, new(bytes.Buffer))
+	expected = `{"data.http.protocol":"http","data.http.result.response.headers.server[0]":"nginx, 1.2","data.http.result.response.status_code":200,"data.http.status":"success","data.tls.protocol":"tls","data.tls.result.certificates[0]":"a","data.tls.result.certificates[1]":"b","data.tls.result.version":771,"data.tls.status":"success","ip":"10.0.0.1","port":443,"schema_version":1}` + "\n" +
+		`{"data.tls.error.category":"timeout","data.tls.error.message":"i/o timeout","data.tls.protocol":"tls","data.tls.status":"io-timeout","domain":"example.com"}` + "\n"
+	if got != expected {
+		t.Errorf("got\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestOutputFormatFields(t *testing.T) {
+	for _, name := range []string{"json", "protobuf", "msgpack"} {
+		if _, err := GetOutputFormat(name)(new(bytes.Buffer), []string{"ip"}); err == nil {
+			t.Errorf("%s accepted --output-fields", name)
+		}
+	}
+	if GetOutputFormat("xml") != nil {
+		t.Error("unknown format found")
+	}
+}
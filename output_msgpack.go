@@ -0,0 +1,200 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+)
+
+// MsgpackEnvelopeVersion is the version of the envelope written with
+// --output-format=msgpack. It has the fields of the Grab message of
+// output.proto, keyed by their JSON names.
+const MsgpackEnvelopeVersion = 1
+
+// msgpackMap builds a MessagePack map, whose header needs the number of
+// entries. As in the JSON output, empty values are omitted.
+type msgpackMap struct {
+	n    int
+	body []byte
+}
+
+// appendMsgpackInt appends the type byte code and v as a big-endian integer
+// of size bytes.
+func appendMsgpackInt(b []byte, code byte, v uint64, size int) []byte {
+	b = append(b, code)
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*uint(i))))
+	}
+	return b
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<7:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return appendMsgpackInt(b, 0xcc, v, 1)
+	case v <= math.MaxUint16:
+		return appendMsgpackInt(b, 0xcd, v, 2)
+	case v <= math.MaxUint32:
+		return appendMsgpackInt(b, 0xce, v, 4)
+	}
+	return appendMsgpackInt(b, 0xcf, v, 8)
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := uint64(len(s))
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = appendMsgpackInt(b, 0xd9, n, 1)
+	case n <= math.MaxUint16:
+		b = appendMsgpackInt(b, 0xda, n, 2)
+	default:
+		b = appendMsgpackInt(b, 0xdb, n, 4)
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBin(b []byte, v []byte) []byte {
+	n := uint64(len(v))
+	switch {
+	case n <= math.MaxUint8:
+		b = appendMsgpackInt(b, 0xc4, n, 1)
+	case n <= math.MaxUint16:
+		b = appendMsgpackInt(b, 0xc5, n, 2)
+	default:
+		b = appendMsgpackInt(b, 0xc6, n, 4)
+	}
+	return append(b, v...)
+}
+
+func (m *msgpackMap) key(key string) {
+	m.n++
+	m.body = appendMsgpackString(m.body, key)
+}
+
+func (m *msgpackMap) str(key string, value string) {
+	if value != "" {
+		m.key(key)
+		m.body = appendMsgpackString(m.body, value)
+	}
+}
+
+func (m *msgpackMap) bin(key string, value []byte) {
+	if len(value) > 0 {
+		m.key(key)
+		m.body = appendMsgpackBin(m.body, value)
+	}
+}
+
+func (m *msgpackMap) uint(key string, value uint64) {
+	if value != 0 {
+		m.key(key)
+		m.body = appendMsgpackUint(m.body, value)
+	}
+}
+
+func (m *msgpackMap) float(key string, value float64) {
+	if value != 0 {
+		m.key(key)
+		m.body = appendMsgpackInt(m.body, 0xcb, math.Float64bits(value), 8)
+	}
+}
+
+// mapValue adds the map value, even if empty.
+func (m *msgpackMap) mapValue(key string, value *msgpackMap) {
+	m.key(key)
+	m.body = value.appendTo(m.body)
+}
+
+func (m *msgpackMap) appendTo(b []byte) []byte {
+	n := uint64(m.n)
+	switch {
+	case n < 16:
+		b = append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		b = appendMsgpackInt(b, 0xde, n, 2)
+	default:
+		b = appendMsgpackInt(b, 0xdf, n, 4)
+	}
+	return append(b, m.body...)
+}
+
+// EncodeGrabMsgpack converts a result line of the JSON output into a
+// MessagePack map. Module results stay JSON-encoded, as bin values, so that
+// they are only parsed by the consumers that need them.
+func EncodeGrabMsgpack(result []byte) ([]byte, error) {
+	var grab encodedGrab
+	if err := json.Unmarshal(result, &grab); err != nil {
+		return nil, err
+	}
+	var ret msgpackMap
+	ret.uint("version", MsgpackEnvelopeVersion)
+	ret.str("ip", grab.IP)
+	ret.str("domain", grab.Domain)
+	ret.uint("port", grab.Port)
+	names := make([]string, 0, len(grab.Data))
+	for name := range grab.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var data msgpackMap
+	for _, name := range names {
+		res := grab.Data[name]
+		var response msgpackMap
+		response.str("status", res.Status)
+		response.str("protocol", res.Protocol)
+		if string(res.Result) != "null" {
+			response.bin("result", res.Result)
+		}
+		response.str("timestamp", res.Timestamp)
+		if res.Error != nil {
+			var e msgpackMap
+			e.str("category", string(res.Error.Category))
+			if res.Error.TLSAlert != nil {
+				e.key("tls_alert")
+				e.body = appendMsgpackUint(e.body, uint64(*res.Error.TLSAlert))
+			}
+			e.str("message", res.Error.Message)
+			response.mapValue("error", &e)
+		}
+		if res.Timing != nil {
+			var timing msgpackMap
+			timing.str("start", res.Timing.Start)
+			timing.str("end", res.Timing.End)
+			timing.float("duration_ms", res.Timing.Duration)
+			timing.float("dial_ms", res.Timing.Dial)
+			timing.float("tls_handshake_ms", res.Timing.TLSHandshake)
+			response.mapValue("timing", &timing)
+		}
+		data.mapValue(name, &response)
+	}
+	if data.n > 0 {
+		ret.mapValue("data", &data)
+	}
+	ret.uint("schema_version", grab.SchemaVersion)
+	return ret.appendTo(nil), nil
+}
+
+// OutputResultsMsgpackFunc returns an OutputResultsFunc that writes the
+// results to w as a stream of MessagePack maps, which need no delimiters.
+func OutputResultsMsgpackFunc(w io.Writer) OutputResultsFunc {
+	buf := bufio.NewWriter(w)
+	return func(results <-chan []byte) error {
+		defer buf.Flush()
+		for result := range results {
+			message, err := EncodeGrabMsgpack(result)
+			if err != nil {
+				return err
+			}
+			if _, err := buf.Write(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
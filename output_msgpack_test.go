@@ -0,0 +1,116 @@
+package zgrab2
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// msgpackDecode decodes the first MessagePack value of b, of the types
+// written by the envelope encoder, and returns the rest of b.
+func msgpackDecode(t *testing.T, b []byte) (interface{}, []byte) {
+	if len(b) == 0 {
+		t.Fatal("truncated value")
+	}
+	readInt := func(size int) uint64 {
+		if len(b) < 1+size {
+			t.Fatalf("truncated value %x", b)
+		}
+		var v uint64
+		for _, c := range b[1 : 1+size] {
+			v = v<<8 | uint64(c)
+		}
+		b = b[1+size:]
+		return v
+	}
+	code := b[0]
+	var n uint64
+	switch {
+	case code < 0x80:
+		return uint64(code), b[1:]
+	case code&0xf0 == 0x80:
+		n = uint64(code & 0x0f)
+		b = b[1:]
+	case code&0xe0 == 0xa0:
+		n = uint64(code & 0x1f)
+		b = b[1:]
+		return string(b[:n]), b[n:]
+	case code >= 0xcc && code <= 0xcf:
+		return readInt(1 << (code - 0xcc)), b
+	case code == 0xcb:
+		return math.Float64frombits(readInt(8)), b
+	case code >= 0xd9 && code <= 0xdb:
+		n = readInt(1 << (code - 0xd9))
+		return string(b[:n]), b[n:]
+	case code >= 0xc4 && code <= 0xc6:
+		n = readInt(1 << (code - 0xc4))
+		return b[:n], b[n:]
+	case code == 0xde || code == 0xdf:
+		n = readInt(2 << (code - 0xde))
+	default:
+		t.Fatalf("unexpected type %x", code)
+	}
+	ret := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		var key, value interface{}
+		key, b = msgpackDecode(t, b)
+		value, b = msgpackDecode(t, b)
+		ret[key.(string)] = value
+	}
+	return ret, b
+}
+
+func TestOutputResultsMsgpack(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	results := make(chan []byte, 2)
+	results <- []byte(`{"ip":"10.0.0.1","port":8443,"data":{"tls":{"status":"unknown-error","protocol":"tls","timestamp":"2020-01-01T00:00:00Z","error":{"category":"tls-alert","tls_alert":40,"message":"remote error: handshake failure"}},"http":{"status":"success","protocol":"http","result":{"body":"` + long + `"},"timing":{"start":"2020-01-01T00:00:00.000Z","end":"2020-01-01T00:00:00.125Z","duration_ms":125,"dial_ms":2.5}}},"schema_version":1}`)
+	results <- []byte(`{"domain":"example.com","data":{}}`)
+	close(results)
+	var out bytes.Buffer
+	if err := OutputResultsMsgpackFunc(&out)(results); err != nil {
+		t.Fatal(err)
+	}
+
+	first, rest := msgpackDecode(t, out.Bytes())
+	expected := map[string]interface{}{
+		"version": uint64(MsgpackEnvelopeVersion),
+		"ip":      "10.0.0.1",
+		"port":    uint64(8443),
+		"data": map[string]interface{}{
+			"http": map[string]interface{}{
+				"status":   "success",
+				"protocol": "http",
+				"result":   []byte(`{"body":"` + long + `"}`),
+				"timing": map[string]interface{}{
+					"start":       "2020-01-01T00:00:00.000Z",
+					"end":         "2020-01-01T00:00:00.125Z",
+					"duration_ms": 125.0,
+					"dial_ms":     2.5,
+				},
+			},
+			"tls": map[string]interface{}{
+				"status":    "unknown-error",
+				"protocol":  "tls",
+				"timestamp": "2020-01-01T00:00:00Z",
+				"error": map[string]interface{}{
+					"category":  "tls-alert",
+					"tls_alert": uint64(40),
+					"message":   "remote error: handshake failure",
+				},
+			},
+		},
+		"schema_version": uint64(OutputSchemaVersion),
+	}
+	if !reflect.DeepEqual(first, expected) {
+		t.Errorf("got %v\nexpected %v", first, expected)
+	}
+	second, rest := msgpackDecode(t, rest)
+	if !reflect.DeepEqual(second, map[string]interface{}{"version": uint64(MsgpackEnvelopeVersion), "domain": "example.com"}) {
+		t.Errorf("got %v", second)
+	}
+	if len(rest) != 0 {
+		t.Errorf("%d bytes after the records", len(rest))
+	}
+}
@@ -0,0 +1,188 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+)
+
+// ProtobufEnvelopeVersion is the version of the Grab message in
+// output.proto written with --output-format=protobuf.
+const ProtobufEnvelopeVersion = 1
+
+// Field numbers of the messages in output.proto.
+const (
+	protoGrabVersion = 1
+	protoGrabIP      = 2
+	protoGrabDomain  = 3
+	protoGrabData    = 4
+	protoGrabSchema  = 5
+	protoGrabPort    = 6
+
+	protoMapKey   = 1
+	protoMapValue = 2
+
+	protoResponseStatus    = 1
+	protoResponseProtocol  = 2
+	protoResponseResult    = 3
+	protoResponseTimestamp = 4
+	protoResponseError     = 5
+	protoResponseHasError  = 6
+	protoResponseCategory  = 7
+	protoResponseTLSAlert  = 8
+	protoResponseTiming    = 9
+
+	protoTimingStart        = 1
+	protoTimingEnd          = 2
+	protoTimingDuration     = 3
+	protoTimingDial         = 4
+	protoTimingTLSHandshake = 5
+)
+
+// Protobuf wire types used by the envelope.
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+)
+
+// encodedGrab is a Grab as read back from its JSON encoding, keeping the
+// module results encoded.
+type encodedGrab struct {
+	IP     string `json:"ip"`
+	Domain string `json:"domain"`
+	Data   map[string]struct {
+		Status    string          `json:"status"`
+		Protocol  string          `json:"protocol"`
+		Result    json.RawMessage `json:"result"`
+		Timestamp string          `json:"timestamp"`
+		Error     *ErrorDetail    `json:"error"`
+		Timing    *Timing         `json:"timing"`
+	} `json:"data"`
+	SchemaVersion uint64 `json:"schema_version"`
+	Port          uint64 `json:"port"`
+}
+
+func appendProtoVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendProtoTag(b []byte, field int, wireType int) []byte {
+	return appendProtoVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// appendProtoBytes appends a length-delimited field, omitting it if empty
+// as proto3 does.
+func appendProtoBytes(b []byte, field int, value []byte) []byte {
+	if len(value) == 0 {
+		return b
+	}
+	b = appendProtoTag(b, field, protoWireBytes)
+	b = appendProtoVarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendProtoString(b []byte, field int, value string) []byte {
+	return appendProtoBytes(b, field, []byte(value))
+}
+
+// appendProtoDouble appends a double field, omitting it if zero as proto3
+// does.
+func appendProtoDouble(b []byte, field int, value float64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = appendProtoTag(b, field, protoWireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(value))
+	return append(b, buf[:]...)
+}
+
+// EncodeGrabProtobuf converts a result line of the JSON output into a Grab
+// message of output.proto. Scanners are written in order of name.
+func EncodeGrabProtobuf(result []byte) ([]byte, error) {
+	var grab encodedGrab
+	if err := json.Unmarshal(result, &grab); err != nil {
+		return nil, err
+	}
+	ret := appendProtoTag(nil, protoGrabVersion, protoWireVarint)
+	ret = appendProtoVarint(ret, ProtobufEnvelopeVersion)
+	ret = appendProtoString(ret, protoGrabIP, grab.IP)
+	ret = appendProtoString(ret, protoGrabDomain, grab.Domain)
+	names := make([]string, 0, len(grab.Data))
+	for name := range grab.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res := grab.Data[name]
+		var response []byte
+		response = appendProtoString(response, protoResponseStatus, res.Status)
+		response = appendProtoString(response, protoResponseProtocol, res.Protocol)
+		if string(res.Result) != "null" {
+			response = appendProtoBytes(response, protoResponseResult, res.Result)
+		}
+		response = appendProtoString(response, protoResponseTimestamp, res.Timestamp)
+		if res.Error != nil {
+			response = appendProtoString(response, protoResponseError, res.Error.Message)
+			response = appendProtoTag(response, protoResponseHasError, protoWireVarint)
+			response = appendProtoVarint(response, 1)
+			response = appendProtoString(response, protoResponseCategory, string(res.Error.Category))
+			if res.Error.TLSAlert != nil {
+				response = appendProtoTag(response, protoResponseTLSAlert, protoWireVarint)
+				response = appendProtoVarint(response, uint64(*res.Error.TLSAlert))
+			}
+		}
+		if res.Timing != nil {
+			var timing []byte
+			timing = appendProtoString(timing, protoTimingStart, res.Timing.Start)
+			timing = appendProtoString(timing, protoTimingEnd, res.Timing.End)
+			timing = appendProtoDouble(timing, protoTimingDuration, res.Timing.Duration)
+			timing = appendProtoDouble(timing, protoTimingDial, res.Timing.Dial)
+			timing = appendProtoDouble(timing, protoTimingTLSHandshake, res.Timing.TLSHandshake)
+			response = appendProtoBytes(response, protoResponseTiming, timing)
+		}
+		// A map entry is a message with the key and value; the value is
+		// written even if empty.
+		entry := appendProtoString(nil, protoMapKey, name)
+		entry = appendProtoTag(entry, protoMapValue, protoWireBytes)
+		entry = appendProtoVarint(entry, uint64(len(response)))
+		entry = append(entry, response...)
+		ret = appendProtoBytes(ret, protoGrabData, entry)
+	}
+	if grab.SchemaVersion != 0 {
+		ret = appendProtoTag(ret, protoGrabSchema, protoWireVarint)
+		ret = appendProtoVarint(ret, grab.SchemaVersion)
+	}
+	if grab.Port != 0 {
+		ret = appendProtoTag(ret, protoGrabPort, protoWireVarint)
+		ret = appendProtoVarint(ret, grab.Port)
+	}
+	return ret, nil
+}
+
+// OutputResultsProtobufFunc returns an OutputResultsFunc that writes the
+// results to w as a stream of length-delimited Grab messages.
+func OutputResultsProtobufFunc(w io.Writer) OutputResultsFunc {
+	buf := bufio.NewWriter(w)
+	return func(results <-chan []byte) error {
+		defer buf.Flush()
+		for result := range results {
+			message, err := EncodeGrabProtobuf(result)
+			if err != nil {
+				return err
+			}
+			if _, err := buf.Write(appendProtoVarint(nil, uint64(len(message)))); err != nil {
+				return err
+			}
+			if _, err := buf.Write(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,128 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// protoFields decodes the fields of a message written by the envelope
+// encoder, by field number.
+func protoFields(t *testing.T, message []byte) map[int][]interface{} {
+	ret := make(map[int][]interface{})
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			t.Fatalf("bad tag in %x", message)
+		}
+		message = message[n:]
+		field := int(tag >> 3)
+		if tag&7 == protoWireFixed64 {
+			ret[field] = append(ret[field], math.Float64frombits(binary.LittleEndian.Uint64(message)))
+			message = message[8:]
+			continue
+		}
+		value, n := binary.Uvarint(message)
+		if n <= 0 {
+			t.Fatalf("bad varint in %x", message)
+		}
+		message = message[n:]
+		switch tag & 7 {
+		case protoWireVarint:
+			ret[field] = append(ret[field], value)
+		case protoWireBytes:
+			ret[field] = append(ret[field], message[:value])
+			message = message[value:]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+	return ret
+}
+
+func TestOutputResultsProtobuf(t *testing.T) {
+	results := make(chan []byte, 2)
+	results <- []byte(`{"ip":"10.0.0.1","data":{"tls":{"status":"unknown-error","protocol":"tls","timestamp":"2020-01-01T00:00:00Z","error":{"category":"tls-alert","tls_alert":40,"message":"remote error: handshake failure"}},"http":{"status":"success","protocol":"http","result":{"response":{"status_code":200}},"timestamp":"2020-01-01T00:00:00Z","timing":{"start":"2020-01-01T00:00:00.000Z","end":"2020-01-01T00:00:00.125Z","duration_ms":125,"dial_ms":2.5}}},"port":8443,"schema_version":1}`)
+	results <- []byte(`{"domain":"example.com","data":{}}`)
+	close(results)
+	var out bytes.Buffer
+	if err := OutputResultsProtobufFunc(&out)(results); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages [][]byte
+	stream := out.Bytes()
+	for len(stream) > 0 {
+		length, n := binary.Uvarint(stream)
+		if n <= 0 || uint64(len(stream)-n) < length {
+			t.Fatalf("bad length prefix in %x", stream)
+		}
+		messages = append(messages, stream[n:n+int(length)])
+		stream = stream[n+int(length):]
+	}
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, expected 2", len(messages))
+	}
+
+	grab := protoFields(t, messages[0])
+	if !reflect.DeepEqual(grab[protoGrabVersion], []interface{}{uint64(ProtobufEnvelopeVersion)}) {
+		t.Errorf("version %v", grab[protoGrabVersion])
+	}
+	if version := grab[protoGrabSchema]; len(version) != 1 || version[0] != uint64(OutputSchemaVersion) {
+		t.Errorf("schema_version %v", version)
+	}
+	if port := grab[protoGrabPort]; len(port) != 1 || port[0] != uint64(8443) {
+		t.Errorf("port %v", port)
+	}
+	if ip := string(grab[protoGrabIP][0].([]byte)); ip != "10.0.0.1" {
+		t.Errorf("ip %q", ip)
+	}
+	if _, ok := grab[protoGrabDomain]; ok {
+		t.Error("empty domain written")
+	}
+	if len(grab[protoGrabData]) != 2 {
+		t.Fatalf("got %d scanners, expected 2", len(grab[protoGrabData]))
+	}
+	entry := protoFields(t, grab[protoGrabData][0].([]byte))
+	if name := string(entry[protoMapKey][0].([]byte)); name != "http" {
+		t.Errorf("first scanner %q, expected http", name)
+	}
+	response := protoFields(t, entry[protoMapValue][0].([]byte))
+	if result := string(response[protoResponseResult][0].([]byte)); result != `{"response":{"status_code":200}}` {
+		t.Errorf("result %s", result)
+	}
+	timing := protoFields(t, response[protoResponseTiming][0].([]byte))
+	if end := string(timing[protoTimingEnd][0].([]byte)); end != "2020-01-01T00:00:00.125Z" || timing[protoTimingDuration][0] != 125.0 || timing[protoTimingDial][0] != 2.5 {
+		t.Errorf("timing %v", timing)
+	}
+	if _, ok := timing[protoTimingTLSHandshake]; ok {
+		t.Error("tls_handshake_ms written without a handshake")
+	}
+	if _, ok := response[protoResponseHasError]; ok {
+		t.Error("has_error set without an error")
+	}
+	entry = protoFields(t, grab[protoGrabData][1].([]byte))
+	response = protoFields(t, entry[protoMapValue][0].([]byte))
+	if status := string(response[protoResponseStatus][0].([]byte)); status != "unknown-error" {
+		t.Errorf("status %q", status)
+	}
+	if _, ok := response[protoResponseResult]; ok {
+		t.Error("result written for a missing result")
+	}
+	if e := string(response[protoResponseError][0].([]byte)); e != "remote error: handshake failure" || response[protoResponseHasError][0] != uint64(1) {
+		t.Errorf("error %q, has_error %v", e, response[protoResponseHasError])
+	}
+	if category := string(response[protoResponseCategory][0].([]byte)); category != "tls-alert" || response[protoResponseTLSAlert][0] != uint64(40) {
+		t.Errorf("error category %q, tls_alert %v", category, response[protoResponseTLSAlert])
+	}
+
+	grab = protoFields(t, messages[1])
+	if domain := string(grab[protoGrabDomain][0].([]byte)); domain != "example.com" {
+		t.Errorf("domain %q", domain)
+	}
+	if _, ok := grab[protoGrabData]; ok {
+		t.Error("data written for no scanners")
+	}
+}
@@ -0,0 +1,205 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// recordStatuses is an output record as read back for its statuses.
+type recordStatuses struct {
+	Resolution *Resolution `json:"resolution"`
+	Data       map[string]struct {
+		Status ScanStatus `json:"status"`
+	} `json:"data"`
+}
+
+// recordStatus returns the status of an output record: success if any of
+// its scanners succeeded, else success-not-contain if one did, else the
+// status of the first scanner by name. A record without scanners failed
+// resolution with dns-error.
+func recordStatus(result []byte) ScanStatus {
+	var record recordStatuses
+	if err := json.Unmarshal(result, &record); err != nil {
+		return SCAN_UNKNOWN_ERROR
+	}
+	if len(record.Data) == 0 {
+		if record.Resolution != nil && record.Resolution.Error != "" {
+			return SCAN_DNS_ERROR
+		}
+		return SCAN_UNKNOWN_ERROR
+	}
+	names := make([]string, 0, len(record.Data))
+	ret := ScanStatus("")
+	for name, response := range record.Data {
+		switch {
+		case response.Status == SCAN_SUCCESS:
+			return SCAN_SUCCESS
+		case response.Status == SCAN_SUCCESS_NOTCONTAIN:
+			ret = SCAN_SUCCESS_NOTCONTAIN
+		}
+		names = append(names, name)
+	}
+	if ret != "" {
+		return ret
+	}
+	sort.Strings(names)
+	return record.Data[names[0]].Status
+}
+
+// isSuccess returns true if the record status is a success.
+func isSuccess(status ScanStatus) bool {
+	return status == SCAN_SUCCESS || status == SCAN_SUCCESS_NOTCONTAIN
+}
+
+// OutputSplitStats counts the output records by status, with
+// --output-success, --output-failure, --split-output-by-status or
+// --no-record-failures.
+type OutputSplitStats struct {
+	Records     map[ScanStatus]int64 `json:"records"`
+	NotRecorded int64                `json:"not_recorded"`
+}
+
+// outputSplitter passes the output records to separate streams by status,
+// each written by the output of --output-format to its own files.
+type outputSplitter struct {
+	// success and failure are the streams of the successful and failed
+	// records; empty for the main output.
+	success string
+	failure string
+
+	// dir is the directory of --split-output-by-status, with a file for
+	// each status named after it with the extension ext.
+	dir string
+	ext string
+
+	// noFailures drops the failed records.
+	noFailures bool
+
+	mu    sync.Mutex
+	stats OutputSplitStats
+}
+
+// outputFormatExtensions are the extensions of the files of
+// --split-output-by-status, by --output-format.
+var outputFormatExtensions = map[string]string{
+	"json":       ".json",
+	"protobuf":   ".pb",
+	"msgpack":    ".msgpack",
+	"csv":        ".csv",
+	"jsonl-flat": ".jsonl",
+}
+
+// mainStream is the stream of the main output.
+const mainStream = ""
+
+// stream returns the stream of a record with the status, and false if it is
+// not recorded.
+func (s *outputSplitter) stream(status ScanStatus) (string, bool) {
+	success := isSuccess(status)
+	switch {
+	case !success && s.noFailures:
+		return "", false
+	case s.dir != "":
+		return filepath.Join(s.dir, string(status)+s.ext), true
+	case success:
+		return s.success, true
+	}
+	return s.failure, true
+}
+
+// count adds a record with the status to the stats.
+func (s *outputSplitter) count(status ScanStatus, recorded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.Records == nil {
+		s.stats.Records = make(map[ScanStatus]int64)
+	}
+	s.stats.Records[status]++
+	if !recorded {
+		s.stats.NotRecorded++
+	}
+}
+
+// results returns an OutputResultsFunc that passes each record on to the
+// output of its stream, returned by open: the main output, and the success
+// and failure files, are started at once, and the files of
+// --split-output-by-status on their first record.
+func (s *outputSplitter) results(main OutputResultsFunc, open func(name string) OutputResultsFunc) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		streams := make(map[string]chan<- []byte)
+		var wg sync.WaitGroup
+		var failed int32
+		errs := make(chan error, 1)
+		start := func(name string) chan<- []byte {
+			output := main
+			if name != mainStream {
+				output = open(name)
+			}
+			ch := make(chan []byte)
+			streams[name] = ch
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := output(ch)
+				if err != nil && atomic.CompareAndSwapInt32(&failed, 0, 1) {
+					errs <- err
+				}
+				// The rest of the records are drained if the output
+				// failed, so that the sender does not block.
+				for range ch {
+				}
+			}()
+			return ch
+		}
+		for _, name := range []string{mainStream, s.success, s.failure} {
+			if _, ok := streams[name]; !ok {
+				start(name)
+			}
+		}
+		for result := range results {
+			if atomic.LoadInt32(&failed) != 0 {
+				break
+			}
+			status := recordStatus(result)
+			name, ok := s.stream(status)
+			s.count(status, ok)
+			if !ok {
+				continue
+			}
+			ch, ok := streams[name]
+			if !ok {
+				ch = start(name)
+			}
+			ch <- result
+		}
+		for _, ch := range streams {
+			close(ch)
+		}
+		wg.Wait()
+		select {
+		case err := <-errs:
+			return err
+		default:
+			return nil
+		}
+	}
+}
+
+// GetOutputSplitStats returns the counts of the output records by status,
+// or nil if the output is not split.
+func GetOutputSplitStats() *OutputSplitStats {
+	s := config.outputSplitter
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := &OutputSplitStats{Records: make(map[ScanStatus]int64, len(s.stats.Records)), NotRecorded: s.stats.NotRecorded}
+	for status, n := range s.stats.Records {
+		ret.Records[status] = n
+	}
+	return ret
+}
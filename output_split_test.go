@@ -0,0 +1,130 @@
+package zgrab2
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var splitResults = []string{
+	`{"ip":"10.0.0.1","data":{"http":{"status":"success"},"tls":{"status":"io-timeout"}}}`,
+	`{"ip":"10.0.0.2","data":{"http":{"status":"connection-refused"},"tls":{"status":"io-timeout"}}}`,
+	`{"ip":"10.0.0.3","data":{"banner":{"status":"success-not-contain"}}}`,
+	`{"domain":"example.invalid","resolution":{"error":"no such host"}}`,
+	`{"ip":"10.0.0.4","data":{"tls":{"status":"io-timeout"}}}`,
+}
+
+func TestRecordStatus(t *testing.T) {
+	expected := []ScanStatus{SCAN_SUCCESS, SCAN_CONNECTION_REFUSED, SCAN_SUCCESS_NOTCONTAIN, SCAN_DNS_ERROR, SCAN_IO_TIMEOUT}
+	for i, result := range splitResults {
+		if status := recordStatus([]byte(result)); status != expected[i] {
+			t.Errorf("%s: got %s, expected %s", result, status, expected[i])
+		}
+	}
+}
+
+// splitOutput runs the results through the splitter, and returns the IPs or
+// domains of the records written to each stream.
+func splitOutput(t *testing.T, s *outputSplitter) map[string][]string {
+	var mu sync.Mutex
+	ret := make(map[string][]string)
+	collect := func(name string) OutputResultsFunc {
+		return func(results <-chan []byte) error {
+			for result := range results {
+				record := string(result)
+				key := record[strings.Index(record, `":"`)+3:]
+				mu.Lock()
+				ret[name] = append(ret[name], key[:strings.IndexByte(key, '"')])
+				mu.Unlock()
+			}
+			return nil
+		}
+	}
+	results := make(chan []byte, len(splitResults))
+	for _, result := range splitResults {
+		results <- []byte(result)
+	}
+	close(results)
+	if err := s.results(collect("main"), collect)(results); err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestOutputSplitter(t *testing.T) {
+	s := &outputSplitter{failure: "failure.json"}
+	got := splitOutput(t, s)
+	expected := map[string][]string{
+		"main":         {"10.0.0.1", "10.0.0.3"},
+		"failure.json": {"10.0.0.2", "example.invalid", "10.0.0.4"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+
+	s = &outputSplitter{dir: "out", ext: ".json"}
+	got = splitOutput(t, s)
+	expected = map[string][]string{
+		filepath.Join("out", "success.json"):             {"10.0.0.1"},
+		filepath.Join("out", "connection-refused.json"):  {"10.0.0.2"},
+		filepath.Join("out", "success-not-contain.json"): {"10.0.0.3"},
+		filepath.Join("out", "dns-error.json"):           {"example.invalid"},
+		filepath.Join("out", "io-timeout.json"):          {"10.0.0.4"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+
+	s = &outputSplitter{success: "success.json", noFailures: true}
+	got = splitOutput(t, s)
+	if !reflect.DeepEqual(got, map[string][]string{"success.json": {"10.0.0.1", "10.0.0.3"}}) {
+		t.Errorf("got %v", got)
+	}
+	stats := OutputSplitStats{
+		Records: map[ScanStatus]int64{
+			SCAN_SUCCESS:            1,
+			SCAN_CONNECTION_REFUSED: 1,
+			SCAN_SUCCESS_NOTCONTAIN: 1,
+			SCAN_DNS_ERROR:          1,
+			SCAN_IO_TIMEOUT:         1,
+		},
+		NotRecorded: 3,
+	}
+	if !reflect.DeepEqual(s.stats, stats) {
+		t.Errorf("stats %+v, expected %+v", s.stats, stats)
+	}
+}
+
+func TestOutputSplitterFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := outputFiles{}
+	s := &outputSplitter{dir: dir, ext: ".csv"}
+	output := s.results(func(results <-chan []byte) error {
+		for range results {
+			t.Error("record written to the main output")
+		}
+		return nil
+	}, func(name string) OutputResultsFunc {
+		stream := files
+		stream.name = name
+		return stream.results(OutputResultsCSVFunc, []string{"ip"})
+	})
+	results := make(chan []byte, len(splitResults))
+	for _, result := range splitResults {
+		results <- []byte(result)
+	}
+	close(results)
+	if err := output(results); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "io-timeout.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ip\n10.0.0.4\n" {
+		t.Errorf("got %q", data)
+	}
+}
@@ -0,0 +1,210 @@
+package zgrab2
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WebhookStats counts the results POSTed to --output-webhook.
+type WebhookStats struct {
+	Batches        int64 `json:"batches"`
+	ResultsSent    int64 `json:"results_sent"`
+	ResultsDropped int64 `json:"results_dropped"`
+}
+
+// webhookSink POSTs the output records to --output-webhook in batches of
+// NDJSON, retrying failed requests with exponential backoff.
+type webhookSink struct {
+	url       string
+	secret    []byte
+	batchSize int
+	interval  time.Duration
+	retries   int
+
+	// retryDelay is the delay before the first retry, doubled for each
+	// next one up to maxRetryDelay.
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	client *http.Client
+	stats  WebhookStats
+}
+
+// webhookSignatureHeader holds the HMAC-SHA256 of the body with
+// --output-webhook-secret, as sha256=HEX.
+const webhookSignatureHeader = "X-Zgrab2-Signature"
+
+// newWebhookSink returns the webhookSink of the --output-webhook-* options,
+// or nil without --output-webhook.
+func newWebhookSink(c *Config) (*webhookSink, error) {
+	if c.OutputWebhook == "" {
+		return nil, nil
+	}
+	if c.OutputWebhookBatch <= 0 {
+		return nil, fmt.Errorf("invalid --output-webhook-batch %d", c.OutputWebhookBatch)
+	}
+	if c.WebhookRetries < 0 {
+		return nil, fmt.Errorf("invalid --output-webhook-retries %d", c.WebhookRetries)
+	}
+	return &webhookSink{
+		url:           c.OutputWebhook,
+		secret:        []byte(c.WebhookSecret),
+		batchSize:     c.OutputWebhookBatch,
+		interval:      c.WebhookInterval,
+		retries:       c.WebhookRetries,
+		retryDelay:    time.Second,
+		maxRetryDelay: time.Minute,
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// retryable returns true if a request that got the status code may be
+// retried.
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// post sends one batch. On failure, it returns whether the request may be
+// retried, and the delay asked by a Retry-After header, if any.
+func (w *webhookSink) post(body []byte) (time.Duration, bool, error) {
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+	var after time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		after = time.Duration(seconds) * time.Second
+	}
+	return after, retryable(resp.StatusCode), fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// send POSTs a batch of n records, retrying up to --output-webhook-retries
+// times. A batch that could not be sent is dropped.
+func (w *webhookSink) send(body []byte, n int) {
+	delay := w.retryDelay
+	for attempt := 0; ; attempt++ {
+		after, retry, err := w.post(body)
+		if err == nil {
+			atomic.AddInt64(&w.stats.Batches, 1)
+			atomic.AddInt64(&w.stats.ResultsSent, int64(n))
+			return
+		}
+		if !retry || attempt >= w.retries {
+			log.Errorf("could not send %d results to --output-webhook: %v", n, err)
+			atomic.AddInt64(&w.stats.ResultsDropped, int64(n))
+			return
+		}
+		if after < delay {
+			after = delay
+		}
+		log.Warnf("--output-webhook: %v, retrying in %s", err, after)
+		time.Sleep(after)
+		if delay *= 2; delay > w.maxRetryDelay {
+			delay = w.maxRetryDelay
+		}
+	}
+}
+
+// wrap returns an OutputResultsFunc that passes the results on to next, and
+// POSTs them to the webhook in batches of --output-webhook-batch records, or
+// of the records of --output-webhook-interval if fewer. The batches are sent
+// in order in the background; if the webhook falls behind, the output waits
+// for it.
+func (w *webhookSink) wrap(next OutputResultsFunc) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		type batch struct {
+			body []byte
+			n    int
+		}
+		batches := make(chan batch, 4)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				w.send(b.body, b.n)
+			}
+		}()
+		defer wg.Wait()
+		defer close(batches)
+
+		passed := make(chan []byte)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- next(passed)
+		}()
+		var body []byte
+		n := 0
+		flush := func() {
+			if n > 0 {
+				batches <- batch{body, n}
+				body, n = nil, 0
+			}
+		}
+		var tick <-chan time.Time
+		if w.interval > 0 {
+			ticker := time.NewTicker(w.interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case result, ok := <-results:
+				if !ok {
+					flush()
+					close(passed)
+					return <-errs
+				}
+				body = append(append(body, result...), '\n')
+				if n++; n >= w.batchSize {
+					flush()
+				}
+				select {
+				case passed <- result:
+				case err := <-errs:
+					return err
+				}
+			case <-tick:
+				flush()
+			}
+		}
+	}
+}
+
+// GetWebhookStats returns the counts of the results POSTed to
+// --output-webhook, or nil without it.
+func GetWebhookStats() *WebhookStats {
+	w := config.webhook
+	if w == nil {
+		return nil
+	}
+	return &WebhookStats{
+		Batches:        atomic.LoadInt64(&w.stats.Batches),
+		ResultsSent:    atomic.LoadInt64(&w.stats.ResultsSent),
+		ResultsDropped: atomic.LoadInt64(&w.stats.ResultsDropped),
+	}
+}
@@ -0,0 +1,98 @@
+package zgrab2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var mutex sync.Mutex
+	var received []string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		// Every other request fails once.
+		if requests%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Content-Type %s", ct)
+		}
+		mac := hmac.New(sha256.New, []byte("key"))
+		mac.Write(body)
+		if sig := r.Header.Get(webhookSignatureHeader); sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("bad signature %s", sig)
+		}
+		received = append(received, string(body))
+	}))
+	defer server.Close()
+
+	w, err := newWebhookSink(&Config{OutputWebhook: server.URL, OutputWebhookBatch: 2, WebhookRetries: 1, WebhookSecret: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.retryDelay = time.Millisecond
+	var output int
+	outputFunc := w.wrap(func(results <-chan []byte) error {
+		for range results {
+			output++
+		}
+		return nil
+	})
+	results := make(chan []byte, 3)
+	for i := 1; i <= 3; i++ {
+		results <- []byte(fmt.Sprintf(`{"ip":"192.0.2.%d"}`, i))
+	}
+	close(results)
+	if err := outputFunc(results); err != nil {
+		t.Fatal(err)
+	}
+	if output != 3 {
+		t.Errorf("expected all 3 results to be passed through, got %d", output)
+	}
+	expected := []string{
+		"{\"ip\":\"192.0.2.1\"}\n{\"ip\":\"192.0.2.2\"}\n",
+		"{\"ip\":\"192.0.2.3\"}\n",
+	}
+	if strings.Join(received, "|") != strings.Join(expected, "|") {
+		t.Errorf("received %q, expected %q", received, expected)
+	}
+	if w.stats != (WebhookStats{Batches: 2, ResultsSent: 3}) {
+		t.Errorf("stats %+v", w.stats)
+	}
+}
+
+func TestWebhookSinkDrop(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	w, err := newWebhookSink(&Config{OutputWebhook: server.URL, OutputWebhookBatch: 10, WebhookRetries: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.retryDelay = time.Millisecond
+	w.send([]byte("{}\n"), 1)
+	if requests != 1 {
+		t.Errorf("a 400 response was retried: %d requests", requests)
+	}
+	if w.stats != (WebhookStats{ResultsDropped: 1}) {
+		t.Errorf("stats %+v", w.stats)
+	}
+}
@@ -0,0 +1,383 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// pcapLinkTypeRaw is the link type of packets starting with their IPv4
+	// or IPv6 header.
+	pcapLinkTypeRaw = 101
+
+	// pcapSnapLen is the snapshot length of the capture files; the packets
+	// are never truncated.
+	pcapSnapLen = 262144
+
+	// pcapMaxSegment is the largest payload of a packet, fitting the IP
+	// length fields; longer reads and writes are split.
+	pcapMaxSegment = 32768
+
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagPSH = 0x08
+	tcpFlagACK = 0x10
+)
+
+// PacketCapture writes the bytes of the connections of a sample of the
+// targets to a pcap file per target, as --pcap-dir. The packets are
+// synthesized from what the connections read and wrote, with the addresses
+// and ports of the connections: TCP connections start with a handshake and
+// end with a FIN, so that tools like Wireshark can follow their streams,
+// but the retransmissions and segmentation on the wire are not seen.
+type PacketCapture struct {
+	dir  string
+	rate float64
+
+	mutex  sync.Mutex
+	random *rand.Rand
+}
+
+// NewPacketCapture returns a PacketCapture writing to dir, which is created
+// if needed, the connections of each target with probability rate.
+func NewPacketCapture(dir string, rate float64) (*PacketCapture, error) {
+	if rate <= 0 || rate > 1 {
+		return nil, fmt.Errorf("the sample rate must be in (0, 1], not %g", rate)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &PacketCapture{dir: dir, rate: rate, random: rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+}
+
+// target returns the capture of the target, or nil if it is not sampled.
+func (c *PacketCapture) target(t *ScanTarget) *targetCapture {
+	if c == nil {
+		return nil
+	}
+	if c.rate < 1 {
+		c.mutex.Lock()
+		sampled := c.random.Float64() < c.rate
+		c.mutex.Unlock()
+		if !sampled {
+			return nil
+		}
+	}
+	return &targetCapture{path: filepath.Join(c.dir, captureFileName(t))}
+}
+
+// captureFileName returns the name of the capture file of a target, from
+// its domain, IP, port and tag.
+func captureFileName(t *ScanTarget) string {
+	var parts []string
+	if t.Domain != "" {
+		parts = append(parts, t.Domain)
+	}
+	if t.IP != nil {
+		parts = append(parts, t.IP.String())
+	}
+	if t.Port != nil {
+		parts = append(parts, strconv.FormatUint(uint64(*t.Port), 10))
+	}
+	if t.Tag != "" {
+		parts = append(parts, t.Tag)
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, "_"))
+	return name + ".pcap"
+}
+
+// targetCapture is the capture file of a target, shared by the connections
+// of its scans. The file is created with the first connection; if a file
+// of the same name exists, e.g. with --connections-per-host, a number is
+// added to the name.
+type targetCapture struct {
+	path string
+
+	mutex  sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	closed bool
+	failed bool
+}
+
+// open returns the capture of a connection of the target, or nil if the
+// target is not captured.
+func (t *targetCapture) open(conn net.Conn) *connCapture {
+	if t == nil || conn == nil {
+		return nil
+	}
+	ret := &connCapture{target: t}
+	switch remote := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		ret.remote, ret.remotePort = remote.IP, remote.Port
+	case *net.UDPAddr:
+		ret.remote, ret.remotePort, ret.udp = remote.IP, remote.Port, true
+	}
+	switch local := conn.LocalAddr().(type) {
+	case *net.TCPAddr:
+		ret.local, ret.localPort = local.IP, local.Port
+	case *net.UDPAddr:
+		ret.local, ret.localPort = local.IP, local.Port
+	}
+	if ret.local.To4() == nil || ret.remote.To4() == nil {
+		ret.local, ret.remote = ret.local.To16(), ret.remote.To16()
+	} else {
+		ret.local, ret.remote = ret.local.To4(), ret.remote.To4()
+	}
+	if ret.local == nil {
+		ret.local = net.IPv4zero.To4()
+	}
+	if ret.remote == nil {
+		ret.remote = make(net.IP, len(ret.local))
+	}
+	if !ret.udp {
+		// The local end starts at sequence number 0, the remote at
+		// 0x10000000, so that the streams are easy to tell apart.
+		now := time.Now()
+		ret.remoteSeq = 0x10000000
+		ret.packet(now, true, tcpFlagSYN, nil)
+		ret.localSeq++
+		ret.packet(now, false, tcpFlagSYN|tcpFlagACK, nil)
+		ret.remoteSeq++
+		ret.packet(now, true, tcpFlagACK, nil)
+	}
+	return ret
+}
+
+// write writes a packet to the capture file, creating it if needed.
+func (t *targetCapture) write(at time.Time, packet []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed || t.failed {
+		return
+	}
+	if t.file == nil {
+		if err := t.create(); err != nil {
+			log.Errorf("--pcap-dir: could not create %s: %s", t.path, err)
+			t.failed = true
+			return
+		}
+	}
+	var header [16]byte
+	binary.LittleEndian.PutUint32(header[0:], uint32(at.Unix()))
+	binary.LittleEndian.PutUint32(header[4:], uint32(at.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(packet)))
+	t.writer.Write(header[:])
+	t.writer.Write(packet)
+}
+
+// create creates the capture file and writes its header.
+func (t *targetCapture) create() error {
+	path := t.path
+	for i := 2; ; i++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && i < 1000 {
+			path = strings.TrimSuffix(t.path, ".pcap") + "-" + strconv.Itoa(i) + ".pcap"
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		t.file = file
+		break
+	}
+	t.writer = bufio.NewWriter(t.file)
+	var header [24]byte
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:], pcapLinkTypeRaw)
+	_, err := t.writer.Write(header[:])
+	return err
+}
+
+// close closes the capture file, after the scans of the target. The
+// connections still open, e.g. of a scan abandoned by the watchdog, are no
+// longer captured.
+func (t *targetCapture) close() {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.closed = true
+	if t.file == nil {
+		return
+	}
+	if err := t.writer.Flush(); err != nil {
+		log.Errorf("--pcap-dir: could not write %s: %s", t.file.Name(), err)
+	}
+	t.file.Close()
+}
+
+// connCapture synthesizes the packets of a connection.
+type connCapture struct {
+	target *targetCapture
+	udp    bool
+
+	local, remote         net.IP
+	localPort, remotePort int
+
+	mutex sync.Mutex
+
+	// localSeq and remoteSeq are the next TCP sequence numbers of each end.
+	localSeq, remoteSeq uint32
+	closed              bool
+}
+
+// read captures the bytes read from the connection.
+func (c *connCapture) read(b []byte) {
+	c.data(false, b)
+}
+
+// written captures the bytes written to the connection.
+func (c *connCapture) written(b []byte) {
+	c.data(true, b)
+}
+
+func (c *connCapture) data(sent bool, b []byte) {
+	if c == nil || len(b) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	for len(b) > 0 {
+		n := len(b)
+		if n > pcapMaxSegment {
+			n = pcapMaxSegment
+		}
+		c.packet(now, sent, tcpFlagPSH|tcpFlagACK, b[:n])
+		if sent {
+			c.localSeq += uint32(n)
+		} else {
+			c.remoteSeq += uint32(n)
+		}
+		b = b[n:]
+	}
+}
+
+// close captures the local end closing a TCP connection.
+func (c *connCapture) close() {
+	if c == nil || c.udp {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.packet(time.Now(), true, tcpFlagFIN|tcpFlagACK, nil)
+	c.localSeq++
+}
+
+// packet writes a packet sent by the local end, or else received, with the
+// TCP flags or as a UDP datagram.
+func (c *connCapture) packet(at time.Time, sent bool, flags byte, payload []byte) {
+	src, dst, srcPort, dstPort := c.local, c.remote, c.localPort, c.remotePort
+	seq, ack := c.localSeq, c.remoteSeq
+	if !sent {
+		src, dst, srcPort, dstPort = dst, src, dstPort, srcPort
+		seq, ack = ack, seq
+	}
+	var transport []byte
+	protocol := byte(6)
+	if c.udp {
+		protocol = 17
+		transport = make([]byte, 8+len(payload))
+		binary.BigEndian.PutUint16(transport[0:], uint16(srcPort))
+		binary.BigEndian.PutUint16(transport[2:], uint16(dstPort))
+		binary.BigEndian.PutUint16(transport[4:], uint16(len(transport)))
+		copy(transport[8:], payload)
+		binary.BigEndian.PutUint16(transport[6:], transportChecksum(src, dst, protocol, transport))
+	} else {
+		transport = make([]byte, 20+len(payload))
+		binary.BigEndian.PutUint16(transport[0:], uint16(srcPort))
+		binary.BigEndian.PutUint16(transport[2:], uint16(dstPort))
+		binary.BigEndian.PutUint32(transport[4:], seq)
+		if flags&tcpFlagACK != 0 {
+			binary.BigEndian.PutUint32(transport[8:], ack)
+		}
+		transport[12] = 5 << 4
+		transport[13] = flags
+		binary.BigEndian.PutUint16(transport[14:], 65535)
+		copy(transport[20:], payload)
+		binary.BigEndian.PutUint16(transport[16:], transportChecksum(src, dst, protocol, transport))
+	}
+	c.target.write(at, ipPacket(src, dst, protocol, transport))
+}
+
+// ipPacket returns an IPv4 or IPv6 packet, as the family of the addresses,
+// with the payload.
+func ipPacket(src, dst net.IP, protocol byte, payload []byte) []byte {
+	if len(src) == net.IPv4len {
+		ret := make([]byte, 20+len(payload))
+		ret[0] = 0x45
+		binary.BigEndian.PutUint16(ret[2:], uint16(len(ret)))
+		ret[6] = 0x40 // don't fragment
+		ret[8] = 64
+		ret[9] = protocol
+		copy(ret[12:], src)
+		copy(ret[16:], dst)
+		binary.BigEndian.PutUint16(ret[10:], ^uint16(onesComplementSum(0, ret[:20])))
+		copy(ret[20:], payload)
+		return ret
+	}
+	ret := make([]byte, 40+len(payload))
+	ret[0] = 0x60
+	binary.BigEndian.PutUint16(ret[4:], uint16(len(payload)))
+	ret[6] = protocol
+	ret[7] = 64
+	copy(ret[8:], src)
+	copy(ret[24:], dst)
+	copy(ret[40:], payload)
+	return ret
+}
+
+// transportChecksum returns the TCP or UDP checksum of a segment, with the
+// pseudo-header of the addresses.
+func transportChecksum(src, dst net.IP, protocol byte, segment []byte) uint16 {
+	sum := onesComplementSum(0, src)
+	sum = onesComplementSum(sum, dst)
+	sum += uint32(protocol) + uint32(len(segment))
+	sum = onesComplementSum(sum, segment)
+	ret := ^uint16(sum)
+	if ret == 0 && protocol == 17 {
+		// A zero UDP checksum means none.
+		ret = 0xffff
+	}
+	return ret
+}
+
+// onesComplementSum adds the 16-bit words of b to sum, folding the carries.
+func onesComplementSum(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return sum
+}
@@ -0,0 +1,148 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// readPcap returns the packets of a capture file written by a
+// PacketCapture.
+func readPcap(t *testing.T, path string) [][]byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 24 || binary.LittleEndian.Uint32(data) != 0xa1b2c3d4 || binary.LittleEndian.Uint32(data[20:]) != pcapLinkTypeRaw {
+		t.Fatalf("bad pcap header % x", data[:24])
+	}
+	var packets [][]byte
+	for data = data[24:]; len(data) >= 16; {
+		n := int(binary.LittleEndian.Uint32(data[8:]))
+		packets = append(packets, data[16:16+n])
+		data = data[16+n:]
+	}
+	return packets
+}
+
+func TestPacketCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	capture, err := NewPacketCapture(filepath.Join(dir, "pcap"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 5)
+		conn.Read(buf)
+		conn.Write([]byte("pong!!"))
+	}()
+
+	port := uint(listener.Addr().(*net.TCPAddr).Port)
+	target := ScanTarget{IP: net.ParseIP("127.0.0.1"), Port: &port, Domain: "example.com"}
+	target.capture = capture.target(&target)
+	raw, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewTimeoutConnection(nil, raw, time.Second, 0, 0, 0)
+	conn.capture = target.capture.open(raw)
+	if _, err := conn.Write([]byte("ping!")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	target.capture.close()
+
+	path := filepath.Join(dir, "pcap", captureFileName(&target))
+	if filepath.Base(path) != "example.com_127.0.0.1_"+strconv.Itoa(int(port))+".pcap" {
+		t.Errorf("got capture file %s", path)
+	}
+	packets := readPcap(t, path)
+	flags := []byte{tcpFlagSYN, tcpFlagSYN | tcpFlagACK, tcpFlagACK, tcpFlagPSH | tcpFlagACK, tcpFlagPSH | tcpFlagACK, tcpFlagFIN | tcpFlagACK}
+	payloads := []string{"", "", "", "ping!", "pong!!", ""}
+	seqs := []uint32{0, 0x10000000, 1, 1, 0x10000001, 6}
+	if len(packets) != len(flags) {
+		t.Fatalf("got %d packets", len(packets))
+	}
+	localPort := uint16(raw.LocalAddr().(*net.TCPAddr).Port)
+	for i, packet := range packets {
+		if packet[0] != 0x45 || packet[9] != 6 || int(binary.BigEndian.Uint16(packet[2:])) != len(packet) {
+			t.Fatalf("packet %d: bad IPv4 header % x", i, packet[:20])
+		}
+		if onesComplementSum(0, packet[:20]) != 0xffff {
+			t.Errorf("packet %d: bad IPv4 checksum", i)
+		}
+		segment := packet[20:]
+		pseudo := onesComplementSum(onesComplementSum(0, packet[12:20]), segment) + 6 + uint32(len(segment))
+		if uint16(pseudo+pseudo>>16) != 0xffff {
+			t.Errorf("packet %d: bad TCP checksum", i)
+		}
+		sent := i != 1 && i != 4
+		if srcPort := binary.BigEndian.Uint16(segment); (srcPort == localPort) != sent {
+			t.Errorf("packet %d: source port %d, local port %d", i, srcPort, localPort)
+		}
+		if segment[13] != flags[i] || binary.BigEndian.Uint32(segment[4:]) != seqs[i] || string(segment[20:]) != payloads[i] {
+			t.Errorf("packet %d: flags %02x, seq %x, payload %q", i, segment[13], binary.BigEndian.Uint32(segment[4:]), segment[20:])
+		}
+	}
+
+	// The connections opened after the end of the target are not captured.
+	conn.capture = target.capture.open(raw)
+	conn.capture.written([]byte("late"))
+	if after := readPcap(t, path); len(after) != len(packets) {
+		t.Errorf("got %d packets after closing", len(after))
+	}
+}
+
+func TestPacketCaptureSampling(t *testing.T) {
+	if _, err := NewPacketCapture(os.TempDir(), 0); err == nil {
+		t.Error("expected an error with a zero sample rate")
+	}
+	capture, err := NewPacketCapture(os.TempDir(), 0.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		if capture.target(&ScanTarget{IP: net.ParseIP("192.0.2.1")}) != nil {
+			sampled++
+		}
+	}
+	if sampled < 2000 || sampled > 3000 {
+		t.Errorf("sampled %d targets of 10000 at 0.25", sampled)
+	}
+	var none *PacketCapture
+	if none.target(&ScanTarget{}) != nil {
+		t.Error("expected no capture without --pcap-dir")
+	}
+	if name := captureFileName(&ScanTarget{IP: net.ParseIP("2001:db8::1"), Tag: "a/b"}); name != "2001_db8__1_a_b.pcap" {
+		t.Errorf("got file name %s", name)
+	}
+	if !bytes.Equal(ipPacket(net.IPv6loopback, net.IPv6loopback, 17, []byte{1})[:8], []byte{0x60, 0, 0, 0, 0, 1, 17, 64}) {
+		t.Error("bad IPv6 header")
+	}
+}
@@ -1,10 +1,14 @@
 package zgrab2
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 
 	"github.com/Positive-Engineer/zgrab2/lib/output"
 	log "github.com/sirupsen/logrus"
@@ -12,9 +16,14 @@ import (
 
 // Grab contains all scan responses for a single host
 type Grab struct {
-	IP     string                  `json:"ip,omitempty"`
-	Domain string                  `json:"domain,omitempty"`
-	Data   map[string]ScanResponse `json:"data,omitempty"`
+	IP         string                  `json:"ip,omitempty"`
+	Domain     string                  `json:"domain,omitempty"`
+	Port       *uint                   `json:"port,omitempty"`
+	Resolution *Resolution             `json:"resolution,omitempty"`
+	Data       map[string]ScanResponse `json:"data,omitempty"`
+
+	// SchemaVersion is the OutputSchemaVersion of the record.
+	SchemaVersion int `json:"schema_version,omitempty"`
 }
 
 // ScanTarget is the host that will be scanned
@@ -23,6 +32,59 @@ type ScanTarget struct {
 	Domain string
 	Tag    string
 	Port   *uint
+
+	// Context is shared by the scanners run on the target, in order.
+	Context *TargetContext
+
+	// conns tracks the connections opened by a scan under the watchdog.
+	conns *connTracker
+
+	// sender is the index of the sender scanning the target, which selects
+	// its local address.
+	sender int
+
+	// localAddrs records the local addresses of the scan's connections.
+	localAddrs *localAddrLog
+
+	// memory is the --max-memory governor of the runner, if any.
+	memory *memoryGovernor
+
+	// dialOpts are the options of the runner for the target's connections.
+	dialOpts *dialOptions
+
+	// ctx is the context of the scan, see Ctx.
+	ctx context.Context
+
+	// index is the position of the target in the input.
+	index uint64
+
+	// resolution is the resolution of the target's domain by --resolve.
+	resolution *Resolution
+
+	// timing records the dial and TLS handshake times of the scan's
+	// connections.
+	timing *timingLog
+
+	// traffic counts the bytes of the scan's connections.
+	traffic *trafficLog
+
+	// capture is the capture file of the target's connections, if it is
+	// sampled by --pcap-dir.
+	capture *targetCapture
+
+	// fallbackIP is the resolved address of the other family than IP, which
+	// is dialed too with --happy-eyeballs.
+	fallbackIP net.IP
+}
+
+// Ctx returns the context of the scan, which is done when the scan is
+// abandoned by the watchdog or --target-timeout, or the scan is interrupted.
+// Connections opened through the target use it.
+func (target *ScanTarget) Ctx() context.Context {
+	if target.ctx == nil {
+		return context.Background()
+	}
+	return target.ctx
 }
 
 func (target ScanTarget) String() string {
@@ -43,6 +105,15 @@ func (target ScanTarget) String() string {
 	return res
 }
 
+// bytesReadLimit returns the read limit of a new connection of the scan:
+// limit if it is set, or else the default of the runner's memory governor.
+func (target *ScanTarget) bytesReadLimit(limit int) int {
+	if limit != 0 {
+		return limit
+	}
+	return target.memory.bytesReadLimit()
+}
+
 // Host gets the host identifier as a string: the IP address if it is available,
 // or the domain if not.
 func (target *ScanTarget) Host() string {
@@ -66,7 +137,14 @@ func (target *ScanTarget) Open(flags *BaseFlags) (net.Conn, error) {
 	}
 
 	address := net.JoinHostPort(target.Host(), fmt.Sprintf("%d", port))
-	return DialTimeoutConnection("tcp", address, flags.Timeout, flags.BytesReadLimit)
+	conn, err := target.dial(target.Ctx(), &net.Dialer{Timeout: flags.Timeout}, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	ret := NewTimeoutConnection(target.Ctx(), conn, flags.Timeout, flags.Timeout, flags.Timeout, target.bytesReadLimit(flags.BytesReadLimit))
+	ret.traffic = target.traffic
+	ret.capture = target.capture.open(conn)
+	return target.conns.track(ret, nil)
 }
 
 // OpenTLS connects to the ScanTarget using the configured flags, then performs
@@ -102,15 +180,26 @@ func (target *ScanTarget) OpenUDP(flags *BaseFlags, udp *UDPFlags) (net.Conn, er
 			local.Port = int(udp.LocalPort)
 		}
 	}
+	if err := target.Ctx().Err(); err != nil {
+		return nil, err
+	}
 	remote, err := net.ResolveUDPAddr("udp", address)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := net.DialUDP("udp", local, remote)
+	dialer := net.Dialer{Control: target.dialOpts.control()}
+	if local != nil {
+		dialer.LocalAddr = local
+	}
+	conn, err := dialer.DialContext(target.Ctx(), "udp", remote.String())
 	if err != nil {
 		return nil, err
 	}
-	return NewTimeoutConnection(nil, conn, flags.Timeout, 0, 0, flags.BytesReadLimit), nil
+	target.localAddrs.add(conn)
+	ret := NewTimeoutConnection(target.Ctx(), conn, flags.Timeout, 0, 0, target.bytesReadLimit(flags.BytesReadLimit))
+	ret.traffic = target.traffic
+	ret.capture = target.capture.open(conn)
+	return target.conns.track(ret, nil)
 }
 
 // BuildGrabFromInputResponse constructs a Grab object for a target, given the
@@ -122,9 +211,12 @@ func BuildGrabFromInputResponse(t *ScanTarget, responses map[string]ScanResponse
 		ipstr = t.IP.String()
 	}
 	return &Grab{
-		IP:     ipstr,
-		Domain: t.Domain,
-		Data:   responses,
+		IP:            ipstr,
+		Domain:        t.Domain,
+		Port:          t.Port,
+		Resolution:    t.resolution,
+		Data:          responses,
+		SchemaVersion: OutputSchemaVersion,
 	}
 }
 
@@ -148,52 +240,10 @@ func EncodeGrab(raw *Grab, includeDebug bool) ([]byte, error) {
 	return json.Marshal(outputData)
 }
 
-// grabTarget calls handler for each action
-func grabTarget(input ScanTarget, m *Monitor) []byte {
-	moduleResult := make(map[string]ScanResponse)
-
-	for _, scannerName := range orderedScanners {
-		scanner := scanners[scannerName]
-		trigger := (*scanner).GetTrigger()
-		if input.Tag != trigger {
-			continue
-		}
-		defer func(name string) {
-			if e := recover(); e != nil {
-				log.Errorf("Panic on scanner %s when scanning target %s: %#v", scannerName, input.String(), e)
-				// Bubble out original error (with original stack) in lieu of explicitly logging the stack / error
-				panic(e)
-			}
-		}(scannerName)
-		name, res := RunScanner(*scanner, m, input)
-		moduleResult[name] = res
-		if res.Error != nil && !config.Multiple.ContinueOnError {
-			break
-		}
-		if res.Status == SCAN_SUCCESS && config.Multiple.BreakOnSuccess {
-			break
-		}
-	}
-
-	raw := BuildGrabFromInputResponse(&input, moduleResult)
-	result, err := EncodeGrab(raw, includeDebugOutput())
-	if err != nil {
-		log.Fatalf("unable to marshal data: %s", err)
-	}
-
-	return result
-}
-
 // Process sets up an output encoder, input reader, and starts grab workers.
 func Process(mon *Monitor) {
-	workers := config.Senders
-	processQueue := make(chan ScanTarget, workers*4)
-	outputQueue := make(chan []byte, workers*4)
-
-	//Create wait groups
-	var workerDone sync.WaitGroup
+	outputQueue := make(chan []byte, config.Senders*4)
 	var outputDone sync.WaitGroup
-	workerDone.Add(int(workers))
 	outputDone.Add(1)
 
 	// Start the output encoder
@@ -203,28 +253,65 @@ func Process(mon *Monitor) {
 			log.Fatal(err)
 		}
 	}()
-	//Start all the workers
-	for i := 0; i < workers; i++ {
-		go func(i int) {
-			for _, scannerName := range orderedScanners {
-				scanner := *scanners[scannerName]
-				scanner.InitPerSender(i)
-			}
-			for obj := range processQueue {
-				for run := uint(0); run < uint(config.ConnectionsPerHost); run++ {
-					result := grabTarget(obj, mon)
-					outputQueue <- result
-				}
-			}
-			workerDone.Done()
-		}(i)
-	}
-
-	if err := config.inputTargets(processQueue); err != nil {
+	var skipTargets uint64
+	if config.resume != nil {
+		skipTargets = config.resume.TargetsDone
+		log.Infof("resuming after %d targets", skipTargets)
+	}
+	var runner *Runner
+	runner, err := newCommandLineRunner(mon, func(raw *Grab) {
+		result, err := EncodeGrab(raw, includeDebugOutput())
+		if err != nil {
+			log.Fatalf("unable to marshal data: %s", err)
+		}
+		outputQueue <- runner.memory.shedResult(raw, result)
+	}, skipTargets)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var checkpointDone sync.WaitGroup
+	stopCheckpoints := make(chan struct{})
+	if config.Checkpoint != "" {
+		checkpointDone.Add(1)
+		go func() {
+			defer checkpointDone.Done()
+			writeCheckpoints(runner, stopCheckpoints)
+		}()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cancelOnInterrupt(cancel)
+	err = runner.RunContext(ctx)
+	if err == context.Canceled {
+		log.Warn("scan interrupted, the results of the targets in flight were written")
+	} else if err != nil {
 		log.Fatal(err)
 	}
-	close(processQueue)
-	workerDone.Wait()
 	close(outputQueue)
 	outputDone.Wait()
+	close(stopCheckpoints)
+	checkpointDone.Wait()
+	if config.Checkpoint != "" {
+		// The results are flushed, so that the targets done are all in the
+		// output.
+		checkpoint := newCheckpoint(runner)
+		checkpoint.Complete = err == nil
+		if err := checkpoint.Write(config.Checkpoint); err != nil {
+			log.Errorf("could not write the checkpoint: %s", err)
+		} else if !checkpoint.Complete {
+			log.Infof("checkpoint written to %s after %d targets, continue with --resume %s", config.Checkpoint, checkpoint.TargetsDone, config.Checkpoint)
+		}
+	}
+}
+
+// cancelOnInterrupt calls cancel on the first SIGINT or SIGTERM, to finish
+// the targets in flight and write their results, and exits on the second.
+func cancelOnInterrupt(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	log.Warn("interrupted, canceling the scans in flight (interrupt again to exit now)")
+	cancel()
+	<-signals
+	os.Exit(1)
 }
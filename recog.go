@@ -0,0 +1,304 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RecogMatch is a recog fingerprint matching a field of a result, with the
+// vendor, product and version it identifies.
+type RecogMatch struct {
+	// Field is the path of the field in the result, and Matches the kind
+	// of text recog matched it as, e.g. http_header.server.
+	Field   string `json:"field"`
+	Matches string `json:"matches"`
+
+	Description string `json:"description,omitempty"`
+
+	// Vendor, Product and Version are the service.* parameters of the
+	// fingerprint, or else its os.* or hw.* ones.
+	Vendor  string `json:"vendor,omitempty"`
+	Product string `json:"product,omitempty"`
+	Version string `json:"version,omitempty"`
+
+	// Params are all the parameters of the fingerprint, e.g. os.family or
+	// service.cpe23.
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// recogFile is the XML of a recog fingerprint database.
+type recogFile struct {
+	Matches      string `xml:"matches,attr"`
+	Fingerprints []struct {
+		Pattern     string `xml:"pattern,attr"`
+		Flags       string `xml:"flags,attr"`
+		Description string `xml:"description"`
+		Params      []struct {
+			Pos   int    `xml:"pos,attr"`
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"param"`
+	} `xml:"fingerprint"`
+}
+
+// recogParam is a parameter of a fingerprint: the group of the pattern at
+// pos, or value if pos is 0.
+type recogParam struct {
+	pos   int
+	name  string
+	value string
+}
+
+// recogFingerprint is a compiled fingerprint.
+type recogFingerprint struct {
+	description string
+	regex       *regexp.Regexp
+	params      []recogParam
+}
+
+// RecogDatabase holds the fingerprints of a directory of recog XML files, by
+// the kind of text they match.
+type RecogDatabase struct {
+	fingerprints map[string][]*recogFingerprint
+
+	// Skipped is the number of fingerprints whose pattern is not supported
+	// by Go regular expressions (e.g. lookarounds).
+	Skipped int
+}
+
+// recogField is a field of a result matched against the fingerprints of a
+// kind.
+type recogField struct {
+	path    string
+	matches string
+}
+
+// recogFields are the fields matched in the results of each protocol. The
+// kind of the banner of the banner module is that of its guessed_protocol.
+var recogFields = map[string][]recogField{
+	"ftp":    {{"banner", "ftp.banner"}},
+	"smtp":   {{"banner", "smtp.banner"}, {"ehlo", "smtp.ehlo"}},
+	"pop3":   {{"banner", "pop3.banner"}},
+	"imap":   {{"banner", "imap4.banner"}},
+	"telnet": {{"banner", "telnet.banner"}},
+	"ssh":    {{"server_id.raw", "ssh.banner"}},
+	"http": {
+		{"response.headers.server", "http_header.server"},
+		{"response.headers.set_cookie", "http_header.cookie"},
+		{"response.headers.www_authenticate", "http_header.wwwauth"},
+		{"html.title", "html_title"},
+	},
+}
+
+// recogBannerKinds are the kinds of the banners of the banner module, by
+// guessed protocol.
+var recogBannerKinds = map[string]string{
+	"ftp":    "ftp.banner",
+	"smtp":   "smtp.banner",
+	"pop3":   "pop3.banner",
+	"imap":   "imap4.banner",
+	"telnet": "telnet.banner",
+	"ssh":    "ssh.banner",
+}
+
+// recogPrefixes are stripped from the text of a kind before it is matched,
+// since recog fingerprints the text after the response code or the protocol
+// version.
+var recogPrefixes = map[string]*regexp.Regexp{
+	"ftp.banner":   regexp.MustCompile(`^\d{3}[ -]`),
+	"smtp.banner":  regexp.MustCompile(`^\d{3}[ -]`),
+	"smtp.ehlo":    regexp.MustCompile(`^\d{3}[ -]`),
+	"pop3.banner":  regexp.MustCompile(`^\+OK ?`),
+	"imap4.banner": regexp.MustCompile(`^\* OK ?`),
+	"ssh.banner":   regexp.MustCompile(`^SSH-[\d.]+-`),
+}
+
+// LoadRecogDir reads the recog XML fingerprint databases (*.xml) of a
+// directory, such as the xml directory of https://github.com/rapid7/recog.
+// The fingerprints whose pattern Go cannot compile are skipped.
+func LoadRecogDir(dir string) (*RecogDatabase, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .xml files in %s", dir)
+	}
+	sort.Strings(files)
+	db := &RecogDatabase{fingerprints: make(map[string][]*recogFingerprint)}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.add(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return db, nil
+}
+
+// add adds the fingerprints of an XML database.
+func (db *RecogDatabase) add(data []byte) error {
+	var file recogFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if file.Matches == "" {
+		return fmt.Errorf("no matches attribute")
+	}
+	for _, f := range file.Fingerprints {
+		prefix := ""
+		for _, flag := range strings.Split(f.Flags, ",") {
+			switch strings.TrimSpace(flag) {
+			case "REG_ICASE":
+				prefix += "i"
+			case "REG_DOT_NEWLINE", "REG_MULTILINE":
+				prefix += "s"
+			}
+		}
+		if prefix != "" {
+			prefix = "(?" + prefix + ")"
+		}
+		regex, err := regexp.Compile(prefix + f.Pattern)
+		if err != nil {
+			db.Skipped++
+			continue
+		}
+		fingerprint := &recogFingerprint{description: strings.TrimSpace(f.Description), regex: regex}
+		for _, p := range f.Params {
+			if p.Pos > regex.NumSubexp() {
+				return fmt.Errorf("fingerprint %q: param %s refers to group %d", f.Pattern, p.Name, p.Pos)
+			}
+			fingerprint.params = append(fingerprint.params, recogParam{pos: p.Pos, name: p.Name, value: p.Value})
+		}
+		db.fingerprints[file.Matches] = append(db.fingerprints[file.Matches], fingerprint)
+	}
+	return nil
+}
+
+// recogInterpolation matches the {name} references to other parameters in
+// the values of parameters, e.g. in service.cpe23.
+var recogInterpolation = regexp.MustCompile(`\{([a-z0-9_.]+)\}`)
+
+// match returns the match of the first fingerprint of kind matching text.
+func (db *RecogDatabase) match(kind string, text string) *RecogMatch {
+	if prefix := recogPrefixes[kind]; prefix != nil {
+		// Only the first line of a greeting, after its code.
+		text = prefix.ReplaceAllString(text, "")
+		if i := strings.IndexAny(text, "\r\n"); i >= 0 {
+			text = text[:i]
+		}
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	for _, fingerprint := range db.fingerprints[kind] {
+		groups := fingerprint.regex.FindStringSubmatch(text)
+		if groups == nil {
+			continue
+		}
+		params := make(map[string]string)
+		for _, p := range fingerprint.params {
+			value := p.value
+			if p.pos > 0 {
+				value = groups[p.pos]
+			}
+			if value != "" {
+				params[p.name] = value
+			}
+		}
+		for name, value := range params {
+			params[name] = recogInterpolation.ReplaceAllStringFunc(value, func(s string) string {
+				return params[s[1:len(s)-1]]
+			})
+		}
+		first := func(names ...string) string {
+			for _, name := range names {
+				if params[name] != "" {
+					return params[name]
+				}
+			}
+			return ""
+		}
+		return &RecogMatch{
+			Matches:     kind,
+			Description: fingerprint.description,
+			Vendor:      first("service.vendor", "os.vendor", "hw.vendor"),
+			Product:     first("service.product", "os.product", "hw.product"),
+			Version:     first("service.version", "os.version", "hw.version"),
+			Params:      params,
+		}
+	}
+	return nil
+}
+
+// recogStrings returns the strings of a JSON value: itself, or the strings
+// of a list, such as the values of an HTTP header.
+func recogStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var ret []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// Match returns the fingerprints matching the fields of a result of the
+// protocol, at most one per field.
+func (db *RecogDatabase) Match(protocol string, result interface{}) []*RecogMatch {
+	fields := recogFields[protocol]
+	if protocol != "banner" && len(fields) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil
+	}
+	lookup := func(path string) interface{} {
+		value := decoded
+		for _, step := range strings.Split(path, ".") {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = object[step]
+		}
+		return value
+	}
+	if protocol == "banner" {
+		guessed, _ := lookup("guessed_protocol").(string)
+		if kind, ok := recogBannerKinds[guessed]; ok {
+			fields = []recogField{{"banner", kind}}
+		}
+	}
+	var ret []*RecogMatch
+	for _, field := range fields {
+		for _, text := range recogStrings(lookup(field.path)) {
+			if match := db.match(field.matches, text); match != nil {
+				match.Field = field.path
+				ret = append(ret, match)
+				break
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,102 @@
+package zgrab2
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const recogTestSSH = `<?xml version="1.0"?>
+<fingerprints matches="ssh.banner" protocol="ssh" database_type="service" preference="0.90">
+  <fingerprint pattern="^OpenSSH_([\w.]+)\s+Ubuntu-(\S+)$">
+    <description>OpenSSH running on Ubuntu</description>
+    <example service.version="8.9p1">OpenSSH_8.9p1 Ubuntu-3ubuntu0.1</example>
+    <param pos="0" name="service.vendor" value="OpenBSD"/>
+    <param pos="0" name="service.product" value="OpenSSH"/>
+    <param pos="1" name="service.version"/>
+    <param pos="2" name="os.version.version"/>
+    <param pos="0" name="os.vendor" value="Ubuntu"/>
+    <param pos="0" name="service.cpe23" value="cpe:/a:openbsd:openssh:{service.version}"/>
+  </fingerprint>
+  <fingerprint pattern="^(?=lookahead)" flags="REG_ICASE">
+    <description>Not supported by Go</description>
+  </fingerprint>
+</fingerprints>
+`
+
+const recogTestHTTP = `<?xml version="1.0"?>
+<fingerprints matches="http_header.server" protocol="http">
+  <fingerprint pattern="^nginx(?:/([\d.]+))?" flags="REG_ICASE">
+    <description>nginx</description>
+    <param pos="0" name="service.vendor" value="nginx"/>
+    <param pos="0" name="service.product" value="nginx"/>
+    <param pos="1" name="service.version"/>
+  </fingerprint>
+</fingerprints>
+`
+
+func loadRecogTest(t *testing.T) *RecogDatabase {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"ssh_banners.xml": recogTestSSH, "http_servers.xml": recogTestHTTP, "README.md": "not a database"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := LoadRecogDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLoadRecogDir(t *testing.T) {
+	db := loadRecogTest(t)
+	if len(db.fingerprints["ssh.banner"]) != 1 || len(db.fingerprints["http_header.server"]) != 1 || db.Skipped != 1 {
+		t.Errorf("got %v, %d skipped", db.fingerprints, db.Skipped)
+	}
+	if _, err := LoadRecogDir(t.TempDir()); err == nil {
+		t.Error("empty directory accepted")
+	}
+	bad := t.TempDir()
+	ioutil.WriteFile(filepath.Join(bad, "bad.xml"), []byte(`<fingerprints matches="x"><fingerprint pattern="^a$"><param pos="1" name="service.version"/></fingerprint></fingerprints>`), 0644)
+	if _, err := LoadRecogDir(bad); err == nil {
+		t.Error("param of a missing group accepted")
+	}
+}
+
+func TestRecogMatch(t *testing.T) {
+	db := loadRecogTest(t)
+	matches := db.Match("ssh", map[string]interface{}{
+		"server_id": map[string]string{"raw": "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1"},
+	})
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches", len(matches))
+	}
+	m := matches[0]
+	if m.Field != "server_id.raw" || m.Matches != "ssh.banner" || m.Vendor != "OpenBSD" || m.Product != "OpenSSH" || m.Version != "8.9p1" {
+		t.Errorf("got %+v", m)
+	}
+	if m.Params["os.version.version"] != "3ubuntu0.1" || m.Params["service.cpe23"] != "cpe:/a:openbsd:openssh:8.9p1" {
+		t.Errorf("got params %v", m.Params)
+	}
+
+	// Each value of a header is tried.
+	matches = db.Match("http", map[string]interface{}{
+		"response": map[string]interface{}{"headers": map[string][]string{"server": {"Apache", "NGINX/1.25.3"}}},
+	})
+	if len(matches) != 1 || matches[0].Version != "1.25.3" || matches[0].Field != "response.headers.server" {
+		t.Errorf("got %+v", matches)
+	}
+
+	// The kind of a banner is that of its guessed protocol.
+	matches = db.Match("banner", map[string]string{"banner": "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3\r\n", "guessed_protocol": "ssh"})
+	if len(matches) != 1 || matches[0].Version != "9.6p1" {
+		t.Errorf("got %+v", matches)
+	}
+	if matches := db.Match("banner", map[string]string{"banner": "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3\r\n"}); len(matches) != 0 {
+		t.Errorf("unclassified banner: got %+v", matches)
+	}
+	if matches := db.Match("tls", map[string]string{"banner": "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3"}); len(matches) != 0 {
+		t.Errorf("tls: got %+v", matches)
+	}
+}
@@ -0,0 +1,426 @@
+package zgrab2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redisQueue is a Redis list or stream of --input-redis or --output-redis,
+// given as comma-separated KEY=VALUE options.
+type redisQueue struct {
+	addr     string
+	password string
+	db       int
+
+	// Exactly one of list and stream is set.
+	list   string
+	stream string
+
+	// group and consumer are the consumer group of the stream input, and
+	// the name of this worker in it.
+	group    string
+	consumer string
+
+	// field is the field of the stream entries holding the target or the
+	// result.
+	field string
+
+	// idle ends the input once the queue has been empty this long; 0 waits
+	// for targets until the scan is interrupted.
+	idle time.Duration
+
+	// poll is how long a pop blocks on an empty queue.
+	poll time.Duration
+
+	timeout time.Duration
+}
+
+// parseRedisQueue parses the options of --input-redis or --output-redis:
+// addr (default 127.0.0.1:6379), password, db, list or stream, and for
+// streams field (default target or result), group (default zgrab2) and
+// consumer (default HOSTNAME-PID), and idle for the input.
+func parseRedisQueue(spec string, field string) (*redisQueue, error) {
+	q := &redisQueue{
+		addr:    "127.0.0.1:6379",
+		group:   "zgrab2",
+		field:   field,
+		poll:    time.Second,
+		timeout: 10 * time.Second,
+	}
+	hostname, _ := os.Hostname()
+	q.consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	for _, option := range strings.Split(spec, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		i := strings.IndexByte(option, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("expected KEY=VALUE, got %q", option)
+		}
+		key, value := option[:i], option[i+1:]
+		var err error
+		switch key {
+		case "addr":
+			q.addr = value
+			if _, _, err = net.SplitHostPort(value); err != nil {
+				q.addr = net.JoinHostPort(value, "6379")
+				err = nil
+			}
+		case "password":
+			q.password = value
+		case "db":
+			if q.db, err = strconv.Atoi(value); err == nil && q.db < 0 {
+				err = fmt.Errorf("negative")
+			}
+		case "list":
+			q.list = value
+		case "stream":
+			q.stream = value
+		case "field":
+			q.field = value
+		case "group":
+			q.group = value
+		case "consumer":
+			q.consumer = value
+		case "idle":
+			if q.idle, err = time.ParseDuration(value); err == nil && q.idle < 0 {
+				err = fmt.Errorf("negative")
+			}
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", key, value, err)
+		}
+	}
+	if (q.list == "") == (q.stream == "") {
+		return nil, errors.New("expected one of list=KEY or stream=KEY")
+	}
+	return q, nil
+}
+
+// name returns the key of the queue, for messages.
+func (q *redisQueue) name() string {
+	if q.list != "" {
+		return "list " + q.list
+	}
+	return "stream " + q.stream
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisConn is a connection to a Redis server speaking RESP, with just the
+// commands of the queues.
+type redisConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	timeout time.Duration
+}
+
+// dial connects to the server of the queue, authenticating and selecting
+// its database.
+func (q *redisQueue) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", q.addr, q.timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		writer:  bufio.NewWriter(conn),
+		timeout: q.timeout,
+	}
+	if q.password != "" {
+		if _, err := c.do(0, "AUTH", q.password); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	if q.db != 0 {
+		if _, err := c.do(0, "SELECT", strconv.Itoa(q.db)); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) close() error {
+	return c.conn.Close()
+}
+
+// send buffers a command.
+func (c *redisConn) send(args ...string) {
+	fmt.Fprintf(c.writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// receive flushes the buffered commands and reads the next reply, which
+// may take block longer than the timeout. Error replies are returned as a
+// redisError.
+func (c *redisConn) receive(block time.Duration) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout + block))
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(redisError); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+// do sends a command and returns its reply.
+func (c *redisConn) do(block time.Duration, args ...string) (interface{}, error) {
+	c.send(args...)
+	return c.receive(block)
+}
+
+// readReply reads a reply: a string for simple strings, a redisError, an
+// int64, a []byte for bulk strings, an []interface{} for arrays, or nil for
+// the null bulk string or array.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("invalid reply line %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return redisError(line), nil
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("invalid reply type %q", kind)
+}
+
+// pop returns the items taken from the queue, waiting up to poll for one.
+// Stream entries are acknowledged when read.
+func (q *redisQueue) pop(c *redisConn) ([][]byte, error) {
+	if q.list != "" {
+		reply, err := c.do(q.poll, "BLPOP", q.list, strconv.Itoa(int(q.poll/time.Second)))
+		if err != nil || reply == nil {
+			return nil, err
+		}
+		pair, ok := reply.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, fmt.Errorf("unexpected BLPOP reply %v", reply)
+		}
+		item, _ := pair[1].([]byte)
+		return [][]byte{item}, nil
+	}
+	reply, err := c.do(q.poll, "XREADGROUP", "GROUP", q.group, q.consumer, "COUNT", "100",
+		"BLOCK", strconv.FormatInt(int64(q.poll/time.Millisecond), 10), "STREAMS", q.stream, ">")
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	// The reply is [[stream, [[id, [field, value, ...]], ...]]].
+	streams, _ := reply.([]interface{})
+	if len(streams) != 1 {
+		return nil, fmt.Errorf("unexpected XREADGROUP reply %v", reply)
+	}
+	stream, _ := streams[0].([]interface{})
+	if len(stream) != 2 {
+		return nil, fmt.Errorf("unexpected XREADGROUP reply %v", reply)
+	}
+	entries, _ := stream[1].([]interface{})
+	var items [][]byte
+	ack := []string{"XACK", q.stream, q.group}
+	for _, e := range entries {
+		entry, _ := e.([]interface{})
+		if len(entry) != 2 {
+			return nil, fmt.Errorf("unexpected stream entry %v", e)
+		}
+		id, _ := entry[0].([]byte)
+		ack = append(ack, string(id))
+		fields, _ := entry[1].([]interface{})
+		found := false
+		for i := 0; i+1 < len(fields); i += 2 {
+			if name, _ := fields[i].([]byte); string(name) == q.field {
+				value, _ := fields[i+1].([]byte)
+				items = append(items, value)
+				found = true
+			}
+		}
+		if !found {
+			log.Errorf("--input-redis: stream entry %s has no field %s, skipping", id, q.field)
+		}
+	}
+	if len(ack) > 3 {
+		if _, err := c.do(0, ack...); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// createGroup creates the consumer group of the stream, and the stream, if
+// they do not exist. New groups read the entries added from now on.
+func (q *redisQueue) createGroup(c *redisConn) error {
+	_, err := c.do(0, "XGROUP", "CREATE", q.stream, q.group, "$", "MKSTREAM")
+	if e, ok := err.(redisError); ok && strings.HasPrefix(string(e), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// inputTargets returns an InputTargetsFunc that pops targets from the queue
+// until it has been empty for idle, or forever without idle. Each item is
+// one or more lines in the CSV input format; if splitPort is true, their
+// addresses may carry a port, as with --auto-module. Lost connections are
+// redialed, so that the workers outlive restarts of the server.
+func (q *redisQueue) inputTargets(splitPort bool) InputTargetsFunc {
+	return func(ch chan<- ScanTarget) error {
+		var c *redisConn
+		defer func() {
+			if c != nil {
+				c.close()
+			}
+		}()
+		lastItem := time.Now()
+		for {
+			if c == nil {
+				var err error
+				if c, err = q.dial(); err == nil && q.stream != "" {
+					if err = q.createGroup(c); err != nil {
+						c.close()
+					}
+				}
+				if err != nil {
+					c = nil
+					log.Warnf("--input-redis: %v, retrying in %s", err, q.poll)
+					time.Sleep(q.poll)
+					continue
+				}
+			}
+			items, err := q.pop(c)
+			if _, ok := err.(redisError); ok {
+				return fmt.Errorf("--input-redis: %v", err)
+			} else if err != nil {
+				log.Warnf("--input-redis: %v, reconnecting", err)
+				c.close()
+				c = nil
+				continue
+			}
+			if len(items) == 0 {
+				if q.idle > 0 && time.Since(lastItem) >= q.idle {
+					log.Infof("--input-redis: %s empty for %s, ending the input", q.name(), q.idle)
+					return nil
+				}
+				continue
+			}
+			lastItem = time.Now()
+			for _, item := range items {
+				if err := getTargetsCSV(strings.NewReader(string(item)), ch, splitPort, nil); err != nil {
+					log.Errorf("--input-redis: parse error, skipping %q: %v", item, err)
+				}
+			}
+		}
+	}
+}
+
+// wrap returns an OutputResultsFunc that passes the results on to next, and
+// pushes them onto the queue: appended to a list with RPUSH, or added to a
+// stream with XADD. The results waiting are pipelined together. A failed
+// push stops the output.
+func (q *redisQueue) wrap(next OutputResultsFunc) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		c, err := q.dial()
+		if err != nil {
+			return fmt.Errorf("--output-redis: %v", err)
+		}
+		defer c.close()
+		passed := make(chan []byte)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- next(passed)
+		}()
+		push := func(result []byte) {
+			if q.list != "" {
+				c.send("RPUSH", q.list, string(result))
+			} else {
+				c.send("XADD", q.stream, "*", q.field, string(result))
+			}
+		}
+		for result := range results {
+			batch := [][]byte{result}
+			push(result)
+			// Pipeline the results already waiting.
+		more:
+			for len(batch) < 1000 {
+				select {
+				case r, ok := <-results:
+					if !ok {
+						break more
+					}
+					batch = append(batch, r)
+					push(r)
+				default:
+					break more
+				}
+			}
+			for range batch {
+				if _, err := c.receive(0); err != nil {
+					return fmt.Errorf("--output-redis: %v", err)
+				}
+			}
+			for _, r := range batch {
+				select {
+				case passed <- r:
+				case err := <-errs:
+					return err
+				}
+			}
+		}
+		close(passed)
+		return <-errs
+	}
+}
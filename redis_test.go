@@ -0,0 +1,142 @@
+package zgrab2
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a Redis server with the list commands of the queues.
+type fakeRedis struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	lists    map[string][]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{listener: listener, lists: make(map[string][]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		var n int
+		if _, err := fmt.Fscanf(reader, "*%d\r\n", &n); err != nil {
+			return
+		}
+		args := make([]string, n)
+		for i := range args {
+			var size int
+			if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+				return
+			}
+			arg := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, arg); err != nil {
+				return
+			}
+			args[i] = string(arg[:size])
+		}
+		r.mutex.Lock()
+		switch args[0] {
+		case "RPUSH":
+			r.lists[args[1]] = append(r.lists[args[1]], args[2:]...)
+			fmt.Fprintf(conn, ":%d\r\n", len(r.lists[args[1]]))
+		case "BLPOP":
+			if list := r.lists[args[1]]; len(list) > 0 {
+				r.lists[args[1]] = list[1:]
+				fmt.Fprintf(conn, "*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(args[1]), args[1], len(list[0]), list[0])
+			} else {
+				fmt.Fprint(conn, "*-1\r\n")
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		r.mutex.Unlock()
+	}
+}
+
+func TestParseRedisQueue(t *testing.T) {
+	q, err := parseRedisQueue("addr=redis.local,stream=targets,group=scan,idle=30s", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.addr != "redis.local:6379" || q.stream != "targets" || q.group != "scan" || q.idle != 30*time.Second || q.field != "target" {
+		t.Errorf("got %+v", q)
+	}
+	for _, spec := range []string{"addr=localhost", "list=a,stream=b", "list=a,idle=x", "list=a,db=-1", "list=a,size=1", "list"} {
+		if _, err := parseRedisQueue(spec, "target"); err == nil {
+			t.Errorf("%s accepted", spec)
+		}
+	}
+}
+
+func TestRedisQueue(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.listener.Close()
+	server.lists["targets"] = []string{"192.0.2.1", "192.0.2.2-192.0.2.3, example.com, tag", "not an address,,,"}
+
+	q, err := parseRedisQueue("addr="+server.listener.Addr().String()+",list=targets,idle=1ms", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.poll = 0
+	ch := make(chan ScanTarget, 10)
+	if err := q.inputTargets(false)(ch); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	var targets []string
+	for target := range ch {
+		targets = append(targets, target.IP.String()+"/"+target.Domain+"/"+target.Tag)
+	}
+	expected := []string{"192.0.2.1//", "192.0.2.2/example.com/tag", "192.0.2.3/example.com/tag"}
+	if fmt.Sprint(targets) != fmt.Sprint(expected) {
+		t.Errorf("got targets %v, expected %v", targets, expected)
+	}
+
+	q, err = parseRedisQueue("addr="+server.listener.Addr().String()+",list=results", "result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output int
+	outputFunc := q.wrap(func(results <-chan []byte) error {
+		for range results {
+			output++
+		}
+		return nil
+	})
+	results := make(chan []byte, 3)
+	for i := 1; i <= 3; i++ {
+		results <- []byte(`{"ip":"192.0.2.` + strconv.Itoa(i) + `"}`)
+	}
+	close(results)
+	if err := outputFunc(results); err != nil {
+		t.Fatal(err)
+	}
+	if output != 3 {
+		t.Errorf("passed on %d results", output)
+	}
+	if pushed := server.lists["results"]; len(pushed) != 3 || pushed[2] != `{"ip":"192.0.2.3"}` {
+		t.Errorf("pushed %v", pushed)
+	}
+}
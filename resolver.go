@@ -0,0 +1,194 @@
+package zgrab2
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Policies of --resolve-policy, which select the addresses of a domain that
+// are scanned.
+const (
+	ResolveIPv4Only   = "ipv4-only"
+	ResolveIPv6Only   = "ipv6-only"
+	ResolvePreferIPv4 = "prefer-ipv4"
+	ResolvePreferIPv6 = "prefer-ipv6"
+)
+
+// Resolution is the resolution of a target given by domain, with --resolve.
+type Resolution struct {
+	// Resolver is the address of the resolver that answered.
+	Resolver string `json:"resolver,omitempty"`
+
+	// CNAMEs are the names of the CNAME chain leading to the addresses.
+	CNAMEs []string `json:"cname_chain,omitempty"`
+
+	IPv4 []string `json:"ipv4,omitempty"`
+	IPv6 []string `json:"ipv6,omitempty"`
+
+	// Error is set if the domain has no address of the selected families,
+	// in which case the target is not scanned.
+	Error string `json:"error,omitempty"`
+}
+
+// Resolver resolves the targets given by domain with a list of DNS
+// resolvers, which are tried in turn.
+type Resolver struct {
+	servers []string
+	policy  string
+	timeout time.Duration
+	next    uint32
+}
+
+// NewResolver returns a Resolver using the resolvers at servers (host or
+// host:port) with one of the ResolveXXX policies. A timeout of 0 means 10
+// seconds per query.
+func NewResolver(servers []string, policy string, timeout time.Duration) (*Resolver, error) {
+	switch policy {
+	case ResolveIPv4Only, ResolveIPv6Only, ResolvePreferIPv4, ResolvePreferIPv6:
+	default:
+		return nil, fmt.Errorf("unknown resolve policy %q", policy)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no resolvers")
+	}
+	ret := &Resolver{policy: policy, timeout: timeout}
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		ret.servers = append(ret.servers, server)
+	}
+	return ret, nil
+}
+
+// lookup queries the resolvers for name and qtype, starting with the next
+// one in turn, until one of them answers.
+func (r *Resolver) lookup(name string, qtype uint16) (*DNSResponse, string, error) {
+	first := int(atomic.AddUint32(&r.next, 1))
+	var err error
+	for i := range r.servers {
+		server := r.servers[(first+i)%len(r.servers)]
+		var response *DNSResponse
+		if response, err = lookupDNS(server, name, qtype, r.timeout); err == nil {
+			return response, server, nil
+		}
+	}
+	return nil, "", err
+}
+
+// Resolve resolves name, returning the resolution and the addresses to scan
+// in order of preference.
+func (r *Resolver) Resolve(name string) (*Resolution, []net.IP) {
+	ret := new(Resolution)
+	var ipv4, ipv6 []net.IP
+	var errs []string
+	for _, qtype := range []uint16{DNSTypeA, DNSTypeAAAA} {
+		if (qtype == DNSTypeA && r.policy == ResolveIPv6Only) || (qtype == DNSTypeAAAA && r.policy == ResolveIPv4Only) {
+			continue
+		}
+		response, server, err := r.lookup(name, qtype)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if response.RCode == DNSRCodeNameError {
+			errs = append(errs, "no such domain")
+			continue
+		} else if response.RCode != 0 {
+			errs = append(errs, fmt.Sprintf("DNS response code %d", response.RCode))
+			continue
+		}
+		if ret.Resolver == "" {
+			ret.Resolver = server
+		}
+		if ret.CNAMEs == nil {
+			for _, cname := range response.CNAMEs {
+				ret.CNAMEs = append(ret.CNAMEs, cname.Target)
+			}
+		}
+		for _, answer := range response.Answers {
+			ip := net.IP(answer.Data)
+			if qtype == DNSTypeA && len(ip) == net.IPv4len {
+				ipv4 = append(ipv4, ip)
+				ret.IPv4 = append(ret.IPv4, ip.String())
+			} else if qtype == DNSTypeAAAA && len(ip) == net.IPv6len {
+				ipv6 = append(ipv6, ip)
+				ret.IPv6 = append(ret.IPv6, ip.String())
+			}
+		}
+	}
+	ips := append(ipv4, ipv6...)
+	if r.policy == ResolveIPv6Only || r.policy == ResolvePreferIPv6 {
+		ips = append(ipv6, ipv4...)
+	}
+	if len(ips) == 0 {
+		if len(errs) == 0 {
+			errs = append(errs, "no addresses")
+		}
+		ret.Error = strings.Join(errs, "; ")
+	}
+	return ret, ips
+}
+
+// otherFamily returns the first of ips of the other family than the first.
+func otherFamily(ips []net.IP) net.IP {
+	for _, ip := range ips[1:] {
+		if (ip.To4() == nil) != (ips[0].To4() == nil) {
+			return ip
+		}
+	}
+	return nil
+}
+
+// ResolveTargets returns an InputTargetsFunc that passes on the targets of
+// input, resolving those given by domain only with resolver, at most
+// concurrency at once, in order. A target gets the first address to scan, or
+// one target is sent for each address if all is set; otherwise it keeps the
+// first address of the other family for --happy-eyeballs. A target that does not
+// resolve is sent without an address; its result only has its resolution.
+func ResolveTargets(input InputTargetsFunc, resolver *Resolver, all bool, concurrency int) InputTargetsFunc {
+	return func(ch chan<- ScanTarget) error {
+		return pipeTargets(input, ch, func(targets <-chan ScanTarget) {
+			// pending holds the resolved targets of each input target, in
+			// order, while up to concurrency are resolved.
+			pending := make(chan chan []ScanTarget, concurrency)
+			go func() {
+				defer close(pending)
+				for target := range targets {
+					resolved := make(chan []ScanTarget, 1)
+					pending <- resolved
+					if target.IP != nil || target.Domain == "" {
+						resolved <- []ScanTarget{target}
+						continue
+					}
+					go func(target ScanTarget) {
+						resolution, ips := resolver.Resolve(target.Domain)
+						target.resolution = resolution
+						if len(ips) == 0 {
+							resolved <- []ScanTarget{target}
+							return
+						}
+						if !all {
+							target.fallbackIP = otherFamily(ips)
+							ips = ips[:1]
+						}
+						ret := make([]ScanTarget, len(ips))
+						for i, ip := range ips {
+							ret[i] = target
+							ret[i].IP = ip
+						}
+						resolved <- ret
+					}(target)
+				}
+			}()
+			for resolved := range pending {
+				for _, target := range <-resolved {
+					ch <- target
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package zgrab2
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dnsTestName encodes name without compression.
+func dnsTestName(name string) []byte {
+	var ret []byte
+	for _, label := range strings.Split(name, ".") {
+		ret = append(ret, byte(len(label)))
+		ret = append(ret, label...)
+	}
+	return append(ret, 0)
+}
+
+// dnsTestRecord encodes a resource record.
+func dnsTestRecord(name string, rtype uint16, data []byte) []byte {
+	ret := dnsTestName(name)
+	ret = append(ret, byte(rtype>>8), byte(rtype), 0, 1, 0, 0, 0, 60, byte(len(data)>>8), byte(len(data)))
+	return append(ret, data...)
+}
+
+// serveTestDNS answers the queries for www.example.com with a CNAME to
+// cdn.example.net, two A and one AAAA records, and the others with
+// NXDOMAIN.
+func serveTestDNS(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			question := query[12 : n-11]
+			qtype := binary.BigEndian.Uint16(question[len(question)-4:])
+			msg := append([]byte(nil), query[:12]...)
+			msg[2], msg[3] = 0x81, 0x80
+			binary.BigEndian.PutUint16(msg[10:], 0)
+			msg = append(msg, question...)
+			var answers [][]byte
+			if string(question[:len(question)-4]) != string(dnsTestName("www.example.com")) {
+				msg[3] |= DNSRCodeNameError
+			} else {
+				answers = append(answers, dnsTestRecord("www.example.com", DNSTypeCNAME, dnsTestName("cdn.example.net")))
+				if qtype == DNSTypeA {
+					answers = append(answers, dnsTestRecord("cdn.example.net", DNSTypeA, net.ParseIP("192.0.2.1").To4()))
+					answers = append(answers, dnsTestRecord("cdn.example.net", DNSTypeA, net.ParseIP("192.0.2.2").To4()))
+				} else {
+					answers = append(answers, dnsTestRecord("cdn.example.net", DNSTypeAAAA, net.ParseIP("2001:db8::1")))
+				}
+			}
+			binary.BigEndian.PutUint16(msg[6:], uint16(len(answers)))
+			for _, answer := range answers {
+				msg = append(msg, answer...)
+			}
+			conn.WriteTo(msg, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestResolver(t *testing.T) {
+	// Nothing listens on the first resolver.
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	server := serveTestDNS(t)
+	resolver, err := NewResolver([]string{closed.LocalAddr().String(), server}, ResolvePreferIPv6, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolution, ips := resolver.Resolve("www.example.com")
+	expected := &Resolution{
+		Resolver: server,
+		CNAMEs:   []string{"cdn.example.net"},
+		IPv4:     []string{"192.0.2.1", "192.0.2.2"},
+		IPv6:     []string{"2001:db8::1"},
+	}
+	if !reflect.DeepEqual(resolution, expected) {
+		t.Errorf("got %+v", resolution)
+	}
+	if len(ips) != 3 || ips[0].String() != "2001:db8::1" {
+		t.Errorf("got addresses %v", ips)
+	}
+	if fallback := otherFamily(ips); fallback.String() != "192.0.2.1" {
+		t.Errorf("got fallback address %v", fallback)
+	}
+	if resolution, ips := resolver.Resolve("missing.example.com"); len(ips) != 0 || !strings.Contains(resolution.Error, "no such domain") {
+		t.Errorf("got %+v", resolution)
+	}
+	if _, err := NewResolver([]string{server}, "any", 0); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+
+	resolver, _ = NewResolver([]string{server}, ResolveIPv4Only, time.Second)
+	input := csvInput("10.0.0.1\nwww.example.com\nmissing.example.com\n, www.example.com, tls\n")
+	targets := collectTargets(t, ResolveTargets(input, resolver, true, 2))
+	if !reflect.DeepEqual(targets, []string{"10.0.0.1/", "192.0.2.1/", "192.0.2.2/", "missing.example.com/", "192.0.2.1/tls", "192.0.2.2/tls"}) {
+		t.Errorf("got %v", targets)
+	}
+
+	r := &Runner{scanners: map[string]Scanner{"static": &staticScanner{name: "static"}}, order: []string{"static"}}
+	missing, _ := resolver.Resolve("missing.example.com")
+	grab := r.grabTarget(context.Background(), ScanTarget{Domain: "missing.example.com", resolution: missing})
+	if len(grab.Data) != 0 || grab.Resolution != missing {
+		t.Errorf("got %+v", grab)
+	}
+}
@@ -0,0 +1,536 @@
+package zgrab2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RunnerOptions configures a Runner. Unlike the command line, it does not
+// use the parser or the modules registered with AddCommand, so a program
+// can run several scans in-process with different modules and options.
+type RunnerOptions struct {
+	// Modules are the modules to scan with, by scanner name. The name is
+	// the key of the module's results, unless its flags set another.
+	Modules ModuleSet
+
+	// Flags are the flags of each module, by scanner name. A module without
+	// flags gets those of its NewFlags, which have no defaults applied.
+	Flags map[string]ScanFlags
+
+	// Order is the order the scanners run in on each target (default: by
+	// name). The scanners not in Order are not run.
+	Order []string
+
+	// Input sends the targets to scan, and returns when there are no more.
+	Input InputTargetsFunc
+
+	// Output is called with the result of each target, from the senders'
+	// goroutines.
+	Output func(*Grab)
+
+	// Monitor, if set, collects the status of each scan.
+	Monitor *Monitor
+
+	// Senders is the number of targets scanned at once (default 1).
+	Senders int
+
+	// ConnectionsPerHost is the number of times each target is scanned
+	// (default 1).
+	ConnectionsPerHost int
+
+	// ContinueOnError runs the remaining scanners of a target after a scan
+	// fails, and BreakOnSuccess skips them after a scan succeeds.
+	ContinueOnError bool
+	BreakOnSuccess  bool
+
+	// FilterExpr, as --filter-expr, replaces the successful results it does
+	// not match with SCAN_SUCCESS_NOTCONTAIN.
+	FilterExpr *FilterExpression
+
+	// ChainRules, as --chain-rules, run follow-up scanners on matching
+	// results.
+	ChainRules []*ChainRule
+
+	// Recog, as --recog-dir, adds the fingerprints matching the banners and
+	// headers of the results to their responses.
+	Recog *RecogDatabase
+
+	// WatchdogTimeout, as --watchdog-timeout, abandons the scans that run
+	// longer than it, or than the max runtime of their flags.
+	WatchdogTimeout time.Duration
+
+	// TargetTimeout, as --target-timeout, abandons the scans of a target
+	// still running after it in total.
+	TargetTimeout time.Duration
+
+	// RecordLocalAddr records the local addresses of each scan's
+	// connections.
+	RecordLocalAddr bool
+
+	// Capture, as --pcap-dir, writes the connections of a sample of the
+	// targets to capture files.
+	Capture *PacketCapture
+
+	// SkipTargets is the number of targets at the start of the input that
+	// are not scanned, e.g. the TargetsDone of a previous run.
+	SkipTargets uint64
+
+	// TimingPrecision is the precision of the start and end times of the
+	// responses' timing, one of the TimingXXX constants (default
+	// milliseconds).
+	TimingPrecision string
+
+	// AddressPolicy, as --blocklist-file and --allowlist-file, skips the
+	// input targets it excludes, and rejects the connections to the
+	// addresses it excludes with SCAN_BLOCKED.
+	AddressPolicy *AddressPolicy
+
+	// SourceIPs, as --source-ip, are the comma-separated local addresses of
+	// the TCP connections, assigned to the senders in turn for the
+	// addresses of their family, and SourcePorts, as --source-ports, is the
+	// LOW-HIGH range of their local ports, split between the senders
+	// sharing an IP.
+	SourceIPs   string
+	SourcePorts string
+
+	// SourceIPPool, as --source-ip-pool, is the comma-separated list of
+	// local addresses of the TCP connections, or @FILE of one per line,
+	// used in turn. It cannot be set with SourceIPs or SourcePorts.
+	SourceIPPool string
+
+	// Interface, as --interface, is the network device the sockets of the
+	// connections are bound to (Linux only).
+	Interface string
+
+	// HappyEyeballs, as --happy-eyeballs, also dials the resolved address of
+	// the other family of the targets resolved by ResolveTargets once a
+	// connection takes HappyEyeballsDelay (default 250ms).
+	HappyEyeballs      bool
+	HappyEyeballsDelay time.Duration
+
+	// MaxMemory, as --max-memory, is the RSS in megabytes the runner keeps
+	// the process under while it runs, by scanning one target at a time and
+	// lowering the read limit of new connections near it (0 = no limit).
+	// Dropping oversized results is left to Output.
+	MaxMemory int
+}
+
+// Runner scans the targets of an input with a set of scanners. The options
+// of the command line are read into the Runner used by Process; programs
+// embedding zgrab2 create their own with NewRunner.
+type Runner struct {
+	scanners           map[string]Scanner
+	order              []string
+	maxRuntimes        map[string]time.Duration
+	input              InputTargetsFunc
+	output             func(*Grab)
+	monitor            *Monitor
+	senders            int
+	connectionsPerHost int
+	continueOnError    bool
+	breakOnSuccess     bool
+	filterExpr         *FilterExpression
+	chainRules         []*ChainRule
+	chained            map[string]bool
+	recog              *RecogDatabase
+	watchdogTimeout    time.Duration
+	targetTimeout      time.Duration
+	recordLocalAddr    bool
+	timingLayout       string
+	capture            *PacketCapture
+	addressPolicy      *AddressPolicy
+	dialOpts           *dialOptions
+	memory             *memoryGovernor
+
+	skipTargets uint64
+	progress    *progressTracker
+
+	// autoModules is only set from the command line.
+	autoModules map[uint][]string
+}
+
+// NewRunner creates and initializes the scanners of the modules, and returns
+// a Runner for them.
+func NewRunner(opts RunnerOptions) (*Runner, error) {
+	if opts.Input == nil || opts.Output == nil {
+		return nil, errors.New("zgrab2: the runner needs an input and an output")
+	}
+	layout, err := timingLayout(opts.TimingPrecision)
+	if err != nil {
+		return nil, err
+	}
+	order := opts.Order
+	if order == nil {
+		for name := range opts.Modules {
+			order = append(order, name)
+		}
+		sort.Strings(order)
+	}
+	r := &Runner{
+		scanners:           make(map[string]Scanner, len(order)),
+		order:              order,
+		maxRuntimes:        make(map[string]time.Duration),
+		input:              opts.Input,
+		output:             opts.Output,
+		monitor:            opts.Monitor,
+		senders:            opts.Senders,
+		connectionsPerHost: opts.ConnectionsPerHost,
+		continueOnError:    opts.ContinueOnError,
+		breakOnSuccess:     opts.BreakOnSuccess,
+		filterExpr:         opts.FilterExpr,
+		chainRules:         opts.ChainRules,
+		chained:            chainedScanners(opts.ChainRules),
+		recog:              opts.Recog,
+		watchdogTimeout:    opts.WatchdogTimeout,
+		targetTimeout:      opts.TargetTimeout,
+		recordLocalAddr:    opts.RecordLocalAddr,
+		timingLayout:       layout,
+		capture:            opts.Capture,
+		addressPolicy:      opts.AddressPolicy,
+		skipTargets:        opts.SkipTargets,
+	}
+	if opts.AddressPolicy != nil {
+		r.input = opts.AddressPolicy.filterTargets(opts.Input)
+	}
+	for _, name := range order {
+		module := opts.Modules[name]
+		if module == nil {
+			return nil, fmt.Errorf("zgrab2: no module for scanner %s", name)
+		}
+		flags := opts.Flags[name]
+		if flags == nil {
+			var ok bool
+			if flags, ok = module.NewFlags().(ScanFlags); !ok {
+				return nil, fmt.Errorf("zgrab2: the flags of scanner %s are not ScanFlags", name)
+			}
+		}
+		scanner := module.NewScanner()
+		if err := scanner.Init(flags); err != nil {
+			return nil, fmt.Errorf("zgrab2: initializing scanner %s: %s", name, err)
+		}
+		r.scanners[name] = scanner
+		if f, ok := flags.(interface{ GetMaxRuntime() time.Duration }); ok && f.GetMaxRuntime() > 0 {
+			if scanner.GetName() != "" {
+				r.maxRuntimes[scanner.GetName()] = f.GetMaxRuntime()
+			} else {
+				r.maxRuntimes[name] = f.GetMaxRuntime()
+			}
+		}
+	}
+	if err := checkChainRules(opts.ChainRules, r.scanners); err != nil {
+		return nil, err
+	}
+	if r.senders <= 0 {
+		r.senders = 1
+	}
+	if r.connectionsPerHost <= 0 {
+		r.connectionsPerHost = 1
+	}
+	r.dialOpts = &dialOptions{policy: opts.AddressPolicy}
+	if err := r.dialOpts.setSourceAddrs(opts.SourceIPs, opts.SourcePorts, opts.SourceIPPool, r.senders); err != nil {
+		return nil, fmt.Errorf("zgrab2: %s", err)
+	}
+	if err := r.dialOpts.setInterface(opts.Interface); err != nil {
+		return nil, fmt.Errorf("zgrab2: %s", err)
+	}
+	if opts.HappyEyeballs {
+		r.dialOpts.happyEyeballsDelay = opts.HappyEyeballsDelay
+		if r.dialOpts.happyEyeballsDelay <= 0 {
+			r.dialOpts.happyEyeballsDelay = 250 * time.Millisecond
+		}
+	}
+	if opts.MaxMemory < 0 {
+		return nil, fmt.Errorf("zgrab2: invalid MaxMemory %d", opts.MaxMemory)
+	}
+	if opts.MaxMemory > 0 {
+		r.memory = newMemoryGovernor(uint64(opts.MaxMemory) << 20)
+	}
+	return r, nil
+}
+
+// newCommandLineRunner returns the Runner of the scanners registered with
+// RegisterScan and the framework options of the command line.
+func newCommandLineRunner(mon *Monitor, output func(*Grab), skipTargets uint64) (*Runner, error) {
+	registered := make(map[string]Scanner, len(scanners))
+	for name, scanner := range scanners {
+		registered[name] = *scanner
+	}
+	if err := checkChainRules(config.chainRules, registered); err != nil {
+		return nil, err
+	}
+	r := commandLineRunner(mon, output, skipTargets)
+	r.scanners = registered
+	r.order = orderedScanners
+	r.input = config.inputTargets
+	if config.MaxMemory > 0 {
+		r.memory = newMemoryGovernor(uint64(config.MaxMemory) << 20)
+	}
+	if config.AutoModule {
+		r.autoModules = resolveAutoModules()
+	}
+	return r, nil
+}
+
+// commandLineRunner returns a Runner with the framework options of the
+// command line and no scanners.
+func commandLineRunner(mon *Monitor, output func(*Grab), skipTargets uint64) *Runner {
+	dialOpts := config.dialOpts
+	dialOpts.policy = config.addressPolicy
+	if config.HappyEyeballs {
+		dialOpts.happyEyeballsDelay = config.HappyEyeballsDelay
+	}
+	return &Runner{
+		maxRuntimes:        maxRuntimes,
+		output:             output,
+		monitor:            mon,
+		senders:            config.Senders,
+		connectionsPerHost: config.ConnectionsPerHost,
+		continueOnError:    config.Multiple.ContinueOnError,
+		breakOnSuccess:     config.Multiple.BreakOnSuccess,
+		filterExpr:         config.filterExpr,
+		chainRules:         config.chainRules,
+		chained:            chainedScanners(config.chainRules),
+		recog:              config.recog,
+		watchdogTimeout:    config.WatchdogTimeout,
+		targetTimeout:      config.TargetTimeout,
+		recordLocalAddr:    config.RecordLocalAddr,
+		timingLayout:       timingLayouts[config.TimingPrecision],
+		capture:            config.capture,
+		addressPolicy:      config.addressPolicy,
+		dialOpts:           &dialOpts,
+		skipTargets:        skipTargets,
+	}
+}
+
+// Run scans the targets of the input with the senders, and returns when
+// they are all done, or with the error of the input.
+func (r *Runner) Run() error {
+	return r.RunContext(context.Background())
+}
+
+// RunContext is Run with a context. When ctx is done, the runner stops
+// reading the input, cancels the scans in flight, outputs the results of
+// their targets with status canceled, and returns ctx.Err(). The input is
+// abandoned, blocked sending the next target. The canceled targets are not
+// counted in TargetsDone.
+func (r *Runner) RunContext(ctx context.Context) error {
+	r.progress = newProgressTracker(r.skipTargets)
+	if r.memory != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go r.memory.run(done)
+	}
+	processQueue := make(chan ScanTarget, r.senders*4)
+	var workerDone sync.WaitGroup
+	workerDone.Add(r.senders)
+	for i := 0; i < r.senders; i++ {
+		go func(i int) {
+			defer workerDone.Done()
+			for _, name := range r.order {
+				r.scanners[name].InitPerSender(i)
+			}
+			for obj := range processQueue {
+				if ctx.Err() != nil {
+					// Skip the queued targets, which are not done.
+					continue
+				}
+				obj.sender = i
+				r.memory.acquire()
+				scanned := false
+				for run := 0; run < r.connectionsPerHost; run++ {
+					if grab := r.grabTarget(ctx, obj); grab != nil {
+						r.output(grab)
+						scanned = true
+					}
+				}
+				r.memory.release()
+				if scanned {
+					r.monitor.reportTarget()
+				}
+				if ctx.Err() == nil {
+					r.progress.done(obj.index)
+				}
+			}
+		}(i)
+	}
+	err := r.forwardInput(ctx, processQueue)
+	close(processQueue)
+	workerDone.Wait()
+	return err
+}
+
+// TargetsDone returns the number of targets at the start of the input whose
+// results have all been output, including the skipped ones.
+func (r *Runner) TargetsDone() uint64 {
+	if r.progress == nil {
+		return r.skipTargets
+	}
+	return r.progress.targetsDone()
+}
+
+// AddressPolicyStats returns the counts of the targets and connections
+// excluded by the AddressPolicy of the runner, or nil if it has none.
+func (r *Runner) AddressPolicyStats() *AddressPolicyStats {
+	return r.addressPolicy.Stats()
+}
+
+// forwardInput sends the targets of the input to queue, numbered in order,
+// until there are no more, or ctx is done. The targets before skipTargets
+// are dropped.
+func (r *Runner) forwardInput(ctx context.Context, queue chan<- ScanTarget) error {
+	targets := make(chan ScanTarget)
+	inputDone := make(chan error, 1)
+	go func() {
+		err := r.input(targets)
+		close(targets)
+		inputDone <- err
+	}()
+	for index := uint64(0); ; index++ {
+		select {
+		case target, ok := <-targets:
+			if !ok {
+				return <-inputDone
+			}
+			if index < r.skipTargets {
+				continue
+			}
+			target.index = index
+			select {
+			case queue <- target:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// watchdogLimit returns the hard cap on a single Scan call of the named
+// scanner, or 0 for none.
+func (r *Runner) watchdogLimit(name string) time.Duration {
+	if limit, ok := r.maxRuntimes[name]; ok {
+		return limit
+	}
+	return r.watchdogTimeout
+}
+
+// runScanner runs the named scanner on a target and returns the name of its
+// results and its response.
+func (r *Runner) runScanner(ctx context.Context, name string, s Scanner, target ScanTarget) (string, ScanResponse) {
+	t := time.Now()
+	if s.GetName() != "" {
+		name = s.GetName()
+	}
+	if r.recordLocalAddr {
+		target.localAddrs = new(localAddrLog)
+	}
+	target.timing = new(timingLog)
+	target.traffic = new(trafficLog)
+	status, res, e := scanWithWatchdog(ctx, s, target, r.watchdogLimit(name))
+	timing := target.timing.timing(t, time.Now(), r.timingLayout)
+	if status == SCAN_SUCCESS && r.filterExpr != nil && !r.filterExpr.Match(res) {
+		status, res = SCAN_SUCCESS_NOTCONTAIN, nil
+	}
+	var fingerprints []*RecogMatch
+	if r.recog != nil && res != nil {
+		fingerprints = r.recog.Match(s.Protocol(), res)
+	}
+	var err *ErrorDetail
+	st := statusSuccess
+	if e != nil {
+		st = statusFailure
+		err = NewErrorDetail(status, e)
+	}
+	response := ScanResponse{Result: res, Protocol: s.Protocol(), Error: err, Timestamp: t.Format(time.RFC3339), Status: status, Timing: timing, LocalAddrs: target.localAddrs.list(), Fingerprints: fingerprints}
+	r.monitor.report(name, st, &response, target.traffic)
+	return name, response
+}
+
+// grabTarget runs the scanners on a target with ctx, and returns their
+// results. It returns nil if --auto-module has no scanner for the target's
+// port.
+func (r *Runner) grabTarget(ctx context.Context, input ScanTarget) *Grab {
+	moduleResult := make(map[string]ScanResponse)
+	if input.IP == nil && input.resolution != nil {
+		// The domain did not resolve with --resolve.
+		return BuildGrabFromInputResponse(&input, moduleResult)
+	}
+	if input.Context == nil {
+		input.Context = NewTargetContext()
+	}
+	input.dialOpts = r.dialOpts
+	input.memory = r.memory
+	input.capture = r.capture.target(&input)
+	defer input.capture.close()
+	if r.targetTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.targetTimeout)
+		defer cancel()
+	}
+
+	scannerNames := r.order
+	auto := r.autoModules != nil && input.Tag == "" && input.Port != nil
+	if auto {
+		var ok bool
+		if scannerNames, ok = r.autoModules[*input.Port]; !ok {
+			log.Debugf("No scanner for port %d, skipping %s", *input.Port, input.String())
+			return nil
+		}
+	}
+	// chained holds the scanners queued by --chain-rules, and the scanner
+	// whose result queued them.
+	var chained []string
+	chainedFrom := make(map[string]string)
+	queue := func(from string, names []string) {
+		for _, name := range names {
+			if _, ok := chainedFrom[name]; !ok {
+				chainedFrom[name] = from
+				chained = append(chained, name)
+			}
+		}
+	}
+	stopped := false
+	for i := 0; i < len(scannerNames)+len(chained); i++ {
+		var scannerName string
+		if i < len(scannerNames) {
+			scannerName = scannerNames[i]
+			if stopped || r.chained[scannerName] {
+				continue
+			}
+			trigger := r.scanners[scannerName].GetTrigger()
+			if !auto && input.Tag != trigger && !input.Context.Triggered(trigger) {
+				continue
+			}
+		} else {
+			scannerName = chained[i-len(scannerNames)]
+		}
+		defer func(name string) {
+			if e := recover(); e != nil {
+				log.Errorf("Panic on scanner %s when scanning target %s: %#v", name, input.String(), e)
+				// Bubble out original error (with original stack) in lieu of explicitly logging the stack / error
+				panic(e)
+			}
+		}(scannerName)
+		name, res := r.runScanner(ctx, scannerName, r.scanners[scannerName], input)
+		res.ChainedFrom = chainedFrom[scannerName]
+		moduleResult[name] = res
+		queue(scannerName, followUps(r.chainRules, scannerName, &res))
+		// Stopping skips the remaining scanners, but not the follow-ups
+		// of the results so far.
+		if res.Error != nil && !r.continueOnError {
+			stopped = true
+		}
+		if res.Status == SCAN_SUCCESS && r.breakOnSuccess {
+			stopped = true
+		}
+	}
+
+	return BuildGrabFromInputResponse(&input, moduleResult)
+}
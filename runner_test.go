@@ -0,0 +1,193 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// staticModule is a module of staticScanners.
+type staticModule struct {
+	name   string
+	result interface{}
+}
+
+func (m *staticModule) NewFlags() interface{} { return new(configOtherFlags) }
+func (m *staticModule) NewScanner() Scanner   { return &staticScanner{name: m.name, result: m.result} }
+func (m *staticModule) Description() string   { return "static" }
+
+func TestRunner(t *testing.T) {
+	modules := NewModuleSet()
+	modules.AddModule("http", &staticModule{name: "http", result: map[string]int{"status_code": 200}})
+	modules.AddModule("ssh", &staticModule{name: "ssh", result: map[string]string{"banner": "SSH-2.0"}})
+	expr, err := ParseFilterExpression(".status_code == 200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mutex sync.Mutex
+	grabs := make(map[string]*Grab)
+	var wg sync.WaitGroup
+	monitor := MakeMonitor(16, &wg)
+	r, err := NewRunner(RunnerOptions{
+		Modules: modules,
+		Input: func(ch chan<- ScanTarget) error {
+			for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+				ch <- ScanTarget{IP: net.ParseIP(ip)}
+			}
+			return nil
+		},
+		Output: func(grab *Grab) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			grabs[grab.IP] = grab
+		},
+		Monitor:         monitor,
+		Senders:         2,
+		ContinueOnError: true,
+		FilterExpr:      expr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	monitor.Stop()
+	wg.Wait()
+	if len(grabs) != 3 {
+		t.Fatalf("got %d results", len(grabs))
+	}
+	for ip, grab := range grabs {
+		if grab.Data["http"].Status != SCAN_SUCCESS || grab.Data["ssh"].Status != SCAN_SUCCESS_NOTCONTAIN {
+			t.Errorf("%s: unexpected results %+v", ip, grab.Data)
+		}
+	}
+	if state := monitor.GetStatuses()["http"]; state == nil || state.Successes != 3 {
+		t.Errorf("unexpected http status %+v", state)
+	}
+
+	input := func(ch chan<- ScanTarget) error { return nil }
+	output := func(*Grab) {}
+	for _, opts := range []RunnerOptions{
+		{Modules: modules},
+		{Modules: modules, Input: input, Output: output, Order: []string{"missing"}},
+		{Modules: modules, Input: input, Output: output, ChainRules: []*ChainRule{{Scanner: "http", Run: chainScanners{"missing"}}}},
+		{Modules: modules, Input: input, Output: output, SourceIPs: "10.0.0.1", SourceIPPool: "10.0.0.2"},
+	} {
+		if _, err := NewRunner(opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestRunnerAddressPolicy(t *testing.T) {
+	modules := NewModuleSet()
+	modules.AddModule("http", &staticModule{name: "http", result: map[string]int{"status_code": 200}})
+	blocklist, err := ReadAddressList(strings.NewReader("10.0.0.2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NewAddressPolicy(blocklist, nil)
+	var mutex sync.Mutex
+	var ips []string
+	r, err := NewRunner(RunnerOptions{
+		Modules: modules,
+		Input: func(ch chan<- ScanTarget) error {
+			for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+				ch <- ScanTarget{IP: net.ParseIP(ip)}
+			}
+			return nil
+		},
+		Output: func(grab *Grab) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			ips = append(ips, grab.IP)
+		},
+		AddressPolicy: policy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ips, []string{"10.0.0.1", "10.0.0.3"}) {
+		t.Errorf("got results of %v", ips)
+	}
+	if stats := r.AddressPolicyStats(); stats == nil || stats.TargetsSkipped != 1 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+// blockingScanner signals started and blocks until release is closed,
+// ignoring its context.
+type blockingScanner struct {
+	staticScanner
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingScanner) ScanContext(ctx context.Context, t ScanTarget) (ScanStatus, interface{}, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return SCAN_SUCCESS, "late", nil
+}
+
+func TestRunnerContext(t *testing.T) {
+	s := &blockingScanner{staticScanner: staticScanner{name: "blocking"}, started: make(chan struct{}, 16), release: make(chan struct{})}
+	t.Cleanup(func() { close(s.release) })
+	var mutex sync.Mutex
+	var grabs []*Grab
+	r := &Runner{
+		scanners:           map[string]Scanner{"blocking": s},
+		order:              []string{"blocking"},
+		senders:            1,
+		connectionsPerHost: 1,
+		input: func(ch chan<- ScanTarget) error {
+			for {
+				ch <- ScanTarget{IP: net.ParseIP("10.0.0.1")}
+			}
+		},
+		output: func(grab *Grab) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			grabs = append(grabs, grab)
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.started
+		cancel()
+	}()
+	if err := r.RunContext(ctx); err != context.Canceled {
+		t.Fatalf("got %v", err)
+	}
+	if len(grabs) != 1 || grabs[0].Data["blocking"].Status != SCAN_CANCELED {
+		t.Fatalf("unexpected results %+v", grabs)
+	}
+	if done := r.TargetsDone(); done != 0 {
+		t.Errorf("got %d targets done", done)
+	}
+
+	grabs = nil
+	r.targetTimeout = 50 * time.Millisecond
+	r.input = func(ch chan<- ScanTarget) error {
+		ch <- ScanTarget{IP: net.ParseIP("10.0.0.2")}
+		return nil
+	}
+	start := time.Now()
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("target timeout fired after %s", elapsed)
+	}
+	if len(grabs) != 1 || grabs[0].Data["blocking"].Status != SCAN_WATCHDOG_TIMEOUT {
+		t.Fatalf("unexpected results %+v", grabs)
+	}
+}
@@ -3,7 +3,6 @@ package zgrab2
 import (
 	"fmt"
 	"log"
-	"time"
 )
 
 var scanners map[string]*Scanner
@@ -26,21 +25,20 @@ func PrintScanners() {
 	}
 }
 
-// RunScanner runs a single scan on a target and returns the resulting data
+// RunScanner runs a single scan on a target and returns the resulting data.
+// Successful results not matching --filter-expr are reported as
+// SCAN_SUCCESS_NOTCONTAIN without a result. The scan runs with the framework
+// options of the command line, as the scans of the Runner do.
 func RunScanner(s Scanner, mon *Monitor, target ScanTarget) (string, ScanResponse) {
-	t := time.Now()
-	status, res, e := s.Scan(target)
-	var err *string
-	if e == nil {
-		mon.statusesChan <- moduleStatus{name: s.GetName(), st: statusSuccess}
-		err = nil
-	} else {
-		mon.statusesChan <- moduleStatus{name: s.GetName(), st: statusFailure}
-		errString := e.Error()
-		err = &errString
+	r := commandLineRunner(mon, nil, 0)
+	if target.dialOpts == nil {
+		target.dialOpts = r.dialOpts
 	}
-	resp := ScanResponse{Result: res, Protocol: s.Protocol(), Error: err, Timestamp: t.Format(time.RFC3339), Status: status}
-	return s.GetName(), resp
+	if target.capture == nil {
+		target.capture = r.capture.target(&target)
+		defer target.capture.close()
+	}
+	return r.runScanner(target.Ctx(), s.GetName(), s, target)
 }
 
 func init() {
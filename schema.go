@@ -0,0 +1,315 @@
+package zgrab2
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OutputSchemaVersion is the version of the schema of the output records,
+// written in their schema_version. It is increased when the records of the
+// framework or the results of a module change incompatibly, e.g. when a
+// field is removed or changes type; added fields keep the version.
+const OutputSchemaVersion = 1
+
+// jsonSchemaDraft is the JSON Schema dialect of the generated schemas.
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// SchemaCommand holds the options of the schema command, which writes the
+// JSON Schema of the results of a module, or of the whole output records, to
+// the output file instead of scanning.
+type SchemaCommand struct {
+	Record bool `long:"record" description:"Write the schema of a whole output record, with the results of the given modules (all by default) under data"`
+
+	modules []string
+}
+
+// Validate checks the module arguments.
+func (x *SchemaCommand) Validate(args []string) error {
+	for _, name := range args {
+		if GetModule(name) == nil {
+			return fmt.Errorf("unknown module %s", name)
+		}
+	}
+	if !x.Record && len(args) != 1 {
+		return errors.New("give one module, or --record")
+	}
+	x.modules = args
+	if x.Record && len(x.modules) == 0 {
+		for name := range modules {
+			x.modules = append(x.modules, name)
+		}
+		sort.Strings(x.modules)
+	}
+	return nil
+}
+
+// Help returns a usage string that will be output at the command line
+func (x *SchemaCommand) Help() string {
+	return "Writes the JSON Schema of the results of the module given as argument, or with --record of the output records"
+}
+
+// Run writes the schema to the output file.
+func (x *SchemaCommand) Run() error {
+	var schema map[string]interface{}
+	if x.Record {
+		schema = RecordSchema(x.modules)
+	} else {
+		schema = ModuleSchema(x.modules[0])
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	output, err := commandOutput()
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(append(data, '\n'))
+	return err
+}
+
+// ModuleSchema returns the JSON Schema of the responses of the named module.
+// The result is only described if the module implements ResultSchemaModule.
+func ModuleSchema(name string) map[string]interface{} {
+	g := newSchemaGenerator()
+	ret := g.document(g.responseSchema(GetModule(name)))
+	ret["title"] = "zgrab2 " + name + " response"
+	return ret
+}
+
+// RecordSchema returns the JSON Schema of the output records, with the
+// results of the named modules under data. The results of other scanner
+// names are only checked as responses.
+func RecordSchema(names []string) map[string]interface{} {
+	g := newSchemaGenerator()
+	record := g.structSchema(reflect.TypeOf(Grab{}))
+	properties := record["properties"].(map[string]interface{})
+	properties["schema_version"] = map[string]interface{}{"type": "integer", "const": OutputSchemaVersion}
+	data := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		g.definitions[name+"_response"] = g.responseSchema(GetModule(name))
+		data[name] = map[string]interface{}{"$ref": "#/definitions/" + name + "_response"}
+	}
+	g.definitions["response"] = g.responseSchema(nil)
+	properties["data"] = map[string]interface{}{
+		"type":                 "object",
+		"properties":           data,
+		"additionalProperties": map[string]interface{}{"$ref": "#/definitions/response"},
+	}
+	ret := g.document(record)
+	ret["title"] = "zgrab2 output record"
+	return ret
+}
+
+// schemaGenerator generates the JSON Schema of Go types as encoded by
+// encoding/json. Named struct types are defined once, in definitions, so
+// that recursive types are described.
+type schemaGenerator struct {
+	definitions map[string]interface{}
+	names       map[reflect.Type]string
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		definitions: make(map[string]interface{}),
+		names:       make(map[reflect.Type]string),
+	}
+}
+
+// document returns the schema document of root, with the definitions.
+func (g *schemaGenerator) document(root map[string]interface{}) map[string]interface{} {
+	root["$schema"] = jsonSchemaDraft
+	root["schema_version"] = OutputSchemaVersion
+	if len(g.definitions) > 0 {
+		root["definitions"] = g.definitions
+	}
+	return root
+}
+
+// responseSchema returns the schema of the ScanResponse of module, with its
+// result type if it declares it.
+func (g *schemaGenerator) responseSchema(module ScanModule) map[string]interface{} {
+	ret := g.structSchema(reflect.TypeOf(ScanResponse{}))
+	if m, ok := module.(ResultSchemaModule); ok {
+		ret["properties"].(map[string]interface{})["result"] = nullable(g.schema(reflect.TypeOf(m.NewResult())))
+	}
+	return ret
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshaler     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	nullSchema        = map[string]interface{}{"type": "null"}
+	customJSONEncoded = "custom JSON encoding"
+)
+
+// implements returns true if t or *t implements iface.
+func implements(t reflect.Type, iface reflect.Type) bool {
+	return t.Implements(iface) || (t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(iface))
+}
+
+// nullable returns schema, also allowing null.
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if len(schema) == 0 || isNullable(schema) {
+		return schema
+	}
+	if t, ok := schema["type"].(string); ok {
+		ret := make(map[string]interface{}, len(schema))
+		for k, v := range schema {
+			ret[k] = v
+		}
+		ret["type"] = []string{t, "null"}
+		return ret
+	}
+	return map[string]interface{}{"anyOf": []interface{}{schema, nullSchema}}
+}
+
+// isNullable returns true if schema is that of a nullable type.
+func isNullable(schema map[string]interface{}) bool {
+	if types, ok := schema["type"].([]string); ok {
+		return len(types) == 2 && types[1] == "null"
+	}
+	anyOf, ok := schema["anyOf"].([]interface{})
+	return ok && len(anyOf) == 2 && reflect.DeepEqual(anyOf[1], nullSchema)
+}
+
+// schema returns the schema of the values of type t.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case implements(t, jsonMarshaler):
+		if t.Kind() == reflect.Ptr {
+			return nullable(g.schema(t.Elem()))
+		}
+		return map[string]interface{}{"description": customJSONEncoded}
+	case implements(t, textMarshaler):
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && !implements(t.Elem(), jsonMarshaler) && !implements(t.Elem(), textMarshaler) {
+			return nullable(map[string]interface{}{"type": "string", "contentEncoding": "base64"})
+		}
+		return nullable(map[string]interface{}{"type": "array", "items": g.schema(t.Elem())})
+	case reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return nullable(map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())})
+	case reflect.Ptr:
+		return nullable(g.schema(t.Elem()))
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = g.definitionName(t)
+			g.names[t] = name
+			// The definition is reserved before the fields are walked, for
+			// recursive types.
+			g.definitions[name] = nil
+			g.definitions[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + name}
+	}
+	// Interfaces hold any value; channels and functions are not encoded.
+	return map[string]interface{}{}
+}
+
+// definitionName returns a unique name for the named type t, qualified by
+// its package name.
+func (g *schemaGenerator) definitionName(t reflect.Type) string {
+	base := path.Base(t.PkgPath()) + "." + t.Name()
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := g.definitions[name]; !ok {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+}
+
+// structSchema returns the schema of the object encoding a struct of type t.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	g.addFields(t, properties, &required, make(map[string]bool))
+	ret := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		ret["required"] = required
+	}
+	return ret
+}
+
+// addFields adds the properties of the fields of the struct type t,
+// including those promoted from its embedded structs. As in encoding/json,
+// the fields that are less nested win.
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string, seen map[string]bool) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, options = tag[:i], tag[i:]
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			embedded = append(embedded, fieldType)
+			continue
+		}
+		if field.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		schema := g.schema(field.Type)
+		if strings.Contains(options, ",string") {
+			schema = map[string]interface{}{"type": "string"}
+		}
+		properties[name] = schema
+		if !strings.Contains(options, ",omitempty") {
+			*required = append(*required, name)
+		}
+	}
+	for _, e := range embedded {
+		if implements(e, jsonMarshaler) {
+			continue
+		}
+		g.addFields(e, properties, required, seen)
+	}
+}
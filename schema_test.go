@@ -0,0 +1,102 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type schemaTestBase struct {
+	Name string `json:"name"`
+	ID   int    `json:"id,omitempty"`
+}
+
+type schemaTestNode struct {
+	schemaTestBase
+	ID       string            `json:"id"`
+	Address  net.IP            `json:"address,omitempty"`
+	Raw      []byte            `json:"raw,omitempty"`
+	Count    uint64            `json:"count,string"`
+	Seen     time.Time         `json:"seen"`
+	Children []*schemaTestNode `json:"children,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Extra    interface{}       `json:"extra,omitempty"`
+	Skipped  string            `json:"-"`
+	hidden   string
+}
+
+// schemaTestModule declares its result type.
+type schemaTestModule struct {
+	staticModule
+}
+
+func (m *schemaTestModule) NewResult() interface{} { return new(schemaTestNode) }
+
+func TestSchemaGenerator(t *testing.T) {
+	g := newSchemaGenerator()
+	if ref := g.schema(reflect.TypeOf(schemaTestNode{})); ref["$ref"] != "#/definitions/zgrab2.schemaTestNode" {
+		t.Fatalf("got %v", ref)
+	}
+	data, err := json.Marshal(g.definitions["zgrab2.schemaTestNode"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var node struct {
+		Properties map[string]map[string]interface{}
+		Required   []string
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(node.Properties))
+	for name := range node.Properties {
+		names = append(names, name)
+	}
+	expected := []string{"address", "children", "count", "extra", "headers", "id", "name", "raw", "seen"}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("got properties %v, expected %v", names, expected)
+	}
+	for name, expected := range map[string]string{
+		// The outer id wins over the embedded one.
+		"id":       `{"type":"string"}`,
+		"name":     `{"type":"string"}`,
+		"address":  `{"type":"string"}`,
+		"raw":      `{"contentEncoding":"base64","type":["string","null"]}`,
+		"count":    `{"type":"string"}`,
+		"seen":     `{"format":"date-time","type":"string"}`,
+		"children": `{"items":{"anyOf":[{"$ref":"#/definitions/zgrab2.schemaTestNode"},{"type":"null"}]},"type":["array","null"]}`,
+		"headers":  `{"additionalProperties":{"type":"string"},"type":["object","null"]}`,
+		"extra":    `{}`,
+	} {
+		if got, _ := json.Marshal(node.Properties[name]); string(got) != expected {
+			t.Errorf("%s: got %s, expected %s", name, got, expected)
+		}
+	}
+	if !reflect.DeepEqual(node.Required, []string{"count", "id", "name", "seen"}) {
+		t.Errorf("got required %v", node.Required)
+	}
+
+	modules["schematest"] = &schemaTestModule{staticModule{name: "schematest"}}
+	defer delete(modules, "schematest")
+	schema := ModuleSchema("schematest")
+	result := schema["properties"].(map[string]interface{})["result"]
+	if got, _ := json.Marshal(result); string(got) != `{"anyOf":[{"$ref":"#/definitions/zgrab2.schemaTestNode"},{"type":"null"}]}` {
+		t.Errorf("got result %s", got)
+	}
+	if schema["schema_version"] != OutputSchemaVersion || schema["definitions"].(map[string]interface{})["zgrab2.Timing"] == nil {
+		t.Errorf("got %v", schema)
+	}
+
+	record := RecordSchema([]string{"schematest"})
+	data, err = json.Marshal(record["properties"].(map[string]interface{})["data"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"additionalProperties":{"$ref":"#/definitions/response"},"properties":{"schematest":{"$ref":"#/definitions/schematest_response"}},"type":"object"}` {
+		t.Errorf("got data %s", data)
+	}
+}
@@ -0,0 +1,683 @@
+package zgrab2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	flags "github.com/zmap/zflags"
+)
+
+// ServeCommand holds the options of the serve command, which runs scans
+// submitted to an HTTP API instead of scanning the input file.
+type ServeCommand struct {
+	Listen     string        `long:"listen" default:":8000" description:"Address of the HTTP API (empty for none)"`
+	GRPCListen string        `long:"grpc-listen" description:"Address of the gRPC ScanService of scan.proto, served over HTTP/2 without TLS"`
+	Token      string        `long:"token" description:"Require this bearer token in the Authorization header of each request (default: the ZGRAB2_API_TOKEN environment variable)"`
+	MaxJobs    int           `long:"max-jobs" default:"4" description:"Number of scan jobs run at once; further submissions are refused with 429"`
+	MaxSenders int           `long:"max-senders" default:"100" description:"Maximum number of senders of a job"`
+	MaxTargets int           `long:"max-targets" default:"65536" description:"Maximum number of targets of a job, after expanding networks and ranges"`
+	JobTTL     time.Duration `long:"job-ttl" default:"1h" description:"How long the results of a finished job are kept for polling"`
+}
+
+// Validate checks the options.
+func (x *ServeCommand) Validate(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %q", args)
+	}
+	if x.Listen == "" && x.GRPCListen == "" {
+		return errors.New("give --listen or --grpc-listen")
+	}
+	if x.MaxJobs <= 0 || x.MaxSenders <= 0 || x.MaxTargets <= 0 {
+		return errors.New("--max-jobs, --max-senders and --max-targets must be positive")
+	}
+	return nil
+}
+
+// Help returns a usage string that will be output at the command line
+func (x *ServeCommand) Help() string {
+	return "Runs the scans submitted to an HTTP API: POST /v1/scans, then GET /v1/scans/ID and /v1/scans/ID/results, or to the gRPC ScanService of scan.proto with --grpc-listen; PUT /v1/configs/NAME registers a scan configuration that scans refer to by name"
+}
+
+// Run serves the HTTP API and the gRPC service until one fails.
+func (x *ServeCommand) Run() error {
+	server, err := NewScanServer(x)
+	if err != nil {
+		return err
+	}
+	errs := make(chan error, 2)
+	if x.Listen != "" {
+		log.Infof("serving the scan API on %s", x.Listen)
+		go func() {
+			errs <- http.ListenAndServe(x.Listen, server)
+		}()
+	}
+	if x.GRPCListen != "" {
+		log.Infof("serving the gRPC scan service on %s", x.GRPCListen)
+		go func() {
+			errs <- http.ListenAndServe(x.GRPCListen, server.GRPCHandler())
+		}()
+	}
+	return <-errs
+}
+
+// ScanRequest is the body of a POST /v1/scans: the targets, in the format
+// of the lines of the input file, and the modules to scan them with.
+type ScanRequest struct {
+	Targets []string `json:"targets"`
+
+	// Module and Flags give a single module; Modules give several, run in
+	// order.
+	Module  string                 `json:"module,omitempty"`
+	Flags   map[string]interface{} `json:"flags,omitempty"`
+	Modules []ScanRequestModule    `json:"modules,omitempty"`
+
+	// Config gives the modules of a registered ScanConfig by name, instead
+	// of Module or Modules.
+	Config string `json:"config,omitempty"`
+
+	// Senders is the number of targets scanned at once (default 1, or the
+	// senders of the Config).
+	Senders int `json:"senders,omitempty"`
+
+	// Debug includes the debug fields in the results, as --debug does.
+	Debug bool `json:"debug,omitempty"`
+}
+
+// ScanConfig is a scan configuration registered by name with PUT
+// /v1/configs/NAME: the modules of a ScanRequest, given the same way, and
+// its default number of senders. Once registered, it is stored with
+// Modules only.
+type ScanConfig struct {
+	Module  string                 `json:"module,omitempty"`
+	Flags   map[string]interface{} `json:"flags,omitempty"`
+	Modules []ScanRequestModule    `json:"modules,omitempty"`
+	Senders int                    `json:"senders,omitempty"`
+}
+
+// ScanRequestModule is a module of a ScanRequest, with its flags by long
+// name, as in the YAML config of the multiple command.
+type ScanRequestModule struct {
+	Module string                 `json:"module"`
+	Flags  map[string]interface{} `json:"flags,omitempty"`
+}
+
+// Statuses of a ScanJobState.
+const (
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// ScanJobState is the state of a submitted scan, as returned by GET
+// /v1/scans/ID.
+type ScanJobState struct {
+	ID       string     `json:"id"`
+	Config   string     `json:"config,omitempty"`
+	Status   string     `json:"status"`
+	Targets  int        `json:"targets"`
+	Results  int        `json:"results"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// scanJob is a submitted scan, with its results.
+type scanJob struct {
+	ScanJobState
+
+	mutex   sync.Mutex
+	results [][]byte
+	cancel  context.CancelFunc
+
+	// changed is closed, and replaced, when a result is added or the job
+	// finishes.
+	changed chan struct{}
+}
+
+// state returns the current state of the job.
+func (j *scanJob) state() ScanJobState {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	state := j.ScanJobState
+	state.Results = len(j.results)
+	return state
+}
+
+func (j *scanJob) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+func (j *scanJob) add(result []byte) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.results = append(j.results, result)
+	j.notify()
+}
+
+func (j *scanJob) finish(status string, err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	now := time.Now()
+	j.Status, j.Finished = status, &now
+	if err != nil {
+		j.Error = err.Error()
+	}
+	j.notify()
+}
+
+// since returns the results from offset on, whether the job is finished, and
+// the channel closed on its next change.
+func (j *scanJob) since(offset int) ([][]byte, bool, <-chan struct{}) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	var results [][]byte
+	if offset < len(j.results) {
+		results = j.results[offset:]
+	}
+	return results, j.Finished != nil, j.changed
+}
+
+// ScanServer is the http.Handler of the scan API.
+type ScanServer struct {
+	options *ServeCommand
+	token   string
+	slots   chan struct{}
+
+	mutex   sync.Mutex
+	jobs    map[string]*scanJob
+	configs map[string]*ScanConfig
+}
+
+// NewScanServer returns the ScanServer of the options of the serve command.
+func NewScanServer(options *ServeCommand) (*ScanServer, error) {
+	if err := options.Validate(nil); err != nil {
+		return nil, err
+	}
+	return &ScanServer{
+		options: options,
+		token:   options.token(),
+		slots:   make(chan struct{}, options.MaxJobs),
+		jobs:    make(map[string]*scanJob),
+		configs: make(map[string]*ScanConfig),
+	}, nil
+}
+
+func (x *ServeCommand) token() string {
+	if x.Token != "" {
+		return x.Token
+	}
+	return strings.TrimSpace(os.Getenv("ZGRAB2_API_TOKEN"))
+}
+
+// serveError writes an error response with a JSON body.
+func serveError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func serveJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+// ServeHTTP routes the requests of the API:
+//
+//	GET    /v1/modules              the names of the modules
+//	POST   /v1/scans[?stream=true]  submit a ScanRequest
+//	GET    /v1/scans                the jobs
+//	GET    /v1/scans/ID             the job
+//	GET    /v1/scans/ID/results     its results as JSON lines, from ?offset=N,
+//	                                following the job with ?follow=true
+//	DELETE /v1/scans/ID             cancel the job
+//	GET    /v1/configs              the registered scan configurations
+//	PUT    /v1/configs/NAME         register (or replace) a ScanConfig
+//	GET    /v1/configs/NAME         the scan configuration
+//	DELETE /v1/configs/NAME         unregister it
+func (s *ScanServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			serveError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+	}
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "v1/modules" && r.Method == "GET":
+		names := make([]string, 0, len(modules))
+		for name := range modules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		serveJSON(w, http.StatusOK, names)
+	case path == "v1/scans" && r.Method == "POST":
+		s.submit(w, r)
+	case path == "v1/scans" && r.Method == "GET":
+		s.mutex.Lock()
+		jobs := make([]ScanJobState, 0, len(s.jobs))
+		for _, job := range s.jobs {
+			jobs = append(jobs, job.state())
+		}
+		s.mutex.Unlock()
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+		serveJSON(w, http.StatusOK, jobs)
+	case path == "v1/configs" && r.Method == "GET":
+		s.mutex.Lock()
+		configs := make(map[string]*ScanConfig, len(s.configs))
+		for name, cfg := range s.configs {
+			configs[name] = cfg
+		}
+		s.mutex.Unlock()
+		serveJSON(w, http.StatusOK, configs)
+	case len(parts) == 3 && parts[0] == "v1" && parts[1] == "configs":
+		s.serveConfig(w, r, parts[2])
+	case len(parts) == 3 && parts[0] == "v1" && parts[1] == "scans" || len(parts) == 4 && parts[0] == "v1" && parts[1] == "scans" && parts[3] == "results":
+		s.mutex.Lock()
+		job := s.jobs[parts[2]]
+		s.mutex.Unlock()
+		if job == nil {
+			serveError(w, http.StatusNotFound, "no job %s", parts[2])
+			return
+		}
+		switch {
+		case len(parts) == 4 && r.Method == "GET":
+			offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+			if err != nil || offset < 0 {
+				offset = 0
+			}
+			s.writeResults(w, r, job, offset, r.URL.Query().Get("follow") == "true")
+		case len(parts) == 3 && r.Method == "GET":
+			serveJSON(w, http.StatusOK, job.state())
+		case len(parts) == 3 && r.Method == "DELETE":
+			job.cancel()
+			serveJSON(w, http.StatusOK, job.state())
+		default:
+			serveError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		}
+	default:
+		serveError(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+// serveConfig registers, returns or unregisters the named scan
+// configuration. A configuration is checked as a scan would be when it is
+// registered; replacing or unregistering it does not change the jobs that
+// already use it.
+func (s *ScanServer) serveConfig(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case "PUT":
+		var cfg ScanConfig
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			serveError(w, http.StatusBadRequest, "invalid configuration: %v", err)
+			return
+		}
+		if cfg.Module != "" {
+			if len(cfg.Modules) > 0 {
+				serveError(w, http.StatusBadRequest, "give module or modules, not both")
+				return
+			}
+			cfg.Modules = []ScanRequestModule{{Module: cfg.Module, Flags: cfg.Flags}}
+			cfg.Module, cfg.Flags = "", nil
+		}
+		if _, err := s.moduleOptions(cfg.Modules, cfg.Senders); err != nil {
+			serveError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		s.mutex.Lock()
+		_, replaced := s.configs[name]
+		s.configs[name] = &cfg
+		s.mutex.Unlock()
+		log.Infof("registered scan configuration %s", name)
+		code := http.StatusCreated
+		if replaced {
+			code = http.StatusOK
+		}
+		serveJSON(w, code, &cfg)
+	case "GET", "DELETE":
+		s.mutex.Lock()
+		cfg := s.configs[name]
+		if r.Method == "DELETE" {
+			delete(s.configs, name)
+		}
+		s.mutex.Unlock()
+		if cfg == nil {
+			serveError(w, http.StatusNotFound, "no configuration %s", name)
+			return
+		}
+		serveJSON(w, http.StatusOK, cfg)
+	default:
+		serveError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+}
+
+// submit starts the job of a ScanRequest. It answers with the job, or with
+// its results as they come with ?stream=true, canceling the job if the
+// client goes away.
+func (s *ScanServer) submit(w http.ResponseWriter, r *http.Request) {
+	var req ScanRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		serveError(w, http.StatusBadRequest, "invalid request: %v", err)
+		return
+	}
+	opts, targets, err := s.runnerOptions(&req)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "10")
+		serveError(w, http.StatusTooManyRequests, "%d jobs are running", s.options.MaxJobs)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &scanJob{
+		ScanJobState: ScanJobState{
+			ID:      newJobID(),
+			Config:  req.Config,
+			Status:  JobRunning,
+			Targets: len(targets),
+			Created: time.Now(),
+		},
+		cancel:  cancel,
+		changed: make(chan struct{}),
+	}
+	opts.Input = func(ch chan<- ScanTarget) error {
+		for _, target := range targets {
+			ch <- target
+		}
+		return nil
+	}
+	opts.Output = func(grab *Grab) {
+		result, err := EncodeGrab(grab, req.Debug)
+		if err != nil {
+			log.Errorf("job %s: unable to marshal data: %s", job.ID, err)
+			return
+		}
+		job.add(result)
+	}
+	runner, err := NewRunner(*opts)
+	if err != nil {
+		<-s.slots
+		cancel()
+		serveError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	s.mutex.Lock()
+	s.expire()
+	s.jobs[job.ID] = job
+	s.mutex.Unlock()
+	go func() {
+		err := runner.RunContext(ctx)
+		// The slot is free once the job is seen finished.
+		cancel()
+		<-s.slots
+		switch {
+		case err == context.Canceled:
+			job.finish(JobCanceled, nil)
+		case err != nil:
+			job.finish(JobFailed, err)
+		default:
+			job.finish(JobDone, nil)
+		}
+	}()
+	log.Infof("job %s: scanning %d targets", job.ID, len(targets))
+	if r.URL.Query().Get("stream") == "true" {
+		w.Header().Set("X-Zgrab2-Job", job.ID)
+		if !s.writeResults(w, r, job, 0, true) {
+			job.cancel()
+		}
+		return
+	}
+	w.Header().Set("Location", "/v1/scans/"+job.ID)
+	serveJSON(w, http.StatusAccepted, job.state())
+}
+
+// writeResults writes the results of the job from offset on as JSON lines,
+// and with follow those that come until the job finishes. It returns false
+// if the client went away first.
+func (s *ScanServer) writeResults(w http.ResponseWriter, r *http.Request, job *scanJob, offset int, follow bool) bool {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	for {
+		results, finished, changed := job.since(offset)
+		for _, result := range results {
+			if _, err := w.Write(append(result, '\n')); err != nil {
+				return false
+			}
+		}
+		offset += len(results)
+		if !follow || (finished && len(results) == 0) {
+			return true
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if finished {
+			continue
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
+
+// expire drops the jobs finished longer than --job-ttl ago. The caller holds
+// the mutex.
+func (s *ScanServer) expire() {
+	for id, job := range s.jobs {
+		if state := job.state(); state.Finished != nil && time.Since(*state.Finished) > s.options.JobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// runnerOptions returns the RunnerOptions of a request, without its input
+// and output, and its targets.
+func (s *ScanServer) runnerOptions(req *ScanRequest) (*RunnerOptions, []ScanTarget, error) {
+	requested := req.Modules
+	if req.Module != "" {
+		if len(requested) > 0 {
+			return nil, nil, errors.New("give module or modules, not both")
+		}
+		requested = []ScanRequestModule{{Module: req.Module, Flags: req.Flags}}
+	}
+	opts, err := s.configOptions(req.Config, requested, req.Senders)
+	if err != nil {
+		return nil, nil, err
+	}
+	targets, err := parseRequestTargets(req.Targets, s.options.MaxTargets)
+	if err != nil {
+		return nil, nil, err
+	}
+	return opts, targets, nil
+}
+
+// configOptions returns the RunnerOptions of the named scan configuration,
+// or else of the requested modules, with the number of senders (by default,
+// those of the configuration), without an input and output.
+func (s *ScanServer) configOptions(name string, requested []ScanRequestModule, senders int) (*RunnerOptions, error) {
+	if name == "" {
+		return s.moduleOptions(requested, senders)
+	}
+	if len(requested) > 0 {
+		return nil, errors.New("give config or modules, not both")
+	}
+	s.mutex.Lock()
+	cfg := s.configs[name]
+	s.mutex.Unlock()
+	if cfg == nil {
+		return nil, fmt.Errorf("unknown configuration %q", name)
+	}
+	if senders == 0 {
+		senders = cfg.Senders
+	}
+	// The flags are parsed again for each job, so that the jobs do not
+	// share them.
+	return s.moduleOptions(cfg.Modules, senders)
+}
+
+// moduleOptions returns the RunnerOptions of the requested modules and
+// number of senders, without an input and output.
+func (s *ScanServer) moduleOptions(requested []ScanRequestModule, senders int) (*RunnerOptions, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("no module")
+	}
+	if senders > s.options.MaxSenders {
+		return nil, fmt.Errorf("at most %d senders", s.options.MaxSenders)
+	}
+	opts := &RunnerOptions{
+		Modules:            NewModuleSet(),
+		Flags:              make(map[string]ScanFlags),
+		Senders:            senders,
+		ContinueOnError:    true,
+		WatchdogTimeout:    config.WatchdogTimeout,
+		TargetTimeout:      config.TargetTimeout,
+		RecordLocalAddr:    config.RecordLocalAddr,
+		TimingPrecision:    config.TimingPrecision,
+		Recog:              config.recog,
+		AddressPolicy:      config.addressPolicy,
+		SourceIPs:          config.LocalAddress,
+		SourcePorts:        config.SourcePorts,
+		SourceIPPool:       config.SourceIPPool,
+		Interface:          config.Interface,
+		HappyEyeballs:      config.HappyEyeballs,
+		HappyEyeballsDelay: config.HappyEyeballsDelay,
+	}
+	for i, m := range requested {
+		module := GetModule(m.Module)
+		if module == nil {
+			return nil, fmt.Errorf("modules[%d]: unknown module %q", i, m.Module)
+		}
+		flags, err := parseModuleFlags(m.Module, m.Flags)
+		if err != nil {
+			return nil, fmt.Errorf("modules[%d]: %v", i, err)
+		}
+		name := flags.(interface{ GetName() string }).GetName()
+		if _, ok := opts.Modules[name]; ok {
+			return nil, fmt.Errorf("modules[%d]: duplicate name %s", i, name)
+		}
+		opts.Modules[name] = module
+		opts.Flags[name] = flags
+		opts.Order = append(opts.Order, name)
+	}
+	return opts, nil
+}
+
+// parseRequestTargets returns the targets of the lines, dropping those
+// outside the --blocklist-file and --allowlist-file, or an error if there
+// are more than max.
+func parseRequestTargets(lines []string, max int) ([]ScanTarget, error) {
+	if len(lines) == 0 {
+		return nil, errors.New("no targets")
+	}
+	input := func(ch chan<- ScanTarget) error {
+		return GetTargetsCSV(strings.NewReader(strings.Join(lines, "\n")), ch)
+	}
+	if config.addressPolicy != nil {
+		input = config.addressPolicy.filterTargets(input)
+	}
+	var targets []ScanTarget
+	err := pipeTargets(input, nil, func(ch <-chan ScanTarget) {
+		for target := range ch {
+			if len(targets) <= max {
+				targets = append(targets, target)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) > max {
+		return nil, fmt.Errorf("more than %d targets", max)
+	}
+	return targets, nil
+}
+
+// parseModuleFlags returns the flags of a module, with its defaults and the
+// values given by long name, validated. Lists give a value per element, and
+// maps KEY:VALUE per entry; boolean flags are set by true, or "true".
+func parseModuleFlags(module string, values map[string]interface{}) (ScanFlags, error) {
+	p := flags.NewNamedParser("zgrab2", flags.None)
+	cmd, err := p.AddCommand(module, "", "", GetModule(module))
+	if err != nil {
+		return nil, err
+	}
+	// The port and name defaults of the module's command.
+	if registered := parser.Find(module); registered != nil {
+		for _, name := range []string{"port", "name"} {
+			if option := registered.FindOptionByLongName(name); option != nil {
+				cmd.FindOptionByLongName(name).Default = option.Default
+			}
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := []string{module}
+	for _, name := range names {
+		if option := cmd.FindOptionByLongName(name); option != nil {
+			if _, ok := option.Value().(bool); ok {
+				set, err := strconv.ParseBool(fmt.Sprint(values[name]))
+				if err != nil {
+					return nil, fmt.Errorf("%s: not a boolean", name)
+				}
+				if set {
+					args = append(args, "--"+name)
+				}
+				continue
+			}
+		}
+		list, err := iniValues(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, value := range list {
+			args = append(args, "--"+name+"="+value)
+		}
+	}
+	_, _, data, err := p.ParseCommandLine(args)
+	if err != nil {
+		return nil, err
+	}
+	ret, ok := data.(ScanFlags)
+	if !ok {
+		return nil, fmt.Errorf("the flags of module %s are not ScanFlags", module)
+	}
+	return ret, nil
+}
+
+// newJobID returns a random job ID.
+func newJobID() string {
+	var id [12]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,395 @@
+package zgrab2
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// scanServiceMethod is the path of the Scan method of scan.proto.
+const scanServiceMethod = "/zgrab2.v1.ScanService/Scan"
+
+// Field numbers of the messages in scan.proto.
+const (
+	protoRequestModules = 1
+	protoRequestSenders = 2
+	protoRequestTargets = 3
+	protoRequestConfig  = 4
+	protoRequestDebug   = 5
+
+	protoModuleName  = 1
+	protoModuleFlags = 2
+
+	protoFlagName  = 1
+	protoFlagValue = 2
+
+	protoResultGrab = 1
+)
+
+// gRPC status codes of the Scan responses.
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcInvalidArgument   = 3
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnauthenticated   = 16
+)
+
+// grpcMaxMessage is the largest request message read.
+const grpcMaxMessage = 16 << 20
+
+// grpcError is an error with a gRPC status code.
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+func grpcErrorf(code int, format string, args ...interface{}) error {
+	return &grpcError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// scanServiceRequest is a decoded ScanRequest message.
+type scanServiceRequest struct {
+	modules []ScanRequestModule
+	senders int
+	targets []string
+	config  string
+	debug   bool
+}
+
+// consumeProtoVarint decodes the varint at the start of b, returning its
+// length, or 0 if it is invalid.
+func consumeProtoVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// rangeProtoFields calls f with each field of a message: its number, and its
+// value for the varint fields, or its bytes for the length-delimited ones.
+// Fields of other wire types are skipped.
+func rangeProtoFields(b []byte, f func(field int, varint uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := consumeProtoVarint(b)
+		if n == 0 {
+			return errors.New("invalid field tag")
+		}
+		b = b[n:]
+		field, wireType := int(tag>>3), int(tag&7)
+		var varint uint64
+		var data []byte
+		switch wireType {
+		case protoWireVarint:
+			if varint, n = consumeProtoVarint(b); n == 0 {
+				return errors.New("invalid varint")
+			}
+		case protoWireFixed64:
+			n = 8
+		case protoWireBytes:
+			length, m := consumeProtoVarint(b)
+			if m == 0 || length > uint64(len(b)-m) {
+				return errors.New("invalid length")
+			}
+			data = b[m : m+int(length)]
+			n = m + int(length)
+		case 5: // fixed32
+			n = 4
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+		if n > len(b) {
+			return errors.New("truncated field")
+		}
+		b = b[n:]
+		if err := f(field, varint, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeScanServiceRequest decodes a ScanRequest message. The flags given
+// several times become a list.
+func decodeScanServiceRequest(b []byte) (*scanServiceRequest, error) {
+	req := new(scanServiceRequest)
+	err := rangeProtoFields(b, func(field int, varint uint64, data []byte) error {
+		switch field {
+		case protoRequestSenders:
+			req.senders = int(varint)
+		case protoRequestTargets:
+			req.targets = append(req.targets, string(data))
+		case protoRequestConfig:
+			req.config = string(data)
+		case protoRequestDebug:
+			req.debug = varint != 0
+		case protoRequestModules:
+			module := ScanRequestModule{Flags: make(map[string]interface{})}
+			err := rangeProtoFields(data, func(field int, _ uint64, data []byte) error {
+				switch field {
+				case protoModuleName:
+					module.Module = string(data)
+				case protoModuleFlags:
+					var name, value string
+					err := rangeProtoFields(data, func(field int, _ uint64, data []byte) error {
+						switch field {
+						case protoFlagName:
+							name = string(data)
+						case protoFlagValue:
+							value = string(data)
+						}
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					switch previous := module.Flags[name].(type) {
+					case nil:
+						module.Flags[name] = value
+					case string:
+						module.Flags[name] = []interface{}{previous, value}
+					case []interface{}:
+						module.Flags[name] = append(previous, value)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			req.modules = append(req.modules, module)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// readGRPCMessage reads a length-prefixed message. It returns io.EOF at the
+// end of the stream.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, grpcErrorf(grpcInvalidArgument, "truncated message")
+		}
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > grpcMaxMessage {
+		return nil, grpcErrorf(grpcResourceExhausted, "message of %d bytes is too large", length)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "truncated message")
+	}
+	return message, nil
+}
+
+// grpcMessage returns a message with its gRPC length prefix.
+func grpcMessage(message []byte) []byte {
+	framed := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(framed[1:], uint32(len(message)))
+	return append(framed, message...)
+}
+
+// grpcPercentEncode encodes a grpc-message trailer.
+func grpcPercentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// writeGRPCStatus sets the status of a response from err: in the trailers
+// once the headers are sent, or in the headers of a trailers-only response.
+func writeGRPCStatus(w http.ResponseWriter, err error, headersSent bool) {
+	code, message := grpcOK, ""
+	if e, ok := err.(*grpcError); ok {
+		code, message = e.code, e.message
+	} else if err == context.Canceled {
+		code, message = grpcCanceled, "scan canceled"
+	} else if err != nil {
+		code, message = grpcInternal, err.Error()
+	}
+	prefix := ""
+	if headersSent {
+		prefix = http.TrailerPrefix
+	}
+	w.Header().Set(prefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(prefix+"Grpc-Message", grpcPercentEncode(message))
+	}
+}
+
+// GRPCHandler returns the http.Handler of the ScanService of scan.proto,
+// served over HTTP/2 without TLS (h2c, with prior knowledge). It shares the
+// token and the job slots of the HTTP API.
+func (s *ScanServer) GRPCHandler() http.Handler {
+	return h2c.NewHandler(http.HandlerFunc(s.serveGRPC), &http2.Server{})
+}
+
+func (s *ScanServer) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "expected a gRPC request", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	if r.URL.Path != scanServiceMethod {
+		writeGRPCStatus(w, grpcErrorf(grpcUnimplemented, "unknown method %s", r.URL.Path), false)
+		return
+	}
+	if s.token != "" {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+s.token)) != 1 {
+			writeGRPCStatus(w, grpcErrorf(grpcUnauthenticated, "missing or invalid token"), false)
+			return
+		}
+	}
+	// The first request configures the scan.
+	message, err := readGRPCMessage(r.Body)
+	if err == io.EOF {
+		writeGRPCStatus(w, nil, false)
+		return
+	} else if err != nil {
+		writeGRPCStatus(w, err, false)
+		return
+	}
+	first, err := decodeScanServiceRequest(message)
+	if err != nil {
+		writeGRPCStatus(w, grpcErrorf(grpcInvalidArgument, "invalid request: %v", err), false)
+		return
+	}
+	opts, err := s.configOptions(first.config, first.modules, first.senders)
+	if err != nil {
+		writeGRPCStatus(w, grpcErrorf(grpcInvalidArgument, "%v", err), false)
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		writeGRPCStatus(w, grpcErrorf(grpcResourceExhausted, "%d jobs are running", s.options.MaxJobs), false)
+		return
+	}
+	writeGRPCStatus(w, s.scanStream(w, r, first, opts), true)
+}
+
+// scanStream runs the scan of a Scan stream configured by its first
+// request, and returns its status.
+func (s *ScanServer) scanStream(w http.ResponseWriter, r *http.Request, first *scanServiceRequest, opts *RunnerOptions) error {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	// inputErr is the error of the stream of requests, set by the input
+	// and read once the runner returns, which may be before the input does.
+	var inputMutex sync.Mutex
+	var inputErr error
+	setInputErr := func(err error) error {
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+		inputErr = err
+		return err
+	}
+	input := func(ch chan<- ScanTarget) error {
+		lines := first.targets
+		for {
+			if len(lines) > 0 {
+				if err := GetTargetsCSV(strings.NewReader(strings.Join(lines, "\n")), ch); err != nil {
+					return err
+				}
+			}
+			message, err := readGRPCMessage(r.Body)
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return setInputErr(err)
+			}
+			req, err := decodeScanServiceRequest(message)
+			if err == nil && (len(req.modules) > 0 || req.config != "" || req.debug) {
+				err = errors.New("modules, config and debug are only given in the first request")
+			}
+			if err != nil {
+				return setInputErr(grpcErrorf(grpcInvalidArgument, "invalid request: %v", err))
+			}
+			lines = req.targets
+		}
+	}
+	opts.Input = input
+	var mutex sync.Mutex
+	var writeErr error
+	opts.Output = func(grab *Grab) {
+		result, err := EncodeGrab(grab, first.debug)
+		if err != nil {
+			log.Errorf("gRPC scan: unable to marshal data: %s", err)
+			return
+		}
+		record, err := EncodeGrabProtobuf(result)
+		if err != nil {
+			log.Errorf("gRPC scan: unable to encode data: %s", err)
+			return
+		}
+		message := appendProtoBytes(nil, protoResultGrab, record)
+		mutex.Lock()
+		defer mutex.Unlock()
+		if writeErr != nil {
+			return
+		}
+		if _, writeErr = w.Write(grpcMessage(message)); writeErr != nil {
+			cancel()
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	runner, err := NewRunner(*opts)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	if err := runner.RunContext(ctx); err != nil {
+		inputMutex.Lock()
+		defer inputMutex.Unlock()
+		if inputErr != nil {
+			return inputErr
+		}
+		return err
+	}
+	return nil
+}
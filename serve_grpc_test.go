@@ -0,0 +1,167 @@
+package zgrab2
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// encodeScanServiceRequest encodes a ScanRequest message.
+func encodeScanServiceRequest(req *scanServiceRequest) []byte {
+	var b []byte
+	for _, m := range req.modules {
+		module := appendProtoString(nil, protoModuleName, m.Module)
+		for name, value := range m.Flags {
+			flag := appendProtoString(nil, protoFlagName, name)
+			flag = appendProtoString(flag, protoFlagValue, value.(string))
+			module = appendProtoBytes(module, protoModuleFlags, flag)
+		}
+		b = appendProtoBytes(b, protoRequestModules, module)
+	}
+	if req.senders > 0 {
+		b = appendProtoVarint(appendProtoTag(b, protoRequestSenders, protoWireVarint), uint64(req.senders))
+	}
+	for _, target := range req.targets {
+		b = appendProtoString(b, protoRequestTargets, target)
+	}
+	if req.config != "" {
+		b = appendProtoString(b, protoRequestConfig, req.config)
+	}
+	if req.debug {
+		b = appendProtoVarint(appendProtoTag(b, protoRequestDebug, protoWireVarint), 1)
+	}
+	return b
+}
+
+func TestDecodeScanServiceRequest(t *testing.T) {
+	message := encodeScanServiceRequest(&scanServiceRequest{
+		modules: []ScanRequestModule{{Module: "http", Flags: map[string]interface{}{"port": "8080"}}},
+		senders: 4,
+		targets: []string{"192.0.2.1", "192.0.2.0/30, , tag"},
+		config:  "web",
+		debug:   true,
+	})
+	// A repeated flag is a list.
+	flag := appendProtoString(appendProtoString(nil, protoFlagName, "header"), protoFlagValue, "A: 1")
+	message = append(message, appendProtoBytes(nil, protoRequestModules, appendProtoBytes(appendProtoBytes(appendProtoString(nil, protoModuleName, "tls"), protoModuleFlags, flag), protoModuleFlags, flag))...)
+	req, err := decodeScanServiceRequest(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.senders != 4 || len(req.targets) != 2 || len(req.modules) != 2 || req.modules[0].Flags["port"] != "8080" || req.config != "web" || !req.debug {
+		t.Errorf("got %+v", req)
+	}
+	if headers, ok := req.modules[1].Flags["header"].([]interface{}); !ok || len(headers) != 2 {
+		t.Errorf("got flags %v", req.modules[1].Flags)
+	}
+	if _, err := decodeScanServiceRequest([]byte{0x1a, 0x05, 'a'}); err == nil {
+		t.Error("truncated message accepted")
+	}
+}
+
+func TestScanService(t *testing.T) {
+	if GetModule("servetest") == nil {
+		if _, err := AddCommand("servetest", "serve test", "serve test", 8080, new(serveTestModule)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := NewScanServer(&ServeCommand{GRPCListen: ":0", Token: "secret", MaxJobs: 1, MaxSenders: 4, MaxTargets: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s.GRPCHandler())
+	defer server.Close()
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	body, requests := io.Pipe()
+	req, err := http.NewRequest("POST", server.URL+scanServiceMethod, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Authorization", "Bearer secret")
+	go func() {
+		requests.Write(grpcMessage(encodeScanServiceRequest(&scanServiceRequest{
+			modules: []ScanRequestModule{{Module: "servetest", Flags: map[string]interface{}{"name": "web"}}},
+			senders: 2,
+			targets: []string{"192.0.2.1"},
+		})))
+		// More targets come later on the same stream.
+		time.Sleep(10 * time.Millisecond)
+		requests.Write(grpcMessage(encodeScanServiceRequest(&scanServiceRequest{targets: []string{"192.0.2.2-192.0.2.3"}})))
+		requests.Close()
+	}()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	ips := make(map[string]bool)
+	for {
+		message, err := readGRPCMessage(resp.Body)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		var grab []byte
+		rangeProtoFields(message, func(field int, _ uint64, data []byte) error {
+			if field == protoResultGrab {
+				grab = data
+			}
+			return nil
+		})
+		var ip string
+		scanners := make(map[string]bool)
+		rangeProtoFields(grab, func(field int, _ uint64, data []byte) error {
+			switch field {
+			case protoGrabIP:
+				ip = string(data)
+			case protoGrabData:
+				return rangeProtoFields(data, func(field int, _ uint64, data []byte) error {
+					if field == protoMapKey {
+						scanners[string(data)] = true
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if !scanners["web"] {
+			t.Errorf("unexpected result for %s: %v", ip, scanners)
+		}
+		ips[ip] = true
+	}
+	if len(ips) != 3 {
+		t.Errorf("got results for %v", ips)
+	}
+	if status := resp.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Errorf("got status %s: %s", status, resp.Trailer.Get("Grpc-Message"))
+	}
+
+	// Without the token.
+	req, _ = http.NewRequest("POST", server.URL+scanServiceMethod, nil)
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	// The status of a trailers-only response is in its headers.
+	if status := resp.Header.Get("Grpc-Status"); status != "16" {
+		t.Errorf("without the token: got status %s", status)
+	}
+}
@@ -0,0 +1,249 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveTestModule is a module of serveTestScanners, with the flags of
+// configTestModule.
+type serveTestModule struct{}
+
+func (m *serveTestModule) NewFlags() interface{} { return new(configTestFlags) }
+func (m *serveTestModule) NewScanner() Scanner {
+	return &serveTestScanner{staticScanner{result: map[string]int{"status_code": 200}}}
+}
+func (m *serveTestModule) Description() string { return "serve test" }
+
+// serveTestScanner is a staticScanner named by its flags.
+type serveTestScanner struct {
+	staticScanner
+}
+
+func (s *serveTestScanner) Init(flags ScanFlags) error {
+	s.name = flags.(*configTestFlags).Name
+	return nil
+}
+
+func TestParseModuleFlags(t *testing.T) {
+	if GetModule("servetest") == nil {
+		if _, err := AddCommand("servetest", "serve test", "serve test", 8080, new(serveTestModule)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := parseModuleFlags("servetest", map[string]interface{}{
+		"use-https": true,
+		"header":    []interface{}{"A: 1", "B: 2"},
+		"timeout":   "3s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := f.(*configTestFlags)
+	if flags.Port != 8080 || flags.Name != "servetest" || !flags.UseHTTPS || len(flags.Headers) != 2 || flags.Timeout != 3*time.Second {
+		t.Errorf("got %+v", flags)
+	}
+	if _, err := parseModuleFlags("servetest", map[string]interface{}{"unknown": 1}); err == nil {
+		t.Error("unknown flag accepted")
+	}
+}
+
+func TestScanServer(t *testing.T) {
+	if GetModule("servetest") == nil {
+		if _, err := AddCommand("servetest", "serve test", "serve test", 8080, new(serveTestModule)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := NewScanServer(&ServeCommand{Listen: ":0", Token: "secret", MaxJobs: 1, MaxSenders: 4, MaxTargets: 8, JobTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	do := func(method string, path string, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp, err := http.Get(server.URL + "/v1/modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %s without the token", resp.Status)
+	}
+
+	resp = do("POST", "/v1/scans?stream=true", `{"module": "servetest", "flags": {"name": "web"}, "targets": ["192.0.2.0/30"], "senders": 2}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream: got %s", resp.Status)
+	}
+	results := 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var grab Grab
+		if err := json.Unmarshal(scanner.Bytes(), &grab); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := grab.Data["web"]; !ok {
+			t.Errorf("no web result in %s", scanner.Text())
+		}
+		results++
+	}
+	resp.Body.Close()
+	if results != 4 {
+		t.Errorf("streamed %d results", results)
+	}
+
+	for body, code := range map[string]int{
+		`{"module": "nope", "targets": ["192.0.2.1"]}`:                     http.StatusBadRequest,
+		`{"module": "servetest", "targets": ["192.0.2.0/24"]}`:             http.StatusBadRequest,
+		`{"module": "servetest", "targets": ["192.0.2.1"], "senders": 10}`: http.StatusBadRequest,
+		`{"module": "servetest"}`:                                          http.StatusBadRequest,
+	} {
+		resp := do("POST", "/v1/scans", body)
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("%s: got %s", body, resp.Status)
+		}
+	}
+
+	resp = do("POST", "/v1/scans", `{"modules": [{"module": "servetest"}], "targets": ["192.0.2.1", "192.0.2.2"]}`)
+	var job ScanJobState
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || job.ID == "" || job.Targets != 2 {
+		t.Fatalf("got %s, %+v", resp.Status, job)
+	}
+	resp = do("GET", "/v1/scans/"+job.ID+"/results?follow=true", "")
+	results = 0
+	scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		results++
+	}
+	resp.Body.Close()
+	if results != 2 {
+		t.Errorf("followed %d results", results)
+	}
+	resp = do("GET", "/v1/scans/"+job.ID, "")
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if job.Status != JobDone || job.Results != 2 || job.Finished == nil {
+		t.Errorf("got %+v", job)
+	}
+	resp = do("GET", "/v1/scans/unknown", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job: got %s", resp.Status)
+	}
+}
+
+func TestScanServerConfigs(t *testing.T) {
+	if GetModule("servetest") == nil {
+		if _, err := AddCommand("servetest", "serve test", "serve test", 8080, new(serveTestModule)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := NewScanServer(&ServeCommand{Listen: ":0", MaxJobs: 1, MaxSenders: 4, MaxTargets: 8, JobTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	do := func(method string, path string, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	status := func(method string, path string, body string) int {
+		resp := do(method, path, body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	web := `{"module": "servetest", "flags": {"name": "web"}, "senders": 2}`
+	if code := status("PUT", "/v1/configs/web", web); code != http.StatusCreated {
+		t.Fatalf("register: got %d", code)
+	}
+	if code := status("PUT", "/v1/configs/web", web); code != http.StatusOK {
+		t.Errorf("replace: got %d", code)
+	}
+	for _, body := range []string{`{"module": "nope"}`, `{}`, `{"module": "servetest", "senders": 10}`, `{"module": "servetest", "modules": [{"module": "servetest"}]}`} {
+		if code := status("PUT", "/v1/configs/bad", body); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", body, code)
+		}
+	}
+	resp := do("GET", "/v1/configs", "")
+	var configs map[string]*ScanConfig
+	json.NewDecoder(resp.Body).Decode(&configs)
+	resp.Body.Close()
+	if cfg := configs["web"]; len(configs) != 1 || cfg == nil || cfg.Module != "" || len(cfg.Modules) != 1 || cfg.Modules[0].Module != "servetest" || cfg.Senders != 2 {
+		t.Errorf("got configurations %+v", configs)
+	}
+
+	resp = do("POST", "/v1/scans?stream=true", `{"config": "web", "targets": ["192.0.2.0/31"]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream: got %s", resp.Status)
+	}
+	results := 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var grab Grab
+		if err := json.Unmarshal(scanner.Bytes(), &grab); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := grab.Data["web"]; !ok {
+			t.Errorf("no web result in %s", scanner.Text())
+		}
+		results++
+	}
+	resp.Body.Close()
+	if results != 2 {
+		t.Errorf("streamed %d results", results)
+	}
+
+	resp = do("POST", "/v1/scans", `{"config": "web", "targets": ["192.0.2.1"]}`)
+	var job ScanJobState
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || job.Config != "web" {
+		t.Errorf("got %s, %+v", resp.Status, job)
+	}
+	for _, body := range []string{
+		`{"config": "web", "module": "servetest", "targets": ["192.0.2.1"]}`,
+		`{"config": "nope", "targets": ["192.0.2.1"]}`,
+	} {
+		if code := status("POST", "/v1/scans", body); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", body, code)
+		}
+	}
+
+	if code := status("DELETE", "/v1/configs/web", ""); code != http.StatusOK {
+		t.Errorf("unregister: got %d", code)
+	}
+	if code := status("GET", "/v1/configs/web", ""); code != http.StatusNotFound {
+		t.Errorf("unregistered: got %d", code)
+	}
+	if code := status("POST", "/v1/scans", `{"config": "web", "targets": ["192.0.2.1"]}`); code != http.StatusBadRequest {
+		t.Errorf("scan of an unregistered configuration: got %d", code)
+	}
+}
@@ -1,9 +1,13 @@
 package zgrab2
 
 import (
+	"context"
 	"io"
 	"net"
+	"os"
+	"reflect"
 	"runtime/debug"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -25,8 +29,135 @@ const (
 	SCAN_APPLICATION_ERROR  = ScanStatus("application-error")   // The application reported an error
 	SCAN_UNKNOWN_ERROR      = ScanStatus("unknown-error")       // Catch-all for unrecognized errors
 	SCAN_SUCCESS_NOTCONTAIN = ScanStatus("success-not-contain") // if success but not contain bytes
+	SCAN_WATCHDOG_TIMEOUT   = ScanStatus("watchdog-timeout")    // The scan exceeded --max-runtime / --watchdog-timeout / --target-timeout and was abandoned
+	SCAN_MEMORY_LIMIT       = ScanStatus("memory-limit")        // The result was dropped to stay under --max-memory
+	SCAN_CANCELED           = ScanStatus("canceled")            // The scan was interrupted before it finished
+	SCAN_BLOCKED            = ScanStatus("blocked")             // The address is excluded by --blocklist-file / --allowlist-file
+	SCAN_DNS_ERROR          = ScanStatus("dns-error")           // The target's name could not be resolved
+	SCAN_CONNECTION_RESET   = ScanStatus("connection-reset")    // The TCP connection was reset by the peer
 )
 
+// ErrorCategory classifies the error of a scan, in the error of its
+// response.
+type ErrorCategory string
+
+const (
+	ERROR_DNS                = ErrorCategory("dns")                // The name could not be resolved
+	ERROR_CONNECTION_REFUSED = ErrorCategory("connection-refused") // The connection was actively rejected
+	ERROR_UNREACHABLE        = ErrorCategory("unreachable")        // There is no route to the host or network
+	ERROR_TIMEOUT            = ErrorCategory("timeout")            // A connection, read, write or the scan timed out
+	ERROR_RESET              = ErrorCategory("reset")              // The connection was reset by the peer
+	ERROR_CONNECTION_CLOSED  = ErrorCategory("connection-closed")  // The peer closed the connection unexpectedly
+	ERROR_TLS_ALERT          = ErrorCategory("tls-alert")          // A TLS alert was received or sent; see tls_alert
+	ERROR_PROTOCOL           = ErrorCategory("protocol-error")     // The data is incompatible with the protocol
+	ERROR_APPLICATION        = ErrorCategory("application-error")  // The application reported an error
+	ERROR_BLOCKED            = ErrorCategory("blocked")            // The address is excluded by --blocklist-file / --allowlist-file
+	ERROR_CANCELED           = ErrorCategory("canceled")           // The scan was interrupted
+	ERROR_MEMORY_LIMIT       = ErrorCategory("memory-limit")       // The result was dropped to stay under --max-memory
+	ERROR_UNKNOWN            = ErrorCategory("unknown")            // Catch-all for unrecognized errors
+)
+
+// ErrorDetail is the error of a scan in its response: the category, for
+// aggregating results, and the message of the error.
+type ErrorDetail struct {
+	Category ErrorCategory `json:"category"`
+
+	// TLSAlert is the code of the TLS alert, with ERROR_TLS_ALERT.
+	TLSAlert *uint8 `json:"tls_alert,omitempty"`
+
+	Message string `json:"message"`
+}
+
+// NewErrorDetail classifies err, the error of a scan that ended with status.
+// The category is detected from the error if possible, and from the status
+// otherwise.
+func NewErrorDetail(status ScanStatus, err error) *ErrorDetail {
+	ret := &ErrorDetail{Category: ERROR_UNKNOWN, Message: err.Error()}
+	if e, ok := err.(*ScanError); ok && e.Err != nil {
+		err = e.Err
+	}
+	if category := errorCategory(err); category != ERROR_UNKNOWN {
+		ret.Category = category
+		if opErr, ok := err.(*net.OpError); ok && category == ERROR_TLS_ALERT {
+			code := uint8(reflect.ValueOf(opErr.Err).Uint())
+			ret.TLSAlert = &code
+		}
+		return ret
+	}
+	switch status {
+	case SCAN_CONNECTION_REFUSED:
+		ret.Category = ERROR_CONNECTION_REFUSED
+	case SCAN_CONNECTION_TIMEOUT, SCAN_IO_TIMEOUT, SCAN_WATCHDOG_TIMEOUT:
+		ret.Category = ERROR_TIMEOUT
+	case SCAN_CONNECTION_CLOSED:
+		ret.Category = ERROR_CONNECTION_CLOSED
+	case SCAN_CONNECTION_RESET:
+		ret.Category = ERROR_RESET
+	case SCAN_DNS_ERROR:
+		ret.Category = ERROR_DNS
+	case SCAN_PROTOCOL_ERROR:
+		ret.Category = ERROR_PROTOCOL
+	case SCAN_APPLICATION_ERROR:
+		ret.Category = ERROR_APPLICATION
+	case SCAN_BLOCKED:
+		ret.Category = ERROR_BLOCKED
+	case SCAN_CANCELED:
+		ret.Category = ERROR_CANCELED
+	case SCAN_MEMORY_LIMIT:
+		ret.Category = ERROR_MEMORY_LIMIT
+	}
+	return ret
+}
+
+// errorCategory returns the category of the network errors it recognizes,
+// and ERROR_UNKNOWN for the others.
+func errorCategory(err error) ErrorCategory {
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		return ERROR_CONNECTION_CLOSED
+	case context.Canceled, errInterrupted:
+		return ERROR_CANCELED
+	case context.DeadlineExceeded, errTargetTimeout:
+		return ERROR_TIMEOUT
+	case errAddressBlocked:
+		return ERROR_BLOCKED
+	case ErrInvalidResponse, ErrUnexpectedResponse:
+		return ERROR_PROTOCOL
+	}
+	switch e := err.(type) {
+	case *net.DNSError:
+		return ERROR_DNS
+	case *net.OpError:
+		// The TLS stack reports alerts as OpErrors wrapping its unexported
+		// alert type, a uint8.
+		if (e.Op == "remote error" || e.Op == "local error") && reflect.ValueOf(e.Err).Kind() == reflect.Uint8 {
+			return ERROR_TLS_ALERT
+		}
+		if category := errorCategory(e.Err); category != ERROR_UNKNOWN || !e.Timeout() {
+			return category
+		}
+		return ERROR_TIMEOUT
+	case *os.SyscallError:
+		return errorCategory(e.Err)
+	case syscall.Errno:
+		switch e {
+		case syscall.ECONNREFUSED:
+			return ERROR_CONNECTION_REFUSED
+		case syscall.ECONNRESET, syscall.EPIPE:
+			return ERROR_RESET
+		case syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+			return ERROR_UNREACHABLE
+		case syscall.ETIMEDOUT:
+			return ERROR_TIMEOUT
+		}
+	case net.Error:
+		if e.Timeout() {
+			return ERROR_TIMEOUT
+		}
+	}
+	return ERROR_UNKNOWN
+}
+
 // ScanError an error that also includes a ScanStatus.
 type ScanError struct {
 	Status ScanStatus
@@ -69,19 +200,29 @@ func TryGetScanStatus(err error) ScanStatus {
 	switch e := err.(type) {
 	case *ScanError:
 		return e.Status
+	case *net.DNSError:
+		return SCAN_DNS_ERROR
 	case *net.OpError:
+		switch errorCategory(e) {
+		case ERROR_BLOCKED:
+			return SCAN_BLOCKED
+		case ERROR_DNS:
+			return SCAN_DNS_ERROR
+		case ERROR_RESET:
+			return SCAN_CONNECTION_RESET
+		case ERROR_CONNECTION_REFUSED:
+			if e.Op == "dial" {
+				return SCAN_CONNECTION_REFUSED
+			}
+		}
 		switch e.Op {
 		case "dial":
-			// TODO: Distinguish connection timeout / connection refused
+			// TODO: Distinguish connection timeout / connection refused on Windows
 			// Windows examples:
 			//	"dial tcp 192.168.30.3:22: connectex: A connection attempt failed because the connected party did not properly respond after a period of time, or established connection failed because connected host has failed to respond."
 			//	"dial tcp 127.0.0.1:22: connectex: No connection could be made because the target machine actively refused it."
 			return SCAN_CONNECTION_TIMEOUT
-		case "read":
-			// TODO: Distinguish connection reset vs timeout
-			return SCAN_IO_TIMEOUT
-		case "write":
-			// TODO: Distinguish connection reset vs timeout
+		case "read", "write":
 			return SCAN_IO_TIMEOUT
 		default:
 			// TODO: Do we need a generic network error?
@@ -0,0 +1,59 @@
+package zgrab2
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// testAlert stands for the TLS stack's unexported alert type.
+type testAlert uint8
+
+func (a testAlert) Error() string {
+	return "handshake failure"
+}
+
+func TestErrorDetail(t *testing.T) {
+	// Nothing listens on the port of a closed listener.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	_, refused := net.Dial("tcp", listener.Addr().String())
+	if refused == nil {
+		t.Fatal("connected to a closed port")
+	}
+
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	dnsError := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "missing.example.com", IsNotFound: true}}
+	for _, test := range []struct {
+		status   ScanStatus
+		err      error
+		category ErrorCategory
+		detected ScanStatus
+	}{
+		{SCAN_CONNECTION_REFUSED, refused, ERROR_CONNECTION_REFUSED, SCAN_CONNECTION_REFUSED},
+		{SCAN_CONNECTION_RESET, reset, ERROR_RESET, SCAN_CONNECTION_RESET},
+		{SCAN_DNS_ERROR, dnsError, ERROR_DNS, SCAN_DNS_ERROR},
+		{SCAN_UNKNOWN_ERROR, &net.OpError{Op: "remote error", Err: testAlert(40)}, ERROR_TLS_ALERT, SCAN_UNKNOWN_ERROR},
+		{SCAN_PROTOCOL_ERROR, NewScanError(SCAN_PROTOCOL_ERROR, errors.New("bad banner")), ERROR_PROTOCOL, SCAN_PROTOCOL_ERROR},
+		{SCAN_WATCHDOG_TIMEOUT, NewScanError(SCAN_WATCHDOG_TIMEOUT, errTargetTimeout), ERROR_TIMEOUT, SCAN_WATCHDOG_TIMEOUT},
+		{SCAN_UNKNOWN_ERROR, errors.New("something"), ERROR_UNKNOWN, SCAN_UNKNOWN_ERROR},
+	} {
+		detail := NewErrorDetail(test.status, test.err)
+		if detail.Category != test.category || detail.Message != test.err.Error() {
+			t.Errorf("%v: got %+v, expected category %s", test.err, detail, test.category)
+		}
+		if status := TryGetScanStatus(test.err); status != test.detected {
+			t.Errorf("%v: status %s, expected %s", test.err, status, test.detected)
+		}
+	}
+
+	detail := NewErrorDetail(SCAN_UNKNOWN_ERROR, &net.OpError{Op: "remote error", Err: testAlert(40)})
+	if detail.TLSAlert == nil || *detail.TLSAlert != 40 {
+		t.Errorf("got TLS alert %v, expected 40", detail.TLSAlert)
+	}
+}
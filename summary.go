@@ -0,0 +1,255 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// maxLatencySamples bounds the scan durations kept for the percentiles of
+// each module, and of the whole scan; past it, a uniform sample is kept.
+const maxLatencySamples = 100000
+
+// topErrorCategories is the number of error categories in the summary,
+// most frequent first.
+const topErrorCategories = 10
+
+// ScanSummary is the report written to --summary-file at the end of a scan,
+// for comparing runs.
+type ScanSummary struct {
+	Start    string  `json:"start"`
+	End      string  `json:"end"`
+	Duration float64 `json:"duration_s"`
+
+	// Targets is the number of targets scanned, and TargetsPerSecond their
+	// rate over the duration.
+	Targets          uint64  `json:"targets"`
+	TargetsPerSecond float64 `json:"targets_per_second"`
+
+	// Scans, Statuses, Latency, BytesRead, BytesWritten and Errors are
+	// those of all the modules together.
+	Scans        uint64                `json:"scans"`
+	Statuses     map[ScanStatus]uint64 `json:"statuses"`
+	Latency      *LatencySummary       `json:"latency_ms,omitempty"`
+	BytesRead    uint64                `json:"bytes_read"`
+	BytesWritten uint64                `json:"bytes_written"`
+	Errors       []ErrorCount          `json:"top_errors"`
+
+	Modules map[string]*ModuleSummary `json:"modules"`
+}
+
+// ModuleSummary is the summary of the scans of one scanner.
+type ModuleSummary struct {
+	Scans uint64 `json:"scans"`
+
+	// SuccessRate is the fraction of the scans with status success or
+	// success-not-contain.
+	SuccessRate float64 `json:"success_rate"`
+
+	Statuses     map[ScanStatus]uint64 `json:"statuses"`
+	Latency      *LatencySummary       `json:"latency_ms,omitempty"`
+	BytesRead    uint64                `json:"bytes_read"`
+	BytesWritten uint64                `json:"bytes_written"`
+	Errors       []ErrorCount          `json:"top_errors"`
+}
+
+// LatencySummary holds percentiles of the durations of the scans, in
+// milliseconds.
+type LatencySummary struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// ErrorCount is the number of failed scans with an error category.
+type ErrorCount struct {
+	Category ErrorCategory `json:"category"`
+	Count    uint64        `json:"count"`
+}
+
+// trafficLog counts the bytes of the connections of a scan.
+type trafficLog struct {
+	read    uint64
+	written uint64
+}
+
+func (l *trafficLog) addRead(n int) {
+	if l != nil && n > 0 {
+		atomic.AddUint64(&l.read, uint64(n))
+	}
+}
+
+func (l *trafficLog) addWritten(n int) {
+	if l != nil && n > 0 {
+		atomic.AddUint64(&l.written, uint64(n))
+	}
+}
+
+// bytes returns the bytes read and written so far.
+func (l *trafficLog) bytes() (uint64, uint64) {
+	if l == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&l.read), atomic.LoadUint64(&l.written)
+}
+
+// latencySample keeps the durations of the scans, or a uniform sample of
+// maxLatencySamples of them (reservoir sampling), and their exact mean and
+// maximum.
+type latencySample struct {
+	samples []float64
+	count   uint64
+	sum     float64
+	max     float64
+	random  *rand.Rand
+}
+
+func (s *latencySample) add(ms float64) {
+	s.count++
+	s.sum += ms
+	s.max = math.Max(s.max, ms)
+	if len(s.samples) < maxLatencySamples {
+		s.samples = append(s.samples, ms)
+		return
+	}
+	if s.random == nil {
+		s.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if i := s.random.Int63n(int64(s.count)); i < maxLatencySamples {
+		s.samples[i] = ms
+	}
+}
+
+// summary returns the percentiles of the sample, or nil if it is empty.
+func (s *latencySample) summary() *LatencySummary {
+	if s.count == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), s.samples...)
+	sort.Float64s(sorted)
+	percentile := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return &LatencySummary{
+		Mean: s.sum / float64(s.count),
+		P50:  percentile(0.50),
+		P90:  percentile(0.90),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+		Max:  s.max,
+	}
+}
+
+// scanStats accumulates the scans of a module, or of all of them.
+type scanStats struct {
+	scans     uint64
+	successes uint64
+	statuses  map[ScanStatus]uint64
+	errors    map[ErrorCategory]uint64
+	latency   latencySample
+	read      uint64
+	written   uint64
+}
+
+func newScanStats() *scanStats {
+	return &scanStats{
+		statuses: make(map[ScanStatus]uint64),
+		errors:   make(map[ErrorCategory]uint64),
+	}
+}
+
+func (s *scanStats) add(scan *moduleStatus) {
+	s.scans++
+	s.statuses[scan.status]++
+	if scan.status == SCAN_SUCCESS || scan.status == SCAN_SUCCESS_NOTCONTAIN {
+		s.successes++
+	}
+	if scan.category != "" {
+		s.errors[scan.category]++
+	}
+	s.latency.add(scan.duration)
+	s.read += scan.read
+	s.written += scan.written
+}
+
+// topErrors returns the most frequent error categories, with their counts.
+func (s *scanStats) topErrors() []ErrorCount {
+	ret := make([]ErrorCount, 0, len(s.errors))
+	for category, count := range s.errors {
+		ret = append(ret, ErrorCount{Category: category, Count: count})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Category < ret[j].Category
+	})
+	if len(ret) > topErrorCategories {
+		ret = ret[:topErrorCategories]
+	}
+	return ret
+}
+
+func (s *scanStats) moduleSummary() *ModuleSummary {
+	ret := &ModuleSummary{
+		Scans:        s.scans,
+		Statuses:     s.statuses,
+		Latency:      s.latency.summary(),
+		BytesRead:    s.read,
+		BytesWritten: s.written,
+		Errors:       s.topErrors(),
+	}
+	if s.scans > 0 {
+		ret.SuccessRate = float64(s.successes) / float64(s.scans)
+	}
+	return ret
+}
+
+// Summary returns the summary of the scans reported to the monitor, which
+// ran from start to end. It must be called after the monitor has stopped.
+func (m *Monitor) Summary(start time.Time, end time.Time) *ScanSummary {
+	duration := end.Sub(start).Seconds()
+	ret := &ScanSummary{
+		Start:        start.Format(time.RFC3339),
+		End:          end.Format(time.RFC3339),
+		Duration:     duration,
+		Targets:      m.targets,
+		Scans:        m.total.scans,
+		Statuses:     m.total.statuses,
+		Latency:      m.total.latency.summary(),
+		BytesRead:    m.total.read,
+		BytesWritten: m.total.written,
+		Errors:       m.total.topErrors(),
+		Modules:      make(map[string]*ModuleSummary, len(m.stats)),
+	}
+	if duration > 0 {
+		ret.TargetsPerSecond = float64(m.targets) / duration
+	}
+	for name, stats := range m.stats {
+		ret.Modules[name] = stats.moduleSummary()
+	}
+	return ret
+}
+
+// WriteSummaryFile writes summary as JSON to --summary-file, if it is set.
+func WriteSummaryFile(summary *ScanSummary) error {
+	if config.SummaryFile == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(config.SummaryFile, append(b, '\n'), 0666)
+}
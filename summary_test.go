@@ -0,0 +1,89 @@
+package zgrab2
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitorSummary(t *testing.T) {
+	var wg sync.WaitGroup
+	monitor := MakeMonitor(16, &wg)
+	for i := 1; i <= 100; i++ {
+		res := &ScanResponse{Status: SCAN_SUCCESS, Timing: &Timing{Duration: float64(i)}}
+		monitor.report("http", statusSuccess, res, &trafficLog{read: 100, written: 10})
+		monitor.reportTarget()
+	}
+	for _, category := range []ErrorCategory{ERROR_TIMEOUT, ERROR_TIMEOUT, ERROR_CONNECTION_REFUSED} {
+		res := &ScanResponse{Status: SCAN_IO_TIMEOUT, Error: &ErrorDetail{Category: category}, Timing: &Timing{Duration: 1000}}
+		monitor.report("ssh", statusFailure, res, nil)
+	}
+	monitor.report("ssh", statusSuccess, &ScanResponse{Status: SCAN_SUCCESS}, nil)
+	monitor.Stop()
+	wg.Wait()
+
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	summary := monitor.Summary(start, start.Add(10*time.Second))
+	if summary.Targets != 100 || summary.TargetsPerSecond != 10 || summary.Scans != 104 {
+		t.Errorf("got %d targets, %f/s, %d scans", summary.Targets, summary.TargetsPerSecond, summary.Scans)
+	}
+	if summary.Statuses[SCAN_SUCCESS] != 101 || summary.Statuses[SCAN_IO_TIMEOUT] != 3 {
+		t.Errorf("got statuses %v", summary.Statuses)
+	}
+	if summary.BytesRead != 10000 || summary.BytesWritten != 1000 {
+		t.Errorf("got %d bytes read, %d written", summary.BytesRead, summary.BytesWritten)
+	}
+	http := summary.Modules["http"]
+	if http == nil || http.SuccessRate != 1 || http.Latency.P50 != 50 || http.Latency.P99 != 99 || http.Latency.Max != 100 || http.Latency.Mean != 50.5 {
+		t.Errorf("got http summary %+v, latency %+v", http, http.Latency)
+	}
+	ssh := summary.Modules["ssh"]
+	if ssh == nil || ssh.SuccessRate != 0.25 || len(ssh.Errors) != 2 || ssh.Errors[0] != (ErrorCount{ERROR_TIMEOUT, 2}) {
+		t.Errorf("got ssh summary %+v", ssh)
+	}
+	if monitor.GetStatuses()["ssh"].Failures != 3 {
+		t.Errorf("got ssh statuses %+v", monitor.GetStatuses()["ssh"])
+	}
+}
+
+func TestLatencySample(t *testing.T) {
+	var sample latencySample
+	if sample.summary() != nil {
+		t.Error("expected no summary of an empty sample")
+	}
+	for i := 0; i < 2*maxLatencySamples; i++ {
+		sample.add(float64(i % 100))
+	}
+	if len(sample.samples) != maxLatencySamples {
+		t.Fatalf("kept %d samples", len(sample.samples))
+	}
+	summary := sample.summary()
+	if summary.Mean != 49.5 || summary.Max != 99 || summary.P50 < 45 || summary.P50 > 55 {
+		t.Errorf("got %+v", summary)
+	}
+}
+
+func TestTrafficLog(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	traffic := new(trafficLog)
+	conn := NewTimeoutConnection(nil, client, time.Second, 0, 0, 0)
+	conn.traffic = traffic
+	go func() {
+		buf := make([]byte, 5)
+		server.Read(buf)
+		server.Write([]byte("pong!!"))
+	}()
+	if _, err := conn.Write([]byte("ping!")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if read, written := traffic.bytes(); read != 6 || written != 5 {
+		t.Errorf("got %d bytes read, %d written", read, written)
+	}
+}
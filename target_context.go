@@ -0,0 +1,133 @@
+package zgrab2
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/zmap/zcrypto/x509"
+)
+
+// Well-known TargetContext keys.
+const (
+	// ContextHostnames are DNS names of the target, e.g. from the subject
+	// and SANs of its TLS certificate.
+	ContextHostnames = "hostnames"
+
+	// ContextALPN is the application protocol negotiated in a TLS handshake.
+	ContextALPN = "alpn"
+
+	// ContextHTTPServer is the Server header of an HTTP response.
+	ContextHTTPServer = "http.server"
+
+	// ContextRealms are the authentication realms announced by the target,
+	// e.g. in WWW-Authenticate headers.
+	ContextRealms = "realms"
+
+	// ContextTriggers are tags added by scanners of the target, e.g. the
+	// protocol found by the detect module. Later scanners whose trigger is
+	// one of them run on the target as if it had been tagged with it.
+	ContextTriggers = "triggers"
+)
+
+// TargetContext is a key-value store shared by the scanners run on a single
+// target: earlier scanners record what they learned, later ones can read it
+// to adapt their probes. Values are lists of strings. All methods are safe to
+// call on a nil TargetContext, which is empty and discards writes.
+type TargetContext struct {
+	mutex  sync.Mutex
+	values map[string][]string
+}
+
+// NewTargetContext returns an empty TargetContext.
+func NewTargetContext() *TargetContext {
+	return &TargetContext{values: make(map[string][]string)}
+}
+
+// Set replaces the values of key.
+func (c *TargetContext) Set(key string, values ...string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[key] = append([]string(nil), values...)
+}
+
+// Add appends the values not yet present to key.
+func (c *TargetContext) Add(key string, values ...string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, value := range values {
+		found := false
+		for _, existing := range c.values[key] {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.values[key] = append(c.values[key], value)
+		}
+	}
+}
+
+// Get returns a copy of the values of key.
+func (c *TargetContext) Get(key string) []string {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string(nil), c.values[key]...)
+}
+
+// First returns the first value of key, or the empty string.
+func (c *TargetContext) First(key string) string {
+	if values := c.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Triggered returns true if trigger is one of the ContextTriggers values.
+func (c *TargetContext) Triggered(trigger string) bool {
+	if trigger == "" {
+		return false
+	}
+	for _, value := range c.Get(ContextTriggers) {
+		if value == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordTLS adds the DNS names of the connection's leaf certificate (subject
+// common name and SANs) and the negotiated ALPN protocol to the context.
+func (c *TargetContext) RecordTLS(conn *TLSConnection) {
+	if c == nil || conn == nil {
+		return
+	}
+	if certs := conn.GetLog().ServerCertificates(); certs != nil {
+		c.RecordCertificate(certs.Certificate.Parsed)
+	}
+	if protocol := conn.ConnectionState().NegotiatedProtocol; protocol != "" {
+		c.Set(ContextALPN, protocol)
+	}
+}
+
+// RecordCertificate adds the DNS names of a leaf certificate (subject common
+// name and SANs) to the context.
+func (c *TargetContext) RecordCertificate(leaf *x509.Certificate) {
+	if c == nil || leaf == nil {
+		return
+	}
+	var names []string
+	if cn := leaf.Subject.CommonName; strings.Contains(cn, ".") && !strings.ContainsAny(cn, " /") {
+		names = append(names, cn)
+	}
+	c.Add(ContextHostnames, append(names, leaf.DNSNames...)...)
+}
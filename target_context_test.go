@@ -0,0 +1,35 @@
+package zgrab2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTargetContext(t *testing.T) {
+	ctx := NewTargetContext()
+	ctx.Add(ContextHostnames, "a.example.com", "b.example.com")
+	ctx.Add(ContextHostnames, "b.example.com", "c.example.com")
+	if actual := ctx.Get(ContextHostnames); !reflect.DeepEqual(actual, []string{"a.example.com", "b.example.com", "c.example.com"}) {
+		t.Errorf("got %v", actual)
+	}
+	ctx.Set(ContextALPN, "h2")
+	ctx.Set(ContextALPN, "http/1.1")
+	if actual := ctx.First(ContextALPN); actual != "http/1.1" {
+		t.Errorf("got %q", actual)
+	}
+	if actual := ctx.First("missing"); actual != "" {
+		t.Errorf("got %q for a missing key", actual)
+	}
+
+	ctx.Add(ContextTriggers, "http")
+	if !ctx.Triggered("http") || ctx.Triggered("ssh") || ctx.Triggered("") {
+		t.Errorf("unexpected triggers %v", ctx.Get(ContextTriggers))
+	}
+
+	var empty *TargetContext
+	empty.Set(ContextALPN, "h2")
+	empty.Add(ContextHostnames, "a.example.com")
+	if empty.Get(ContextALPN) != nil || empty.First(ContextHostnames) != "" {
+		t.Error("nil context is not empty")
+	}
+}
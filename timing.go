@@ -0,0 +1,101 @@
+package zgrab2
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Precisions of the start and end times of Timing, as --timing-precision.
+const (
+	TimingSeconds      = "s"
+	TimingMilliseconds = "ms"
+	TimingMicroseconds = "us"
+	TimingNanoseconds  = "ns"
+)
+
+// timingLayouts are the time layouts of the precisions.
+var timingLayouts = map[string]string{
+	TimingSeconds:      time.RFC3339,
+	TimingMilliseconds: "2006-01-02T15:04:05.000Z07:00",
+	TimingMicroseconds: "2006-01-02T15:04:05.000000Z07:00",
+	TimingNanoseconds:  "2006-01-02T15:04:05.000000000Z07:00",
+}
+
+// timingLayout returns the time layout of precision, which defaults to
+// milliseconds.
+func timingLayout(precision string) (string, error) {
+	if precision == "" {
+		precision = TimingMilliseconds
+	}
+	layout, ok := timingLayouts[precision]
+	if !ok {
+		return "", fmt.Errorf("unknown timing precision %q", precision)
+	}
+	return layout, nil
+}
+
+// Timing is the timing of a scan, in every response. The durations are in
+// milliseconds.
+type Timing struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	Duration float64 `json:"duration_ms"`
+
+	// Dial is the time spent connecting, over all the connections of the
+	// scan dialed through the ScanTarget.
+	Dial float64 `json:"dial_ms,omitempty"`
+
+	// TLSHandshake is the time spent in TLS handshakes, over all the
+	// connections of the scan.
+	TLSHandshake float64 `json:"tls_handshake_ms,omitempty"`
+}
+
+// milliseconds returns d in milliseconds, to the microsecond.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Round(time.Microsecond)) / float64(time.Millisecond)
+}
+
+// timingLog accumulates the dial and handshake times of the connections of
+// a scan.
+type timingLog struct {
+	mutex        sync.Mutex
+	dial         time.Duration
+	tlsHandshake time.Duration
+}
+
+func (l *timingLog) addDial(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.dial += d
+}
+
+func (l *timingLog) addTLSHandshake(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.tlsHandshake += d
+}
+
+// timing returns the timing of a scan that ran from start to end, with its
+// start and end times in layout.
+func (l *timingLog) timing(start time.Time, end time.Time, layout string) *Timing {
+	ret := &Timing{
+		Start:    start.Format(layout),
+		End:      end.Format(layout),
+		Duration: milliseconds(end.Sub(start)),
+	}
+	if l != nil {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		ret.Dial = milliseconds(l.dial)
+		ret.TLSHandshake = milliseconds(l.tlsHandshake)
+	}
+	return ret
+}
@@ -0,0 +1,73 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// dialScanner connects to the target after a delay.
+type dialScanner struct {
+	staticScanner
+	delay time.Duration
+}
+
+func (s *dialScanner) Scan(t ScanTarget) (ScanStatus, interface{}, error) {
+	time.Sleep(s.delay)
+	conn, err := t.Open(&BaseFlags{Timeout: time.Second})
+	if err != nil {
+		return TryGetScanStatus(err), nil, err
+	}
+	conn.Close()
+	return SCAN_SUCCESS, nil, nil
+}
+
+func TestTiming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	layout, err := timingLayout(TimingMicroseconds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Runner{timingLayout: layout}
+	port := uint(listener.Addr().(*net.TCPAddr).Port)
+	_, res := r.runScanner(context.Background(), "dial", &dialScanner{staticScanner{name: "dial"}, 20 * time.Millisecond}, ScanTarget{IP: net.ParseIP("127.0.0.1"), Port: &port})
+	if res.Status != SCAN_SUCCESS || res.Timing == nil {
+		t.Fatalf("got %+v", res)
+	}
+	start, err := time.Parse(layout, res.Timing.Start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := time.Parse(layout, res.Timing.End)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`\.[0-9]{6}(Z|[+-])`).MatchString(res.Timing.Start) || start.Nanosecond()%1000 != 0 {
+		t.Errorf("start %s is not to the microsecond", res.Timing.Start)
+	}
+	if elapsed := end.Sub(start); res.Timing.Duration < 20 || res.Timing.Duration > milliseconds(elapsed)+0.002 {
+		t.Errorf("duration %vms, from %s to %s", res.Timing.Duration, res.Timing.Start, res.Timing.End)
+	}
+	if res.Timing.Dial <= 0 || res.Timing.Dial > res.Timing.Duration || res.Timing.TLSHandshake != 0 {
+		t.Errorf("got %+v", res.Timing)
+	}
+
+	if _, err := timingLayout("ps"); err == nil {
+		t.Error("expected an error for an unknown precision")
+	}
+}
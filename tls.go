@@ -44,6 +44,8 @@ type TLSFlags struct {
 	Certificates string `long:"certificates" description:"Set of certificates to present to the server"`
 	// TODO: re-evaluate this, or at least specify the file format
 	CertificateMap string `long:"certificate-map" description:"A file mapping server names to certificates"`
+	ClientCert     string `long:"client-cert" description:"PEM file containing a client certificate chain to present if the server requests one"`
+	ClientKey      string `long:"client-key" description:"PEM file containing the private key for --client-cert"`
 	// TODO: directory? glob?
 	RootCAs string `long:"root-cas" description:"Set of certificates to use when verifying server certificates"`
 	// TODO: format?
@@ -64,6 +66,11 @@ type TLSFlags struct {
 	ClientRandom string `long:"client-random" description:"Set an explicit Client Random (base64 encoded)"`
 	// TODO: format?
 	ClientHello string `long:"client-hello" description:"Set an explicit ClientHello (base64 encoded)"`
+
+	CertOutputDir string `long:"cert-output-dir" description:"Write each unique server certificate chain to this directory as DER/PEM files named by SHA-256, and output only the fingerprints"`
+
+	// certExports records the chains written to CertOutputDir.
+	certExports *certificateExports
 }
 
 func getCSV(arg string) []string {
@@ -126,6 +133,16 @@ func (t *TLSFlags) GetTLSConfigForTarget(target *ScanTarget) (*tls.Config, error
 		// TODO FIXME: Implement
 		log.Fatalf("--certificate-map not implemented")
 	}
+	if t.ClientCert != "" || t.ClientKey != "" {
+		if t.ClientCert == "" || t.ClientKey == "" {
+			return nil, fmt.Errorf("--client-cert and --client-key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading client certificate '%s': %s", t.ClientCert, err)
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
 	if t.RootCAs != "" {
 		var fd *os.File
 		if fd, err = os.Open(t.RootCAs); err != nil {
@@ -261,6 +278,12 @@ type TLSConnection struct {
 	tls.Conn
 	flags *TLSFlags
 	log   *TLSLog
+
+	serverVersion      uint16
+	certificateRequest *CertificateRequest
+
+	// timing is that of the scan of the target, if any.
+	timing *timingLog
 }
 
 type TLSLog struct {
@@ -268,6 +291,13 @@ type TLSLog struct {
 	HandshakeLog *tls.ServerHandshake `json:"handshake_log"`
 	// This will be nil if heartbleed is not checked because of client configuration flags
 	HeartbleedLog *tls.Heartbleed `json:"heartbleed_log,omitempty"`
+	// CertificateRequest is present if the server asked for a client certificate in a TLS 1.0-1.2
+	// handshake (the only versions the zcrypto client negotiates)
+	CertificateRequest *CertificateRequest `json:"certificate_request,omitempty"`
+	// CertificateChain replaces HandshakeLog.ServerCertificates if --cert-output-dir is set
+	CertificateChain *CertificateChain `json:"certificate_chain,omitempty"`
+
+	serverCertificates *tls.Certificates
 }
 
 func (z *TLSConnection) GetLog() *TLSLog {
@@ -279,12 +309,16 @@ func (z *TLSConnection) GetLog() *TLSLog {
 }
 
 func (z *TLSConnection) Handshake() error {
+	start := time.Now()
+	defer func() { z.timing.addTLSHandshake(time.Since(start)) }()
 	log := z.GetLog()
 	if z.flags.Heartbleed {
 		buf := make([]byte, 256)
 		defer func() {
 			log.HandshakeLog = z.Conn.GetHandshakeLog()
 			log.HeartbleedLog = z.Conn.GetHeartbleedLog()
+			log.CertificateRequest = z.certificateRequest
+			z.exportCertificates()
 		}()
 		// TODO - CheckHeartbleed does not bubble errors from Handshake
 		_, err := z.CheckHeartbleed(buf)
@@ -296,11 +330,25 @@ func (z *TLSConnection) Handshake() error {
 		defer func() {
 			log.HandshakeLog = z.Conn.GetHandshakeLog()
 			log.HeartbleedLog = nil
+			log.CertificateRequest = z.certificateRequest
+			z.exportCertificates()
 		}()
 		return z.Conn.Handshake()
 	}
 }
 
+// exportCertificates moves the server certificates out of the handshake log
+// and into --cert-output-dir, if set.
+func (z *TLSConnection) exportCertificates() {
+	log := z.GetLog()
+	if z.flags.CertOutputDir == "" || log.HandshakeLog == nil || log.HandshakeLog.ServerCertificates == nil {
+		return
+	}
+	log.serverCertificates = log.HandshakeLog.ServerCertificates
+	log.CertificateChain = exportCertificates(z.flags.CertOutputDir, log.serverCertificates, z.flags.certificateExports())
+	log.HandshakeLog.ServerCertificates = nil
+}
+
 // Close the underlying connection.
 func (conn *TLSConnection) Close() error {
 	return conn.Conn.Close()
@@ -326,14 +374,34 @@ func (t *TLSFlags) GetTLSConnectionForTarget(conn net.Conn, target *ScanTarget)
 	if err != nil {
 		return nil, fmt.Errorf("Error getting TLSConfig for options: %s", err)
 	}
-	return t.GetWrappedConnection(conn, cfg), nil
+	ret := t.GetWrappedConnection(conn, cfg)
+	if target != nil {
+		ret.timing = target.timing
+	}
+	return ret, nil
 }
 
 func (t *TLSFlags) GetWrappedConnection(conn net.Conn, cfg *tls.Config) *TLSConnection {
-	tlsClient := tls.Client(conn, cfg)
-	wrappedClient := TLSConnection{
-		Conn:  *tlsClient,
+	wrappedClient := &TLSConnection{
 		flags: t,
 	}
-	return &wrappedClient
+	sniffer := &handshakeSniffer{
+		Conn:      conn,
+		onMessage: wrappedClient.onHandshakeMessage,
+	}
+	wrappedClient.Conn = *tls.Client(sniffer, cfg)
+	return wrappedClient
+}
+
+// onHandshakeMessage records the server handshake messages that zcrypto does
+// not include in its handshake log.
+func (z *TLSConnection) onHandshakeMessage(msgType uint8, body []byte) {
+	switch msgType {
+	case tlsHandshakeTypeServerHello:
+		if len(body) >= 2 {
+			z.serverVersion = uint16(body[0])<<8 | uint16(body[1])
+		}
+	case tlsHandshakeTypeCertificateRequest:
+		z.certificateRequest = parseCertificateRequest(body, z.serverVersion >= tls.VersionTLS12)
+	}
 }
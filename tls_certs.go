@@ -0,0 +1,152 @@
+package zgrab2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zcrypto/tls"
+	"github.com/zmap/zcrypto/x509"
+)
+
+// CertificateChain replaces the server certificates in the handshake log when
+// --cert-output-dir is set. The certificates themselves are written to the
+// output directory as <sha256>.der (one per certificate) and <sha256>.pem
+// (the whole chain, named by ChainSHA256).
+type CertificateChain struct {
+	// ChainSHA256 is the SHA-256 of the concatenated DER certificates, leaf
+	// first.
+	ChainSHA256 string `json:"chain_sha256"`
+
+	// Fingerprints are the SHA-256 fingerprints of the certificates in the
+	// order the server sent them, leaf first.
+	Fingerprints []string `json:"fingerprints"`
+
+	// Validation is the validation result from the original handshake log.
+	Validation *x509.Validation `json:"validation,omitempty"`
+}
+
+// maxExportedChains caps the chains remembered by certificateExports. Past
+// it, the record is reset, and the chains written before are only skipped
+// because their files already exist.
+const maxExportedChains = 100000
+
+// certificateExports records the chains that have been written to the
+// --cert-output-dir of a module, so that each unique chain is written once.
+type certificateExports struct {
+	mu     sync.Mutex
+	chains map[string]struct{}
+}
+
+// certExportsMutex guards the creation of TLSFlags.certExports.
+var certExportsMutex sync.Mutex
+
+// certificateExports returns the record of the chains written to
+// CertOutputDir, which is created on first use.
+func (t *TLSFlags) certificateExports() *certificateExports {
+	certExportsMutex.Lock()
+	defer certExportsMutex.Unlock()
+	if t.certExports == nil {
+		t.certExports = new(certificateExports)
+	}
+	return t.certExports
+}
+
+// exported returns true if the chain has already been written.
+func (e *certificateExports) exported(chain string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.chains[chain]
+	return ok
+}
+
+// add records that the chain has been written.
+func (e *certificateExports) add(chain string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.chains == nil || len(e.chains) >= maxExportedChains {
+		e.chains = make(map[string]struct{})
+	}
+	e.chains[chain] = struct{}{}
+}
+
+// certificateFingerprint returns the hex SHA-256 of a DER certificate.
+func certificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// exportCertificates writes the chain to dir (if it is not in exports) and
+// returns its CertificateChain entry. The chain is added to exports once all
+// its files are written.
+func exportCertificates(dir string, certs *tls.Certificates, exports *certificateExports) *CertificateChain {
+	ders := make([][]byte, 0, len(certs.Chain)+1)
+	if len(certs.Certificate.Raw) > 0 {
+		ders = append(ders, certs.Certificate.Raw)
+	}
+	for _, cert := range certs.Chain {
+		if len(cert.Raw) > 0 {
+			ders = append(ders, cert.Raw)
+		}
+	}
+	ret := &CertificateChain{
+		Fingerprints: make([]string, len(ders)),
+		Validation:   certs.Validation,
+	}
+	chainHash := sha256.New()
+	var chainPEM []byte
+	for i, der := range ders {
+		ret.Fingerprints[i] = certificateFingerprint(der)
+		chainHash.Write(der)
+		chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	ret.ChainSHA256 = hex.EncodeToString(chainHash.Sum(nil))
+	if exports.exported(ret.ChainSHA256) {
+		return ret
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Errorf("Could not create certificate output directory %s: %v", dir, err)
+		return ret
+	}
+	written := true
+	for i, der := range ders {
+		written = writeCertificateFile(filepath.Join(dir, ret.Fingerprints[i]+".der"), der) && written
+	}
+	written = writeCertificateFile(filepath.Join(dir, ret.ChainSHA256+".pem"), chainPEM) && written
+	if written {
+		exports.add(ret.ChainSHA256)
+	}
+	return ret
+}
+
+// writeCertificateFile writes data to path unless the file already exists
+// (e.g. from an earlier scan into the same directory). It returns false if
+// the file could not be written.
+func writeCertificateFile(path string, data []byte) bool {
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		log.Errorf("Could not write certificate file %s: %v", path, err)
+		return false
+	}
+	return true
+}
+
+// ServerCertificates returns the certificates sent by the server. Unlike
+// HandshakeLog.ServerCertificates, this is still set when the certificates
+// were exported with --cert-output-dir.
+func (log *TLSLog) ServerCertificates() *tls.Certificates {
+	if log.serverCertificates != nil {
+		return log.serverCertificates
+	}
+	if log.HandshakeLog == nil {
+		return nil
+	}
+	return log.HandshakeLog.ServerCertificates
+}
@@ -0,0 +1,104 @@
+package zgrab2
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/zmap/zcrypto/tls"
+)
+
+func TestExportCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	leaf, issuer := []byte("leaf certificate"), []byte("issuer certificate")
+	certs := &tls.Certificates{
+		Certificate: tls.SimpleCertificate{Raw: leaf},
+		Chain:       []tls.SimpleCertificate{{Raw: issuer}},
+	}
+	exports := new(certificateExports)
+	chain := exportCertificates(dir, certs, exports)
+	if len(chain.Fingerprints) != 2 || chain.Fingerprints[0] != certificateFingerprint(leaf) || chain.Fingerprints[1] != certificateFingerprint(issuer) {
+		t.Fatalf("wrong fingerprints: %v", chain.Fingerprints)
+	}
+	for i, der := range [][]byte{leaf, issuer} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, chain.Fingerprints[i]+".der"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(der) {
+			t.Errorf("wrong contents for certificate %d: %q", i, data)
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, chain.ChainSHA256+".pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks []*pem.Block
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		blocks = append(blocks, block)
+	}
+	if len(blocks) != 2 || string(blocks[0].Bytes) != string(leaf) || string(blocks[1].Bytes) != string(issuer) {
+		t.Errorf("wrong PEM chain: %q", data)
+	}
+
+	// A chain that was already exported is not written again.
+	os.Remove(filepath.Join(dir, chain.ChainSHA256+".pem"))
+	if again := exportCertificates(dir, certs, exports); again.ChainSHA256 != chain.ChainSHA256 {
+		t.Errorf("chain hash changed: %s != %s", again.ChainSHA256, chain.ChainSHA256)
+	}
+	if _, err := os.Stat(filepath.Join(dir, chain.ChainSHA256+".pem")); !os.IsNotExist(err) {
+		t.Error("chain was exported twice")
+	}
+}
+
+func TestExportCertificatesFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The output directory cannot be created under a file.
+	out := filepath.Join(dir, "certs")
+	if err := ioutil.WriteFile(out, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	certs := &tls.Certificates{Certificate: tls.SimpleCertificate{Raw: []byte("leaf certificate")}}
+	exports := new(certificateExports)
+	chain := exportCertificates(out, certs, exports)
+	if exports.exported(chain.ChainSHA256) {
+		t.Fatal("chain recorded without being written")
+	}
+
+	// The chain is written by the next scan that can.
+	os.Remove(out)
+	exportCertificates(out, certs, exports)
+	if _, err := os.Stat(filepath.Join(out, chain.ChainSHA256+".pem")); err != nil {
+		t.Fatal(err)
+	}
+	if !exports.exported(chain.ChainSHA256) {
+		t.Error("chain not recorded")
+	}
+}
+
+func TestCertificateExportsLimit(t *testing.T) {
+	exports := new(certificateExports)
+	for i := 0; i < maxExportedChains; i++ {
+		exports.add(strconv.Itoa(i))
+	}
+	if !exports.exported("0") {
+		t.Fatal("chain not recorded")
+	}
+	exports.add("last")
+	if exports.exported("0") || !exports.exported("last") || len(exports.chains) != 1 {
+		t.Errorf("the record was not reset at the limit: %d chains", len(exports.chains))
+	}
+}
@@ -0,0 +1,165 @@
+package zgrab2
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+
+	"github.com/zmap/zcrypto/tls"
+)
+
+// TLS record and handshake message types that are inspected on the wire.
+const (
+	tlsRecordTypeChangeCipherSpec = 20
+	tlsRecordTypeHandshake        = 22
+
+	tlsHandshakeTypeServerHello        = 2
+	tlsHandshakeTypeCertificateRequest = 13
+)
+
+// CertificateRequest describes the contents of a TLS CertificateRequest
+// message, which the server sends when it asks the client to authenticate.
+// It is only recorded in TLS 1.0-1.2 handshakes: the zcrypto client does not
+// implement TLS 1.3, whose CertificateRequest is encrypted.
+type CertificateRequest struct {
+	// CertificateTypes are the ClientCertificateType values the server accepts.
+	CertificateTypes []uint8 `json:"certificate_types,omitempty"`
+
+	// SignatureAndHashes are the signature algorithms the server accepts
+	// (TLS 1.2 only).
+	SignatureAndHashes []tls.SignatureAndHash `json:"signature_and_hashes,omitempty"`
+
+	// CertificateAuthorities are the distinguished names of the acceptable
+	// certificate authorities, in RFC 2253 string form.
+	CertificateAuthorities []string `json:"certificate_authorities,omitempty"`
+}
+
+// handshakeSniffer wraps the raw connection underneath a TLS client and hands
+// every plaintext handshake message the server sends to onMessage. It stops
+// looking once the server sends a ChangeCipherSpec, since everything after
+// that is encrypted.
+type handshakeSniffer struct {
+	net.Conn
+	onMessage func(msgType uint8, body []byte)
+	records   []byte
+	messages  []byte
+	done      bool
+}
+
+// Read passes data through unchanged, parsing a copy of it.
+func (s *handshakeSniffer) Read(b []byte) (int, error) {
+	n, err := s.Conn.Read(b)
+	if n > 0 && !s.done {
+		s.records = append(s.records, b[:n]...)
+		s.parseRecords()
+	}
+	return n, err
+}
+
+func (s *handshakeSniffer) parseRecords() {
+	for !s.done && len(s.records) >= 5 {
+		length := int(binary.BigEndian.Uint16(s.records[3:5]))
+		if len(s.records) < 5+length {
+			return
+		}
+		recordType := s.records[0]
+		fragment := s.records[5 : 5+length]
+		switch recordType {
+		case tlsRecordTypeHandshake:
+			s.messages = append(s.messages, fragment...)
+			s.parseMessages()
+		case tlsRecordTypeChangeCipherSpec:
+			s.stop()
+			return
+		}
+		s.records = s.records[5+length:]
+	}
+}
+
+func (s *handshakeSniffer) parseMessages() {
+	for len(s.messages) >= 4 {
+		length := int(s.messages[1])<<16 | int(s.messages[2])<<8 | int(s.messages[3])
+		if len(s.messages) < 4+length {
+			return
+		}
+		s.onMessage(s.messages[0], s.messages[4:4+length])
+		s.messages = s.messages[4+length:]
+	}
+}
+
+func (s *handshakeSniffer) stop() {
+	s.done = true
+	s.records = nil
+	s.messages = nil
+}
+
+// parseCertificateRequest parses the body of a TLS 1.0-1.2 CertificateRequest
+// message. Returns nil if the message is malformed.
+func parseCertificateRequest(body []byte, hasSignatureAndHashes bool) *CertificateRequest {
+	ret := new(CertificateRequest)
+	if len(body) < 1 {
+		return nil
+	}
+	numTypes := int(body[0])
+	body = body[1:]
+	if len(body) < numTypes {
+		return nil
+	}
+	ret.CertificateTypes = append([]uint8{}, body[:numTypes]...)
+	body = body[numTypes:]
+
+	if hasSignatureAndHashes {
+		if len(body) < 2 {
+			return nil
+		}
+		sigLen := int(binary.BigEndian.Uint16(body))
+		body = body[2:]
+		if len(body) < sigLen || sigLen%2 != 0 {
+			return nil
+		}
+		for i := 0; i < sigLen; i += 2 {
+			ret.SignatureAndHashes = append(ret.SignatureAndHashes, tls.SignatureAndHash{
+				Hash:      body[i],
+				Signature: body[i+1],
+			})
+		}
+		body = body[sigLen:]
+	}
+
+	if len(body) < 2 {
+		return nil
+	}
+	casLen := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	if len(body) < casLen {
+		return nil
+	}
+	cas := body[:casLen]
+	for len(cas) > 0 {
+		if len(cas) < 2 {
+			return nil
+		}
+		caLen := int(binary.BigEndian.Uint16(cas))
+		cas = cas[2:]
+		if len(cas) < caLen {
+			return nil
+		}
+		ret.CertificateAuthorities = append(ret.CertificateAuthorities, distinguishedNameString(cas[:caLen]))
+		cas = cas[caLen:]
+	}
+	return ret
+}
+
+// distinguishedNameString renders a DER-encoded distinguished name, falling
+// back to hex when it cannot be parsed.
+func distinguishedNameString(der []byte) string {
+	var rdns pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(der, &rdns); err != nil || len(rest) > 0 {
+		return "hex:" + hex.EncodeToString(der)
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdns)
+	return name.String()
+}
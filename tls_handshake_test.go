@@ -0,0 +1,129 @@
+package zgrab2
+
+import (
+	gotls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"testing"
+
+	"github.com/Positive-Engineer/zgrab2/lib/testutil"
+)
+
+func TestParseCertificateRequest(t *testing.T) {
+	name := pkix.Name{CommonName: "Test CA", Organization: []string{"Example"}}
+	dn, err := asn1.Marshal(name.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte{
+		2, 1, 64, // certificate_types: rsa_sign, ecdsa_sign
+		0, 4, 4, 1, 4, 3, // signature_algorithms: sha256/rsa, sha256/ecdsa
+	}
+	body = append(body, byte((len(dn)+2)>>8), byte(len(dn)+2))
+	body = append(body, byte(len(dn)>>8), byte(len(dn)))
+	body = append(body, dn...)
+
+	req := parseCertificateRequest(body, true)
+	if req == nil {
+		t.Fatal("failed to parse CertificateRequest")
+	}
+	if len(req.CertificateTypes) != 2 || req.CertificateTypes[0] != 1 || req.CertificateTypes[1] != 64 {
+		t.Errorf("wrong certificate types: %v", req.CertificateTypes)
+	}
+	if len(req.SignatureAndHashes) != 2 || req.SignatureAndHashes[1].Hash != 4 || req.SignatureAndHashes[1].Signature != 3 {
+		t.Errorf("wrong signature algorithms: %v", req.SignatureAndHashes)
+	}
+	if len(req.CertificateAuthorities) != 1 || req.CertificateAuthorities[0] != "CN=Test CA,O=Example" {
+		t.Errorf("wrong certificate authorities: %v", req.CertificateAuthorities)
+	}
+
+	if parseCertificateRequest(body[:len(body)-1], true) != nil {
+		t.Error("parsed truncated CertificateRequest")
+	}
+}
+
+// serveClientAuth accepts one TLS connection between minVersion and
+// maxVersion, asking for a client certificate issued by the CA named
+// "Client CA".
+func serveClientAuth(t *testing.T, minVersion, maxVersion uint16) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	ca, err := x509.ParseCertificate(testutil.Certificate(t, "Client CA").Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	cfg := &gotls.Config{
+		Certificates: []gotls.Certificate{testutil.Certificate(t, "server.example.com")},
+		ClientAuth:   gotls.RequestClientCert,
+		ClientCAs:    pool,
+		MinVersion:   minVersion,
+		MaxVersion:   maxVersion,
+	}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		gotls.Server(conn, cfg).Handshake()
+	}()
+	return listener.Addr().String()
+}
+
+func TestHandshakeCertificateRequest(t *testing.T) {
+	tests := []struct {
+		name                   string
+		minVersion, maxVersion uint16
+		recorded               bool
+	}{
+		{"TLS 1.2", gotls.VersionTLS12, gotls.VersionTLS12, true},
+		// A server also offering TLS 1.3 negotiates TLS 1.2 with the zcrypto
+		// client, which does not implement TLS 1.3.
+		{"TLS 1.2-1.3", gotls.VersionTLS12, gotls.VersionTLS13, true},
+		// With TLS 1.3 only, the handshake fails before the (encrypted)
+		// CertificateRequest.
+		{"TLS 1.3", gotls.VersionTLS13, gotls.VersionTLS13, false},
+	}
+	for _, test := range tests {
+		conn, err := net.Dial("tcp", serveClientAuth(t, test.minVersion, test.maxVersion))
+		if err != nil {
+			t.Fatal(err)
+		}
+		flags := new(TLSFlags)
+		cfg, err := flags.GetTLSConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConn := flags.GetWrappedConnection(conn, cfg)
+		err = tlsConn.Handshake()
+		tlsConn.Close()
+		if (err == nil) != test.recorded {
+			t.Errorf("%s: handshake error %v", test.name, err)
+		}
+		req := tlsConn.GetLog().CertificateRequest
+		if !test.recorded {
+			if req != nil {
+				t.Errorf("%s: unexpected CertificateRequest %+v", test.name, req)
+			}
+			continue
+		}
+		if req == nil {
+			t.Errorf("%s: CertificateRequest not recorded", test.name)
+			continue
+		}
+		if len(req.CertificateTypes) == 0 || len(req.SignatureAndHashes) == 0 {
+			t.Errorf("%s: unexpected CertificateRequest %+v", test.name, req)
+		}
+		if len(req.CertificateAuthorities) != 1 || req.CertificateAuthorities[0] != "CN=Client CA" {
+			t.Errorf("%s: got authorities %v", test.name, req.CertificateAuthorities)
+		}
+	}
+}
@@ -212,6 +212,14 @@ func IsTimeoutError(err error) bool {
 	return false
 }
 
+// TruncatedByTimeout returns true if err is a timeout that interrupted a
+// read after n bytes had already arrived. Scanners should then keep the
+// partial data and flag it (as truncated_by_timeout) instead of failing the
+// scan and discarding it.
+func TruncatedByTimeout(n int, err error) bool {
+	return n > 0 && IsTimeoutError(err)
+}
+
 // LogPanic is intended to be called from within defer -- if there was no panic, it returns without
 // doing anything. Otherwise, it logs the stacktrace, the panic error, and the provided message
 // before re-raising the original panic.
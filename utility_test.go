@@ -0,0 +1,33 @@
+package zgrab2
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTruncatedByTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go server.Write([]byte("220-first line\r\n220-sec"))
+
+	client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	buf := make([]byte, 1024)
+	n, err := ReadUntilRegex(client, buf, regexp.MustCompile(`(?m)^\d{3} .*\r\n$`))
+	if !TruncatedByTimeout(n, err) {
+		t.Fatalf("expected a truncated read, got %d bytes, %v", n, err)
+	}
+	if string(buf[:n]) != "220-first line\r\n220-sec" {
+		t.Errorf("got %q", buf[:n])
+	}
+
+	if TruncatedByTimeout(0, err) {
+		t.Error("a timeout without data is not a truncated read")
+	}
+	if TruncatedByTimeout(n, errors.New("connection reset")) {
+		t.Error("a non-timeout error is not a truncated read")
+	}
+}
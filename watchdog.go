@@ -0,0 +1,126 @@
+package zgrab2
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRuntimes holds the --max-runtime of each registered scanner, by name.
+var maxRuntimes = make(map[string]time.Duration)
+
+// abandonedScans counts the Scan calls stopped by the watchdog.
+var abandonedScans int64
+
+// SetMaxRuntime records the --max-runtime of the named scanner from its
+// flags. Without one, the scanner uses --watchdog-timeout.
+func SetMaxRuntime(name string, flags ScanFlags) {
+	if f, ok := flags.(interface{ GetMaxRuntime() time.Duration }); ok && f.GetMaxRuntime() > 0 {
+		maxRuntimes[name] = f.GetMaxRuntime()
+	}
+}
+
+// connTracker records the connections opened through a ScanTarget, so that
+// the watchdog can close them and unblock a scan stuck on I/O.
+type connTracker struct {
+	mutex  sync.Mutex
+	conns  []net.Conn
+	closed *ScanError
+}
+
+// track adds conn to the tracker, closing it at once if the watchdog has
+// already fired.
+func (t *connTracker) track(conn net.Conn, err error) (net.Conn, error) {
+	if t == nil || conn == nil {
+		return conn, err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed != nil {
+		conn.Close()
+		return nil, t.closed
+	}
+	t.conns = append(t.conns, conn)
+	return conn, err
+}
+
+// closeAll closes the connections, and those tracked later with the error
+// reason.
+func (t *connTracker) closeAll(reason *ScanError) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.closed = reason
+	for _, conn := range t.conns {
+		conn.Close()
+	}
+	t.conns = nil
+}
+
+var (
+	errWatchdog      = fmt.Errorf("scan stopped by the watchdog")
+	errTargetTimeout = fmt.Errorf("scan stopped by --target-timeout")
+	errInterrupted   = fmt.Errorf("scan interrupted")
+)
+
+// scan runs the scan of s with ctx.
+func scan(ctx context.Context, s Scanner, target ScanTarget) (ScanStatus, interface{}, error) {
+	target.ctx = ctx
+	if sc, ok := s.(ScannerContext); ok {
+		return sc.ScanContext(ctx, target)
+	}
+	return s.Scan(target)
+}
+
+// scanWithWatchdog runs the scan of s with ctx, giving up after limit or
+// when ctx is done. Go cannot kill the scan's goroutine, so the watchdog
+// closes the connections the scan opened through the target and abandons
+// it; its eventual result is discarded.
+func scanWithWatchdog(ctx context.Context, s Scanner, target ScanTarget, limit time.Duration) (ScanStatus, interface{}, error) {
+	parent := ctx
+	if limit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
+	if ctx.Done() == nil {
+		return scan(ctx, s, target)
+	}
+	tracker := new(connTracker)
+	target.conns = tracker
+	type scanResult struct {
+		status ScanStatus
+		result interface{}
+		err    error
+	}
+	done := make(chan scanResult, 1)
+	go func() {
+		status, result, err := scan(ctx, s, target)
+		done <- scanResult{status, result, err}
+	}()
+	select {
+	case r := <-done:
+		return r.status, r.result, r.err
+	case <-ctx.Done():
+	}
+	var reason *ScanError
+	switch {
+	case parent.Err() == context.Canceled:
+		reason = NewScanError(SCAN_CANCELED, errInterrupted)
+	case parent.Err() != nil:
+		reason = NewScanError(SCAN_WATCHDOG_TIMEOUT, errTargetTimeout)
+	default:
+		reason = NewScanError(SCAN_WATCHDOG_TIMEOUT, fmt.Errorf("%v after %s", errWatchdog, limit))
+	}
+	tracker.closeAll(reason)
+	if reason.Status == SCAN_CANCELED {
+		return reason.Unpack(nil)
+	}
+	n := atomic.AddInt64(&abandonedScans, 1)
+	log.Warnf("watchdog: %s scan of %s: %v (%d scans abandoned so far)", s.GetName(), target.String(), reason, n)
+	return reason.Unpack(nil)
+}
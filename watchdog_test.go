@@ -0,0 +1,77 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// hangingScanner blocks reading from a silent target for much longer than
+// the watchdog allows.
+type hangingScanner struct {
+	flags    BaseFlags
+	finished chan error
+}
+
+func (s *hangingScanner) Init(flags ScanFlags) error       { return nil }
+func (s *hangingScanner) InitPerSender(senderID int) error { return nil }
+func (s *hangingScanner) GetName() string                  { return "hanging" }
+func (s *hangingScanner) GetTrigger() string               { return "" }
+func (s *hangingScanner) Protocol() string                 { return "hanging" }
+
+func (s *hangingScanner) Scan(t ScanTarget) (ScanStatus, interface{}, error) {
+	conn, err := t.Open(&s.flags)
+	if err != nil {
+		return TryGetScanStatus(err), nil, err
+	}
+	_, err = conn.Read(make([]byte, 1))
+	s.finished <- err
+	return SCAN_SUCCESS, "done", nil
+}
+
+func TestWatchdog(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	port := uint(listener.Addr().(*net.TCPAddr).Port)
+	target := ScanTarget{IP: net.ParseIP("127.0.0.1"), Port: &port}
+	s := &hangingScanner{flags: BaseFlags{Timeout: time.Minute}, finished: make(chan error, 1)}
+
+	start := time.Now()
+	status, result, err := scanWithWatchdog(context.Background(), s, target, 100*time.Millisecond)
+	if status != SCAN_WATCHDOG_TIMEOUT || result != nil || err == nil {
+		t.Fatalf("got %s %v %v", status, result, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("watchdog fired after %s", elapsed)
+	}
+	// Closing the scan's connection unblocks the abandoned goroutine.
+	select {
+	case err := <-s.finished:
+		if err == nil {
+			t.Error("expected the read to fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("the abandoned scan is still blocked")
+	}
+
+	r := &Runner{maxRuntimes: map[string]time.Duration{"hanging": time.Minute}, watchdogTimeout: time.Second}
+	if limit := r.watchdogLimit("hanging"); limit != time.Minute {
+		t.Errorf("got limit %s", limit)
+	}
+	if limit := r.watchdogLimit("other"); limit != time.Second {
+		t.Errorf("got limit %s", limit)
+	}
+}
@@ -27,12 +27,24 @@ def FlagsSet(keys, **kwargs):
     }, **kwargs)
 
 
+# zgrab2/resolver.go: Resolution
+resolution = SubRecord({
+    "resolver": String(required=False, doc="The address of the resolver that answered."),
+    "cname_chain": ListOf(String(), required=False, doc="The names of the CNAME chain leading to the addresses."),
+    "ipv4": ListOf(IPv4Address(), required=False, doc="The IPv4 addresses of the domain."),
+    "ipv6": ListOf(IPv6Address(), required=False, doc="The IPv6 addresses of the domain."),
+    "error": String(required=False, doc="Set if the domain has no address of the selected families, in which case the target is not scanned."),
+}, required=False, doc="The resolution of the target's domain, with --resolve.")
+
 # zgrab2/processing.go: Grab
 grab_result = Record({
     # TODO: ip may be required; see https://github.com/zmap/zgrab2/issues/104
     "ip": IPv4Address(required=False, doc="The IP address of the target."),
     "domain": String(required=False, doc="The domain name of the target, if available."),
+    "port": Unsigned16BitInteger(required=False, doc="The port of the target, if given in the input."),
+    "resolution": resolution,
     "data": SubRecord(scan_response_types, doc="The scan data for this host."),
+    "schema_version": Unsigned32BitInteger(required=False, doc="The version of the schema of the record."),
 })
 
 # zgrab2/module.go: const SCAN_*
@@ -45,15 +57,67 @@ STATUS_VALUES = [
   "protocol-error",
   "application-error",
   "unknown-error",
+  "success-not-contain",
+  "watchdog-timeout",
+  "memory-limit",
+  "canceled",
+  "blocked",
+  "dns-error",
+  "connection-reset",
 ]
 
+# zgrab2/status.go: const ERROR_*
+ERROR_CATEGORIES = [
+  "dns",
+  "connection-refused",
+  "unreachable",
+  "timeout",
+  "reset",
+  "connection-closed",
+  "tls-alert",
+  "protocol-error",
+  "application-error",
+  "blocked",
+  "canceled",
+  "memory-limit",
+  "unknown",
+]
+
+# zgrab2/status.go: ErrorDetail
+error_detail = SubRecord({
+    "category": Enum(values=ERROR_CATEGORIES, doc="The class of the failure."),
+    "tls_alert": Unsigned8BitInteger(required=False, doc="The code of the TLS alert, with the tls-alert category."),
+    "message": String(doc="The error message."),
+}, required=False, doc="If the status was not success, error may contain information about the failure.")
+
+# zgrab2/recog.go: RecogMatch
+recog_match = SubRecord({
+    "field": String(doc="The path of the field in the result."),
+    "matches": String(doc="The kind of text recog matched the field as, e.g. http_header.server."),
+    "description": String(required=False, doc="The description of the fingerprint."),
+    "vendor": String(required=False, doc="The vendor of the fingerprint."),
+    "product": String(required=False, doc="The product of the fingerprint."),
+    "version": String(required=False, doc="The version of the fingerprint."),
+    "params": SubRecord({}, required=False, doc="All the parameters of the fingerprint."),  # TODO FIXME: unconstrained dict
+})
+
 # zgrab2/module.go: ScanResponse
 base_scan_response = SubRecord({
     "status": Enum(values=STATUS_VALUES, doc="The status of the request."),
     "protocol": String(doc="The identifier of the protocol being scanned."),
     "timestamp": DateTime(doc="The time the scan was started."),
     "result": SubRecord({}, required=False),  # This is overridden by the protocols' implementations
-    "error": String(required=False, doc="If the status was not success, error may contain information about the failure.")
+    "error": error_detail,
+    "timing": SubRecord({
+        "start": DateTime(doc="The time the scan started."),
+        "end": DateTime(doc="The time the scan ended."),
+        "duration_ms": Float(doc="The duration of the scan, in milliseconds."),
+        "dial_ms": Float(required=False, doc="The time spent connecting, over all the connections of the scan, in milliseconds."),
+        "tls_handshake_ms": Float(required=False, doc="The time spent in TLS handshakes, over all the connections of the scan, in milliseconds."),
+    }, required=False, doc="The timing of the scan."),
+    "local_addrs": ListOf(String(), required=False, doc="The local addresses of the scan's connections, with --record-local-addr."),
+    "chained_from": String(required=False, doc="The scanner whose result ran this one through --chain-rules."),
+    "fingerprints": ListOf(recog_match, required=False, doc="The recog fingerprints matching the result, with --recog-dir."),
     # TODO: error_component? domain?
 })
 
@@ -0,0 +1,157 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// zmapRecord is a ZMap result: the responding address and port, and
+// whether the probe succeeded and the response repeats an earlier one,
+// when ZMap outputs them.
+type zmapRecord struct {
+	saddr   string
+	sport   string
+	success string
+	repeat  string
+}
+
+// zmapTrue returns true for a ZMap boolean field that is set: true in JSON,
+// 1 or true in CSV.
+func zmapTrue(value string) bool {
+	value = strings.TrimSpace(value)
+	return value == "1" || value == "true"
+}
+
+// target returns the ScanTarget of a ZMap result, on defaultPort if it has
+// no sport, or false if the result is a failed probe or a repeat.
+func (r *zmapRecord) target(defaultPort uint) (*ScanTarget, bool, error) {
+	if (r.success != "" && !zmapTrue(r.success)) || zmapTrue(r.repeat) {
+		return nil, false, nil
+	}
+	ip := net.ParseIP(strings.TrimSpace(r.saddr))
+	if ip == nil {
+		return nil, false, fmt.Errorf("invalid saddr %q", r.saddr)
+	}
+	target := &ScanTarget{IP: ip}
+	if sport := strings.TrimSpace(r.sport); sport != "" {
+		port, err := strconv.ParseUint(sport, 10, 16)
+		if err != nil || port == 0 {
+			return nil, false, fmt.Errorf("invalid sport %q", r.sport)
+		}
+		p := uint(port)
+		target.Port = &p
+	} else if defaultPort != 0 {
+		p := defaultPort
+		target.Port = &p
+	}
+	return target, true, nil
+}
+
+// zmapJSONValue returns a JSON string unquoted, and other values, such as
+// numbers and booleans, as written.
+func zmapJSONValue(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// InputTargetsZMap is an InputTargetsFunc for --input-format zmap-json and
+// zmap-csv, which reads the output of ZMap from the input file.
+func InputTargetsZMap(ch chan<- ScanTarget) error {
+	if config.InputFormat == "zmap-json" {
+		return GetTargetsZMapJSON(config.inputFile, config.ZMapPort, ch)
+	}
+	return GetTargetsZMapCSV(config.inputFile, config.ZMapPort, ch)
+}
+
+// GetTargetsZMapJSON reads the JSON output of ZMap (-O json), one object
+// per line, and delivers a ScanTarget for each successful result that is not
+// a repeat: its saddr, on its sport, or on defaultPort (if not 0) without
+// one. Lines that cannot be parsed are skipped.
+func GetTargetsZMapJSON(source io.Reader, defaultPort uint, ch chan<- ScanTarget) error {
+	scanner := bufio.NewScanner(source)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			log.Errorf("parse error, skipping: %v", err)
+			continue
+		}
+		record := zmapRecord{
+			saddr:   zmapJSONValue(fields["saddr"]),
+			sport:   zmapJSONValue(fields["sport"]),
+			success: zmapJSONValue(fields["success"]),
+			repeat:  zmapJSONValue(fields["repeat"]),
+		}
+		target, ok, err := record.target(defaultPort)
+		if err != nil {
+			log.Errorf("parse error, skipping: %v", err)
+			continue
+		}
+		if ok {
+			ch <- *target
+		}
+	}
+	return scanner.Err()
+}
+
+// GetTargetsZMapCSV reads the CSV output of ZMap (-O csv), as
+// GetTargetsZMapJSON. The columns are named by the header row; without one,
+// the columns are saddr and optionally sport.
+func GetTargetsZMapCSV(source io.Reader, defaultPort uint, ch chan<- ScanTarget) error {
+	reader := csv.NewReader(source)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	columns := map[string]int{"saddr": 0, "sport": 1}
+	first := true
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if first {
+			first = false
+			if net.ParseIP(strings.TrimSpace(fields[0])) == nil {
+				columns = make(map[string]int)
+				for i, name := range fields {
+					columns[strings.TrimSpace(name)] = i
+				}
+				if _, ok := columns["saddr"]; !ok {
+					return fmt.Errorf("no saddr column in the ZMap header %q", fields)
+				}
+				continue
+			}
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return fields[i]
+			}
+			return ""
+		}
+		record := zmapRecord{saddr: field("saddr"), sport: field("sport"), success: field("success"), repeat: field("repeat")}
+		target, ok, err := record.target(defaultPort)
+		if err != nil {
+			log.Errorf("parse error, skipping: %v", err)
+			continue
+		}
+		if ok {
+			ch <- *target
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package zgrab2
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// zmapTargets returns the targets read by get from input, as ADDRESS:PORT
+// or ADDRESS.
+func zmapTargets(t *testing.T, get func(ch chan<- ScanTarget) error) []string {
+	ch := make(chan ScanTarget, 10)
+	if err := get(ch); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	var ret []string
+	for target := range ch {
+		if target.Port != nil {
+			ret = append(ret, fmt.Sprintf("%s:%d", target.IP, *target.Port))
+		} else {
+			ret = append(ret, target.IP.String())
+		}
+	}
+	return ret
+}
+
+func TestGetTargetsZMapJSON(t *testing.T) {
+	input := `{"saddr": "192.0.2.1", "sport": 443, "classification": "synack", "success": true}
+{"saddr": "192.0.2.2", "sport": 80, "classification": "rst", "success": false}
+{"saddr": "192.0.2.1", "sport": 443, "success": true, "repeat": true}
+{"saddr": "192.0.2.3", "sport": "8080"}
+not json
+{"saddr": "2001:db8::1"}
+`
+	targets := zmapTargets(t, func(ch chan<- ScanTarget) error {
+		return GetTargetsZMapJSON(strings.NewReader(input), 22, ch)
+	})
+	expected := []string{"192.0.2.1:443", "192.0.2.3:8080", "2001:db8::1:22"}
+	if fmt.Sprint(targets) != fmt.Sprint(expected) {
+		t.Errorf("got %v, expected %v", targets, expected)
+	}
+}
+
+func TestGetTargetsZMapCSV(t *testing.T) {
+	input := `sport,saddr,success,repeat
+443,192.0.2.1,1,0
+80,192.0.2.2,0,0
+443,192.0.2.1,1,1
+`
+	targets := zmapTargets(t, func(ch chan<- ScanTarget) error {
+		return GetTargetsZMapCSV(strings.NewReader(input), 0, ch)
+	})
+	if expected := []string{"192.0.2.1:443"}; fmt.Sprint(targets) != fmt.Sprint(expected) {
+		t.Errorf("got %v, expected %v", targets, expected)
+	}
+
+	// Without a header, the columns are saddr and sport.
+	targets = zmapTargets(t, func(ch chan<- ScanTarget) error {
+		return GetTargetsZMapCSV(strings.NewReader("192.0.2.1\n192.0.2.2,8443\n"), 0, ch)
+	})
+	if expected := []string{"192.0.2.1", "192.0.2.2:8443"}; fmt.Sprint(targets) != fmt.Sprint(expected) {
+		t.Errorf("got %v, expected %v", targets, expected)
+	}
+
+	ch := make(chan ScanTarget, 1)
+	if err := GetTargetsZMapCSV(strings.NewReader("daddr,dport\n"), 0, ch); err == nil {
+		t.Error("header without saddr accepted")
+	}
+}